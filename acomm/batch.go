@@ -0,0 +1,210 @@
+package acomm
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/url"
+
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/logrusx"
+)
+
+// ReadConnRequests reads a message of either a single request or a batch
+// (array) of requests from the connection. It returns the requests, whether
+// the message was a batch, and the codec it was encoded with, so the reply can
+// take the matching form: a single response, or an array of responses in the
+// order of the requests.
+func ReadConnRequests(conn net.Conn) ([]*Request, bool, Codec, error) {
+	return readConnRequests(conn, readOptions{})
+}
+
+// readConnRequests reads a message of either a single request or a batch of
+// requests from the connection.
+func readConnRequests(conn net.Conn, opts readOptions) ([]*Request, bool, Codec, error) {
+	codec, payload, err := readFrame(conn, opts)
+	if err != nil {
+		return nil, false, codec, err
+	}
+	reqs, batch, err := unmarshalRequests(codec, payload)
+	return reqs, batch, codec, err
+}
+
+// UnmarshalRequests unmarshals JSON data of either a single request or a batch
+// (array) of requests, returning whether it was a batch. If a single request
+// fails to unmarshal, it is still returned so an error response can be made.
+func UnmarshalRequests(data []byte) ([]*Request, bool, error) {
+	return unmarshalRequests(CodecJSON, data)
+}
+
+func unmarshalRequests(codec Codec, data []byte) ([]*Request, bool, error) {
+	if !isArray(codec, data) {
+		req := &Request{codec: codec}
+		return []*Request{req}, false, codec.unmarshal(data, req)
+	}
+
+	var reqs []*Request
+	if err := codec.unmarshal(data, &reqs); err != nil {
+		return nil, true, err
+	}
+	for i, req := range reqs {
+		// An empty request fails validation, giving null entries an error
+		// response in their place
+		if req == nil {
+			reqs[i] = &Request{}
+		}
+		reqs[i].codec = codec
+	}
+	return reqs, true, nil
+}
+
+// isArray returns whether the encoded data is an array rather than an object.
+func isArray(codec Codec, data []byte) bool {
+	if codec == CodecJSON {
+		data = bytes.TrimLeft(data, " \t\r\n")
+	}
+	if len(data) == 0 {
+		return false
+	}
+
+	switch codec {
+	case CodecJSON:
+		return data[0] == '['
+	case CodecCBOR:
+		// Major type 4
+		return data[0]&0xe0 == 0x80
+	case CodecMsgpack:
+		// fixarray, array 16, or array 32
+		return data[0]&0xf0 == 0x90 || data[0] == 0xdc || data[0] == 0xdd
+	default:
+		return false
+	}
+}
+
+// SendBatch sends a batch of requests to a coordinator in a single message
+// rather than one per request. Each request is handled independently, and the
+// errors of their initial responses are returned in the order of the requests.
+// An error is returned instead if the batch as a whole could not be sent. Over
+// a unix socket, the batch is sent with the DefaultCodec.
+func SendBatch(addr *url.URL, reqs []*Request) ([]error, error) {
+	return sendBatch(addr, DefaultCodec, reqs)
+}
+
+// sendBatch sends a batch of requests, with the codec if over a unix socket.
+func sendBatch(addr *url.URL, codec Codec, reqs []*Request) ([]error, error) {
+	if addr == nil {
+		return nil, errors.New("missing addr")
+	}
+
+	var resps []*Response
+	var err error
+	switch addr.Scheme {
+	case "unix":
+		resps, err = sendBatchUnix(addr, codec, reqs)
+	case "http", "https":
+		resps, err = sendBatchHTTP(addr, reqs)
+	default:
+		return nil, errors.Newv("unknown url scheme", map[string]interface{}{"addr": addr})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resps) != len(reqs) {
+		return nil, errors.Newv("batch response count does not match requests", map[string]interface{}{
+			"addr":      addr,
+			"requests":  len(reqs),
+			"responses": len(resps),
+		})
+	}
+	errs := make([]error, len(reqs))
+	for i, resp := range resps {
+		if resp == nil {
+			errs[i] = errors.Newv("missing batch response", map[string]interface{}{"requestID": reqs[i].ID})
+			continue
+		}
+		errs[i] = errors.ResetStack(resp.Error)
+	}
+	return errs, nil
+}
+
+// sendBatchUnix sends a batch of requests via a Unix socket. If the peer does
+// not accept the codec, the batch is sent again as JSON.
+func sendBatchUnix(addr *url.URL, codec Codec, reqs []*Request) ([]*Response, error) {
+	resps, err := sendBatchUnixCodec(addr, codec, reqs)
+	if codec != CodecJSON && isUnsupportedCodec(err) {
+		resps, err = sendBatchUnixCodec(addr, CodecJSON, reqs)
+	}
+	return resps, err
+}
+
+// sendBatchUnixCodec sends a batch of requests via a Unix socket with the
+// codec.
+func sendBatchUnixCodec(addr *url.URL, codec Codec, reqs []*Request) ([]*Response, error) {
+	conn, err := net.Dial("unix", addr.RequestURI())
+	if err != nil {
+		// Nothing was sent, so it is safe to try again
+		return nil, errors.WithCode(NewTemporaryError(err.Error(), map[string]interface{}{"addr": addr}), errors.CodeUnavailable)
+	}
+	defer logrusx.LogReturnedErr(conn.Close,
+		map[string]interface{}{"addr": addr},
+		"failed to close unix connection",
+	)
+
+	if err := WriteConnData(conn, codec, reqs); err != nil {
+		return nil, err
+	}
+
+	replyCodec, payload, err := readFrame(conn, readOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalResponses(replyCodec, payload)
+}
+
+// sendBatchHTTP sends a batch of requests via HTTP/HTTPS.
+func sendBatchHTTP(addr *url.URL, reqs []*Request) ([]*Response, error) {
+	payloadJSON, err := json.Marshal(reqs)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	httpResp, err := httpClient().Post(addr.String(), "application/json", bytes.NewReader(payloadJSON))
+	if err != nil {
+		errData := map[string]interface{}{"addr": addr}
+		if isDialError(err) {
+			// Nothing was sent, so it is safe to try again
+			return nil, errors.WithCode(NewTemporaryError(err.Error(), errData), errors.CodeUnavailable)
+		}
+		return nil, errors.Wrapv(err, errData)
+	}
+	defer logrusx.LogReturnedErr(httpResp.Body.Close, nil, "failed to close http body")
+
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"addr": addr})
+	}
+	return unmarshalResponses(CodecJSON, body)
+}
+
+// unmarshalResponses unmarshals the reply to a batch. A single response in
+// place of an array means the batch as a whole was rejected.
+func unmarshalResponses(codec Codec, data []byte) ([]*Response, error) {
+	if !isArray(codec, data) {
+		resp := &Response{}
+		if err := codec.unmarshal(data, resp); err != nil {
+			return nil, err
+		}
+		if resp.Error != nil {
+			return nil, errors.ResetStack(resp.Error)
+		}
+		return nil, errors.New("expected batch response")
+	}
+
+	var resps []*Response
+	if err := codec.unmarshal(data, &resps); err != nil {
+		return nil, err
+	}
+	return resps, nil
+}
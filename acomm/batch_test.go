@@ -0,0 +1,238 @@
+package acomm_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type BatchTestSuite struct {
+	suite.Suite
+	Listener *acomm.UnixListener
+	Server   *httptest.Server
+	Tracker  *acomm.Tracker
+	Batches  chan bool
+}
+
+func TestBatchTestSuite(t *testing.T) {
+	suite.Run(t, new(BatchTestSuite))
+}
+
+func (s *BatchTestSuite) SetupSuite() {
+	logrus.SetLevel(logrus.FatalLevel)
+	s.Batches = make(chan bool, 10)
+
+	f, err := ioutil.TempFile("", "acommTest-")
+	s.Require().NoError(err, "failed to create test unix socket")
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+	s.Listener = acomm.NewUnixListener(f.Name()+".sock", 0)
+	s.Require().NoError(s.Listener.Start(), "failed to start listener")
+
+	go func() {
+		for {
+			conn := s.Listener.NextConn()
+			if conn == nil {
+				return
+			}
+			reqs, batch, codec, err := acomm.ReadConnRequests(conn)
+			s.Batches <- batch
+			if err != nil {
+				_ = acomm.WriteConnData(conn, codec, &acomm.Response{Error: err})
+				s.Listener.DoneConn(conn)
+				continue
+			}
+			resps := handleBatch(reqs)
+			if batch {
+				_ = acomm.WriteConnData(conn, codec, resps)
+			} else {
+				_ = acomm.WriteConnData(conn, codec, resps[0])
+			}
+			s.Listener.DoneConn(conn)
+			respondBatch(reqs, resps)
+		}
+	}()
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		reqs, batch, err := acomm.UnmarshalRequests(body)
+		s.Batches <- batch
+		if err != nil {
+			data, _ := json.Marshal(&acomm.Response{Error: err})
+			_, _ = w.Write(data)
+			return
+		}
+		resps := handleBatch(reqs)
+		var data []byte
+		if batch {
+			data, _ = json.Marshal(resps)
+		} else {
+			data, _ = json.Marshal(resps[0])
+		}
+		_, _ = w.Write(data)
+		respondBatch(reqs, resps)
+	}))
+
+	s.Tracker, err = acomm.NewTracker("", nil, nil, 5*time.Second)
+	s.Require().NoError(err, "failed to create tracker")
+	s.Require().NoError(s.Tracker.Start(), "failed to start tracker")
+}
+
+func (s *BatchTestSuite) TearDownSuite() {
+	s.Listener.Stop(0)
+	s.Server.Close()
+	s.Tracker.Stop()
+}
+
+func (s *BatchTestSuite) TearDownTest() {
+	acomm.DefaultCodec = acomm.CodecJSON
+	for len(s.Batches) > 0 {
+		<-s.Batches
+	}
+}
+
+// handleBatch acks requests for the "fail" task with an error and the rest
+// successfully.
+func handleBatch(reqs []*acomm.Request) []*acomm.Response {
+	resps := make([]*acomm.Response, len(reqs))
+	for i, req := range reqs {
+		var err error
+		if req.Task == "fail" {
+			err = errors.NewWithCode(errors.CodeInvalidArgument, "failed", nil)
+		}
+		resps[i], _ = acomm.NewResponse(req, nil, nil, err)
+	}
+	return resps
+}
+
+// respondBatch sends the task as the result of each successfully acked request
+// to its response hook.
+func respondBatch(reqs []*acomm.Request, acks []*acomm.Response) {
+	for i, req := range reqs {
+		if acks[i].Error != nil || req.ResponseHook == nil {
+			continue
+		}
+		resp, _ := acomm.NewResponse(req, req.Task, nil, nil)
+		_ = acomm.Send(req.ResponseHook, resp)
+	}
+}
+
+func (s *BatchTestSuite) TestUnmarshalRequests() {
+	tests := []struct {
+		description string
+		data        string
+		batch       bool
+		count       int
+		expectedErr bool
+	}{
+		{"single", `{"id":"1","task":"foo"}`, false, 1, false},
+		{"batch", ` [{"id":"1","task":"foo"},{"id":"2","task":"bar"}]`, true, 2, false},
+		{"empty batch", `[]`, true, 0, false},
+		{"null entry", `[{"id":"1","task":"foo"},null]`, true, 2, false},
+		{"invalid single", `{"id":1}`, false, 1, true},
+		{"invalid batch", `[{"id":1}]`, true, 0, true},
+	}
+
+	for _, test := range tests {
+		msg := testMsgFunc(test.description)
+		reqs, batch, err := acomm.UnmarshalRequests([]byte(test.data))
+		s.Equal(test.batch, batch, msg("should have detected batch"))
+		if test.expectedErr {
+			s.Error(err, msg("should have failed to unmarshal"))
+		} else {
+			s.NoError(err, msg("should have unmarshalled"))
+		}
+		s.Len(reqs, test.count, msg("should have returned the requests"))
+		for _, req := range reqs {
+			s.NotNil(req, msg("should not return nil requests"))
+		}
+	}
+}
+
+func (s *BatchTestSuite) TestSendBatch() {
+	httpAddr, _ := url.ParseRequestURI(s.Server.URL)
+
+	tests := []struct {
+		description string
+		addr        *url.URL
+		codec       acomm.Codec
+	}{
+		{"unix json", s.Listener.URL(), acomm.CodecJSON},
+		{"unix cbor", s.Listener.URL(), acomm.CodecCBOR},
+		{"unix msgpack", s.Listener.URL(), acomm.CodecMsgpack},
+		{"http", httpAddr, acomm.CodecJSON},
+	}
+
+	for _, test := range tests {
+		msg := testMsgFunc(test.description)
+		acomm.DefaultCodec = test.codec
+
+		var reqs []*acomm.Request
+		for _, task := range []string{"foo", "fail", "bar"} {
+			req, err := acomm.NewRequest(acomm.RequestOptions{Task: task})
+			s.Require().NoError(err, msg("should have created request"))
+			reqs = append(reqs, req)
+		}
+
+		errs, err := acomm.SendBatch(test.addr, reqs)
+		if !s.NoError(err, msg("should have sent batch")) {
+			continue
+		}
+		s.True(<-s.Batches, msg("should have been received as a batch"))
+		if !s.Len(errs, 3, msg("should have an error per request")) {
+			continue
+		}
+		s.NoError(errs[0], msg("should have acked request"))
+		s.True(errors.IsCode(errs[1], errors.CodeInvalidArgument), msg("should have request error"))
+		s.NoError(errs[2], msg("should have acked request"))
+
+		// A single request is still handled
+		s.NoError(acomm.Send(test.addr, reqs[0]), msg("should have sent single request"))
+		s.False(<-s.Batches, msg("should not have been received as a batch"))
+	}
+
+	down, _ := url.ParseRequestURI("unix:///does/not/exist.sock")
+	_, err := acomm.SendBatch(down, []*acomm.Request{{ID: "1", Task: "foo"}})
+	s.True(acomm.IsTemporary(err), "should be temporary when the destination is down")
+}
+
+func (s *BatchTestSuite) TestMultiRequestSendRequests() {
+	multiRequest := acomm.NewMultiRequest(context.Background(), s.Tracker, 5*time.Second)
+
+	requests := make(map[string]*acomm.Request)
+	for _, task := range []string{"foo", "fail", "bar"} {
+		req, err := acomm.NewRequest(acomm.RequestOptions{Task: task})
+		s.Require().NoError(err)
+		requests[task] = req
+	}
+
+	errs := multiRequest.SendRequests(s.Listener.URL(), requests)
+	s.True(<-s.Batches, "should have been sent as a batch")
+	if s.Len(errs, 1, "should have an error for the failed request") {
+		s.True(errors.IsCode(errs["fail"], errors.CodeInvalidArgument))
+	}
+
+	responses := multiRequest.Responses()
+	s.Len(responses, 2, "should have responses for the sent requests")
+	for _, name := range []string{"foo", "bar"} {
+		resp := responses[name]
+		if !s.NotNil(resp, name) {
+			continue
+		}
+		var result string
+		s.NoError(resp.UnmarshalResult(&result), name)
+		s.Equal(name, result)
+	}
+	s.Equal(0, s.Tracker.NumRequests())
+}
@@ -0,0 +1,51 @@
+package acomm
+
+import "github.com/cerana/cerana/pkg/errors"
+
+// CancelTask is the reserved task name for cancelling an in-flight request.
+// A cancel request is routed like any other task request, following the
+// original request to the provider handling it.
+const CancelTask = "cancel"
+
+// errorCodeCancelled is the response error code identifying a CancelledError.
+const errorCodeCancelled = "cancelled"
+
+// CancelArgs are the arguments for a CancelTask request.
+type CancelArgs struct {
+	RequestID string `json:"requestID"`
+}
+
+// NewCancelRequest creates a request to cancel the in-flight request with the
+// given ID.
+func NewCancelRequest(requestID string, opts RequestOptions) (*Request, error) {
+	if requestID == "" {
+		return nil, errors.New("missing request id to cancel")
+	}
+	opts.Task = CancelTask
+	opts.Args = &CancelArgs{RequestID: requestID}
+	return NewRequest(opts)
+}
+
+// CancelledError is the error sent in the response to a request that was
+// cancelled before completion. It is preserved across the wire when sent as a
+// Response error.
+type CancelledError struct {
+	Message string `json:"message"`
+}
+
+// NewCancelledError creates a new CancelledError with a callstack.
+func NewCancelledError(msg string, values map[string]interface{}) error {
+	return errors.Wrapv(&CancelledError{Message: msg}, values)
+}
+
+// Error returns the error message.
+func (e *CancelledError) Error() string {
+	return e.Message
+}
+
+// IsCancelled returns whether the error, or its underlying cause, is a
+// CancelledError.
+func IsCancelled(err error) bool {
+	_, ok := errors.Cause(err).(*CancelledError)
+	return ok
+}
@@ -0,0 +1,90 @@
+package acomm
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/cerana/cerana/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// Client makes synchronous task requests through a coordinator. It is the
+// transport shared by the typed clients of the providers.
+type Client struct {
+	tracker        *Tracker
+	coordinatorURL *url.URL
+	timeout        time.Duration
+}
+
+// NewClient creates a new Client sending requests to the coordinator and
+// tracking their responses with the tracker, which must be started.
+func NewClient(tracker *Tracker, coordinatorURL *url.URL, timeout time.Duration) *Client {
+	return &Client{
+		tracker:        tracker,
+		coordinatorURL: coordinatorURL,
+		timeout:        timeout,
+	}
+}
+
+// Tracker returns the client's tracker.
+func (c *Client) Tracker() *Tracker {
+	return c.tracker
+}
+
+// Call requests the task with the args and unmarshals the result into result,
+// unless it is nil. A non-nil taskURL sends the request on to the coordinator
+// at that url, such as one on another node.
+func (c *Client) Call(ctx context.Context, task string, taskURL *url.URL, args, result interface{}) error {
+	_, err := c.Do(ctx, RequestOptions{
+		Task:    task,
+		TaskURL: taskURL,
+		Args:    args,
+	}, result)
+	return err
+}
+
+// Do makes a request with the options and unmarshals the result into result,
+// unless it is nil. The response is returned for access to its stream url.
+func (c *Client) Do(ctx context.Context, opts RequestOptions, result interface{}) (*Response, error) {
+	resp, err := c.tracker.SyncRequest(ctx, c.coordinatorURL, opts, c.timeout)
+	if err != nil {
+		return resp, err
+	}
+	if result != nil {
+		if err := resp.UnmarshalResult(result); err != nil {
+			return resp, errors.Wrapv(err, map[string]interface{}{"task": opts.Task})
+		}
+	}
+	return resp, nil
+}
+
+// CallBatch requests the task once for each of the named args, sending the
+// requests to the coordinator in a single batch. The errors of requests that
+// could not be sent or that failed are returned, keyed on name.
+func (c *Client) CallBatch(ctx context.Context, task string, args map[string]interface{}) map[string]error {
+	multiRequest := NewMultiRequest(ctx, c.tracker, c.timeout)
+
+	errs := make(map[string]error)
+	requests := make(map[string]*Request, len(args))
+	for name, arg := range args {
+		req, err := NewRequest(RequestOptions{
+			Task: task,
+			Args: arg,
+		})
+		if err != nil {
+			errs[name] = err
+			continue
+		}
+		requests[name] = req
+	}
+
+	for name, err := range multiRequest.SendRequests(c.coordinatorURL, requests) {
+		errs[name] = err
+	}
+	for name, resp := range multiRequest.Responses() {
+		if resp.Error != nil {
+			errs[name] = resp.Error
+		}
+	}
+	return errs
+}
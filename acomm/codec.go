@@ -0,0 +1,176 @@
+package acomm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/ugorji/go/codec"
+)
+
+// Codec identifies the encoding of messages sent over unix sockets. With a
+// binary codec, the whole message is encoded with the codec, including request
+// args and response results.
+type Codec byte
+
+// Supported codecs. JSON is the default and the only one understood by peers
+// without v2 framing.
+const (
+	CodecJSON Codec = iota
+	CodecCBOR
+	CodecMsgpack
+)
+
+// Handles for the binary codecs. Messages are converted to their JSON data
+// model before being encoded, so only maps, arrays, strings, numbers, booleans,
+// and nulls are encoded, and are decoded back into the same.
+var (
+	cborHandle    = &codec.CborHandle{}
+	msgpackHandle = &codec.MsgpackHandle{WriteExt: true, RawToString: true}
+)
+
+func init() {
+	mapType := reflect.TypeOf(map[string]interface{}(nil))
+	cborHandle.MapType = mapType
+	msgpackHandle.MapType = mapType
+}
+
+// errorCodeUnsupportedCodec is the response error code of a message rejected
+// because its codec is not accepted, so the sender can send it again as JSON.
+const errorCodeUnsupportedCodec = "unsupported_codec"
+
+// newUnsupportedCodecError creates a new error for a message with a codec that
+// is not accepted.
+func newUnsupportedCodecError(codec Codec) error {
+	return errors.NewWithCode(errorCodeUnsupportedCodec, "unsupported codec", map[string]interface{}{"codec": codec.String()})
+}
+
+// isUnsupportedCodec returns whether the error is the response to a message
+// with a codec that was not accepted.
+func isUnsupportedCodec(err error) bool {
+	return errors.IsCode(err, errorCodeUnsupportedCodec)
+}
+
+// String returns the name of the codec.
+func (c Codec) String() string {
+	switch c {
+	case CodecJSON:
+		return "json"
+	case CodecCBOR:
+		return "cbor"
+	case CodecMsgpack:
+		return "msgpack"
+	default:
+		return fmt.Sprintf("codec(%d)", byte(c))
+	}
+}
+
+// ParseCodec returns the codec with the name.
+func ParseCodec(name string) (Codec, error) {
+	for _, c := range []Codec{CodecJSON, CodecCBOR, CodecMsgpack} {
+		if c.String() == name {
+			return c, nil
+		}
+	}
+	return CodecJSON, errors.Newv("unknown codec", map[string]interface{}{"codec": name})
+}
+
+func (c Codec) handle() codec.Handle {
+	switch c {
+	case CodecCBOR:
+		return cborHandle
+	case CodecMsgpack:
+		return msgpackHandle
+	default:
+		return nil
+	}
+}
+
+// supported returns whether the codec is known.
+func (c Codec) supported() bool {
+	return c == CodecJSON || c.handle() != nil
+}
+
+// marshal encodes the value with the codec. For binary codecs, the value is
+// marshalled to JSON first so its JSON marshalling and tags apply, and the
+// resulting data is encoded natively, args and results included.
+func (c Codec) marshal(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || c == CodecJSON {
+		return data, errors.Wrap(err)
+	}
+
+	h := c.handle()
+	if h == nil {
+		return nil, errors.Newv("unknown codec", map[string]interface{}{"codec": c.String()})
+	}
+	native, err := decodeJSONNative(data)
+	if err != nil {
+		return nil, err
+	}
+	var encoded []byte
+	err = codec.NewEncoderBytes(&encoded, h).Encode(native)
+	return encoded, errors.Wrapv(err, map[string]interface{}{"codec": c.String()})
+}
+
+// unmarshal decodes data encoded with the codec into the value. Binary data is
+// converted to JSON first so the value's JSON unmarshalling applies.
+func (c Codec) unmarshal(data []byte, v interface{}) error {
+	if c == CodecJSON {
+		return errors.Wrap(json.Unmarshal(data, v))
+	}
+
+	h := c.handle()
+	if h == nil {
+		return errors.Newv("unknown codec", map[string]interface{}{"codec": c.String()})
+	}
+	var native interface{}
+	if err := codec.NewDecoderBytes(data, h).Decode(&native); err != nil {
+		return errors.Wrapv(err, map[string]interface{}{"codec": c.String()})
+	}
+	jsonData, err := json.Marshal(native)
+	if err != nil {
+		return errors.Wrapv(err, map[string]interface{}{"codec": c.String()})
+	}
+	return errors.Wrap(json.Unmarshal(jsonData, v))
+}
+
+// decodeJSONNative decodes JSON data into its data model, with numbers as
+// integers where they are whole so they are encoded as such.
+func decodeJSONNative(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return nativeNumbers(v), nil
+}
+
+// nativeNumbers replaces the json.Numbers in decoded JSON data with integers
+// or floats.
+func nativeNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, elem := range value {
+			value[key] = nativeNumbers(elem)
+		}
+	case []interface{}:
+		for i, elem := range value {
+			value[i] = nativeNumbers(elem)
+		}
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(value), 10, 64); err == nil {
+			return u
+		}
+		f, _ := value.Float64()
+		return f
+	}
+	return v
+}
@@ -0,0 +1,82 @@
+package acomm
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported stream encodings, in order of preference.
+const (
+	EncodingZstd = "zstd"
+	EncodingGzip = "gzip"
+)
+
+// StreamEncodings are the compression encodings offered when retrieving a
+// stream over http, in order of preference.
+var StreamEncodings = []string{EncodingZstd, EncodingGzip}
+
+// negotiateEncoding picks the first supported encoding from an
+// Accept-Encoding header value. An empty string means no compression.
+func negotiateEncoding(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		encoding := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		switch encoding {
+		case EncodingZstd, EncodingGzip:
+			return encoding
+		}
+	}
+	return ""
+}
+
+// nopWriteCloser adds a no-op Close to an io.Writer.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// newEncoder wraps a writer with a compressor for the encoding. The returned
+// writer must be closed to flush the compressed data.
+func newEncoder(encoding string, w io.Writer) (io.WriteCloser, error) {
+	switch encoding {
+	case "":
+		return nopWriteCloser{w}, nil
+	case EncodingGzip:
+		return gzip.NewWriter(w), nil
+	case EncodingZstd:
+		enc, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, errors.Wrapv(err, map[string]interface{}{"encoding": encoding})
+		}
+		return enc, nil
+	default:
+		return nil, errors.Newv("unsupported encoding", map[string]interface{}{"encoding": encoding})
+	}
+}
+
+// newDecoder wraps a reader with a decompressor for the encoding.
+func newDecoder(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case "", "identity":
+		return ioutil.NopCloser(r), nil
+	case EncodingGzip:
+		dec, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, errors.Wrapv(err, map[string]interface{}{"encoding": encoding})
+		}
+		return dec, nil
+	case EncodingZstd:
+		dec, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, errors.Wrapv(err, map[string]interface{}{"encoding": encoding})
+		}
+		return dec.IOReadCloser(), nil
+	default:
+		return nil, errors.Newv("unsupported encoding", map[string]interface{}{"encoding": encoding})
+	}
+}
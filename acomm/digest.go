@@ -0,0 +1,150 @@
+package acomm
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+// HTTP trailers carrying the stream digest.
+const (
+	streamBytesHeader  = "X-Stream-Bytes"
+	streamSHA256Header = "X-Stream-Sha256"
+)
+
+// StreamDigest summarizes the uncompressed data of a stream. It is sent after
+// the data so readers can detect truncation or corruption.
+type StreamDigest struct {
+	Bytes  uint64 `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// Verify returns an error if the digests do not match.
+func (d *StreamDigest) Verify(expected *StreamDigest) error {
+	if expected == nil {
+		return errors.New("missing stream digest")
+	}
+	if *d != *expected {
+		return errors.Newv("stream digest mismatch", map[string]interface{}{
+			"expected": expected,
+			"actual":   d,
+		})
+	}
+	return nil
+}
+
+// setTrailer sets the digest as http trailers.
+func (d *StreamDigest) setTrailer(header http.Header) {
+	header.Set(streamBytesHeader, strconv.FormatUint(d.Bytes, 10))
+	header.Set(streamSHA256Header, d.SHA256)
+}
+
+// digestFromTrailer parses a digest from http trailers.
+func digestFromTrailer(trailer http.Header) (*StreamDigest, error) {
+	sum := trailer.Get(streamSHA256Header)
+	if sum == "" {
+		return nil, errors.New("missing stream digest")
+	}
+	n, err := strconv.ParseUint(trailer.Get(streamBytesHeader), 10, 64)
+	if err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"trailer": trailer}, "invalid stream byte count")
+	}
+	return &StreamDigest{Bytes: n, SHA256: sum}, nil
+}
+
+// digester computes a StreamDigest of the data written to it.
+type digester struct {
+	hash  hash.Hash
+	bytes uint64
+}
+
+func newDigester() *digester {
+	return &digester{hash: sha256.New()}
+}
+
+// Write adds data to the digest.
+func (d *digester) Write(p []byte) (int, error) {
+	n, _ := d.hash.Write(p)
+	d.bytes += uint64(n)
+	return n, nil
+}
+
+// Digest returns the digest of the data written so far.
+func (d *digester) Digest() *StreamDigest {
+	return &StreamDigest{
+		Bytes:  d.bytes,
+		SHA256: hex.EncodeToString(d.hash.Sum(nil)),
+	}
+}
+
+// chunkWriter frames data written to it as size-prefixed chunks, allowing
+// the end of the data to be marked so more can follow on the same connection.
+type chunkWriter struct {
+	w io.Writer
+}
+
+// Write writes p as a single chunk.
+func (cw *chunkWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(p)))
+	if _, err := cw.w.Write(size); err != nil {
+		return 0, errors.Wrap(err)
+	}
+	n, err := cw.w.Write(p)
+	return n, errors.Wrap(err)
+}
+
+// Close marks the end of the chunks.
+func (cw *chunkWriter) Close() error {
+	_, err := cw.w.Write(make([]byte, 4))
+	return errors.Wrap(err)
+}
+
+// chunkReader reads data framed by a chunkWriter, returning io.EOF at the end
+// marker and io.ErrUnexpectedEOF if the data ends without one.
+type chunkReader struct {
+	r         io.Reader
+	remaining uint32
+	done      bool
+}
+
+// Read reads chunk data.
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	if cr.done {
+		return 0, io.EOF
+	}
+
+	if cr.remaining == 0 {
+		size := make([]byte, 4)
+		if _, err := io.ReadFull(cr.r, size); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		cr.remaining = binary.BigEndian.Uint32(size)
+		if cr.remaining == 0 {
+			cr.done = true
+			return 0, io.EOF
+		}
+	}
+
+	if uint32(len(p)) > cr.remaining {
+		p = p[:cr.remaining]
+	}
+	n, err := cr.r.Read(p)
+	cr.remaining -= uint32(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
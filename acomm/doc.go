@@ -20,14 +20,115 @@ proxying requests that use an http response hook to one that uses a unix socket
 (provided by the tracker). It tracks the original request and returns a new
 request using its response listener as the response hook. When the response
 comes, it will then forward it along to the original response hook.
+With a journal set, proxied requests are also recorded on disk while tracked,
+and a restarted tracker tracks them again on Start so late responses are still
+forwarded. Those whose timeout passed while it was stopped get an error
+response.
+Requests and Streams describe the tracked requests and registered data
+streams for introspection, and ExpireRequest forces a tracked request to time
+out. Trackers also record Prometheus metrics (see package prometheusx) of the
+requests in flight, timeouts by task, the latency of proxied requests by task
+and outcome, and the bytes of streamed data served.
 
-In a similar vein, the tracker can set up ad-hoc unix listeners for streaming
-data, as well as proxy it to http. It includes an HTTP handler func for
-handling http stream requests.
+Requests are routed by a coordinator to a local provider of the task, or to
+another coordinator given by the TaskURL. A Target can be set instead of the
+TaskURL to name the node to run on, or a bundle or dataset on the node, which
+the coordinator resolves to the coordinator on that node.
+
+An in-flight request can be cancelled by sending a request for the reserved
+CancelTask with the ID of the request to cancel. The tracker records where each
+request was sent so cancel requests can follow the same route to the handler.
+The handler observes cancellation through the request's Done channel, and the
+original caller receives a response with a CancelledError.
+
+Requests may carry a deadline, after which the caller no longer cares about
+the response. Each time the tracker proxies a request, the deadline of the
+proxied request is shortened to fit the tracking timeout, so it shrinks at
+every hop. The deadline is sent as an absolute time, so it assumes the clocks
+of the nodes a request passes through are kept in sync (e.g. with NTP); clock
+skew between nodes shortens or stretches it by the same amount, while each
+hop's own tracking timeout is still measured locally. Request.Context provides a context reflecting both the deadline and
+cancellation, and SyncRequest and MultiRequest accept a context whose deadline
+is applied to the requests they send. A Client pairs a tracker with a
+coordinator url and timeout, making a request and unmarshaling its result in
+one call; the providers' typed clients are built on it.
+
+Errors keep their errors.Code, such as not_found or unavailable, across the
+wire, so callers can handle failures without matching on error messages.
+Errors marked with a Temporary method, such as TemporaryError, indicate a
+failure that may succeed if retried, and are preserved across the wire. With a
+RetryPolicy set on the tracker, SyncRequest and MultiRequest.SendRequest retry
+requests failing with temporary errors, with exponential backoff. Retries get
+a new request ID but share an IdempotencyKey, so a provider that already
+handled the request returns the original result instead of running the task
+again.
+
+Requests may carry a TraceID and ParentSpanID tying them to a trace. Handling
+a request can be recorded as a Span, a child of the span that sent it, and a
+span carried by a context with ContextWithSpan becomes the parent of requests
+sent by SyncRequest and MultiRequest with that context. Proxied requests keep
+their trace. Finished spans are exported in batches by the SpanExporter set
+with SetSpanExporter, in the OpenTelemetry (OTLP) JSON format, either to a
+file or to a collector over http.
+
+Long running requests may report progress before the final response. A
+progress message is a Response with only the Progress field set; it is routed
+to the response hook like any other response, but it does not complete the
+request. The tracker forwards progress for proxied requests and runs the
+ProgressHandler for others, leaving the request tracked in both cases.
+ProgressWriter reports the number of bytes written through it, sending the
+progress in the background so a slow response hook doesn't hold up the writes.
+
+Many requests for the same coordinator can be sent as a single batch, an array
+of requests, with SendBatch, saving a connection per request. Each request of
+a batch is handled independently, and the initial responses come back as an
+array in the same order. MultiRequest.SendRequests sends its requests as a
+batch. ReadConnRequests and UnmarshalRequests read either a single request or a
+batch, for servers accepting both.
+
+Callers that can't receive a response hook, such as clients behind NAT, can
+send a request with SendEvents instead. The response is delivered on the same
+http connection as a stream of Server-Sent Events: an ack event with the
+initial response, progress events, and a response event with the final
+response, which are passed to the request's handlers.
+
+In a similar vein, the tracker provides a registry of data streams served by a
+single unix listener. Each registered stream gets an opaque, unguessable id
+that is included in its URL and can be retrieved once, unless its data is
+seekable; streams not retrieved before the tracker's default timeout are
+discarded. Streams can also be
+registered for proxying over http, and the tracker's ProxyStreamHandler serves
+only registered stream ids.
+
+Stream data is followed by a StreamDigest, the sha256 and byte count of the
+data, which Stream verifies after copying the data; an error from Stream means
+the data written is incomplete or corrupt. Over unix sockets the data is sent
+in size-prefixed chunks followed by the digest. Over http, ServeStream
+compresses the data with gzip or zstd as negotiated through Accept-Encoding
+and sends the digest as trailers.
+
+Seekable stream data, such as a regular file, can be retrieved any number of
+times and from any offset. Over http it is served uncompressed with a
+Content-Length and supports single byte ranges. When an http transfer of
+seekable data is interrupted by a transient error, Stream resumes it from the
+last offset written. Unix streams and non-seekable data, such as zfs sends, are
+not resumed; an interrupted transfer fails and must be requested again.
 
 The UnixListener provides a wrapper around a unix socket, with connection
 tracking for graceful shutdown. Communication over a unix socket is done by
-sending a payload size header and then the JSON data; there are included
-methods for handling the sending and reading of such data.
+sending a payload size header and then the encoded data; there are included
+methods for handling the sending and reading of such data. JSON payloads are
+sent with the original four byte size header. Payloads encoded with CBOR or
+msgpack are sent with a v2 header that identifies the codec, and servers reply
+using the codec of the message they received. The whole message is encoded
+with the codec, including request args and response results. The codec is
+negotiated per connection: a UnixListener accepts JSON and the codec set with
+SetCodec, and rejects other messages with an error that has the sender send the
+message again as JSON. Peers without v2 framing can't reply that way, so binary
+codecs should only be used with v2 peers. A Tracker sends with the codec set
+with its SetCodec, a Request is responded to with the codec it was received
+with, and other messages use the DefaultCodec. Sizes are read in full and
+messages larger than the limit set with SetMaxMessageSize, or MaxMessageSize by
+default, are rejected.
 */
 package acomm
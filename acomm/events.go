@@ -0,0 +1,127 @@
+package acomm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/logrusx"
+)
+
+// Server-Sent Event names used to deliver responses on the connection a
+// request was sent on. The ack event carries the initial response, progress
+// events carry progress messages, and the response event carries the final
+// response.
+const (
+	EventAck      = "ack"
+	EventProgress = "progress"
+	EventResponse = "response"
+)
+
+// EventsContentType is the content type of a Server-Sent Events stream.
+const EventsContentType = "text/event-stream"
+
+// WriteEvent writes a response as a Server-Sent Event.
+func WriteEvent(w io.Writer, event string, resp *Response) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return errors.Wrapv(err, map[string]interface{}{"requestID": resp.ID, "event": event})
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return errors.Wrapv(err, map[string]interface{}{"requestID": resp.ID, "event": event})
+}
+
+// SendEvents sends a request over http to addr, which responds with a
+// Server-Sent Events stream, and blocks until the final response arrives on
+// the same connection. Progress messages and the final response are passed to
+// the request's handlers; the response hook is not used. It returns the error
+// of the initial response, or an error if the stream ends early.
+func SendEvents(addr *url.URL, req *Request) error {
+	errData := map[string]interface{}{"addr": addr, "requestID": req.ID}
+
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrapv(err, errData)
+	}
+
+	httpReq, err := http.NewRequest("POST", addr.String(), bytes.NewReader(payload))
+	if err != nil {
+		return errors.Wrapv(err, errData)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", EventsContentType)
+
+	httpResp, err := httpClient().Do(httpReq)
+	if err != nil {
+		if isDialError(err) {
+			// Nothing was sent, so it is safe to try again
+			return errors.WithCode(NewTemporaryError(err.Error(), errData), errors.CodeUnavailable)
+		}
+		return errors.Wrapv(err, errData)
+	}
+	defer logrusx.LogReturnedErr(httpResp.Body.Close, nil, "failed to close http body")
+
+	if httpResp.StatusCode != http.StatusOK {
+		errData["status"] = httpResp.Status
+		return errors.Newv("unexpected http status", errData)
+	}
+
+	return readEvents(bufio.NewReader(httpResp.Body), req)
+}
+
+// readEvents reads responses from a Server-Sent Events stream until the final
+// response.
+func readEvents(r *bufio.Reader, req *Request) error {
+	var event string
+	var data []byte
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return errors.Wrapv(err, map[string]interface{}{"requestID": req.ID}, "events stream ended before response")
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			continue
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimSpace(strings.TrimPrefix(line, "data:"))...)
+			continue
+		case line != "":
+			// Comments, such as keepalives, and unused fields
+			continue
+		}
+
+		// A blank line ends an event
+		if len(data) == 0 {
+			continue
+		}
+		resp := &Response{}
+		if err := json.Unmarshal(data, resp); err != nil {
+			return errors.Wrapv(err, map[string]interface{}{"requestID": req.ID, "event": event, "data": string(data)})
+		}
+
+		switch event {
+		case EventAck:
+			if resp.Error != nil {
+				return errors.ResetStack(resp.Error)
+			}
+		case EventProgress:
+			req.HandleResponse(resp)
+		case EventResponse:
+			req.HandleResponse(resp)
+			return nil
+		}
+		event, data = "", nil
+	}
+}
@@ -0,0 +1,121 @@
+package acomm_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/stretchr/testify/suite"
+)
+
+type EventsTestSuite struct {
+	suite.Suite
+}
+
+func TestEventsTestSuite(t *testing.T) {
+	suite.Run(t, new(EventsTestSuite))
+}
+
+func (s *EventsTestSuite) SetupSuite() {
+	logrus.SetLevel(logrus.FatalLevel)
+}
+
+// eventsServer responds to a request with an ack, a progress message, and the
+// final response, stopping after the ack if ackErr is set and before the final
+// response if final is false.
+func eventsServer(ackErr error, final bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &acomm.Request{}
+		_ = json.NewDecoder(r.Body).Decode(req)
+
+		w.Header().Set("Content-Type", acomm.EventsContentType)
+		ack, _ := acomm.NewResponse(req, nil, nil, ackErr)
+		_ = acomm.WriteEvent(w, acomm.EventAck, ack)
+		if ackErr != nil {
+			return
+		}
+
+		_, _ = w.Write([]byte(":\n\n"))
+		progress, _ := acomm.NewProgressResponse(req, &acomm.Progress{Percent: 50})
+		_ = acomm.WriteEvent(w, acomm.EventProgress, progress)
+		if !final {
+			return
+		}
+
+		resp, _ := acomm.NewResponse(req, req.Args, nil, nil)
+		_ = acomm.WriteEvent(w, acomm.EventResponse, resp)
+	}))
+}
+
+func (s *EventsTestSuite) TestSendEvents() {
+	tests := []struct {
+		description string
+		ackErr      error
+		final       bool
+		code        errors.Code
+	}{
+		{"success", nil, true, ""},
+		{"ack error", errors.NewWithCode(errors.CodeNotFound, "no such task", nil), true, errors.CodeNotFound},
+		{"no final response", nil, false, ""},
+	}
+
+	for _, test := range tests {
+		msg := testMsgFunc(test.description)
+		server := eventsServer(test.ackErr, test.final)
+		addr, _ := url.ParseRequestURI(server.URL)
+
+		var progress, results []*acomm.Response
+		handler := func(_ *acomm.Request, resp *acomm.Response) {
+			results = append(results, resp)
+		}
+		req, err := acomm.NewRequest(acomm.RequestOptions{
+			Task:           "foobar",
+			Args:           map[string]string{"foo": "bar"},
+			SuccessHandler: handler,
+			ErrorHandler:   handler,
+			ProgressHandler: func(_ *acomm.Request, resp *acomm.Response) {
+				progress = append(progress, resp)
+			},
+		})
+		s.Require().NoError(err, msg("should have created request"))
+
+		err = acomm.SendEvents(addr, req)
+		server.Close()
+
+		switch {
+		case test.ackErr != nil:
+			s.True(errors.IsCode(err, test.code), msg("should have returned the ack error"))
+			s.Len(progress, 0, msg("should not have handled progress"))
+			s.Len(results, 0, msg("should not have handled a response"))
+		case !test.final:
+			s.Error(err, msg("should have errored on a stream without a final response"))
+			s.Len(progress, 1, msg("should have handled progress"))
+			s.Len(results, 0, msg("should not have handled a response"))
+		default:
+			s.NoError(err, msg("should not have errored"))
+			if s.Len(progress, 1, msg("should have handled progress")) {
+				s.Equal(float64(50), progress[0].Progress.Percent, msg("should have handled progress"))
+			}
+			if s.Len(results, 1, msg("should have handled the response")) {
+				result := map[string]string{}
+				s.NoError(results[0].UnmarshalResult(&result), msg("should have unmarshalled result"))
+				s.Equal("bar", result["foo"], msg("should have gotten the result"))
+			}
+		}
+	}
+}
+
+func (s *EventsTestSuite) TestSendEventsUnavailable() {
+	addr, _ := url.ParseRequestURI("http://127.0.0.1:1/events")
+	req, err := acomm.NewRequest(acomm.RequestOptions{Task: "foobar"})
+	s.Require().NoError(err)
+
+	err = acomm.SendEvents(addr, req)
+	s.True(errors.IsCode(err, errors.CodeUnavailable), "should be unavailable")
+	s.True(acomm.IsTemporary(err), "should be temporary")
+}
@@ -0,0 +1,34 @@
+package acomm
+
+import "github.com/cerana/cerana/pkg/errors"
+
+// errorCodeForbidden is the response error code identifying a ForbiddenError.
+const errorCodeForbidden = string(errors.CodeForbidden)
+
+// ForbiddenError is the error returned when the caller making a request is
+// not authorized to run the requested task. It is preserved across the wire
+// when sent as a Response error.
+type ForbiddenError struct {
+	Message string `json:"message"`
+}
+
+// NewForbiddenError creates a new ForbiddenError with a callstack.
+func NewForbiddenError(msg string, values map[string]interface{}) error {
+	return errors.Wrapv(&ForbiddenError{Message: msg}, values)
+}
+
+// Error returns the error message.
+func (e *ForbiddenError) Error() string {
+	return e.Message
+}
+
+// Code returns the forbidden error code.
+func (e *ForbiddenError) Code() errors.Code {
+	return errors.CodeForbidden
+}
+
+// IsForbidden returns whether the error, or its underlying cause, is a
+// ForbiddenError or is otherwise classified as forbidden.
+func IsForbidden(err error) bool {
+	return errors.IsCode(err, errors.CodeForbidden)
+}
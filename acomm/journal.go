@@ -0,0 +1,349 @@
+package acomm
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/logrusx"
+	"github.com/cerana/cerana/pkg/prometheusx"
+)
+
+// Journal record operations.
+const (
+	journalTrack = "track"
+	journalRoute = "route"
+	journalDone  = "done"
+)
+
+// journalCompactMin is the number of records the journal may grow to before
+// it is compacted down to the live entries.
+const journalCompactMin = 1000
+
+// journalRecord is a single line of the journal.
+type journalRecord struct {
+	Op      string    `json:"op"`
+	ID      string    `json:"id"`
+	Request *Request  `json:"request,omitempty"`
+	Tracked time.Time `json:"tracked,omitempty"`
+	Expires time.Time `json:"expires,omitempty"`
+	Route   *url.URL  `json:"route,omitempty"`
+}
+
+// journal is an append-only, on-disk log of proxied requests being tracked
+// and where they were sent. It allows a restarted tracker to keep routing
+// responses for requests that were in flight.
+type journal struct {
+	path           string
+	maxMessageSize uint32
+	lock           sync.Mutex // Protects file, entries, and records
+	file           *os.File
+	entries        map[string]*journalRecord
+	records        int
+
+	pendingLock sync.Mutex // Protects pending
+	pending     []*journalRecord
+}
+
+// openJournal loads the journal at the path, compacts it to the live entries,
+// and opens it for appending. The live entries are returned for replay.
+// Records larger than the maxMessageSize are not read.
+func openJournal(path string, maxMessageSize uint32) (*journal, []*journalRecord, error) {
+	j := &journal{
+		path:           path,
+		maxMessageSize: maxMessageSize,
+		entries:        make(map[string]*journalRecord),
+	}
+
+	if err := j.load(); err != nil {
+		return nil, nil, err
+	}
+	if err := j.compact(); err != nil {
+		return nil, nil, err
+	}
+
+	entries := make([]*journalRecord, 0, len(j.entries))
+	for _, entry := range j.entries {
+		entries = append(entries, entry)
+	}
+	return j, entries, nil
+}
+
+// load reads the records in the journal file, if it exists.
+func (j *journal) load() error {
+	f, err := os.Open(j.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapv(err, map[string]interface{}{"path": j.path})
+	}
+	defer logrusx.LogReturnedErr(f.Close, map[string]interface{}{"path": j.path}, "failed to close journal")
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), int(readOptions{maxMessageSize: j.maxMessageSize}.maxSize()))
+	for scanner.Scan() {
+		rec := &journalRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), rec); err != nil {
+			// The last record may have been partially written on a crash
+			logrus.WithField("error", errors.Wrapv(err, map[string]interface{}{"path": j.path})).Warn("skipping invalid journal record")
+			continue
+		}
+		j.apply(rec)
+	}
+	return errors.Wrapv(scanner.Err(), map[string]interface{}{"path": j.path})
+}
+
+// apply updates the live entries with a record.
+func (j *journal) apply(rec *journalRecord) {
+	switch rec.Op {
+	case journalTrack:
+		if rec.Request != nil {
+			j.entries[rec.ID] = rec
+		}
+	case journalRoute:
+		if entry, ok := j.entries[rec.ID]; ok {
+			entry.Route = rec.Route
+		}
+	case journalDone:
+		delete(j.entries, rec.ID)
+	}
+}
+
+// compact rewrites the journal file with only the live entries and reopens
+// it for appending. The caller must hold the lock, if the journal is shared.
+func (j *journal) compact() error {
+	errData := map[string]interface{}{"path": j.path}
+
+	if j.file != nil {
+		if err := j.file.Close(); err != nil {
+			logrus.WithField("error", errors.Wrapv(err, errData)).Error("failed to close journal")
+		}
+		j.file = nil
+	}
+
+	tmpPath := j.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrapv(err, errData)
+	}
+	encoder := json.NewEncoder(tmp)
+	for _, entry := range j.entries {
+		if err = encoder.Encode(entry); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, j.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrapv(err, errData)
+	}
+
+	j.file, err = os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrapv(err, errData)
+	}
+	j.records = len(j.entries)
+	return nil
+}
+
+// track queues a record of a proxied request that is now tracked, along with
+// when it was tracked and when its tracking expires.
+func (j *journal) track(req *Request) {
+	j.queue(&journalRecord{
+		Op:      journalTrack,
+		ID:      req.ID,
+		Request: req,
+		Tracked: req.tracked,
+		Expires: req.expires,
+	})
+}
+
+// route queues a record of where a tracked request was sent.
+func (j *journal) route(id string, dest *url.URL) {
+	j.queue(&journalRecord{
+		Op:    journalRoute,
+		ID:    id,
+		Route: dest,
+	})
+}
+
+// done queues a record that a request is no longer tracked.
+func (j *journal) done(id string) {
+	j.queue(&journalRecord{
+		Op: journalDone,
+		ID: id,
+	})
+}
+
+// queue adds a record to be written by the next flush. Records are queued
+// while the tracker holds its locks, keeping them in order, and flushed after
+// the locks are released, so requests don't wait on the disk while holding
+// them.
+func (j *journal) queue(rec *journalRecord) {
+	j.pendingLock.Lock()
+	defer j.pendingLock.Unlock()
+
+	j.pending = append(j.pending, rec)
+}
+
+// flush appends the queued records to the journal file with a single sync,
+// compacting it if it has grown too large. Records queued while another flush
+// is writing are written together by the next one. Failures are logged, since
+// the journal only aids recovery.
+func (j *journal) flush() {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.pendingLock.Lock()
+	pending := j.pending
+	j.pending = nil
+	j.pendingLock.Unlock()
+
+	if j.file == nil {
+		return
+	}
+
+	var data []byte
+	var records int
+	for _, rec := range pending {
+		// Routes are only needed for requests that can be recovered
+		if _, ok := j.entries[rec.ID]; rec.Op != journalTrack && !ok {
+			continue
+		}
+		j.apply(rec)
+
+		recData, err := json.Marshal(rec)
+		if err != nil {
+			err = errors.Wrapv(err, map[string]interface{}{"path": j.path, "requestID": rec.ID, "op": rec.Op})
+			logrus.WithField("error", err).Error("failed to marshal journal record")
+			continue
+		}
+		data = append(append(data, recData...), '\n')
+		records++
+	}
+	if records == 0 {
+		return
+	}
+
+	_, err := j.file.Write(data)
+	if err == nil {
+		err = j.file.Sync()
+	}
+	if err != nil {
+		err = errors.Wrapv(err, map[string]interface{}{"path": j.path, "records": records})
+		logrus.WithField("error", err).Error("failed to write journal records")
+		return
+	}
+	j.records += records
+
+	if j.records > journalCompactMin && j.records > 2*len(j.entries) {
+		if err := j.compact(); err != nil {
+			logrus.WithField("error", err).Error("failed to compact journal")
+		}
+	}
+}
+
+// close closes the journal file. Further records are ignored.
+func (j *journal) close() {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if j.file == nil {
+		return
+	}
+	logrusx.LogReturnedErr(j.file.Close, map[string]interface{}{"path": j.path}, "failed to close journal")
+	j.file = nil
+}
+
+// SetJournal sets the path of a journal file used to recover proxied requests
+// when the tracker is restarted. On Start, requests left in the journal by a
+// previous run are tracked again, so late responses are still forwarded to
+// their original response hooks, and requests whose tracking expired in the
+// meantime get an error response. It must be called before Start.
+func (t *Tracker) SetJournal(path string) {
+	t.journalPath = path
+}
+
+// replayJournal opens the journal and tracks the requests left in it. It
+// returns the requests that expired while the tracker was stopped.
+func (t *Tracker) replayJournal() ([]*Request, error) {
+	j, entries, err := openJournal(t.journalPath, t.maxMessageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []*Request
+	for _, entry := range entries {
+		req := entry.Request
+		req.proxied = true
+		req.tracked = entry.Tracked
+		if req.tracked.IsZero() {
+			// Recorded before tracking times were journaled
+			req.tracked = time.Now()
+		}
+		req.expires = entry.Expires
+
+		remaining := entry.Expires.Sub(time.Now())
+		if remaining <= 0 {
+			expired = append(expired, req)
+			continue
+		}
+
+		t.requestsLock.Lock()
+		t.waitgroup.Add(1)
+		t.requests[req.ID] = req
+		prometheusx.TrackerInFlight.Inc()
+		if err := t.setRequestTimeout(req, remaining); err != nil {
+			logrus.WithField("error", err).Error("failed to set request timeout")
+		}
+		t.requestsLock.Unlock()
+
+		if entry.Route != nil {
+			t.TrackRoute(req, entry.Route, remaining)
+		}
+	}
+	// The live entries are already in the journal, so start recording only
+	// after they are tracked again
+	t.journal = j
+
+	logrus.WithFields(logrus.Fields{
+		"path":      t.journalPath,
+		"recovered": len(entries) - len(expired),
+		"expired":   len(expired),
+	}).Info("replayed request journal")
+	return expired, nil
+}
+
+// respondExpired sends an error response for a journaled request that expired
+// while the tracker was stopped.
+func (t *Tracker) respondExpired(req *Request) {
+	t.journal.done(req.ID)
+	t.journal.flush()
+
+	resp, err := NewResponse(req, nil, nil, errors.NewWithCode(errors.CodeTimeout, "request expired while tracker was stopped", map[string]interface{}{
+		"requestID": req.ID,
+		"task":      req.Task,
+	}))
+	if err != nil {
+		logrus.WithField("error", err).Error("failed to create expired request response")
+		return
+	}
+	if err := req.Respond(resp); err != nil {
+		err = errors.Wrapv(err, map[string]interface{}{"requestID": req.ID})
+		logrus.WithField("error", err).Error("failed to respond to expired request")
+	}
+}
@@ -1,65 +1,294 @@
 package acomm
 
 import (
+	"net/url"
 	"sync"
 	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
 )
 
 // MultiRequest provides a way to manage multiple parallel requests
 type MultiRequest struct {
+	ctx        context.Context
+	lock       sync.Mutex // Protects idsToNames, requests, dests, attempts, and responses
 	idsToNames map[string]string
+	requests   map[string]*Request
+	dests      map[string]*url.URL
+	attempts   map[string]int
 	respWG     sync.WaitGroup
-	responses  chan *Response
+	responses  []*Response
 	tracker    *Tracker
 	timeout    time.Duration
+	retry      *RetryPolicy
 }
 
-// NewMultiRequest creates and initializes a new MultiRequest.
-func NewMultiRequest(tracker *Tracker, timeout time.Duration) *MultiRequest {
+// NewMultiRequest creates and initializes a new MultiRequest. The deadline of
+// the context, if set, is applied to each added request, and waiting for
+// responses is abandoned if the context is done first. A span carried by the
+// context becomes the parent of requests not already part of a trace. Requests
+// sent with SendRequest are retried according to the tracker's retry policy.
+func NewMultiRequest(ctx context.Context, tracker *Tracker, timeout time.Duration) *MultiRequest {
 	return &MultiRequest{
+		ctx:        ctx,
 		idsToNames: make(map[string]string),
-		responses:  make(chan *Response, 100),
+		requests:   make(map[string]*Request),
+		dests:      make(map[string]*url.URL),
+		attempts:   make(map[string]int),
 		tracker:    tracker,
 		timeout:    timeout,
+		retry:      tracker.retryPolicy(),
 	}
 }
 
 // AddRequest adds a request to the MultiRequest. Sending the request is still
 // the responsibility of the caller.
 func (m *MultiRequest) AddRequest(name string, req *Request) error {
+	m.lock.Lock()
 	m.idsToNames[req.ID] = name
+	m.requests[req.ID] = req
+	m.lock.Unlock()
+
 	req.ResponseHook = m.tracker.URL()
 	req.SuccessHandler = m.responseHandler
 	req.ErrorHandler = m.responseHandler
+	if deadline, ok := m.ctx.Deadline(); ok {
+		req.SetDeadline(deadline)
+	}
+	injectContextSpan(m.ctx, req)
 
 	m.respWG.Add(1)
 	return m.tracker.TrackRequest(req, m.timeout)
 }
 
+// SendRequest adds a request to the MultiRequest and sends it to the
+// destination. If the request fails with a temporary error, whether sending it
+// or in its response, it is retried according to the retry policy.
+func (m *MultiRequest) SendRequest(name string, dest *url.URL, req *Request) error {
+	if m.retry != nil && req.IdempotencyKey == "" {
+		req.IdempotencyKey = uuid.New()
+	}
+
+	m.lock.Lock()
+	m.dests[name] = dest
+	m.attempts[name] = 1
+	m.lock.Unlock()
+
+	if err := m.AddRequest(name, req); err != nil {
+		return err
+	}
+
+	return m.sent(name, req, m.tracker.Send(dest, req))
+}
+
+// SendRequests adds the named requests to the MultiRequest and sends them to
+// the destination, a coordinator, in a single batch (see SendBatch) rather
+// than one message each. Requests that fail with a temporary error, whether
+// sending the batch or in their responses, are retried individually according
+// to the retry policy. The errors of requests that could not be sent are
+// returned, keyed on name.
+func (m *MultiRequest) SendRequests(dest *url.URL, reqs map[string]*Request) map[string]error {
+	errs := make(map[string]error)
+	names := make([]string, 0, len(reqs))
+	batch := make([]*Request, 0, len(reqs))
+	for name, req := range reqs {
+		if m.retry != nil && req.IdempotencyKey == "" {
+			req.IdempotencyKey = uuid.New()
+		}
+
+		m.lock.Lock()
+		m.dests[name] = dest
+		m.attempts[name] = 1
+		m.lock.Unlock()
+
+		if err := m.AddRequest(name, req); err != nil {
+			errs[name] = err
+			continue
+		}
+		names = append(names, name)
+		batch = append(batch, req)
+	}
+
+	var sendErrs []error
+	switch len(batch) {
+	case 0:
+		return errs
+	case 1:
+		sendErrs = []error{m.tracker.Send(dest, batch[0])}
+	default:
+		var err error
+		sendErrs, err = m.tracker.SendBatch(dest, batch)
+		if err != nil {
+			sendErrs = make([]error, len(batch))
+			for i := range sendErrs {
+				sendErrs[i] = err
+			}
+		}
+	}
+
+	for i, req := range batch {
+		if err := m.sent(names[i], req, sendErrs[i]); err != nil {
+			errs[names[i]] = err
+		}
+	}
+	return errs
+}
+
+// sent handles the outcome of sending a request. A request that failed to send
+// is retried if possible and otherwise removed, returning the error.
+func (m *MultiRequest) sent(name string, req *Request, err error) error {
+	if err == nil {
+		return nil
+	}
+	if m.retry.shouldRetry(1, err) && m.tracker.RemoveRequest(req) {
+		go m.retryRequest(name, req, err)
+		return nil
+	}
+	m.RemoveRequest(req)
+	return err
+}
+
 // RemoveRequest removes a request from the MultiRequest. Useful if the send fails.
 func (m *MultiRequest) RemoveRequest(req *Request) {
+	m.lock.Lock()
+	delete(m.requests, req.ID)
+	m.lock.Unlock()
+
 	if m.tracker.RemoveRequest(req) {
 		m.respWG.Done()
 	}
 }
 
 // responseHandler alerts the MultiRequest when a response has been received and
-// captures the response.
+// captures the response, unless the request is being retried.
 func (m *MultiRequest) responseHandler(req *Request, resp *Response) {
+	m.lock.Lock()
+	name := m.idsToNames[req.ID]
+	attempt := m.attempts[name]
+	m.lock.Unlock()
+
+	// Only requests sent with SendRequest have attempts and can be retried
+	if attempt > 0 && m.retry.shouldRetry(attempt, resp.Error) {
+		go m.retryRequest(name, req, resp.Error)
+		return
+	}
+
+	m.respond(resp)
+}
+
+// respond captures the final response of a request.
+func (m *MultiRequest) respond(resp *Response) {
 	defer m.respWG.Done()
 
-	m.responses <- resp
+	m.lock.Lock()
+	m.responses = append(m.responses, resp)
+	m.lock.Unlock()
+}
+
+// retryRequest resends a failed request under a new ID after waiting for the
+// retry backoff, until an attempt is sent and tracked, the attempts run out,
+// or the context is done. The request has already been removed from the
+// tracker.
+func (m *MultiRequest) retryRequest(name string, req *Request, reqErr error) {
+	for {
+		m.lock.Lock()
+		attempt := m.attempts[name]
+		dest := m.dests[name]
+		delete(m.requests, req.ID)
+		m.lock.Unlock()
+
+		logrus.WithFields(logrus.Fields{
+			"task":    req.Task,
+			"attempt": attempt,
+			"error":   reqErr,
+		}).Warn("retrying request after temporary error")
+
+		if !m.retry.wait(m.ctx, attempt) {
+			m.fail(req, errors.Wrapv(m.ctx.Err(), map[string]interface{}{"requestID": req.ID}))
+			return
+		}
+
+		retryReq, err := req.newAttempt()
+		if err != nil {
+			m.fail(req, err)
+			return
+		}
+
+		m.lock.Lock()
+		m.attempts[name] = attempt + 1
+		m.idsToNames[retryReq.ID] = name
+		m.requests[retryReq.ID] = retryReq
+		m.lock.Unlock()
+
+		if err := m.tracker.TrackRequest(retryReq, m.timeout); err != nil {
+			m.fail(req, err)
+			return
+		}
+		reqErr = m.tracker.Send(dest, retryReq)
+		if reqErr == nil {
+			return
+		}
+		if !m.tracker.RemoveRequest(retryReq) {
+			// Already responded to or being handled
+			return
+		}
+		if !m.retry.shouldRetry(attempt+1, reqErr) {
+			m.fail(retryReq, reqErr)
+			return
+		}
+		req = retryReq
+	}
+}
+
+// fail captures an error response for a request.
+func (m *MultiRequest) fail(req *Request, err error) {
+	m.lock.Lock()
+	delete(m.requests, req.ID)
+	m.lock.Unlock()
+
+	resp, _ := NewResponse(req, nil, nil, err)
+	m.respond(resp)
 }
 
 // Responses returns responses for all of the requests, keyed on the request name
-// (as opposed to request id). Blocks until all requests are accounted for.
+// (as opposed to request id). Blocks until all requests are accounted for. If
+// the context is done first, requests still waiting on a response are given an
+// error response with the context error.
 func (m *MultiRequest) Responses() map[string]*Response {
 	results := make(map[string]*Response)
 
-	m.respWG.Wait()
+	done := make(chan struct{})
+	go func() {
+		m.respWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-m.ctx.Done():
+		m.lock.Lock()
+		requests := make([]*Request, 0, len(m.requests))
+		for _, req := range m.requests {
+			requests = append(requests, req)
+		}
+		m.lock.Unlock()
+
+		for _, req := range requests {
+			if !m.tracker.RemoveRequest(req) {
+				// Already responded to, being handled, or being retried
+				continue
+			}
+			m.fail(req, errors.Wrapv(m.ctx.Err(), map[string]interface{}{"requestID": req.ID}))
+		}
+		<-done
+	}
 
-	close(m.responses)
-	for resp := range m.responses {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, resp := range m.responses {
 		name := m.idsToNames[resp.ID]
 		results[name] = resp
 	}
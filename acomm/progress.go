@@ -0,0 +1,117 @@
+package acomm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+// Progress describes how far along a long running request is. All fields are
+// optional; providers set whichever are meaningful for the task.
+type Progress struct {
+	Percent    float64 `json:"percent,omitempty"`
+	Bytes      uint64  `json:"bytes,omitempty"`
+	TotalBytes uint64  `json:"totalBytes,omitempty"`
+	Step       string  `json:"step,omitempty"`
+}
+
+// String returns a human readable representation of the progress.
+func (p *Progress) String() string {
+	parts := make([]string, 0, 3)
+	if p.Step != "" {
+		parts = append(parts, p.Step)
+	}
+	if p.Percent > 0 {
+		parts = append(parts, fmt.Sprintf("%.1f%%", p.Percent))
+	}
+	if p.TotalBytes > 0 {
+		parts = append(parts, fmt.Sprintf("%d/%d bytes", p.Bytes, p.TotalBytes))
+	} else if p.Bytes > 0 {
+		parts = append(parts, fmt.Sprintf("%d bytes", p.Bytes))
+	}
+	return strings.Join(parts, " ")
+}
+
+// NewProgressResponse creates a progress message for a request. Progress
+// messages are Responses that do not complete the request; any number may be
+// sent before the final Response.
+func NewProgressResponse(req *Request, progress *Progress) (*Response, error) {
+	if req == nil {
+		return nil, errors.New("cannot create progress response without request")
+	}
+	if progress == nil {
+		return nil, errors.Newv("missing progress", map[string]interface{}{"requestID": req.ID})
+	}
+
+	return &Response{
+		ID:       req.ID,
+		Progress: progress,
+	}, nil
+}
+
+// IsProgress returns whether the response is a progress message rather than
+// the final response to a request.
+func (r *Response) IsProgress() bool {
+	return r.Progress != nil
+}
+
+// SendProgress sends a progress message to the ResponseHook if present.
+func (req *Request) SendProgress(progress *Progress) error {
+	resp, err := NewProgressResponse(req, progress)
+	if err != nil {
+		return err
+	}
+	return req.Respond(resp)
+}
+
+// ProgressWriter is an io.Writer that counts the bytes written through it and
+// periodically sends the count as progress for a request. Progress is sent in
+// the background so a slow response hook doesn't hold up the writes, and
+// updates due while one is still being sent are dropped.
+type ProgressWriter struct {
+	writer   io.Writer
+	req      *Request
+	step     string
+	interval time.Duration
+	bytes    uint64
+	lastSent time.Time
+	sending  int32
+}
+
+// NewProgressWriter creates a new ProgressWriter wrapping w. Progress is sent
+// at most once per interval.
+func NewProgressWriter(w io.Writer, req *Request, step string, interval time.Duration) *ProgressWriter {
+	return &ProgressWriter{
+		writer:   w,
+		req:      req,
+		step:     step,
+		interval: interval,
+		lastSent: time.Now(),
+	}
+}
+
+// Write writes to the underlying writer and sends progress if the interval
+// has elapsed and no progress is still being sent. Failure to send progress
+// does not fail the write.
+func (pw *ProgressWriter) Write(p []byte) (int, error) {
+	n, err := pw.writer.Write(p)
+	pw.bytes += uint64(n)
+
+	if time.Since(pw.lastSent) >= pw.interval && atomic.CompareAndSwapInt32(&pw.sending, 0, 1) {
+		pw.lastSent = time.Now()
+		progress := &Progress{Step: pw.step, Bytes: pw.bytes}
+		go func() {
+			defer atomic.StoreInt32(&pw.sending, 0)
+			if err := pw.req.SendProgress(progress); err != nil {
+				logrus.WithField("error", err).Warn("failed to send progress")
+			}
+		}()
+	}
+
+	return n, err
+}
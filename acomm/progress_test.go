@@ -0,0 +1,210 @@
+package acomm_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/stretchr/testify/suite"
+)
+
+type ProgressTestSuite struct {
+	suite.Suite
+	RespServer *httptest.Server
+	Responses  chan *acomm.Response
+}
+
+func TestProgressTestSuite(t *testing.T) {
+	suite.Run(t, new(ProgressTestSuite))
+}
+
+func (s *ProgressTestSuite) SetupSuite() {
+	logrus.SetLevel(logrus.FatalLevel)
+	s.Responses = make(chan *acomm.Response, 10)
+
+	s.RespServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := &acomm.Response{}
+		body, err := ioutil.ReadAll(r.Body)
+		s.NoError(err, "should not fail reading body")
+		s.NoError(json.Unmarshal(body, resp), "should not fail unmarshalling response")
+		s.Responses <- resp
+
+		ack, _ := json.Marshal(&acomm.Response{})
+		_, _ = w.Write(ack)
+	}))
+}
+
+func (s *ProgressTestSuite) TearDownTest() {
+	for len(s.Responses) > 0 {
+		<-s.Responses
+	}
+}
+
+func (s *ProgressTestSuite) TearDownSuite() {
+	s.RespServer.Close()
+}
+
+func (s *ProgressTestSuite) TestProgressString() {
+	tests := []struct {
+		progress *acomm.Progress
+		expected string
+	}{
+		{&acomm.Progress{}, ""},
+		{&acomm.Progress{Step: "importing"}, "importing"},
+		{&acomm.Progress{Percent: 50}, "50.0%"},
+		{&acomm.Progress{Bytes: 10}, "10 bytes"},
+		{&acomm.Progress{Step: "receiving", Percent: 25, Bytes: 10, TotalBytes: 40}, "receiving 25.0% 10/40 bytes"},
+	}
+
+	for _, test := range tests {
+		s.Equal(test.expected, test.progress.String())
+	}
+}
+
+func (s *ProgressTestSuite) TestNewProgressResponse() {
+	req, err := acomm.NewRequest(acomm.RequestOptions{Task: "foobar"})
+	s.Require().NoError(err, "request should be created")
+
+	resp, err := acomm.NewProgressResponse(nil, &acomm.Progress{})
+	s.Error(err, "should fail without a request")
+	s.Nil(resp)
+
+	resp, err = acomm.NewProgressResponse(req, nil)
+	s.Error(err, "should fail without progress")
+	s.Nil(resp)
+
+	progress := &acomm.Progress{Step: "foo"}
+	resp, err = acomm.NewProgressResponse(req, progress)
+	s.NoError(err, "should create progress response")
+	s.Equal(req.ID, resp.ID)
+	s.Equal(progress, resp.Progress)
+	s.True(resp.IsProgress())
+
+	final, err := acomm.NewResponse(req, struct{}{}, nil, nil)
+	s.Require().NoError(err)
+	s.False(final.IsProgress())
+}
+
+func (s *ProgressTestSuite) TestHandleProgress() {
+	sh, eh, handled := generateHandlers()
+	var progress []*acomm.Progress
+	ph := func(req *acomm.Request, resp *acomm.Response) {
+		progress = append(progress, resp.Progress)
+	}
+
+	req, err := acomm.NewRequest(acomm.RequestOptions{
+		Task:            "foobar",
+		SuccessHandler:  sh,
+		ErrorHandler:    eh,
+		ProgressHandler: ph,
+	})
+	s.Require().NoError(err, "request should be created")
+
+	resp, err := acomm.NewProgressResponse(req, &acomm.Progress{Percent: 10})
+	s.Require().NoError(err)
+	req.HandleResponse(resp)
+	s.Len(progress, 1, "should have called progress handler")
+	s.Equal(0, handled["success"], "should not have called success handler")
+	s.Equal(0, handled["error"], "should not have called error handler")
+
+	resp, err = acomm.NewResponse(req, struct{}{}, nil, nil)
+	s.Require().NoError(err)
+	req.HandleResponse(resp)
+	s.Len(progress, 1, "should not have called progress handler")
+	s.Equal(1, handled["success"], "should have called success handler")
+}
+
+func (s *ProgressTestSuite) TestSendProgress() {
+	req, err := acomm.NewRequest(acomm.RequestOptions{
+		Task:               "foobar",
+		ResponseHookString: s.RespServer.URL,
+	})
+	s.Require().NoError(err, "request should be created")
+
+	s.NoError(req.SendProgress(&acomm.Progress{Step: "foo"}))
+	resp := nextResp(s.Responses)
+	if !s.NotNil(resp, "should have sent progress") {
+		return
+	}
+	s.Equal(req.ID, resp.ID)
+	s.True(resp.IsProgress())
+	s.Equal("foo", resp.Progress.Step)
+}
+
+func (s *ProgressTestSuite) TestProgressWriter() {
+	req, err := acomm.NewRequest(acomm.RequestOptions{
+		Task:               "foobar",
+		ResponseHookString: s.RespServer.URL,
+	})
+	s.Require().NoError(err, "request should be created")
+
+	var buf bytes.Buffer
+	pw := acomm.NewProgressWriter(&buf, req, "writing", 100*time.Millisecond)
+
+	n, err := pw.Write([]byte("foo"))
+	s.NoError(err)
+	s.Equal(3, n)
+	s.Len(s.Responses, 0, "should not send progress before the interval")
+
+	time.Sleep(200 * time.Millisecond)
+	n, err = pw.Write([]byte("bar"))
+	s.NoError(err)
+	s.Equal(3, n)
+	s.Equal("foobar", buf.String(), "should have written through")
+
+	resp := nextResp(s.Responses)
+	if !s.NotNil(resp, "should have sent progress") {
+		return
+	}
+	s.Equal(req.ID, resp.ID)
+	s.Equal("writing", resp.Progress.Step)
+	s.EqualValues(6, resp.Progress.Bytes)
+}
+
+func (s *ProgressTestSuite) TestProgressWriterSlowHook() {
+	release := make(chan struct{})
+	received := make(chan *acomm.Response, 10)
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := &acomm.Response{}
+		_ = json.NewDecoder(r.Body).Decode(resp)
+		received <- resp
+		<-release
+
+		ack, _ := json.Marshal(&acomm.Response{})
+		_, _ = w.Write(ack)
+	}))
+	defer slowServer.Close()
+
+	req, err := acomm.NewRequest(acomm.RequestOptions{
+		Task:               "foobar",
+		ResponseHookString: slowServer.URL,
+	})
+	s.Require().NoError(err, "request should be created")
+
+	var buf bytes.Buffer
+	pw := acomm.NewProgressWriter(&buf, req, "writing", 10*time.Millisecond)
+
+	// Writes aren't held up by the hook, and updates due while one is being
+	// sent are dropped
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		time.Sleep(20 * time.Millisecond)
+		_, err = pw.Write([]byte("foo"))
+		s.NoError(err)
+	}
+	s.True(time.Since(start) < time.Second, "should not have waited for the hook")
+	s.Equal("foofoofoofoofoo", buf.String(), "should have written through")
+
+	resp := nextResp(received)
+	if s.NotNil(resp, "should have sent progress") {
+		s.EqualValues(3, resp.Progress.Bytes)
+	}
+	s.Len(received, 0, "should have dropped updates while sending")
+	close(release)
+}
@@ -3,27 +3,48 @@ package acomm
 import (
 	"encoding/json"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/cerana/cerana/pkg/errors"
 	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
 )
 
 // Request is a request data structure for asynchronous requests. The ID is
 // used to identify the request throught its life cycle. The ResponseHook is a
 // URL where response data should be sent. SuccessHandler and ErrorHandler will
-// be called appropriately to handle a response.
+// be called appropriately to handle a response, and ProgressHandler for any
+// progress messages received before it. The optional Deadline is the
+// time by which the caller no longer cares about a response; as an absolute
+// time, it assumes synchronized clocks between nodes. Requests sharing
+// an optional IdempotencyKey are handled once by a provider, with later ones
+// getting the original result. The optional TraceID and ParentSpanID link the
+// request to the trace and span it was sent from. The optional Target routes the
+// request to the coordinator of a node resolved by the cluster coordinator,
+// instead of a TaskURL.
 type Request struct {
-	ID             string           `json:"id"`
-	Task           string           `json:"task"`
-	TaskURL        *url.URL         `json:"taskURL"`
-	ResponseHook   *url.URL         `json:"responseHook"`
-	StreamURL      *url.URL         `json:"streamURL"`
-	Args           *json.RawMessage `json:"args"`
-	SuccessHandler ResponseHandler  `json:"-"`
-	ErrorHandler   ResponseHandler  `json:"-"`
-	timeout        *time.Timer
-	proxied        bool
+	ID              string           `json:"id"`
+	Task            string           `json:"task"`
+	TaskURL         *url.URL         `json:"taskURL"`
+	Target          *Target          `json:"target,omitempty"`
+	ResponseHook    *url.URL         `json:"responseHook"`
+	StreamURL       *url.URL         `json:"streamURL"`
+	Args            *json.RawMessage `json:"args"`
+	Deadline        *time.Time       `json:"deadline,omitempty"`
+	IdempotencyKey  string           `json:"idempotencyKey,omitempty"`
+	TraceID         string           `json:"traceID,omitempty"`
+	ParentSpanID    string           `json:"parentSpanID,omitempty"`
+	SuccessHandler  ResponseHandler  `json:"-"`
+	ErrorHandler    ResponseHandler  `json:"-"`
+	ProgressHandler ResponseHandler  `json:"-"`
+	timeout         *time.Timer
+	tracked         time.Time
+	expires         time.Time
+	proxied         bool
+	codec           Codec
+	doneLock        sync.Mutex // Protects done
+	done            chan struct{}
 }
 
 // RequestOptions are properties and options used to create a new Request
@@ -33,13 +54,46 @@ type RequestOptions struct {
 	Task               string
 	TaskURL            *url.URL
 	TaskURLString      string
+	Target             *Target
 	ResponseHook       *url.URL
 	ResponseHookString string
 	StreamURL          *url.URL
 	StreamURLString    string
 	Args               interface{}
+	Deadline           time.Time
+	IdempotencyKey     string
+	TraceID            string
+	ParentSpanID       string
 	SuccessHandler     ResponseHandler `json:"-"`
 	ErrorHandler       ResponseHandler `json:"-"`
+	ProgressHandler    ResponseHandler `json:"-"`
+}
+
+// Target identifies the node a request should run on. Exactly one of Node, the
+// ID of the node, Bundle, the ID of a bundle running on it, or Dataset, the ID
+// of a dataset held by it, must be set.
+type Target struct {
+	Node    string `json:"node,omitempty"`
+	Bundle  uint64 `json:"bundle,omitempty"`
+	Dataset string `json:"dataset,omitempty"`
+}
+
+// Validate validates the target.
+func (t *Target) Validate() error {
+	set := 0
+	if t.Node != "" {
+		set++
+	}
+	if t.Bundle != 0 {
+		set++
+	}
+	if t.Dataset != "" {
+		set++
+	}
+	if set != 1 {
+		return errors.NewWithCode(errors.CodeInvalidArgument, "target must have exactly one of node, bundle, or dataset", map[string]interface{}{"target": t})
+	}
+	return nil
 }
 
 // ResponseHandler is a function to run when a request receives a response.
@@ -48,16 +102,25 @@ type ResponseHandler func(*Request, *Response)
 // NewRequest creates a new Request instance.
 func NewRequest(opts RequestOptions) (*Request, error) {
 	req := &Request{
-		ID:             uuid.New(),
-		Task:           opts.Task,
-		SuccessHandler: opts.SuccessHandler,
-		ErrorHandler:   opts.ErrorHandler,
+		ID:              uuid.New(),
+		Task:            opts.Task,
+		Target:          opts.Target,
+		IdempotencyKey:  opts.IdempotencyKey,
+		TraceID:         opts.TraceID,
+		ParentSpanID:    opts.ParentSpanID,
+		SuccessHandler:  opts.SuccessHandler,
+		ErrorHandler:    opts.ErrorHandler,
+		ProgressHandler: opts.ProgressHandler,
 	}
 
 	if err := req.SetArgs(opts.Args); err != nil {
 		return nil, err
 	}
 
+	if !opts.Deadline.IsZero() {
+		req.SetDeadline(opts.Deadline)
+	}
+
 	if opts.TaskURL != nil {
 		req.TaskURL = opts.TaskURL
 	} else if opts.TaskURLString != "" {
@@ -89,6 +152,29 @@ func NewRequest(opts RequestOptions) (*Request, error) {
 	return req, nil
 }
 
+// newAttempt returns a copy of the request under a new ID, for retrying it.
+func (req *Request) newAttempt() (*Request, error) {
+	retryReq := &Request{
+		ID:              uuid.New(),
+		Task:            req.Task,
+		TaskURL:         req.TaskURL,
+		Target:          req.Target,
+		ResponseHook:    req.ResponseHook,
+		StreamURL:       req.StreamURL,
+		Args:            req.Args,
+		IdempotencyKey:  req.IdempotencyKey,
+		TraceID:         req.TraceID,
+		ParentSpanID:    req.ParentSpanID,
+		SuccessHandler:  req.SuccessHandler,
+		ErrorHandler:    req.ErrorHandler,
+		ProgressHandler: req.ProgressHandler,
+	}
+	if req.Deadline != nil {
+		retryReq.SetDeadline(*req.Deadline)
+	}
+	return retryReq, retryReq.Validate()
+}
+
 // SetResponseHook is a convenience method to set the ResponseHook from a
 // string url.
 func (req *Request) SetResponseHook(urlString string) error {
@@ -123,6 +209,15 @@ func (req *Request) SetTaskURL(urlString string) error {
 	return nil
 }
 
+// SetDeadline sets the Deadline. An existing earlier deadline is kept, so a
+// deadline can only ever shrink.
+func (req *Request) SetDeadline(deadline time.Time) {
+	if req.Deadline != nil && req.Deadline.Before(deadline) {
+		return
+	}
+	req.Deadline = &deadline
+}
+
 // SetArgs sets the Args.
 func (req *Request) SetArgs(args interface{}) error {
 	argsJSON, err := json.Marshal(args)
@@ -157,22 +252,43 @@ func (req *Request) Validate() error {
 	if req.Task == "" {
 		return errors.Newv("missing task", map[string]interface{}{"requestID": req.ID, "request": req})
 	}
+	if req.Target != nil {
+		if req.TaskURL != nil {
+			return errors.NewWithCode(errors.CodeInvalidArgument, "target and taskURL are exclusive", map[string]interface{}{"requestID": req.ID, "request": req})
+		}
+		if err := req.Target.Validate(); err != nil {
+			return errors.Wrapv(err, map[string]interface{}{"requestID": req.ID})
+		}
+	}
 
 	return nil
 }
 
-// Respond sends a Response to the ResponseHook if present.
+// Respond sends a Response to the ResponseHook if present. Over a unix socket,
+// it is sent with the codec the request was received with, if not JSON, or
+// the DefaultCodec.
 func (req *Request) Respond(resp *Response) error {
 	if req.ResponseHook == nil {
 		return nil
 	}
-	return errors.Wrapv(Send(req.ResponseHook, resp), map[string]interface{}{"requestID": req.ID})
+	codec := req.codec
+	if codec == CodecJSON {
+		codec = DefaultCodec
+	}
+	return errors.Wrapv(send(req.ResponseHook, codec, resp), map[string]interface{}{"requestID": req.ID})
 }
 
-// HandleResponse determines whether a response indicates success or error and
-// runs the appropriate handler. If the appropriate handler is not defined, it
-// is assumed no handling is necessary and silently finishes.
+// HandleResponse determines whether a response indicates progress, success, or
+// error and runs the appropriate handler. If the appropriate handler is not
+// defined, it is assumed no handling is necessary and silently finishes.
 func (req *Request) HandleResponse(resp *Response) {
+	if resp.IsProgress() {
+		if req.ProgressHandler != nil {
+			req.ProgressHandler(req, resp)
+		}
+		return
+	}
+
 	if resp.Error != nil {
 		if req.ErrorHandler != nil {
 			req.ErrorHandler(req, resp)
@@ -185,3 +301,56 @@ func (req *Request) HandleResponse(resp *Response) {
 		return
 	}
 }
+
+// Done returns a channel that is closed when the request is cancelled.
+// Handlers performing long running work should watch it and abandon the work
+// once it is closed.
+func (req *Request) Done() <-chan struct{} {
+	req.doneLock.Lock()
+	defer req.doneLock.Unlock()
+
+	if req.done == nil {
+		req.done = make(chan struct{})
+	}
+	return req.done
+}
+
+// Cancel marks the request as cancelled, closing the Done channel. It is safe
+// to call multiple times.
+func (req *Request) Cancel() {
+	req.doneLock.Lock()
+	defer req.doneLock.Unlock()
+
+	if req.done == nil {
+		req.done = make(chan struct{})
+	}
+	select {
+	case <-req.done:
+	default:
+		close(req.done)
+	}
+}
+
+// Context returns a context derived from parent that expires at the request
+// Deadline, if set, and is cancelled when the request is cancelled. The
+// returned CancelFunc should be called once the request is handled.
+func (req *Request) Context(parent context.Context) (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if req.Deadline != nil {
+		ctx, cancel = context.WithDeadline(parent, *req.Deadline)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+
+	done := req.Done()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
@@ -6,11 +6,13 @@ import (
 	"net/url"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/cerana/cerana/acomm"
 	"github.com/pborman/uuid"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
 )
 
 type RequestTestSuite struct {
@@ -268,12 +270,19 @@ func (s *RequestTestSuite) TestValidate() {
 		id           string
 		task         string
 		responseHook *url.URL
+		taskURL      *url.URL
+		target       *acomm.Target
 		expectedErr  bool
 	}{
-		{"missing ID", "", "foo", rh, true},
-		{"missing Task", uuid.New(), "", rh, true},
-		{"missing ResponseHook", uuid.New(), "foo", nil, false},
-		{"valid", uuid.New(), "foo", rh, false},
+		{"missing ID", "", "foo", rh, nil, nil, true},
+		{"missing Task", uuid.New(), "", rh, nil, nil, true},
+		{"missing ResponseHook", uuid.New(), "foo", nil, nil, nil, false},
+		{"valid", uuid.New(), "foo", rh, nil, nil, false},
+		{"node target", uuid.New(), "foo", rh, nil, &acomm.Target{Node: "10.0.0.1"}, false},
+		{"bundle target", uuid.New(), "foo", rh, nil, &acomm.Target{Bundle: 1}, false},
+		{"empty target", uuid.New(), "foo", rh, nil, &acomm.Target{}, true},
+		{"multiple targets", uuid.New(), "foo", rh, nil, &acomm.Target{Node: "10.0.0.1", Dataset: "bar"}, true},
+		{"target and TaskURL", uuid.New(), "foo", rh, rh, &acomm.Target{Node: "10.0.0.1"}, true},
 	}
 
 	for _, test := range tests {
@@ -282,6 +291,8 @@ func (s *RequestTestSuite) TestValidate() {
 			ID:           test.id,
 			Task:         test.task,
 			ResponseHook: test.responseHook,
+			TaskURL:      test.taskURL,
+			Target:       test.target,
 		}
 		if test.expectedErr {
 			s.Error(req.Validate(), msg("should not be valid"))
@@ -291,6 +302,64 @@ func (s *RequestTestSuite) TestValidate() {
 	}
 }
 
+func (s *RequestTestSuite) TestCancel() {
+	req, err := acomm.NewRequest(acomm.RequestOptions{Task: "foobar"})
+	s.Require().NoError(err, "should have created request")
+
+	select {
+	case <-req.Done():
+		s.Fail("should not be done before cancel")
+	default:
+	}
+
+	req.Cancel()
+	req.Cancel()
+
+	select {
+	case <-req.Done():
+	default:
+		s.Fail("should be done after cancel")
+	}
+
+	cancelReq, err := acomm.NewCancelRequest(req.ID, acomm.RequestOptions{})
+	s.NoError(err, "should have created cancel request")
+	s.Equal(acomm.CancelTask, cancelReq.Task, "should have set the cancel task")
+	args := &acomm.CancelArgs{}
+	s.NoError(cancelReq.UnmarshalArgs(args), "should have valid args")
+	s.Equal(req.ID, args.RequestID, "should target the request")
+
+	_, err = acomm.NewCancelRequest("", acomm.RequestOptions{})
+	s.Error(err, "should require a request id")
+}
+
+func (s *RequestTestSuite) TestContext() {
+	req, err := acomm.NewRequest(acomm.RequestOptions{Task: "foobar"})
+	s.Require().NoError(err, "should have created request")
+
+	ctx, cancel := req.Context(context.Background())
+	defer cancel()
+	_, ok := ctx.Deadline()
+	s.False(ok, "should not have a deadline without a request deadline")
+	req.Cancel()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		s.Fail("should be done after request is cancelled")
+	}
+
+	deadline := time.Now().Add(time.Minute)
+	req, err = acomm.NewRequest(acomm.RequestOptions{Task: "foobar", Deadline: deadline})
+	s.Require().NoError(err, "should have created request")
+	req.SetDeadline(deadline.Add(time.Minute))
+	s.Equal(deadline, *req.Deadline, "should not extend the deadline")
+
+	ctx, cancel = req.Context(context.Background())
+	defer cancel()
+	ctxDeadline, ok := ctx.Deadline()
+	s.True(ok, "should have a deadline")
+	s.Equal(deadline, ctxDeadline, "should use the request deadline")
+}
+
 func generateHandlers() (acomm.ResponseHandler, acomm.ResponseHandler, map[string]int) {
 	handled := make(map[string]int)
 	sh := func(req *acomm.Request, resp *acomm.Response) {
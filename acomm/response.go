@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net"
-	"net/http"
 	"net/url"
 
 	"github.com/cerana/cerana/pkg/errors"
@@ -14,48 +13,113 @@ import (
 
 // Response is a response data structure for asynchronous requests. The ID
 // should be the same as the Request it corresponds to. Result should be nil if
-// Error is present and vice versa.
+// Error is present and vice versa. A Response with Progress set is an
+// intermediate progress message rather than the final response.
 type Response struct {
 	ID        string           `json:"id"`
 	Result    *json.RawMessage `json:"result"`
 	StreamURL *url.URL         `json:"streamURL"`
 	Error     error            `json:"error"`
+	Progress  *Progress        `json:"progress,omitempty"`
 }
 
-// MarshalJSON marshals a Response into JSON.
-func (r *Response) MarshalJSON() ([]byte, error) {
-	type Alias Response
+// responseWire is the encoded form of a Response, with the error flattened
+// into a message, a code identifying its type, and whether it is temporary.
+type responseWire struct {
+	ID        string           `json:"id"`
+	Result    *json.RawMessage `json:"result"`
+	StreamURL *url.URL         `json:"streamURL"`
+	Error     string           `json:"error"`
+	ErrorCode string           `json:"errorCode,omitempty"`
+	Temporary bool             `json:"temporary,omitempty"`
+	Progress  *Progress        `json:"progress,omitempty"`
+}
+
+// wire returns the encoded form of the Response.
+func (r *Response) wire() *responseWire {
 	respErr := r.Error
 	if respErr == nil {
 		respErr = errors.New("")
 	}
-	return json.Marshal(&struct {
-		Error string `json:"error"`
-		*Alias
-	}{
-		Error: respErr.Error(),
-		Alias: (*Alias)(r),
-	})
+	return &responseWire{
+		ID:        r.ID,
+		Result:    r.Result,
+		StreamURL: r.StreamURL,
+		Error:     respErr.Error(),
+		ErrorCode: errorCode(respErr),
+		Temporary: r.Error != nil && IsTemporary(r.Error),
+		Progress:  r.Progress,
+	}
+}
+
+// fromWire sets the Response from its encoded form.
+func (r *Response) fromWire(w *responseWire) {
+	r.ID = w.ID
+	r.Result = w.Result
+	r.StreamURL = w.StreamURL
+	r.Progress = w.Progress
+	r.Error = nil
+	if w.Error != "" {
+		r.Error = newCodedError(w.ErrorCode, w.Temporary, w.Error, map[string]interface{}{"requestID": r.ID})
+	}
+}
+
+// MarshalJSON marshals a Response into JSON.
+func (r *Response) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.wire())
 }
 
 // UnmarshalJSON unmarshals JSON data into a Response.
 func (r *Response) UnmarshalJSON(data []byte) error {
-	type Alias Response
-	aux := &struct {
-		Error string `json:"error"`
-		*Alias
-	}{
-		Alias: (*Alias)(r),
-	}
-	if err := json.Unmarshal(data, &aux); err != nil {
+	w := &responseWire{}
+	if err := json.Unmarshal(data, w); err != nil {
 		return errors.Wrapv(err, map[string]interface{}{"requestID": r.ID})
 	}
-	if aux.Error != "" {
-		r.Error = errors.Newv(aux.Error, map[string]interface{}{"requestID": r.ID})
-	}
+	r.fromWire(w)
 	return nil
 }
 
+// errorCode returns the code identifying the type of a response error, if it
+// is one that should be preserved across the wire. Temporary errors without
+// another code use the temporary code understood by older peers.
+func errorCode(err error) string {
+	if IsCancelled(err) {
+		return errorCodeCancelled
+	}
+	if code := errors.GetCode(err); code != "" {
+		return string(code)
+	}
+	if IsTemporary(err) {
+		return errorCodeTemporary
+	}
+	return ""
+}
+
+// newCodedError recreates a response error of the type identified by code,
+// marked as temporary if it was.
+func newCodedError(code string, temporary bool, msg string, values map[string]interface{}) error {
+	var err error
+	switch code {
+	case errorCodeForbidden:
+		err = NewForbiddenError(msg, values)
+	case errorCodeCancelled:
+		err = NewCancelledError(msg, values)
+	case errorCodeTemporary:
+		return NewTemporaryError(msg, values)
+	case "":
+		if temporary {
+			return NewTemporaryError(msg, values)
+		}
+		err = errors.Newv(msg, values)
+	default:
+		err = errors.NewWithCode(errors.Code(code), msg, values)
+	}
+	if temporary {
+		err = errors.MarkTemporary(err)
+	}
+	return err
+}
+
 // NewResponse creates a new Response instance based on a Request.
 func NewResponse(req *Request, result interface{}, streamURL *url.URL, respErr error) (*Response, error) {
 	if req == nil {
@@ -88,14 +152,20 @@ func (r *Response) UnmarshalResult(dest interface{}) error {
 	return unmarshalFromRaw(r.Result, dest)
 }
 
-// Send attempts send the payload to the specified URL.
+// Send attempts send the payload to the specified URL. Over a unix socket, it
+// is sent with the DefaultCodec.
 func Send(addr *url.URL, payload interface{}) error {
+	return send(addr, DefaultCodec, payload)
+}
+
+// send sends the payload to the URL, with the codec if over a unix socket.
+func send(addr *url.URL, codec Codec, payload interface{}) error {
 	if addr == nil {
 		return errors.New("missing addr")
 	}
 	switch addr.Scheme {
 	case "unix":
-		return sendUnix(addr, payload)
+		return sendUnix(addr, codec, payload)
 	case "http", "https":
 		return sendHTTP(addr, payload)
 	default:
@@ -103,18 +173,29 @@ func Send(addr *url.URL, payload interface{}) error {
 	}
 }
 
-// sendUnix sends a request or response via a Unix socket.
-func sendUnix(addr *url.URL, payload interface{}) error {
+// sendUnix sends a request or response via a Unix socket. If the peer does not
+// accept the codec, the payload is sent again as JSON.
+func sendUnix(addr *url.URL, codec Codec, payload interface{}) error {
+	err := sendUnixCodec(addr, codec, payload)
+	if codec != CodecJSON && isUnsupportedCodec(err) {
+		err = sendUnixCodec(addr, CodecJSON, payload)
+	}
+	return err
+}
+
+// sendUnixCodec sends a request or response via a Unix socket with the codec.
+func sendUnixCodec(addr *url.URL, codec Codec, payload interface{}) error {
 	conn, err := net.Dial("unix", addr.RequestURI())
 	if err != nil {
-		return errors.Wrapv(err, map[string]interface{}{"addr": addr, "payload": payload})
+		// Nothing was sent, so it is safe to try again
+		return errors.WithCode(NewTemporaryError(err.Error(), map[string]interface{}{"addr": addr, "payload": payload}), errors.CodeUnavailable)
 	}
 	defer logrusx.LogReturnedErr(conn.Close,
 		map[string]interface{}{"addr": addr},
 		"failed to close unix connection",
 	)
 
-	if err := SendConnData(conn, payload); err != nil {
+	if err := WriteConnData(conn, codec, payload); err != nil {
 		return err
 	}
 
@@ -133,9 +214,14 @@ func sendHTTP(addr *url.URL, payload interface{}) error {
 		return errors.Wrapv(err, map[string]interface{}{"payload": payload})
 	}
 
-	httpResp, err := http.Post(addr.String(), "application/json", bytes.NewReader(payloadJSON))
+	httpResp, err := httpClient().Post(addr.String(), "application/json", bytes.NewReader(payloadJSON))
 	if err != nil {
-		return errors.Wrapv(err, map[string]interface{}{"addr": addr, "payload": payload})
+		errData := map[string]interface{}{"addr": addr, "payload": payload}
+		if isDialError(err) {
+			// Nothing was sent, so it is safe to try again
+			return errors.WithCode(NewTemporaryError(err.Error(), errData), errors.CodeUnavailable)
+		}
+		return errors.Wrapv(err, errData)
 	}
 	defer logrusx.LogReturnedErr(httpResp.Body.Close, nil, "failed to close http body")
 
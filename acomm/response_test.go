@@ -14,6 +14,7 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/cerana/cerana/acomm"
+	cerrors "github.com/cerana/cerana/pkg/errors"
 	"github.com/pborman/uuid"
 	"github.com/stretchr/testify/suite"
 )
@@ -159,3 +160,79 @@ func (s *ResponseTestSuite) TestSend() {
 		}
 	}
 }
+
+func (s *ResponseTestSuite) TestErrorCodeJSON() {
+	request, err := acomm.NewRequest(acomm.RequestOptions{Task: "foobar"})
+	s.Require().NoError(err, "should have created request")
+
+	tests := []struct {
+		description string
+		err         error
+		forbidden   bool
+		cancelled   bool
+	}{
+		{"plain error", errors.New("foobar"), false, false},
+		{"forbidden error", acomm.NewForbiddenError("not allowed", nil), true, false},
+		{"cancelled error", acomm.NewCancelledError("cancelled", nil), false, true},
+	}
+
+	for _, test := range tests {
+		msg := testMsgFunc(test.description)
+		resp, err := acomm.NewResponse(request, nil, nil, test.err)
+		if !s.NoError(err, msg("should have created response")) {
+			continue
+		}
+		s.Equal(test.forbidden, acomm.IsForbidden(resp.Error), msg("should be correctly identified as forbidden"))
+		s.Equal(test.cancelled, acomm.IsCancelled(resp.Error), msg("should be correctly identified as cancelled"))
+
+		respJSON, err := json.Marshal(resp)
+		if !s.NoError(err, msg("should have marshalled response")) {
+			continue
+		}
+		decoded := &acomm.Response{}
+		if !s.NoError(json.Unmarshal(respJSON, decoded), msg("should have unmarshalled response")) {
+			continue
+		}
+		s.Equal(test.err.Error(), decoded.Error.Error(), msg("should have preserved the error message"))
+		s.Equal(test.forbidden, acomm.IsForbidden(decoded.Error), msg("should have preserved the forbidden type"))
+		s.Equal(test.cancelled, acomm.IsCancelled(decoded.Error), msg("should have preserved the cancelled type"))
+	}
+}
+
+func (s *ResponseTestSuite) TestErrorCodes() {
+	request, err := acomm.NewRequest(acomm.RequestOptions{Task: "foobar"})
+	s.Require().NoError(err, "should have created request")
+
+	tests := []struct {
+		description string
+		err         error
+		code        cerrors.Code
+		temporary   bool
+	}{
+		{"uncoded error", errors.New("foobar"), "", false},
+		{"coded error", cerrors.NewWithCode(cerrors.CodeNotFound, "foobar", nil), cerrors.CodeNotFound, false},
+		{"temporary error", acomm.NewTemporaryError("foobar", nil), "", true},
+		{"coded temporary error", cerrors.MarkTemporary(cerrors.NewWithCode(cerrors.CodeUnavailable, "foobar", nil)), cerrors.CodeUnavailable, true},
+		{"forbidden error", acomm.NewForbiddenError("foobar", nil), cerrors.CodeForbidden, false},
+	}
+
+	for _, test := range tests {
+		msg := testMsgFunc(test.description)
+		resp, err := acomm.NewResponse(request, nil, nil, test.err)
+		if !s.NoError(err, msg("should have created response")) {
+			continue
+		}
+
+		respJSON, err := json.Marshal(resp)
+		if !s.NoError(err, msg("should have marshalled response")) {
+			continue
+		}
+		decoded := &acomm.Response{}
+		if !s.NoError(json.Unmarshal(respJSON, decoded), msg("should have unmarshalled response")) {
+			continue
+		}
+		s.Equal(test.err.Error(), decoded.Error.Error(), msg("should have preserved the error message"))
+		s.Equal(test.code, cerrors.GetCode(decoded.Error), msg("should have preserved the code"))
+		s.Equal(test.temporary, acomm.IsTemporary(decoded.Error), msg("should have preserved whether the error is temporary"))
+	}
+}
@@ -0,0 +1,118 @@
+package acomm
+
+import (
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/cerana/cerana/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// errorCodeTemporary is the response error code identifying a temporary
+// error.
+const errorCodeTemporary = "temporary"
+
+// TemporaryError is an error for a failure that may succeed if the request is
+// retried, such as no provider being available for a task. It is preserved
+// across the wire when sent as a Response error.
+type TemporaryError struct {
+	Message string `json:"message"`
+}
+
+// NewTemporaryError creates a new TemporaryError with a callstack.
+func NewTemporaryError(msg string, values map[string]interface{}) error {
+	return errors.Wrapv(&TemporaryError{Message: msg}, values)
+}
+
+// Error returns the error message.
+func (e *TemporaryError) Error() string {
+	return e.Message
+}
+
+// Temporary returns true.
+func (e *TemporaryError) Temporary() bool {
+	return true
+}
+
+// IsTemporary returns whether the error, or its underlying cause, is marked
+// as temporary. See errors.IsTemporary.
+func IsTemporary(err error) bool {
+	return errors.IsTemporary(err)
+}
+
+// isDialError returns whether the error is from failing to connect, in which
+// case nothing was sent.
+func isDialError(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	opErr, ok := err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
+
+// RetryPolicy controls the retrying of requests that fail with temporary
+// errors. Retried requests get a new ID but keep the idempotency key, so a
+// provider that already handled the request returns the original result.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	// Backoff is the delay before the first retry. It doubles for each
+	// subsequent retry.
+	Backoff time.Duration
+	// MaxBackoff, if set, caps the delay between retries.
+	MaxBackoff time.Duration
+}
+
+// shouldRetry returns whether another attempt should be made after the
+// attempt number, starting at 1, failed with the error.
+func (p *RetryPolicy) shouldRetry(attempt int, err error) bool {
+	return p != nil && attempt < p.MaxAttempts && IsTemporary(err)
+}
+
+// delay returns how long to wait before the next attempt after the attempt
+// number, starting at 1.
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxBackoff > 0 && delay >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// wait waits for the delay before the next attempt, returning false if the
+// context is done first.
+func (p *RetryPolicy) wait(ctx context.Context, attempt int) bool {
+	timer := time.NewTimer(p.delay(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// SetRetryPolicy sets the retry policy used by SyncRequest and by
+// MultiRequests created with the tracker. A nil policy disables retries.
+func (t *Tracker) SetRetryPolicy(policy *RetryPolicy) {
+	t.retryLock.Lock()
+	defer t.retryLock.Unlock()
+
+	t.retry = policy
+}
+
+// retryPolicy returns the tracker's retry policy.
+func (t *Tracker) retryPolicy() *RetryPolicy {
+	t.retryLock.Lock()
+	defer t.retryLock.Unlock()
+
+	return t.retry
+}
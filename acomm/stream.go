@@ -1,81 +1,446 @@
 package acomm
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/cerana/cerana/pkg/errors"
 	"github.com/cerana/cerana/pkg/logrusx"
+	"github.com/cerana/cerana/pkg/prometheusx"
 )
 
-// NewStreamUnix sets up an ad-hoc unix listner to stream data.
-func (t *Tracker) NewStreamUnix(dir string, src io.ReadCloser) (*url.URL, error) {
+// streamResumeAttempts is the number of times Stream resumes an interrupted
+// http stream, waiting streamResumeDelay longer before each attempt.
+const (
+	streamResumeAttempts = 5
+	streamResumeDelay    = 100 * time.Millisecond
+)
+
+// dataStream is a registered stream. Non-seekable streams are unregistered
+// when opened. Seekable streams remain registered so they can be retrieved
+// again or from an offset, expiring once unused for the tracker's default timeout. The source is
+// closed once the stream is unregistered and no longer being read.
+type dataStream struct {
+	source     streamSource
+	expire     *time.Timer
+	active     int
+	registered time.Time
+}
+
+// TrackedStream describes a registered data stream, for introspection. Readers
+// is the number of times it is currently being read.
+type TrackedStream struct {
+	ID         string    `json:"id"`
+	Registered time.Time `json:"registered"`
+	Age        string    `json:"age"`
+	Readers    int       `json:"readers"`
+}
+
+// streamRequest is sent over the stream socket to request stream data.
+type streamRequest struct {
+	ID     string `json:"id"`
+	Offset int64  `json:"offset,omitempty"`
+}
+
+// activeStream counts the bytes read from its stream and releases it when
+// closed.
+type activeStream struct {
+	io.ReadCloser
+	release func()
+}
+
+func (a *activeStream) Read(p []byte) (int, error) {
+	n, err := a.ReadCloser.Read(p)
+	prometheusx.StreamBytes.Add(float64(n))
+	return n, err
+}
+
+func (a *activeStream) Close() error {
+	defer a.release()
+	return a.ReadCloser.Close()
+}
+
+// NewStream registers a source of data with the tracker's stream listener and
+// returns the unix URL for retrieving it. A source that is not seekable can be
+// retrieved once. If it is not retrieved within the tracker's default
+// timeout, it is discarded and the source closed. Seekable sources, such as
+// regular files, can be retrieved repeatedly from any offset until unused for
+// the default timeout.
+func (t *Tracker) NewStream(src io.ReadCloser) (*url.URL, error) {
 	if src == nil {
 		return nil, errors.New("missing stream src")
 	}
 
-	socketPath, err := generateTempSocketPath(dir, "")
+	id, err := t.registerStream(newStreamSource(src))
 	if err != nil {
 		return nil, err
 	}
+	return t.streamURL(id), nil
+}
+
+// streamURL returns the unix URL for retrieving a registered stream.
+func (t *Tracker) streamURL(id string) *url.URL {
+	addr := t.streamListener.URL()
+	addr.RawQuery = url.Values{"id": []string{id}}.Encode()
+	return addr
+}
+
+// ProxyStreamHTTPURL registers a unix stream with the tracker for proxying
+// over http and generates the url for retrieving it.
+func (t *Tracker) ProxyStreamHTTPURL(addr *url.URL) (*url.URL, error) {
+	if t.httpStreamURL == nil {
+		return nil, errors.New("tracker missing http stream url")
+	}
+
+	if addr == nil {
+		return nil, errors.New("missing addr")
+	}
 
-	ul := NewUnixListener(socketPath, 1)
-	if err := ul.Start(); err != nil {
+	id, err := t.registerStream(&streamProxy{addr: addr})
+	if err != nil {
 		return nil, err
 	}
 
-	t.dsLock.Lock()
-	t.dataStreams[socketPath] = ul
-	t.dsLock.Unlock()
+	streamAddr := &url.URL{}
+	*streamAddr = *t.httpStreamURL
+	q := streamAddr.Query()
+	q.Set("id", id)
+	streamAddr.RawQuery = q.Encode()
 
-	go func() {
-		defer func() {
-			logrusx.LogReturnedErr(src.Close, map[string]interface{}{"socketPath": socketPath}, "failed to close stream source")
+	return streamAddr, nil
+}
 
-			t.dsLock.Lock()
-			delete(t.dataStreams, socketPath)
-			t.dsLock.Unlock()
-		}()
+// ProxyStreamHandler is an HTTP HandlerFunc for retrieving streams registered
+// with ProxyStreamHTTPURL. Unknown stream ids are not found.
+func (t *Tracker) ProxyStreamHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if !t.hasStream(id) {
+		http.Error(w, "stream not found", http.StatusNotFound)
+		return
+	}
 
-		conn := ul.NextConn()
-		if conn == nil {
-			return
+	open := func(offset int64) (io.ReadCloser, *streamInfo, error) {
+		return t.openStream(id, offset)
+	}
+	if err := serveStream(w, r, open); err != nil {
+		err = errors.Wrapv(err, map[string]interface{}{"streamID": id})
+		logrus.WithField("error", err).Error("failed to stream data")
+	}
+}
+
+// ServeStream writes stream data to an http response. If src is seekable,
+// such as a regular file, a Range request is honored and the length of the
+// data is reported. Otherwise, the data is compressed with the first encoding
+// in the request's Accept-Encoding that is supported, and a digest of the
+// uncompressed data is sent in the trailer. If streaming fails, the digest is
+// omitted so the reader knows the data is incomplete. The src is not closed.
+func ServeStream(w http.ResponseWriter, r *http.Request, src io.Reader) error {
+	return serveStream(w, r, newStreamSource(src).open)
+}
+
+// serveStream writes the data from a stream source to an http response.
+func serveStream(w http.ResponseWriter, r *http.Request, open func(int64) (io.ReadCloser, *streamInfo, error)) error {
+	start, end, ranged := parseRange(r.Header.Get("Range"))
+	if !ranged {
+		start, end = 0, -1
+	}
+
+	data, info, err := open(start)
+	if err != nil {
+		http.Error(w, "failed to stream data", http.StatusInternalServerError)
+		return err
+	}
+	if data == nil {
+		http.Error(w, "stream does not support ranges", http.StatusRequestedRangeNotSatisfiable)
+		return nil
+	}
+	defer logrusx.LogReturnedErr(data.Close, nil, "failed to close stream data")
+
+	if !info.Seekable {
+		return serveEncoded(w, r, data)
+	}
+
+	w.Header().Set("Accept-Ranges", "bytes")
+	if ranged && start != 0 && start >= info.Size {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+		http.Error(w, "invalid range", http.StatusRequestedRangeNotSatisfiable)
+		return nil
+	}
+	if end < 0 || end >= info.Size {
+		end = info.Size - 1
+	}
+	length := end - start + 1
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	status := http.StatusOK
+	if ranged {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, info.Size))
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+
+	_, err = io.CopyN(w, data, length)
+	return errors.Wrap(err, "failed to stream data")
+}
+
+// serveEncoded writes compressed stream data to an http response, followed
+// by a digest trailer.
+func serveEncoded(w http.ResponseWriter, r *http.Request, data io.Reader) error {
+	encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	enc, err := newEncoder(encoding, w)
+	if err != nil {
+		http.Error(w, "failed to stream data", http.StatusInternalServerError)
+		return err
+	}
+
+	w.Header().Set("Trailer", streamBytesHeader+", "+streamSHA256Header)
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+
+	d := newDigester()
+	if _, err := io.Copy(io.MultiWriter(enc, d), data); err != nil {
+		return errors.Wrap(err, "failed to stream data")
+	}
+	if err := enc.Close(); err != nil {
+		return errors.Wrapv(err, map[string]interface{}{"encoding": encoding}, "failed to flush stream data")
+	}
+
+	d.Digest().setTrailer(w.Header())
+	return nil
+}
+
+// registerStream adds a stream source to the registry under a new opaque id.
+func (t *Tracker) registerStream(source streamSource) (string, error) {
+	id, err := newStreamID()
+	if err != nil {
+		return "", err
+	}
+
+	t.streamsLock.Lock()
+	defer t.streamsLock.Unlock()
+
+	if t.status != statusStarted {
+		return "", errors.New("tracker not started")
+	}
+
+	ds := &dataStream{source: source, registered: time.Now()}
+	ds.expire = time.AfterFunc(t.defaultTimeout, func() {
+		t.expireStream(id, ds)
+	})
+	t.streams[id] = ds
+	return id, nil
+}
+
+// Streams returns descriptions of the registered data streams, oldest first.
+func (t *Tracker) Streams() []*TrackedStream {
+	t.streamsLock.Lock()
+	defer t.streamsLock.Unlock()
+
+	now := time.Now()
+	streams := make([]*TrackedStream, 0, len(t.streams))
+	for id, ds := range t.streams {
+		streams = append(streams, &TrackedStream{
+			ID:         id,
+			Registered: ds.registered,
+			Age:        now.Sub(ds.registered).String(),
+			Readers:    ds.active,
+		})
+	}
+	sort.Stable(byRegistered(streams))
+	return streams
+}
+
+// byRegistered sorts streams by the time they were registered.
+type byRegistered []*TrackedStream
+
+func (b byRegistered) Len() int           { return len(b) }
+func (b byRegistered) Less(i, j int) bool { return b[i].Registered.Before(b[j].Registered) }
+func (b byRegistered) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// hasStream returns whether a stream is registered.
+func (t *Tracker) hasStream(id string) bool {
+	t.streamsLock.Lock()
+	defer t.streamsLock.Unlock()
+
+	_, ok := t.streams[id]
+	return ok
+}
+
+// openStream opens a registered stream from an offset. The returned reader
+// must be closed when done.
+func (t *Tracker) openStream(id string, offset int64) (io.ReadCloser, *streamInfo, error) {
+	t.streamsLock.Lock()
+	ds, ok := t.streams[id]
+	if ok {
+		ds.active++
+		ds.expire.Stop()
+	}
+	t.streamsLock.Unlock()
+
+	if !ok {
+		return nil, nil, errors.Newv("stream not found", map[string]interface{}{"streamID": id})
+	}
+
+	data, info, err := ds.source.open(offset)
+	if err != nil || data == nil {
+		t.releaseStream(id, ds)
+		return nil, info, errors.Wrapv(err, map[string]interface{}{"streamID": id})
+	}
+
+	if !info.Seekable {
+		// Data that can't be read again is no longer available
+		t.streamsLock.Lock()
+		if t.streams[id] == ds {
+			delete(t.streams, id)
+		}
+		t.streamsLock.Unlock()
+	}
+
+	return &activeStream{
+		ReadCloser: data,
+		release:    func() { t.releaseStream(id, ds) },
+	}, info, nil
+}
+
+// releaseStream marks that a reader of a stream is done. A registered stream
+// begins expiring once it has no readers, while an unregistered one is
+// closed.
+func (t *Tracker) releaseStream(id string, ds *dataStream) {
+	t.streamsLock.Lock()
+	ds.active--
+	registered := t.streams[id] == ds
+	if registered && ds.active == 0 {
+		ds.expire.Reset(t.defaultTimeout)
+	}
+	closeSource := !registered && ds.active == 0
+	t.streamsLock.Unlock()
+
+	if closeSource {
+		logrusx.LogReturnedErr(ds.source.Close, map[string]interface{}{"streamID": id}, "failed to close stream source")
+	}
+}
+
+// expireStream unregisters a stream that has gone unused for too long.
+func (t *Tracker) expireStream(id string, ds *dataStream) {
+	t.streamsLock.Lock()
+	if t.streams[id] != ds || ds.active > 0 {
+		t.streamsLock.Unlock()
+		return
+	}
+	delete(t.streams, id)
+	t.streamsLock.Unlock()
+
+	logrus.WithField("streamID", id).Info("stream expired")
+	logrusx.LogReturnedErr(ds.source.Close, map[string]interface{}{"streamID": id}, "failed to close stream source")
+}
+
+// closeStreams unregisters all streams, closing those not being read.
+func (t *Tracker) closeStreams() {
+	t.streamsLock.Lock()
+	defer t.streamsLock.Unlock()
+
+	for id, ds := range t.streams {
+		ds.expire.Stop()
+		delete(t.streams, id)
+		if ds.active == 0 {
+			logrusx.LogReturnedErr(ds.source.Close, map[string]interface{}{"streamID": id}, "failed to close stream source")
 		}
-		defer ul.DoneConn(conn)
+	}
+}
+
+// newStreamID generates an unguessable stream id.
+func newStreamID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "failed to generate stream id")
+	}
+	return hex.EncodeToString(b), nil
+}
 
-		if _, err := io.Copy(conn, src); err != nil {
-			err = errors.Wrapv(err, map[string]interface{}{"socketPath": socketPath}, "failed to stream data")
-			logrus.WithField("error", err).Error(err.Error())
+// listenForStreams continually accepts new stream connections on the
+// listener.
+func (t *Tracker) listenForStreams() {
+	for {
+		conn := t.streamListener.NextConn()
+		if conn == nil {
 			return
 		}
-	}()
 
-	return ul.URL(), nil
+		go t.handleStreamConn(conn)
+	}
 }
 
-// ProxyStreamHTTPURL generates the url for proxying streaming data from a unix
-// socket.
-func (t *Tracker) ProxyStreamHTTPURL(addr *url.URL) (*url.URL, error) {
-	if t.httpStreamURL == nil {
-		return nil, errors.New("tracker missing http stream url")
+// handleStreamConn reads the id of the requested stream and writes the
+// stream data to the connection.
+func (t *Tracker) handleStreamConn(conn net.Conn) {
+	defer t.streamListener.DoneConn(conn)
+
+	sreq := &streamRequest{}
+	codec, err := t.streamListener.ReadConnData(conn, sreq)
+	if err != nil {
+		logrus.WithField("error", errors.Wrap(err)).Error("failed to unmarshal stream request")
+		return
 	}
 
-	if addr == nil {
-		return nil, errors.New("missing addr")
+	data, info, err := t.openStream(sreq.ID, sreq.Offset)
+	if err != nil {
+		if err := WriteConnData(conn, codec, &Response{Error: err}); err != nil {
+			logrus.WithField("error", err).Error("failed to respond to stream request")
+		}
+		return
 	}
-	streamAddr := &url.URL{}
-	*streamAddr = *t.httpStreamURL
-	q := streamAddr.Query()
-	q.Set("addr", addr.String())
-	streamAddr.RawQuery = q.Encode()
 
-	return streamAddr, nil
+	// The ack describes the stream so the reader knows whether it is seekable
+	infoJSON, _ := json.Marshal(info)
+	if err := WriteConnData(conn, codec, &Response{Result: (*json.RawMessage)(&infoJSON)}); err != nil {
+		logrus.WithField("error", err).Error("failed to ack stream request")
+		if data != nil {
+			logrusx.LogReturnedErr(data.Close, nil, "failed to close stream data")
+		}
+		return
+	}
+	if data == nil {
+		// The offset is not supported, which the info tells the reader
+		return
+	}
+	defer logrusx.LogReturnedErr(data.Close, map[string]interface{}{"streamID": sreq.ID}, "failed to close stream data")
+
+	// Data is sent in chunks followed by the digest. On failure, the end of
+	// the chunks is never marked so the reader knows the data is incomplete.
+	cw := &chunkWriter{w: conn}
+	d := newDigester()
+	if _, err := io.Copy(io.MultiWriter(cw, d), data); err != nil {
+		err = errors.Wrapv(err, map[string]interface{}{"streamID": sreq.ID}, "failed to stream data")
+		logrus.WithField("error", err).Error(err.Error())
+		return
+	}
+	if err := cw.Close(); err != nil {
+		logrus.WithField("error", errors.Wrapv(err, map[string]interface{}{"streamID": sreq.ID})).Error("failed to end stream data")
+		return
+	}
+	if err := WriteConnData(conn, codec, d.Digest()); err != nil {
+		logrus.WithField("error", errors.Wrapv(err, map[string]interface{}{"streamID": sreq.ID})).Error("failed to send stream digest")
+	}
 }
 
-// Stream streams data from a URL to a destination writer.
+// Stream streams data from a URL to a destination writer. The data is
+// verified against the digest sent by the source after it has been written
+// to dest, so an error means the written data should not be trusted. Http
+// streams from seekable sources are resumed from the last received offset if
+// interrupted. Unix streams and streams from non-seekable sources, such as zfs
+// sends, are not resumed.
 func Stream(dest io.Writer, addr *url.URL) error {
 	if dest == nil {
 		return errors.New("missing dest")
@@ -96,48 +461,64 @@ func Stream(dest io.Writer, addr *url.URL) error {
 
 // streamUnix streams data from a unix socket to a destination writer.
 func streamUnix(dest io.Writer, addr *url.URL) error {
-	conn, err := net.Dial("unix", addr.RequestURI())
+	data, _, err := openUnixStream(addr, 0)
 	if err != nil {
-		return errors.Wrapv(err, map[string]interface{}{"addr": addr})
+		return err
 	}
-	defer logrusx.LogReturnedErr(conn.Close,
+	defer logrusx.LogReturnedErr(data.Close,
 		map[string]interface{}{"addr": addr},
 		"failed to close stream connection",
 	)
 
-	_, err = io.Copy(dest, conn)
+	_, err = io.Copy(dest, data)
 	return errors.Wrapv(err, map[string]interface{}{"addr": addr})
 }
 
-// streamHTTP streams data from an http connection to a destination writer.
+// streamHTTP streams data from an http connection to a destination writer,
+// resuming after transient failures if the source supports ranges.
 func streamHTTP(dest io.Writer, addr *url.URL) error {
-	httpResp, err := http.Get(addr.String())
-	if err != nil {
-		return errors.Wrapv(err, map[string]interface{}{"addr": addr})
-	}
-	defer logrusx.LogReturnedErr(httpResp.Body.Close,
-		map[string]interface{}{"addr": addr},
-		"failed to close stream response body",
-	)
+	var offset int64
+	var resumable bool
+	for attempt := 0; ; attempt++ {
+		data, info, err := openHTTPStream(addr, offset)
+		if err == nil && data == nil {
+			resumable = false
+			err = errors.New("stream cannot be resumed")
+		}
+		if err == nil {
+			resumable = info.Seekable
+			var n int64
+			n, err = io.Copy(dest, data)
+			offset += n
+			logrusx.LogReturnedErr(data.Close,
+				map[string]interface{}{"addr": addr},
+				"failed to close stream response body",
+			)
+			if err == nil {
+				return nil
+			}
+		}
 
-	_, err = io.Copy(dest, httpResp.Body)
-	return errors.Wrapv(err, map[string]interface{}{"addr": addr})
-}
+		err = errors.Wrapv(err, map[string]interface{}{"addr": addr, "offset": offset})
+		if !resumable || attempt >= streamResumeAttempts || !isTransientStreamError(err) {
+			return err
+		}
 
-// ProxyStreamHandler is an HTTP HandlerFunc for simple proxy streaming.
-func ProxyStreamHandler(w http.ResponseWriter, r *http.Request) {
-	addr, err := url.ParseRequestURI(r.URL.Query().Get("addr"))
-	if err != nil {
-		http.Error(w, "invalid addr", http.StatusBadRequest)
-		return
+		logrus.WithFields(logrus.Fields{
+			"error":   err,
+			"attempt": attempt + 1,
+		}).Warn("resuming interrupted stream")
+		time.Sleep(time.Duration(attempt+1) * streamResumeDelay)
 	}
+}
 
-	if err := Stream(w, addr); err != nil {
-		if _, ok := errors.Cause(err).(*net.OpError); ok {
-			// TODO: find out what the result is for "not-exist" and return 404
-			logrus.WithField("error", err).Error("failed to stream data")
-		}
-		http.Error(w, "failed to stream data", http.StatusInternalServerError)
-		return
+// isTransientStreamError returns whether a stream failure may succeed if
+// retried, such as a dropped connection.
+func isTransientStreamError(err error) bool {
+	cause := errors.Cause(err)
+	if cause == io.ErrUnexpectedEOF {
+		return true
 	}
+	_, ok := cause.(net.Error)
+	return ok
 }
@@ -2,25 +2,65 @@ package acomm_test
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/cerana/cerana/acomm"
 )
 
-func (s *TrackerTestSuite) TestNewStreamUnix() {
-	if !s.NoError(s.Tracker.Start(), "failed to start Tracker") {
-		return
+// failingReader returns data followed by an error instead of EOF.
+type failingReader struct {
+	data io.Reader
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.data.Read(p)
+	if err == io.EOF {
+		err = errors.New("source failed")
 	}
+	return n, err
+}
+
+func (s *TrackerTestSuite) TestNewStream() {
 	data := []byte("foobar")
 	src := ioutil.NopCloser(bytes.NewReader(data))
 
-	addr, err := s.Tracker.NewStreamUnix("", nil)
+	addr, err := s.Tracker.NewStream(src)
+	s.Nil(addr, "shouldn't be able to create stream before tracker is started")
+	s.Error(err, "shouldn't be able to create stream before tracker is started")
+
+	if !s.NoError(s.Tracker.Start(), "failed to start Tracker") {
+		return
+	}
+
+	addr, err = s.Tracker.NewStream(nil)
 	s.Nil(addr, "shouldn't be able to create stream without src")
 	s.Error(err, "shouldn't be able to create stream without src")
 
-	addr, err = s.Tracker.NewStreamUnix("", src)
-	s.NotNil(addr, "should create streqm with src")
+	addr, err = s.Tracker.NewStream(src)
+	s.NotNil(addr, "should create stream with src")
+	s.NoError(err, "should create stream with src")
+	s.NotEmpty(addr.Query().Get("id"), "should have a stream id")
+
+	addr2, err := s.Tracker.NewStream(src)
 	s.NoError(err, "should create stream with src")
+	s.Equal(addr.Path, addr2.Path, "streams should share a listener")
+	s.NotEqual(addr.Query().Get("id"), addr2.Query().Get("id"), "streams should have unique ids")
+
+	streams := s.Tracker.Streams()
+	if s.Len(streams, 2, "should list the registered streams") {
+		ids := []string{streams[0].ID, streams[1].ID}
+		s.Contains(ids, addr.Query().Get("id"))
+		s.Contains(ids, addr2.Query().Get("id"))
+		s.Equal(0, streams[0].Readers, "should not be read yet")
+	}
 }
 
 func (s *TrackerTestSuite) TestStreamUnix() {
@@ -29,7 +69,7 @@ func (s *TrackerTestSuite) TestStreamUnix() {
 	}
 	data := []byte("foobar")
 	src := ioutil.NopCloser(bytes.NewReader(data))
-	addr, err := s.Tracker.NewStreamUnix("", src)
+	addr, err := s.Tracker.NewStream(src)
 	if !s.NoError(err) {
 		return
 	}
@@ -48,6 +88,30 @@ func (s *TrackerTestSuite) TestStreamUnix() {
 
 	s.Error(acomm.Stream(&dest, addr), "stream should only be available once")
 	s.Equal(0, dest.Len(), "should not have streamed any data")
+
+	unknown := *addr
+	unknown.RawQuery = url.Values{"id": []string{"foobar"}}.Encode()
+	s.Error(acomm.Stream(&dest, &unknown), "should not stream an unknown id")
+	s.Equal(0, dest.Len(), "should not have streamed any data")
+}
+
+func (s *TrackerTestSuite) TestStreamExpire() {
+	streamAddr, _ := url.ParseRequestURI(s.StreamServer.URL)
+	tracker, err := acomm.NewTracker("", streamAddr, nil, 500*time.Millisecond)
+	s.Require().NoError(err)
+	s.Require().NoError(tracker.Start())
+	defer tracker.Stop()
+
+	src := ioutil.NopCloser(bytes.NewReader([]byte("foobar")))
+	addr, err := tracker.NewStream(src)
+	if !s.NoError(err) {
+		return
+	}
+
+	time.Sleep(time.Second)
+	var dest bytes.Buffer
+	s.Error(acomm.Stream(&dest, addr), "expired stream should not be available")
+	s.Equal(0, dest.Len(), "should not have streamed any data")
 }
 
 func (s *TrackerTestSuite) TestStreamHTTP() {
@@ -56,7 +120,7 @@ func (s *TrackerTestSuite) TestStreamHTTP() {
 	}
 	data := []byte("foobar")
 	src := ioutil.NopCloser(bytes.NewReader(data))
-	addr, err := s.Tracker.NewStreamUnix("", src)
+	addr, err := s.Tracker.NewStream(src)
 	if !s.NoError(err) {
 		return
 	}
@@ -70,8 +134,207 @@ func (s *TrackerTestSuite) TestStreamHTTP() {
 	httpAddr, err = s.Tracker.ProxyStreamHTTPURL(addr)
 	s.NotNil(httpAddr, "should be able to create HTTP url with stream addr")
 	s.NoError(err, "should be able to create HTTP url with stream addr")
+	s.Empty(httpAddr.Query().Get("addr"), "should not expose the unix addr")
 
 	s.NoError(acomm.Stream(&dest, httpAddr), "http stream should not fail")
 	s.Equal(data, dest.Bytes(), "http stream should have streamed data")
 	dest.Reset()
+
+	s.Error(acomm.Stream(&dest, httpAddr), "http stream should only be available once")
+	s.Equal(0, dest.Len(), "should not have streamed any data")
+
+	// Arbitrary local sockets should not be reachable
+	q := url.Values{"addr": []string{addr.String()}}
+	resp, err := http.Get(s.StreamServer.URL + "?" + q.Encode())
+	if s.NoError(err) {
+		s.Equal(http.StatusNotFound, resp.StatusCode, "should only serve registered streams")
+		_ = resp.Body.Close()
+	}
+}
+
+func (s *TrackerTestSuite) TestStreamUnixTruncated() {
+	if !s.NoError(s.Tracker.Start(), "failed to start Tracker") {
+		return
+	}
+	src := ioutil.NopCloser(&failingReader{bytes.NewReader([]byte("foobar"))})
+	addr, err := s.Tracker.NewStream(src)
+	if !s.NoError(err) {
+		return
+	}
+
+	var dest bytes.Buffer
+	s.Error(acomm.Stream(&dest, addr), "incomplete stream should fail")
+}
+
+func (s *TrackerTestSuite) TestStreamHTTPEncodings() {
+	data := bytes.Repeat([]byte("foobar"), 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only streams that can't seek are compressed
+		s.NoError(acomm.ServeStream(w, r, ioutil.NopCloser(bytes.NewReader(data))))
+	}))
+	defer server.Close()
+	addr, _ := url.ParseRequestURI(server.URL)
+
+	tests := []struct {
+		accept   string
+		encoding string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"zstd", "zstd"},
+		{"br, gzip;q=0.8, zstd", "gzip"},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		req.Header.Set("Accept-Encoding", test.accept)
+		resp, err := http.DefaultClient.Do(req)
+		if !s.NoError(err, test.accept) {
+			continue
+		}
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		_ = resp.Body.Close()
+		s.Equal(test.encoding, resp.Header.Get("Content-Encoding"), test.accept)
+		s.Equal("6000", resp.Trailer.Get("X-Stream-Bytes"), test.accept)
+		s.NotEmpty(resp.Trailer.Get("X-Stream-Sha256"), test.accept)
+	}
+
+	for _, encodings := range [][]string{nil, {"gzip"}, {"zstd"}} {
+		orig := acomm.StreamEncodings
+		acomm.StreamEncodings = encodings
+		var dest bytes.Buffer
+		s.NoError(acomm.Stream(&dest, addr), "should stream with encodings %v", encodings)
+		s.Equal(data, dest.Bytes(), "should stream with encodings %v", encodings)
+		acomm.StreamEncodings = orig
+	}
+}
+
+func (s *TrackerTestSuite) TestStreamHTTPVerify() {
+	data := []byte("foobar")
+	var digest string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			s.Error(acomm.ServeStream(w, r, &failingReader{bytes.NewReader(data)}))
+			return
+		}
+		w.Header().Set("Trailer", "X-Stream-Bytes, X-Stream-Sha256")
+		_, _ = w.Write(data)
+		w.Header().Set("X-Stream-Bytes", "6")
+		w.Header().Set("X-Stream-Sha256", digest)
+	}))
+	defer server.Close()
+	addr, _ := url.ParseRequestURI(server.URL)
+
+	var dest bytes.Buffer
+	digest = "c3ab8ff13720e8ad9047dd39466b3c8974e592c2fa383d4a3960714caef0c4f2"
+	s.NoError(acomm.Stream(&dest, addr), "should verify matching digest")
+
+	dest.Reset()
+	digest = "0000000000000000000000000000000000000000000000000000000000000000"
+	s.Error(acomm.Stream(&dest, addr), "should fail on digest mismatch")
+
+	dest.Reset()
+	failAddr, _ := url.ParseRequestURI(server.URL + "?fail=true")
+	s.Error(acomm.Stream(&dest, failAddr), "should fail on incomplete stream")
+}
+
+func (s *TrackerTestSuite) TestStreamHTTPRange() {
+	if !s.NoError(s.Tracker.Start(), "failed to start Tracker") {
+		return
+	}
+
+	f, err := ioutil.TempFile("", "acommStreamRange-")
+	s.Require().NoError(err)
+	defer func() { _ = os.Remove(f.Name()) }()
+	_, err = f.WriteString("foobar")
+	s.Require().NoError(err)
+
+	addr, err := s.Tracker.NewStream(f)
+	s.Require().NoError(err)
+	httpAddr, err := s.Tracker.ProxyStreamHTTPURL(addr)
+	s.Require().NoError(err)
+
+	tests := []struct {
+		rangeHeader  string
+		status       int
+		contentRange string
+		body         string
+	}{
+		{"", http.StatusOK, "", "foobar"},
+		{"bytes=0-", http.StatusPartialContent, "bytes 0-5/6", "foobar"},
+		{"bytes=3-", http.StatusPartialContent, "bytes 3-5/6", "bar"},
+		{"bytes=1-2", http.StatusPartialContent, "bytes 1-2/6", "oo"},
+		{"bytes=10-", http.StatusRequestedRangeNotSatisfiable, "bytes */6", ""},
+		{"bytes=-2", http.StatusOK, "", "foobar"},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", httpAddr.String(), nil)
+		if test.rangeHeader != "" {
+			req.Header.Set("Range", test.rangeHeader)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if !s.NoError(err, test.rangeHeader) {
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+
+		s.Equal(test.status, resp.StatusCode, test.rangeHeader)
+		s.Equal("bytes", resp.Header.Get("Accept-Ranges"), test.rangeHeader)
+		s.Equal(test.contentRange, resp.Header.Get("Content-Range"), test.rangeHeader)
+		if test.status != http.StatusRequestedRangeNotSatisfiable {
+			s.Equal(test.body, string(body), test.rangeHeader)
+			s.EqualValues(len(test.body), resp.ContentLength, test.rangeHeader)
+		}
+	}
+
+	var dest bytes.Buffer
+	s.NoError(acomm.Stream(&dest, httpAddr), "seekable stream should be available again")
+	s.Equal("foobar", dest.String())
+
+	// Streams that can't seek don't support ranges
+	addr, err = s.Tracker.NewStream(ioutil.NopCloser(bytes.NewReader([]byte("foobar"))))
+	s.Require().NoError(err)
+	httpAddr, err = s.Tracker.ProxyStreamHTTPURL(addr)
+	s.Require().NoError(err)
+	req, _ := http.NewRequest("GET", httpAddr.String(), nil)
+	req.Header.Set("Range", "bytes=3-")
+	resp, err := http.DefaultClient.Do(req)
+	if s.NoError(err) {
+		_ = resp.Body.Close()
+		s.Equal(http.StatusRequestedRangeNotSatisfiable, resp.StatusCode)
+	}
+}
+
+func (s *TrackerTestSuite) TestStreamHTTPResume() {
+	data := bytes.Repeat([]byte("foobar"), 1000)
+	f, err := ioutil.TempFile("", "acommStreamResume-")
+	s.Require().NoError(err)
+	defer func() { _ = os.Remove(f.Name()) }()
+	defer func() { _ = f.Close() }()
+	_, err = f.Write(data)
+	s.Require().NoError(err)
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Get("Range"))
+		if len(requests) == 1 {
+			// Drop the connection partway through
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			_, _ = w.Write(data[:1000])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		s.NoError(acomm.ServeStream(w, r, f))
+	}))
+	defer server.Close()
+	addr, _ := url.ParseRequestURI(server.URL)
+
+	var dest bytes.Buffer
+	s.NoError(acomm.Stream(&dest, addr), "should resume interrupted stream")
+	s.Equal(data, dest.Bytes(), "should have streamed all data")
+	s.Equal([]string{"", "bytes=1000-"}, requests, "should have resumed from the last offset")
 }
@@ -0,0 +1,340 @@
+package acomm
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/logrusx"
+)
+
+// streamInfo describes the data of a stream.
+type streamInfo struct {
+	Seekable bool  `json:"seekable,omitempty"`
+	Size     int64 `json:"size,omitempty"`
+}
+
+// streamSource provides the data of a stream. Seekable sources can be opened
+// any number of times from any offset. Other sources can be opened once from
+// the beginning; opening them from a non-zero offset returns a nil
+// ReadCloser along with the info so the caller can tell that ranges are not
+// supported. Closing the returned ReadCloser does not close the source.
+type streamSource interface {
+	open(offset int64) (io.ReadCloser, *streamInfo, error)
+	Close() error
+}
+
+// newStreamSource wraps data as a streamSource. Data that supports random
+// access and has a known size, such as a regular file, is seekable.
+func newStreamSource(src io.Reader) streamSource {
+	if ra, ok := src.(io.ReaderAt); ok {
+		if seeker, ok := src.(io.Seeker); ok {
+			if size, err := seeker.Seek(0, os.SEEK_END); err == nil {
+				return &seekableSource{src: src, ra: ra, size: size}
+			}
+		}
+	}
+	return &onceSource{src: src}
+}
+
+// closeSource closes src if it is an io.Closer.
+func closeSource(src io.Reader) error {
+	if closer, ok := src.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// seekableSource is a stream source supporting random access.
+type seekableSource struct {
+	src  io.Reader
+	ra   io.ReaderAt
+	size int64
+}
+
+func (s *seekableSource) open(offset int64) (io.ReadCloser, *streamInfo, error) {
+	info := &streamInfo{Seekable: true, Size: s.size}
+	if offset > s.size {
+		offset = s.size
+	}
+	return ioutil.NopCloser(io.NewSectionReader(s.ra, offset, s.size-offset)), info, nil
+}
+
+func (s *seekableSource) Close() error {
+	return closeSource(s.src)
+}
+
+// onceSource is a stream source that can only be read once, in order.
+type onceSource struct {
+	src    io.Reader
+	lock   sync.Mutex
+	opened bool
+}
+
+func (s *onceSource) open(offset int64) (io.ReadCloser, *streamInfo, error) {
+	info := &streamInfo{}
+	if offset != 0 {
+		return nil, info, nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.opened {
+		return nil, nil, errors.New("stream already retrieved")
+	}
+	s.opened = true
+	return ioutil.NopCloser(s.src), info, nil
+}
+
+func (s *onceSource) Close() error {
+	return closeSource(s.src)
+}
+
+// streamProxy is a stream source that retrieves data from a stream URL when
+// opened.
+type streamProxy struct {
+	addr *url.URL
+}
+
+func (p *streamProxy) open(offset int64) (io.ReadCloser, *streamInfo, error) {
+	switch p.addr.Scheme {
+	case "unix":
+		return openUnixStream(p.addr, offset)
+	case "http", "https":
+		return openHTTPStream(p.addr, offset)
+	default:
+		return nil, nil, errors.Newv("unknown url scheme", map[string]interface{}{"addr": p.addr})
+	}
+}
+
+func (p *streamProxy) Close() error {
+	return nil
+}
+
+// openUnixStream requests stream data from a unix socket, starting at the
+// offset. The data is verified against the digest that follows it.
+func openUnixStream(addr *url.URL, offset int64) (io.ReadCloser, *streamInfo, error) {
+	errData := map[string]interface{}{"addr": addr, "offset": offset}
+
+	conn, err := net.Dial("unix", addr.Path)
+	if err != nil {
+		return nil, nil, errors.Wrapv(err, errData)
+	}
+	closeConn := func() {
+		logrusx.LogReturnedErr(conn.Close, errData, "failed to close stream connection")
+	}
+
+	if err := SendConnData(conn, &streamRequest{ID: addr.Query().Get("id"), Offset: offset}); err != nil {
+		closeConn()
+		return nil, nil, errors.Wrapv(err, errData)
+	}
+
+	resp := &Response{}
+	if err := UnmarshalConnData(conn, resp); err != nil {
+		closeConn()
+		return nil, nil, errors.Wrapv(err, errData)
+	}
+	if resp.Error != nil {
+		closeConn()
+		return nil, nil, errors.Wrapv(errors.ResetStack(resp.Error), errData)
+	}
+
+	info := &streamInfo{}
+	if resp.Result != nil {
+		if err := resp.UnmarshalResult(info); err != nil {
+			closeConn()
+			return nil, nil, errors.Wrapv(err, errData)
+		}
+	}
+	if offset != 0 && !info.Seekable {
+		closeConn()
+		return nil, info, nil
+	}
+
+	return &verifyingReader{
+		r:      &chunkReader{r: conn},
+		closer: conn,
+		d:      newDigester(),
+		expected: func() (*StreamDigest, error) {
+			expected := &StreamDigest{}
+			if err := UnmarshalConnData(conn, expected); err != nil {
+				return nil, errors.Wrapv(err, errData, "failed to read stream digest")
+			}
+			return expected, nil
+		},
+	}, info, nil
+}
+
+// openHTTPStream requests stream data over http, starting at the offset.
+// Compressed data is decompressed, and data from sources that declare a
+// digest trailer is verified.
+func openHTTPStream(addr *url.URL, offset int64) (io.ReadCloser, *streamInfo, error) {
+	errData := map[string]interface{}{"addr": addr, "offset": offset}
+
+	httpReq, err := http.NewRequest("GET", addr.String(), nil)
+	if err != nil {
+		return nil, nil, errors.Wrapv(err, errData)
+	}
+	httpReq.Header.Set("Accept-Encoding", strings.Join(StreamEncodings, ", "))
+	if offset != 0 {
+		httpReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	httpResp, err := httpClient().Do(httpReq)
+	if err != nil {
+		return nil, nil, errors.Wrapv(err, errData)
+	}
+	closeBody := func() {
+		logrusx.LogReturnedErr(httpResp.Body.Close, errData, "failed to close stream response body")
+	}
+
+	info := &streamInfo{
+		Seekable: httpResp.Header.Get("Accept-Ranges") == "bytes" && httpResp.ContentLength >= 0,
+		Size:     httpResp.ContentLength,
+	}
+	switch httpResp.StatusCode {
+	case http.StatusOK:
+		if offset != 0 {
+			// The range was ignored
+			closeBody()
+			return nil, &streamInfo{}, nil
+		}
+	case http.StatusPartialContent:
+		start, size, err := parseContentRange(httpResp.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			closeBody()
+			errData["contentRange"] = httpResp.Header.Get("Content-Range")
+			return nil, nil, errors.Newv("unexpected content range", errData)
+		}
+		info.Size = size
+	case http.StatusRequestedRangeNotSatisfiable:
+		closeBody()
+		return nil, &streamInfo{}, nil
+	default:
+		closeBody()
+		errData["status"] = httpResp.Status
+		return nil, nil, errors.Newv("failed to stream data", errData)
+	}
+
+	encoding := httpResp.Header.Get("Content-Encoding")
+	body, err := newDecoder(encoding, httpResp.Body)
+	if err != nil {
+		closeBody()
+		return nil, nil, errors.Wrapv(err, errData)
+	}
+
+	return &verifyingReader{
+		r:      body,
+		closer: multiCloser{body, httpResp.Body},
+		d:      newDigester(),
+		expected: func() (*StreamDigest, error) {
+			if _, ok := httpResp.Trailer[streamSHA256Header]; !ok {
+				return nil, nil
+			}
+			// The trailer is only populated once the body has been read to EOF
+			if _, err := io.Copy(ioutil.Discard, httpResp.Body); err != nil {
+				return nil, errors.Wrapv(err, errData)
+			}
+			expected, err := digestFromTrailer(httpResp.Trailer)
+			return expected, errors.Wrapv(err, errData)
+		},
+	}, info, nil
+}
+
+// parseContentRange parses the start and complete length from a
+// Content-Range header of the form "bytes start-end/size".
+func parseContentRange(contentRange string) (int64, int64, error) {
+	var start, end, size int64
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &start, &end, &size); err != nil {
+		return 0, 0, errors.Wrapv(err, map[string]interface{}{"contentRange": contentRange})
+	}
+	return start, size, nil
+}
+
+// parseRange parses a Range header for a single range of the form
+// "bytes=start-" or "bytes=start-end". An end of -1 means the end of the data.
+// Other forms, which may be ignored by the server, are not supported.
+func parseRange(rangeHeader string) (int64, int64, bool) {
+	if !strings.HasPrefix(rangeHeader, "bytes=") {
+		return 0, 0, false
+	}
+	parts := strings.Split(strings.TrimPrefix(rangeHeader, "bytes="), "-")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	start, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	end := int64(-1)
+	if endStr := strings.TrimSpace(parts[1]); endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+	}
+	return start, end, true
+}
+
+// verifyingReader checks the data read through it against the digest
+// provided by its source once the data ends. A nil expected digest means the
+// source did not provide one.
+type verifyingReader struct {
+	r        io.Reader
+	closer   io.Closer
+	d        *digester
+	expected func() (*StreamDigest, error)
+	endErr   error
+}
+
+// Read reads data, returning an error instead of io.EOF if the data does not
+// match the digest.
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	if v.endErr != nil {
+		return 0, v.endErr
+	}
+
+	n, err := v.r.Read(p)
+	_, _ = v.d.Write(p[:n])
+	if err != io.EOF {
+		return n, err
+	}
+
+	v.endErr = io.EOF
+	expected, err := v.expected()
+	if err == nil && expected != nil {
+		err = v.d.Digest().Verify(expected)
+	}
+	if err != nil {
+		v.endErr = err
+	}
+	return n, v.endErr
+}
+
+// Close closes the underlying data.
+func (v *verifyingReader) Close() error {
+	return v.closer.Close()
+}
+
+// multiCloser closes each of a set of closers, returning the first error.
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	var firstErr error
+	for _, c := range m {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
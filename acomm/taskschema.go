@@ -0,0 +1,41 @@
+package acomm
+
+import (
+	"strings"
+
+	"github.com/cerana/cerana/pkg/jsonschema"
+)
+
+// ListTasksTask is the reserved task name for listing the tasks available
+// through a coordinator, along with their schemas.
+const ListTasksTask = "list-tasks"
+
+// DescribeTaskTask is the reserved task name for retrieving the schema of a
+// single task.
+const DescribeTaskTask = "describe-task"
+
+// TaskSchema describes a task: the providers handling it and the JSON Schemas
+// of its args and result. A nil schema means nothing is known about it.
+type TaskSchema struct {
+	Task        string             `json:"task"`
+	Providers   []string           `json:"providers,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Args        *jsonschema.Schema `json:"args,omitempty"`
+	Result      *jsonschema.Schema `json:"result,omitempty"`
+}
+
+// DescribeTaskArgs are the arguments for a DescribeTaskTask request.
+type DescribeTaskArgs struct {
+	Task string `json:"task"`
+}
+
+// ListTasksResult is the result of a ListTasksTask request.
+type ListTasksResult struct {
+	Tasks []*TaskSchema `json:"tasks"`
+}
+
+// TaskSchemaPath returns the path of the schema file published alongside a
+// task socket.
+func TaskSchemaPath(socketPath string) string {
+	return strings.TrimSuffix(socketPath, ".sock") + ".json"
+}
@@ -0,0 +1,75 @@
+package acomm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+// LoadTLSConfig creates a TLS config from PEM encoded files. The certificate
+// and key are used to identify this side of the connection, whether client or
+// server. The CA is used both to verify servers being dialed and, when set as
+// required, to verify client certificates presented to a server.
+func LoadTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Wrapv(err, map[string]interface{}{"certFile": certFile, "keyFile": keyFile}, "failed to load key pair")
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile != "" {
+		caPEM, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, errors.Wrapv(err, map[string]interface{}{"caFile": caFile}, "failed to read ca file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.Newv("no valid certificates in ca file", map[string]interface{}{"caFile": caFile})
+		}
+		config.RootCAs = pool
+		config.ClientCAs = pool
+	}
+
+	return config, nil
+}
+
+// httpClientLock protects httpClientValue.
+var httpClientLock sync.RWMutex
+
+// httpClientValue is the client used to send payloads and stream data over
+// http(s). It is kept separate from http.DefaultClient once a TLS config is
+// set, so other http clients in the process aren't affected.
+var httpClientValue = http.DefaultClient
+
+// SetTLSConfig sets the TLS config used when sending payloads and streaming
+// data over https, allowing a client certificate to be presented. It only
+// applies to acomm; http.DefaultTransport is left unchanged. A nil config
+// restores the default client.
+func SetTLSConfig(config *tls.Config) {
+	client := http.DefaultClient
+	if config != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = config
+		client = &http.Client{Transport: transport}
+	}
+
+	httpClientLock.Lock()
+	defer httpClientLock.Unlock()
+	httpClientValue = client
+}
+
+// httpClient returns the client used to send payloads and stream data over
+// http(s).
+func httpClient() *http.Client {
+	httpClientLock.RLock()
+	defer httpClientLock.RUnlock()
+	return httpClientValue
+}
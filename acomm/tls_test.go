@@ -0,0 +1,151 @@
+package acomm_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/stretchr/testify/suite"
+)
+
+type TLSTestSuite struct {
+	suite.Suite
+	dir      string
+	certFile string
+	keyFile  string
+}
+
+func TestTLSTestSuite(t *testing.T) {
+	suite.Run(t, new(TLSTestSuite))
+}
+
+func (s *TLSTestSuite) SetupSuite() {
+	var err error
+	s.dir, err = ioutil.TempDir("", "acommTLSTest-")
+	s.Require().NoError(err)
+
+	s.certFile = filepath.Join(s.dir, "cert.pem")
+	s.keyFile = filepath.Join(s.dir, "key.pem")
+	s.Require().NoError(writeSelfSignedCert(s.certFile, s.keyFile))
+}
+
+func (s *TLSTestSuite) TearDownSuite() {
+	_ = os.RemoveAll(s.dir)
+}
+
+func (s *TLSTestSuite) TestLoadTLSConfig() {
+	tests := []struct {
+		description string
+		caFile      string
+		certFile    string
+		keyFile     string
+		expectedErr bool
+	}{
+		{"empty", "", "", "", false},
+		{"cert and key", "", s.certFile, s.keyFile, false},
+		{"ca only", s.certFile, "", "", false},
+		{"all", s.certFile, s.certFile, s.keyFile, false},
+		{"missing key", "", s.certFile, "", true},
+		{"missing cert", "", "", s.keyFile, true},
+		{"invalid ca", s.keyFile, "", "", true},
+		{"nonexistent ca", filepath.Join(s.dir, "foobar"), "", "", true},
+	}
+
+	for _, test := range tests {
+		config, err := acomm.LoadTLSConfig(test.caFile, test.certFile, test.keyFile)
+		if test.expectedErr {
+			s.Error(err, test.description)
+			s.Nil(config, test.description)
+			continue
+		}
+		if !s.NoError(err, test.description) {
+			continue
+		}
+		s.Equal(test.certFile != "", len(config.Certificates) == 1, test.description)
+		s.Equal(test.caFile != "", config.RootCAs != nil, test.description)
+		s.Equal(test.caFile != "", config.ClientCAs != nil, test.description)
+	}
+}
+
+func (s *TLSTestSuite) TestSendClientCert() {
+	serverConfig, err := acomm.LoadTLSConfig(s.certFile, s.certFile, s.keyFile)
+	s.Require().NoError(err)
+	serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ack, _ := json.Marshal(&acomm.Response{})
+		_, _ = w.Write(ack)
+	}))
+	server.TLS = serverConfig
+	server.StartTLS()
+	defer server.Close()
+
+	addr, _ := url.ParseRequestURI(server.URL)
+	payload := map[string]string{"foo": "bar"}
+
+	defer acomm.SetTLSConfig(nil)
+
+	acomm.SetTLSConfig(nil)
+	s.Error(acomm.Send(addr, payload), "should fail without client cert")
+
+	clientConfig, err := acomm.LoadTLSConfig(s.certFile, s.certFile, s.keyFile)
+	s.Require().NoError(err)
+	acomm.SetTLSConfig(clientConfig)
+	s.NoError(acomm.Send(addr, payload), "should succeed with client cert")
+	defaultConfig := http.DefaultTransport.(*http.Transport).TLSClientConfig
+	s.True(defaultConfig == nil || len(defaultConfig.Certificates) == 0, "should not change the default transport")
+}
+
+// writeSelfSignedCert creates a self-signed certificate valid for localhost
+// that can act as its own CA, client, and server certificate.
+func writeSelfSignedCert(certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "acomm-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return ioutil.WriteFile(keyFile, keyPEM, 0600)
+}
@@ -0,0 +1,130 @@
+package acomm
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// SpanKind describes the relationship of a span to the spans around it,
+// numbered as in OpenTelemetry.
+type SpanKind int
+
+// Span kinds.
+const (
+	SpanKindInternal SpanKind = iota + 1
+	SpanKindServer
+	SpanKindClient
+)
+
+// Span is a timed operation within a trace, such as the routing of a request
+// by a coordinator or its handling by a provider. Spans of a trace share the
+// trace ID and are linked to the span that caused them by the parent span ID.
+type Span struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Kind         SpanKind
+	StartTime    time.Time
+	EndTime      time.Time
+	Error        string
+	lock         sync.Mutex // Protects Attributes
+	Attributes   map[string]interface{}
+}
+
+type spanContextKey struct{}
+
+// newTraceID returns a random 16 byte trace id, hex encoded.
+func newTraceID() string {
+	return randomHex(16)
+}
+
+// newSpanID returns a random 8 byte span id, hex encoded.
+func newSpanID() string {
+	return randomHex(8)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	// crypto/rand only fails if the system's source of randomness does
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NewSpan starts a new span. A new trace is started if the trace id is empty.
+func NewSpan(name string, kind SpanKind, traceID, parentSpanID string) *Span {
+	if traceID == "" {
+		traceID = newTraceID()
+		parentSpanID = ""
+	}
+	return &Span{
+		TraceID:      traceID,
+		SpanID:       newSpanID(),
+		ParentSpanID: parentSpanID,
+		Name:         name,
+		Kind:         kind,
+		StartTime:    time.Now(),
+		Attributes:   make(map[string]interface{}),
+	}
+}
+
+// NewRequestSpan starts a new span for handling the request, as a child of
+// the span that sent it. The request ID and task are recorded as attributes.
+func NewRequestSpan(req *Request, name string, kind SpanKind) *Span {
+	span := NewSpan(name, kind, req.TraceID, req.ParentSpanID)
+	span.SetAttribute("cerana.request_id", req.ID)
+	span.SetAttribute("cerana.task", req.Task)
+	return span
+}
+
+// SetAttribute sets an attribute of the span.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.Attributes[key] = value
+}
+
+// Inject sets the trace of the request so the span is its parent.
+func (s *Span) Inject(req *Request) {
+	req.TraceID = s.TraceID
+	req.ParentSpanID = s.SpanID
+}
+
+// Finish ends the span, recording the error if there is one, and queues it
+// for export.
+func (s *Span) Finish(err error) {
+	s.EndTime = time.Now()
+	if err != nil {
+		s.Error = err.Error()
+	}
+	exportSpan(s)
+}
+
+// ContextWithSpan returns a copy of the context carrying the span. Requests
+// sent with SyncRequest or a MultiRequest using the context become children
+// of the span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext returns the span carried by the context, if any.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// injectContextSpan makes the span carried by the context, if any, the parent
+// of a request that is not already part of a trace.
+func injectContextSpan(ctx context.Context, req *Request) {
+	if req.TraceID != "" {
+		return
+	}
+	if span := SpanFromContext(ctx); span != nil {
+		span.Inject(req)
+	}
+}
@@ -0,0 +1,189 @@
+package acomm_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type TraceTestSuite struct {
+	suite.Suite
+	tracker *acomm.Tracker
+}
+
+func TestTraceTestSuite(t *testing.T) {
+	suite.Run(t, new(TraceTestSuite))
+}
+
+func (s *TraceTestSuite) SetupTest() {
+	logrus.SetLevel(logrus.FatalLevel)
+
+	var err error
+	s.tracker, err = acomm.NewTracker("", nil, nil, 0)
+	s.Require().NoError(err)
+	s.Require().NoError(s.tracker.Start())
+}
+
+func (s *TraceTestSuite) TearDownTest() {
+	s.tracker.Stop()
+	acomm.SetSpanExporter(nil)
+}
+
+// otlpSpans returns the spans of an OTLP JSON export and the service name.
+func otlpSpans(data []byte) ([]map[string]interface{}, string, error) {
+	var traces struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string
+					Value map[string]interface{}
+				}
+			}
+			ScopeSpans []struct {
+				Spans []map[string]interface{}
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &traces); err != nil {
+		return nil, "", err
+	}
+
+	var spans []map[string]interface{}
+	var serviceName string
+	for _, rs := range traces.ResourceSpans {
+		for _, attr := range rs.Resource.Attributes {
+			if attr.Key == "service.name" {
+				serviceName, _ = attr.Value["stringValue"].(string)
+			}
+		}
+		for _, ss := range rs.ScopeSpans {
+			spans = append(spans, ss.Spans...)
+		}
+	}
+	return spans, serviceName, nil
+}
+
+func (s *TraceTestSuite) TestNewSpan() {
+	root := acomm.NewSpan("root", acomm.SpanKindInternal, "", "foobar")
+	s.Len(root.TraceID, 32, "should start a trace")
+	s.Len(root.SpanID, 16)
+	s.Empty(root.ParentSpanID, "root span should not have a parent")
+
+	req, err := acomm.NewRequest(acomm.RequestOptions{
+		Task:               "foobar",
+		ResponseHookString: "unix:///tmp/foobar",
+	})
+	s.Require().NoError(err)
+	root.Inject(req)
+
+	child := acomm.NewRequestSpan(req, "child", acomm.SpanKindServer)
+	s.Equal(root.TraceID, child.TraceID, "should continue the trace")
+	s.Equal(root.SpanID, child.ParentSpanID, "should be a child of the sending span")
+	s.NotEqual(root.SpanID, child.SpanID)
+	s.Equal(req.ID, child.Attributes["cerana.request_id"])
+}
+
+func (s *TraceTestSuite) TestContextPropagation() {
+	span := acomm.NewSpan("root", acomm.SpanKindInternal, "", "")
+	ctx := acomm.ContextWithSpan(context.Background(), span)
+	s.Equal(span, acomm.SpanFromContext(ctx))
+	s.Nil(acomm.SpanFromContext(context.Background()))
+
+	multiRequest := acomm.NewMultiRequest(ctx, s.tracker, 0)
+	req, err := acomm.NewRequest(acomm.RequestOptions{Task: "foobar"})
+	s.Require().NoError(err)
+	s.Require().NoError(multiRequest.AddRequest("foobar", req))
+	defer s.tracker.RemoveRequest(req)
+	s.Equal(span.TraceID, req.TraceID, "sub-request should be part of the trace")
+	s.Equal(span.SpanID, req.ParentSpanID, "sub-request should be a child of the span")
+
+	// Proxying keeps the trace
+	req, err = acomm.NewRequest(acomm.RequestOptions{
+		Task:               "foobar",
+		ResponseHookString: "http://localhost/foobar",
+	})
+	s.Require().NoError(err)
+	span.Inject(req)
+	proxyReq, err := s.tracker.ProxyUnix(req, 0)
+	s.Require().NoError(err)
+	defer s.tracker.RemoveRequest(req)
+	s.Equal(req.TraceID, proxyReq.TraceID)
+	s.Equal(req.ParentSpanID, proxyReq.ParentSpanID)
+}
+
+func (s *TraceTestSuite) TestFileExport() {
+	f, err := ioutil.TempFile("", "acommTrace-")
+	s.Require().NoError(err)
+	_ = f.Close()
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	exporter, err := acomm.NewSpanExporter("foobar", f.Name())
+	s.Require().NoError(err)
+	acomm.SetSpanExporter(exporter)
+
+	root := acomm.NewSpan("root", acomm.SpanKindServer, "", "")
+	root.SetAttribute("count", 2)
+	child := acomm.NewSpan("child", acomm.SpanKindInternal, root.TraceID, root.SpanID)
+	child.Finish(errors.New("child failed"))
+	root.Finish(nil)
+	acomm.FlushSpans()
+
+	data, err := ioutil.ReadFile(f.Name())
+	s.Require().NoError(err)
+	spans, serviceName, err := otlpSpans(data)
+	s.Require().NoError(err)
+	s.Equal("foobar", serviceName)
+	if !s.Len(spans, 2) {
+		return
+	}
+
+	s.Equal(child.SpanID, spans[0]["spanId"])
+	s.Equal(root.SpanID, spans[0]["parentSpanId"])
+	s.Equal(root.TraceID, spans[0]["traceId"])
+	s.EqualValues(2, spans[0]["status"].(map[string]interface{})["code"], "should have error status")
+	s.Equal("child failed", spans[0]["status"].(map[string]interface{})["message"])
+
+	s.Equal(root.SpanID, spans[1]["spanId"])
+	s.Nil(spans[1]["parentSpanId"])
+	s.EqualValues(acomm.SpanKindServer, spans[1]["kind"])
+	s.NotEmpty(spans[1]["startTimeUnixNano"])
+	s.NotEmpty(spans[1]["attributes"])
+}
+
+func (s *TraceTestSuite) TestHTTPExport() {
+	bodies := make(chan []byte, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		s.Equal("application/json", r.Header.Get("Content-Type"))
+		bodies <- body
+	}))
+	defer collector.Close()
+
+	exporter, err := acomm.NewSpanExporter("foobar", collector.URL+"/v1/traces")
+	s.Require().NoError(err)
+	acomm.SetSpanExporter(exporter)
+
+	span := acomm.NewSpan("root", acomm.SpanKindServer, "", "")
+	span.Finish(nil)
+	acomm.FlushSpans()
+
+	select {
+	case body := <-bodies:
+		spans, _, err := otlpSpans(body)
+		s.NoError(err)
+		if s.Len(spans, 1) {
+			s.Equal(span.SpanID, spans[0]["spanId"])
+		}
+	default:
+		s.Fail("should have posted spans to the collector")
+	}
+}
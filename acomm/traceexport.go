@@ -0,0 +1,323 @@
+package acomm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/logrusx"
+)
+
+// Span export batching.
+const (
+	spanQueueSize     = 1024
+	spanBatchSize     = 100
+	spanFlushInterval = time.Second
+)
+
+// SpanExporter exports finished spans.
+type SpanExporter interface {
+	ExportSpans(spans []*Span) error
+}
+
+// NewSpanExporter creates a SpanExporter for the destination, exporting spans
+// in the OpenTelemetry (OTLP) JSON format for the named service. An http(s)
+// destination is an OTLP/HTTP collector endpoint, such as
+// http://localhost:4318/v1/traces. Any other destination is a file path, to
+// which each batch is appended as a line.
+func NewSpanExporter(serviceName, dest string) (SpanExporter, error) {
+	if u, err := url.ParseRequestURI(dest); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		return &httpSpanExporter{serviceName: serviceName, url: u}, nil
+	}
+	if dest == "" {
+		return nil, errors.New("missing span export destination")
+	}
+	return &fileSpanExporter{serviceName: serviceName, path: dest}, nil
+}
+
+// fileSpanExporter appends batches of spans to a file.
+type fileSpanExporter struct {
+	serviceName string
+	path        string
+	lock        sync.Mutex // Serializes writes
+}
+
+func (e *fileSpanExporter) ExportSpans(spans []*Span) error {
+	data, err := json.Marshal(newOTLPTraces(e.serviceName, spans))
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	f, err := os.OpenFile(e.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrapv(err, map[string]interface{}{"path": e.path})
+	}
+	defer logrusx.LogReturnedErr(f.Close, map[string]interface{}{"path": e.path}, "failed to close span export file")
+
+	_, err = f.Write(append(data, '\n'))
+	return errors.Wrapv(err, map[string]interface{}{"path": e.path})
+}
+
+// httpSpanExporter posts batches of spans to an OTLP/HTTP collector.
+type httpSpanExporter struct {
+	serviceName string
+	url         *url.URL
+}
+
+func (e *httpSpanExporter) ExportSpans(spans []*Span) error {
+	errData := map[string]interface{}{"url": e.url.String()}
+
+	data, err := json.Marshal(newOTLPTraces(e.serviceName, spans))
+	if err != nil {
+		return errors.Wrapv(err, errData)
+	}
+
+	httpResp, err := http.Post(e.url.String(), "application/json", bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrapv(err, errData)
+	}
+	defer logrusx.LogReturnedErr(httpResp.Body.Close, errData, "failed to close span export response body")
+	_, _ = ioutil.ReadAll(httpResp.Body)
+
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		errData["status"] = httpResp.Status
+		return errors.Newv("span export rejected", errData)
+	}
+	return nil
+}
+
+// OTLP JSON structures. Only the fields used are included.
+type (
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              SpanKind        `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+
+	otlpAttribute struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	}
+)
+
+// OTLP status codes.
+const (
+	otlpStatusOK    = 1
+	otlpStatusError = 2
+)
+
+func newOTLPTraces(serviceName string, spans []*Span) *otlpTraces {
+	otlpSpans := make([]otlpSpan, len(spans))
+	for i, span := range spans {
+		otlpSpans[i] = span.otlp()
+	}
+
+	return &otlpTraces{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpAttribute{newOTLPAttribute("service.name", serviceName)},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/cerana/cerana/acomm"},
+				Spans: otlpSpans,
+			}},
+		}},
+	}
+}
+
+func (s *Span) otlp() otlpSpan {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	o := otlpSpan{
+		TraceID:           s.TraceID,
+		SpanID:            s.SpanID,
+		ParentSpanID:      s.ParentSpanID,
+		Name:              s.Name,
+		Kind:              s.Kind,
+		StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+		Status:            otlpStatus{Code: otlpStatusOK},
+	}
+	if s.Error != "" {
+		o.Status = otlpStatus{Code: otlpStatusError, Message: s.Error}
+	}
+	for key, value := range s.Attributes {
+		o.Attributes = append(o.Attributes, newOTLPAttribute(key, value))
+	}
+	return o
+}
+
+func newOTLPAttribute(key string, value interface{}) otlpAttribute {
+	var v map[string]interface{}
+	switch value := value.(type) {
+	case string:
+		v = map[string]interface{}{"stringValue": value}
+	case bool:
+		v = map[string]interface{}{"boolValue": value}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32:
+		v = map[string]interface{}{"intValue": fmt.Sprint(value)}
+	case float32, float64:
+		v = map[string]interface{}{"doubleValue": value}
+	default:
+		v = map[string]interface{}{"stringValue": fmt.Sprint(value)}
+	}
+	return otlpAttribute{Key: key, Value: v}
+}
+
+// spanBatcher queues finished spans and exports them in batches.
+type spanBatcher struct {
+	exporter SpanExporter
+	spans    chan *Span
+	flush    chan chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+var (
+	batcherLock sync.Mutex // Protects batcher
+	batcher     *spanBatcher
+)
+
+// SetSpanExporter sets the exporter for finished spans, replacing and
+// flushing any previous one. Spans are exported in batches in the background.
+// A nil exporter disables exporting.
+func SetSpanExporter(exporter SpanExporter) {
+	batcherLock.Lock()
+	defer batcherLock.Unlock()
+
+	if batcher != nil {
+		close(batcher.stop)
+		<-batcher.done
+		batcher = nil
+	}
+	if exporter == nil {
+		return
+	}
+
+	batcher = &spanBatcher{
+		exporter: exporter,
+		spans:    make(chan *Span, spanQueueSize),
+		flush:    make(chan chan struct{}),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go batcher.run()
+}
+
+// FlushSpans exports any queued spans, blocking until done.
+func FlushSpans() {
+	batcherLock.Lock()
+	defer batcherLock.Unlock()
+
+	if batcher == nil {
+		return
+	}
+	flushed := make(chan struct{})
+	batcher.flush <- flushed
+	<-flushed
+}
+
+// exportSpan queues a finished span for export. Spans are dropped rather
+// than blocking if the queue is full.
+func exportSpan(span *Span) {
+	batcherLock.Lock()
+	defer batcherLock.Unlock()
+
+	if batcher == nil {
+		return
+	}
+	select {
+	case batcher.spans <- span:
+	default:
+		logrus.WithField("spanID", span.SpanID).Debug("span export queue full, dropping span")
+	}
+}
+
+func (b *spanBatcher) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(spanFlushInterval)
+	defer ticker.Stop()
+
+	var spans []*Span
+	export := func() {
+		// Include everything already queued
+		for len(b.spans) > 0 {
+			spans = append(spans, <-b.spans)
+		}
+		if len(spans) == 0 {
+			return
+		}
+		if err := b.exporter.ExportSpans(spans); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+				"spans": len(spans),
+			}).Error("failed to export spans")
+		}
+		spans = nil
+	}
+
+	for {
+		select {
+		case span := <-b.spans:
+			spans = append(spans, span)
+			if len(spans) >= spanBatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case flushed := <-b.flush:
+			export()
+			close(flushed)
+		case <-b.stop:
+			export()
+			return
+		}
+	}
+}
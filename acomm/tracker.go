@@ -3,13 +3,13 @@ package acomm
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -17,6 +17,9 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/cerana/cerana/pkg/errors"
 	"github.com/cerana/cerana/pkg/logrusx"
+	"github.com/cerana/cerana/pkg/prometheusx"
+	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
 )
 
 const (
@@ -36,13 +39,32 @@ type Tracker struct {
 	defaultTimeout   time.Duration
 	requestsLock     sync.Mutex // Protects requests
 	requests         map[string]*Request
-	dsLock           sync.Mutex // Protects dataStreams
-	dataStreams      map[string]*UnixListener
+	streamListener   *UnixListener
+	streamsLock      sync.Mutex // Protects streams
+	streams          map[string]*dataStream
+	routesLock       sync.Mutex // Protects routes
+	routes           map[string]*route
+	retryLock        sync.Mutex // Protects retry
+	retry            *RetryPolicy
+	proxyDoneLock    sync.Mutex // Protects proxyDone
+	proxyDone        ProxyDoneHandler
+	journalPath      string
+	journal          *journal
+	codec            Codec
+	maxMessageSize   uint32
 	waitgroup        sync.WaitGroup
 }
 
+// route is the destination a request was sent to and who sent it, if known.
+type route struct {
+	dest   *url.URL
+	owner  string
+	expire *time.Timer
+}
+
 // NewTracker creates and initializes a new Tracker. If a socketPath is not
-// provided, the response socket will be created in a temporary directory.
+// provided, the response socket will be created in a temporary directory. The
+// stream socket is created alongside the response socket.
 func NewTracker(socketPath string, httpStreamURL, externalProxyURL *url.URL, defaultTimeout time.Duration) (*Tracker, error) {
 	if socketPath == "" {
 		var err error
@@ -56,13 +78,18 @@ func NewTracker(socketPath string, httpStreamURL, externalProxyURL *url.URL, def
 		defaultTimeout = time.Minute
 	}
 
+	streamSocketPath := strings.TrimSuffix(socketPath, ".sock") + "-streams.sock"
+
 	return &Tracker{
 		status:           statusStopped,
 		responseListener: NewUnixListener(socketPath, 0),
+		streamListener:   NewUnixListener(streamSocketPath, 0),
 		httpStreamURL:    httpStreamURL,
 		externalProxyURL: externalProxyURL,
-		dataStreams:      make(map[string]*UnixListener),
+		streams:          make(map[string]*dataStream),
+		routes:           make(map[string]*route),
 		defaultTimeout:   defaultTimeout,
+		codec:            DefaultCodec,
 	}, nil
 }
 
@@ -103,16 +130,129 @@ func (t *Tracker) NumRequests() int {
 	return len(t.requests)
 }
 
+// TrackedRequest describes a tracked request, for introspection. Responses
+// come back from the Route the request was sent to, if known, and go on to the
+// ResponseHook of the original request when it was proxied.
+type TrackedRequest struct {
+	ID           string    `json:"id"`
+	Task         string    `json:"task"`
+	TraceID      string    `json:"traceID,omitempty"`
+	Tracked      time.Time `json:"tracked"`
+	Age          string    `json:"age"`
+	Expires      time.Time `json:"expires"`
+	Proxied      bool      `json:"proxied"`
+	ResponseHook string    `json:"responseHook,omitempty"`
+	Route        string    `json:"route,omitempty"`
+}
+
+// Requests returns descriptions of the tracked requests, oldest first.
+func (t *Tracker) Requests() []*TrackedRequest {
+	t.requestsLock.Lock()
+	reqs := make([]*Request, 0, len(t.requests))
+	for _, req := range t.requests {
+		reqs = append(reqs, req)
+	}
+	t.requestsLock.Unlock()
+
+	now := time.Now()
+	tracked := make([]*TrackedRequest, len(reqs))
+	for i, req := range reqs {
+		tracked[i] = &TrackedRequest{
+			ID:      req.ID,
+			Task:    req.Task,
+			TraceID: req.TraceID,
+			Tracked: req.tracked,
+			Age:     now.Sub(req.tracked).String(),
+			Expires: req.expires,
+			Proxied: req.proxied,
+		}
+		if req.ResponseHook != nil {
+			tracked[i].ResponseHook = req.ResponseHook.String()
+		}
+		if dest := t.Route(req.ID); dest != nil {
+			tracked[i].Route = dest.String()
+		}
+	}
+	sort.Stable(byTracked(tracked))
+	return tracked
+}
+
+// byTracked sorts tracked requests by the time they started being tracked.
+type byTracked []*TrackedRequest
+
+func (b byTracked) Len() int           { return len(b) }
+func (b byTracked) Less(i, j int) bool { return b[i].Tracked.Before(b[j].Tracked) }
+func (b byTracked) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// ExpireRequest forces a tracked request to time out now, handling it with
+// the same timeout error as if its timeout had passed. It returns whether the
+// request was being tracked.
+func (t *Tracker) ExpireRequest(requestID string) bool {
+	req := t.lookupRequest(requestID)
+	if req == nil {
+		return false
+	}
+
+	timeoutErr := errors.NewWithCode(errors.CodeTimeout, "response timeout", map[string]interface{}{
+		"requestID": req.ID,
+		"request":   req,
+		"expired":   true,
+	})
+	resp, err := NewResponse(req, nil, nil, timeoutErr)
+	if err != nil {
+		return false
+	}
+	prometheusx.TrackerTimeouts.WithLabelValues(req.Task).Inc()
+	t.HandleResponse(resp)
+	return true
+}
+
 // Addr returns the string representation of the Tracker's response listener socket.
 func (t *Tracker) Addr() string {
 	return t.responseListener.Addr()
 }
 
+// StreamAddr returns the string representation of the Tracker's stream
+// listener socket.
+func (t *Tracker) StreamAddr() string {
+	return t.streamListener.Addr()
+}
+
 // URL returns the URL of the Tracker's response listener socket.
 func (t *Tracker) URL() *url.URL {
 	return t.responseListener.URL()
 }
 
+// SetCodec sets the codec of messages sent by the Tracker over unix sockets,
+// which its response listener accepts in addition to JSON. It must be called
+// before Start.
+func (t *Tracker) SetCodec(codec Codec) {
+	t.codec = codec
+	t.responseListener.SetCodec(codec)
+}
+
+// SetMaxMessageSize sets the largest message size, in bytes, read by the
+// Tracker's listeners and from its journal. Zero uses MaxMessageSize. It must
+// be called before Start.
+func (t *Tracker) SetMaxMessageSize(size uint32) {
+	t.maxMessageSize = size
+	t.responseListener.SetMaxMessageSize(size)
+	t.streamListener.SetMaxMessageSize(size)
+}
+
+// Send sends the payload to the URL. Over a unix socket, it is sent with the
+// Tracker's codec, or as JSON if the peer does not accept it.
+func (t *Tracker) Send(addr *url.URL, payload interface{}) error {
+	return send(addr, t.codec, payload)
+}
+
+// SendBatch sends a batch of requests to a coordinator in a single message
+// (see the SendBatch function). Over a unix socket, it is sent with the
+// Tracker's codec, or as JSON if the peer does not accept it.
+func (t *Tracker) SendBatch(addr *url.URL, reqs []*Request) ([]error, error) {
+	return sendBatch(addr, t.codec, reqs)
+}
+
 // Start activates the tracker. This allows tracking of requests as well as
 // listening for and handling responses.
 func (t *Tracker) Start() error {
@@ -125,6 +265,15 @@ func (t *Tracker) Start() error {
 
 	t.requests = make(map[string]*Request)
 
+	// recover requests tracked by a previous run before responses can arrive
+	var expired []*Request
+	if t.journalPath != "" {
+		var err error
+		if expired, err = t.replayJournal(); err != nil {
+			return err
+		}
+	}
+
 	// start the proxy response listener
 	if err := t.responseListener.Start(); err != nil {
 		return err
@@ -132,8 +281,20 @@ func (t *Tracker) Start() error {
 
 	go t.listenForResponses()
 
+	// start the data stream listener
+	if err := t.streamListener.Start(); err != nil {
+		t.responseListener.Stop(0)
+		return err
+	}
+
+	go t.listenForStreams()
+
 	t.status = statusStarted
 
+	for _, req := range expired {
+		go t.respondExpired(req)
+	}
+
 	return nil
 }
 
@@ -154,12 +315,19 @@ func (t *Tracker) handleConn(conn net.Conn) {
 	defer t.responseListener.DoneConn(conn)
 
 	resp := &Response{}
-	if err := UnmarshalConnData(conn, resp); err != nil {
+	codec, err := t.responseListener.ReadConnData(conn, resp)
+	if err != nil {
 		logrus.WithField("error", errors.Wrap(err)).Error("fail to unmarshal response")
+		if isUnsupportedCodec(err) {
+			// Have the sender try again with JSON
+			if err := WriteConnData(conn, codec, &Response{Error: err}); err != nil {
+				logrus.WithField("error", err).Error("failed to reject response")
+			}
+		}
 		return
 	}
 
-	if err := SendConnData(conn, &Response{}); err != nil {
+	if err := WriteConnData(conn, codec, &Response{}); err != nil {
 		logrus.WithField("error", map[string]interface{}{"requestID": resp.ID}).Error("failed to ack response")
 	}
 
@@ -167,8 +335,14 @@ func (t *Tracker) handleConn(conn net.Conn) {
 }
 
 // HandleResponse associates a response with a request and either forwards the
-// response or calls the request's handler.
+// response or calls the request's handler. Progress messages are handled the
+// same way, but leave the request tracked awaiting its final response.
 func (t *Tracker) HandleResponse(resp *Response) {
+	if resp.IsProgress() {
+		t.handleProgress(resp)
+		return
+	}
+
 	req := t.retrieveRequest(resp.ID)
 	if req == nil {
 		err := errors.Newv("no tracked request", map[string]interface{}{"requestID": resp.ID})
@@ -182,6 +356,13 @@ func (t *Tracker) HandleResponse(resp *Response) {
 		_ = req.timeout.Stop()
 	}
 
+	if req.proxied {
+		prometheusx.ProxyDuration.WithLabelValues(req.Task, prometheusx.Outcome(resp.Error)).Observe(prometheusx.Since(req.tracked))
+		if handler := t.proxyDoneHandler(); handler != nil {
+			handler(req, resp)
+		}
+	}
+
 	// If there are handlers, this is the final destination, so handle the
 	// response. Otherwise, forward the response along.
 	// Known issue: If this is the final destination and there are
@@ -193,7 +374,8 @@ func (t *Tracker) HandleResponse(resp *Response) {
 		return
 	}
 
-	if resp.StreamURL != nil {
+	// Local callers can retrieve a unix stream directly
+	if resp.StreamURL != nil && req.ResponseHook.Scheme != "unix" {
 		streamURL, err := t.ProxyStreamHTTPURL(resp.StreamURL) // Replace the StreamURL with a proxy stream url
 		if err != nil {
 			err = errors.Wrapv(err, map[string]interface{}{"requestID": req.ID})
@@ -211,6 +393,27 @@ func (t *Tracker) HandleResponse(resp *Response) {
 	return
 }
 
+// handleProgress forwards a progress message along or calls the request's
+// progress handler.
+func (t *Tracker) handleProgress(resp *Response) {
+	req := t.lookupRequest(resp.ID)
+	if req == nil {
+		// Progress may arrive after the final response; it's no longer useful
+		logrus.WithField("requestID", resp.ID).Debug("dropping progress for untracked request")
+		return
+	}
+
+	if !req.proxied {
+		req.HandleResponse(resp)
+		return
+	}
+
+	if err := req.Respond(resp); err != nil {
+		err = errors.Wrapv(err, map[string]interface{}{"requestID": req.ID})
+		logrus.WithField("error", err).Error("failed to forward progress")
+	}
+}
+
 // Stop deactivates the tracker. It blocks until all active connections or tracked requests to finish.
 func (t *Tracker) Stop() {
 	// Nothing to do if it's not listening.
@@ -224,21 +427,24 @@ func (t *Tracker) Stop() {
 	// Handle any requests that are expected
 	t.waitgroup.Wait()
 
-	// Stop listening for responses
-	t.responseListener.Stop(0)
+	// Discard unclaimed data streams
+	t.closeStreams()
 
-	// Stop any data streamers
-	var dsWG sync.WaitGroup
-	t.dsLock.Lock()
-	for _, ds := range t.dataStreams {
-		dsWG.Add(1)
-		go func(ds *UnixListener) {
-			defer dsWG.Done()
-			ds.Stop(0)
-		}(ds)
+	// Stop listening for responses and data stream requests, finishing any
+	// active connections
+	var ulWG sync.WaitGroup
+	for _, ul := range []*UnixListener{t.responseListener, t.streamListener} {
+		ulWG.Add(1)
+		go func(ul *UnixListener) {
+			defer ulWG.Done()
+			ul.Stop(0)
+		}(ul)
+	}
+	ulWG.Wait()
+
+	if t.journal != nil {
+		t.journal.close()
 	}
-	t.dsLock.Unlock()
-	dsWG.Wait()
 
 	t.status = statusStopped
 	return
@@ -247,6 +453,9 @@ func (t *Tracker) Stop() {
 // TrackRequest tracks a request. This does not need to be called after using
 // ProxyUnix.
 func (t *Tracker) TrackRequest(req *Request, timeout time.Duration) error {
+	var journaled bool
+	defer t.flushJournal(&journaled)
+
 	t.requestsLock.Lock()
 	defer t.requestsLock.Unlock()
 
@@ -259,10 +468,18 @@ func (t *Tracker) TrackRequest(req *Request, timeout time.Duration) error {
 		}
 		t.waitgroup.Add(1)
 		t.requests[req.ID] = req
+		prometheusx.TrackerInFlight.Inc()
 
+		timeout = t.requestTimeout(req, timeout)
+		req.tracked = time.Now()
+		req.expires = req.tracked.Add(timeout)
 		if err := t.setRequestTimeout(req, timeout); err != nil {
 			logrus.WithField("error", err).Error("failed to set request timeout")
 		}
+		if req.proxied && t.journal != nil {
+			t.journal.track(req)
+			journaled = true
+		}
 		return nil
 	}
 
@@ -288,24 +505,141 @@ func (t *Tracker) RemoveRequest(req *Request) bool {
 
 // retrieveRequest returns a tracked Request based on ID and stops tracking it.
 func (t *Tracker) retrieveRequest(id string) *Request {
+	var journaled bool
+	defer t.flushJournal(&journaled)
+
 	t.requestsLock.Lock()
 	defer t.requestsLock.Unlock()
 
 	if req, ok := t.requests[id]; ok {
 		delete(t.requests, id)
+		prometheusx.TrackerInFlight.Dec()
+		t.removeRoute(id)
+		if req.proxied && t.journal != nil {
+			t.journal.done(id)
+			journaled = true
+		}
 		return req
 	}
 
 	return nil
 }
 
-func (t *Tracker) setRequestTimeout(req *Request, timeout time.Duration) error {
-	// Fallback to default timeout
+// lookupRequest returns a tracked Request based on ID without removing it.
+func (t *Tracker) lookupRequest(id string) *Request {
+	t.requestsLock.Lock()
+	defer t.requestsLock.Unlock()
+
+	return t.requests[id]
+}
+
+// TrackRoute records the destination a request was sent to, allowing later
+// messages about the request, such as cancellation, to follow it. The route
+// is forgotten when a response to a tracked request is handled or after the
+// timeout, whichever is first.
+func (t *Tracker) TrackRoute(req *Request, dest *url.URL, timeout time.Duration) {
 	if timeout <= 0 {
 		timeout = t.defaultTimeout
 	}
 
-	timeoutErr := errors.Newv("response timeout", map[string]interface{}{
+	var journaled bool
+	defer t.flushJournal(&journaled)
+
+	t.routesLock.Lock()
+	defer t.routesLock.Unlock()
+
+	var owner string
+	if r, ok := t.routes[req.ID]; ok {
+		_ = r.expire.Stop()
+		owner = r.owner
+	}
+	id := req.ID
+	t.routes[id] = &route{
+		dest:   dest,
+		owner:  owner,
+		expire: time.AfterFunc(timeout, func() { t.removeRoute(id) }),
+	}
+
+	if t.journal != nil {
+		t.journal.route(id, dest)
+		journaled = true
+	}
+}
+
+// flushJournal writes the queued journal records if journaled is set. It is
+// deferred before taking a lock, so the records are written after the lock is
+// released.
+func (t *Tracker) flushJournal(journaled *bool) {
+	if *journaled {
+		t.journal.flush()
+	}
+}
+
+// Route returns the destination a request was sent to, if known.
+func (t *Tracker) Route(requestID string) *url.URL {
+	t.routesLock.Lock()
+	defer t.routesLock.Unlock()
+
+	if r, ok := t.routes[requestID]; ok {
+		return r.dest
+	}
+	return nil
+}
+
+// SetRouteOwner records who sent a request whose route is tracked, such as
+// the identity of the caller, so later messages about the request can be
+// checked against it. The owner is not journaled. Returns whether the route
+// is tracked.
+func (t *Tracker) SetRouteOwner(requestID, owner string) bool {
+	t.routesLock.Lock()
+	defer t.routesLock.Unlock()
+
+	r, ok := t.routes[requestID]
+	if ok {
+		r.owner = owner
+	}
+	return ok
+}
+
+// RouteOwner returns the owner recorded for the route of a request, if any.
+func (t *Tracker) RouteOwner(requestID string) string {
+	t.routesLock.Lock()
+	defer t.routesLock.Unlock()
+
+	if r, ok := t.routes[requestID]; ok {
+		return r.owner
+	}
+	return ""
+}
+
+// removeRoute stops tracking the route of a request.
+func (t *Tracker) removeRoute(requestID string) {
+	t.routesLock.Lock()
+	defer t.routesLock.Unlock()
+
+	if r, ok := t.routes[requestID]; ok {
+		_ = r.expire.Stop()
+		delete(t.routes, requestID)
+	}
+}
+
+// requestTimeout returns the timeout to use for a tracked request. It falls
+// back to the default timeout and is shortened to fit within the request's
+// deadline, if set.
+func (t *Tracker) requestTimeout(req *Request, timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		timeout = t.defaultTimeout
+	}
+	if req.Deadline != nil {
+		if remaining := req.Deadline.Sub(time.Now()); remaining < timeout {
+			timeout = remaining
+		}
+	}
+	return timeout
+}
+
+func (t *Tracker) setRequestTimeout(req *Request, timeout time.Duration) error {
+	timeoutErr := errors.NewWithCode(errors.CodeTimeout, "response timeout", map[string]interface{}{
 		"requestID": req.ID,
 		"request":   req,
 		"timeout":   timeout.String(),
@@ -316,20 +650,51 @@ func (t *Tracker) setRequestTimeout(req *Request, timeout time.Duration) error {
 	}
 
 	req.timeout = time.AfterFunc(timeout, func() {
+		prometheusx.TrackerTimeouts.WithLabelValues(req.Task).Inc()
 		t.HandleResponse(resp)
 	})
 	return nil
 }
 
+// ProxyDoneHandler is run with the final response to a proxied request, which
+// is a timeout error if none arrived in time, before it is forwarded.
+type ProxyDoneHandler func(req *Request, resp *Response)
+
+// SetProxyDoneHandler sets the handler run when a proxied request is done.
+func (t *Tracker) SetProxyDoneHandler(handler ProxyDoneHandler) {
+	t.proxyDoneLock.Lock()
+	defer t.proxyDoneLock.Unlock()
+
+	t.proxyDone = handler
+}
+
+func (t *Tracker) proxyDoneHandler() ProxyDoneHandler {
+	t.proxyDoneLock.Lock()
+	defer t.proxyDoneLock.Unlock()
+
+	return t.proxyDone
+}
+
 // ProxyUnix proxies requests that have response hooks and stream urls of
 // non-unix sockets. If the response hook and stream url are already unix
 // sockets, it returns the original request. If the response hook is not, it
 // tracks the original request and returns a new request with a unix socket
-// response hook. If the stream url is not, it pipes the original stream
-// through a new unix socket and updates the stream url. The purpose of this is
+// response hook. If the stream url is not, it registers the original stream
+// with the tracker's stream listener and updates the stream url. The purpose of this is
 // so that there can be a single entry and exit point for external
 // communication, while local services can reply directly to each other.
 func (t *Tracker) ProxyUnix(req *Request, timeout time.Duration) (*Request, error) {
+	return t.proxyUnix(req, timeout, false)
+}
+
+// ProxyUnixTracked is like ProxyUnix, but requests with unix response hooks are
+// tracked and proxied as well, so the response to every request passes through
+// the tracker and the ProxyDoneHandler learns when each is done.
+func (t *Tracker) ProxyUnixTracked(req *Request, timeout time.Duration) (*Request, error) {
+	return t.proxyUnix(req, timeout, true)
+}
+
+func (t *Tracker) proxyUnix(req *Request, timeout time.Duration, always bool) (*Request, error) {
 	errData := map[string]interface{}{"requestID": req.ID, "request": req}
 
 	if t.responseListener == nil {
@@ -338,40 +703,36 @@ func (t *Tracker) ProxyUnix(req *Request, timeout time.Duration) (*Request, erro
 
 	if req.StreamURL != nil && req.StreamURL.Scheme != "unix" {
 		// proxy the stream
-		r, w := io.Pipe()
-
-		go func(src *url.URL) {
-			defer logrusx.LogReturnedErr(w.Close, nil, "failed to close proxy stream writer")
-			if err := Stream(w, src); err != nil {
-				err = errors.Wrapv(err, errData)
-				logrus.WithField("errors", err).Error("failed to proxy stream")
-			}
-		}(req.StreamURL)
-
-		addr, err := t.NewStreamUnix("", r)
+		id, err := t.registerStream(&streamProxy{addr: req.StreamURL})
 		if err != nil {
 			return nil, errors.Wrapv(err, errData)
 		}
 
-		req.StreamURL = addr
+		req.StreamURL = t.streamURL(id)
 	}
 
 	unixReq := req
-	if req.ResponseHook.Scheme != "unix" {
+	if always || req.ResponseHook.Scheme != "unix" {
 		// proxy the request
 		unixReq = &Request{
-			ID:           req.ID,
-			Task:         req.Task,
-			ResponseHook: t.responseListener.URL(),
-			StreamURL:    req.StreamURL,
-			Args:         req.Args,
+			ID:             req.ID,
+			Task:           req.Task,
+			ResponseHook:   t.responseListener.URL(),
+			StreamURL:      req.StreamURL,
+			Args:           req.Args,
+			IdempotencyKey: req.IdempotencyKey,
+			TraceID:        req.TraceID,
+			ParentSpanID:   req.ParentSpanID,
 			// Success and ErrorHandler are unnecessary here and intentionally
 			// omitted.
 		}
+		// Shrink the deadline by the time already spent getting here
+		unixReq.SetDeadline(time.Now().Add(t.requestTimeout(req, timeout)))
+		req.proxied = true
 		if err := t.TrackRequest(req, timeout); err != nil {
+			req.proxied = false
 			return nil, err
 		}
-		req.proxied = true
 	}
 
 	return unixReq, nil
@@ -389,10 +750,13 @@ func (t *Tracker) ProxyExternal(req *Request, timeout time.Duration) (*Request,
 	}
 
 	externalReq := &Request{
-		ID:           req.ID,
-		Task:         req.Task,
-		ResponseHook: t.externalProxyURL,
-		Args:         req.Args,
+		ID:             req.ID,
+		Task:           req.Task,
+		ResponseHook:   t.externalProxyURL,
+		Args:           req.Args,
+		IdempotencyKey: req.IdempotencyKey,
+		TraceID:        req.TraceID,
+		ParentSpanID:   req.ParentSpanID,
 	}
 	if req.StreamURL != nil {
 		streamURL, err := t.ProxyStreamHTTPURL(req.StreamURL) // Replace the StreamURL with a proxy stream url
@@ -402,10 +766,13 @@ func (t *Tracker) ProxyExternal(req *Request, timeout time.Duration) (*Request,
 		externalReq.StreamURL = streamURL
 	}
 
+	// Shrink the deadline by the time already spent getting here
+	externalReq.SetDeadline(time.Now().Add(t.requestTimeout(req, timeout)))
+	req.proxied = true
 	if err := t.TrackRequest(req, timeout); err != nil {
+		req.proxied = false
 		return nil, err
 	}
-	req.proxied = true
 
 	return externalReq, nil
 }
@@ -442,12 +809,44 @@ func (t *Tracker) ProxyExternalHandler(w http.ResponseWriter, r *http.Request) {
 	t.HandleResponse(resp)
 }
 
-// SyncRequest is a convenience method for creating and sending a synchronous request.
-func (t *Tracker) SyncRequest(dest *url.URL, opts RequestOptions, timeout time.Duration) (*Response, error) {
+// SyncRequest is a convenience method for creating and sending a synchronous
+// request. The request deadline is set from the context, if it has one, and
+// the wait for a response is abandoned if the context is done first. Requests
+// failing with temporary errors are retried according to the tracker's retry
+// policy, under an idempotency key so the task is not run more than once. If
+// the context carries a span, the request becomes part of its trace.
+func (t *Tracker) SyncRequest(ctx context.Context, dest *url.URL, opts RequestOptions, timeout time.Duration) (*Response, error) {
+	policy := t.retryPolicy()
+	if policy != nil && opts.IdempotencyKey == "" {
+		opts.IdempotencyKey = uuid.New()
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.syncRequest(ctx, dest, opts, timeout)
+		if !policy.shouldRetry(attempt, err) {
+			return resp, err
+		}
+		logrus.WithFields(logrus.Fields{
+			"task":    opts.Task,
+			"attempt": attempt,
+			"error":   err,
+		}).Warn("retrying request after temporary error")
+		if !policy.wait(ctx, attempt) {
+			return resp, err
+		}
+	}
+}
+
+// syncRequest makes a single attempt at a synchronous request.
+func (t *Tracker) syncRequest(ctx context.Context, dest *url.URL, opts RequestOptions, timeout time.Duration) (*Response, error) {
 	opts.ResponseHook = t.URL()
+	if deadline, ok := ctx.Deadline(); ok && (opts.Deadline.IsZero() || deadline.Before(opts.Deadline)) {
+		opts.Deadline = deadline
+	}
 
+	// Buffered and never closed so that a response arriving after the
+	// context is done does not block or panic
 	ch := make(chan *Response, 1)
-	defer close(ch)
 
 	rh := func(_ *Request, resp *Response) {
 		ch <- resp
@@ -459,19 +858,33 @@ func (t *Tracker) SyncRequest(dest *url.URL, opts RequestOptions, timeout time.D
 	if err != nil {
 		return nil, err
 	}
+	injectContextSpan(ctx, req)
 
 	if err := t.TrackRequest(req, timeout); err != nil {
 		return nil, err
 	}
 
-	if err := Send(dest, req); err != nil {
-		errData := map[string]interface{}{"requestID": req.ID, "request": req}
+	errData := map[string]interface{}{"requestID": req.ID, "request": req}
+	if err := t.Send(dest, req); err != nil {
 		_ = t.RemoveRequest(req)
 		return nil, errors.Wrapv(err, errData)
 	}
 
-	resp := <-ch
-	return resp, errors.ResetStack(resp.Error)
+	select {
+	case resp := <-ch:
+		return resp, errors.ResetStack(resp.Error)
+	case <-ctx.Done():
+		if !t.RemoveRequest(req) {
+			// The response is already being handled
+			resp := <-ch
+			return resp, errors.ResetStack(resp.Error)
+		}
+		err := errors.Wrapv(ctx.Err(), errData)
+		if ctx.Err() == context.DeadlineExceeded {
+			err = errors.WithCode(err, errors.CodeTimeout)
+		}
+		return nil, err
+	}
 }
 
 // ReplaceLocalhost replaces localhost, 127.0.0.1, or ::1 with the specified host.
@@ -8,12 +8,16 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
 )
 
 type TrackerTestSuite struct {
@@ -45,7 +49,9 @@ func (s *TrackerTestSuite) SetupSuite() {
 	})))
 
 	// Mock HTTP Stream server
-	s.StreamServer = httptest.NewServer(http.HandlerFunc(acomm.ProxyStreamHandler))
+	s.StreamServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Tracker.ProxyStreamHandler(w, r)
+	}))
 }
 
 func (s *TrackerTestSuite) SetupTest() {
@@ -109,6 +115,146 @@ func (s *TrackerTestSuite) TestTrackRequest() {
 	s.Equal(0, s.Tracker.NumRequests(), "timeout should have removed request")
 }
 
+func (s *TrackerTestSuite) TestRequests() {
+	if !s.NoError(s.Tracker.Start(), "should have started tracker") {
+		return
+	}
+	s.Empty(s.Tracker.Requests(), "should not have any requests")
+
+	expired := make(chan *acomm.Response, 1)
+	req, err := acomm.NewRequest(acomm.RequestOptions{
+		Task: "foobar",
+		ErrorHandler: func(_ *acomm.Request, resp *acomm.Response) {
+			expired <- resp
+		},
+	})
+	s.Require().NoError(err, "request should be created")
+	dest, _ := url.ParseRequestURI("unix:///tmp/foobar.sock")
+
+	s.NoError(s.Tracker.TrackRequest(req, time.Minute), "should have tracked request")
+	s.Tracker.TrackRoute(req, dest, 0)
+
+	requests := s.Tracker.Requests()
+	if s.Len(requests, 1, "should have the tracked request") {
+		s.Equal(req.ID, requests[0].ID)
+		s.Equal(req.Task, requests[0].Task)
+		s.Equal(dest.String(), requests[0].Route, "should have the route of the request")
+		s.False(requests[0].Proxied)
+		s.WithinDuration(requests[0].Tracked.Add(time.Minute), requests[0].Expires, time.Second)
+	}
+
+	s.False(s.Tracker.ExpireRequest("asdf"), "should not expire an untracked request")
+	s.True(s.Tracker.ExpireRequest(req.ID), "should expire the tracked request")
+	select {
+	case resp := <-expired:
+		s.True(errors.IsCode(resp.Error, errors.CodeTimeout), "should have a timeout error")
+	case <-time.After(5 * time.Second):
+		s.Fail("should have handled the request as timed out")
+	}
+	s.Empty(s.Tracker.Requests(), "should no longer track the request")
+}
+
+func (s *TrackerTestSuite) TestTrackRoute() {
+	if !s.NoError(s.Tracker.Start(), "should have started tracker") {
+		return
+	}
+	dest, _ := url.ParseRequestURI("unix:///tmp/foobar.sock")
+
+	s.Nil(s.Tracker.Route(s.Request.ID), "should not have a route for an unsent request")
+	s.False(s.Tracker.SetRouteOwner(s.Request.ID, "foo"), "should not set the owner of an untracked route")
+	s.Tracker.TrackRoute(s.Request, dest, 0)
+	s.Equal(dest, s.Tracker.Route(s.Request.ID), "should have tracked the route")
+	s.Empty(s.Tracker.RouteOwner(s.Request.ID), "should not have an owner yet")
+	s.True(s.Tracker.SetRouteOwner(s.Request.ID, "foo"))
+	s.Tracker.TrackRoute(s.Request, dest, 0)
+	s.Equal("foo", s.Tracker.RouteOwner(s.Request.ID), "retracking the route should keep the owner")
+
+	s.NoError(s.Tracker.TrackRequest(s.Request, 0), "should have successfully tracked request")
+	s.True(s.Tracker.RemoveRequest(s.Request))
+	s.Nil(s.Tracker.Route(s.Request.ID), "removing the request should have removed the route")
+
+	s.Tracker.TrackRoute(s.Request, dest, 500*time.Millisecond)
+	s.Equal(dest, s.Tracker.Route(s.Request.ID), "should have tracked the route")
+	time.Sleep(time.Second)
+	s.Nil(s.Tracker.Route(s.Request.ID), "timeout should have removed the route")
+}
+
+func (s *TrackerTestSuite) TestProxyDeadline() {
+	if !s.NoError(s.Tracker.Start(), "listner should start") {
+		return
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	req, err := acomm.NewRequest(acomm.RequestOptions{
+		Task:               "foobar",
+		ResponseHookString: s.RespServer.URL,
+		Deadline:           deadline,
+	})
+	s.Require().NoError(err, "request should be created")
+
+	time.Sleep(100 * time.Millisecond)
+	unixReq, err := s.Tracker.ProxyUnix(req, time.Minute)
+	if !s.NoError(err, "should not fail proxying") {
+		return
+	}
+	if s.NotNil(unixReq.Deadline, "should have a deadline") {
+		s.False(unixReq.Deadline.After(deadline), "should not extend the deadline")
+	}
+
+	unixReq, err = s.Tracker.ProxyUnix(&acomm.Request{
+		ID:           "shorter",
+		Task:         "foobar",
+		ResponseHook: req.ResponseHook,
+		Deadline:     &deadline,
+	}, time.Second)
+	if !s.NoError(err, "should not fail proxying") {
+		return
+	}
+	if s.NotNil(unixReq.Deadline, "should have a deadline") {
+		s.True(unixReq.Deadline.Before(deadline), "should shrink the deadline to the timeout")
+	}
+
+	s.True(s.Tracker.RemoveRequest(req), "should remove request")
+	s.True(s.Tracker.RemoveRequest(unixReq), "should remove request")
+}
+
+func (s *TrackerTestSuite) TestSyncRequestContext() {
+	if !s.NoError(s.Tracker.Start(), "listner should start") {
+		return
+	}
+
+	// Accepts requests without ever responding
+	f, err := ioutil.TempFile("", "acommTest-")
+	s.Require().NoError(err, "failed to create test unix socket")
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+	listener := acomm.NewUnixListener(f.Name()+".sock", 0)
+	s.Require().NoError(listener.Start(), "failed to start listener")
+	defer listener.Stop(0)
+	go func() {
+		for {
+			conn := listener.NextConn()
+			if conn == nil {
+				return
+			}
+			req := &acomm.Request{}
+			_ = acomm.UnmarshalConnData(conn, req)
+			_ = acomm.SendConnData(conn, &acomm.Response{})
+			listener.DoneConn(conn)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	// Either the context or the tracker timeout, which is shortened to the
+	// context deadline, may end the wait first
+	_, err = s.Tracker.SyncRequest(ctx, listener.URL(), acomm.RequestOptions{Task: "foobar"}, time.Minute)
+	s.Error(err, "should have failed when the context expired")
+	s.WithinDuration(start.Add(500*time.Millisecond), time.Now(), 300*time.Millisecond, "should have returned at the context deadline")
+	s.Equal(0, s.Tracker.NumRequests(), "should have stopped tracking the request")
+}
+
 func (s *TrackerTestSuite) TestStartListener() {
 	s.NoError(s.Tracker.Start(), "starting an unstarted should not error")
 	s.NoError(s.Tracker.Start(), "starting an started should not error")
@@ -178,6 +324,81 @@ func (s *TrackerTestSuite) TestProxyUnix() {
 	s.Equal(0, s.Tracker.NumRequests(), "should not response an unproxied request")
 }
 
+func (s *TrackerTestSuite) TestProxyUnixTracked() {
+	s.Require().NoError(s.Tracker.Start(), "listener should start")
+
+	done := make(chan *acomm.Response, 1)
+	s.Tracker.SetProxyDoneHandler(func(req *acomm.Request, resp *acomm.Response) {
+		done <- resp
+	})
+
+	respListener := acomm.NewUnixListener(s.Tracker.URL().Path+".resp", 0)
+	s.Require().NoError(respListener.Start(), "response listener should start")
+	defer respListener.Stop(0)
+
+	origUnixReq, err := acomm.NewRequest(acomm.RequestOptions{
+		Task:         "foobar",
+		ResponseHook: respListener.URL(),
+	})
+	s.Require().NoError(err, "request should be created")
+
+	unixReq, err := s.Tracker.ProxyUnixTracked(origUnixReq, 0)
+	s.Require().NoError(err, "should not fail proxying")
+	s.NotEqual(origUnixReq.ResponseHook, unixReq.ResponseHook, "should proxy a unix response hook")
+	s.Equal(1, s.Tracker.NumRequests(), "should have tracked the new request")
+
+	resp, err := acomm.NewResponse(unixReq, struct{}{}, nil, nil)
+	s.Require().NoError(err, "new response should not error")
+	s.Require().NoError(acomm.Send(unixReq.ResponseHook, resp), "response send should not error")
+
+	select {
+	case doneResp := <-done:
+		s.Equal(resp.ID, doneResp.ID, "should have called the done handler with the response")
+	case <-time.After(5 * time.Second):
+		s.Fail("should have called the done handler")
+	}
+
+	conn := respListener.NextConn()
+	s.Require().NotNil(conn, "response should have been proxied to the original response hook")
+	lastResp := &acomm.Response{}
+	s.NoError(acomm.UnmarshalConnData(conn, lastResp), "should unmarshal the proxied response")
+	s.NoError(acomm.SendConnData(conn, &acomm.Response{}), "should ack the proxied response")
+	respListener.DoneConn(conn)
+	s.Equal(resp.ID, lastResp.ID, "response should have been proxied to the original response hook")
+}
+
+func (s *TrackerTestSuite) TestProxyProgress() {
+	if !s.NoError(s.Tracker.Start(), "listner should start") {
+		return
+	}
+
+	unixReq, err := s.Tracker.ProxyUnix(s.Request, 0)
+	s.Require().NoError(err, "should not fail proxying")
+
+	progress, err := acomm.NewProgressResponse(unixReq, &acomm.Progress{Percent: 50})
+	s.Require().NoError(err, "new progress response should not error")
+	s.Require().NoError(acomm.Send(unixReq.ResponseHook, progress), "progress send should not error")
+
+	resp := s.NextResp()
+	if !s.NotNil(resp, "progress should have been proxied to original http response hook") {
+		return
+	}
+	s.Equal(s.Request.ID, resp.ID)
+	s.True(resp.IsProgress(), "should have proxied progress")
+	s.Equal(1, s.Tracker.NumRequests(), "progress should not have completed the request")
+
+	final, err := acomm.NewResponse(unixReq, struct{}{}, nil, nil)
+	s.Require().NoError(err, "new response should not error")
+	s.Require().NoError(acomm.Send(unixReq.ResponseHook, final), "response send should not error")
+
+	resp = s.NextResp()
+	if !s.NotNil(resp, "response should have been proxied to original http response hook") {
+		return
+	}
+	s.False(resp.IsProgress(), "should have proxied the final response")
+	s.Equal(0, s.Tracker.NumRequests(), "should have removed the request from tracking")
+}
+
 func (s *TrackerTestSuite) TestProxyExternal() {
 	if !s.NoError(s.Tracker.Start(), "listner should start") {
 		return
@@ -199,6 +420,9 @@ func (s *TrackerTestSuite) TestProxyExternal() {
 	}
 	s.Equal(origReq.ID, proxyReq.ID, "ids should be equal")
 	s.Equal("http", proxyReq.ResponseHook.Scheme, "new request should have http response hook")
+	if s.NotNil(proxyReq.Deadline, "proxy req should have a deadline") {
+		s.WithinDuration(time.Now().Add(time.Minute), *proxyReq.Deadline, time.Second, "proxy req deadline should be the tracking timeout")
+	}
 	if !s.Equal(1, s.Tracker.NumRequests(), "should have tracked the new request") {
 		return
 	}
@@ -221,6 +445,72 @@ func (s *TrackerTestSuite) TestProxyExternal() {
 
 }
 
+func (s *TrackerTestSuite) TestJournal() {
+	dir, err := ioutil.TempDir("", "acommJournal-")
+	s.Require().NoError(err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	journalPath := filepath.Join(dir, "journal")
+	crashPath := filepath.Join(dir, "crash")
+
+	s.Tracker.SetJournal(journalPath)
+	s.Require().NoError(s.Tracker.Start(), "listener should start")
+
+	unixReq, err := s.Tracker.ProxyUnix(s.Request, 0)
+	s.Require().NoError(err, "should not fail proxying")
+	dest, _ := url.ParseRequestURI("unix:///tmp/foobar.sock")
+	s.Tracker.TrackRoute(s.Request, dest, 0)
+
+	expiring, err := acomm.NewRequest(acomm.RequestOptions{
+		Task:               "foobar",
+		ResponseHookString: s.RespServer.URL,
+	})
+	s.Require().NoError(err, "request should be created")
+	_, err = s.Tracker.ProxyUnix(expiring, time.Second)
+	s.Require().NoError(err, "should not fail proxying")
+
+	// Keep a copy of the journal as it would be left by a crash
+	data, err := ioutil.ReadFile(journalPath)
+	s.Require().NoError(err, "should have written the journal")
+	s.Require().NoError(ioutil.WriteFile(crashPath, data, 0600))
+	s.True(s.Tracker.RemoveRequest(s.Request))
+	s.True(s.Tracker.RemoveRequest(expiring))
+	time.Sleep(1100 * time.Millisecond)
+
+	tracker, err := acomm.NewTracker("", nil, nil, 0)
+	s.Require().NoError(err)
+	tracker.SetJournal(crashPath)
+	replayed := time.Now()
+	s.Require().NoError(tracker.Start(), "should replay the journal")
+	defer tracker.Stop()
+
+	resp := s.NextResp()
+	if s.NotNil(resp, "should have responded to the expired request") {
+		s.Equal(expiring.ID, resp.ID)
+		s.Error(resp.Error, "should have responded with an error")
+	}
+	s.Equal(1, tracker.NumRequests(), "should have recovered the unexpired request")
+	if reqs := tracker.Requests(); s.Len(reqs, 1) {
+		s.False(reqs[0].Tracked.IsZero(), "should have recovered when the request was tracked")
+		s.True(reqs[0].Tracked.Before(replayed), "should have kept the original tracked time")
+		s.True(reqs[0].Expires.After(replayed), "should have recovered when the request expires")
+	}
+	if s.NotNil(tracker.Route(s.Request.ID), "should have recovered the route") {
+		s.Equal(dest.String(), tracker.Route(s.Request.ID).String())
+	}
+
+	// A late response should still reach the original response hook
+	resp, err = acomm.NewResponse(unixReq, struct{}{}, nil, nil)
+	s.Require().NoError(err, "new response should not error")
+	s.Require().NoError(acomm.Send(tracker.URL(), resp), "response send should not error")
+
+	resp = s.NextResp()
+	if s.NotNil(resp, "response should have been proxied to original http response hook") {
+		s.Equal(s.Request.ID, resp.ID)
+		s.NoError(resp.Error)
+	}
+	s.Equal(0, tracker.NumRequests(), "should have removed the request from tracking")
+}
+
 func (s *TrackerTestSuite) TestReplaceLocalhost() {
 	tests := []struct {
 		orig        string
@@ -278,3 +568,135 @@ func (s *TrackerTestSuite) TestReplaceLocalhost() {
 	}
 
 }
+
+// startFlakyProvider starts a unix listener that fails the first failures
+// requests it receives with temporary errors, either in the initial response
+// or in the final response sent to the response hook, and responds to the
+// rest successfully. Received requests are sent on the returned channel.
+func (s *TrackerTestSuite) startFlakyProvider(failures int, failInitial bool) (*acomm.UnixListener, chan *acomm.Request) {
+	f, err := ioutil.TempFile("", "acommTest-")
+	s.Require().NoError(err, "failed to create test unix socket")
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+	listener := acomm.NewUnixListener(f.Name()+".sock", 0)
+	s.Require().NoError(listener.Start(), "failed to start listener")
+
+	reqs := make(chan *acomm.Request, 10)
+	go func() {
+		for count := 1; ; count++ {
+			conn := listener.NextConn()
+			if conn == nil {
+				return
+			}
+			req := &acomm.Request{}
+			_ = acomm.UnmarshalConnData(conn, req)
+			reqs <- req
+
+			var respErr error
+			if count <= failures {
+				respErr = acomm.NewTemporaryError("provider unavailable", nil)
+			}
+			if failInitial && respErr != nil {
+				_ = acomm.SendConnData(conn, &acomm.Response{Error: respErr})
+				listener.DoneConn(conn)
+				continue
+			}
+			_ = acomm.SendConnData(conn, &acomm.Response{})
+			listener.DoneConn(conn)
+
+			var result interface{}
+			if respErr == nil {
+				result = map[string]int{"attempt": count}
+			}
+			resp, _ := acomm.NewResponse(req, result, nil, respErr)
+			_ = acomm.Send(req.ResponseHook, resp)
+		}
+	}()
+	return listener, reqs
+}
+
+func (s *TrackerTestSuite) TestSyncRequestRetry() {
+	if !s.NoError(s.Tracker.Start(), "listner should start") {
+		return
+	}
+
+	tests := []struct {
+		description string
+		failures    int
+		failInitial bool
+		policy      *acomm.RetryPolicy
+		expectedErr bool
+		attempts    int
+	}{
+		{"no policy", 1, true, nil, true, 1},
+		{"initial failures", 2, true, &acomm.RetryPolicy{MaxAttempts: 3, Backoff: 10 * time.Millisecond}, false, 3},
+		{"response failures", 2, false, &acomm.RetryPolicy{MaxAttempts: 3, Backoff: 10 * time.Millisecond}, false, 3},
+		{"too many failures", 3, false, &acomm.RetryPolicy{MaxAttempts: 2, Backoff: 10 * time.Millisecond}, true, 2},
+	}
+
+	for _, test := range tests {
+		s.Tracker.SetRetryPolicy(test.policy)
+		listener, reqs := s.startFlakyProvider(test.failures, test.failInitial)
+
+		resp, err := s.Tracker.SyncRequest(context.Background(), listener.URL(), acomm.RequestOptions{Task: "foobar"}, 5*time.Second)
+		listener.Stop(0)
+		close(reqs)
+
+		if test.expectedErr {
+			s.Error(err, test.description)
+			s.True(acomm.IsTemporary(err), test.description)
+		} else if s.NoError(err, test.description) {
+			var result map[string]int
+			s.NoError(resp.UnmarshalResult(&result), test.description)
+			s.Equal(test.attempts, result["attempt"], test.description)
+		}
+
+		var attempts []*acomm.Request
+		for req := range reqs {
+			attempts = append(attempts, req)
+		}
+		if s.Len(attempts, test.attempts, test.description) && test.policy != nil {
+			s.NotEmpty(attempts[0].IdempotencyKey, test.description)
+			s.Equal(attempts[0].IdempotencyKey, attempts[len(attempts)-1].IdempotencyKey, test.description)
+			s.NotEqual(attempts[0].ID, attempts[len(attempts)-1].ID, test.description)
+		}
+		s.Equal(0, s.Tracker.NumRequests(), test.description)
+	}
+}
+
+func (s *TrackerTestSuite) TestMultiRequestRetry() {
+	if !s.NoError(s.Tracker.Start(), "listner should start") {
+		return
+	}
+	s.Tracker.SetRetryPolicy(&acomm.RetryPolicy{MaxAttempts: 3, Backoff: 10 * time.Millisecond})
+
+	listener, _ := s.startFlakyProvider(2, false)
+	defer listener.Stop(0)
+
+	multiRequest := acomm.NewMultiRequest(context.Background(), s.Tracker, 5*time.Second)
+	req, err := acomm.NewRequest(acomm.RequestOptions{Task: "foobar"})
+	s.Require().NoError(err)
+	s.Require().NoError(multiRequest.SendRequest("foobar", listener.URL(), req))
+
+	responses := multiRequest.Responses()
+	resp := responses["foobar"]
+	if !s.NotNil(resp, "should have a response") {
+		return
+	}
+	s.NoError(resp.Error, "should have succeeded after retries")
+	var result map[string]int
+	s.NoError(resp.UnmarshalResult(&result))
+	s.Equal(3, result["attempt"])
+
+	// Destinations that are down are retried too
+	multiRequest = acomm.NewMultiRequest(context.Background(), s.Tracker, 5*time.Second)
+	down, _ := url.ParseRequestURI("unix:///does/not/exist.sock")
+	req, err = acomm.NewRequest(acomm.RequestOptions{Task: "foobar"})
+	s.Require().NoError(err)
+	s.NoError(multiRequest.SendRequest("foobar", down, req), "should retry failed sends")
+	resp = multiRequest.Responses()["foobar"]
+	if s.NotNil(resp, "should have a response") {
+		s.True(acomm.IsTemporary(resp.Error), "should have the temporary error")
+	}
+	s.Equal(0, s.Tracker.NumRequests())
+}
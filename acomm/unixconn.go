@@ -2,48 +2,163 @@ package acomm
 
 import (
 	"encoding/binary"
-	"encoding/json"
 	"io"
 	"net"
 
 	"github.com/cerana/cerana/pkg/errors"
 )
 
-// UnmarshalConnData reads and unmarshals JSON data from the connection into
-// the destination object.
+// Message framing. Original (v1) frames are a 4 byte big endian payload size
+// followed by the JSON payload. V2 frames start with a 4 byte header of the
+// frame magic, version, codec, and a reserved byte, followed by the size and
+// the encoded payload. A v1 size starting with the magic byte would exceed
+// any sane MaxMessageSize, so the two can be told apart by the first byte.
+const (
+	frameMagic   byte = 0xAC
+	frameVersion byte = 2
+)
+
+// MaxMessageSize is the largest message payload, in bytes, that will be read
+// from a connection, unless a UnixListener or Tracker is given its own limit.
+var MaxMessageSize uint32 = 64 << 20
+
+// DefaultCodec is the codec used to encode messages on connections initiated
+// locally, unless sent by a Tracker with its own codec or in response to a
+// request received with another codec. A peer that does not accept the codec
+// is sent the message again as JSON.
+var DefaultCodec = CodecJSON
+
+// readOptions are the codecs accepted and the largest message payload size
+// read from a connection.
+type readOptions struct {
+	codecs         []Codec // All supported codecs if empty
+	maxMessageSize uint32  // MaxMessageSize if zero
+}
+
+// accepts returns whether messages with the codec are read. JSON is always
+// accepted.
+func (o readOptions) accepts(codec Codec) bool {
+	if !codec.supported() {
+		return false
+	}
+	if codec == CodecJSON || len(o.codecs) == 0 {
+		return true
+	}
+	for _, c := range o.codecs {
+		if c == codec {
+			return true
+		}
+	}
+	return false
+}
+
+// maxSize returns the largest message payload size read.
+func (o readOptions) maxSize() uint32 {
+	if o.maxMessageSize == 0 {
+		return MaxMessageSize
+	}
+	return o.maxMessageSize
+}
+
+// UnmarshalConnData reads and unmarshals data from the connection into the
+// destination object.
 func UnmarshalConnData(conn net.Conn, dest interface{}) error {
-	sizeBytes := make([]byte, 4)
-	if _, err := conn.Read(sizeBytes); err != nil {
-		return errors.Wrap(err)
+	_, err := ReadConnData(conn, dest)
+	return err
+}
+
+// ReadConnData reads and unmarshals a message from the connection into the
+// destination object, returning the codec the message was encoded with so a
+// reply can use the same one. Both v1 and v2 frames are accepted, with any
+// supported codec. A message with a codec that is not supported returns an
+// error that, sent as the reply, has the sender try again with JSON.
+func ReadConnData(conn net.Conn, dest interface{}) (Codec, error) {
+	return readConnData(conn, readOptions{}, dest)
+}
+
+// readConnData reads and unmarshals a message from the connection into the
+// destination object. A Request remembers the codec so its responses can use
+// the same one.
+func readConnData(conn net.Conn, opts readOptions, dest interface{}) (Codec, error) {
+	codec, payload, err := readFrame(conn, opts)
+	if err != nil {
+		return codec, err
+	}
+	if err := codec.unmarshal(payload, dest); err != nil {
+		return codec, err
+	}
+	if req, ok := dest.(*Request); ok {
+		req.codec = codec
 	}
-	payloadSize := binary.BigEndian.Uint32(sizeBytes)
+	return codec, nil
+}
 
-	// wrap in an io.LimitReader with the expected size to prevent
-	// malformed payloads from blocking the decoder
-	payloadReader := io.LimitReader(conn, int64(payloadSize))
+// readFrame reads a message frame from the connection, returning the codec
+// and the encoded payload. A message with a codec that is not accepted is
+// read in full and returns an unsupported codec error with the JSON codec, so
+// it can be replied to.
+func readFrame(conn net.Conn, opts readOptions) (Codec, []byte, error) {
+	codec := CodecJSON
 
-	decoder := json.NewDecoder(payloadReader)
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return codec, nil, errors.Wrap(err)
+	}
+	if header[0] == frameMagic {
+		if header[1] != frameVersion {
+			return codec, nil, errors.Newv("unsupported frame version", map[string]interface{}{"version": header[1]})
+		}
+		codec = Codec(header[2])
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return codec, nil, errors.Wrap(err)
+		}
+	}
 
-	return errors.Wrap(decoder.Decode(dest))
+	payloadSize := binary.BigEndian.Uint32(header)
+	if maxSize := opts.maxSize(); payloadSize > maxSize {
+		return codec, nil, errors.Newv("message too large", map[string]interface{}{
+			"size": payloadSize,
+			"max":  maxSize,
+		})
+	}
+
+	payload := make([]byte, payloadSize)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return codec, nil, errors.Wrapv(err, map[string]interface{}{"size": payloadSize})
+	}
+	if !opts.accepts(codec) {
+		return CodecJSON, nil, newUnsupportedCodecError(codec)
+	}
+	return codec, payload, nil
 }
 
-// SendConnData marshals and writes payload JSON data to the Conn with
-// appropriate headers.
+// SendConnData marshals and writes payload data to the Conn with appropriate
+// headers, using the DefaultCodec.
 func SendConnData(conn net.Conn, payload interface{}) error {
-	payloadJSON, err := json.Marshal(payload)
+	return WriteConnData(conn, DefaultCodec, payload)
+}
+
+// WriteConnData marshals and writes payload data to the Conn with the codec.
+// JSON payloads use v1 frames so peers without v2 framing can read them.
+func WriteConnData(conn net.Conn, codec Codec, payload interface{}) error {
+	payloadData, err := codec.marshal(payload)
 	if err != nil {
 		return errors.Wrapv(err, map[string]interface{}{"payload": payload})
 	}
 
+	data := make([]byte, 0, 8+len(payloadData))
+	if codec != CodecJSON {
+		data = append(data, frameMagic, frameVersion, byte(codec), 0)
+	}
 	sizeBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(sizeBytes, uint32(len(payloadJSON)))
-
-	data := append(sizeBytes, payloadJSON...)
+	binary.BigEndian.PutUint32(sizeBytes, uint32(len(payloadData)))
+	data = append(data, sizeBytes...)
+	data = append(data, payloadData...)
 
 	if _, err := conn.Write(data); err != nil {
 		return errors.Wrapv(err, map[string]interface{}{
-			"addr": conn.RemoteAddr(),
-			"data": string(data),
+			"addr":  conn.RemoteAddr(),
+			"codec": codec.String(),
 		})
 	}
 
@@ -0,0 +1,178 @@
+package acomm_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/stretchr/testify/suite"
+)
+
+type UnixConnTestSuite struct {
+	suite.Suite
+	client net.Conn
+	server net.Conn
+}
+
+func TestUnixConnTestSuite(t *testing.T) {
+	suite.Run(t, new(UnixConnTestSuite))
+}
+
+func (s *UnixConnTestSuite) SetupTest() {
+	s.client, s.server = net.Pipe()
+}
+
+func (s *UnixConnTestSuite) TearDownTest() {
+	_ = s.client.Close()
+	_ = s.server.Close()
+}
+
+// write writes data to the client end in the background.
+func (s *UnixConnTestSuite) write(chunks ...[]byte) {
+	go func() {
+		for _, chunk := range chunks {
+			if _, err := s.client.Write(chunk); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+func (s *UnixConnTestSuite) TestCodecs() {
+	deadline := time.Now().Add(time.Minute).Round(time.Second).UTC()
+	req, err := acomm.NewRequest(acomm.RequestOptions{
+		Task:               "foobar",
+		ResponseHookString: "unix://foo/bar",
+		Args:               map[string]interface{}{"foo": "bar", "big": int64(1) << 60, "half": 0.5},
+	})
+	s.Require().NoError(err)
+	req.SetDeadline(deadline)
+
+	result := map[string]string{"bar": "baz"}
+	resp, err := acomm.NewResponse(req, result, nil, nil)
+	s.Require().NoError(err)
+	errResp, err := acomm.NewResponse(req, nil, nil, acomm.NewForbiddenError("denied", nil))
+	s.Require().NoError(err)
+
+	for _, codec := range []acomm.Codec{acomm.CodecJSON, acomm.CodecCBOR, acomm.CodecMsgpack} {
+		go func(codec acomm.Codec) {
+			_ = acomm.WriteConnData(s.client, codec, req)
+			_ = acomm.WriteConnData(s.client, codec, resp)
+			_ = acomm.WriteConnData(s.client, codec, errResp)
+		}(codec)
+
+		reqOut := &acomm.Request{}
+		readCodec, err := acomm.ReadConnData(s.server, reqOut)
+		if !s.NoError(err, codec.String()) {
+			continue
+		}
+		s.Equal(codec, readCodec, codec.String())
+		s.Equal(req.ID, reqOut.ID, codec.String())
+		s.Equal(req.Task, reqOut.Task, codec.String())
+		s.Equal(req.ResponseHook.String(), reqOut.ResponseHook.String(), codec.String())
+		s.True(deadline.Equal(*reqOut.Deadline), codec.String())
+		var args struct {
+			Foo  string  `json:"foo"`
+			Big  int64   `json:"big"`
+			Half float64 `json:"half"`
+		}
+		s.NoError(reqOut.UnmarshalArgs(&args), codec.String())
+		s.Equal("bar", args.Foo, codec.String())
+		s.Equal(int64(1)<<60, args.Big, codec.String())
+		s.Equal(0.5, args.Half, codec.String())
+
+		respOut := &acomm.Response{}
+		_, err = acomm.ReadConnData(s.server, respOut)
+		s.NoError(err, codec.String())
+		s.Equal(resp.ID, respOut.ID, codec.String())
+		s.NoError(respOut.Error, codec.String())
+		var resultOut map[string]string
+		s.NoError(respOut.UnmarshalResult(&resultOut), codec.String())
+		s.Equal(result, resultOut, codec.String())
+
+		errRespOut := &acomm.Response{}
+		_, err = acomm.ReadConnData(s.server, errRespOut)
+		s.NoError(err, codec.String())
+		s.Nil(errRespOut.Result, codec.String())
+		s.True(acomm.IsForbidden(errRespOut.Error), codec.String())
+	}
+}
+
+func (s *UnixConnTestSuite) TestNativeArgs() {
+	req, err := acomm.NewRequest(acomm.RequestOptions{
+		Task: "foobar",
+		Args: map[string]string{"foo": "bar"},
+	})
+	s.Require().NoError(err)
+
+	for _, codec := range []acomm.Codec{acomm.CodecCBOR, acomm.CodecMsgpack} {
+		go func(codec acomm.Codec) {
+			_ = acomm.WriteConnData(s.client, codec, req)
+		}(codec)
+
+		data := make([]byte, 1024)
+		n, err := s.server.Read(data)
+		s.NoError(err, codec.String())
+		s.False(bytes.Contains(data[:n], []byte(`{"foo":"bar"}`)), codec.String()+": should not encode args as JSON")
+		s.True(bytes.Contains(data[:n], []byte("foo")), codec.String()+": should encode args")
+	}
+}
+
+func (s *UnixConnTestSuite) TestV1Frames() {
+	payload := []byte(`{"id":"foobar"}`)
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(payload)))
+	// Short writes should not corrupt the framing
+	s.write(size[:1], size[1:], payload[:3], payload[3:])
+
+	resp := &acomm.Response{}
+	codec, err := acomm.ReadConnData(s.server, resp)
+	s.NoError(err)
+	s.Equal(acomm.CodecJSON, codec)
+	s.Equal("foobar", resp.ID)
+
+	// JSON is sent with v1 frames
+	go func() { _ = acomm.SendConnData(s.server, resp) }()
+	header := make([]byte, 4)
+	_, err = s.client.Read(header)
+	s.NoError(err)
+	s.EqualValues(0, header[0])
+}
+
+func (s *UnixConnTestSuite) TestMaxMessageSize() {
+	orig := acomm.MaxMessageSize
+	defer func() { acomm.MaxMessageSize = orig }()
+	acomm.MaxMessageSize = 10
+
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, 11)
+	s.write(size)
+
+	_, err := acomm.ReadConnData(s.server, &acomm.Response{})
+	s.Error(err)
+	s.Contains(errors.Cause(err).Error(), "message too large")
+}
+
+func (s *UnixConnTestSuite) TestUnknownFrame() {
+	s.write([]byte{0xAC, 9, 0, 0})
+	_, err := acomm.ReadConnData(s.server, &acomm.Response{})
+	s.Error(err, "should not read unknown frame versions")
+
+	s.write([]byte{0xAC, 2, 99, 0, 0, 0, 0, 2}, []byte("{}"))
+	_, err = acomm.ReadConnData(s.server, &acomm.Response{})
+	s.Error(err, "should not read unknown codecs")
+}
+
+func (s *UnixConnTestSuite) TestParseCodec() {
+	for _, codec := range []acomm.Codec{acomm.CodecJSON, acomm.CodecCBOR, acomm.CodecMsgpack} {
+		parsed, err := acomm.ParseCodec(codec.String())
+		s.NoError(err)
+		s.Equal(codec, parsed)
+	}
+	_, err := acomm.ParseCodec("xml")
+	s.Error(err)
+}
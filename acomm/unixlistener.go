@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -22,7 +23,9 @@ type UnixListener struct {
 	listener    *net.UnixListener
 	waitgroup   sync.WaitGroup
 	stopChan    chan struct{}
+	listenDone  chan struct{}
 	connChan    chan net.Conn
+	readOpts    readOptions
 }
 
 // NewUnixListener creates and initializes a new UnixListener. AcceptLimit
@@ -38,9 +41,14 @@ func NewUnixListener(socketPath string, acceptLimit int) *UnixListener {
 		acceptLimit = -1
 	}
 
+	// Nothing is listening until started
+	listenDone := make(chan struct{})
+	close(listenDone)
+
 	return &UnixListener{
-		addr:     addr,
-		stopChan: make(chan struct{}),
+		addr:       addr,
+		stopChan:   make(chan struct{}),
+		listenDone: listenDone,
 		// Note: The chan here just holds conns until they get passed to a
 		// handler. The buffer size does not control conn handling concurrency.
 		connChan:    make(chan net.Conn, 1000),
@@ -59,6 +67,35 @@ func (ul *UnixListener) URL() *url.URL {
 	return u
 }
 
+// SetCodec sets the codec accepted on connections in addition to JSON. Until
+// it is set, all supported codecs are accepted. Messages with other codecs
+// are rejected so the sender can send them again as JSON. It should be called
+// before the listener is started.
+func (ul *UnixListener) SetCodec(codec Codec) {
+	ul.readOpts.codecs = []Codec{codec}
+}
+
+// SetMaxMessageSize sets the largest message size, in bytes, read from
+// connections. Zero uses MaxMessageSize. It should be called before the
+// listener is started.
+func (ul *UnixListener) SetMaxMessageSize(size uint32) {
+	ul.readOpts.maxMessageSize = size
+}
+
+// ReadConnData reads and unmarshals a message from a connection of the
+// listener into the destination object, accepting the listener's codecs and
+// message size. See the ReadConnData function.
+func (ul *UnixListener) ReadConnData(conn net.Conn, dest interface{}) (Codec, error) {
+	return readConnData(conn, ul.readOpts, dest)
+}
+
+// ReadConnRequests reads a message of either a single request or a batch of
+// requests from a connection of the listener, accepting the listener's codecs
+// and message size. See the ReadConnRequests function.
+func (ul *UnixListener) ReadConnRequests(conn net.Conn) ([]*Request, bool, Codec, error) {
+	return readConnRequests(conn, ul.readOpts)
+}
+
 // Start prepares the listener and starts listening for new connections.
 func (ul *UnixListener) Start() error {
 	if err := ul.createListener(); err != nil {
@@ -66,6 +103,7 @@ func (ul *UnixListener) Start() error {
 	}
 
 	ul.stopChan = make(chan struct{})
+	ul.listenDone = make(chan struct{})
 
 	// Waitgroup should wait for the listener itself to close
 	ul.waitgroup.Add(1)
@@ -99,6 +137,7 @@ func (ul *UnixListener) createListener() error {
 // limit.
 func (ul *UnixListener) listen() {
 	defer ul.waitgroup.Done()
+	defer close(ul.listenDone)
 	defer logrusx.LogReturnedErr(ul.listener.Close, map[string]interface{}{
 		"addr": ul.Addr(),
 	}, "failed to close listener")
@@ -148,17 +187,38 @@ func (ul *UnixListener) Stop(timeout time.Duration) {
 	return
 }
 
-// NextConn blocks and returns the next connection. It will return nil when the
-// listener is stopped and all existing connections have been handled.
+// Unlink removes the socket file so no new connections are made, while
+// connections already made are still accepted. The path can then be reused,
+// so the listener no longer removes it when stopped, which would remove a
+// socket that replaced it.
+func (ul *UnixListener) Unlink() error {
+	if ul.listener != nil {
+		ul.listener.SetUnlinkOnClose(false)
+	}
+	if err := os.Remove(ul.Addr()); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapv(err, map[string]interface{}{"addr": ul.Addr()})
+	}
+	return nil
+}
+
+// NextConn blocks and returns the next connection. It will return nil once the
+// listener stops accepting connections and all accepted ones have been
+// returned.
 // Connections should be handled in a go routine to take advantage of
 // concurrency. When done, the connection MUST be finished with a call to
 // DoneConn.
 func (ul *UnixListener) NextConn() net.Conn {
 	select {
-	case <-ul.stopChan:
-		return nil
 	case conn := <-ul.connChan:
 		return conn
+	case <-ul.listenDone:
+		// Connections may have been accepted just before it stopped
+		select {
+		case conn := <-ul.connChan:
+			return conn
+		default:
+			return nil
+		}
 	}
 }
 
@@ -175,3 +235,37 @@ func (ul *UnixListener) DoneConn(conn net.Conn) {
 
 	ul.waitgroup.Done()
 }
+
+// IsStaleSocket returns whether the path is a unix socket that refuses
+// connections, as one left behind by a process that exited without removing
+// it does.
+func IsStaleSocket(socketPath string) bool {
+	fi, err := os.Lstat(socketPath)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return false
+	}
+
+	conn, err := net.DialTimeout("unix", socketPath, time.Second)
+	if err == nil {
+		_ = conn.Close()
+		return false
+	}
+	opErr, ok := err.(*net.OpError)
+	if !ok {
+		return false
+	}
+	sysErr, ok := opErr.Err.(*os.SyscallError)
+	return ok && sysErr.Err == syscall.ECONNREFUSED
+}
+
+// RemoveStaleSocket removes the unix socket at a path if it is stale, so that
+// it can be replaced. It returns whether the socket was removed.
+func RemoveStaleSocket(socketPath string) (bool, error) {
+	if !IsStaleSocket(socketPath) {
+		return false, nil
+	}
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return false, errors.Wrapv(err, map[string]interface{}{"socket": socketPath}, "failed to remove stale socket")
+	}
+	return true, nil
+}
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"syscall"
 	"testing"
 
 	"github.com/cerana/cerana/acomm"
@@ -110,3 +111,88 @@ func (s *UnixListenerTestSuite) TestSendAndUnmarshalConnData() {
 
 	s.Listener.DoneConn(lConn)
 }
+
+func (s *UnixListenerTestSuite) TestStaleSocket() {
+	s.False(acomm.IsStaleSocket(s.Socket), "should not be stale when missing")
+
+	// A socket bound but no longer listening is left behind by a process
+	// exiting without removing it
+	fd, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	s.Require().NoError(err)
+	s.Require().NoError(syscall.Bind(fd, &syscall.SockaddrUnix{Name: s.Socket}))
+	s.Require().NoError(syscall.Close(fd))
+	s.True(acomm.IsStaleSocket(s.Socket), "should be stale without a listener")
+
+	removed, err := acomm.RemoveStaleSocket(s.Socket)
+	s.NoError(err)
+	s.True(removed, "should have removed the stale socket")
+	_, err = os.Stat(s.Socket)
+	s.True(os.IsNotExist(err), "should have removed the socket file")
+
+	s.NoError(s.Listener.Start(), "should start with the stale socket gone")
+	s.False(acomm.IsStaleSocket(s.Socket), "should not be stale while listening")
+	// Finish the connection made checking the socket
+	s.Listener.DoneConn(s.Listener.NextConn())
+
+	f, err := ioutil.TempFile("", "acommTest-")
+	s.Require().NoError(err)
+	_ = f.Close()
+	defer func() { _ = os.Remove(f.Name()) }()
+	s.False(acomm.IsStaleSocket(f.Name()), "should not treat a regular file as a socket")
+}
+
+func (s *UnixListenerTestSuite) TestCodecNegotiation() {
+	s.Listener.SetCodec(acomm.CodecJSON)
+	if !s.NoError(s.Listener.Start(), "should start successfully") {
+		return
+	}
+
+	tracker, err := acomm.NewTracker("", nil, nil, 0)
+	s.Require().NoError(err)
+	tracker.SetCodec(acomm.CodecCBOR)
+
+	codecs := make(chan acomm.Codec, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			conn := s.Listener.NextConn()
+			if conn == nil {
+				return
+			}
+			resp := &acomm.Response{}
+			codec, err := s.Listener.ReadConnData(conn, resp)
+			if err == nil {
+				codecs <- codec
+			}
+			_ = acomm.WriteConnData(conn, codec, &acomm.Response{Error: err})
+			s.Listener.DoneConn(conn)
+		}
+	}()
+
+	resp := &acomm.Response{ID: "foobar"}
+	s.NoError(tracker.Send(s.Listener.URL(), resp), "should send again as JSON")
+	s.Equal(acomm.CodecJSON, <-codecs, "should only accept JSON")
+}
+
+func (s *UnixListenerTestSuite) TestMaxMessageSize() {
+	s.Listener.SetMaxMessageSize(10)
+	if !s.NoError(s.Listener.Start(), "should start successfully") {
+		return
+	}
+
+	go func() {
+		conn, err := net.Dial("unix", s.Listener.Addr())
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_ = acomm.WriteConnData(conn, acomm.CodecJSON, &acomm.Response{ID: "foobar"})
+	}()
+
+	conn := s.Listener.NextConn()
+	if !s.NotNil(conn) {
+		return
+	}
+	_, err := s.Listener.ReadConnData(conn, &acomm.Response{})
+	s.Error(err, "should not read messages larger than the listener's limit")
+	s.Listener.DoneConn(conn)
+}
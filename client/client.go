@@ -0,0 +1,46 @@
+package client
+
+import (
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/providers/clusterconf"
+	"github.com/cerana/cerana/providers/datatrade"
+	"github.com/cerana/cerana/providers/dhcp"
+	"github.com/cerana/cerana/providers/health"
+	"github.com/cerana/cerana/providers/kv"
+	"github.com/cerana/cerana/providers/metrics"
+	"github.com/cerana/cerana/providers/namespace"
+	"github.com/cerana/cerana/providers/service"
+	"github.com/cerana/cerana/providers/systemd"
+	"github.com/cerana/cerana/providers/zfs"
+)
+
+// Client has typed clients for the tasks of each provider, sharing one acomm
+// client.
+type Client struct {
+	ClusterConf *clusterconf.Client
+	DataTrade   *datatrade.Client
+	DHCP        *dhcp.Client
+	Health      *health.Client
+	KV          *kv.Client
+	Metrics     *metrics.Client
+	Namespace   *namespace.Client
+	Service     *service.Client
+	Systemd     *systemd.Client
+	ZFS         *zfs.Client
+}
+
+// New creates a new Client sending requests with the acomm client.
+func New(c *acomm.Client) *Client {
+	return &Client{
+		ClusterConf: clusterconf.NewClient(c),
+		DataTrade:   datatrade.NewClient(c),
+		DHCP:        dhcp.NewClient(c),
+		Health:      health.NewClient(c),
+		KV:          kv.NewClient(c),
+		Metrics:     metrics.NewClient(c),
+		Namespace:   namespace.NewClient(c),
+		Service:     service.NewClient(c),
+		Systemd:     systemd.NewClient(c),
+		ZFS:         zfs.NewClient(c),
+	}
+}
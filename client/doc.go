@@ -0,0 +1,22 @@
+/*
+Package client provides typed access to the tasks of all of the providers.
+
+Each provider package has the names of its tasks as constants and a Client
+with a method per task, taking and returning the provider's arg and result
+types. Client gathers them over a single acomm.Client, which sends the
+requests to a coordinator and waits for the responses. Methods of node local
+providers, such as zfs and systemd, take the url of the coordinator on the
+node to run the task on; nil runs it on the coordinator's own node.
+
+	tracker, _ := acomm.NewTracker(socketPath, nil, nil, timeout)
+	_ = tracker.Start()
+	c := client.New(acomm.NewClient(tracker, coordinatorURL, timeout))
+
+	bundles, err := c.ClusterConf.ListBundles(ctx, true)
+	err = c.ZFS.Snapshot(ctx, nodeURL, zfs.SnapshotArgs{Name: name, SnapName: "backup"})
+	cookie, err := c.KV.Lock(ctx, "lock/key", 10*time.Second)
+
+Errors keep the error code given by the provider, so they can be checked with
+errors.IsCode.
+*/
+package client
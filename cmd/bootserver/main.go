@@ -178,7 +178,7 @@ func (h *dhcpHandler) ServeDHCP(p dhcp4.Packet, msgType dhcp4.MessageType, optio
 	var responseType dhcp4.MessageType
 	switch msgType {
 	case dhcp4.Discover:
-		logrusx.DieOnError(comm(h.tracker, h.coordinator, "dhcp-offer-lease", args, &offer), "get lease offering")
+		logrusx.DieOnError(comm(h.tracker, h.coordinator, dhcp.TaskOfferLease, args, &offer), "get lease offering")
 
 		responseType = dhcp4.Offer
 	case dhcp4.Request:
@@ -195,7 +195,7 @@ func (h *dhcpHandler) ServeDHCP(p dhcp4.Packet, msgType dhcp4.MessageType, optio
 		} else if reqIP.Equal(net.IPv4zero) {
 			logrus.Error("requested ip is 0.0.0.0")
 			return nack(p, ip)
-		} else if err := comm(h.tracker, h.coordinator, "dhcp-ack-lease", args, &offer); err != nil {
+		} else if err := comm(h.tracker, h.coordinator, dhcp.TaskAckLease, args, &offer); err != nil {
 			logrus.WithField("error", err).Error("")
 			return nack(p, ip)
 		}
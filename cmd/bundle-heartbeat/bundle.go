@@ -3,16 +3,16 @@ package main
 import (
 	"fmt"
 	"net"
-	"net/url"
 	"strconv"
 	"strings"
 
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/pkg/errors"
 	"github.com/cerana/cerana/providers/clusterconf"
+	"github.com/cerana/cerana/providers/metrics"
 	"github.com/cerana/cerana/providers/service"
 	"github.com/cerana/cerana/tick"
-	"github.com/shirou/gopsutil/host"
+	"golang.org/x/net/context"
 )
 
 func bundleHeartbeats(config tick.Configer, tracker *acomm.Tracker) error {
@@ -36,43 +36,19 @@ func bundleHeartbeats(config tick.Configer, tracker *acomm.Tracker) error {
 }
 
 func getBundles(config tick.Configer, tracker *acomm.Tracker) ([]*clusterconf.Bundle, error) {
-	requests := map[string]struct {
-		task     string
-		url      *url.URL
-		respData interface{}
-	}{
-		"local": {task: "service-list", url: config.NodeDataURL(), respData: &service.ListResult{}},
-		"known": {task: "list-bundles", url: config.ClusterDataURL(), respData: &clusterconf.BundleListResult{}},
-	}
-
-	multiRequest := acomm.NewMultiRequest(tracker, config.RequestTimeout())
-	for name, args := range requests {
-		req, err := acomm.NewRequest(acomm.RequestOptions{Task: args.task})
-		if err != nil {
-			return nil, err
-		}
-		if err := multiRequest.AddRequest(name, req); err != nil {
-			return nil, err
-		}
-		if err := acomm.Send(args.url, req); err != nil {
-			multiRequest.RemoveRequest(req)
-			return nil, err
-		}
+	ctx := context.Background()
+	nodeData := service.NewClient(acomm.NewClient(tracker, config.NodeDataURL(), config.RequestTimeout()))
+	clusterData := clusterconf.NewClient(acomm.NewClient(tracker, config.ClusterDataURL(), config.RequestTimeout()))
 
+	services, err := nodeData.List(ctx, nil)
+	if err != nil {
+		return nil, errors.ResetStack(err)
 	}
-
-	responses := multiRequest.Responses()
-	for name, args := range requests {
-		resp := responses[name]
-		if resp.Error != nil {
-			return nil, errors.ResetStack(resp.Error)
-		}
-		if err := resp.UnmarshalResult(args.respData); err != nil {
-			return nil, err
-		}
+	knownBundles, err := clusterData.ListBundles(ctx, false)
+	if err != nil {
+		return nil, errors.ResetStack(err)
 	}
-	localBundles := extractBundles(requests["local"].respData.(*service.ListResult).Services)
-	knownBundles := requests["known"].respData.(*clusterconf.BundleListResult).Bundles
+	localBundles := extractBundles(services)
 
 	bundles := make([]*clusterconf.Bundle, 0, len(localBundles))
 	for _, local := range localBundles {
@@ -97,85 +73,41 @@ func getBundles(config tick.Configer, tracker *acomm.Tracker) ([]*clusterconf.Bu
 }
 
 func getSerial(config tick.Configer, tracker *acomm.Tracker) (string, error) {
-	doneChan := make(chan *acomm.Response, 1)
-	rh := func(_ *acomm.Request, resp *acomm.Response) {
-		doneChan <- resp
-	}
-	req, err := acomm.NewRequest(acomm.RequestOptions{
-		Task:           "metrics-host",
-		ResponseHook:   tracker.URL(),
-		SuccessHandler: rh,
-		ErrorHandler:   rh,
-	})
+	nodeData := metrics.NewClient(acomm.NewClient(tracker, config.NodeDataURL(), config.RequestTimeout()))
+	info, err := nodeData.Host(context.Background(), nil)
 	if err != nil {
-		return "", err
-	}
-	if err := tracker.TrackRequest(req, config.RequestTimeout()); err != nil {
-		return "", err
-	}
-	if err := acomm.Send(config.NodeDataURL(), req); err != nil {
-		return "", err
-	}
-
-	resp := <-doneChan
-	if resp.Error != nil {
-		return "", errors.ResetStack(resp.Error)
-	}
-
-	var data host.InfoStat
-	if err := resp.UnmarshalResult(&data); err != nil {
-		return "", err
+		return "", errors.ResetStack(err)
 	}
-
-	return data.Hostname, nil
+	return info.Hostname, nil
 }
 
 func sendBundleHeartbeats(config tick.Configer, tracker *acomm.Tracker, bundles map[uint64]map[string]error, serial string, ip net.IP) error {
-	errored := make([]uint64, 0, len(bundles))
+	clusterData := clusterconf.NewClient(acomm.NewClient(tracker, config.ClusterDataURL(), config.RequestTimeout()))
 
-	multiRequest := acomm.NewMultiRequest(tracker, config.RequestTimeout())
+	// The heartbeats are sent in a single batch
+	heartbeats := make([]clusterconf.BundleHeartbeatArgs, 0, len(bundles))
 	for bundle, healthErrors := range bundles {
-		req, err := acomm.NewRequest(acomm.RequestOptions{
-			Task: "bundle-heartbeat",
-			Args: clusterconf.BundleHeartbeatArgs{
-				ID:           bundle,
-				Serial:       serial,
-				IP:           ip,
-				HealthErrors: healthErrors,
-			},
+		heartbeats = append(heartbeats, clusterconf.BundleHeartbeatArgs{
+			ID:           bundle,
+			Serial:       serial,
+			IP:           ip,
+			HealthErrors: healthErrors,
 		})
-		if err != nil {
-			errored = append(errored, bundle)
-			continue
-		}
-		if err := multiRequest.AddRequest(strconv.FormatUint(bundle, 10), req); err != nil {
-			errored = append(errored, bundle)
-			continue
-		}
-		if err := acomm.Send(config.ClusterDataURL(), req); err != nil {
-			multiRequest.RemoveRequest(req)
-			errored = append(errored, bundle)
-			continue
-		}
 	}
 
-	responses := multiRequest.Responses()
-	for name, resp := range responses {
-		if resp.Error != nil {
-			bundle, _ := strconv.ParseUint(name, 10, 64)
+	errs := clusterData.SendBundleHeartbeats(context.Background(), heartbeats)
+	if len(errs) > 0 {
+		errored := make([]uint64, 0, len(errs))
+		for bundle := range errs {
 			errored = append(errored, bundle)
-			break
 		}
-	}
-
-	if len(errored) > 0 {
 		return errors.Newv("one or more bundle heartbeats unsuccessful", map[string]interface{}{"errors": errored})
 	}
 	return nil
 }
 
 func runHealthChecks(config tick.Configer, tracker *acomm.Tracker, bundles []*clusterconf.Bundle) (map[uint64]map[string]error, map[string]error) {
-	multiRequest := acomm.NewMultiRequest(tracker, 0)
+	multiRequest := acomm.NewMultiRequest(context.Background(), tracker, 0)
 
 	requests := make(map[string]*acomm.Request)
 	errs := make(map[string]error)
@@ -196,15 +128,8 @@ func runHealthChecks(config tick.Configer, tracker *acomm.Tracker, bundles []*cl
 		}
 	}
 
-	for name, req := range requests {
-		if err := multiRequest.AddRequest(name, req); err != nil {
-			errs[name] = err
-			continue
-		}
-		if err := acomm.Send(config.NodeDataURL(), req); err != nil {
-			multiRequest.RemoveRequest(req)
-			errs[name] = err
-		}
+	for name, err := range multiRequest.SendRequests(config.NodeDataURL(), requests) {
+		errs[name] = err
 	}
 
 	responses := multiRequest.Responses()
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/cerana/cerana/acomm"
+)
+
+// Response hook paths of the http server, used when responses are not
+// received as events.
+const (
+	hookResponse = "response"
+	hookCancel   = "cancel"
+	hookDescribe = "describe"
+)
+
+// client sends requests to the coordinator and delivers their responses on
+// channels. Responses are received on the request connection as events, or
+// by the http server when callback is set.
+type client struct {
+	coordinatorURL *url.URL
+	eventsURL      *url.URL
+	httpAddr       string
+	callback       bool
+	hooks          map[string]chan *acomm.Response
+	streamErrs     chan error
+}
+
+func newClient(coordinator, httpAddr string, callback bool) (*client, error) {
+	coordinatorURL, err := url.ParseRequestURI(coordinator)
+	if err != nil {
+		return nil, fmt.Errorf("invalid coordinator url: %s", err)
+	}
+
+	return &client{
+		coordinatorURL: coordinatorURL,
+		eventsURL:      coordinatorURL.ResolveReference(&url.URL{Path: "/events"}),
+		httpAddr:       httpAddr,
+		callback:       callback,
+		hooks: map[string]chan *acomm.Response{
+			hookResponse: make(chan *acomm.Response, 10),
+			hookCancel:   make(chan *acomm.Response, 1),
+			hookDescribe: make(chan *acomm.Response, 1),
+		},
+		streamErrs: make(chan error, 1),
+	}, nil
+}
+
+// send sends a request and returns the channel its responses, including
+// progress, are delivered on. An error sending the request is delivered as an
+// error response.
+func (c *client) send(req *acomm.Request, hook string) (<-chan *acomm.Response, error) {
+	if c.callback {
+		if err := req.SetResponseHook(fmt.Sprintf("http://%s/%s", c.httpAddr, hook)); err != nil {
+			return nil, err
+		}
+		return c.hooks[hook], acomm.Send(c.coordinatorURL, req)
+	}
+
+	responses := make(chan *acomm.Response, 10)
+	handler := func(_ *acomm.Request, resp *acomm.Response) {
+		deliver(responses, resp)
+	}
+	req.SuccessHandler = handler
+	req.ErrorHandler = handler
+	req.ProgressHandler = handler
+	go func() {
+		if err := acomm.SendEvents(c.eventsURL, req); err != nil {
+			responses <- &acomm.Response{ID: req.ID, Error: err}
+		}
+	}()
+	return responses, nil
+}
+
+// deliver passes a response along, dropping progress rather than blocking if
+// rendering falls behind.
+func deliver(responses chan *acomm.Response, resp *acomm.Response) {
+	if !resp.IsProgress() {
+		responses <- resp
+		return
+	}
+	select {
+	case responses <- resp:
+	default:
+	}
+}
+
+// startHTTPServer starts the http server for response hooks, if responses are
+// received by callback, and for serving request stream data from STDIN.
+func (c *client) startHTTPServer() error {
+	for hook, responses := range c.hooks {
+		http.HandleFunc("/"+hook, hookHandler(responses))
+	}
+	http.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		if err := acomm.ServeStream(w, r, os.Stdin); err != nil {
+			c.streamErrs <- err
+		}
+	})
+
+	runErr := make(chan error)
+	running := time.NewTimer(time.Second)
+	go func() {
+		if err := http.ListenAndServe(c.httpAddr, nil); err != nil {
+			runErr <- err
+		}
+	}()
+
+	select {
+	case <-running.C:
+		return nil
+	case err := <-runErr:
+		return err
+	}
+}
+
+func hookHandler(responses chan *acomm.Response) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			responses <- &acomm.Response{Error: err}
+			return
+		}
+
+		resp := &acomm.Response{}
+		if err := json.Unmarshal(body, resp); err != nil {
+			responses <- &acomm.Response{Error: err}
+			return
+		}
+
+		ack, _ := json.Marshal(&acomm.Response{})
+		_, _ = w.Write(ack)
+
+		deliver(responses, resp)
+	}
+}
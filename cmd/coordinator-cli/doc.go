@@ -3,12 +3,34 @@ Usage
 
 	$ ./coordinator-cli -h
 	Usage of ./coordinator-cli:
+	    --callback                 receive responses with an http server at http_addr instead of on the request connection
 	-c, --coordinator_url string   url of the coordinator
-	-r, --http_addr string         address for http server to listen for responses and stream request data (default ":4080")
+	-d, --describe                 describe the task and its args instead of running it
+	-r, --http_addr string         address for http server to listen for callback responses and stream request data (default ":4080")
 	-j, --json_args                read a json args object form STDIN
+	-l, --list                     list the available tasks
 	-a, --request_arg value        task specific argument the form 'key=value'. can be set multiple times (default [])
 	-s, --stream                   stream data from STDIN to provider
+	    --target_bundle uint       id of a bundle whose node to run the task on
+	    --target_dataset string    id of a dataset whose node to run the task on
+	    --target_node string       id of the node to run the task on, resolved by the coordinator instead of a task_url
 	-t, --task string              task to run
 	-u, --task_url string          url of the task handler if different than coordinator
+	    --tls_ca_file string       path to ca certificate for verifying the coordinator
+	    --tls_cert_file string     path to client certificate to present to the coordinator
+	    --tls_key_file string      path to key for the client certificate
+
+Responses, including progress, are received on the connection the request is
+sent on, so the coordinator doesn't need to be able to reach the cli. With
+--callback, responses are instead sent to an http server listening on
+http_addr, which is also used to serve request stream data.
+
+A task can be run on a particular node of the cluster with one of the target
+flags, naming the node, or a bundle or dataset on it. The cluster coordinator
+resolves the node and routes the request to the coordinator on it.
+
+Args are typed and validated using the task's schema, when the coordinator has
+one, before the request is sent. Nested args are set with dotted keys, such as
+'bundle.id=1', and array values are separated by commas.
 */
 package main
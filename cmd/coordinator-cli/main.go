@@ -2,19 +2,15 @@ package main
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"net/http"
-	"net/url"
 	"os"
-	"strconv"
+	"os/signal"
 	"strings"
-	"time"
+	"syscall"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/jsonschema"
 	"github.com/cerana/cerana/pkg/logrusx"
 	flags "github.com/spf13/pflag"
 )
@@ -26,40 +22,124 @@ const (
 func main() {
 	logrus.SetLevel(logrus.FatalLevel)
 
-	var coordinator, taskURL, httpAddr, taskName string
+	var coordinator, taskURL, httpAddr, taskName, tlsCAFile, tlsCertFile, tlsKeyFile string
+	var target acomm.Target
 	var taskArgs []string
-	var streamRequest, jsonArgs bool
+	var streamRequest, jsonArgs, list, describe, callback bool
 	flags.StringVarP(&coordinator, "coordinator_url", "c", "", "url of the coordinator")
 	flags.StringVarP(&taskURL, "task_url", "u", "", "url of the task handler if different than coordinator")
+	flags.StringVar(&target.Node, "target_node", "", "id of the node to run the task on, resolved by the coordinator instead of a task_url")
+	flags.Uint64Var(&target.Bundle, "target_bundle", 0, "id of a bundle whose node to run the task on")
+	flags.StringVar(&target.Dataset, "target_dataset", "", "id of a dataset whose node to run the task on")
 	flags.StringVarP(&taskName, "task", "t", "", "task to run")
 	flags.StringSliceVarP(&taskArgs, "request_arg", "a", []string{}, fmt.Sprintf("task specific argument the form 'key%svalue'. can be set multiple times", argSep))
-	flags.StringVarP(&httpAddr, "http_addr", "r", ":4080", "address for http server to listen for responses and stream request data")
+	flags.StringVarP(&httpAddr, "http_addr", "r", ":4080", "address for http server to listen for callback responses and stream request data")
+	flags.BoolVar(&callback, "callback", false, "receive responses with an http server at http_addr instead of on the request connection")
 	flags.BoolVarP(&streamRequest, "stream", "s", false, "stream data from STDIN to provider")
 	flags.BoolVarP(&jsonArgs, "json_args", "j", false, "read a json args object form STDIN")
+	flags.BoolVarP(&list, "list", "l", false, "list the available tasks")
+	flags.BoolVarP(&describe, "describe", "d", false, "describe the task and its args instead of running it")
+	flags.StringVar(&tlsCAFile, "tls_ca_file", "", "path to ca certificate for verifying the coordinator")
+	flags.StringVar(&tlsCertFile, "tls_cert_file", "", "path to client certificate to present to the coordinator")
+	flags.StringVar(&tlsKeyFile, "tls_key_file", "", "path to key for the client certificate")
 	flags.Parse()
 
+	if tlsCAFile != "" || tlsCertFile != "" || tlsKeyFile != "" {
+		tlsConfig, err := acomm.LoadTLSConfig(tlsCAFile, tlsCertFile, tlsKeyFile)
+		logrusx.DieOnError(err, "load tls config")
+		acomm.SetTLSConfig(tlsConfig)
+	}
+
+	c, err := newClient(coordinator, httpAddr, callback)
+	logrusx.DieOnError(err, "create client")
+
+	// The provider retrieves request stream data from the http server
+	if callback || streamRequest {
+		logrusx.DieOnError(c.startHTTPServer(), "start http server")
+	}
+
+	if list {
+		tasks, err := listTasks(c, taskURL)
+		logrusx.DieOnError(err, "list tasks")
+		logrusx.DieOnError(printTaskList(os.Stdout, tasks), "print tasks")
+		return
+	}
+
+	// Tasks may not have a schema, so args are only checked when one is
+	// available
+	schema, err := describeTask(c, taskURL, taskName)
+	if describe {
+		logrusx.DieOnError(err, "describe task")
+		logrusx.DieOnError(printTaskHelp(os.Stdout, schema), "print task")
+		return
+	}
+	var argsSchema *jsonschema.Schema
+	if err == nil {
+		argsSchema = schema.Args
+	}
+
 	var args map[string]interface{}
-	var err error
 	if jsonArgs {
 		args, err = parseJSONArgs()
 	} else {
-		args, err = parseTaskArgs(taskArgs)
+		args, err = parseTaskArgs(taskArgs, argsSchema)
 	}
 	logrusx.DieOnError(err, "parse args")
+	logrusx.DieOnError(validateArgs(args, argsSchema), "validate args")
 
-	result, streamResult, respErr, err := startHTTPServer(httpAddr)
-	logrusx.DieOnError(err, "start http server")
+	// Cancel the request on interrupt and wait for the cancelled response
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	logrusx.DieOnError(makeRequest(coordinator, taskName, httpAddr, taskURL, streamRequest, args), "make request")
+	var reqTarget *acomm.Target
+	if target != (acomm.Target{}) {
+		reqTarget = &target
+	}
+	req, responses, err := makeRequest(c, taskName, taskURL, reqTarget, streamRequest, args)
+	logrusx.DieOnError(err, "make request")
+
+	// Progress is redrawn in place on stderr to keep stdout clean
+	var progressShown bool
+	endProgress := func() {
+		if progressShown {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
 
-	select {
-	case err := <-respErr:
-		logrusx.DieOnError(err, "response error")
-	case result := <-result:
-		j, _ := json.Marshal(result)
-		fmt.Println(string(j))
-	case streamResult := <-streamResult:
-		logrusx.DieOnError(acomm.Stream(os.Stdout, streamResult), "stream result")
+	var cancelResponses <-chan *acomm.Response
+	for {
+		select {
+		case <-sigChan:
+			cancelResponses, err = cancelRequest(c, req.ID)
+			logrusx.DieOnError(err, "cancel request")
+			signal.Stop(sigChan)
+			continue
+		case err := <-c.streamErrs:
+			endProgress()
+			logrusx.DieOnError(err, "stream request data")
+		case resp := <-cancelResponses:
+			if resp.Error != nil {
+				endProgress()
+				logrusx.DieOnError(resp.Error, "cancel request")
+			}
+			continue
+		case resp := <-responses:
+			if resp.IsProgress() {
+				fmt.Fprintf(os.Stderr, "\r\033[K%s", resp.Progress)
+				progressShown = true
+				continue
+			}
+
+			endProgress()
+			logrusx.DieOnError(resp.Error, "response error")
+			if resp.StreamURL != nil {
+				logrusx.DieOnError(acomm.Stream(os.Stdout, resp.StreamURL), "stream result")
+			} else {
+				j, _ := json.Marshal(resp.Result)
+				fmt.Println(string(j))
+			}
+		}
+		return
 	}
 }
 
@@ -93,7 +173,7 @@ func (am argmap) set(keys []string, value interface{}) error {
 	return m.set(keys[1:], value)
 }
 
-func parseTaskArgs(taskArgs []string) (map[string]interface{}, error) {
+func parseTaskArgs(taskArgs []string, schema *jsonschema.Schema) (map[string]interface{}, error) {
 	out := make(argmap)
 	for _, in := range taskArgs {
 		parts := strings.Split(in, argSep)
@@ -101,17 +181,12 @@ func parseTaskArgs(taskArgs []string) (map[string]interface{}, error) {
 			return nil, fmt.Errorf("invalid request arg: '%s'", in)
 		}
 
-		valueS := strings.Join(parts[1:], argSep)
-		var value interface{}
-		if arg, err := strconv.ParseInt(valueS, 10, 64); err == nil {
-			value = arg
-		} else if arg, err := strconv.ParseBool(valueS); err == nil {
-			value = arg
-		} else {
-			value = valueS
+		keys := strings.Split(parts[0], ".")
+		value, err := typedArg(strings.Join(parts[1:], argSep), argSchema(schema, keys))
+		if err != nil {
+			return nil, fmt.Errorf("invalid request arg: '%s': %s", in, err)
 		}
 
-		keys := strings.Split(parts[0], ".")
 		if err := out.set(keys, value); err != nil {
 			return nil, err
 		}
@@ -130,83 +205,42 @@ func parseJSONArgs() (map[string]interface{}, error) {
 	return out, nil
 }
 
-func startHTTPServer(addr string) (chan interface{}, chan *url.URL, chan error, error) {
-	result := make(chan interface{}, 1)
-	errChan := make(chan error, 1)
-	stream := make(chan *url.URL, 1)
-
-	http.HandleFunc("/response", func(w http.ResponseWriter, r *http.Request) {
-		body, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			errChan <- err
-			return
-		}
-
-		resp := &acomm.Response{}
-		if err := json.Unmarshal(body, resp); err != nil {
-			errChan <- err
-			return
-		}
-
-		ack, _ := json.Marshal(&acomm.Response{})
-		_, _ = w.Write(ack)
-
-		if resp.Error != nil {
-			errChan <- resp.Error
-			return
-		}
-
-		if resp.StreamURL != nil {
-			stream <- resp.StreamURL
-		} else {
-			result <- resp.Result
-		}
-	})
-	http.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
-		if _, err := io.Copy(w, os.Stdin); err != nil {
-			errChan <- err
-			return
-		}
-	})
-
-	runErr := make(chan error)
-	running := time.NewTimer(time.Second)
-	go func() {
-		if err := http.ListenAndServe(addr, nil); err != nil {
-			runErr <- err
-		}
-	}()
-
-	var err error
-	select {
-	case <-running.C:
-	case err = <-runErr:
+func validateArgs(args map[string]interface{}, schema *jsonschema.Schema) error {
+	if schema == nil {
+		return nil
 	}
-
-	return result, stream, errChan, err
-}
-
-func makeRequest(coordinator, taskName, httpAddr, taskURL string, stream bool, taskArgs map[string]interface{}) error {
-	coordinatorURL, err := url.ParseRequestURI(coordinator)
+	data, err := json.Marshal(args)
 	if err != nil {
-		return errors.New("invalid coordinator url")
+		return err
 	}
+	return schema.Validate(data)
+}
 
-	responseHook := fmt.Sprintf("http://%s/response", httpAddr)
+func makeRequest(c *client, taskName, taskURL string, target *acomm.Target, stream bool, taskArgs map[string]interface{}) (*acomm.Request, <-chan *acomm.Response, error) {
 	streamURL := ""
 	if stream {
-		streamURL = fmt.Sprintf("http://%s/stream", httpAddr)
+		streamURL = fmt.Sprintf("http://%s/stream", c.httpAddr)
 	}
 	req, err := acomm.NewRequest(acomm.RequestOptions{
-		Task:               taskName,
-		ResponseHookString: responseHook,
-		StreamURLString:    streamURL,
-		Args:               taskArgs,
-		TaskURLString:      taskURL,
+		Task:            taskName,
+		StreamURLString: streamURL,
+		Args:            taskArgs,
+		TaskURLString:   taskURL,
+		Target:          target,
 	})
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	responses, err := c.send(req, hookResponse)
+	return req, responses, err
+}
+
+func cancelRequest(c *client, requestID string) (<-chan *acomm.Response, error) {
+	req, err := acomm.NewCancelRequest(requestID, acomm.RequestOptions{})
+	if err != nil {
+		return nil, err
 	}
 
-	return acomm.Send(coordinatorURL, req)
+	return c.send(req, hookCancel)
 }
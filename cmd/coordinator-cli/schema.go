@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/jsonschema"
+)
+
+// describeTimeout is how long to wait for task descriptions.
+const describeTimeout = 10 * time.Second
+
+// requestDescription makes a list-tasks or describe-task request and waits
+// for the result.
+func requestDescription(c *client, taskURL, task string, args interface{}, result interface{}) error {
+	req, err := acomm.NewRequest(acomm.RequestOptions{
+		Task:          task,
+		Args:          args,
+		TaskURLString: taskURL,
+	})
+	if err != nil {
+		return err
+	}
+	responses, err := c.send(req, hookDescribe)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-responses:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		return resp.UnmarshalResult(result)
+	case <-time.After(describeTimeout):
+		return errors.New("timed out waiting for task description")
+	}
+}
+
+func listTasks(c *client, taskURL string) ([]*acomm.TaskSchema, error) {
+	result := &acomm.ListTasksResult{}
+	err := requestDescription(c, taskURL, acomm.ListTasksTask, nil, result)
+	return result.Tasks, err
+}
+
+func describeTask(c *client, taskURL, taskName string) (*acomm.TaskSchema, error) {
+	result := &acomm.TaskSchema{}
+	args := &acomm.DescribeTaskArgs{Task: taskName}
+	if err := requestDescription(c, taskURL, acomm.DescribeTaskTask, args, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func printTaskList(w io.Writer, tasks []*acomm.TaskSchema) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, task := range tasks {
+		fmt.Fprintf(tw, "%s\t%s\n", task.Task, task.Description)
+	}
+	return tw.Flush()
+}
+
+func printTaskHelp(w io.Writer, task *acomm.TaskSchema) error {
+	fmt.Fprintln(w, task.Task)
+	if task.Description != "" {
+		fmt.Fprintf(w, "  %s\n", task.Description)
+	}
+	if len(task.Providers) > 0 {
+		fmt.Fprintf(w, "\nProviders: %s\n", strings.Join(task.Providers, ", "))
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	if task.Args != nil {
+		fmt.Fprintln(tw, "\nArgs:")
+		printSchemaFields(tw, "", task.Args)
+	}
+	if task.Result != nil {
+		fmt.Fprintln(tw, "\nResult:")
+		printSchemaFields(tw, "", task.Result)
+	}
+	return tw.Flush()
+}
+
+// printSchemaFields prints a line per field of an object schema, with nested
+// object fields named in the key.subkey form used for request args.
+func printSchemaFields(w io.Writer, prefix string, schema *jsonschema.Schema) {
+	if schema.Type != jsonschema.TypeObject || len(schema.Properties) == 0 {
+		fmt.Fprintf(w, "  %s\t%s\n", strings.TrimSuffix(prefix, "."), schemaTypeName(schema))
+		return
+	}
+
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		printSchemaFields(w, prefix+name+".", schema.Properties[name])
+	}
+}
+
+func schemaTypeName(schema *jsonschema.Schema) string {
+	if schema == nil || schema.Type == "" {
+		return "any"
+	}
+
+	name := schema.Type
+	switch {
+	case schema.Type == jsonschema.TypeArray:
+		name = "array of " + schemaTypeName(schema.Items)
+	case schema.Type == jsonschema.TypeObject && schema.AdditionalProperties != nil:
+		name = "map of " + schemaTypeName(schema.AdditionalProperties)
+	case schema.Format != "":
+		name += " (" + schema.Format + ")"
+	}
+	if schema.Description != "" {
+		name += ", " + schema.Description
+	}
+	return name
+}
+
+// typedArg converts a 'key=value' arg value to the type given by its schema.
+// Values without a schema are converted by guessing the type.
+func typedArg(value string, schema *jsonschema.Schema) (interface{}, error) {
+	if schema == nil {
+		return guessArg(value), nil
+	}
+
+	switch schema.Type {
+	case jsonschema.TypeString:
+		return value, nil
+	case jsonschema.TypeInteger:
+		return strconv.ParseInt(value, 10, 64)
+	case jsonschema.TypeNumber:
+		return strconv.ParseFloat(value, 64)
+	case jsonschema.TypeBoolean:
+		return strconv.ParseBool(value)
+	case jsonschema.TypeArray:
+		values := strings.Split(value, ",")
+		out := make([]interface{}, len(values))
+		for i, v := range values {
+			arg, err := typedArg(v, schema.Items)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = arg
+		}
+		return out, nil
+	default:
+		return guessArg(value), nil
+	}
+}
+
+func guessArg(value string) interface{} {
+	if arg, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return arg
+	}
+	if arg, err := strconv.ParseBool(value); err == nil {
+		return arg
+	}
+	return value
+}
+
+// argSchema returns the schema of a nested arg key, or nil if it is unknown.
+func argSchema(schema *jsonschema.Schema, keys []string) *jsonschema.Schema {
+	for _, key := range keys {
+		if schema == nil {
+			return nil
+		}
+		prop := schema.Property(key)
+		if prop == nil {
+			prop = schema.AdditionalProperties
+		}
+		schema = prop
+	}
+	return schema
+}
@@ -3,11 +3,19 @@ Usage
 
 	$ coordinator -h
 	Usage of coordinator:
+	    --codec="json": codec for messages sent over unix sockets: json/cbor/msgpack
 	-c, --config_file="": path to config file
 	-p, --external_port=8080: port for the http external request server to listen
+	    --journal_file="": path to journal of in-flight requests, recovered after a restart (disabled if empty)
 	-l, --log_level="warning": log level: debug/info/warn/error/fatal/panic
+	    --max_message_size=0: maximum size in bytes of messages read from unix sockets (0 for the default)
+	    --policy_file="": path to task authorization policy file
 	-t, --request_timeout=0: default timeout for requests in seconds
 	-n, --service_name="": name of the coordinator
 	-s, --socket_dir="/tmp/cerana": base directory in which to create task sockets
+	    --tls_ca_file="": path to ca certificate for verifying client and server certificates
+	    --tls_cert_file="": path to certificate for the external server and outgoing requests
+	    --tls_key_file="": path to key for the tls certificate
+	    --trace_export="": file path or OTLP/HTTP collector url to export traces to (disabled if empty)
 */
 package main
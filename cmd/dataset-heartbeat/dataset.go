@@ -2,7 +2,6 @@ package main
 
 import (
 	"net"
-	"net/url"
 	"path/filepath"
 
 	"github.com/cerana/cerana/acomm"
@@ -10,6 +9,7 @@ import (
 	"github.com/cerana/cerana/providers/clusterconf"
 	"github.com/cerana/cerana/providers/zfs"
 	"github.com/cerana/cerana/tick"
+	"golang.org/x/net/context"
 )
 
 func datasetHeartbeats(config tick.Configer, tracker *acomm.Tracker) error {
@@ -32,49 +32,22 @@ func datasetHeartbeats(config tick.Configer, tracker *acomm.Tracker) error {
 }
 
 func getDatasets(config *Config, tracker *acomm.Tracker, ip net.IP) ([]clusterconf.DatasetHeartbeatArgs, error) {
-	requests := map[string]struct {
-		task        string
-		coordinator *url.URL
-		args        interface{}
-		respData    interface{}
-	}{
-		"datasets":  {task: "zfs-list", coordinator: config.NodeDataURL(), args: zfs.ListArgs{Name: config.DatasetPrefix()}, respData: &zfs.ListResult{}},
-		"bundles":   {task: "list-bundles", coordinator: config.ClusterDataURL(), respData: &clusterconf.BundleListResult{}},
-		"bundleHBs": {task: "list-bundle-heartbeats", coordinator: config.ClusterDataURL(), respData: &clusterconf.BundleHeartbeatList{}},
-	}
+	ctx := context.Background()
+	nodeData := zfs.NewClient(acomm.NewClient(tracker, config.NodeDataURL(), config.RequestTimeout()))
+	clusterData := clusterconf.NewClient(acomm.NewClient(tracker, config.ClusterDataURL(), config.RequestTimeout()))
 
-	multiRequest := acomm.NewMultiRequest(tracker, config.RequestTimeout())
-	for name, args := range requests {
-		req, err := acomm.NewRequest(acomm.RequestOptions{
-			Task: args.task,
-			Args: args.args,
-		})
-		if err != nil {
-			return nil, err
-		}
-		if err := multiRequest.AddRequest(name, req); err != nil {
-			return nil, err
-		}
-		if err := acomm.Send(args.coordinator, req); err != nil {
-			multiRequest.RemoveRequest(req)
-			return nil, err
-		}
+	listResult, err := nodeData.List(ctx, nil, zfs.ListArgs{Name: config.DatasetPrefix()})
+	if err != nil {
+		return nil, errors.ResetStack(err)
 	}
-
-	responses := multiRequest.Responses()
-	for name, args := range requests {
-		resp := responses[name]
-		if resp.Error != nil {
-			return nil, errors.ResetStack(resp.Error)
-		}
-		if err := resp.UnmarshalResult(args.respData); err != nil {
-			return nil, err
-		}
+	bundles, err := clusterData.ListBundles(ctx, false)
+	if err != nil {
+		return nil, errors.ResetStack(err)
+	}
+	heartbeats, err := clusterData.ListBundleHeartbeats(ctx)
+	if err != nil {
+		return nil, errors.ResetStack(err)
 	}
-
-	listResult := requests["datasets"].respData.(*zfs.ListResult).Datasets
-	bundles := requests["bundles"].respData.(*clusterconf.BundleListResult).Bundles
-	heartbeats := requests["bundleHBs"].respData.(*clusterconf.BundleHeartbeatList).Heartbeats
 
 	// determine which datasets are configured to be in use on this node
 	datasetsInUse := make(map[string]bool)
@@ -109,38 +82,22 @@ func getDatasets(config *Config, tracker *acomm.Tracker, ip net.IP) ([]clusterco
 }
 
 func sendDatasetHeartbeats(config *Config, tracker *acomm.Tracker, datasetArgs []clusterconf.DatasetHeartbeatArgs, ip net.IP) error {
-	var errored bool
-	multiRequest := acomm.NewMultiRequest(tracker, config.RequestTimeout())
-	for _, dataset := range datasetArgs {
+	clusterData := clusterconf.NewClient(acomm.NewClient(tracker, config.ClusterDataURL(), config.RequestTimeout()))
+
+	// The heartbeats are sent in a single batch
+	heartbeats := make([]clusterconf.DatasetHeartbeatArgs, len(datasetArgs))
+	for i, dataset := range datasetArgs {
 		dataset.IP = ip
-		req, err := acomm.NewRequest(acomm.RequestOptions{
-			Task: "dataset-heartbeat",
-			Args: dataset,
-		})
-		if err != nil {
-			errored = true
-			continue
-		}
-		if err := multiRequest.AddRequest(dataset.ID, req); err != nil {
-			errored = true
-			continue
-		}
-		if err := acomm.Send(config.ClusterDataURL(), req); err != nil {
-			multiRequest.RemoveRequest(req)
-			errored = true
-			continue
-		}
-	}
-	responses := multiRequest.Responses()
-	for _, resp := range responses {
-		if resp.Error != nil {
-			errored = true
-			break
-		}
+		heartbeats[i] = dataset
 	}
 
-	if errored {
-		return errors.New("one or more dataset heartbeats unsuccessful")
+	errs := clusterData.SendDatasetHeartbeats(context.Background(), heartbeats)
+	if len(errs) > 0 {
+		errored := make([]string, 0, len(errs))
+		for id := range errs {
+			errored = append(errored, id)
+		}
+		return errors.Newv("one or more dataset heartbeats unsuccessful", map[string]interface{}{"errors": errored})
 	}
 	return nil
 }
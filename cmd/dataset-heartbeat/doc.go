@@ -7,9 +7,13 @@ Usage:
 	-a, --datasetPrefix string         dataset directory
 	-l, --logLevel string              log level: debug/info/warn/error/fatal/panic (default "warning")
 	-n, --nodeDataURL string           url of coordinator for node information retrieval
+	    --requestRetries int           times to retry requests that fail with temporary errors (default 2)
 	-r, --requestTimeout duration      default timeout for external requests made
 	-t, --tickInterval duration        tick run frequency
 	-i, --tickRetryInterval duration   tick retry on error frequency
+	    --tlsCAFile string             path to ca certificate for verifying coordinators
+	    --tlsCertFile string           path to client certificate to present to coordinators
+	    --tlsKeyFile string            path to key for the client certificate
 	Note: Long flag names can be specified in either fooBar or foo[_-.]bar form.
 */
 package main
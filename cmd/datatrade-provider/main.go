@@ -12,7 +12,6 @@ func main() {
 	logrus.SetFormatter(&logrusx.JSONFormatter{})
 
 	config := datatrade.NewConfig(nil, nil)
-	flag.UintP("node_coordinator_port", "o", 0, "node coordinator external port")
 	flag.StringP("dataset_dir", "d", "/data/datasets", "node directory for dataset storage")
 	flag.Parse()
 
@@ -26,6 +25,11 @@ func main() {
 
 	if len(server.RegisteredTasks()) != 0 {
 		logrusx.DieOnError(server.Start(), "start server")
+		go func() {
+			if err := d.ResumeWorkflows(); err != nil {
+				logrus.WithField("error", err).Error("failed to resume workflows")
+			}
+		}()
 		server.StopOnSignal()
 	} else {
 		logrus.Warn("no registered tasks, exiting")
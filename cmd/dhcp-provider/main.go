@@ -53,7 +53,7 @@ func comm(tracker *acomm.Tracker, coordinator *url.URL, task string, args interf
 
 func getDHCPConfig(tracker *acomm.Tracker, coordinator *url.URL) (*clusterconf.DHCPConfig, error) {
 	dconf := &clusterconf.DHCPConfig{}
-	return dconf, comm(tracker, coordinator, "get-dhcp-config", nil, dconf)
+	return dconf, comm(tracker, coordinator, clusterconf.TaskGetDHCP, nil, dconf)
 }
 
 func joinDNS(dns []net.IP) string {
@@ -10,6 +10,7 @@ import (
 	"github.com/cerana/cerana/providers/metrics"
 	"github.com/cerana/cerana/tick"
 	"github.com/shirou/gopsutil/disk"
+	"golang.org/x/net/context"
 )
 
 func nodeHeartbeat(config tick.Configer, tracker *acomm.Tracker) error {
@@ -26,45 +27,24 @@ func nodeHeartbeat(config tick.Configer, tracker *acomm.Tracker) error {
 }
 
 func getNodeInfo(config tick.Configer, tracker *acomm.Tracker, ip net.IP) (*clusterconf.Node, error) {
-	var err error
-	tasks := map[string]interface{}{
-		"metrics-cpu":    &metrics.CPUResult{},
-		"metrics-disk":   &metrics.DiskResult{},
-		"metrics-memory": &metrics.MemoryResult{},
-	}
-	requests := make(map[string]*acomm.Request)
-	for task := range tasks {
-		requests[task], err = acomm.NewRequest(acomm.RequestOptions{Task: task})
-		if err != nil {
-			return nil, err
-		}
-	}
+	ctx := context.Background()
+	nodeData := metrics.NewClient(acomm.NewClient(tracker, config.NodeDataURL(), config.RequestTimeout()))
 
-	multiRequest := acomm.NewMultiRequest(tracker, config.RequestTimeout())
-	for name, req := range requests {
-		if err := multiRequest.AddRequest(name, req); err != nil {
-			return nil, err
-		}
-		if err := acomm.Send(config.NodeDataURL(), req); err != nil {
-			multiRequest.RemoveRequest(req)
-			return nil, err
-		}
+	cpu, err := nodeData.CPU(ctx, nil)
+	if err != nil {
+		return nil, errors.ResetStack(err)
 	}
-
-	responses := multiRequest.Responses()
-	for name := range requests {
-		resp := responses[name]
-		if resp.Error != nil {
-			return nil, errors.Wrapv(errors.ResetStack(resp.Error), map[string]interface{}{"task": name})
-		}
-		if err := resp.UnmarshalResult(tasks[name]); err != nil {
-			return nil, err
-		}
+	diskResult, err := nodeData.Disk(ctx, nil)
+	if err != nil {
+		return nil, errors.ResetStack(err)
+	}
+	memory, err := nodeData.Memory(ctx, nil)
+	if err != nil {
+		return nil, errors.ResetStack(err)
 	}
 
-	usages := tasks["metrics-disk"].(*metrics.DiskResult).Usage
 	var usage *disk.UsageStat
-	for _, u := range usages {
+	for _, u := range diskResult.Usage {
 		if u.Path == "/" {
 			usage = u
 			break
@@ -77,23 +57,16 @@ func getNodeInfo(config tick.Configer, tracker *acomm.Tracker, ip net.IP) (*clus
 	return &clusterconf.Node{
 		ID:          ip.String(),
 		Heartbeat:   time.Now(),
-		MemoryTotal: tasks["metrics-memory"].(*metrics.MemoryResult).Virtual.Total,
-		MemoryFree:  tasks["metrics-memory"].(*metrics.MemoryResult).Virtual.Available,
-		CPUCores:    len(tasks["metrics-cpu"].(*metrics.CPUResult).Info),
-		CPULoad:     tasks["metrics-cpu"].(*metrics.CPUResult).Load,
+		MemoryTotal: memory.Virtual.Total,
+		MemoryFree:  memory.Virtual.Available,
+		CPUCores:    len(cpu.Info),
+		CPULoad:     cpu.Load,
 		DiskTotal:   usage.Total,
 		DiskFree:    usage.Free,
 	}, nil
 }
 
 func sendNodeHeartbeat(config tick.Configer, tracker *acomm.Tracker, data *clusterconf.Node) error {
-	opts := acomm.RequestOptions{
-		Task: "node-heartbeat",
-		Args: &clusterconf.NodePayload{Node: data},
-	}
-	resp, err := tracker.SyncRequest(config.ClusterDataURL(), opts, config.RequestTimeout())
-	if err != nil {
-		return err
-	}
-	return errors.ResetStack(resp.Error)
+	clusterData := clusterconf.NewClient(acomm.NewClient(tracker, config.ClusterDataURL(), config.RequestTimeout()))
+	return errors.ResetStack(clusterData.NodeHeartbeat(context.Background(), data))
 }
@@ -3,12 +3,17 @@ Usage
 
 	$ service-provider -h
 	Usage of service-provider:
+	    --codec string             codec for messages sent over unix sockets: json/cbor/msgpack (default "json")
 	-c, --config_file string       path to config file
 	-u, --coordinator_url string   url of coordinator for making requests
 	-p, --default_priority uint    default task priority (default 50)
+	    --idempotency_ttl uint     seconds to remember responses to requests with idempotency keys (default 60)
 	-l, --log_level string         log level: debug/info/warn/error/fatal/panic (default "warning")
+	    --max_message_size uint32  maximum size in bytes of messages read from unix sockets (0 for the default)
+	    --request_retries uint     times to retry requests made by this provider that fail with temporary errors
 	-t, --request_timeout uint     default timeout for requests made by this provider in seconds
 	-n, --service_name string      provider service name
 	-s, --socket_dir string        base directory in which to create task sockets (default "/tmp/cerana")
+	    --trace_export string      file path or OTLP/HTTP collector url to export traces to (disabled if empty)
 */
 package main
@@ -26,6 +26,11 @@ func main() {
 
 	if len(server.RegisteredTasks()) != 0 {
 		logrusx.DieOnError(server.Start(), "start server")
+		go func() {
+			if err := s.ResumeWorkflows(); err != nil {
+				logrus.WithField("error", err).Error("failed to resume workflows")
+			}
+		}()
 		server.StopOnSignal()
 	} else {
 		logrus.Warn("no registered tasks, exiting")
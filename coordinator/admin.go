@@ -0,0 +1,365 @@
+package coordinator
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/prometheusx"
+	"github.com/pborman/uuid"
+)
+
+// StatusTask is the task handled by a coordinator itself, responding with its
+// Status.
+const StatusTask = "coordinator-status"
+
+// ExpireRequestTask is the task handled by a coordinator itself to force a
+// request it is tracking to time out.
+const ExpireRequestTask = "coordinator-expire-request"
+
+// ReloadConfigTask is the task handled by a coordinator itself to reload its
+// config, responding with a configutil.ReloadResult.
+const ReloadConfigTask = "coordinator-reload-config"
+
+// CancelAnyTask is the task a caller must be permitted by the policy to cancel
+// requests made by other callers. It is not handled by the coordinator.
+const CancelAnyTask = "coordinator-cancel-any"
+
+// ProxyResponseTask is the task a caller must be permitted by the policy to
+// send responses to the external /proxy endpoint, as other coordinators do.
+// It is not handled by the coordinator.
+const ProxyResponseTask = "coordinator-proxy-response"
+
+// StreamTask is the task a caller must be permitted by the policy to read data
+// streams from the external /stream endpoint. It is not handled by the
+// coordinator.
+const StreamTask = "coordinator-stream"
+
+// MetricsTask is the task a caller must be permitted by the policy to scrape
+// the external /metrics endpoint. It is not handled by the coordinator.
+const MetricsTask = "coordinator-metrics"
+
+// Status is the state of a coordinator, for introspection. Tasks include those
+// with providers and those requested since the coordinator started. Drain is
+// only set while the coordinator is draining.
+type Status struct {
+	Requests []*acomm.TrackedRequest `json:"requests"`
+	Tasks    []*TaskStatus           `json:"tasks"`
+	Streams  []*acomm.TrackedStream  `json:"streams"`
+	Drain    *DrainStatus            `json:"drain,omitempty"`
+}
+
+// DrainStatus is the state of a coordinator draining before it stops. New
+// requests are rejected while those in flight are given until the deadline to
+// finish.
+type DrainStatus struct {
+	Since    time.Time `json:"since"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// TaskStatus is the state of the providers of a task and the counts of the
+// requests for it.
+type TaskStatus struct {
+	Task      string            `json:"task"`
+	Providers []*ProviderStatus `json:"providers"`
+	Counters  TaskCounters      `json:"counters"`
+}
+
+// ProviderStatus is the state of a provider socket of a task. The requests in
+// flight and consecutive timeouts are only known for tasks whose balancing
+// tracks requests. A quarantined socket refuses connections and is skipped.
+type ProviderStatus struct {
+	Socket           string     `json:"socket"`
+	InFlight         int        `json:"inFlight"`
+	Timeouts         uint       `json:"timeouts"`
+	EjectedUntil     *time.Time `json:"ejectedUntil,omitempty"`
+	QuarantinedSince *time.Time `json:"quarantinedSince,omitempty"`
+}
+
+// TaskCounters are counts of the requests for a task. Requests for tasks
+// without providers are counted under the "unknown" task. Rejected requests
+// failed to be routed. Responses are only counted for requests whose
+// responses come back through the coordinator.
+type TaskCounters struct {
+	Requests  uint64 `json:"requests"`
+	Rejected  uint64 `json:"rejected"`
+	Succeeded uint64 `json:"succeeded"`
+	Failed    uint64 `json:"failed"`
+	TimedOut  uint64 `json:"timedOut"`
+}
+
+// ExpireRequestArgs are arguments for an ExpireRequestTask request.
+type ExpireRequestArgs struct {
+	RequestID string `json:"requestID"`
+}
+
+// adminTask handles the coordinator's status, expire-request, and
+// reload-config tasks. The response is sent after the request has been
+// acknowledged.
+func (s *Server) adminTask(req *acomm.Request) error {
+	var result interface{}
+	switch req.Task {
+	case StatusTask:
+		status, err := s.status()
+		if err != nil {
+			return err
+		}
+		result = status
+	case ReloadConfigTask:
+		reloadResult, err := s.Reload()
+		if err != nil {
+			return err
+		}
+		result = reloadResult
+	default:
+		args := &ExpireRequestArgs{}
+		if err := req.UnmarshalArgs(args); err != nil {
+			return err
+		}
+		if err := s.expireRequest(args.RequestID); err != nil {
+			return err
+		}
+	}
+
+	resp, err := acomm.NewResponse(req, result, nil, nil)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := req.Respond(resp); err != nil {
+			err = errors.Wrapv(err, map[string]interface{}{"request": req})
+			logrus.WithField("error", err).Error("failed to send admin task response")
+		}
+	}()
+	return nil
+}
+
+// adminStatusHandler is an HTTP HandlerFunc responding with the Status.
+func (s *Server) adminStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeAdmin(w, r, StatusTask) {
+		return
+	}
+
+	status, err := s.status()
+	if err != nil {
+		logrus.WithField("error", err).Error("failed to get status")
+		http.Error(w, "failed to get status", http.StatusInternalServerError)
+		return
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		logrus.WithField("error", errors.Wrap(err)).Error("failed to marshal status")
+		http.Error(w, "failed to get status", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// adminExpireHandler is an HTTP HandlerFunc forcing the request given by the
+// id query parameter to time out.
+func (s *Server) adminExpireHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorizeAdmin(w, r, ExpireRequestTask) {
+		return
+	}
+
+	err := s.expireRequest(r.URL.Query().Get("id"))
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.IsCode(err, errors.CodeNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.IsCode(err, errors.CodeInvalidArgument):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		logrus.WithField("error", err).Error("failed to expire request")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// authorizedHandler wraps an http handler, only calling it if the caller is
+// permitted to request the equivalent task.
+func (s *Server) authorizedHandler(task string, handler http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorizeAdmin(w, r, task) {
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}
+}
+
+// authorizeAdmin checks whether the caller of an http endpoint is permitted
+// to request the equivalent task, writing an error response if not.
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request, task string) bool {
+	if err := s.authorize(&acomm.Request{ID: uuid.New(), Task: task}, httpIdentity(r)); err != nil {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// expireRequest forces a tracked request to time out.
+func (s *Server) expireRequest(requestID string) error {
+	if requestID == "" {
+		return errors.NewWithCode(errors.CodeInvalidArgument, "missing requestID", nil)
+	}
+	if !s.proxy.ExpireRequest(requestID) {
+		return errors.NewWithCode(errors.CodeNotFound, "request not tracked", map[string]interface{}{"expireRequestID": requestID})
+	}
+	logrus.WithField("requestID", requestID).Warn("request expired by admin")
+	return nil
+}
+
+// status returns the current state of the coordinator.
+func (s *Server) status() (*Status, error) {
+	tasks, err := s.taskStatuses()
+	if err != nil {
+		return nil, err
+	}
+	return &Status{
+		Requests: s.proxy.Requests(),
+		Tasks:    tasks,
+		Streams:  s.proxy.Streams(),
+		Drain:    s.draining(),
+	}, nil
+}
+
+// taskStatuses returns the status of each task with providers or counted
+// requests, in order of task name.
+func (s *Server) taskStatuses() ([]*TaskStatus, error) {
+	statuses := make(map[string]*TaskStatus)
+
+	socketDir := s.config.SocketDir()
+	dirs, err := ioutil.ReadDir(socketDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapv(err, map[string]interface{}{"socketDir": socketDir})
+	}
+	for _, dir := range dirs {
+		// Skip the coordinator's and providers' own sockets
+		if !dir.IsDir() || dir.Name() == "coordinator" || dir.Name() == "response" {
+			continue
+		}
+		providerSockets, err := s.getProviders(dir.Name())
+		if err != nil {
+			return nil, err
+		}
+		if len(providerSockets) == 0 {
+			continue
+		}
+		status := &TaskStatus{Task: dir.Name()}
+		for _, providerSocket := range providerSockets {
+			providerStatus := s.balancer.providerStatus(providerSocket)
+			providerStatus.QuarantinedSince = s.sockets.quarantinedSince(providerSocket)
+			status.Providers = append(status.Providers, providerStatus)
+		}
+		statuses[status.Task] = status
+	}
+
+	s.countersLock.Lock()
+	for task, counters := range s.counters {
+		status, ok := statuses[task]
+		if !ok {
+			status = &TaskStatus{Task: task, Providers: []*ProviderStatus{}}
+			statuses[task] = status
+		}
+		status.Counters = *counters
+	}
+	s.countersLock.Unlock()
+
+	names := make([]string, 0, len(statuses))
+	for task := range statuses {
+		names = append(names, task)
+	}
+	sort.Strings(names)
+	result := make([]*TaskStatus, len(names))
+	for i, task := range names {
+		result[i] = statuses[task]
+	}
+	return result, nil
+}
+
+// unknownTask is the task that requests for tasks without providers are
+// counted under, so requests for arbitrary task names don't each add metrics
+// series and counters.
+const unknownTask = "unknown"
+
+// countedTask returns the task that requests for a task are counted under: the
+// task if it is a coordinator task or has been routed to providers, and
+// unknownTask otherwise. The lock must be held.
+func (s *Server) countedTask(task string) string {
+	switch task {
+	case acomm.CancelTask, acomm.ListTasksTask, acomm.DescribeTaskTask, StatusTask, ExpireRequestTask, ReloadConfigTask:
+		return task
+	}
+	if s.knownTasks[task] {
+		return task
+	}
+	return unknownTask
+}
+
+// addKnownTask records that a task has providers, so requests for it are
+// counted under the task, without looking for its providers each time.
+func (s *Server) addKnownTask(task string) {
+	s.countersLock.Lock()
+	defer s.countersLock.Unlock()
+
+	if s.knownTasks == nil {
+		s.knownTasks = make(map[string]bool)
+	}
+	s.knownTasks[task] = true
+}
+
+// countRequest counts a request for a task and whether it was routed.
+func (s *Server) countRequest(task string, err error) {
+	s.countersLock.Lock()
+	defer s.countersLock.Unlock()
+
+	task = s.countedTask(task)
+	prometheusx.CoordinatorRequests.WithLabelValues(task, prometheusx.Outcome(err)).Inc()
+
+	counters := s.taskCounters(task)
+	counters.Requests++
+	if err != nil {
+		counters.Rejected++
+	}
+}
+
+// countResponse counts the final response to a request for a task.
+func (s *Server) countResponse(task string, resp *acomm.Response) {
+	s.countersLock.Lock()
+	defer s.countersLock.Unlock()
+
+	task = s.countedTask(task)
+	prometheusx.CoordinatorResponses.WithLabelValues(task, prometheusx.Outcome(resp.Error)).Inc()
+
+	counters := s.taskCounters(task)
+	switch {
+	case resp.Error == nil:
+		counters.Succeeded++
+	case errors.IsCode(resp.Error, errors.CodeTimeout):
+		counters.TimedOut++
+	default:
+		counters.Failed++
+	}
+}
+
+// taskCounters returns the counters of a task, creating them if needed. The
+// lock must be held.
+func (s *Server) taskCounters(task string) *TaskCounters {
+	counters, ok := s.counters[task]
+	if !ok {
+		counters = &TaskCounters{}
+		s.counters[task] = counters
+	}
+	return counters
+}
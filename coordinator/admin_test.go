@@ -0,0 +1,316 @@
+package coordinator_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/coordinator"
+	"github.com/cerana/cerana/pkg/configutil"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/logrusx"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+func TestAdmin(t *testing.T) {
+	suite.Run(t, new(AdminSuite))
+}
+
+type AdminSuite struct {
+	suite.Suite
+	configData     *coordinator.ConfigData
+	configFile     *os.File
+	server         *coordinator.Server
+	tracker        *acomm.Tracker
+	coordinatorURL *url.URL
+	adminURL       string
+	respServer     *httptest.Server
+	responses      chan *acomm.Response
+	taskListener   *acomm.UnixListener
+}
+
+func (s *AdminSuite) SetupSuite() {
+	logrus.SetLevel(logrus.FatalLevel)
+
+	socketDir, err := ioutil.TempDir("", "coordinatorTest-")
+	s.Require().NoError(err, "failed to create socket dir")
+
+	s.configData = &coordinator.ConfigData{
+		SocketDir:      socketDir,
+		ServiceName:    uuid.New(),
+		ExternalPort:   45683,
+		RequestTimeout: 5,
+		LogLevel:       "fatal",
+	}
+	s.adminURL = fmt.Sprintf("http://localhost:%d/admin", s.configData.ExternalPort)
+
+	var config *coordinator.Config
+	config, _, _, s.configFile, err = newConfig(false, true, s.configData)
+	s.Require().NoError(err, "failed to create config")
+	s.Require().NoError(config.LoadConfig(), "failed to load config")
+
+	s.server, err = coordinator.NewServer(config)
+	s.Require().NoError(err, "failed to create server")
+	s.Require().NoError(s.server.Start(), "failed to start server")
+	time.Sleep(time.Second)
+
+	s.coordinatorURL, _ = url.ParseRequestURI("unix://" + filepath.Join(socketDir, "coordinator", s.configData.ServiceName+".sock"))
+	s.tracker, err = acomm.NewTracker(filepath.Join(socketDir, "response", "adminTest.sock"), nil, nil, 5*time.Second)
+	s.Require().NoError(err, "failed to create tracker")
+	s.Require().NoError(s.tracker.Start(), "failed to start tracker")
+
+	// Responses to proxied requests
+	s.responses = make(chan *acomm.Response, 10)
+	s.respServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := &acomm.Response{}
+		if err := json.NewDecoder(r.Body).Decode(resp); err == nil {
+			s.responses <- resp
+		}
+	}))
+
+	// A task that never responds
+	s.taskListener = acomm.NewUnixListener(filepath.Join(socketDir, "hang", "1-hang.sock"), 0)
+	s.Require().NoError(s.taskListener.Start(), "failed to start task listener")
+	go func() {
+		for {
+			conn := s.taskListener.NextConn()
+			if conn == nil {
+				return
+			}
+			req := &acomm.Request{}
+			if err := acomm.UnmarshalConnData(conn, req); err == nil {
+				resp, _ := acomm.NewResponse(req, nil, nil, nil)
+				_ = acomm.SendConnData(conn, resp)
+			}
+			s.taskListener.DoneConn(conn)
+		}
+	}()
+}
+
+func (s *AdminSuite) TearDownSuite() {
+	s.taskListener.Stop(0)
+	s.tracker.Stop()
+	s.server.Stop()
+	s.respServer.Close()
+	_ = os.Remove(s.configFile.Name())
+	_ = os.RemoveAll(s.configData.SocketDir)
+}
+
+// status requests the status of the coordinator with the status task.
+func (s *AdminSuite) status() *coordinator.Status {
+	resp, err := s.tracker.SyncRequest(context.Background(), s.coordinatorURL, acomm.RequestOptions{
+		Task: coordinator.StatusTask,
+	}, 5*time.Second)
+	s.Require().NoError(err, "should have requested the status")
+	status := &coordinator.Status{}
+	s.Require().NoError(resp.UnmarshalResult(status), "should have a status")
+	return status
+}
+
+func findRequest(status *coordinator.Status, id string) *acomm.TrackedRequest {
+	for _, req := range status.Requests {
+		if req.ID == id {
+			return req
+		}
+	}
+	return nil
+}
+
+func findTask(status *coordinator.Status, task string) *coordinator.TaskStatus {
+	for _, taskStatus := range status.Tasks {
+		if taskStatus.Task == task {
+			return taskStatus
+		}
+	}
+	return nil
+}
+
+func (s *AdminSuite) TestStatus() {
+	req, err := acomm.NewRequest(acomm.RequestOptions{
+		Task:               "hang",
+		ResponseHookString: s.respServer.URL,
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(acomm.Send(s.coordinatorURL, req), "should have sent the request")
+
+	status := s.status()
+	tracked := findRequest(status, req.ID)
+	if s.NotNil(tracked, "should list the in-flight request") {
+		s.Equal("hang", tracked.Task)
+		s.True(tracked.Proxied, "should have proxied the request")
+		s.Equal(s.respServer.URL, tracked.ResponseHook, "should have the original response hook")
+		route, _ := url.Parse(tracked.Route)
+		if s.NotNil(route, "should have the route") {
+			s.Equal(filepath.Join(s.configData.SocketDir, "hang", "1-hang.sock"), route.Path, "should have the provider socket")
+		}
+	}
+	s.Nil(status.Drain, "should not be draining")
+	task := findTask(status, "hang")
+	if s.NotNil(task, "should list the task") {
+		s.Len(task.Providers, 1, "should list the provider socket")
+		s.True(task.Counters.Requests >= 1, "should have counted the request")
+	}
+
+	// The http endpoint has the same status
+	httpResp, err := http.Get(s.adminURL + "/status")
+	if s.NoError(err) {
+		defer func() { _ = httpResp.Body.Close() }()
+		s.Equal(http.StatusOK, httpResp.StatusCode)
+		httpStatus := &coordinator.Status{}
+		s.NoError(json.NewDecoder(httpResp.Body).Decode(httpStatus))
+		s.NotNil(findRequest(httpStatus, req.ID), "should list the in-flight request")
+	}
+	s.expire(req.ID)
+}
+
+func (s *AdminSuite) TestExpireRequest() {
+	req, err := acomm.NewRequest(acomm.RequestOptions{
+		Task:               "hang",
+		ResponseHookString: s.respServer.URL,
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(acomm.Send(s.coordinatorURL, req), "should have sent the request")
+
+	httpResp, err := http.Get(s.adminURL + "/expire?id=" + req.ID)
+	if s.NoError(err) {
+		_ = httpResp.Body.Close()
+		s.Equal(http.StatusMethodNotAllowed, httpResp.StatusCode, "should require a post")
+	}
+	httpResp, err = http.Post(s.adminURL+"/expire", "", nil)
+	if s.NoError(err) {
+		body, _ := ioutil.ReadAll(httpResp.Body)
+		_ = httpResp.Body.Close()
+		s.Equal(http.StatusBadRequest, httpResp.StatusCode, "should require an id")
+		s.Contains(string(body), "missing requestID", "should return the error")
+	}
+	httpResp, err = http.Post(s.adminURL+"/expire?id="+uuid.New(), "", nil)
+	if s.NoError(err) {
+		_ = httpResp.Body.Close()
+		s.Equal(http.StatusNotFound, httpResp.StatusCode, "should not find an untracked request")
+	}
+	httpResp, err = http.Post(s.adminURL+"/expire?id="+req.ID, "", nil)
+	if s.NoError(err) {
+		_ = httpResp.Body.Close()
+		s.Equal(http.StatusNoContent, httpResp.StatusCode, "should expire the request")
+	}
+	s.expectTimeout(req.ID)
+
+	// The task does the same
+	_, err = s.tracker.SyncRequest(context.Background(), s.coordinatorURL, acomm.RequestOptions{
+		Task: coordinator.ExpireRequestTask,
+		Args: coordinator.ExpireRequestArgs{RequestID: req.ID},
+	}, 5*time.Second)
+	s.True(errors.IsCode(err, errors.CodeNotFound), "should no longer track the request")
+
+	task := findTask(s.status(), "hang")
+	if s.NotNil(task, "should list the task") {
+		s.True(task.Counters.TimedOut >= 1, "should have counted the timeout")
+	}
+}
+
+// expire expires a request with the expire task.
+func (s *AdminSuite) expire(id string) {
+	_, err := s.tracker.SyncRequest(context.Background(), s.coordinatorURL, acomm.RequestOptions{
+		Task: coordinator.ExpireRequestTask,
+		Args: coordinator.ExpireRequestArgs{RequestID: id},
+	}, 5*time.Second)
+	s.NoError(err, "should have expired the request")
+	s.expectTimeout(id)
+}
+
+// expectTimeout waits for the timeout response to a request.
+func (s *AdminSuite) expectTimeout(id string) {
+	select {
+	case resp := <-s.responses:
+		s.Equal(id, resp.ID)
+		s.True(errors.IsCode(resp.Error, errors.CodeTimeout), "should have a timeout error")
+	case <-time.After(5 * time.Second):
+		s.Fail("should have responded with a timeout")
+	}
+}
+
+func (s *AdminSuite) TestMetrics() {
+	task := uuid.New()
+	_, err := s.tracker.SyncRequest(context.Background(), s.coordinatorURL, acomm.RequestOptions{
+		Task: task,
+	}, 5*time.Second)
+	s.True(errors.IsCode(err, errors.CodeUnavailable), "should not have found a provider")
+
+	status := s.status()
+	s.Nil(findTask(status, task), "should not list a task without providers")
+	if unknown := findTask(status, "unknown"); s.NotNil(unknown, "should list the unknown task") {
+		s.True(unknown.Counters.Rejected >= 1, "should have counted the rejected request")
+	}
+
+	httpResp, err := http.Get(fmt.Sprintf("http://localhost:%d/metrics", s.configData.ExternalPort))
+	if !s.NoError(err) {
+		return
+	}
+	defer func() { _ = httpResp.Body.Close() }()
+	s.Equal(http.StatusOK, httpResp.StatusCode)
+	body, err := ioutil.ReadAll(httpResp.Body)
+	s.NoError(err)
+	s.Regexp(`cerana_coordinator_requests_total\{outcome="unavailable",task="unknown"\} [1-9]`, string(body), "should have counted the rejected request")
+	s.NotContains(string(body), task, "should not label metrics with a task without providers")
+	s.Regexp(fmt.Sprintf(`cerana_coordinator_requests_total\{outcome="success",task="%s"\} [1-9]`, coordinator.StatusTask), string(body), "should label metrics with coordinator tasks")
+}
+
+func (s *AdminSuite) TestReloadConfig() {
+	writeConfig := func(configData coordinator.ConfigData) {
+		configJSON, _ := json.Marshal(configData)
+		s.Require().NoError(ioutil.WriteFile(s.configFile.Name(), configJSON, 0644))
+	}
+	defer writeConfig(*s.configData)
+	// Only sets the level if it changed, so it doesn't race with logging by a
+	// reload triggered by SIGHUP
+	defer func() { _ = logrusx.SetLevel("fatal") }()
+
+	configData := *s.configData
+	configData.LogLevel = "error"
+	configData.ValidateArgs = true
+	configData.ExternalPort = 45686
+	writeConfig(configData)
+
+	resp, err := s.tracker.SyncRequest(context.Background(), s.coordinatorURL, acomm.RequestOptions{
+		Task: coordinator.ReloadConfigTask,
+	}, 5*time.Second)
+	if s.NoError(err, "should have reloaded the config") {
+		result := &configutil.ReloadResult{}
+		s.NoError(resp.UnmarshalResult(result))
+		s.Equal([]string{"log_level", "validate_args"}, result.Applied)
+		s.Equal([]string{"external_port"}, result.RestartRequired)
+	}
+	s.Equal(logrus.ErrorLevel, logrus.GetLevel(), "should have applied the log level")
+
+	// An invalid config is not applied
+	configData.LogLevel = "info"
+	configData.SocketDir = ""
+	writeConfig(configData)
+	_, err = s.tracker.SyncRequest(context.Background(), s.coordinatorURL, acomm.RequestOptions{
+		Task: coordinator.ReloadConfigTask,
+	}, 5*time.Second)
+	s.Error(err, "should not reload an invalid config")
+	s.Equal(logrus.ErrorLevel, logrus.GetLevel(), "should keep the log level")
+
+	// Reload on SIGHUP
+	writeConfig(*s.configData)
+	selfProcess, err := os.FindProcess(os.Getpid())
+	s.Require().NoError(err, "couldn't find this process")
+	s.Require().NoError(selfProcess.Signal(syscall.SIGHUP))
+	for i := 0; i < 20 && logrus.GetLevel() != logrus.FatalLevel; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	s.Equal(logrus.FatalLevel, logrus.GetLevel(), "should have reloaded the config")
+}
@@ -0,0 +1,285 @@
+package coordinator
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+// Provider selection strategies. Priority tries providers in the order of
+// their socket names, <priority>-<provider>.sock. Round-robin rotates through
+// them. Least-in-flight prefers the providers with the fewest requests
+// awaiting a response. Weighted-random orders them at random, in proportion to
+// their weights.
+const (
+	StrategyPriority       = "priority"
+	StrategyRoundRobin     = "round-robin"
+	StrategyLeastInFlight  = "least-in-flight"
+	StrategyWeightedRandom = "weighted-random"
+)
+
+// BalancingConfig configures how the provider of a task request is selected.
+// A provider timing out OutlierTimeouts requests in a row is ejected, skipped
+// for OutlierEjection seconds unless no other provider is available. Weights,
+// keyed by provider name, are used by the weighted-random strategy; providers
+// without one have a weight of 1, and those with a weight of 0 are only tried
+// after the others.
+type BalancingConfig struct {
+	Strategy        string          `json:"strategy"`
+	OutlierTimeouts uint            `json:"outlier_timeouts"`
+	OutlierEjection uint            `json:"outlier_ejection"`
+	Weights         map[string]uint `json:"weights"`
+}
+
+// merge overrides the config with the fields set in another.
+func (b *BalancingConfig) merge(override *BalancingConfig) {
+	if override.Strategy != "" {
+		b.Strategy = override.Strategy
+	}
+	if override.OutlierTimeouts != 0 {
+		b.OutlierTimeouts = override.OutlierTimeouts
+	}
+	if override.OutlierEjection != 0 {
+		b.OutlierEjection = override.OutlierEjection
+	}
+	if override.Weights != nil {
+		b.Weights = override.Weights
+	}
+}
+
+// tracksRequests returns whether selection depends on the outcome of requests,
+// which requires their responses to pass through the coordinator.
+func (b *BalancingConfig) tracksRequests() bool {
+	return b.Strategy == StrategyLeastInFlight || b.OutlierTimeouts > 0
+}
+
+// weight returns the weight of the provider serving a socket.
+func (b *BalancingConfig) weight(providerSocket string) uint {
+	// Config keys are case insensitive
+	if weight, ok := b.Weights[strings.ToLower(socketProviderName(providerSocket))]; ok {
+		return weight
+	}
+	return 1
+}
+
+func validateStrategy(strategy string) error {
+	switch strategy {
+	case "", StrategyPriority, StrategyRoundRobin, StrategyLeastInFlight, StrategyWeightedRandom:
+		return nil
+	default:
+		return errors.Newv("unknown balance strategy", map[string]interface{}{"strategy": strategy})
+	}
+}
+
+// balancer orders the providers of a task for each request according to the
+// task's strategy, and keeps count of the in-flight requests and consecutive
+// timeouts of each provider socket.
+type balancer struct {
+	lock     sync.Mutex // Protects all fields
+	sockets  map[string]*socketStats
+	requests map[string]*balancedRequest
+	next     map[string]int
+	rand     *rand.Rand
+}
+
+// socketStats are the request stats of a provider socket.
+type socketStats struct {
+	inFlight     int
+	timeouts     uint
+	ejectedUntil time.Time
+}
+
+// balancedRequest is an in-flight request and the socket it was sent to.
+type balancedRequest struct {
+	socket    string
+	balancing *BalancingConfig
+}
+
+func newBalancer() *balancer {
+	return &balancer{
+		sockets:  make(map[string]*socketStats),
+		requests: make(map[string]*balancedRequest),
+		next:     make(map[string]int),
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// order returns the provider sockets of a task, given in priority order, in
+// the order they should be tried. Ejected providers are left out, unless all
+// of them are ejected.
+func (b *balancer) order(task string, balancing *BalancingConfig, providerSockets []string) []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	available := make([]string, 0, len(providerSockets))
+	for _, providerSocket := range providerSockets {
+		if stats, ok := b.sockets[providerSocket]; ok && stats.ejectedUntil.After(now) {
+			continue
+		}
+		available = append(available, providerSocket)
+	}
+	// An ejected provider is better than none
+	if len(available) == 0 {
+		available = append(available, providerSockets...)
+	}
+	if len(available) < 2 {
+		return available
+	}
+
+	keys := make([]float64, len(available))
+	switch balancing.Strategy {
+	case StrategyRoundRobin:
+		start := b.next[task] % len(available)
+		b.next[task] = start + 1
+		for i := range keys {
+			keys[i] = float64((i - start + len(available)) % len(available))
+		}
+	case StrategyLeastInFlight:
+		for i, providerSocket := range available {
+			if stats, ok := b.sockets[providerSocket]; ok {
+				keys[i] = float64(stats.inFlight)
+			}
+		}
+	case StrategyWeightedRandom:
+		// Weighted random sampling without replacement (Efraimidis-Spirakis),
+		// with the keys negated to sort in ascending order
+		for i, providerSocket := range available {
+			keys[i] = 1
+			if weight := balancing.weight(providerSocket); weight > 0 {
+				keys[i] = -math.Pow(b.rand.Float64(), 1/float64(weight))
+			}
+		}
+	default:
+		return available
+	}
+
+	sort.Stable(&socketOrder{sockets: available, keys: keys})
+	return available
+}
+
+// started records a request being sent to a provider socket.
+func (b *balancer) started(requestID, providerSocket string, balancing *BalancingConfig) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	stats, ok := b.sockets[providerSocket]
+	if !ok {
+		stats = &socketStats{}
+		b.sockets[providerSocket] = stats
+	}
+	stats.inFlight++
+	b.requests[requestID] = &balancedRequest{
+		socket:    providerSocket,
+		balancing: balancing,
+	}
+}
+
+// finished records a request being done, either with a response or by timing
+// out. A provider with too many consecutive timeouts is ejected.
+func (b *balancer) finished(requestID string, timedOut bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	req, stats := b.remove(requestID)
+	if stats == nil {
+		return
+	}
+	defer b.forget(req.socket, stats)
+
+	if !timedOut {
+		stats.timeouts = 0
+		return
+	}
+	stats.timeouts++
+	if limit := req.balancing.OutlierTimeouts; limit > 0 && stats.timeouts >= limit {
+		ejection := time.Duration(req.balancing.OutlierEjection) * time.Second
+		stats.timeouts = 0
+		stats.ejectedUntil = time.Now().Add(ejection)
+		logrus.WithFields(logrus.Fields{
+			"socket":   req.socket,
+			"timeouts": limit,
+			"ejection": ejection.String(),
+		}).Warn("ejecting provider after consecutive timeouts")
+	}
+}
+
+// unsent records a request not being accepted by the provider it was sent to.
+// Sending failures don't count towards ejection.
+func (b *balancer) unsent(requestID string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if req, stats := b.remove(requestID); stats != nil {
+		b.forget(req.socket, stats)
+	}
+}
+
+// remove stops tracking an in-flight request, returning it and the stats of
+// its socket. The lock must be held.
+func (b *balancer) remove(requestID string) (*balancedRequest, *socketStats) {
+	req, ok := b.requests[requestID]
+	if !ok {
+		return nil, nil
+	}
+	delete(b.requests, requestID)
+
+	stats, ok := b.sockets[req.socket]
+	if !ok {
+		return req, nil
+	}
+	if stats.inFlight > 0 {
+		stats.inFlight--
+	}
+	return req, stats
+}
+
+// forget drops the stats of a socket if there is nothing to remember. The
+// lock must be held.
+func (b *balancer) forget(providerSocket string, stats *socketStats) {
+	if stats.inFlight == 0 && stats.timeouts == 0 && !stats.ejectedUntil.After(time.Now()) {
+		delete(b.sockets, providerSocket)
+	}
+}
+
+// providerStatus returns the current stats of a provider socket.
+func (b *balancer) providerStatus(providerSocket string) *ProviderStatus {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	status := &ProviderStatus{Socket: providerSocket}
+	if stats, ok := b.sockets[providerSocket]; ok {
+		status.InFlight = stats.inFlight
+		status.Timeouts = stats.timeouts
+		if stats.ejectedUntil.After(time.Now()) {
+			ejectedUntil := stats.ejectedUntil
+			status.EjectedUntil = &ejectedUntil
+		}
+	}
+	return status
+}
+
+// socketOrder sorts provider sockets by ascending keys.
+type socketOrder struct {
+	sockets []string
+	keys    []float64
+}
+
+func (o *socketOrder) Len() int {
+	return len(o.sockets)
+}
+
+func (o *socketOrder) Less(i, j int) bool {
+	return o.keys[i] < o.keys[j]
+}
+
+func (o *socketOrder) Swap(i, j int) {
+	o.sockets[i], o.sockets[j] = o.sockets[j], o.sockets[i]
+	o.keys[i], o.keys[j] = o.keys[j], o.keys[i]
+}
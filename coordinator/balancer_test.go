@@ -0,0 +1,171 @@
+package coordinator_test
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/coordinator"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+func TestBalancer(t *testing.T) {
+	suite.Run(t, new(BalancerSuite))
+}
+
+type BalancerSuite struct {
+	suite.Suite
+	configData     *coordinator.ConfigData
+	configFile     *os.File
+	server         *coordinator.Server
+	tracker        *acomm.Tracker
+	coordinatorURL *url.URL
+	taskListeners  []*acomm.UnixListener
+	release        chan struct{}
+}
+
+func (s *BalancerSuite) SetupSuite() {
+	logrus.SetLevel(logrus.FatalLevel)
+
+	socketDir, err := ioutil.TempDir("", "coordinatorTest-")
+	s.Require().NoError(err, "failed to create socket dir")
+
+	s.configData = &coordinator.ConfigData{
+		SocketDir:       socketDir,
+		ServiceName:     uuid.New(),
+		ExternalPort:    45681,
+		RequestTimeout:  1,
+		LogLevel:        "fatal",
+		BalanceStrategy: coordinator.StrategyPriority,
+		TaskBalancing: map[string]*coordinator.BalancingConfig{
+			"round-robin":     {Strategy: coordinator.StrategyRoundRobin},
+			"least-in-flight": {Strategy: coordinator.StrategyLeastInFlight},
+			"weighted":        {Strategy: coordinator.StrategyWeightedRandom, Weights: map[string]uint{"a": 0}},
+			"outlier":         {OutlierTimeouts: 1, OutlierEjection: 60},
+		},
+	}
+
+	var config *coordinator.Config
+	config, _, _, s.configFile, err = newConfig(false, true, s.configData)
+	s.Require().NoError(err, "failed to create config")
+	s.Require().NoError(config.LoadConfig(), "failed to load config")
+
+	s.server, err = coordinator.NewServer(config)
+	s.Require().NoError(err, "failed to create server")
+	s.Require().NoError(s.server.Start(), "failed to start server")
+
+	s.coordinatorURL, _ = url.ParseRequestURI("unix://" + filepath.Join(socketDir, "coordinator", s.configData.ServiceName+".sock"))
+	s.tracker, err = acomm.NewTracker(filepath.Join(socketDir, "response", "balancerTest.sock"), nil, nil, 5*time.Second)
+	s.Require().NoError(err, "failed to create tracker")
+	s.Require().NoError(s.tracker.Start(), "failed to start tracker")
+
+	s.release = make(chan struct{})
+	s.startTask("round-robin", "1-a.sock", nil)
+	s.startTask("round-robin", "2-b.sock", nil)
+	s.startTask("least-in-flight", "1-a.sock", s.release)
+	s.startTask("least-in-flight", "2-b.sock", nil)
+	s.startTask("weighted", "1-a.sock", nil)
+	s.startTask("weighted", "2-b.sock", nil)
+	s.startTask("outlier", "1-a.sock", make(chan struct{}))
+	s.startTask("outlier", "2-b.sock", nil)
+}
+
+func (s *BalancerSuite) TearDownSuite() {
+	close(s.release)
+	for _, taskListener := range s.taskListeners {
+		taskListener.Stop(0)
+	}
+	s.tracker.Stop()
+	s.server.Stop()
+	_ = os.Remove(s.configFile.Name())
+	_ = os.RemoveAll(s.configData.SocketDir)
+}
+
+// startTask starts a task listener responding with the name of its socket.
+// If wait is not nil, each response waits for a value from it.
+func (s *BalancerSuite) startTask(task, socket string, wait chan struct{}) {
+	taskListener := acomm.NewUnixListener(filepath.Join(s.configData.SocketDir, task, socket), 0)
+	s.Require().NoError(taskListener.Start(), "failed to start task listener")
+	s.taskListeners = append(s.taskListeners, taskListener)
+
+	go func() {
+		for {
+			conn := taskListener.NextConn()
+			if conn == nil {
+				return
+			}
+			req := &acomm.Request{}
+			if err := acomm.UnmarshalConnData(conn, req); err != nil {
+				taskListener.DoneConn(conn)
+				continue
+			}
+			resp, _ := acomm.NewResponse(req, nil, nil, nil)
+			_ = acomm.SendConnData(conn, resp)
+			taskListener.DoneConn(conn)
+
+			go func() {
+				if wait != nil {
+					<-wait
+				}
+				resp, _ := acomm.NewResponse(req, socket, nil, nil)
+				_ = req.Respond(resp)
+			}()
+		}
+	}()
+}
+
+// send sends a request for the task and returns the channel its result, the
+// name of the socket that handled it, is delivered on.
+func (s *BalancerSuite) send(task string) chan string {
+	result := make(chan string, 1)
+	go func() {
+		var socket string
+		resp, err := s.tracker.SyncRequest(context.Background(), s.coordinatorURL, acomm.RequestOptions{Task: task}, 5*time.Second)
+		if err == nil {
+			_ = resp.UnmarshalResult(&socket)
+		} else if errors.IsCode(err, errors.CodeTimeout) {
+			socket = "timeout"
+		}
+		result <- socket
+	}()
+	return result
+}
+
+func (s *BalancerSuite) TestRoundRobin() {
+	counts := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		counts[<-s.send("round-robin")]++
+	}
+	s.Equal(map[string]int{"1-a.sock": 2, "2-b.sock": 2}, counts)
+}
+
+func (s *BalancerSuite) TestWeightedRandom() {
+	for i := 0; i < 4; i++ {
+		s.Equal("2-b.sock", <-s.send("weighted"), "should prefer the weighted provider")
+	}
+}
+
+func (s *BalancerSuite) TestLeastInFlight() {
+	// The first provider holds its response, so it has a request in flight
+	held := s.send("least-in-flight")
+	time.Sleep(100 * time.Millisecond)
+
+	s.Equal("2-b.sock", <-s.send("least-in-flight"), "should use the provider with fewer requests in flight")
+	s.release <- struct{}{}
+	s.Equal("1-a.sock", <-held)
+}
+
+func (s *BalancerSuite) TestOutlierEjection() {
+	s.Equal("timeout", <-s.send("outlier"), "should time out on the hung provider")
+	for i := 0; i < 2; i++ {
+		s.Equal("2-b.sock", <-s.send("outlier"), "should skip the ejected provider")
+	}
+}
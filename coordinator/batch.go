@@ -0,0 +1,31 @@
+package coordinator
+
+import (
+	"sync"
+
+	"github.com/cerana/cerana/acomm"
+)
+
+// handleBatch handles each request of a batch independently and concurrently,
+// running prepare on it first, and returns their initial responses in the
+// order of the requests. A failed request does not affect the rest.
+func (s *Server) handleBatch(reqs []*acomm.Request, prepare func(*acomm.Request) error, identity *Identity) []*acomm.Response {
+	resps := make([]*acomm.Response, len(reqs))
+
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		go func(i int, req *acomm.Request) {
+			defer wg.Done()
+
+			err := prepare(req)
+			if err == nil {
+				err = s.handleRequest(req, identity)
+			}
+			resps[i], _ = acomm.NewResponse(req, nil, nil, err)
+		}(i, req)
+	}
+	wg.Wait()
+
+	return resps
+}
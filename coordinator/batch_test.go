@@ -0,0 +1,66 @@
+package coordinator_test
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
+)
+
+func (s *TasksSuite) TestBatch() {
+	externalURL, _ := url.ParseRequestURI(fmt.Sprintf("http://localhost:%d", s.configData.ExternalPort))
+
+	tests := []struct {
+		description string
+		addr        *url.URL
+	}{
+		{"internal", s.coordinatorURL},
+		{"external", externalURL},
+	}
+
+	for _, test := range tests {
+		reqs := []*acomm.Request{
+			{ID: uuid.New(), Task: "foobar", ResponseHook: s.tracker.URL()},
+			{ID: uuid.New(), Task: "asdf", ResponseHook: s.tracker.URL()},
+			{ID: uuid.New(), ResponseHook: s.tracker.URL()},
+		}
+
+		errs, err := acomm.SendBatch(test.addr, reqs)
+		if !s.NoError(err, test.description) || !s.Len(errs, len(reqs), test.description) {
+			continue
+		}
+		s.NoError(errs[0], test.description)
+		s.True(errors.IsCode(errs[1], errors.CodeUnavailable), test.description)
+		s.Error(errs[2], test.description)
+	}
+}
+
+func (s *TasksSuite) TestMultiRequestBatch() {
+	multiRequest := acomm.NewMultiRequest(context.Background(), s.tracker, 5*time.Second)
+
+	requests := make(map[string]*acomm.Request)
+	for _, name := range []string{"foo", "bar", "baz"} {
+		req, err := acomm.NewRequest(acomm.RequestOptions{
+			Task: "foobar",
+			Args: &params{ID: name},
+		})
+		s.Require().NoError(err)
+		requests[name] = req
+	}
+
+	s.Len(multiRequest.SendRequests(s.coordinatorURL, requests), 0)
+	responses := multiRequest.Responses()
+	for name := range requests {
+		resp := responses[name]
+		if !s.NotNil(resp, name) {
+			continue
+		}
+		p := &params{}
+		s.NoError(resp.UnmarshalResult(p), name)
+		s.Equal(name, p.ID)
+	}
+}
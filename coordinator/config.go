@@ -1,18 +1,25 @@
 package coordinator
 
 import (
+	"crypto/tls"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/configutil"
 	"github.com/cerana/cerana/pkg/errors"
 	"github.com/cerana/cerana/pkg/logrusx"
+	"github.com/mitchellh/mapstructure"
 	flag "github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 // Config holds all configuration for the provider.
 type Config struct {
-	viper   *viper.Viper
 	flagSet *flag.FlagSet
+	file    *configutil.ConfigFile
 }
 
 // ConfigData defines the structure of the config data (e.g. in the config file)
@@ -22,6 +29,26 @@ type ConfigData struct {
 	ExternalPort   uint   `json:"external_port"`
 	RequestTimeout uint   `json:"request_timeout"`
 	LogLevel       string `json:"log_level"`
+	TLSCAFile      string `json:"tls_ca_file"`
+	TLSCertFile    string `json:"tls_cert_file"`
+	TLSKeyFile     string `json:"tls_key_file"`
+	PolicyFile     string `json:"policy_file"`
+	Codec          string `json:"codec"`
+	MaxMessageSize uint32 `json:"max_message_size"`
+	JournalFile    string `json:"journal_file"`
+	TraceExport    string `json:"trace_export"`
+	ValidateArgs   bool   `json:"validate_args"`
+
+	BalanceStrategy string                      `json:"balance_strategy"`
+	OutlierTimeouts uint                        `json:"outlier_timeouts"`
+	OutlierEjection uint                        `json:"outlier_ejection"`
+	TaskBalancing   map[string]*BalancingConfig `json:"task_balancing"`
+
+	ClusterDataURL      string `json:"cluster_data_url"`
+	NodeCoordinatorPort uint   `json:"node_coordinator_port"`
+
+	StaleSocketTimeout uint `json:"stale_socket_timeout"`
+	DrainTimeout       uint `json:"drain_timeout"`
 }
 
 // NewConfig creates a new instance of Config. If a viper instance is not
@@ -41,50 +68,276 @@ func NewConfig(flagSet *flag.FlagSet, v *viper.Viper) *Config {
 	flagSet.UintP("external_port", "p", 8080, "port for the http external request server to listen")
 	flagSet.StringP("log_level", "l", "warning", "log level: debug/info/warn/error/fatal/panic")
 	flagSet.UintP("request_timeout", "t", 0, "default timeout for requests in seconds")
+	flagSet.String("tls_ca_file", "", "path to ca certificate for verifying client and server certificates")
+	flagSet.String("tls_cert_file", "", "path to certificate for the external server and outgoing requests")
+	flagSet.String("tls_key_file", "", "path to key for the tls certificate")
+	flagSet.String("policy_file", "", "path to task authorization policy file")
+	flagSet.String("codec", "json", "codec for messages sent over unix sockets: json/cbor/msgpack")
+	flagSet.Uint32("max_message_size", 0, "maximum size in bytes of messages read from unix sockets (0 for the default)")
+	flagSet.String("trace_export", "", "file path or OTLP/HTTP collector url to export traces to (disabled if empty)")
+	flagSet.String("journal_file", "", "path to journal of in-flight requests, recovered after a restart (disabled if empty)")
+	flagSet.Bool("validate_args", false, "reject requests with args not matching the task schema before dispatch")
+	flagSet.String("balance_strategy", StrategyPriority, "provider selection strategy: priority/round-robin/least-in-flight/weighted-random")
+	flagSet.Uint("outlier_timeouts", 0, "consecutive request timeouts after which a provider is ejected (0 disables)")
+	flagSet.Uint("outlier_ejection", 30, "seconds an ejected provider is skipped")
+	flagSet.String("cluster_data_url", "", "url of the coordinator for clusterconf requests resolving request targets (this coordinator if empty)")
+	flagSet.Uint("node_coordinator_port", 0, "external port of node coordinators targeted requests are routed to (external_port if 0)")
+	flagSet.Uint("stale_socket_timeout", 30, "seconds a provider socket refusing connections is quarantined before it is removed (0 disables removal)")
+	flagSet.Uint("drain_timeout", 30, "seconds to let requests in flight finish while rejecting new ones when stopping")
 
-	return &Config{
-		viper:   v,
+	c := &Config{
 		flagSet: flagSet,
 	}
+	c.file = configutil.NewConfigFile(v, c.newViper)
+	return c
+}
+
+// newViper creates a new viper instance for reloaded settings.
+func (c *Config) newViper() (*viper.Viper, error) {
+	v := viper.New()
+	if err := v.BindPFlags(c.flagSet); err != nil {
+		return nil, errors.Wrap(err, "failed to bind flags to viper")
+	}
+	return v, nil
+}
+
+// viper returns the viper instance with the current settings.
+func (c *Config) viper() *viper.Viper {
+	return c.file.Viper()
 }
 
 // LoadConfig attempts to load the config. Flags should be parsed first.
 func (c *Config) LoadConfig() error {
-	if err := c.viper.BindPFlags(c.flagSet); err != nil {
+	if err := c.viper().BindPFlags(c.flagSet); err != nil {
 		return errors.Wrap(err, "failed to bind flags to viper")
 	}
 
-	filePath := c.viper.GetString("config_file")
+	filePath := c.viper().GetString("config_file")
 	if filePath == "" {
 		return c.Validate()
 	}
 
-	c.viper.SetConfigFile(filePath)
-	if err := c.viper.ReadInConfig(); err != nil {
-		return errors.Wrapv(err, map[string]interface{}{"configFile": filePath}, "failed to read config file")
+	if err := c.file.Read(filePath); err != nil {
+		return err
 	}
 
 	return c.Validate()
 }
 
+// Reload reloads the config file, keeping the current config if the new one is
+// not valid. The log level, policy file, argument validation, balancing, node
+// coordinator port, and drain timeout can change while running; other changed
+// settings keep their current values until a restart. If apply is not nil, it
+// is called with the reloaded config before it replaces the current one, and
+// the current config is kept if it fails.
+func (c *Config) Reload(apply func(*Config) error) (*configutil.ReloadResult, error) {
+	var applyViper func(*viper.Viper) error
+	if apply != nil {
+		applyViper = func(v *viper.Viper) error {
+			return apply(c.reloaded(v))
+		}
+	}
+	return c.file.Reload(c.validateReload, liveSetting, applyViper)
+}
+
+// reloaded returns a config for reloaded settings.
+func (c *Config) reloaded(v *viper.Viper) *Config {
+	return &Config{
+		flagSet: c.flagSet,
+		file:    configutil.NewConfigFile(v, c.newViper),
+	}
+}
+
+// validateReload validates a reloaded config, including the log level that is
+// applied immediately. The policy is validated by loading it when the config is
+// applied.
+func (c *Config) validateReload(v *viper.Viper) error {
+	reloaded := c.reloaded(v)
+	if err := reloaded.Validate(); err != nil {
+		return err
+	}
+	logLevel := v.GetString("log_level")
+	_, err := logrus.ParseLevel(logLevel)
+	return errors.Wrapv(err, map[string]interface{}{"logLevel": logLevel})
+}
+
+// liveSetting returns whether a setting can change while the coordinator is
+// running.
+func liveSetting(key string) bool {
+	switch key {
+	case "log_level", "policy_file", "validate_args", "balance_strategy", "outlier_timeouts", "outlier_ejection", "node_coordinator_port", "drain_timeout":
+		return true
+	}
+	return strings.HasPrefix(key, "task_balancing.")
+}
+
 // SocketDir returns the base directory for task sockets.
 func (c *Config) SocketDir() string {
-	return c.viper.GetString("socket_dir")
+	return c.viper().GetString("socket_dir")
 }
 
 // ServiceName returns the name the service should register as.
 func (c *Config) ServiceName() string {
-	return c.viper.GetString("service_name")
+	return c.viper().GetString("service_name")
 }
 
 // ExternalPort returns the port to listen on for external requests.
 func (c *Config) ExternalPort() int {
-	return c.viper.GetInt("external_port")
+	return c.viper().GetInt("external_port")
 }
 
 // RequestTimeout returns the duration of the default request timeout.
 func (c *Config) RequestTimeout() time.Duration {
-	return time.Second * time.Duration(c.viper.GetInt("request_timeout"))
+	return time.Second * time.Duration(c.viper().GetInt("request_timeout"))
+}
+
+// TLSCAFile returns the path to the CA certificate used to verify client and
+// server certificates.
+func (c *Config) TLSCAFile() string {
+	return c.viper().GetString("tls_ca_file")
+}
+
+// TLSCertFile returns the path to the certificate used for TLS.
+func (c *Config) TLSCertFile() string {
+	return c.viper().GetString("tls_cert_file")
+}
+
+// TLSKeyFile returns the path to the key used for TLS.
+func (c *Config) TLSKeyFile() string {
+	return c.viper().GetString("tls_key_file")
+}
+
+// TLSEnabled returns whether the external server should use TLS.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile() != ""
+}
+
+// TLSConfig returns the TLS config for the external server and outgoing
+// requests. Client certificates are required when a CA is configured.
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	if !c.TLSEnabled() {
+		return nil, nil
+	}
+
+	tlsConfig, err := acomm.LoadTLSConfig(c.TLSCAFile(), c.TLSCertFile(), c.TLSKeyFile())
+	if err != nil {
+		return nil, err
+	}
+	if c.TLSCAFile() != "" {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// PolicyFile returns the path to the task authorization policy file.
+func (c *Config) PolicyFile() string {
+	return c.viper().GetString("policy_file")
+}
+
+// Codec returns the codec for messages sent over unix sockets, which is also
+// accepted in addition to JSON. Peers that don't accept it are sent JSON.
+func (c *Config) Codec() acomm.Codec {
+	codec, _ := acomm.ParseCodec(c.codecName())
+	return codec
+}
+
+func (c *Config) codecName() string {
+	if name := c.viper().GetString("codec"); name != "" {
+		return name
+	}
+	return acomm.CodecJSON.String()
+}
+
+// MaxMessageSize returns the largest message size, in bytes, read from unix
+// sockets. Zero means the acomm default.
+func (c *Config) MaxMessageSize() uint32 {
+	return uint32(c.viper().GetInt64("max_message_size"))
+}
+
+// JournalFile returns the path to the journal of in-flight requests. An empty
+// path disables the journal.
+func (c *Config) JournalFile() string {
+	return c.viper().GetString("journal_file")
+}
+
+// TraceExport returns the file path or collector url to export traces to. An
+// empty value disables exporting.
+func (c *Config) TraceExport() string {
+	return c.viper().GetString("trace_export")
+}
+
+// ValidateArgs returns whether request args should be validated against the
+// task schema before dispatch.
+func (c *Config) ValidateArgs() bool {
+	return c.viper().GetBool("validate_args")
+}
+
+// Balancing returns the provider selection config for a task. Settings in
+// task_balancing for the task take precedence over the defaults.
+func (c *Config) Balancing(task string) *BalancingConfig {
+	v := c.viper()
+	balancing := &BalancingConfig{
+		Strategy:        v.GetString("balance_strategy"),
+		OutlierTimeouts: uint(v.GetInt("outlier_timeouts")),
+		OutlierEjection: uint(v.GetInt("outlier_ejection")),
+	}
+
+	// Errors are caught by Validate
+	taskBalancing, _ := c.taskBalancing()
+	if override, ok := taskBalancing[strings.ToLower(task)]; ok && override != nil {
+		balancing.merge(override)
+	}
+	if balancing.Strategy == "" {
+		balancing.Strategy = StrategyPriority
+	}
+	return balancing
+}
+
+func (c *Config) taskBalancing() (map[string]*BalancingConfig, error) {
+	var taskBalancing map[string]*BalancingConfig
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:  &taskBalancing,
+		TagName: "json",
+	})
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if err := decoder.Decode(c.viper().Get("task_balancing")); err != nil {
+		return nil, errors.Wrap(err, "invalid task_balancing")
+	}
+	return taskBalancing, nil
+}
+
+// ClusterDataURL returns the url of the coordinator clusterconf requests are
+// sent to. A nil url means this coordinator.
+func (c *Config) ClusterDataURL() (*url.URL, error) {
+	urlString := c.viper().GetString("cluster_data_url")
+	if urlString == "" {
+		return nil, nil
+	}
+	u, err := url.ParseRequestURI(urlString)
+	return u, errors.Wrapv(err, map[string]interface{}{"url": urlString}, "invalid cluster_data_url")
+}
+
+// NodeCoordinatorPort returns the external port of the coordinators on nodes,
+// defaulting to the port of this coordinator.
+func (c *Config) NodeCoordinatorPort() int {
+	if port := c.viper().GetInt("node_coordinator_port"); port != 0 {
+		return port
+	}
+	return c.ExternalPort()
+}
+
+// StaleSocketTimeout returns how long a provider socket refusing connections
+// is quarantined before it is removed. Zero disables removal.
+func (c *Config) StaleSocketTimeout() time.Duration {
+	return time.Second * time.Duration(c.viper().GetInt("stale_socket_timeout"))
+}
+
+// DrainTimeout returns how long requests in flight are given to finish when
+// stopping.
+func (c *Config) DrainTimeout() time.Duration {
+	return time.Second * time.Duration(c.viper().GetInt("drain_timeout"))
 }
 
 // Validate returns whether the config is valid, containing necessary values.
@@ -101,12 +354,44 @@ func (c *Config) Validate() error {
 		return errors.New("missing external_port")
 	}
 
+	if (c.TLSCertFile() == "") != (c.TLSKeyFile() == "") {
+		return errors.New("tls_cert_file and tls_key_file must be set together")
+	}
+
+	if c.TLSCAFile() != "" && !c.TLSEnabled() {
+		return errors.New("tls_ca_file requires tls_cert_file and tls_key_file")
+	}
+
+	if _, err := acomm.ParseCodec(c.codecName()); err != nil {
+		return err
+	}
+
+	if _, err := c.ClusterDataURL(); err != nil {
+		return err
+	}
+
+	if err := validateStrategy(c.viper().GetString("balance_strategy")); err != nil {
+		return err
+	}
+	taskBalancing, err := c.taskBalancing()
+	if err != nil {
+		return err
+	}
+	for task, balancing := range taskBalancing {
+		if balancing == nil {
+			continue
+		}
+		if err := validateStrategy(balancing.Strategy); err != nil {
+			return errors.Wrapv(err, map[string]interface{}{"task": task})
+		}
+	}
+
 	return nil
 }
 
 // SetupLogging sets the log level and formatting.
 func (c *Config) SetupLogging() error {
-	logLevel := c.viper.GetString("log_level")
+	logLevel := c.viper().GetString("log_level")
 	if err := logrusx.SetLevel(logLevel); err != nil {
 		return err
 	}
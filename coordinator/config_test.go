@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/coordinator"
 	"github.com/pborman/uuid"
 	flag "github.com/spf13/pflag"
@@ -40,7 +42,27 @@ func (s *ConfigSuite) SetupTest() {
 		ServiceName:    uuid.New(),
 		ExternalPort:   45678,
 		RequestTimeout: 5,
+		Codec:          "cbor",
+		MaxMessageSize: 1024,
+		TraceExport:    "/tmp/traces.json",
+		JournalFile:    filepath.Join(socketDir, "journal"),
+		ValidateArgs:   true,
 		LogLevel:       "fatal",
+
+		BalanceStrategy: coordinator.StrategyRoundRobin,
+		OutlierTimeouts: 3,
+		OutlierEjection: 10,
+		TaskBalancing: map[string]*coordinator.BalancingConfig{
+			"foo-bar": {
+				Strategy: coordinator.StrategyWeightedRandom,
+				Weights:  map[string]uint{"baz": 2},
+			},
+		},
+
+		ClusterDataURL:      "http://localhost:8080",
+		NodeCoordinatorPort: 8081,
+
+		DrainTimeout: 5,
 	}
 
 	s.config, _, _, s.configFile, err = newConfig(false, true, s.configData)
@@ -120,18 +142,98 @@ func (s *ConfigSuite) TestRequestTimeout() {
 	s.EqualValues(s.configData.RequestTimeout, s.config.RequestTimeout()/time.Second)
 }
 
+func (s *ConfigSuite) TestCodec() {
+	s.Equal(acomm.CodecCBOR, s.config.Codec())
+
+	config, fs, v, _, err := newConfig(true, false, s.configData)
+	s.Require().NoError(err)
+	_ = v.BindPFlags(fs)
+	s.Equal(acomm.CodecJSON, config.Codec(), "should default to json")
+
+	s.NoError(fs.Set("codec", "msgpack"))
+	s.Equal(acomm.CodecMsgpack, config.Codec())
+	s.NoError(fs.Set("codec", "xml"))
+	s.Error(config.Validate(), "should not be valid with an unknown codec")
+}
+
+func (s *ConfigSuite) TestMaxMessageSize() {
+	s.EqualValues(s.configData.MaxMessageSize, s.config.MaxMessageSize())
+}
+
+func (s *ConfigSuite) TestTraceExport() {
+	s.Equal(s.configData.TraceExport, s.config.TraceExport())
+}
+
+func (s *ConfigSuite) TestJournalFile() {
+	s.Equal(s.configData.JournalFile, s.config.JournalFile())
+}
+
+func (s *ConfigSuite) TestValidateArgs() {
+	s.Equal(s.configData.ValidateArgs, s.config.ValidateArgs())
+}
+
+func (s *ConfigSuite) TestBalancing() {
+	s.Equal(&coordinator.BalancingConfig{
+		Strategy:        coordinator.StrategyRoundRobin,
+		OutlierTimeouts: 3,
+		OutlierEjection: 10,
+	}, s.config.Balancing("foobar"), "should use the defaults")
+
+	s.Equal(&coordinator.BalancingConfig{
+		Strategy:        coordinator.StrategyWeightedRandom,
+		OutlierTimeouts: 3,
+		OutlierEjection: 10,
+		Weights:         map[string]uint{"baz": 2},
+	}, s.config.Balancing("foo-bar"), "should override the defaults for the task")
+
+	configData := *s.configData
+	configData.TaskBalancing = map[string]*coordinator.BalancingConfig{
+		"foo-bar": {Strategy: "asdf"},
+	}
+	config, _, _, configFile, err := newConfig(false, true, &configData)
+	if configFile != nil {
+		defer func() { _ = os.Remove(configFile.Name()) }()
+	}
+	if s.NoError(err) {
+		s.Error(config.LoadConfig(), "should not be valid with an unknown strategy")
+	}
+}
+
+func (s *ConfigSuite) TestClusterDataURL() {
+	u, err := s.config.ClusterDataURL()
+	if s.NoError(err) && s.NotNil(u) {
+		s.Equal(s.configData.ClusterDataURL, u.String())
+	}
+}
+
+func (s *ConfigSuite) TestNodeCoordinatorPort() {
+	s.Equal(int(s.configData.NodeCoordinatorPort), s.config.NodeCoordinatorPort())
+}
+
+func (s *ConfigSuite) TestDrainTimeout() {
+	s.EqualValues(s.configData.DrainTimeout, s.config.DrainTimeout()/time.Second)
+}
+
 func (s *ConfigSuite) TestValidate() {
 	tests := []struct {
 		description   string
 		socketDir     string
 		serviceName   string
 		externalPort  uint
+		tlsCAFile     string
+		tlsCertFile   string
+		tlsKeyFile    string
 		expectedError bool
 	}{
-		{"valid", "/tmp", "foobar", 8080, false},
-		{"missing socket dir", "", "foobar", 8080, true},
-		{"missing service name", "/tmp", "", 8080, true},
-		{"missing external port", "/tmp", "foobar", 0, true},
+		{"valid", "/tmp", "foobar", 8080, "", "", "", false},
+		{"missing socket dir", "", "foobar", 8080, "", "", "", true},
+		{"missing service name", "/tmp", "", 8080, "", "", "", true},
+		{"missing external port", "/tmp", "foobar", 0, "", "", "", true},
+		{"valid tls", "/tmp", "foobar", 8080, "", "cert.pem", "key.pem", false},
+		{"valid mutual tls", "/tmp", "foobar", 8080, "ca.pem", "cert.pem", "key.pem", false},
+		{"missing tls key", "/tmp", "foobar", 8080, "", "cert.pem", "", true},
+		{"missing tls cert", "/tmp", "foobar", 8080, "", "", "key.pem", true},
+		{"tls ca only", "/tmp", "foobar", 8080, "ca.pem", "", "", true},
 	}
 
 	for _, test := range tests {
@@ -141,6 +243,9 @@ func (s *ConfigSuite) TestValidate() {
 			SocketDir:    test.socketDir,
 			ServiceName:  test.serviceName,
 			ExternalPort: test.externalPort,
+			TLSCAFile:    test.tlsCAFile,
+			TLSCertFile:  test.tlsCertFile,
+			TLSKeyFile:   test.tlsKeyFile,
 		}
 
 		config, fs, v, _, err := newConfig(true, false, configData)
@@ -188,8 +293,15 @@ func newConfig(setFlags, writeConfig bool, configData *coordinator.ConfigData) (
 
 	var configFile *os.File
 	if writeConfig {
-		var err error
-		configFile, err = ioutil.TempFile("", "coordinatorTest-")
+		tempFile, err := ioutil.TempFile("", "coordinatorTest-")
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		_ = tempFile.Close()
+		_ = os.Remove(tempFile.Name())
+
+		// The config file type is determined by its extension when reloading
+		configFile, err = os.Create(tempFile.Name() + ".json")
 		if err != nil {
 			return nil, nil, nil, nil, err
 		}
@@ -215,6 +327,18 @@ func newConfig(setFlags, writeConfig bool, configData *coordinator.ConfigData) (
 		if err := fs.Set("external_port", strconv.FormatUint(uint64(configData.ExternalPort), 10)); err != nil {
 			return nil, nil, nil, configFile, err
 		}
+		if err := fs.Set("tls_ca_file", configData.TLSCAFile); err != nil {
+			return nil, nil, nil, configFile, err
+		}
+		if err := fs.Set("tls_cert_file", configData.TLSCertFile); err != nil {
+			return nil, nil, nil, configFile, err
+		}
+		if err := fs.Set("tls_key_file", configData.TLSKeyFile); err != nil {
+			return nil, nil, nil, configFile, err
+		}
+		if err := fs.Set("policy_file", configData.PolicyFile); err != nil {
+			return nil, nil, nil, configFile, err
+		}
 	}
 
 	return config, fs, v, configFile, nil
@@ -16,12 +16,150 @@ Providers responding directly to the outside world. Similarly, if the response
 to a proxied request contains a StreamURL, the Coordinator proxies the stream,
 modifying the StreamURL being sent externally appropriately.
 
+The providers of a task are tried until one accepts the request, in an order
+chosen by the balance_strategy, which can be set per task in task_balancing.
+The priority strategy tries them in the order of their socket names,
+[priority]-[provider].sock, round-robin rotates through them, least-in-flight
+prefers those with the fewest requests awaiting a response, and
+weighted-random picks at random in proportion to the configured weights of the
+providers. With outlier_timeouts set, a provider timing out that many requests
+in a row is ejected, skipped for outlier_ejection seconds unless no other
+provider is available. Responses to requests for tasks using least-in-flight or
+outlier ejection always come back through the Coordinator, so it knows when
+each is done.
+
+The Coordinator watches the task socket directories for provider sockets
+being created and removed. A socket that refuses connections, such as one left
+behind by a provider that crashed, is quarantined when found on start or when
+a request fails to be sent to it, and is skipped until it accepts connections
+again or a provider replaces it. Once quarantined for stale_socket_timeout
+seconds, the socket and its task schema are removed, unless the socket was
+replaced in the meantime.
+
+Both the http server and the unix socket also accept a batch of requests, an
+array instead of a single request, in one call. Each request of a batch is
+routed independently and concurrently, and the initial responses are returned
+as an array in the order of the requests, so one failing request doesn't affect
+the others (see acomm.SendBatch).
+
+A request may set a target (see acomm.Target) rather than a TaskURL, to run on
+a node of the cluster without knowing its address. The Coordinator resolves
+the target to a node, using the bundle or dataset heartbeats from clusterconf
+when the target is a bundle or dataset, preferring nodes where a bundle is
+healthy. Clusterconf requests are sent through this Coordinator, or the one at
+cluster_data_url if set. Listed heartbeats are reused for a few seconds, unless
+they don't include the target. The request is then routed to the coordinator on the
+node, listening on node_coordinator_port, or handled locally if the node is the
+one this Coordinator runs on.
+
+The destination of each routed request is remembered until it completes or
+times out. A cancel request (see acomm.CancelTask) is routed to the same
+destination as the request it cancels, whether a local provider or another
+coordinator.
+
+When a journal file is configured, proxied requests and their routes are
+recorded on disk until they complete. If the Coordinator is restarted, it
+resumes tracking requests left in the journal, so late responses from
+providers are still forwarded to the original response hooks. Requests whose
+timeout passed while it was down get an error response instead of being left
+to wait.
+
+External requests may instead be posted to the events endpoint, for callers
+that can't receive a response hook. The Coordinator routes the request with
+its own events socket as the response hook and delivers the initial response,
+progress messages, and the final response, with any StreamURL proxied, on the
+same http connection as Server-Sent Events (see acomm.SendEvents). The stream
+ends with an error response if the request times out first.
+
+Each routed request is recorded as a span of its trace, starting a new trace
+if the request is not already part of one, and the request is sent on as a
+child of that span. Spans are exported in the OpenTelemetry JSON format to the
+configured trace_export file or collector url.
+
+When a TLS certificate and key are configured, the external server uses https
+and the same certificate is presented as a client certificate when the
+Coordinator makes requests to other coordinators or external services.
+Configuring a CA additionally requires and verifies client certificates on
+the external server, so only holders of a certificate signed by the CA can make
+requests. Since localhost in stream and proxy urls is replaced with the
+Coordinator's address, certificates should include the node's IP addresses as
+well as hostnames.
+
+When a policy file is configured, every task request is authorized before
+being routed. External callers are identified by the common name of their
+verified TLS client certificate and internal callers by the uid of the peer
+process on the unix socket. A request is allowed only if a rule applying to the
+caller has a task pattern matching the requested task; otherwise it is denied
+with an acomm.ForbiddenError. Each decision is logged. Patterns use the shell
+glob syntax of path.Match. Callers may cancel their own requests, while
+cancelling those of other callers, or requests restored from the journal,
+also requires a rule allowing the coordinator-cancel-any task (see
+CancelAnyTask). The external /proxy, /stream, and /metrics
+endpoints are authorized the same way, as the coordinator-proxy-response,
+coordinator-stream, and coordinator-metrics tasks (see ProxyResponseTask,
+StreamTask, and MetricsTask), so other coordinators and readers of proxied
+streams need rules allowing them.
+
+	{
+		"rules": [
+			{"uid": 0, "tasks": ["*"]},
+			{"subject": "tenant-*", "tasks": ["list-*", "metrics-*"]}
+		]
+	}
+
+Providers publish a JSON Schema of the args and result of their tasks next to
+the task sockets. The Coordinator handles the list-tasks and describe-task
+requests (see acomm.ListTasksTask) itself, answering with the schemas of the
+tasks offered by its providers, merged by task. With validate_args set, the
+args of requests for a task with a schema are validated before the request is
+sent to a provider, and malformed requests are rejected with an
+invalid_argument error.
+
+For visibility into what it is doing, the Coordinator serves its Status at
+the admin status endpoint and as the response to the coordinator-status task
+(see StatusTask). The status lists the requests it is tracking with their age,
+task, the provider socket or coordinator each was sent to, and where the
+response goes next, the tasks with providers or requests along with the
+provider sockets and their balancing stats, the open data streams, and per
+task counts of requests and their outcomes, with tasks without providers
+counted together as "unknown". A tracked request can be forced to
+time out with a post to the admin expire endpoint or a
+coordinator-expire-request task (see ExpireRequestTask), responding with a
+timeout error. Admin endpoints are authorized by the policy as the equivalent
+tasks.
+
+The config file is reloaded on SIGHUP or a coordinator-reload-config request
+(see ReloadConfigTask). The new config and its policy file are validated
+first and ignored if they are not valid. The log level and policy apply immediately, and argument validation,
+balancing, and the node coordinator port apply to requests received
+afterwards. Other changed settings keep their current values until a restart,
+and are reported as such in the response.
+
+Stopping the Coordinator drains it first: new requests are rejected with a
+temporary unavailable error, so callers can retry them elsewhere, while
+responses and data streams of the requests in flight keep being proxied until
+they finish or the configured drain_timeout passes. Requests still in flight
+then are expired. The status reports the drain and its deadline while it lasts.
+
+Prometheus metrics (see package prometheusx) are served at the metrics
+endpoint, including the requests received by task and routing outcome, the
+responses that come back through the Coordinator by task and outcome, the
+latency of proxied requests, and the requests in flight. Tasks without
+providers, other than the Coordinator's own tasks, are labeled "unknown".
+
 Endpoints
 
-	External Request: http, /
+	External Request: http(s), /
+	External Events Request: http(s), /events
+	Admin Status: http(s), GET /admin/status
+	Admin Expire Request: http(s), POST /admin/expire?id=[request id]
+	Metrics: http(s), GET /metrics
 	Internal Request: unix, /[socket_dir]/coordinator/[coordinator name].sock
 	Internal Response: unix, /[socket_dir]/response/[coordinator name].sock
-	Proxied Stream: http, /stream?addr=[original StreamURL]
+	Internal Events Response: unix, /[socket_dir]/response/[coordinator name]-events.sock
+	Internal Stream: unix, /[socket_dir]/response/[coordinator name]-streams.sock?id=[stream id]
+	Proxied Response: http(s), POST /proxy
+	Proxied Stream: http(s), /stream?id=[stream id]
 
 Config
 
@@ -31,7 +169,27 @@ Config
 		"service_name": "NameOfThisCoordinator",
 		"external_port": 8080,
 		"request_timeout": 0,
-		"log_level": "warning"
+		"log_level": "warning",
+		"tls_ca_file": "/path/to/ca.pem",
+		"tls_cert_file": "/path/to/cert.pem",
+		"tls_key_file": "/path/to/key.pem",
+		"policy_file": "/path/to/policy.json",
+		"journal_file": "/path/to/journal",
+		"trace_export": "http://localhost:4318/v1/traces",
+		"validate_args": false,
+		"cluster_data_url": "http://cluster-coordinator:8080",
+		"node_coordinator_port": 8080,
+		"balance_strategy": "priority",
+		"outlier_timeouts": 0,
+		"outlier_ejection": 30,
+		"stale_socket_timeout": 30,
+		"drain_timeout": 30,
+		"task_balancing": {
+			"metrics-cpu": {
+				"strategy": "weighted-random",
+				"weights": {"metrics": 2, "metrics-backup": 1}
+			}
+		}
 	}
 */
 package coordinator
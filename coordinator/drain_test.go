@@ -0,0 +1,193 @@
+package coordinator_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/coordinator"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+func TestDrain(t *testing.T) {
+	suite.Run(t, new(DrainSuite))
+}
+
+type DrainSuite struct {
+	suite.Suite
+	configData     *coordinator.ConfigData
+	configFile     *os.File
+	server         *coordinator.Server
+	tracker        *acomm.Tracker
+	coordinatorURL *url.URL
+	respServer     *httptest.Server
+	responses      chan *acomm.Response
+	taskListener   *acomm.UnixListener
+}
+
+func (s *DrainSuite) SetupSuite() {
+	logrus.SetLevel(logrus.FatalLevel)
+
+	socketDir, err := ioutil.TempDir("", "coordinatorTest-")
+	s.Require().NoError(err, "failed to create socket dir")
+
+	s.configData = &coordinator.ConfigData{
+		SocketDir:      socketDir,
+		ServiceName:    uuid.New(),
+		ExternalPort:   45687,
+		RequestTimeout: 10,
+		LogLevel:       "fatal",
+		DrainTimeout:   2,
+	}
+
+	var config *coordinator.Config
+	config, _, _, s.configFile, err = newConfig(false, true, s.configData)
+	s.Require().NoError(err, "failed to create config")
+	s.Require().NoError(config.LoadConfig(), "failed to load config")
+
+	s.server, err = coordinator.NewServer(config)
+	s.Require().NoError(err, "failed to create server")
+	s.Require().NoError(s.server.Start(), "failed to start server")
+	time.Sleep(time.Second)
+
+	s.coordinatorURL, _ = url.ParseRequestURI("unix://" + filepath.Join(socketDir, "coordinator", s.configData.ServiceName+".sock"))
+	s.tracker, err = acomm.NewTracker(filepath.Join(socketDir, "response", "drainTest.sock"), nil, nil, 5*time.Second)
+	s.Require().NoError(err, "failed to create tracker")
+	s.Require().NoError(s.tracker.Start(), "failed to start tracker")
+
+	s.responses = make(chan *acomm.Response, 10)
+	s.respServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := &acomm.Response{}
+		if err := json.NewDecoder(r.Body).Decode(resp); err == nil {
+			s.responses <- resp
+		}
+	}))
+
+	// A task that responds when told to by the request args
+	s.taskListener = acomm.NewUnixListener(filepath.Join(socketDir, "drain", "1-drain.sock"), 0)
+	s.Require().NoError(s.taskListener.Start(), "failed to start task listener")
+	go func() {
+		for {
+			conn := s.taskListener.NextConn()
+			if conn == nil {
+				return
+			}
+			req := &acomm.Request{}
+			if err := acomm.UnmarshalConnData(conn, req); err != nil {
+				s.taskListener.DoneConn(conn)
+				continue
+			}
+			resp, _ := acomm.NewResponse(req, nil, nil, nil)
+			_ = acomm.SendConnData(conn, resp)
+			s.taskListener.DoneConn(conn)
+
+			var delay float64
+			if err := req.UnmarshalArgs(&delay); err != nil || delay < 0 {
+				continue
+			}
+			go func() {
+				time.Sleep(time.Duration(delay * float64(time.Second)))
+				resp, _ := acomm.NewResponse(req, "done", nil, nil)
+				_ = req.Respond(resp)
+			}()
+		}
+	}()
+}
+
+func (s *DrainSuite) TearDownSuite() {
+	s.taskListener.Stop(0)
+	s.tracker.Stop()
+	s.respServer.Close()
+	_ = os.Remove(s.configFile.Name())
+	_ = os.RemoveAll(s.configData.SocketDir)
+}
+
+// send sends a request for the drain task, which responds after the delay in
+// seconds, or never if it is negative.
+func (s *DrainSuite) send(delay float64) *acomm.Request {
+	req, err := acomm.NewRequest(acomm.RequestOptions{
+		Task:               "drain",
+		ResponseHookString: s.respServer.URL,
+		Args:               delay,
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(acomm.Send(s.coordinatorURL, req), "should have sent the request")
+	return req
+}
+
+// expectResponse waits for the response to a request.
+func (s *DrainSuite) expectResponse() *acomm.Response {
+	select {
+	case resp := <-s.responses:
+		return resp
+	case <-time.After(5 * time.Second):
+		s.Fail("should have responded")
+		return nil
+	}
+}
+
+func (s *DrainSuite) TestDrain() {
+	finishing := s.send(1)
+	hanging := s.send(-1)
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.Stop()
+		close(stopped)
+	}()
+
+	// The status reports the drain
+	var status *coordinator.Status
+	for i := 0; i < 10 && (status == nil || status.Drain == nil); i++ {
+		time.Sleep(100 * time.Millisecond)
+		httpResp, err := http.Get(fmt.Sprintf("http://localhost:%d/admin/status", s.configData.ExternalPort))
+		if !s.NoError(err, "should serve the status while draining") {
+			continue
+		}
+		status = &coordinator.Status{}
+		s.NoError(json.NewDecoder(httpResp.Body).Decode(status))
+		_ = httpResp.Body.Close()
+	}
+	if s.NotNil(status) && s.NotNil(status.Drain, "should report the drain") {
+		s.WithinDuration(status.Drain.Since.Add(2*time.Second), status.Drain.Deadline, time.Millisecond, "should have the drain deadline")
+		s.NotNil(findRequest(status, hanging.ID), "should list the request in flight")
+	}
+
+	// New requests are rejected
+	_, err := s.tracker.SyncRequest(context.Background(), s.coordinatorURL, acomm.RequestOptions{
+		Task: "drain",
+		Args: 0,
+	}, 5*time.Second)
+	s.True(errors.IsCode(err, errors.CodeUnavailable), "should have rejected the request")
+	s.True(acomm.IsTemporary(err), "should be able to retry the rejected request")
+
+	// Requests in flight finish, or are expired at the deadline
+	resp := s.expectResponse()
+	if s.NotNil(resp) {
+		s.Equal(finishing.ID, resp.ID)
+		s.NoError(resp.Error, "should have proxied the response while draining")
+	}
+	resp = s.expectResponse()
+	if s.NotNil(resp) {
+		s.Equal(hanging.ID, resp.ID)
+		s.True(errors.IsCode(resp.Error, errors.CodeTimeout), "should have expired the request")
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		s.Fail("should have stopped")
+	}
+}
@@ -0,0 +1,222 @@
+package coordinator
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+// eventsKeepalive is how often a comment is sent on an idle events stream to
+// keep it from being closed by proxies.
+const eventsKeepalive = 15 * time.Second
+
+// eventsHandler is the http handler for external requests whose responses
+// are delivered on the same connection as Server-Sent Events, for callers
+// that can't receive a response hook callback.
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", acomm.EventsContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	req := &acomm.Request{}
+	responses, ackErr := s.startEventsRequest(req, r)
+	if responses != nil {
+		defer s.removeEventStream(req.ID)
+	}
+
+	ack, err := acomm.NewResponse(req, nil, nil, ackErr)
+	if err == nil {
+		err = acomm.WriteEvent(w, acomm.EventAck, ack)
+	}
+	if err != nil {
+		logrus.WithField("error", errors.Wrapv(err, map[string]interface{}{"request": req})).Error("failed to send initial response")
+		return
+	}
+	flusher.Flush()
+	if ackErr != nil {
+		return
+	}
+
+	timeout := s.config.RequestTimeout()
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	if req.Deadline != nil {
+		timeout = req.Deadline.Sub(time.Now())
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	keepalive := time.NewTicker(eventsKeepalive)
+	defer keepalive.Stop()
+
+	var closed <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		closed = cn.CloseNotify()
+	}
+
+	for {
+		var resp *acomm.Response
+		select {
+		case resp = <-responses:
+		case <-timer.C:
+			resp, err = acomm.NewResponse(req, nil, nil, errors.NewWithCode(errors.CodeTimeout, "response timeout", map[string]interface{}{
+				"requestID": req.ID,
+				"timeout":   timeout.String(),
+			}))
+			if err != nil {
+				logrus.WithField("error", err).Error("failed to create timeout response")
+				return
+			}
+		case <-keepalive.C:
+			if _, err := w.Write([]byte(":\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+			continue
+		case <-closed:
+			logrus.WithFields(logrus.Fields{
+				"requestID": req.ID,
+				"task":      req.Task,
+			}).Info("events client disconnected before response")
+			return
+		}
+
+		event := acomm.EventResponse
+		if resp.IsProgress() {
+			event = acomm.EventProgress
+		} else if resp.StreamURL != nil && resp.StreamURL.Scheme == "unix" {
+			// Replace the StreamURL with a proxy stream url
+			streamURL, err := s.proxy.ProxyStreamHTTPURL(resp.StreamURL)
+			if err != nil {
+				err = errors.Wrapv(err, map[string]interface{}{"requestID": req.ID})
+				logrus.WithField("error", err).Error("failed to generate proxy stream url")
+			}
+			resp.StreamURL = streamURL
+		}
+
+		if err := acomm.WriteEvent(w, event, resp); err != nil {
+			logrus.WithField("error", err).Error("failed to send event")
+			return
+		}
+		flusher.Flush()
+		if event == acomm.EventResponse {
+			return
+		}
+	}
+}
+
+// startEventsRequest parses and routes a request received by the events
+// handler, with the coordinator's events socket as the response hook. It
+// returns the channel responses to the request will be delivered on.
+func (s *Server) startEventsRequest(req *acomm.Request, r *http.Request) (chan *acomm.Response, error) {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal request")
+	}
+	if err := req.Validate(); err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"request": req})
+	}
+	if err := acomm.ReplaceLocalhost(req.StreamURL, r.RemoteAddr); err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"request": req}, "streamURL")
+	}
+	req.ResponseHook = s.events.URL()
+
+	responses, err := s.addEventStream(req.ID)
+	if err != nil {
+		return nil, err
+	}
+	return responses, s.handleRequest(req, httpIdentity(r))
+}
+
+// addEventStream registers a channel for the responses to a request.
+func (s *Server) addEventStream(requestID string) (chan *acomm.Response, error) {
+	s.eventStreamsLock.Lock()
+	defer s.eventStreamsLock.Unlock()
+
+	if _, ok := s.eventStreams[requestID]; ok {
+		return nil, errors.NewWithCode(errors.CodeAlreadyExists, "request id already in use", map[string]interface{}{"requestID": requestID})
+	}
+	responses := make(chan *acomm.Response, 10)
+	s.eventStreams[requestID] = responses
+	return responses, nil
+}
+
+func (s *Server) removeEventStream(requestID string) {
+	s.eventStreamsLock.Lock()
+	defer s.eventStreamsLock.Unlock()
+
+	delete(s.eventStreams, requestID)
+}
+
+// eventsResponseHandler accepts responses sent to the events socket and
+// passes them along to the waiting events handlers.
+func (s *Server) eventsResponseHandler() {
+	for {
+		conn := s.events.NextConn()
+		if conn == nil {
+			return
+		}
+		go s.acceptEventsResponse(conn)
+	}
+}
+
+func (s *Server) acceptEventsResponse(conn net.Conn) {
+	defer s.events.DoneConn(conn)
+
+	resp := &acomm.Response{}
+	codec, err := s.events.ReadConnData(conn, resp)
+	if err != nil {
+		logrus.WithField("error", errors.Wrap(err, "failed to unmarshal response")).Error("failed to read events response")
+		// Reply with the error, so a codec that is not accepted can be sent
+		// again as JSON
+		if err := acomm.WriteConnData(conn, codec, &acomm.Response{Error: err}); err != nil {
+			logrus.WithField("error", err).Error("failed to reject response")
+		}
+		return
+	}
+
+	var ackErr error
+	if !s.deliverEvent(resp) {
+		ackErr = errors.NewWithCode(errors.CodeNotFound, "no events stream for response", map[string]interface{}{"requestID": resp.ID})
+	}
+	if err := acomm.WriteConnData(conn, codec, &acomm.Response{ID: resp.ID, Error: ackErr}); err != nil {
+		logrus.WithField("error", errors.Wrapv(err, map[string]interface{}{"requestID": resp.ID})).Error("failed to ack response")
+	}
+}
+
+// deliverEvent passes a response to the events handler waiting for it,
+// returning false if there is none. Progress is dropped rather than blocking
+// if the client is not keeping up, always leaving room for the final
+// response.
+func (s *Server) deliverEvent(resp *acomm.Response) bool {
+	s.eventStreamsLock.Lock()
+	defer s.eventStreamsLock.Unlock()
+
+	responses, ok := s.eventStreams[resp.ID]
+	if !ok {
+		return false
+	}
+	if !resp.IsProgress() {
+		// Nothing else is delivered after the final response
+		delete(s.eventStreams, resp.ID)
+	} else if len(responses) >= cap(responses)-1 {
+		return true
+	}
+	responses <- resp
+	return true
+}
@@ -0,0 +1,55 @@
+package coordinator_test
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/pborman/uuid"
+)
+
+func (s *TasksSuite) TestEvents() {
+	eventsURL, _ := url.ParseRequestURI(fmt.Sprintf("http://localhost:%d/events", s.configData.ExternalPort))
+
+	tests := []struct {
+		description string
+		task        string
+		args        *params
+		code        errors.Code
+	}{
+		{"valid task", "foobar", &params{ID: uuid.New()}, ""},
+		{"no providers", "asdf", &params{ID: uuid.New()}, errors.CodeUnavailable},
+	}
+
+	for _, test := range tests {
+		var result *acomm.Response
+		req, err := acomm.NewRequest(acomm.RequestOptions{
+			Task: test.task,
+			Args: test.args,
+			SuccessHandler: func(_ *acomm.Request, resp *acomm.Response) {
+				result = resp
+			},
+			ErrorHandler: func(_ *acomm.Request, resp *acomm.Response) {
+				result = resp
+			},
+		})
+		s.Require().NoError(err, test.description)
+
+		err = acomm.SendEvents(eventsURL, req)
+		if test.code != "" {
+			s.True(errors.IsCode(err, test.code), test.description)
+			s.Nil(result, test.description)
+			continue
+		}
+		if !s.NoError(err, test.description) || !s.NotNil(result, test.description) {
+			continue
+		}
+
+		s.Equal(req.ID, result.ID, test.description)
+		s.Nil(result.Error, test.description)
+		p := &params{}
+		s.NoError(result.UnmarshalResult(p), test.description)
+		s.Equal(test.args, p, test.description)
+	}
+}
@@ -0,0 +1,179 @@
+package coordinator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path"
+	"syscall"
+
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+// Identity describes the caller making a request. External callers are
+// identified by the subject common name of their TLS client certificate, while
+// internal callers are identified by the credentials of the process on the
+// other end of the unix socket.
+type Identity struct {
+	Subject string  `json:"subject,omitempty"`
+	UID     *uint32 `json:"uid,omitempty"`
+	GID     *uint32 `json:"gid,omitempty"`
+	PID     int32   `json:"pid,omitempty"`
+}
+
+// String returns a human readable representation of the identity.
+func (i *Identity) String() string {
+	switch {
+	case i == nil:
+		return "anonymous"
+	case i.Subject != "":
+		return fmt.Sprintf("subject=%s", i.Subject)
+	case i.UID != nil:
+		return fmt.Sprintf("uid=%d pid=%d", *i.UID, i.PID)
+	default:
+		return "anonymous"
+	}
+}
+
+// owner returns the part of the identity that is stable across a caller's
+// requests, for recording who made a request. It is empty for anonymous
+// callers.
+func (i *Identity) owner() string {
+	switch {
+	case i == nil:
+		return ""
+	case i.Subject != "":
+		return "subject=" + i.Subject
+	case i.UID != nil:
+		return fmt.Sprintf("uid=%d", *i.UID)
+	default:
+		return ""
+	}
+}
+
+// PolicyRule grants a set of callers permission to run tasks matching any of
+// the task patterns. Subject and task patterns use shell glob syntax as
+// supported by path.Match. A rule applies to a caller if either the Subject
+// pattern matches the caller's certificate subject or the UID matches the
+// caller's uid.
+type PolicyRule struct {
+	Subject string   `json:"subject"`
+	UID     *uint32  `json:"uid"`
+	Tasks   []string `json:"tasks"`
+}
+
+// Policy is a set of rules determining which callers may run which tasks.
+// Requests not permitted by any rule are denied.
+type Policy struct {
+	Rules []*PolicyRule `json:"rules"`
+}
+
+// LoadPolicy loads and validates a policy from a JSON file.
+func LoadPolicy(filePath string) (*Policy, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"policyFile": filePath}, "failed to read policy file")
+	}
+
+	policy := &Policy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"policyFile": filePath}, "failed to unmarshal policy")
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"policyFile": filePath})
+	}
+	return policy, nil
+}
+
+// Validate returns whether the policy is valid.
+func (p *Policy) Validate() error {
+	for i, rule := range p.Rules {
+		if rule.Subject == "" && rule.UID == nil {
+			return errors.Newv("policy rule missing subject or uid", map[string]interface{}{"rule": i})
+		}
+		if _, err := path.Match(rule.Subject, ""); err != nil {
+			return errors.Wrapv(err, map[string]interface{}{"rule": i, "subject": rule.Subject}, "invalid subject pattern")
+		}
+		for _, pattern := range rule.Tasks {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return errors.Wrapv(err, map[string]interface{}{"rule": i, "pattern": pattern}, "invalid task pattern")
+			}
+		}
+	}
+	return nil
+}
+
+// Allowed returns whether the identity is permitted to run the task.
+func (p *Policy) Allowed(identity *Identity, task string) bool {
+	if identity == nil {
+		return false
+	}
+
+	for _, rule := range p.Rules {
+		if !rule.appliesTo(identity) {
+			continue
+		}
+		for _, pattern := range rule.Tasks {
+			if ok, _ := path.Match(pattern, task); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// appliesTo returns whether the rule covers the identity.
+func (r *PolicyRule) appliesTo(identity *Identity) bool {
+	if r.Subject != "" && identity.Subject != "" {
+		if ok, _ := path.Match(r.Subject, identity.Subject); ok {
+			return true
+		}
+	}
+	return r.UID != nil && identity.UID != nil && *r.UID == *identity.UID
+}
+
+// httpIdentity determines the identity of an external caller from the
+// verified TLS client certificate.
+func httpIdentity(r *http.Request) *Identity {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return &Identity{Subject: r.TLS.VerifiedChains[0][0].Subject.CommonName}
+}
+
+// unixIdentity determines the identity of an internal caller from the
+// credentials of the peer process.
+func unixIdentity(conn net.Conn) (*Identity, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, errors.New("connection is not a unix connection")
+	}
+
+	// Read the credentials through the raw connection rather than File,
+	// which would duplicate the descriptor and switch it to blocking mode.
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get raw connection")
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to access raw connection")
+	}
+	if credErr != nil {
+		return nil, errors.Wrap(credErr, "failed to get peer credentials")
+	}
+
+	return &Identity{
+		UID: &cred.Uid,
+		GID: &cred.Gid,
+		PID: cred.Pid,
+	}, nil
+}
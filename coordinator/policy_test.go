@@ -0,0 +1,234 @@
+package coordinator_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/coordinator"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/pborman/uuid"
+)
+
+func (s *ServerSuite) TestPolicyAllowed() {
+	rootUID := uint32(0)
+	userUID := uint32(1000)
+	policy := &coordinator.Policy{
+		Rules: []*coordinator.PolicyRule{
+			{UID: &rootUID, Tasks: []string{"*"}},
+			{UID: &userUID, Tasks: []string{"zfs-list", "metrics-*"}},
+			{Subject: "tenant-*", Tasks: []string{"list-*"}},
+		},
+	}
+	s.Require().NoError(policy.Validate(), "policy should be valid")
+
+	otherUID := uint32(1001)
+	tests := []struct {
+		description string
+		identity    *coordinator.Identity
+		task        string
+		allowed     bool
+	}{
+		{"anonymous", nil, "zfs-list", false},
+		{"root any task", &coordinator.Identity{UID: &rootUID}, "zfs-destroy", true},
+		{"user exact task", &coordinator.Identity{UID: &userUID}, "zfs-list", true},
+		{"user pattern task", &coordinator.Identity{UID: &userUID}, "metrics-cpu", true},
+		{"user denied task", &coordinator.Identity{UID: &userUID}, "zfs-destroy", false},
+		{"unknown uid", &coordinator.Identity{UID: &otherUID}, "zfs-list", false},
+		{"subject pattern task", &coordinator.Identity{Subject: "tenant-a"}, "list-bundles", true},
+		{"subject denied task", &coordinator.Identity{Subject: "tenant-a"}, "zfs-list", false},
+		{"unknown subject", &coordinator.Identity{Subject: "other"}, "list-bundles", false},
+	}
+
+	for _, test := range tests {
+		msg := testMsgFunc(test.description)
+		s.Equal(test.allowed, policy.Allowed(test.identity, test.task), msg("should have made the correct decision"))
+	}
+}
+
+func (s *ServerSuite) TestLoadPolicy() {
+	tests := []struct {
+		description string
+		policyJSON  string
+		expectedErr bool
+	}{
+		{"valid", `{"rules":[{"uid":0,"tasks":["*"]},{"subject":"foo","tasks":["bar-*"]}]}`, false},
+		{"empty", `{}`, false},
+		{"invalid json", `{"rules":`, true},
+		{"missing identity", `{"rules":[{"tasks":["*"]}]}`, true},
+		{"bad task pattern", `{"rules":[{"uid":0,"tasks":["["]}]}`, true},
+		{"bad subject pattern", `{"rules":[{"subject":"[","tasks":["*"]}]}`, true},
+	}
+
+	for _, test := range tests {
+		msg := testMsgFunc(test.description)
+		policyFile := s.writePolicy(test.policyJSON)
+		policy, err := coordinator.LoadPolicy(policyFile)
+		_ = os.Remove(policyFile)
+		if test.expectedErr {
+			s.Error(err, msg("should have failed to load"))
+			s.Nil(policy, msg("should not have returned a policy"))
+		} else {
+			s.NoError(err, msg("should have loaded"))
+			s.NotNil(policy, msg("should have returned a policy"))
+		}
+	}
+
+	policy, err := coordinator.LoadPolicy(filepath.Join(s.configData.SocketDir, "doesnotexist.json"))
+	s.Error(err, "should fail to load a missing file")
+	s.Nil(policy, "should not return a policy for a missing file")
+}
+
+func (s *ServerSuite) TestPolicyEnforced() {
+	policyFile := s.writePolicy(fmt.Sprintf(`{"rules":[{"uid":%d,"tasks":["allowed-*"]}]}`, os.Getuid()))
+	defer func() { _ = os.Remove(policyFile) }()
+
+	configData := *s.configData
+	configData.ServiceName = uuid.New()
+	configData.ExternalPort = 45679
+	configData.PolicyFile = policyFile
+	config, _, _, _, err := newConfig(true, false, &configData)
+	s.Require().NoError(err, "failed to create config")
+	s.Require().NoError(config.LoadConfig(), "failed to load config")
+
+	server, err := coordinator.NewServer(config)
+	s.Require().NoError(err, "failed to create server")
+	s.Require().NoError(server.Start(), "failed to start server")
+	defer server.Stop()
+
+	internalURL, _ := url.ParseRequestURI("unix://" + filepath.Join(
+		config.SocketDir(),
+		"coordinator",
+		config.ServiceName()+".sock"),
+	)
+
+	tests := []struct {
+		description string
+		task        string
+		forbidden   bool
+	}{
+		{"allowed", "allowed-task", false},
+		{"denied", "denied-task", true},
+	}
+
+	for _, test := range tests {
+		msg := testMsgFunc(test.description)
+		req, err := acomm.NewRequest(acomm.RequestOptions{
+			Task:               test.task,
+			ResponseHookString: "unix:///tmp/doesnotexist.sock",
+		})
+		s.Require().NoError(err, msg("should have created req"))
+
+		// Neither task has a provider, so both should fail, but only the
+		// denied task should fail authorization
+		err = acomm.Send(internalURL, req)
+		s.Error(err, msg("should have failed"))
+		s.Equal(test.forbidden, acomm.IsForbidden(err), msg("should have correctly been forbidden"))
+	}
+}
+
+func (s *ServerSuite) TestPolicyCancel() {
+	tests := []struct {
+		description string
+		tasks       string
+		forbidden   bool
+	}{
+		{"not owner", `["cancel"]`, true},
+		{"admin", `["cancel", "coordinator-cancel-any"]`, false},
+	}
+
+	for i, test := range tests {
+		msg := testMsgFunc(test.description)
+		policyFile := s.writePolicy(fmt.Sprintf(`{"rules":[{"uid":%d,"tasks":%s}]}`, os.Getuid(), test.tasks))
+		defer func() { _ = os.Remove(policyFile) }()
+
+		configData := *s.configData
+		configData.ServiceName = uuid.New()
+		configData.ExternalPort = 45688 + uint(i)
+		configData.PolicyFile = policyFile
+		config, _, _, _, err := newConfig(true, false, &configData)
+		s.Require().NoError(err, msg("failed to create config"))
+		s.Require().NoError(config.LoadConfig(), msg("failed to load config"))
+
+		server, err := coordinator.NewServer(config)
+		s.Require().NoError(err, msg("failed to create server"))
+		s.Require().NoError(server.Start(), msg("failed to start server"))
+
+		internalURL, _ := url.ParseRequestURI("unix://" + filepath.Join(
+			config.SocketDir(),
+			"coordinator",
+			config.ServiceName()+".sock"),
+		)
+
+		// The request was not made by the caller, so only an admin gets as
+		// far as finding there is no route for it
+		req, err := acomm.NewCancelRequest(uuid.New(), acomm.RequestOptions{
+			ResponseHookString: "unix:///tmp/doesnotexist.sock",
+		})
+		s.Require().NoError(err, msg("should have created req"))
+		err = acomm.Send(internalURL, req)
+		s.Error(err, msg("should have failed"))
+		s.Equal(test.forbidden, acomm.IsForbidden(err), msg("should have correctly been forbidden"))
+		s.Equal(!test.forbidden, errors.IsCode(err, errors.CodeNotFound), msg("should have failed to find the route"))
+
+		server.Stop()
+	}
+}
+
+func (s *ServerSuite) writePolicy(policyJSON string) string {
+	f, err := ioutil.TempFile(s.configData.SocketDir, "policy-")
+	s.Require().NoError(err, "failed to create policy file")
+	defer func() { _ = f.Close() }()
+	_, err = f.WriteString(policyJSON)
+	s.Require().NoError(err, "failed to write policy file")
+	return f.Name()
+}
+
+func (s *ServerSuite) TestPolicyEndpoints() {
+	policyFile := s.writePolicy(fmt.Sprintf(`{"rules":[{"uid":%d,"tasks":["*"]}]}`, os.Getuid()))
+	defer func() { _ = os.Remove(policyFile) }()
+
+	configData := *s.configData
+	configData.ServiceName = uuid.New()
+	configData.ExternalPort = 45690
+	configData.PolicyFile = policyFile
+	config, _, _, _, err := newConfig(true, false, &configData)
+	s.Require().NoError(err, "failed to create config")
+	s.Require().NoError(config.LoadConfig(), "failed to load config")
+
+	server, err := coordinator.NewServer(config)
+	s.Require().NoError(err, "failed to create server")
+	s.Require().NoError(server.Start(), "failed to start server")
+	defer server.Stop()
+	time.Sleep(time.Second)
+
+	tests := []struct {
+		description string
+		method      string
+		path        string
+	}{
+		{"proxy", "POST", "/proxy"},
+		{"stream", "GET", "/stream?id=foobar"},
+		{"metrics", "GET", "/metrics"},
+	}
+
+	// External callers without a client certificate have no identity, so
+	// aren't allowed by any rule
+	for _, test := range tests {
+		msg := testMsgFunc(test.description)
+		httpReq, err := http.NewRequest(test.method, fmt.Sprintf("http://localhost:%d%s", configData.ExternalPort, test.path), strings.NewReader("{}"))
+		s.Require().NoError(err, msg("should have created http request"))
+		httpResp, err := http.DefaultClient.Do(httpReq)
+		if !s.NoError(err, msg("should have made http request")) {
+			continue
+		}
+		_ = httpResp.Body.Close()
+		s.Equal(http.StatusForbidden, httpResp.StatusCode, msg("should have been forbidden"))
+	}
+}
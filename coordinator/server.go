@@ -11,11 +11,16 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/configutil"
 	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/prometheusx"
+	"github.com/cerana/cerana/providers/clusterconf"
 	"github.com/tylerb/graceful"
 )
 
@@ -26,6 +31,27 @@ type Server struct {
 	proxy    *acomm.Tracker
 	internal *acomm.UnixListener
 	external *graceful.Server
+	sighup   chan os.Signal
+
+	policyLock sync.Mutex // Protects policy
+	policy     *Policy
+	reloadLock sync.Mutex // Serializes reloads
+
+	drainLock   sync.Mutex // Protects drainStatus
+	drainStatus *DrainStatus
+
+	balancer    *balancer
+	sockets     *socketMonitor
+	clusterData *clusterconf.Client
+	heartbeats  heartbeatCache
+
+	countersLock sync.Mutex // Protects counters and knownTasks
+	counters     map[string]*TaskCounters
+	knownTasks   map[string]bool
+
+	events           *acomm.UnixListener
+	eventStreamsLock sync.Mutex // Protects eventStreams
+	eventStreams     map[string]chan *acomm.Response
 }
 
 // NewServer creates and initializes a new instance of Server.
@@ -35,9 +61,20 @@ func NewServer(config *Config) (*Server, error) {
 		return nil, err
 	}
 
-	var err error
 	s := &Server{
-		config: config,
+		config:       config,
+		balancer:     newBalancer(),
+		sockets:      newSocketMonitor(config.SocketDir(), config.StaleSocketTimeout()),
+		counters:     make(map[string]*TaskCounters),
+		eventStreams: make(map[string]chan *acomm.Response),
+	}
+
+	if policyFile := config.PolicyFile(); policyFile != "" {
+		policy, err := LoadPolicy(policyFile)
+		if err != nil {
+			return nil, err
+		}
+		s.policy = policy
 	}
 
 	// Internal socket for requests from providers
@@ -46,6 +83,18 @@ func NewServer(config *Config) (*Server, error) {
 		"coordinator",
 		config.ServiceName()+".sock")
 	s.internal = acomm.NewUnixListener(internalSocket, 0)
+	s.internal.SetCodec(config.Codec())
+	s.internal.SetMaxMessageSize(config.MaxMessageSize())
+
+	// Targets are resolved with clusterconf, through this coordinator unless
+	// another is configured
+	clusterDataURL, err := config.ClusterDataURL()
+	if err != nil {
+		return nil, err
+	}
+	if clusterDataURL == nil {
+		clusterDataURL = s.internal.URL()
+	}
 
 	// Response socket for proxied requests
 	responseSocket := filepath.Join(
@@ -53,7 +102,28 @@ func NewServer(config *Config) (*Server, error) {
 		"response",
 		config.ServiceName()+".sock")
 
-	streamURLS := fmt.Sprintf("http://localhost:%d/stream", config.ExternalPort())
+	// Response socket for requests delivering responses as events
+	eventsSocket := filepath.Join(
+		config.SocketDir(),
+		"response",
+		config.ServiceName()+"-events.sock")
+	s.events = acomm.NewUnixListener(eventsSocket, 0)
+	s.events.SetCodec(config.Codec())
+	s.events.SetMaxMessageSize(config.MaxMessageSize())
+
+	tlsConfig, err := config.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+		// Present the same certificate when making requests to other
+		// coordinators and external services
+		acomm.SetTLSConfig(tlsConfig)
+	}
+
+	streamURLS := fmt.Sprintf("%s://localhost:%d/stream", scheme, config.ExternalPort())
 	streamURL, err := url.ParseRequestURI(streamURLS)
 	if err != nil {
 		return nil, errors.Wrapv(err, map[string]interface{}{
@@ -61,7 +131,7 @@ func NewServer(config *Config) (*Server, error) {
 			"streamURL":    streamURLS,
 		}, "failed to generate valid streamURL")
 	}
-	proxyURLS := fmt.Sprintf("http://localhost:%d/proxy", config.ExternalPort())
+	proxyURLS := fmt.Sprintf("%s://localhost:%d/proxy", scheme, config.ExternalPort())
 	proxyURL, err := url.ParseRequestURI(proxyURLS)
 	if err != nil {
 		return nil, errors.Wrapv(err, map[string]interface{}{
@@ -73,43 +143,79 @@ func NewServer(config *Config) (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
+	s.proxy.SetCodec(config.Codec())
+	s.proxy.SetMaxMessageSize(config.MaxMessageSize())
+	if journalFile := config.JournalFile(); journalFile != "" {
+		s.proxy.SetJournal(journalFile)
+	}
+	s.clusterData = clusterconf.NewClient(acomm.NewClient(s.proxy, clusterDataURL, config.RequestTimeout()))
+	s.proxy.SetProxyDoneHandler(func(req *acomm.Request, resp *acomm.Response) {
+		s.balancer.finished(req.ID, errors.IsCode(resp.Error, errors.CodeTimeout))
+		s.countResponse(req.Task, resp)
+	})
+
+	if dest := config.TraceExport(); dest != "" {
+		exporter, err := acomm.NewSpanExporter(config.ServiceName(), dest)
+		if err != nil {
+			return nil, err
+		}
+		acomm.SetSpanExporter(exporter)
+	}
 
 	// External server for requests to and from outside
 	mux := http.NewServeMux()
-	mux.HandleFunc("/stream", acomm.ProxyStreamHandler)
-	mux.HandleFunc("/proxy", s.proxy.ProxyExternalHandler)
+	mux.HandleFunc("/stream", s.authorizedHandler(StreamTask, http.HandlerFunc(s.proxy.ProxyStreamHandler)))
+	mux.HandleFunc("/proxy", s.authorizedHandler(ProxyResponseTask, http.HandlerFunc(s.proxy.ProxyExternalHandler)))
+	mux.HandleFunc("/events", s.eventsHandler)
+	mux.HandleFunc("/admin/status", s.adminStatusHandler)
+	mux.HandleFunc("/admin/expire", s.adminExpireHandler)
+	mux.HandleFunc("/metrics", s.authorizedHandler(MetricsTask, prometheusx.Handler()))
 	mux.HandleFunc("/", s.externalHandler)
 	s.external = &graceful.Server{
 		Server: &http.Server{
-			Addr:    fmt.Sprintf(":%d", config.ExternalPort()),
-			Handler: mux,
+			Addr:      fmt.Sprintf(":%d", config.ExternalPort()),
+			Handler:   mux,
+			TLSConfig: tlsConfig,
 		},
 		NoSignalHandling: true,
 	}
 
 	logrus.WithFields(logrus.Fields{
 		"response": responseSocket,
+		"events":   eventsSocket,
 		"stream":   streamURL.String(),
 		"internal": internalSocket,
 		"external": fmt.Sprintf(":%d", config.ExternalPort()),
+		"tls":      tlsConfig != nil,
+		"policy":   s.policy != nil,
 	}).Info("server addresses")
 
 	return s, nil
 }
 
-// externalHandler is the http handler for external requests.
+// externalHandler is the http handler for external requests, either a single
+// request or a batch of them.
 func (s *Server) externalHandler(w http.ResponseWriter, r *http.Request) {
 	var respErr error
-	req := &acomm.Request{}
+	reqs := []*acomm.Request{{}}
+	var batchResps []*acomm.Response
 
-	// Send the immediate response
+	// Send the immediate response, or one for each request of a batch
 	defer func() {
-		resp, err := acomm.NewResponse(req, nil, nil, respErr)
+		var payload interface{} = batchResps
 		errData := map[string]interface{}{
-			"request":  req,
-			"response": resp,
+			"requests":  reqs,
+			"responses": batchResps,
+		}
+		if batchResps == nil {
+			resp, _ := acomm.NewResponse(reqs[0], nil, nil, respErr)
+			payload = resp
+			errData = map[string]interface{}{
+				"request":  reqs[0],
+				"response": resp,
+			}
 		}
-		respJSON, err := json.Marshal(resp)
+		respJSON, err := json.Marshal(payload)
 		if err != nil {
 			err = errors.Wrapv(err, errData)
 			logrus.WithField("error", err).Error("failed to marshal initial response")
@@ -128,21 +234,38 @@ func (s *Server) externalHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := json.Unmarshal(body, req); err != nil {
+	parsed, batch, err := acomm.UnmarshalRequests(body)
+	if !batch {
+		reqs = parsed
+	}
+	if err != nil {
 		respErr = errors.Wrapv(err, map[string]interface{}{"json": string(body)}, "failed to unmarshal request")
 		return
 	}
 
-	if err := acomm.ReplaceLocalhost(req.ResponseHook, r.RemoteAddr); err != nil {
-		respErr = errors.Wrapv(err, map[string]interface{}{"request": req}, "responseHook")
-		return
+	prepare := func(req *acomm.Request) error {
+		if err := req.Validate(); err != nil {
+			return errors.Wrapv(err, map[string]interface{}{"request": req})
+		}
+		if err := acomm.ReplaceLocalhost(req.ResponseHook, r.RemoteAddr); err != nil {
+			return errors.Wrapv(err, map[string]interface{}{"request": req}, "responseHook")
+		}
+		if err := acomm.ReplaceLocalhost(req.StreamURL, r.RemoteAddr); err != nil {
+			return errors.Wrapv(err, map[string]interface{}{"request": req}, "streamURL")
+		}
+		return nil
 	}
-	if err := acomm.ReplaceLocalhost(req.StreamURL, r.RemoteAddr); err != nil {
-		respErr = errors.Wrapv(err, map[string]interface{}{"request": req}, "streamURL")
+
+	if batch {
+		reqs = parsed
+		batchResps = s.handleBatch(reqs, prepare, httpIdentity(r))
 		return
 	}
 
-	respErr = s.handleRequest(req)
+	if respErr = prepare(reqs[0]); respErr != nil {
+		return
+	}
+	respErr = s.handleRequest(reqs[0], httpIdentity(r))
 }
 
 func (s *Server) internalHandler() {
@@ -158,12 +281,25 @@ func (s *Server) internalHandler() {
 func (s *Server) acceptInternalRequest(conn net.Conn) {
 	defer s.internal.DoneConn(conn)
 	var respErr error
-	req := &acomm.Request{}
+	reqs := []*acomm.Request{{}}
+	var batchResps []*acomm.Response
+	codec := acomm.CodecJSON
 	defer func() {
-		// Respond to the initial request
-		resp, err := acomm.NewResponse(req, nil, nil, respErr)
+		// Respond to the initial request, or each request of a batch
+		if batchResps != nil {
+			if err := acomm.WriteConnData(conn, codec, batchResps); err != nil {
+				err = errors.Wrapv(err, map[string]interface{}{
+					"requests":  reqs,
+					"responses": batchResps,
+				})
+				logrus.WithField("error", err).Error("failed to send initial responses")
+			}
+			return
+		}
+
+		resp, err := acomm.NewResponse(reqs[0], nil, nil, respErr)
 		errData := map[string]interface{}{
-			"request":  req,
+			"request":  reqs[0],
 			"response": resp,
 		}
 		if err != nil {
@@ -172,39 +308,118 @@ func (s *Server) acceptInternalRequest(conn net.Conn) {
 			return
 		}
 
-		if err := acomm.SendConnData(conn, resp); err != nil {
+		if err := acomm.WriteConnData(conn, codec, resp); err != nil {
 			err = errors.Wrapv(err, errData)
 			logrus.WithField("error", err).Error("failed to send initial response")
 			return
 		}
 	}()
 
-	if err := acomm.UnmarshalConnData(conn, req); err != nil {
+	parsed, batch, readCodec, err := s.internal.ReadConnRequests(conn)
+	codec = readCodec
+	if !batch && parsed != nil {
+		reqs = parsed
+	}
+	if err != nil {
 		respErr = errors.Wrap(err, "failed to unmarshal request")
 		return
 	}
 
-	if err := req.Validate(); err != nil {
-		respErr = errors.Wrapv(err, map[string]interface{}{"request": req})
+	var identity *Identity
+	if s.currentPolicy() != nil {
+		var err error
+		identity, err = unixIdentity(conn)
+		if err != nil {
+			logrus.WithField("error", err).Error("failed to determine caller identity")
+		}
+	}
+
+	validate := func(req *acomm.Request) error {
+		return errors.Wrapv(req.Validate(), map[string]interface{}{"request": req})
+	}
+
+	if batch {
+		reqs = parsed
+		batchResps = s.handleBatch(reqs, validate, identity)
 		return
 	}
 
-	respErr = s.handleRequest(req)
+	if respErr = validate(reqs[0]); respErr != nil {
+		return
+	}
+	respErr = s.handleRequest(reqs[0], identity)
 }
 
-func (s *Server) handleRequest(req *acomm.Request) error {
-	var err error
-	if req.TaskURL == nil {
+func (s *Server) handleRequest(req *acomm.Request, identity *Identity) (err error) {
+	// Requests are routed as children of this span, starting a trace if the
+	// request isn't part of one yet
+	span := acomm.NewRequestSpan(req, "route "+req.Task, acomm.SpanKindServer)
+	span.SetAttribute("cerana.coordinator", s.config.ServiceName())
+	span.Inject(req)
+	defer func() {
+		if dest := s.proxy.Route(req.ID); dest != nil {
+			span.SetAttribute("cerana.route", dest.String())
+		}
+		span.Finish(err)
+	}()
+
+	if err := s.authorize(req, identity); err != nil {
+		return err
+	}
+
+	switch {
+	case req.Task == acomm.CancelTask:
+		err = s.cancelTask(req, identity)
+	case req.Task == acomm.ListTasksTask, req.Task == acomm.DescribeTaskTask:
+		err = s.describeTasks(req)
+	case req.Task == StatusTask, req.Task == ExpireRequestTask, req.Task == ReloadConfigTask:
+		err = s.adminTask(req)
+	case s.draining() != nil:
+		err = errors.WithCode(acomm.NewTemporaryError("coordinator is draining", map[string]interface{}{"task": req.Task}), errors.CodeUnavailable)
+	case req.Target != nil:
+		err = s.targetTask(req)
+	case req.TaskURL == nil:
 		err = s.localTask(req)
-	} else {
-		err = s.externalTask(req)
+	default:
+		err = s.externalTask(req, req.TaskURL)
 	}
 	if err != nil {
 		_ = s.proxy.RemoveRequest(req)
+	} else if identity != nil {
+		// Only the caller, or an admin, may cancel the request
+		s.proxy.SetRouteOwner(req.ID, identity.owner())
 	}
+	s.countRequest(req.Task, err)
 	return errors.Wrapv(err, map[string]interface{}{"request": req})
 }
 
+// authorize checks whether the caller is permitted to make the request
+// according to the policy, if one is configured. Every decision is logged.
+func (s *Server) authorize(req *acomm.Request, identity *Identity) error {
+	policy := s.currentPolicy()
+	if policy == nil {
+		return nil
+	}
+
+	allowed := policy.Allowed(identity, req.Task)
+	entry := logrus.WithFields(logrus.Fields{
+		"requestID": req.ID,
+		"traceID":   req.TraceID,
+		"task":      req.Task,
+		"identity":  identity.String(),
+		"allowed":   allowed,
+	})
+	if !allowed {
+		entry.Warn("request denied by policy")
+		return acomm.NewForbiddenError("forbidden: caller not authorized for task", map[string]interface{}{
+			"request":  req,
+			"identity": identity,
+		})
+	}
+	entry.Info("request allowed by policy")
+	return nil
+}
+
 // localTask handles proxying and forwarding a request to a provider for
 // the specified task.
 func (s *Server) localTask(req *acomm.Request) error {
@@ -213,32 +428,63 @@ func (s *Server) localTask(req *acomm.Request) error {
 		return err
 	}
 
+	if len(providerSockets) > 0 {
+		s.addKnownTask(req.Task)
+	}
+
+	// Providers may be restarting, so the request can be retried
+	providerSockets = s.sockets.available(providerSockets)
 	if len(providerSockets) == 0 {
-		return errors.Newv("no providers available for task", map[string]interface{}{"task": req.Task})
+		return errors.WithCode(acomm.NewTemporaryError("no providers available for task", map[string]interface{}{"task": req.Task}), errors.CodeUnavailable)
 	}
 
-	proxyReq, err := s.proxy.ProxyUnix(req, 0)
+	if s.config.ValidateArgs() {
+		if err := s.validateArgs(req, providerSockets); err != nil {
+			return err
+		}
+	}
+
+	// Responses need to come back through the coordinator when selection
+	// depends on how providers handle requests
+	balancing := s.config.Balancing(req.Task)
+	proxy := s.proxy.ProxyUnix
+	if balancing.tracksRequests() {
+		proxy = s.proxy.ProxyUnixTracked
+	}
+	proxyReq, err := proxy(req, 0)
 	if err != nil {
 		return err
 	}
 
 	// Cycle through available providers until one accepts the request
-	for _, providerSocket := range providerSockets {
+	for _, providerSocket := range s.balancer.order(req.Task, balancing, providerSockets) {
 		addr, _ := url.ParseRequestURI(fmt.Sprintf("unix://%s", providerSocket))
-		err = acomm.Send(addr, proxyReq)
+		if balancing.tracksRequests() {
+			s.balancer.started(req.ID, providerSocket, balancing)
+		}
+		err = s.proxy.Send(addr, proxyReq)
 		if err == nil {
 			// Successfully sent
-			break
+			s.proxy.TrackRoute(req, addr, 0)
+			return nil
 		}
+		s.balancer.unsent(req.ID)
+		// Skip the socket for later requests if the provider is gone
+		s.sockets.check(providerSocket)
 	}
 
+	if acomm.IsTemporary(err) {
+		return errors.WithCode(acomm.NewTemporaryError("no providers accepted request", map[string]interface{}{
+			"task":  req.Task,
+			"error": err,
+		}), errors.CodeUnavailable)
+	}
 	return err
 }
 
 // externalTask handles proxying and forwarding a request to an external
-// service (e.g. another coordinator)
-func (s *Server) externalTask(req *acomm.Request) error {
-	taskURL := req.TaskURL
+// service (e.g. another coordinator) at the task url.
+func (s *Server) externalTask(req *acomm.Request, taskURL *url.URL) error {
 	proxyReq := req
 	if taskURL.Scheme != "unix" {
 		var err error
@@ -250,7 +496,73 @@ func (s *Server) externalTask(req *acomm.Request) error {
 		// Don't proxy local requests
 		proxyReq.TaskURL = nil
 	}
-	return acomm.Send(taskURL, proxyReq)
+	if err := s.proxy.Send(taskURL, proxyReq); err != nil {
+		return err
+	}
+	s.proxy.TrackRoute(req, taskURL, 0)
+	return nil
+}
+
+// cancelTask forwards a cancel request along the route taken by the request
+// being cancelled, ending at the provider handling it.
+func (s *Server) cancelTask(req *acomm.Request, identity *Identity) error {
+	args := &acomm.CancelArgs{}
+	if err := req.UnmarshalArgs(args); err != nil {
+		return err
+	}
+	if args.RequestID == "" {
+		return errors.NewWithCode(errors.CodeInvalidArgument, "missing requestID", nil)
+	}
+	if err := s.authorizeCancel(args.RequestID, identity); err != nil {
+		return err
+	}
+
+	dest := s.proxy.Route(args.RequestID)
+	if dest == nil {
+		return errors.NewWithCode(errors.CodeNotFound, "no route for request", map[string]interface{}{"cancelRequestID": args.RequestID})
+	}
+
+	var proxyReq *acomm.Request
+	var err error
+	if dest.Scheme == "unix" {
+		proxyReq, err = s.proxy.ProxyUnix(req, 0)
+	} else {
+		proxyReq, err = s.proxy.ProxyExternal(req, 0)
+	}
+	if err != nil {
+		return err
+	}
+	return s.proxy.Send(dest, proxyReq)
+}
+
+// authorizeCancel checks whether the caller is permitted to cancel the
+// request, if a policy is configured. Callers may cancel their own requests,
+// while cancelling those of others, or requests whose caller isn't known,
+// requires permission for the CancelAnyTask. Every decision is logged.
+func (s *Server) authorizeCancel(requestID string, identity *Identity) error {
+	policy := s.currentPolicy()
+	if policy == nil {
+		return nil
+	}
+
+	owner := s.proxy.RouteOwner(requestID)
+	ownRequest := owner != "" && owner == identity.owner()
+	allowed := ownRequest || policy.Allowed(identity, CancelAnyTask)
+	entry := logrus.WithFields(logrus.Fields{
+		"cancelRequestID": requestID,
+		"identity":        identity.String(),
+		"owner":           owner,
+		"allowed":         allowed,
+	})
+	if !allowed {
+		entry.Warn("cancel denied by policy")
+		return acomm.NewForbiddenError("forbidden: caller not authorized to cancel request", map[string]interface{}{
+			"cancelRequestID": requestID,
+			"identity":        identity,
+		})
+	}
+	entry.Info("cancel allowed by policy")
+	return nil
 }
 
 // getProviders returns a list of providers registered for a given task.
@@ -282,7 +594,13 @@ func (s *Server) getProviders(task string) ([]string, error) {
 
 // externalListenAndServe runs and blocks on the external http server.
 func (s *Server) externalListenAndServe() {
-	if err := s.external.ListenAndServe(); err != nil {
+	var err error
+	if s.external.TLSConfig != nil {
+		err = s.external.ListenAndServeTLSConfig(s.external.TLSConfig)
+	} else {
+		err = s.external.ListenAndServe()
+	}
+	if err != nil {
 		// Ignore the error from closing the listener, which is involved in the
 		// graceful shutdown
 		if !strings.Contains(err.Error(), "use of closed network connection") {
@@ -307,14 +625,144 @@ func (s *Server) Start() error {
 	}
 	go s.internalHandler()
 
+	// Start watching for stale provider sockets
+	if err := s.sockets.start(); err != nil {
+		return err
+	}
+
+	// Start up the events response handler
+	if err := s.events.Start(); err != nil {
+		return err
+	}
+	go s.eventsResponseHandler()
+
 	// Start up the external request handler
 	go s.externalListenAndServe()
+
+	// Reload the config on SIGHUP
+	s.sighup = make(chan os.Signal, 1)
+	signal.Notify(s.sighup, syscall.SIGHUP)
+	go s.reloadOnSignal(s.sighup)
 	return nil
 }
 
+// Reload reloads the config and applies the settings that can change while
+// running. The log level and policy apply immediately, and balancing and
+// argument validation apply to new requests.
+func (s *Server) Reload() (*configutil.ReloadResult, error) {
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+
+	// The policy file is read again even if its path didn't change, and the
+	// current config is kept if it can't be loaded
+	var policy *Policy
+	result, err := s.config.Reload(func(config *Config) error {
+		policyFile := config.PolicyFile()
+		if policyFile == "" {
+			return nil
+		}
+		var err error
+		policy, err = LoadPolicy(policyFile)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.config.SetupLogging(); err != nil {
+		return nil, err
+	}
+
+	s.policyLock.Lock()
+	s.policy = policy
+	s.policyLock.Unlock()
+
+	entry := logrus.WithFields(logrus.Fields{
+		"applied":         result.Applied,
+		"restartRequired": result.RestartRequired,
+		"policy":          policy != nil,
+	})
+	if len(result.RestartRequired) > 0 {
+		entry.Warn("config reloaded, some settings require a restart")
+	} else {
+		entry.Info("config reloaded")
+	}
+	return result, nil
+}
+
+// reloadOnSignal reloads the config for each signal received, until the
+// channel is closed.
+func (s *Server) reloadOnSignal(sigChan chan os.Signal) {
+	for range sigChan {
+		if _, err := s.Reload(); err != nil {
+			logrus.WithField("error", err).Error("failed to reload config")
+		}
+	}
+}
+
+// drain rejects new requests and waits for the requests in flight to finish,
+// up to the drain timeout. Responses keep being proxied in the meantime.
+// Requests still in flight at the deadline are expired.
+func (s *Server) drain() {
+	now := time.Now()
+	status := &DrainStatus{
+		Since:    now,
+		Deadline: now.Add(s.config.DrainTimeout()),
+	}
+	s.drainLock.Lock()
+	s.drainStatus = status
+	s.drainLock.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"inFlight": s.proxy.NumRequests(),
+		"deadline": status.Deadline,
+	}).Info("draining")
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for s.proxy.NumRequests() > 0 && time.Now().Before(status.Deadline) {
+		<-ticker.C
+	}
+
+	for _, req := range s.proxy.Requests() {
+		if s.proxy.ExpireRequest(req.ID) {
+			logrus.WithField("requestID", req.ID).Warn("request expired after drain timeout")
+		}
+	}
+}
+
+// draining returns the drain status, or nil if the server is not draining.
+func (s *Server) draining() *DrainStatus {
+	s.drainLock.Lock()
+	defer s.drainLock.Unlock()
+
+	if s.drainStatus == nil {
+		return nil
+	}
+	status := *s.drainStatus
+	return &status
+}
+
+// currentPolicy returns the task authorization policy, or nil if there is
+// none.
+func (s *Server) currentPolicy() *Policy {
+	s.policyLock.Lock()
+	defer s.policyLock.Unlock()
+
+	return s.policy
+}
+
 // Stop stops the server, gracefully stopping all of the listeners and proxy
-// tracker.
+// tracker. The server drains first: new requests are rejected while those in
+// flight are given until the drain timeout to finish.
 func (s *Server) Stop() {
+	if s.sighup != nil {
+		signal.Stop(s.sighup)
+		close(s.sighup)
+		s.sighup = nil
+	}
+
+	s.drain()
+
 	// Stop accepting new external requests
 	stopChan := s.external.StopChan()
 	s.external.Stop(0)
@@ -322,9 +770,14 @@ func (s *Server) Stop() {
 
 	// Stop accepting new internal requests
 	s.internal.Stop(0)
+	s.events.Stop(0)
+
+	// Stop watching provider sockets
+	s.sockets.stop()
 
 	// Stop the proxy tracker
 	s.proxy.Stop()
+	acomm.FlushSpans()
 }
 
 // StopOnSignal will wait until one of the specified signals is received and
@@ -0,0 +1,308 @@
+package coordinator
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/fsnotify/fsnotify"
+)
+
+// socketMonitor watches the task socket directories and quarantines provider
+// sockets that refuse connections, such as those left behind by providers
+// that crashed. Quarantined sockets are skipped when routing requests until
+// they accept connections again, are replaced, or, after the stale socket
+// timeout, are removed.
+type socketMonitor struct {
+	socketDir    string
+	staleTimeout time.Duration
+	watcher      *fsnotify.Watcher
+	stopChan     chan struct{}
+	waitgroup    sync.WaitGroup
+
+	lock        sync.Mutex // Protects quarantined
+	quarantined map[string]*quarantinedSocket
+}
+
+// quarantinedSocket is a provider socket found to be refusing connections.
+// The file info identifies the socket file, so that a new socket created in
+// its place is not removed instead.
+type quarantinedSocket struct {
+	since time.Time
+	info  os.FileInfo
+}
+
+func newSocketMonitor(socketDir string, staleTimeout time.Duration) *socketMonitor {
+	return &socketMonitor{
+		socketDir:    socketDir,
+		staleTimeout: staleTimeout,
+		quarantined:  make(map[string]*quarantinedSocket),
+	}
+}
+
+// start begins watching the socket directories, checking the sockets already
+// in them.
+func (m *socketMonitor) start() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "failed to create socket watcher")
+	}
+	m.watcher = watcher
+	m.stopChan = make(chan struct{})
+
+	if err := m.watch(m.socketDir); err != nil {
+		_ = watcher.Close()
+		return err
+	}
+	dirs, err := filepath.Glob(filepath.Join(m.socketDir, "*"))
+	if err != nil {
+		_ = watcher.Close()
+		return errors.Wrapv(err, map[string]interface{}{"socketDir": m.socketDir})
+	}
+	for _, dir := range dirs {
+		m.watchTask(dir, true)
+	}
+
+	m.waitgroup.Add(1)
+	go m.run()
+	return nil
+}
+
+// stop stops watching the socket directories.
+func (m *socketMonitor) stop() {
+	if m.stopChan == nil {
+		return
+	}
+	close(m.stopChan)
+	m.waitgroup.Wait()
+	if err := m.watcher.Close(); err != nil {
+		logrus.WithField("error", errors.Wrap(err)).Error("failed to close socket watcher")
+	}
+}
+
+// run handles changes to the socket directories and prunes stale sockets
+// until stopped.
+func (m *socketMonitor) run() {
+	defer m.waitgroup.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case event := <-m.watcher.Events:
+			m.handleEvent(event)
+		case err := <-m.watcher.Errors:
+			logrus.WithField("error", errors.Wrap(err)).Error("socket watcher error")
+		case <-ticker.C:
+			m.prune()
+		}
+	}
+}
+
+// handleEvent watches new task directories and releases sockets that were
+// removed or replaced.
+func (m *socketMonitor) handleEvent(event fsnotify.Event) {
+	if filepath.Dir(event.Name) == m.socketDir {
+		if event.Op&fsnotify.Create != 0 {
+			m.watchTask(event.Name, false)
+		}
+		return
+	}
+
+	switch {
+	case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+		m.release(event.Name)
+	case event.Op&fsnotify.Create != 0:
+		// A provider creating its socket replaces any stale one that was there
+		m.releaseReplaced(event.Name)
+	}
+}
+
+// watch adds a directory to the watcher.
+func (m *socketMonitor) watch(dir string) error {
+	if err := m.watcher.Add(dir); err != nil {
+		return errors.Wrapv(err, map[string]interface{}{"dir": dir}, "failed to watch socket directory")
+	}
+	return nil
+}
+
+// watchTask watches a task socket directory, optionally checking the sockets
+// in it. Sockets in a new directory are being created by starting providers,
+// which may not be listening yet.
+func (m *socketMonitor) watchTask(dir string, probe bool) {
+	// Skip the coordinator's and providers' own sockets
+	name := filepath.Base(dir)
+	if name == "coordinator" || name == "response" {
+		return
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return
+	}
+
+	if err := m.watch(dir); err != nil {
+		logrus.WithField("error", err).Error("failed to watch task sockets")
+	}
+	if !probe {
+		return
+	}
+	sockets, err := filepath.Glob(filepath.Join(dir, "*.sock"))
+	if err != nil {
+		return
+	}
+	for _, socket := range sockets {
+		m.check(socket)
+	}
+}
+
+// check quarantines a provider socket if it refuses connections, returning
+// whether it is quarantined.
+func (m *socketMonitor) check(providerSocket string) bool {
+	if !acomm.IsStaleSocket(providerSocket) {
+		m.release(providerSocket)
+		return false
+	}
+	info, err := os.Lstat(providerSocket)
+	if err != nil {
+		return false
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if q, ok := m.quarantined[providerSocket]; ok && os.SameFile(q.info, info) {
+		return true
+	}
+	m.quarantined[providerSocket] = &quarantinedSocket{since: time.Now(), info: info}
+
+	logrus.WithField("socket", providerSocket).Warn("quarantined stale provider socket")
+	return true
+}
+
+// release takes a socket out of quarantine.
+func (m *socketMonitor) release(providerSocket string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.quarantined, providerSocket)
+}
+
+// releaseReplaced takes a socket out of quarantine if the file at its path is
+// no longer the one that was quarantined.
+func (m *socketMonitor) releaseReplaced(providerSocket string) {
+	info, err := os.Lstat(providerSocket)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if q, ok := m.quarantined[providerSocket]; ok && (err != nil || !os.SameFile(q.info, info)) {
+		delete(m.quarantined, providerSocket)
+	}
+}
+
+// available returns the provider sockets that are not quarantined, in the
+// same order.
+func (m *socketMonitor) available(providerSockets []string) []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	result := make([]string, 0, len(providerSockets))
+	for _, providerSocket := range providerSockets {
+		if _, ok := m.quarantined[providerSocket]; !ok {
+			result = append(result, providerSocket)
+		}
+	}
+	return result
+}
+
+// quarantinedSince returns when a socket was quarantined, or nil if it isn't.
+func (m *socketMonitor) quarantinedSince(providerSocket string) *time.Time {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	q, ok := m.quarantined[providerSocket]
+	if !ok {
+		return nil
+	}
+	since := q.since
+	return &since
+}
+
+// prune checks the quarantined sockets again, releasing those that accept
+// connections or were replaced, and removes those that have been quarantined
+// for longer than the stale socket timeout. A socket is only removed if it is
+// the same file that was quarantined and still refuses connections.
+func (m *socketMonitor) prune() {
+	m.lock.Lock()
+	quarantined := make(map[string]*quarantinedSocket, len(m.quarantined))
+	for providerSocket, q := range m.quarantined {
+		quarantined[providerSocket] = q
+	}
+	m.lock.Unlock()
+
+	for providerSocket, q := range quarantined {
+		info, err := os.Lstat(providerSocket)
+		if err != nil || !os.SameFile(q.info, info) || !acomm.IsStaleSocket(providerSocket) {
+			m.release(providerSocket)
+			continue
+		}
+		if m.staleTimeout <= 0 || time.Since(q.since) < m.staleTimeout {
+			continue
+		}
+
+		removed, err := removeStaleSocket(providerSocket, q.info)
+		if err != nil {
+			logrus.WithField("error", err).Error("failed to remove stale provider socket")
+			continue
+		}
+		if !removed {
+			m.release(providerSocket)
+			continue
+		}
+		schemaPath := acomm.TaskSchemaPath(providerSocket)
+		if err := os.Remove(schemaPath); err != nil && !os.IsNotExist(err) {
+			err = errors.Wrapv(err, map[string]interface{}{"path": schemaPath})
+			logrus.WithField("error", err).Error("failed to remove stale task schema")
+		}
+		m.release(providerSocket)
+		logrus.WithField("socket", providerSocket).Warn("removed stale provider socket")
+	}
+}
+
+// removeStaleSocket removes a quarantined socket, returning whether it was
+// removed. A provider may replace the socket at any time, so rather than
+// removing whatever is at the path, the socket is first moved aside and only
+// removed if it is still the quarantined file and still refuses connections.
+// Otherwise it is put back, unless it was replaced yet again in the meantime.
+func removeStaleSocket(providerSocket string, quarantined os.FileInfo) (bool, error) {
+	errData := map[string]interface{}{"socket": providerSocket}
+	tombstone := providerSocket + ".stale"
+
+	if err := os.Rename(providerSocket, tombstone); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.Wrapv(err, errData)
+	}
+
+	info, err := os.Lstat(tombstone)
+	if err == nil && os.SameFile(quarantined, info) && acomm.IsStaleSocket(tombstone) {
+		if err := os.Remove(tombstone); err != nil && !os.IsNotExist(err) {
+			return false, errors.Wrapv(err, errData)
+		}
+		return true, nil
+	}
+
+	// Link fails rather than clobbering a socket created since the rename
+	defer func() { _ = os.Remove(tombstone) }()
+	if err := os.Link(tombstone, providerSocket); err != nil && !os.IsExist(err) {
+		return false, errors.Wrapv(err, errData, "failed to restore provider socket")
+	}
+	return false, nil
+}
@@ -0,0 +1,174 @@
+package coordinator_test
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/coordinator"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+func TestSockets(t *testing.T) {
+	suite.Run(t, new(SocketsSuite))
+}
+
+type SocketsSuite struct {
+	suite.Suite
+	configData     *coordinator.ConfigData
+	configFile     *os.File
+	server         *coordinator.Server
+	tracker        *acomm.Tracker
+	coordinatorURL *url.URL
+	taskListener   *acomm.UnixListener
+}
+
+func (s *SocketsSuite) SetupSuite() {
+	logrus.SetLevel(logrus.FatalLevel)
+
+	socketDir, err := ioutil.TempDir("", "coordinatorTest-")
+	s.Require().NoError(err, "failed to create socket dir")
+
+	s.configData = &coordinator.ConfigData{
+		SocketDir:          socketDir,
+		ServiceName:        uuid.New(),
+		ExternalPort:       45685,
+		RequestTimeout:     5,
+		LogLevel:           "fatal",
+		StaleSocketTimeout: 2,
+	}
+
+	// A provider that crashed before the coordinator started
+	s.staleSocket(filepath.Join(socketDir, "foobar", "1-crashed.sock"))
+
+	var config *coordinator.Config
+	config, _, _, s.configFile, err = newConfig(false, true, s.configData)
+	s.Require().NoError(err, "failed to create config")
+	s.Require().NoError(config.LoadConfig(), "failed to load config")
+
+	s.server, err = coordinator.NewServer(config)
+	s.Require().NoError(err, "failed to create server")
+	s.Require().NoError(s.server.Start(), "failed to start server")
+	time.Sleep(time.Second)
+
+	s.coordinatorURL, _ = url.ParseRequestURI("unix://" + filepath.Join(socketDir, "coordinator", s.configData.ServiceName+".sock"))
+	s.tracker, err = acomm.NewTracker(filepath.Join(socketDir, "response", "socketsTest.sock"), nil, nil, 5*time.Second)
+	s.Require().NoError(err, "failed to create tracker")
+	s.Require().NoError(s.tracker.Start(), "failed to start tracker")
+
+	s.taskListener = acomm.NewUnixListener(filepath.Join(socketDir, "foobar", "5-live.sock"), 0)
+	s.Require().NoError(s.taskListener.Start(), "failed to start task listener")
+	go func() {
+		for {
+			conn := s.taskListener.NextConn()
+			if conn == nil {
+				return
+			}
+			req := &acomm.Request{}
+			if err := acomm.UnmarshalConnData(conn, req); err != nil {
+				s.taskListener.DoneConn(conn)
+				continue
+			}
+			resp, _ := acomm.NewResponse(req, nil, nil, nil)
+			_ = acomm.SendConnData(conn, resp)
+			s.taskListener.DoneConn(conn)
+
+			go func() {
+				resp, _ := acomm.NewResponse(req, "live", nil, nil)
+				_ = req.Respond(resp)
+			}()
+		}
+	}()
+}
+
+func (s *SocketsSuite) TearDownSuite() {
+	s.taskListener.Stop(0)
+	s.tracker.Stop()
+	s.server.Stop()
+	_ = os.Remove(s.configFile.Name())
+	_ = os.RemoveAll(s.configData.SocketDir)
+}
+
+// staleSocket creates a socket that nothing is listening on, as left behind
+// by a provider that crashed.
+func (s *SocketsSuite) staleSocket(path string) {
+	s.Require().NoError(os.MkdirAll(filepath.Dir(path), os.ModePerm))
+	fd, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	s.Require().NoError(err)
+	s.Require().NoError(syscall.Bind(fd, &syscall.SockaddrUnix{Name: path}))
+	s.Require().NoError(syscall.Close(fd))
+}
+
+// providerStatus returns the status of a provider socket of the foobar task.
+func (s *SocketsSuite) providerStatus(socket string) *coordinator.ProviderStatus {
+	resp, err := s.tracker.SyncRequest(context.Background(), s.coordinatorURL, acomm.RequestOptions{
+		Task: coordinator.StatusTask,
+	}, 5*time.Second)
+	s.Require().NoError(err, "should have requested the status")
+	status := &coordinator.Status{}
+	s.Require().NoError(resp.UnmarshalResult(status), "should have a status")
+
+	if task := findTask(status, "foobar"); task != nil {
+		for _, provider := range task.Providers {
+			if provider.Socket == socket {
+				return provider
+			}
+		}
+	}
+	return nil
+}
+
+// expectRemoved waits for a stale socket to be removed.
+func (s *SocketsSuite) expectRemoved(socket string) {
+	for i := 0; i < 20; i++ {
+		if _, err := os.Lstat(socket); os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+	s.Fail("should have removed the stale socket", socket)
+}
+
+func (s *SocketsSuite) TestStaleSockets() {
+	crashed := filepath.Join(s.configData.SocketDir, "foobar", "1-crashed.sock")
+	status := s.providerStatus(crashed)
+	if s.NotNil(status, "should list the stale socket") {
+		s.NotNil(status.QuarantinedSince, "should have quarantined the stale socket found on start")
+	}
+
+	// A provider that crashes while the coordinator is running is found when
+	// a request fails to be sent to it
+	failed := filepath.Join(s.configData.SocketDir, "foobar", "0-failed.sock")
+	s.staleSocket(failed)
+	for i := 0; i < 2; i++ {
+		resp, err := s.tracker.SyncRequest(context.Background(), s.coordinatorURL, acomm.RequestOptions{
+			Task: "foobar",
+		}, 5*time.Second)
+		if s.NoError(err, "should have sent the request to the live provider") {
+			var result string
+			s.NoError(resp.UnmarshalResult(&result))
+			s.Equal("live", result)
+		}
+	}
+	status = s.providerStatus(failed)
+	if s.NotNil(status, "should list the stale socket") {
+		s.NotNil(status.QuarantinedSince, "should have quarantined the socket refusing requests")
+	}
+	live := s.providerStatus(s.taskListener.Addr())
+	if s.NotNil(live, "should list the live socket") {
+		s.Nil(live.QuarantinedSince, "should not have quarantined the live socket")
+	}
+
+	s.expectRemoved(crashed)
+	s.expectRemoved(failed)
+	_, err := os.Lstat(s.taskListener.Addr())
+	s.NoError(err, "should not have removed the live socket")
+}
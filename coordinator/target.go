@@ -0,0 +1,171 @@
+package coordinator
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/providers/clusterconf"
+	"golang.org/x/net/context"
+)
+
+// targetTask handles forwarding a request to the coordinator on the node
+// resolved from its target.
+func (s *Server) targetTask(req *acomm.Request) error {
+	ctx, cancel := req.Context(context.Background())
+	defer cancel()
+
+	node, err := s.resolveTarget(ctx, req.Target)
+	if err != nil {
+		return err
+	}
+	if s.isLocalNode(node) {
+		return s.localTask(req)
+	}
+	taskURL, err := s.nodeCoordinatorURL(node)
+	if err != nil {
+		return err
+	}
+	return s.externalTask(req, taskURL)
+}
+
+// resolveTarget returns the ID of the node a target refers to, using the
+// heartbeats of bundles and datasets for targets other than a node.
+func (s *Server) resolveTarget(ctx context.Context, target *acomm.Target) (string, error) {
+	var nodes []string
+	switch {
+	case target.Node != "":
+		return target.Node, nil
+	case target.Bundle != 0:
+		heartbeats, err := s.heartbeats.bundle(ctx, s.clusterData, target.Bundle)
+		if err != nil {
+			return "", err
+		}
+		// Prefer nodes where the bundle is healthy
+		var unhealthy []string
+		for _, heartbeat := range heartbeats {
+			if heartbeat.IP == nil {
+				continue
+			}
+			if len(heartbeat.HealthErrors) == 0 {
+				nodes = append(nodes, heartbeat.IP.String())
+			} else {
+				unhealthy = append(unhealthy, heartbeat.IP.String())
+			}
+		}
+		if len(nodes) == 0 {
+			nodes = unhealthy
+		}
+	case target.Dataset != "":
+		heartbeats, err := s.heartbeats.dataset(ctx, s.clusterData, target.Dataset)
+		if err != nil {
+			return "", err
+		}
+		for ip := range heartbeats {
+			nodes = append(nodes, ip)
+		}
+	}
+
+	if len(nodes) == 0 {
+		return "", errors.NewWithCode(errors.CodeNotFound, "no node found for target", map[string]interface{}{"target": target})
+	}
+	// Consistently pick the same node while the heartbeats don't change
+	sort.Strings(nodes)
+	return nodes[0], nil
+}
+
+// heartbeatsTTL is how long listed heartbeats are used to resolve targets
+// before they are listed again.
+const heartbeatsTTL = 5 * time.Second
+
+// heartbeatCache holds the heartbeats last listed to resolve targets, so
+// targeted requests don't each wait on clusterconf before being acked. A
+// target missing from the heartbeats has them listed again, in case it was
+// added since.
+type heartbeatCache struct {
+	lock           sync.Mutex // Protects all fields
+	bundles        map[uint64]clusterconf.BundleHeartbeats
+	bundlesExpire  time.Time
+	datasets       map[string]map[string]clusterconf.DatasetHeartbeat
+	datasetsExpire time.Time
+}
+
+// bundle returns the heartbeats of a bundle.
+func (c *heartbeatCache) bundle(ctx context.Context, clusterData *clusterconf.Client, id uint64) (clusterconf.BundleHeartbeats, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if heartbeats, ok := c.bundles[id]; ok && time.Now().Before(c.bundlesExpire) {
+		return heartbeats, nil
+	}
+	heartbeats, err := clusterData.ListBundleHeartbeats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.bundles, c.bundlesExpire = heartbeats, time.Now().Add(heartbeatsTTL)
+	return heartbeats[id], nil
+}
+
+// dataset returns the heartbeats of a dataset, by node IP.
+func (c *heartbeatCache) dataset(ctx context.Context, clusterData *clusterconf.Client, id string) (map[string]clusterconf.DatasetHeartbeat, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if heartbeats, ok := c.datasets[id]; ok && time.Now().Before(c.datasetsExpire) {
+		return heartbeats, nil
+	}
+	heartbeats, err := clusterData.ListDatasetHeartbeats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.datasets, c.datasetsExpire = heartbeats, time.Now().Add(heartbeatsTTL)
+	return heartbeats[id], nil
+}
+
+// nodeCoordinatorURL returns the url of the coordinator running on a node.
+func (s *Server) nodeCoordinatorURL(node string) (*url.URL, error) {
+	scheme := "http"
+	if s.config.TLSEnabled() {
+		scheme = "https"
+	}
+
+	urlString := fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(node, strconv.Itoa(s.config.NodeCoordinatorPort())))
+	u, err := url.ParseRequestURI(urlString)
+	if err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"node": node, "url": urlString}, "failed to generate node coordinator url")
+	}
+	return u, nil
+}
+
+// isLocalNode returns whether a node is the one this coordinator is running on,
+// so requests for it are handled locally instead of being sent back around to
+// the coordinator.
+func (s *Server) isLocalNode(node string) bool {
+	if s.config.NodeCoordinatorPort() != s.config.ExternalPort() {
+		return false
+	}
+
+	ip := net.ParseIP(node)
+	if ip == nil {
+		return node == "localhost"
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
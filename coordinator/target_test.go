@@ -0,0 +1,215 @@
+package coordinator_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/coordinator"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/providers/clusterconf"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+func TestTarget(t *testing.T) {
+	suite.Run(t, new(TargetSuite))
+}
+
+type TargetSuite struct {
+	suite.Suite
+	configData      *coordinator.ConfigData
+	configFile      *os.File
+	server          *coordinator.Server
+	tracker         *acomm.Tracker
+	coordinatorURL  *url.URL
+	taskListeners   []*acomm.UnixListener
+	nodeCoordinator *httptest.Server
+	routed          chan string
+	datasetLists    int32
+}
+
+func (s *TargetSuite) SetupSuite() {
+	logrus.SetLevel(logrus.FatalLevel)
+	s.routed = make(chan string, 10)
+
+	socketDir, err := ioutil.TempDir("", "coordinatorTest-")
+	s.Require().NoError(err, "failed to create socket dir")
+
+	// Targets resolve to the local address, with a mock node coordinator on
+	// its own port
+	s.nodeCoordinator = httptest.NewServer(http.HandlerFunc(s.nodeCoordinatorHandler))
+	nodeURL, _ := url.ParseRequestURI(s.nodeCoordinator.URL)
+	_, nodePort, _ := net.SplitHostPort(nodeURL.Host)
+	port, _ := strconv.ParseUint(nodePort, 10, 64)
+
+	s.configData = &coordinator.ConfigData{
+		SocketDir:           socketDir,
+		ServiceName:         uuid.New(),
+		ExternalPort:        45682,
+		RequestTimeout:      5,
+		LogLevel:            "fatal",
+		NodeCoordinatorPort: uint(port),
+	}
+
+	var config *coordinator.Config
+	config, _, _, s.configFile, err = newConfig(false, true, s.configData)
+	s.Require().NoError(err, "failed to create config")
+	s.Require().NoError(config.LoadConfig(), "failed to load config")
+
+	s.server, err = coordinator.NewServer(config)
+	s.Require().NoError(err, "failed to create server")
+	s.Require().NoError(s.server.Start(), "failed to start server")
+	time.Sleep(time.Second)
+
+	s.coordinatorURL, _ = url.ParseRequestURI("unix://" + filepath.Join(socketDir, "coordinator", s.configData.ServiceName+".sock"))
+	s.tracker, err = acomm.NewTracker(filepath.Join(socketDir, "response", "targetTest.sock"), nil, nil, 5*time.Second)
+	s.Require().NoError(err, "failed to create tracker")
+	s.Require().NoError(s.tracker.Start(), "failed to start tracker")
+
+	s.startTask(clusterconf.TaskListBundleHeartbeats, func(req *acomm.Request) interface{} {
+		return clusterconf.BundleHeartbeatList{
+			Heartbeats: map[uint64]clusterconf.BundleHeartbeats{
+				1: {
+					"a": {IP: net.ParseIP("127.0.0.2"), HealthErrors: map[string]error{"foo": errors.New("unhealthy")}},
+					"b": {IP: net.ParseIP("127.0.0.1")},
+				},
+			},
+		}
+	})
+	s.startTask(clusterconf.TaskListDatasetHeartbeats, func(req *acomm.Request) interface{} {
+		atomic.AddInt32(&s.datasetLists, 1)
+		return clusterconf.DatasetHeartbeatList{
+			Heartbeats: map[string]map[string]clusterconf.DatasetHeartbeat{
+				"foo": {"127.0.0.1": {IP: net.ParseIP("127.0.0.1")}},
+			},
+		}
+	})
+}
+
+func (s *TargetSuite) TearDownSuite() {
+	for _, taskListener := range s.taskListeners {
+		taskListener.Stop(0)
+	}
+	s.tracker.Stop()
+	s.server.Stop()
+	s.nodeCoordinator.Close()
+	_ = os.Remove(s.configFile.Name())
+	_ = os.RemoveAll(s.configData.SocketDir)
+}
+
+// startTask starts a task listener responding with the result of handler.
+func (s *TargetSuite) startTask(task string, handler func(*acomm.Request) interface{}) {
+	taskListener := acomm.NewUnixListener(filepath.Join(s.configData.SocketDir, task, "target.sock"), 0)
+	s.Require().NoError(taskListener.Start(), "failed to start task listener")
+	s.taskListeners = append(s.taskListeners, taskListener)
+
+	go func() {
+		for {
+			conn := taskListener.NextConn()
+			if conn == nil {
+				return
+			}
+			req := &acomm.Request{}
+			if err := acomm.UnmarshalConnData(conn, req); err != nil {
+				taskListener.DoneConn(conn)
+				continue
+			}
+			resp, _ := acomm.NewResponse(req, nil, nil, nil)
+			_ = acomm.SendConnData(conn, resp)
+			taskListener.DoneConn(conn)
+
+			go func() {
+				resp, _ := acomm.NewResponse(req, handler(req), nil, nil)
+				_ = req.Respond(resp)
+			}()
+		}
+	}()
+}
+
+// nodeCoordinatorHandler accepts requests as a node coordinator, responding
+// with the host the request was sent to.
+func (s *TargetSuite) nodeCoordinatorHandler(w http.ResponseWriter, r *http.Request) {
+	req := &acomm.Request{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		data, _ := json.Marshal(&acomm.Response{Error: err})
+		_, _ = w.Write(data)
+		return
+	}
+	ack, _ := acomm.NewResponse(req, nil, nil, nil)
+	data, _ := json.Marshal(ack)
+	_, _ = w.Write(data)
+
+	s.routed <- req.Task
+	go func() {
+		resp, _ := acomm.NewResponse(req, r.Host, nil, nil)
+		_ = req.Respond(resp)
+	}()
+}
+
+func (s *TargetSuite) TestTarget() {
+	tests := []struct {
+		description string
+		target      *acomm.Target
+		expectedErr bool
+	}{
+		{"node", &acomm.Target{Node: "127.0.0.1"}, false},
+		{"bundle", &acomm.Target{Bundle: 1}, false},
+		{"unknown bundle", &acomm.Target{Bundle: 2}, true},
+		{"dataset", &acomm.Target{Dataset: "foo"}, false},
+		{"unknown dataset", &acomm.Target{Dataset: "bar"}, true},
+	}
+
+	for _, test := range tests {
+		msg := testMsgFunc(test.description)
+		resp, err := s.tracker.SyncRequest(context.Background(), s.coordinatorURL, acomm.RequestOptions{
+			Task:   "foobar",
+			Target: test.target,
+		}, 5*time.Second)
+		if test.expectedErr {
+			s.True(errors.IsCode(err, errors.CodeNotFound), msg("should not have found a node"))
+			continue
+		}
+		if !s.NoError(err, msg("should have routed the request")) {
+			continue
+		}
+		s.Equal("foobar", <-s.routed, msg("should have routed the request to the node coordinator"))
+		var result string
+		s.NoError(resp.UnmarshalResult(&result), msg("should have a result"))
+		s.Equal(s.nodeCoordinator.Listener.Addr().String(), result, msg("should have the result from the node coordinator"))
+	}
+}
+
+func (s *TargetSuite) TestTargetHeartbeatCache() {
+	atomic.StoreInt32(&s.datasetLists, 0)
+	for i := 0; i < 2; i++ {
+		_, err := s.tracker.SyncRequest(context.Background(), s.coordinatorURL, acomm.RequestOptions{
+			Task:   "foobar",
+			Target: &acomm.Target{Dataset: "foo"},
+		}, 5*time.Second)
+		if !s.NoError(err, "should have routed the request") {
+			return
+		}
+		<-s.routed
+	}
+	s.True(atomic.LoadInt32(&s.datasetLists) <= 1, "should have reused the listed heartbeats")
+
+	_, err := s.tracker.SyncRequest(context.Background(), s.coordinatorURL, acomm.RequestOptions{
+		Task:   "foobar",
+		Target: &acomm.Target{Dataset: "bar"},
+	}, 5*time.Second)
+	s.Error(err, "should not have found a node")
+	s.True(atomic.LoadInt32(&s.datasetLists) >= 1, "should have listed the heartbeats again for a missing target")
+}
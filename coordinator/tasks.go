@@ -0,0 +1,164 @@
+package coordinator
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+// describeTasks handles list-tasks and describe-task requests, responding
+// with the schemas published by the providers. The response is sent after
+// the request has been acknowledged.
+func (s *Server) describeTasks(req *acomm.Request) error {
+	var result interface{}
+	if req.Task == acomm.ListTasksTask {
+		schemas, err := s.taskSchemas()
+		if err != nil {
+			return err
+		}
+		result = &acomm.ListTasksResult{Tasks: schemas}
+	} else {
+		args := &acomm.DescribeTaskArgs{}
+		if err := req.UnmarshalArgs(args); err != nil {
+			return err
+		}
+		if args.Task == "" {
+			return errors.NewWithCode(errors.CodeInvalidArgument, "missing task", nil)
+		}
+		schema, err := s.taskSchema(args.Task)
+		if err != nil {
+			return err
+		}
+		if schema == nil {
+			return errors.NewWithCode(errors.CodeNotFound, "no providers for task", map[string]interface{}{"task": args.Task})
+		}
+		result = schema
+	}
+
+	resp, err := acomm.NewResponse(req, result, nil, nil)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := req.Respond(resp); err != nil {
+			err = errors.Wrapv(err, map[string]interface{}{"request": req})
+			logrus.WithField("error", err).Error("failed to send task description")
+		}
+	}()
+	return nil
+}
+
+// taskSchemas returns the schemas of all tasks with providers, in order of
+// task name.
+func (s *Server) taskSchemas() ([]*acomm.TaskSchema, error) {
+	socketDir := s.config.SocketDir()
+	dirs, err := ioutil.ReadDir(socketDir)
+	if err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"socketDir": socketDir})
+	}
+
+	schemas := make([]*acomm.TaskSchema, 0, len(dirs))
+	for _, dir := range dirs {
+		// Skip the coordinator's and providers' own sockets
+		if !dir.IsDir() || dir.Name() == "coordinator" || dir.Name() == "response" {
+			continue
+		}
+		schema, err := s.taskSchema(dir.Name())
+		if err != nil {
+			return nil, err
+		}
+		if schema != nil {
+			schemas = append(schemas, schema)
+		}
+	}
+	return schemas, nil
+}
+
+// taskSchema returns the schema of a task, merged from the schemas published
+// by its providers, or nil if no providers are registered for the task. The
+// description and args and result schemas are those of the first provider, in
+// the order requests are dispatched, that published a schema.
+func (s *Server) taskSchema(task string) (*acomm.TaskSchema, error) {
+	providerSockets, err := s.getProviders(task)
+	if err != nil || len(providerSockets) == 0 {
+		return nil, err
+	}
+
+	merged := &acomm.TaskSchema{Task: task}
+	described := false
+	for _, providerSocket := range providerSockets {
+		schema, err := readTaskSchema(providerSocket)
+		if err != nil {
+			return nil, err
+		}
+		if schema == nil {
+			merged.Providers = append(merged.Providers, socketProviderName(providerSocket))
+			continue
+		}
+		merged.Providers = append(merged.Providers, schema.Providers...)
+		if !described {
+			described = true
+			merged.Description = schema.Description
+			merged.Args = schema.Args
+			merged.Result = schema.Result
+		}
+	}
+	return merged, nil
+}
+
+// validateArgs checks the args of a request against the schema published by
+// one of the task providers. Requests for tasks without a schema are not
+// checked.
+func (s *Server) validateArgs(req *acomm.Request, providerSockets []string) error {
+	for _, providerSocket := range providerSockets {
+		schema, err := readTaskSchema(providerSocket)
+		if err != nil {
+			return err
+		}
+		if schema == nil || schema.Args == nil {
+			continue
+		}
+
+		var args []byte
+		if req.Args != nil {
+			args = *req.Args
+		}
+		return errors.Wrapv(schema.Args.Validate(args), map[string]interface{}{"task": req.Task}, "invalid args")
+	}
+	return nil
+}
+
+// readTaskSchema reads the schema published next to a provider's task socket,
+// returning nil if there is none.
+func readTaskSchema(providerSocket string) (*acomm.TaskSchema, error) {
+	path := acomm.TaskSchemaPath(providerSocket)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapv(err, map[string]interface{}{"path": path})
+	}
+
+	schema := &acomm.TaskSchema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"path": path}, "failed to unmarshal task schema")
+	}
+	return schema, nil
+}
+
+// socketProviderName returns the provider name from a task socket path of the
+// form [priority]-[provider-name].sock.
+func socketProviderName(providerSocket string) string {
+	name := strings.TrimSuffix(filepath.Base(providerSocket), ".sock")
+	if idx := strings.Index(name, "-"); idx != -1 {
+		name = name[idx+1:]
+	}
+	return name
+}
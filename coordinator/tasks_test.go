@@ -0,0 +1,209 @@
+package coordinator_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/coordinator"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/jsonschema"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+func TestTasks(t *testing.T) {
+	suite.Run(t, new(TasksSuite))
+}
+
+type TasksSuite struct {
+	suite.Suite
+	configData     *coordinator.ConfigData
+	configFile     *os.File
+	server         *coordinator.Server
+	tracker        *acomm.Tracker
+	coordinatorURL *url.URL
+	result         chan *params
+	taskListeners  []*acomm.UnixListener
+}
+
+func (s *TasksSuite) SetupSuite() {
+	logrus.SetLevel(logrus.FatalLevel)
+
+	socketDir, err := ioutil.TempDir("", "coordinatorTest-")
+	s.Require().NoError(err, "failed to create socket dir")
+
+	s.configData = &coordinator.ConfigData{
+		SocketDir:      socketDir,
+		ServiceName:    uuid.New(),
+		ExternalPort:   45679,
+		RequestTimeout: 5,
+		ValidateArgs:   true,
+		LogLevel:       "fatal",
+	}
+
+	var config *coordinator.Config
+	config, _, _, s.configFile, err = newConfig(false, true, s.configData)
+	s.Require().NoError(err, "failed to create config")
+	s.Require().NoError(config.LoadConfig(), "failed to load config")
+
+	s.server, err = coordinator.NewServer(config)
+	s.Require().NoError(err, "failed to create server")
+	s.Require().NoError(s.server.Start(), "failed to start server")
+
+	s.coordinatorURL, _ = url.ParseRequestURI("unix://" + filepath.Join(socketDir, "coordinator", s.configData.ServiceName+".sock"))
+	s.tracker, err = acomm.NewTracker(filepath.Join(socketDir, "response", "tasksTest.sock"), nil, nil, 5*time.Second)
+	s.Require().NoError(err, "failed to create tracker")
+	s.Require().NoError(s.tracker.Start(), "failed to start tracker")
+
+	// A task with a schema published by two providers, and one without
+	s.result = make(chan *params, 10)
+	schema := &acomm.TaskSchema{
+		Task:        "foobar",
+		Description: "Echoes the args.",
+		Args:        jsonschema.Reflect(params{}),
+		Result:      jsonschema.Reflect(params{}),
+	}
+	s.startTask("foobar", "1-foo.sock", schema, "foo")
+	s.startTask("foobar", "2-bar.sock", schema, "bar")
+	s.startTask("baz", "1-baz.sock", nil, "")
+}
+
+func (s *TasksSuite) TearDownSuite() {
+	for _, taskListener := range s.taskListeners {
+		taskListener.Stop(0)
+	}
+	s.tracker.Stop()
+	s.server.Stop()
+	_ = os.Remove(s.configFile.Name())
+	_ = os.RemoveAll(s.configData.SocketDir)
+}
+
+// startTask starts an echo task listener, publishing the schema next to the
+// socket if it is not nil.
+func (s *TasksSuite) startTask(task, socket string, schema *acomm.TaskSchema, providerName string) {
+	socketPath := filepath.Join(s.configData.SocketDir, task, socket)
+	taskListener := acomm.NewUnixListener(socketPath, 0)
+	s.Require().NoError(taskListener.Start(), "failed to start task listener")
+	s.taskListeners = append(s.taskListeners, taskListener)
+
+	if schema != nil {
+		published := *schema
+		published.Providers = []string{providerName}
+		data, err := json.Marshal(published)
+		s.Require().NoError(err)
+		s.Require().NoError(ioutil.WriteFile(acomm.TaskSchemaPath(socketPath), data, 0644))
+	}
+
+	go func() {
+		for {
+			conn := taskListener.NextConn()
+			if conn == nil {
+				return
+			}
+			req := &acomm.Request{}
+			if err := acomm.UnmarshalConnData(conn, req); err != nil {
+				taskListener.DoneConn(conn)
+				continue
+			}
+			resp, _ := acomm.NewResponse(req, nil, nil, nil)
+			_ = acomm.SendConnData(conn, resp)
+			taskListener.DoneConn(conn)
+
+			resp, _ = acomm.NewResponse(req, req.Args, nil, nil)
+			_ = req.Respond(resp)
+		}
+	}()
+}
+
+func (s *TasksSuite) request(task string, args interface{}, result interface{}) error {
+	resp, err := s.tracker.SyncRequest(context.Background(), s.coordinatorURL, acomm.RequestOptions{
+		Task: task,
+		Args: args,
+	}, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	if result != nil {
+		return resp.UnmarshalResult(result)
+	}
+	return nil
+}
+
+func (s *TasksSuite) TestListTasks() {
+	result := &acomm.ListTasksResult{}
+	if !s.NoError(s.request(acomm.ListTasksTask, nil, result)) {
+		return
+	}
+	if !s.Len(result.Tasks, 2) {
+		return
+	}
+
+	baz := result.Tasks[0]
+	s.Equal("baz", baz.Task)
+	s.Equal([]string{"baz"}, baz.Providers, "should name providers without schemas")
+	s.Nil(baz.Args)
+
+	foobar := result.Tasks[1]
+	s.Equal("foobar", foobar.Task)
+	s.Equal([]string{"foo", "bar"}, foobar.Providers)
+	s.Equal("Echoes the args.", foobar.Description)
+	if s.NotNil(foobar.Args) {
+		s.Equal(jsonschema.TypeString, foobar.Args.Properties["ID"].Type)
+	}
+	s.NotNil(foobar.Result)
+}
+
+func (s *TasksSuite) TestDescribeTask() {
+	tests := []struct {
+		task string
+		code errors.Code
+	}{
+		{"foobar", ""},
+		{"baz", ""},
+		{"asdf", errors.CodeNotFound},
+		{"", errors.CodeInvalidArgument},
+	}
+
+	for _, test := range tests {
+		result := &acomm.TaskSchema{}
+		err := s.request(acomm.DescribeTaskTask, &acomm.DescribeTaskArgs{Task: test.task}, result)
+		if test.code != "" {
+			s.True(errors.IsCode(err, test.code), test.task)
+			continue
+		}
+		if s.NoError(err, test.task) {
+			s.Equal(test.task, result.Task)
+		}
+	}
+}
+
+func (s *TasksSuite) TestValidateArgs() {
+	tests := []struct {
+		description string
+		task        string
+		args        interface{}
+		valid       bool
+	}{
+		{"valid args", "foobar", &params{ID: "foo"}, true},
+		{"no args", "foobar", nil, true},
+		{"invalid args", "foobar", map[string]int{"ID": 1}, false},
+		{"no schema", "baz", map[string]int{"ID": 1}, true},
+	}
+
+	for _, test := range tests {
+		err := s.request(test.task, test.args, nil)
+		if test.valid {
+			s.NoError(err, test.description)
+		} else {
+			s.True(errors.IsCode(err, errors.CodeInvalidArgument), test.description)
+		}
+	}
+}
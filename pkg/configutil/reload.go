@@ -0,0 +1,165 @@
+package configutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// ReloadResult reports the settings changed by reloading a config file.
+// Settings are named by their config keys, with nested settings joined by
+// periods (e.g. tasks.foo.priority).
+type ReloadResult struct {
+	Applied         []string `json:"applied"`
+	RestartRequired []string `json:"restartRequired"`
+}
+
+// ConfigFile is a config file read into a viper instance that can be
+// reloaded while running. Reloaded settings are read into a new viper instance
+// that replaces the current one, so a viper instance is not modified once
+// published and can be read while reloading. The config file type is
+// determined by its extension. Changed settings that can't be applied while
+// running keep their current values until a restart.
+type ConfigFile struct {
+	reloadLock sync.Mutex
+	lock       sync.RWMutex
+	viper      *viper.Viper
+	newViper   func() (*viper.Viper, error)
+	path       string
+}
+
+// NewConfigFile creates a new ConfigFile for the viper instance. Reloaded
+// settings are read into viper instances created by newViper, which should
+// set up the same sources (e.g. flags) as the initial instance.
+func NewConfigFile(v *viper.Viper, newViper func() (*viper.Viper, error)) *ConfigFile {
+	return &ConfigFile{
+		viper:    v,
+		newViper: newViper,
+	}
+}
+
+// Viper returns the viper instance with the current settings. It should only
+// be read from.
+func (f *ConfigFile) Viper() *viper.Viper {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.viper
+}
+
+// Read reads the config file at the path into viper. It should be called
+// before the settings are in use.
+func (f *ConfigFile) Read(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapv(err, map[string]interface{}{"configFile": path}, "failed to read config file")
+	}
+
+	v := f.Viper()
+	v.SetConfigFile(path)
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return errors.Wrapv(err, map[string]interface{}{"configFile": path}, "failed to read config file")
+	}
+	f.path = path
+	return nil
+}
+
+// Reload reads the config file again into a new viper instance and validates
+// the new settings. If they can't be read or are not valid, the current
+// settings are kept. Changed settings for which live returns true are applied;
+// the rest keep their current values until a restart. If apply is not nil, it
+// is called with the new settings before they replace the current ones, and
+// the current settings are kept if it fails.
+func (f *ConfigFile) Reload(validate func(*viper.Viper) error, live func(key string) bool, apply func(*viper.Viper) error) (*ReloadResult, error) {
+	f.reloadLock.Lock()
+	defer f.reloadLock.Unlock()
+
+	if f.path == "" {
+		return nil, errors.New("no config file to reload")
+	}
+
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"configFile": f.path}, "failed to read config file")
+	}
+
+	v, err := f.newViper()
+	if err != nil {
+		return nil, err
+	}
+	v.SetConfigFile(f.path)
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"configFile": f.path}, "failed to read config file")
+	}
+	if err := validate(v); err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"configFile": f.path}, "invalid config")
+	}
+
+	before := flattenSettings("", f.Viper().AllSettings(), make(map[string]interface{}))
+	after := flattenSettings("", v.AllSettings(), make(map[string]interface{}))
+	result := &ReloadResult{
+		Applied:         []string{},
+		RestartRequired: []string{},
+	}
+	for _, key := range changedSettings(before, after) {
+		if live(key) {
+			result.Applied = append(result.Applied, key)
+			continue
+		}
+		result.RestartRequired = append(result.RestartRequired, key)
+		// Keep the current value until a restart
+		if value, ok := before[key]; ok {
+			v.Set(key, value)
+		}
+	}
+
+	if apply != nil {
+		if err := apply(v); err != nil {
+			return nil, err
+		}
+	}
+
+	f.lock.Lock()
+	f.viper = v
+	f.lock.Unlock()
+
+	return result, nil
+}
+
+// flattenSettings adds nested settings to the flattened map under their full
+// keys.
+func flattenSettings(prefix string, settings map[string]interface{}, flattened map[string]interface{}) map[string]interface{} {
+	for key, value := range settings {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			flattenSettings(key, nested, flattened)
+			continue
+		}
+		flattened[key] = value
+	}
+	return flattened
+}
+
+// changedSettings returns the sorted keys of settings that differ between the
+// flattened settings.
+func changedSettings(before, after map[string]interface{}) []string {
+	changed := make([]string, 0)
+	for key, value := range before {
+		if afterValue, ok := after[key]; !ok || !reflect.DeepEqual(value, afterValue) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,97 @@
+package configutil_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/cerana/cerana/pkg/configutil"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+func (s *ConfigUtil) TestConfigFile() {
+	file, err := ioutil.TempFile("", "configUtilTest-")
+	s.Require().NoError(err)
+	_ = file.Close()
+	_ = os.Remove(file.Name())
+
+	// The config file type is determined by its extension when reloading
+	filePath := file.Name() + ".json"
+	defer func() { _ = os.Remove(filePath) }()
+
+	write := func(data string) {
+		s.Require().NoError(ioutil.WriteFile(filePath, []byte(data), 0644))
+	}
+	validate := func(v *viper.Viper) error {
+		if v.GetString("name") == "" {
+			return errors.New("missing name")
+		}
+		return nil
+	}
+	live := func(key string) bool {
+		return key == "level" || strings.HasPrefix(key, "tasks.")
+	}
+
+	newViper := func() (*viper.Viper, error) {
+		return viper.New(), nil
+	}
+	v, _ := newViper()
+	configFile := configutil.NewConfigFile(v, newViper)
+	_, err = configFile.Reload(validate, live, nil)
+	s.Error(err, "should not reload before reading a config file")
+
+	write(`{"name": "foo", "level": "info", "tasks": {"bar": {"priority": 1}}}`)
+	s.Require().NoError(configFile.Read(filePath))
+	s.True(v == configFile.Viper())
+	s.Equal("foo", v.GetString("name"))
+
+	write(`{"name": "baz", "level": "debug", "tasks": {"bar": {"priority": 2}}}`)
+	result, err := configFile.Reload(validate, live, nil)
+	if s.NoError(err) {
+		s.Equal([]string{"level", "tasks.bar.priority"}, result.Applied)
+		s.Equal([]string{"name"}, result.RestartRequired)
+	}
+	s.Equal("info", v.GetString("level"), "should not modify the previous viper instance")
+	v = configFile.Viper()
+	s.Equal("debug", v.GetString("level"), "should apply live settings")
+	s.Equal(2, v.GetInt("tasks.bar.priority"), "should apply nested live settings")
+	s.Equal("foo", v.GetString("name"), "should keep settings requiring a restart")
+
+	write(`{"name": "foo", "level": "debug", "tasks": {"bar": {"priority": 2}}}`)
+	result, err = configFile.Reload(validate, live, nil)
+	if s.NoError(err) {
+		s.Empty(result.Applied)
+		s.Empty(result.RestartRequired, "should not require a restart once reverted")
+	}
+	v = configFile.Viper()
+
+	write(`{"level": "warn"}`)
+	_, err = configFile.Reload(validate, live, nil)
+	s.Error(err, "should not reload an invalid config")
+	s.True(v == configFile.Viper(), "should keep the previous config")
+
+	write(`{"name":`)
+	_, err = configFile.Reload(validate, live, nil)
+	s.Error(err, "should not reload an unparseable config")
+	s.True(v == configFile.Viper(), "should keep the previous config")
+
+	write(`{"name": "foo", "level": "error"}`)
+	var applied *viper.Viper
+	_, err = configFile.Reload(validate, live, func(v *viper.Viper) error {
+		applied = v
+		return errors.New("failed to apply")
+	})
+	s.Error(err, "should not reload a config that failed to apply")
+	s.True(v == configFile.Viper(), "should keep the previous config")
+	if s.NotNil(applied) {
+		s.Equal("error", applied.GetString("level"), "should apply the new settings")
+	}
+
+	_, err = configFile.Reload(validate, live, func(v *viper.Viper) error {
+		applied = v
+		return nil
+	})
+	s.NoError(err)
+	s.True(applied == configFile.Viper(), "should publish the applied config")
+}
@@ -0,0 +1,111 @@
+package errors
+
+import "errors"
+
+// Code classifies an error by the kind of failure.
+type Code string
+
+// Error codes.
+const (
+	CodeNotFound        Code = "not_found"
+	CodeAlreadyExists   Code = "already_exists"
+	CodeInvalidArgument Code = "invalid_argument"
+	CodeTimeout         Code = "timeout"
+	CodeUnavailable     Code = "unavailable"
+	CodeConflict        Code = "conflict"
+	CodeForbidden       Code = "forbidden"
+)
+
+// coder is implemented by errors that classify themselves with a Code.
+type coder interface {
+	Code() Code
+}
+
+// temporary is implemented by errors that may be marked as temporary.
+type temporary interface {
+	Temporary() bool
+}
+
+// NewWithCode returns a new error with callstack, classified with the code,
+// that formats as the given text and associates the supplied data with the
+// error.
+func NewWithCode(code Code, msg string, values map[string]interface{}) error {
+	eExt := fromError(errors.New(msg))
+	eExt.code = code
+	return Wrapv(eExt, values)
+}
+
+// WithCode classifies an error with the code, creating a callstack if
+// necessary. The error passed in is left unchanged.
+func WithCode(err error, code Code) error {
+	if err == nil {
+		return nil
+	}
+
+	eExt, ok := err.(*errorExt)
+	if ok {
+		eExt = eExt.copy()
+	} else {
+		eExt = fromError(err)
+	}
+	eExt.code = code
+	return eExt
+}
+
+// MarkTemporary marks an error as temporary, a failure that may succeed if
+// retried, creating a callstack if necessary. The error passed in is left
+// unchanged.
+func MarkTemporary(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	eExt, ok := err.(*errorExt)
+	if ok {
+		eExt = eExt.copy()
+	} else {
+		eExt = fromError(err)
+	}
+	eExt.temporary = true
+	return eExt
+}
+
+// GetCode returns the code classifying the error, or an empty Code if there
+// is none. A code set with WithCode takes precedence over one provided by the
+// underlying cause.
+func GetCode(err error) Code {
+	if eExt, ok := err.(*errorExt); ok && eExt.code != "" {
+		return eExt.code
+	}
+	if c, ok := Cause(err).(coder); ok {
+		return c.Code()
+	}
+	return ""
+}
+
+// IsCode returns whether the error is classified with the code.
+func IsCode(err error, code Code) bool {
+	return err != nil && code != "" && GetCode(err) == code
+}
+
+// IsTemporary returns whether the error is marked as temporary, either with
+// MarkTemporary or by the underlying cause's Temporary method.
+func IsTemporary(err error) bool {
+	if eExt, ok := err.(*errorExt); ok && eExt.temporary {
+		return true
+	}
+	t, ok := Cause(err).(temporary)
+	return ok && t.Temporary()
+}
+
+// copy returns a copy of the error that can be classified without changing
+// the original, which may be shared.
+func (e *errorExt) copy() *errorExt {
+	eCopy := *e
+	eCopy.context = append(make([]string, 0, len(e.context)), e.context...)
+	eCopy.data = make(map[string]interface{}, len(e.data))
+	for key, value := range e.data {
+		eCopy.data[key] = value
+	}
+	return &eCopy
+}
@@ -0,0 +1,82 @@
+package errors
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+type codedErr struct{}
+
+func (codedErr) Error() string   { return "coded" }
+func (codedErr) Code() Code      { return CodeConflict }
+func (codedErr) Temporary() bool { return true }
+
+func (s *Errors) TestNewWithCode() {
+	err := NewWithCode(CodeNotFound, "missing", map[string]interface{}{"foo": "bar"})
+	eExt, ok := err.(*errorExt)
+	if !s.True(ok, "wrong error return type") {
+		return
+	}
+	s.Equal("missing", err.Error())
+	s.Equal("bar", eExt.data["foo"], "data should be set")
+	s.True(len(eExt.pcs) > 0, "callstack should be generated")
+	s.Equal(CodeNotFound, GetCode(err))
+	s.True(IsCode(err, CodeNotFound))
+	s.False(IsCode(err, CodeConflict))
+}
+
+func (s *Errors) TestWithCode() {
+	s.Nil(WithCode(nil, CodeNotFound))
+
+	err := errors.New("an error")
+	s.Equal(Code(""), GetCode(err))
+	s.False(IsCode(err, ""), "should not match an empty code")
+
+	coded := WithCode(err, CodeTimeout)
+	s.Equal(CodeTimeout, GetCode(coded))
+	s.Equal(err, Cause(coded))
+	s.Equal(CodeTimeout, GetCode(Wrap(coded, "context")), "code should survive wrapping")
+
+	// Codes from the cause, overridden by WithCode
+	s.Equal(CodeConflict, GetCode(codedErr{}))
+	s.Equal(CodeConflict, GetCode(Wrap(codedErr{})))
+	s.Equal(CodeUnavailable, GetCode(WithCode(codedErr{}, CodeUnavailable)))
+
+	// Classifying a shared error leaves it unchanged
+	shared := Newv("shared", map[string]interface{}{"foo": "bar"})
+	coded = Wrap(WithCode(shared, CodeNotFound), "context")
+	s.Equal(CodeNotFound, GetCode(coded))
+	s.Equal(Code(""), GetCode(shared), "should not classify the original")
+	s.Equal("shared", shared.Error(), "should not add context to the original")
+}
+
+func (s *Errors) TestTemporary() {
+	s.Nil(MarkTemporary(nil))
+	s.False(IsTemporary(nil))
+
+	err := errors.New("an error")
+	s.False(IsTemporary(err))
+	s.False(IsTemporary(Wrap(err)))
+	s.True(IsTemporary(MarkTemporary(err)))
+	s.True(IsTemporary(codedErr{}))
+	s.True(IsTemporary(Wrap(codedErr{})))
+
+	shared := New("shared")
+	s.True(IsTemporary(MarkTemporary(shared)))
+	s.False(IsTemporary(shared), "should not mark the original")
+}
+
+func (s *Errors) TestMarshalJSONCode() {
+	err := MarkTemporary(NewWithCode(CodeUnavailable, "down", nil))
+	j, jmErr := json.Marshal(err)
+	if !s.NoError(jmErr, "failed to marshal error") {
+		return
+	}
+
+	output := make(map[string]interface{})
+	if !s.NoError(json.Unmarshal(j, &output), "failed to unmarshal output") {
+		return
+	}
+	s.Equal(string(CodeUnavailable), output["code"])
+	s.Equal(true, output["temporary"])
+}
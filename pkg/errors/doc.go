@@ -3,5 +3,12 @@ Package errors provides richer error handling functionality
 
 Errors created or wrapped include a stack trace, optional additional
 context messages, and optional additional relevant data.
+
+Errors may be classified with a Code describing the kind of failure, such as
+CodeNotFound or CodeUnavailable, and marked as temporary when the failure may
+succeed if retried. Both are preserved when an error is sent as an acomm
+Response error, so callers, including remote ones, can handle failures without
+matching on error messages. Errors whose underlying cause implements a Code or
+Temporary method are classified by it.
 */
 package errors
@@ -13,10 +13,12 @@ import (
 const stackDepth uint = 32
 
 type errorExt struct {
-	cause   error
-	context []string
-	data    map[string]interface{}
-	pcs     []uintptr
+	cause     error
+	context   []string
+	data      map[string]interface{}
+	pcs       []uintptr
+	code      Code
+	temporary bool
 }
 
 func (e *errorExt) Error() string {
@@ -58,6 +60,12 @@ func (e *errorExt) MarshalJSON() ([]byte, error) {
 	// add library fields last to avoid being overwritten
 	outputMap["cause"] = e.Error()
 	outputMap["stack"] = callstack(e.pcs)
+	if code := GetCode(e); code != "" {
+		outputMap["code"] = code
+	}
+	if IsTemporary(e) {
+		outputMap["temporary"] = true
+	}
 
 	output, err := json.Marshal(outputMap)
 	if err != nil {
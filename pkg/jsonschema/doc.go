@@ -0,0 +1,16 @@
+/*
+Package jsonschema derives JSON Schemas from Go types and validates JSON
+against them.
+
+Reflect builds a schema from the type of a value, following the same rules as
+encoding/json: exported fields are properties named by their json tags,
+embedded structs are flattened, and fields tagged "-" are left out. Types with
+their own JSON encoding, interfaces, and recursive types are described by an
+empty schema, which accepts any value.
+
+Validate checks that JSON data could be unmarshaled into the type a schema was
+derived from. Like encoding/json, it accepts null for any value, ignores
+unknown object properties, and matches property names case-insensitively if
+there is no exact match.
+*/
+package jsonschema
@@ -0,0 +1,150 @@
+package jsonschema_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/jsonschema"
+	"github.com/stretchr/testify/suite"
+)
+
+type Embedded struct {
+	ID    int  `json:"id"`
+	Extra bool `json:"extra"`
+}
+
+type Nested struct {
+	Next *Nested `json:"next"`
+}
+
+type TestArgs struct {
+	Embedded
+	ID       string         `json:"id"`
+	Name     int            `json:"name"`
+	Count    uint64         `json:"count"`
+	Ratio    float64        `json:"ratio,omitempty"`
+	Enabled  bool           `json:"enabled"`
+	Tags     []string       `json:"tags"`
+	Data     []byte         `json:"data"`
+	Labels   map[string]int `json:"labels"`
+	Created  time.Time      `json:"created"`
+	TTL      time.Duration  `json:"ttl"`
+	IP       net.IP         `json:"ip"`
+	Quoted   int            `json:"quoted,string"`
+	Any      interface{}    `json:"any"`
+	Nested   *Nested        `json:"nested"`
+	Ignored  string         `json:"-"`
+	Untagged string
+	hidden   string
+	Settings map[string]string `json:"settings"`
+}
+
+type JSONSchema struct {
+	suite.Suite
+	schema *jsonschema.Schema
+}
+
+func TestJSONSchema(t *testing.T) {
+	suite.Run(t, new(JSONSchema))
+}
+
+func (s *JSONSchema) SetupTest() {
+	s.schema = jsonschema.Reflect(TestArgs{})
+}
+
+func (s *JSONSchema) TestReflect() {
+	s.Nil(jsonschema.Reflect(nil))
+
+	schema := s.schema
+	s.Equal(jsonschema.TypeObject, schema.Type)
+
+	tests := map[string]struct {
+		typ    string
+		format string
+	}{
+		"id":       {jsonschema.TypeString, ""}, // shadows the embedded field
+		"name":     {jsonschema.TypeInteger, ""},
+		"count":    {jsonschema.TypeInteger, ""},
+		"ratio":    {jsonschema.TypeNumber, ""},
+		"enabled":  {jsonschema.TypeBoolean, ""},
+		"tags":     {jsonschema.TypeArray, ""},
+		"data":     {jsonschema.TypeString, "byte"},
+		"labels":   {jsonschema.TypeObject, ""},
+		"created":  {jsonschema.TypeString, "date-time"},
+		"ttl":      {jsonschema.TypeInteger, ""},
+		"ip":       {jsonschema.TypeString, "ip"},
+		"quoted":   {jsonschema.TypeString, ""},
+		"any":      {"", ""},
+		"nested":   {jsonschema.TypeObject, ""},
+		"extra":    {jsonschema.TypeBoolean, ""},
+		"Untagged": {jsonschema.TypeString, ""},
+		"settings": {jsonschema.TypeObject, ""},
+	}
+	s.Len(schema.Properties, len(tests))
+	for name, test := range tests {
+		prop, ok := schema.Properties[name]
+		if !s.True(ok, name) {
+			continue
+		}
+		s.Equal(test.typ, prop.Type, name)
+		s.Equal(test.format, prop.Format, name)
+	}
+
+	s.NotContains(schema.Properties, "Ignored")
+	s.NotContains(schema.Properties, "hidden")
+
+	if s.NotNil(schema.Properties["count"].Minimum) {
+		s.Equal(float64(0), *schema.Properties["count"].Minimum)
+	}
+	s.Equal(jsonschema.TypeString, schema.Properties["tags"].Items.Type)
+	s.Equal(jsonschema.TypeInteger, schema.Properties["labels"].AdditionalProperties.Type)
+
+	next := schema.Properties["nested"].Properties["next"]
+	if s.NotNil(next) {
+		s.Equal("", next.Type, "recursive type should accept any value")
+	}
+}
+
+func (s *JSONSchema) TestValidate() {
+	tests := []struct {
+		description string
+		data        string
+		valid       bool
+	}{
+		{"empty", ``, true},
+		{"null", `null`, true},
+		{"empty object", `{}`, true},
+		{"valid", `{"id":"foo","name":1,"count":2,"ratio":1.5,"enabled":true,"tags":["a"],"labels":{"a":1},"ttl":100,"any":[1,"a"],"nested":{"next":{"next":5}}}`, true},
+		{"null field", `{"id":null}`, true},
+		{"unknown field", `{"unknown":1}`, true},
+		{"case insensitive", `{"ID":"foo"}`, true},
+		{"not object", `[]`, false},
+		{"string", `{"id":1}`, false},
+		{"integer", `{"name":1.5}`, false},
+		{"minimum", `{"count":-1}`, false},
+		{"number", `{"ratio":"1"}`, false},
+		{"boolean", `{"enabled":"true"}`, false},
+		{"array", `{"tags":"a"}`, false},
+		{"array item", `{"tags":["a",1]}`, false},
+		{"map value", `{"labels":{"a":"b"}}`, false},
+		{"case insensitive invalid", `{"ID":1}`, false},
+		{"invalid json", `{`, false},
+	}
+
+	for _, test := range tests {
+		err := s.schema.Validate([]byte(test.data))
+		if test.valid {
+			s.NoError(err, test.description)
+			continue
+		}
+		if !s.Error(err, test.description) {
+			continue
+		}
+		s.True(errors.IsCode(err, errors.CodeInvalidArgument), test.description)
+	}
+
+	var schema *jsonschema.Schema
+	s.NoError(schema.Validate([]byte(`{"id":1}`)), "nil schema should accept anything")
+}
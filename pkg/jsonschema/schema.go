@@ -0,0 +1,163 @@
+package jsonschema
+
+import (
+	"encoding"
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// JSON Schema types.
+const (
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeString  = "string"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+)
+
+// Schema is a JSON Schema. A Schema without a Type accepts any value.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	ipType            = reflect.TypeOf(net.IP{})
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Reflect returns the schema of the type of v, or nil if v is nil.
+func Reflect(v interface{}) *Schema {
+	if v == nil {
+		return nil
+	}
+	return reflectType(reflect.TypeOf(v), make(map[reflect.Type]bool))
+}
+
+// reflectType returns the schema of a type. Types currently being reflected
+// are tracked in seen to stop at recursive types.
+func reflectType(t reflect.Type, seen map[reflect.Type]bool) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: TypeString, Format: "date-time"}
+	case durationType:
+		return &Schema{Type: TypeInteger, Description: "duration in nanoseconds"}
+	case ipType:
+		return &Schema{Type: TypeString, Format: "ip"}
+	}
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return &Schema{}
+	}
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return &Schema{Type: TypeString}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: TypeBoolean}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: TypeInteger}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		min := float64(0)
+		return &Schema{Type: TypeInteger, Minimum: &min}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: TypeNumber}
+	case reflect.String:
+		return &Schema{Type: TypeString}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return &Schema{Type: TypeString, Format: "byte"}
+		}
+		return &Schema{Type: TypeArray, Items: reflectType(t.Elem(), seen)}
+	case reflect.Map:
+		return &Schema{Type: TypeObject, AdditionalProperties: reflectType(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			return &Schema{}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+
+		s := &Schema{Type: TypeObject, Properties: make(map[string]*Schema)}
+		reflectFields(t, s.Properties, seen)
+		return s
+	default:
+		// Interfaces, and types that can't be encoded
+		return &Schema{}
+	}
+}
+
+// reflectFields adds the schemas of a struct's fields to properties,
+// flattening untagged embedded structs. Fields of the outer struct take
+// precedence over embedded fields of the same name.
+func reflectFields(t reflect.Type, properties map[string]*Schema, seen map[reflect.Type]bool) {
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx != -1 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			// Unexported
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := reflectType(field.Type, seen)
+		for _, opt := range strings.Split(opts, ",") {
+			if opt == "string" {
+				schema = &Schema{Type: TypeString}
+			}
+		}
+		properties[name] = schema
+	}
+
+	for _, et := range embedded {
+		if seen[et] {
+			continue
+		}
+		seen[et] = true
+		fields := make(map[string]*Schema)
+		reflectFields(et, fields, seen)
+		delete(seen, et)
+		for name, schema := range fields {
+			if _, ok := properties[name]; !ok {
+				properties[name] = schema
+			}
+		}
+	}
+}
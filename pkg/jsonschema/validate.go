@@ -0,0 +1,122 @@
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+// Validate checks JSON data against the schema. The error for invalid data
+// has the errors.CodeInvalidArgument code and names the path to the invalid
+// value.
+func (s *Schema) Validate(data []byte) error {
+	if s == nil || len(data) == 0 {
+		return nil
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return errors.WithCode(errors.Wrap(err, "invalid json"), errors.CodeInvalidArgument)
+	}
+	return s.validate("", value)
+}
+
+func (s *Schema) validate(path string, value interface{}) error {
+	if s == nil || s.Type == "" || value == nil {
+		return nil
+	}
+
+	switch s.Type {
+	case TypeObject:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return s.invalid(path, value)
+		}
+		for key, v := range obj {
+			prop := s.Property(key)
+			if prop == nil {
+				prop = s.AdditionalProperties
+			}
+			if err := prop.validate(joinPath(path, key), v); err != nil {
+				return err
+			}
+		}
+	case TypeArray:
+		arr, ok := value.([]interface{})
+		if !ok {
+			return s.invalid(path, value)
+		}
+		for i, v := range arr {
+			if err := s.Items.validate(joinPath(path, strconv.Itoa(i)), v); err != nil {
+				return err
+			}
+		}
+	case TypeString:
+		if _, ok := value.(string); !ok {
+			return s.invalid(path, value)
+		}
+	case TypeBoolean:
+		if _, ok := value.(bool); !ok {
+			return s.invalid(path, value)
+		}
+	case TypeNumber, TypeInteger:
+		num, ok := value.(json.Number)
+		if !ok {
+			return s.invalid(path, value)
+		}
+		f, err := num.Float64()
+		if err != nil {
+			return s.invalid(path, value)
+		}
+		if s.Type == TypeInteger && f != math.Trunc(f) {
+			return s.invalid(path, value)
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			return errors.NewWithCode(errors.CodeInvalidArgument, "value below minimum", map[string]interface{}{
+				"path":    path,
+				"minimum": *s.Minimum,
+				"value":   value,
+			})
+		}
+	}
+	return nil
+}
+
+// Property returns the schema of an object property, matched the same way as
+// encoding/json: exactly, or else case-insensitively. It returns nil if the
+// schema has no such property.
+func (s *Schema) Property(key string) *Schema {
+	if s == nil {
+		return nil
+	}
+	if prop, ok := s.Properties[key]; ok {
+		return prop
+	}
+	for name, prop := range s.Properties {
+		if strings.EqualFold(name, key) {
+			return prop
+		}
+	}
+	return nil
+}
+
+func (s *Schema) invalid(path string, value interface{}) error {
+	return errors.NewWithCode(errors.CodeInvalidArgument, "value does not match schema", map[string]interface{}{
+		"path":     path,
+		"expected": s.Type,
+		"value":    value,
+	})
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -116,7 +116,7 @@ func (c *ckv) cas(key string, value kv.Value) error {
 
 	if !valid {
 		// TODO(mm) better error
-		return errors.Newv("CAS failed", map[string]interface{}{"key": key, "value": value})
+		return errors.NewWithCode(errors.CodeConflict, "CAS failed", map[string]interface{}{"key": key, "value": value})
 	}
 
 	return nil
@@ -143,7 +143,7 @@ func (c *ckv) Remove(key string, index uint64) error {
 	}
 
 	if !ok {
-		err = errors.Newv("failed to delete atomically", map[string]interface{}{"key": key, "index": index})
+		err = errors.NewWithCode(errors.CodeConflict, "failed to delete atomically", map[string]interface{}{"key": key, "index": index})
 	}
 
 	return err
@@ -249,7 +249,7 @@ func (c *ckv) lock(key string, ttl time.Duration, behavior string) (string, erro
 		return "", errors.Wrapv(err, map[string]interface{}{"key": key, "session": session})
 	}
 	if !ok {
-		return "", errors.Newv("lock held by another client", map[string]interface{}{"key": key})
+		return "", errors.NewWithCode(errors.CodeConflict, "lock held by another client", map[string]interface{}{"key": key})
 	}
 	return session, nil
 }
@@ -125,6 +125,9 @@ func (e *ekv) Update(key string, value kv.Value) (uint64, error) {
 		err = errors.Wrapv(err, map[string]interface{}{"key": key, "value": value}, "failed to update key")
 	}
 	if err != nil {
+		if e.isConflict(err) {
+			err = errors.WithCode(err, errors.CodeConflict)
+		}
 		return 0, err
 	}
 	return resp.Node.ModifiedIndex, nil
@@ -132,6 +135,9 @@ func (e *ekv) Update(key string, value kv.Value) (uint64, error) {
 
 func (e *ekv) Remove(key string, index uint64) error {
 	_, err := e.e.CompareAndDelete(key, "", index)
+	if e.isConflict(err) {
+		err = errors.WithCode(err, errors.CodeConflict)
+	}
 	return errors.Wrapv(err, map[string]interface{}{"key": key, "index": index})
 }
 
@@ -145,6 +151,14 @@ func (e *ekv) isKeyExists(err error) bool {
 	return ok && eErr.ErrorCode == etcdErr.EcodeNodeExist
 }
 
+// isConflict returns whether the error is from a create or compare-and-swap
+// failing because the key already exists or was changed, matching the
+// conflicts reported by other kv implementations.
+func (e *ekv) isConflict(err error) bool {
+	eErr, ok := errors.Cause(err).(*etcd.EtcdError)
+	return ok && (eErr.ErrorCode == etcdErr.EcodeNodeExist || eErr.ErrorCode == etcdErr.EcodeTestFailed)
+}
+
 var typeE2KV = map[string]kv.EventType{
 	"compareAndSwap": kv.Update,
 	"create":         kv.Create,
@@ -142,8 +142,10 @@ type KV interface {
 
 	// Atomic operations
 	// Update will set key=value while ensuring that newer values are not clobbered
+	// Clobbering is refused with an errors.CodeConflict error
 	Update(string, Value) (uint64, error)
 	// Remove will delete key only if it has not been modified since index
+	// Otherwise it fails with an errors.CodeConflict error
 	Remove(string, uint64) error
 
 	// IsKeyNotFound is a helper to determine if the error is a key not found error
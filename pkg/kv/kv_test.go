@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/cerana/cerana/internal/tests/common"
+	"github.com/cerana/cerana/pkg/errors"
 	"github.com/cerana/cerana/pkg/kv"
 	consul "github.com/cerana/cerana/pkg/kv/consul"
 	etcd "github.com/cerana/cerana/pkg/kv/etcd"
@@ -250,8 +251,10 @@ func (s *KVSuite) TestUpdate() {
 
 	_, err = s.KV.Update("lochness/some-key", kv.Value{Data: []byte("2")})
 	s.Require().Error(err)
+	s.True(errors.IsCode(err, errors.CodeConflict), "should be a conflict")
 	_, err = s.KV.Update("lochness/some-key", kv.Value{Data: []byte("2"), Index: idx - 1})
 	s.Require().Error(err)
+	s.True(errors.IsCode(err, errors.CodeConflict), "should be a conflict")
 
 	idx2, err := s.KV.Update("lochness/some-key", kv.Value{Data: []byte("2"), Index: idx})
 	s.Require().NoError(err)
@@ -265,7 +268,9 @@ func (s *KVSuite) TestRemove() {
 	s.Require().NoError(err)
 	s.Require().True(idx > 0)
 
-	s.Require().Error(s.KV.Remove("lochness/some-key", idx-1))
+	err = s.KV.Remove("lochness/some-key", idx-1)
+	s.Require().Error(err)
+	s.True(errors.IsCode(err, errors.CodeConflict), "should be a conflict")
 	v, err := s.KV.Get("lochness/some-key")
 	s.Require().NoError(err)
 	s.Require().True(v.Index == idx)
@@ -15,13 +15,17 @@ func DefaultSetup(logLevel string) error {
 	return nil
 }
 
-// SetLevel parses and sets the log level
+// SetLevel parses and sets the log level. Logrus reads the level without
+// locking, so it is only set if it changed, letting a config reload run while
+// logging.
 func SetLevel(logLevel string) error {
 	level, err := logrus.ParseLevel(logLevel)
 	if err != nil {
 		return errors.Wrapv(err, map[string]interface{}{"logLevel": logLevel})
 	}
-	logrus.SetLevel(level)
+	if logrus.GetLevel() != level {
+		logrus.SetLevel(level)
+	}
 	return nil
 }
 
@@ -0,0 +1,16 @@
+/*
+Package prometheusx holds the Prometheus metrics reported by cerana's
+coordinator, providers, and request tracker, and serves them.
+
+All metrics are in the "cerana" namespace and are registered with the default
+Prometheus registry, so they are reported by any process that records them.
+Metrics about requests are labeled consistently: "task" is the task name,
+"provider" is the service name of a provider, and "outcome" is "success" or,
+for failures, the error code (e.g. "timeout", "not_found") or "error" if the
+error has no code.
+
+Handler serves the metrics for a Prometheus server to scrape. The coordinator
+serves them at /metrics on its external port, and a provider serves them at
+/metrics on its metrics_port, if one is configured.
+*/
+package prometheusx
@@ -0,0 +1,127 @@
+package prometheusx
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "cerana"
+
+// Outcome label values that aren't error codes.
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+var (
+	// CoordinatorRequests counts the requests received by a coordinator, by
+	// task and the outcome of routing them.
+	CoordinatorRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "coordinator",
+		Name:      "requests_total",
+		Help:      "Requests received by the coordinator, by task and routing outcome.",
+	}, []string{"task", "outcome"})
+
+	// CoordinatorResponses counts the final responses to requests that come
+	// back through a coordinator, by task and outcome.
+	CoordinatorResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "coordinator",
+		Name:      "responses_total",
+		Help:      "Final responses to requests routed by the coordinator, by task and outcome.",
+	}, []string{"task", "outcome"})
+
+	// HandlerDuration observes the time taken by provider task handlers, by
+	// provider, task, and outcome.
+	HandlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "provider",
+		Name:      "handler_duration_seconds",
+		Help:      "Time taken by provider task handlers, by provider, task, and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider", "task", "outcome"})
+
+	// ProxyDuration observes the time from a tracker proxying a request until
+	// it receives the response, by task and outcome.
+	ProxyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "tracker",
+		Name:      "proxy_duration_seconds",
+		Help:      "Time from proxying a request to receiving its response, by task and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"task", "outcome"})
+
+	// TrackerInFlight is the number of requests awaiting responses in
+	// trackers.
+	TrackerInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "tracker",
+		Name:      "requests_in_flight",
+		Help:      "Requests awaiting responses.",
+	})
+
+	// TrackerTimeouts counts the requests that timed out in trackers, by task.
+	TrackerTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "tracker",
+		Name:      "timeouts_total",
+		Help:      "Requests that timed out awaiting responses, by task.",
+	}, []string{"task"})
+
+	// StreamBytes counts the bytes of streamed data served by trackers.
+	StreamBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "tracker",
+		Name:      "stream_bytes_total",
+		Help:      "Bytes of streamed data served.",
+	})
+
+	// KVDuration observes the time taken by requests to the kv provider's
+	// backend, by operation and outcome.
+	KVDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "kv",
+		Name:      "backend_duration_seconds",
+		Help:      "Time taken by requests to the kv backend, by operation and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "outcome"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		CoordinatorRequests,
+		CoordinatorResponses,
+		HandlerDuration,
+		ProxyDuration,
+		TrackerInFlight,
+		TrackerTimeouts,
+		StreamBytes,
+		KVDuration,
+	)
+}
+
+// Handler returns an http.Handler serving the metrics.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Outcome returns the outcome label value for the error of a request.
+func Outcome(err error) string {
+	if err == nil {
+		return OutcomeSuccess
+	}
+	if code := errors.GetCode(err); code != "" {
+		return string(code)
+	}
+	return OutcomeError
+}
+
+// Since returns the seconds elapsed since a time, for observing durations.
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
@@ -0,0 +1,51 @@
+package prometheusx_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cerrors "github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/prometheusx"
+	"github.com/stretchr/testify/suite"
+)
+
+type MetricsSuite struct {
+	suite.Suite
+}
+
+func TestMetrics(t *testing.T) {
+	suite.Run(t, new(MetricsSuite))
+}
+
+func (s *MetricsSuite) TestOutcome() {
+	tests := []struct {
+		description string
+		err         error
+		expected    string
+	}{
+		{"nil", nil, prometheusx.OutcomeSuccess},
+		{"plain", errors.New("foo"), prometheusx.OutcomeError},
+		{"wrapped", cerrors.Wrap(errors.New("foo")), prometheusx.OutcomeError},
+		{"code", cerrors.NewWithCode(cerrors.CodeNotFound, "foo", nil), "not_found"},
+		{"wrapped code", cerrors.Wrap(cerrors.WithCode(errors.New("foo"), cerrors.CodeTimeout)), "timeout"},
+	}
+
+	for _, test := range tests {
+		s.Equal(test.expected, prometheusx.Outcome(test.err), test.description)
+	}
+}
+
+func (s *MetricsSuite) TestHandler() {
+	prometheusx.TrackerTimeouts.WithLabelValues("foobar").Inc()
+
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	s.Require().NoError(err)
+	w := httptest.NewRecorder()
+	prometheusx.Handler().ServeHTTP(w, req)
+	s.Equal(http.StatusOK, w.Code)
+	body := w.Body.String()
+	s.Contains(body, `cerana_tracker_timeouts_total{task="foobar"} 1`, "should report recorded metrics")
+	s.Contains(body, "cerana_tracker_requests_in_flight", "should report metrics without labels")
+}
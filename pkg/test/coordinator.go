@@ -3,6 +3,7 @@ package test
 import (
 	"io/ioutil"
 	"math/rand"
+	"net/url"
 	"os"
 	"path/filepath"
 	"time"
@@ -21,6 +22,7 @@ type Coordinator struct {
 	HTTPPort       int
 	coordinatorURL string
 	coordinator    *coordinator.Server
+	viper          *viper.Viper
 	providerName   string
 	providerServer *provider.Server
 }
@@ -65,6 +67,7 @@ func NewCoordinator(baseDir string) (*Coordinator, error) {
 		HTTPPort:       port,
 		coordinatorURL: coordinatorSocket,
 		coordinator:    coordinatorServer,
+		viper:          coordinatorViper,
 	}
 
 	c.providerName = "testProvider"
@@ -95,11 +98,25 @@ func (c *Coordinator) NewProviderViper() *viper.Viper {
 	return v
 }
 
+// SetNodeCoordinatorPort sets the external port of the coordinators that
+// requests targeting a node are routed to, such as the HTTPPort of another
+// Coordinator standing in for the node. It should be called before Start.
+func (c *Coordinator) SetNodeCoordinatorPort(port int) {
+	c.viper.Set("node_coordinator_port", port)
+}
+
 // ProviderTracker returns the tracker of the provider server.
 func (c *Coordinator) ProviderTracker() *acomm.Tracker {
 	return c.providerServer.Tracker()
 }
 
+// NewClient returns an acomm client sending requests through the coordinator
+// with the tracker of the provider server.
+func (c *Coordinator) NewClient() *acomm.Client {
+	coordinatorURL, _ := url.ParseRequestURI(c.coordinatorURL)
+	return acomm.NewClient(c.ProviderTracker(), coordinatorURL, 20*time.Second)
+}
+
 // RegisterProvider registers a Provider's tasks with the internal Provider
 // server.
 func (c *Coordinator) RegisterProvider(p provider.Provider) {
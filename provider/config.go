@@ -3,9 +3,12 @@ package provider
 import (
 	"fmt"
 	"net/url"
-	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/configutil"
 	"github.com/cerana/cerana/pkg/errors"
 	"github.com/cerana/cerana/pkg/logrusx"
 	"github.com/mitchellh/mapstructure"
@@ -15,8 +18,8 @@ import (
 
 // Config holds all configuration for the provider.
 type Config struct {
-	viper   *viper.Viper
 	flagSet *flag.FlagSet
+	file    *configutil.ConfigFile
 }
 
 // ConfigData defines the structure of the config data (e.g. in the config file)
@@ -28,6 +31,13 @@ type ConfigData struct {
 	LogLevel        string                     `json:"log_level"`
 	DefaultTimeout  uint64                     `json:"default_timeout"`
 	RequestTimeout  uint64                     `json:"request_timeout"`
+	IdempotencyTTL  uint64                     `json:"idempotency_ttl"`
+	RequestRetries  uint                       `json:"request_retries"`
+	Codec           string                     `json:"codec"`
+	MaxMessageSize  uint32                     `json:"max_message_size"`
+	TraceExport     string                     `json:"trace_export"`
+	MetricsPort     uint                       `json:"metrics_port"`
+	DrainTimeout    uint64                     `json:"drain_timeout"`
 	Tasks           map[string]*TaskConfigData `json:"tasks"`
 }
 
@@ -55,52 +65,121 @@ func NewConfig(flagSet *flag.FlagSet, v *viper.Viper) *Config {
 	flagSet.StringP("coordinator_url", "u", "", "url of coordinator for making requests")
 	flagSet.StringP("log_level", "l", "warning", "log level: debug/info/warn/error/fatal/panic")
 	flagSet.Uint64P("request_timeout", "t", 0, "default timeout for requests made by this provider in seconds")
+	flagSet.Uint64("idempotency_ttl", 60, "seconds to remember responses to requests with idempotency keys")
+	flagSet.Uint("request_retries", 0, "times to retry requests made by this provider that fail with temporary errors")
+	flagSet.String("codec", "json", "codec for messages sent over unix sockets: json/cbor/msgpack")
+	flagSet.Uint32("max_message_size", 0, "maximum size in bytes of messages read from unix sockets (0 for the default)")
+	flagSet.String("trace_export", "", "file path or OTLP/HTTP collector url to export traces to (disabled if empty)")
+	flagSet.Uint("metrics_port", 0, "port to serve prometheus metrics on (disabled if 0)")
+	flagSet.Uint64("drain_timeout", 30, "seconds to finish requests being handled after removing task sockets when stopping")
 
-	return &Config{
-		viper:   v,
+	c := &Config{
 		flagSet: flagSet,
 	}
+	c.file = configutil.NewConfigFile(v, c.newViper)
+	return c
+}
+
+// newViper creates a new viper instance for reloaded settings.
+func (c *Config) newViper() (*viper.Viper, error) {
+	v := viper.New()
+	if err := v.BindPFlags(c.flagSet); err != nil {
+		return nil, errors.Wrap(err, "failed to bind flags to viper")
+	}
+	return v, nil
+}
+
+// viper returns the viper instance with the current settings.
+func (c *Config) viper() *viper.Viper {
+	return c.file.Viper()
 }
 
 // LoadConfig attempts to load the config. Flags should be parsed first.
 func (c *Config) LoadConfig() error {
-	if err := c.viper.BindPFlags(c.flagSet); err != nil {
+	if err := c.viper().BindPFlags(c.flagSet); err != nil {
 		return errors.Wrap(err, "failed to bind flags to viper")
 	}
 
-	filePath := c.viper.GetString("config_file")
+	filePath := c.viper().GetString("config_file")
 	if filePath == "" {
 		return c.Validate()
 	}
 
-	c.viper.SetConfigFile(filePath)
-	if err := c.viper.ReadInConfig(); err != nil {
-		return errors.Wrapv(err, map[string]interface{}{"configFile": filePath}, "failed to read config file")
+	if err := c.file.Read(filePath); err != nil {
+		return err
 	}
 
 	return c.Validate()
 }
 
+// Reload reloads the config file, keeping the current config if the new one is
+// not valid. The log level, request retries, drain timeout, and task priorities
+// and timeouts can change while running; other changed settings keep their
+// current values until a restart. If apply is not nil, it is called with the
+// reloaded config before it replaces the current one, and the current config is
+// kept if it fails.
+func (c *Config) Reload(apply func(*Config) error) (*configutil.ReloadResult, error) {
+	var applyViper func(*viper.Viper) error
+	if apply != nil {
+		applyViper = func(v *viper.Viper) error {
+			return apply(c.reloaded(v))
+		}
+	}
+	return c.file.Reload(c.validateReload, liveSetting, applyViper)
+}
+
+// reloaded returns a config for reloaded settings.
+func (c *Config) reloaded(v *viper.Viper) *Config {
+	return &Config{
+		flagSet: c.flagSet,
+		file:    configutil.NewConfigFile(v, c.newViper),
+	}
+}
+
+// validateReload validates a reloaded config, including the log level that is
+// applied immediately.
+func (c *Config) validateReload(v *viper.Viper) error {
+	reloaded := c.reloaded(v)
+	if err := reloaded.Validate(); err != nil {
+		return err
+	}
+	logLevel := v.GetString("log_level")
+	_, err := logrus.ParseLevel(logLevel)
+	return errors.Wrapv(err, map[string]interface{}{"logLevel": logLevel})
+}
+
+// liveSetting returns whether a setting can change while the provider is
+// running.
+func liveSetting(key string) bool {
+	switch key {
+	case "log_level", "request_retries", "default_priority", "default_timeout", "drain_timeout":
+		return true
+	}
+	return strings.HasPrefix(key, "tasks.")
+}
+
 // TaskPriority determines the registration priority of a task. If a
 // priority was not explicitly configured for the task, it will return the
 // default.
 func (c *Config) TaskPriority(taskName string) int {
+	v := c.viper()
 	key := fmt.Sprintf("tasks.%s.priority", taskName)
-	if c.viper.IsSet(key) {
-		return c.viper.GetInt(key)
+	if v.IsSet(key) {
+		return v.GetInt(key)
 	}
-	return c.viper.GetInt("default_priority")
+	return v.GetInt("default_priority")
 }
 
 // TaskTimeout determines the timeout for a task. If a timeout was not
 // explicitly configured for the task, it will return the default.
 func (c *Config) TaskTimeout(taskName string) time.Duration {
+	v := c.viper()
 	key := fmt.Sprintf("tasks.%s.timeout", taskName)
 	var seconds int
-	if c.viper.IsSet(key) {
-		seconds = c.viper.GetInt(key)
+	if v.IsSet(key) {
+		seconds = v.GetInt(key)
 	} else {
-		seconds = c.viper.GetInt("default_timeout")
+		seconds = v.GetInt("default_timeout")
 	}
 
 	return time.Duration(seconds) * time.Second
@@ -108,34 +187,83 @@ func (c *Config) TaskTimeout(taskName string) time.Duration {
 
 // SocketDir returns the base directory for task sockets.
 func (c *Config) SocketDir() string {
-	return c.viper.GetString("socket_dir")
-}
-
-// StreamDir returns the directory for ad-hoc data stream sockets.
-func (c *Config) StreamDir(taskName string) string {
-	return filepath.Join(
-		c.SocketDir(),
-		"streams",
-		taskName,
-		c.ServiceName())
+	return c.viper().GetString("socket_dir")
 }
 
 // ServiceName returns the name the service should register as.
 func (c *Config) ServiceName() string {
-	return c.viper.GetString("service_name")
+	return c.viper().GetString("service_name")
 }
 
 // CoordinatorURL returns the URL of the Coordinator for which the Provider is
 // registered.
 func (c *Config) CoordinatorURL() *url.URL {
 	// Error checking has been done during validation
-	u, _ := url.ParseRequestURI(c.viper.GetString("coordinator_url"))
+	u, _ := url.ParseRequestURI(c.viper().GetString("coordinator_url"))
 	return u
 }
 
 // RequestTimeout returns the duration of the default request timeout.
 func (c *Config) RequestTimeout() time.Duration {
-	return time.Second * time.Duration(c.viper.GetInt("request_timeout"))
+	return time.Second * time.Duration(c.viper().GetInt("request_timeout"))
+}
+
+// IdempotencyTTL returns how long responses to requests with idempotency keys
+// are remembered.
+func (c *Config) IdempotencyTTL() time.Duration {
+	return time.Second * time.Duration(c.viper().GetInt("idempotency_ttl"))
+}
+
+// RetryPolicy returns the policy for retrying requests that fail with
+// temporary errors, or nil if they should not be retried.
+func (c *Config) RetryPolicy() *acomm.RetryPolicy {
+	retries := c.viper().GetInt("request_retries")
+	if retries <= 0 {
+		return nil
+	}
+	return &acomm.RetryPolicy{
+		MaxAttempts: retries + 1,
+		Backoff:     250 * time.Millisecond,
+		MaxBackoff:  5 * time.Second,
+	}
+}
+
+// Codec returns the codec for messages sent over unix sockets, which is also
+// accepted in addition to JSON. Peers that don't accept it are sent JSON.
+func (c *Config) Codec() acomm.Codec {
+	codec, _ := acomm.ParseCodec(c.codecName())
+	return codec
+}
+
+func (c *Config) codecName() string {
+	if name := c.viper().GetString("codec"); name != "" {
+		return name
+	}
+	return acomm.CodecJSON.String()
+}
+
+// MaxMessageSize returns the largest message size, in bytes, read from unix
+// sockets. Zero means the acomm default.
+func (c *Config) MaxMessageSize() uint32 {
+	return uint32(c.viper().GetInt64("max_message_size"))
+}
+
+// TraceExport returns the file path or collector url to export traces to. An
+// empty value disables exporting.
+func (c *Config) TraceExport() string {
+	return c.viper().GetString("trace_export")
+}
+
+// MetricsPort returns the port to serve metrics on. Zero disables serving
+// metrics.
+func (c *Config) MetricsPort() int {
+	return c.viper().GetInt("metrics_port")
+}
+
+// DrainTimeout returns how long requests being handled are given to finish
+// when stopping.
+func (c *Config) DrainTimeout() time.Duration {
+	return time.Second * time.Duration(c.viper().GetInt("drain_timeout"))
 }
 
 // Validate returns whether the config is valid, containing necessary values.
@@ -147,11 +275,15 @@ func (c *Config) Validate() error {
 	if c.ServiceName() == "" {
 		return errors.New("missing service_name")
 	}
-	coordinatorURL := c.viper.GetString("coordinator_url")
+	coordinatorURL := c.viper().GetString("coordinator_url")
 	if _, err := url.ParseRequestURI(coordinatorURL); err != nil {
 		return errors.Wrapv(err, map[string]interface{}{"coordinatorURL": coordinatorURL}, "failed to parse coordinatorURL")
 	}
 
+	if _, err := acomm.ParseCodec(c.codecName()); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -165,7 +297,7 @@ func (c *Config) Unmarshal(rawVal interface{}) error {
 	if err != nil {
 		return errors.Wrap(err)
 	}
-	return errors.Wrap(decoder.Decode(c.viper.AllSettings()))
+	return errors.Wrap(decoder.Decode(c.viper().AllSettings()))
 }
 
 // UnmarshalKey unmarshals a single config key into a struct.
@@ -178,11 +310,11 @@ func (c *Config) UnmarshalKey(key string, rawVal interface{}) error {
 	if err != nil {
 		return errors.Wrap(err)
 	}
-	return errors.Wrapv(decoder.Decode(c.viper.Get(key)), map[string]interface{}{"key": key})
+	return errors.Wrapv(decoder.Decode(c.viper().Get(key)), map[string]interface{}{"key": key})
 }
 
 // SetupLogging sets the log level and formatting.
 func (c *Config) SetupLogging() error {
-	logLevel := c.viper.GetString("log_level")
+	logLevel := c.viper().GetString("log_level")
 	return logrusx.SetLevel(logLevel)
 }
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/provider"
 	"github.com/pborman/uuid"
 	flag "github.com/spf13/pflag"
@@ -39,6 +40,12 @@ func (s *ConfigSuite) SetupTest() {
 		LogLevel:        "fatal",
 		DefaultTimeout:  100,
 		RequestTimeout:  10,
+		IdempotencyTTL:  30,
+		RequestRetries:  2,
+		Codec:           "cbor",
+		MaxMessageSize:  1024,
+		TraceExport:     "/tmp/traces.json",
+		DrainTimeout:    5,
 		Tasks: map[string]*provider.TaskConfigData{
 			"foobar": {
 				Priority: 56,
@@ -123,13 +130,6 @@ func (s *ConfigSuite) TestSocketDir() {
 	s.Equal(s.configData.SocketDir, s.config.SocketDir())
 }
 
-func (s *ConfigSuite) TestStreamDir() {
-	dir := s.config.StreamDir("foobar")
-	s.Contains(dir, s.config.SocketDir(), "missing socket dir")
-	s.Contains(dir, "foobar", "missing task name")
-	s.Contains(dir, s.config.ServiceName(), "missing service name")
-}
-
 func (s *ConfigSuite) TestServiceName() {
 	s.Equal(s.configData.ServiceName, s.config.ServiceName())
 }
@@ -142,6 +142,53 @@ func (s *ConfigSuite) TestRequestTimeout() {
 	s.EqualValues(s.configData.RequestTimeout, s.config.RequestTimeout()/time.Second)
 }
 
+func (s *ConfigSuite) TestDrainTimeout() {
+	s.EqualValues(s.configData.DrainTimeout, s.config.DrainTimeout()/time.Second)
+
+	config, fs, v, _, err := newConfig(true, false, s.configData)
+	s.Require().NoError(err)
+	_ = v.BindPFlags(fs)
+	s.Equal(30*time.Second, config.DrainTimeout(), "should default to 30 seconds")
+}
+
+func (s *ConfigSuite) TestIdempotencyTTL() {
+	s.EqualValues(s.configData.IdempotencyTTL, s.config.IdempotencyTTL()/time.Second)
+}
+
+func (s *ConfigSuite) TestRetryPolicy() {
+	policy := s.config.RetryPolicy()
+	if s.NotNil(policy) {
+		s.EqualValues(s.configData.RequestRetries+1, policy.MaxAttempts)
+	}
+
+	config, fs, v, _, err := newConfig(true, false, s.configData)
+	s.Require().NoError(err)
+	_ = v.BindPFlags(fs)
+	s.Nil(config.RetryPolicy(), "should not retry by default")
+}
+
+func (s *ConfigSuite) TestCodec() {
+	s.Equal(acomm.CodecCBOR, s.config.Codec())
+
+	config, fs, v, _, err := newConfig(true, false, s.configData)
+	s.Require().NoError(err)
+	_ = v.BindPFlags(fs)
+	s.Equal(acomm.CodecJSON, config.Codec(), "should default to json")
+
+	s.NoError(fs.Set("codec", "msgpack"))
+	s.Equal(acomm.CodecMsgpack, config.Codec())
+	s.NoError(fs.Set("codec", "xml"))
+	s.Error(config.Validate(), "should not be valid with an unknown codec")
+}
+
+func (s *ConfigSuite) TestMaxMessageSize() {
+	s.EqualValues(s.configData.MaxMessageSize, s.config.MaxMessageSize())
+}
+
+func (s *ConfigSuite) TestTraceExport() {
+	s.Equal(s.configData.TraceExport, s.config.TraceExport())
+}
+
 func (s *ConfigSuite) TestValidate() {
 	tests := []struct {
 		description    string
@@ -227,8 +274,15 @@ func newConfig(setFlags, writeConfig bool, configData *provider.ConfigData) (*pr
 
 	var configFile *os.File
 	if writeConfig {
-		var err error
-		configFile, err = ioutil.TempFile("", "providerTest-")
+		tempFile, err := ioutil.TempFile("", "providerTest-")
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		_ = tempFile.Close()
+		_ = os.Remove(tempFile.Name())
+
+		// The config file type is determined by its extension when reloading
+		configFile, err = os.Create(tempFile.Name() + ".json")
 		if err != nil {
 			return nil, nil, nil, nil, err
 		}
@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/cerana/cerana/acomm"
+)
+
+// dedupeEntry is the outcome of handling a request with an idempotency key.
+// The response is set and done closed once the original request completes.
+type dedupeEntry struct {
+	key     string
+	done    chan struct{}
+	resp    *acomm.Response
+	expires time.Time
+}
+
+// dedupeExpiry is a min-heap of completed entries ordered by expiration.
+type dedupeExpiry []*dedupeEntry
+
+func (h dedupeExpiry) Len() int            { return len(h) }
+func (h dedupeExpiry) Less(i, j int) bool  { return h[i].expires.Before(h[j].expires) }
+func (h dedupeExpiry) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *dedupeExpiry) Push(x interface{}) { *h = append(*h, x.(*dedupeEntry)) }
+func (h *dedupeExpiry) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// dedupeCache remembers the responses to requests with idempotency keys so
+// that retries of a request get the original response rather than running
+// the task again.
+type dedupeCache struct {
+	ttl     time.Duration
+	lock    sync.Mutex // Protects entries and expiry
+	entries map[string]*dedupeEntry
+	expiry  dedupeExpiry
+}
+
+func newDedupeCache(ttl time.Duration) *dedupeCache {
+	return &dedupeCache{
+		ttl:     ttl,
+		entries: make(map[string]*dedupeEntry),
+	}
+}
+
+// begin returns the entry for the key, creating it if there isn't one. The
+// caller that creates the entry is responsible for handling the request and
+// calling finish.
+func (c *dedupeCache) begin(key string) (*dedupeEntry, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.expire(time.Now())
+
+	if entry, ok := c.entries[key]; ok {
+		return entry, false
+	}
+	entry := &dedupeEntry{key: key, done: make(chan struct{})}
+	c.entries[key] = entry
+	return entry, true
+}
+
+// expire removes the entries that expired before now. Only the expired
+// entries are visited. The caller must hold the lock.
+func (c *dedupeCache) expire(now time.Time) {
+	for len(c.expiry) > 0 && now.After(c.expiry[0].expires) {
+		entry := heap.Pop(&c.expiry).(*dedupeEntry)
+		if c.entries[entry.key] == entry {
+			delete(c.entries, entry.key)
+		}
+	}
+}
+
+// finish records the response for the key and releases any waiting
+// duplicates. Responses that should not be reused, such as temporary errors,
+// are handed to the waiting duplicates but then forgotten so a later retry
+// runs the task again.
+func (c *dedupeCache) finish(key string, entry *dedupeEntry, resp *acomm.Response, keep bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry.resp = resp
+	if !keep || c.ttl <= 0 {
+		delete(c.entries, key)
+	} else {
+		entry.expires = time.Now().Add(c.ttl)
+		heap.Push(&c.expiry, entry)
+	}
+	close(entry.done)
+}
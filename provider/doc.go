@@ -12,11 +12,23 @@ registration of each task, a unix socket is created in a known directory
 structure based on the task name. A Coordinator can check a task directory for
 the socket when routing requests. When a Provider is shut down, the unix socket
 will be automatically removed, effectively de-registering from the Coordinator.
+If a Provider exits without removing its sockets, the next instance replaces
+them on Start, while sockets of a running instance are left alone.
 In order to handle multiple Providers capable of handling the same task, socket
 filenames are prefixed with a priority value.
 
 Task socket path: `/[socket_dir]/[task_name]/[priority]-[provider-name].sock`
 
+Stopping a Provider drains it: the task sockets are removed first, so the
+Coordinator routes new requests to other Providers of the same tasks, while
+requests being handled are given until the configured drain_timeout to finish.
+Requests still being handled then are abandoned with an unavailable error that
+is not temporary, since the work may have been partly done, so callers don't
+retry them automatically. A replacement with the same service name can be
+started once the task sockets are removed, while the old instance is still
+draining; each instance has its own response socket, and the draining
+instance leaves the replacement's task sockets and schemas alone.
+
 Communication
 
 Communication is handled via the acomm package. An initial request is received
@@ -27,6 +39,37 @@ data stream url, and error. These three are bundled into a response and sent to
 the request's responseHook. In the case of data streaming, the caller will
 connect to the stream url and stream the data.
 
+A cancel request received on a task socket targets a request being handled by
+that task. The request's Done channel is closed, a cancelled response is sent
+to its responseHook, and any result later returned by the TaskHandler is
+discarded. Long running TaskHandlers should watch the Done channel.
+
+Handlers registered with RegisterContextTask follow the ContextTaskHandler
+signature and receive a context that expires at the earlier of the request's
+deadline and the task's configured timeout, and that is cancelled along with
+the request. Passing the context to nested requests, such as through the
+tracker's SyncRequest, lets timeouts cascade through the whole call tree.
+
+Handling a request is recorded as a span of the request's trace, and the
+context carries the span so nested requests made with it become its children.
+Spans are exported in the OpenTelemetry JSON format to the configured
+trace_export file or collector url. The duration of each handled request is
+also observed as a Prometheus metric by provider, task, and outcome (see
+package prometheusx), which are served at /metrics over http on the configured
+metrics_port, if any.
+
+Requests with an IdempotencyKey are handled once per task. A request with the
+same key as one being handled waits for its response, and one received within
+the configured idempotency_ttl after it completed gets the same response,
+without the TaskHandler being run again. Responses with temporary errors or
+streams are not remembered, so a retry runs the task again. A stream can only
+be read once, so a duplicate waiting on a request that responds with a stream
+gets a conflict error instead.
+
+Long running TaskHandlers may report progress while working by calling the
+request's SendProgress, or by copying data through an acomm.ProgressWriter.
+Progress is relayed to the original caller without completing the request.
+
 All requests originating from a provider go through the coordinator; providers
 should not make requests directly to each other. These requests should be
 tracked with the tracker. Responses may be sent directly to a unix socket
@@ -46,6 +89,12 @@ should be used. The provider must follow the Provider interface, which requires
 a method to register the task handlers; the method should accept a Server and
 call its RegisterTask method for each task handler.
 
+A TaskSpec may be passed when registering a task to describe it and its args
+and result. JSON Schemas are derived from the args and result values and
+published in a file next to the task socket, from which the coordinator serves
+the list-tasks and describe-task requests and optionally validates request
+args.
+
 Create a new Config, optionally supplying a flagset or viper instance. If
 flagset is not provided, it will use the commandline flagset, and if viper is
 not provided, one will be created. Flags should then be parsed, and the Config
@@ -66,6 +115,13 @@ There are a number of values required in the config for a provider to operate su
 		"default_priority": 50,
 		"log_level": "warning",
 		"request_timeout": 0,
+		"request_retries": 0,
+		"idempotency_ttl": 60,
+		"codec": "json",
+		"max_message_size": 0,
+		"trace_export": "http://localhost:4318/v1/traces",
+		"metrics_port": 9100,
+		"drain_timeout": 30,
 		"tasks":{
 			"ATaskNameFoo":{
 				"priority": 60,
@@ -73,6 +129,16 @@ There are a number of values required in the config for a provider to operate su
 		}
 	}
 
+The config file is reloaded on SIGHUP or a request for the provider's own
+reload task, named after the service (e.g. foo-reload-config for the foo
+service, see ReloadConfigTaskName). The new config is validated first and
+ignored if it is not valid. A task whose priority changed starts listening on
+its new socket before the old one is removed, and the new config is ignored if
+a task can't be moved. The log level and request retries apply immediately,
+and task timeouts apply to requests received afterwards. Other changed
+settings keep their current values until a restart, and are reported as such
+in the response.
+
 Suggestions
 
 Task handlers should be kept focused and self-contained as possible, doing one
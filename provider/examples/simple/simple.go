@@ -10,6 +10,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/provider"
+	"golang.org/x/net/context"
 )
 
 // Simple is a simple provider implementation.
@@ -98,7 +99,7 @@ func (s *Simple) SystemStatus(req *acomm.Request) (interface{}, *url.URL, error)
 	}
 
 	// Prepare multiple requests
-	multiRequest := acomm.NewMultiRequest(s.tracker, 0)
+	multiRequest := acomm.NewMultiRequest(context.Background(), s.tracker, 0)
 
 	cpuReq, err := acomm.NewRequest(acomm.RequestOptions{
 		Task:         "CPUInfo",
@@ -123,15 +124,9 @@ func (s *Simple) SystemStatus(req *acomm.Request) (interface{}, *url.URL, error)
 		"DiskInfo": diskReq,
 	}
 
-	for name, req := range requests {
-		if err := multiRequest.AddRequest(name, req); err != nil {
-			continue
-		}
-		if err := acomm.Send(s.config.CoordinatorURL(), req); err != nil {
-			multiRequest.RemoveRequest(req)
-			continue
-		}
-	}
+	// Both go to the coordinator, so they are sent in one batch. Requests that
+	// fail to send are missing from the responses.
+	_ = multiRequest.SendRequests(s.config.CoordinatorURL(), requests)
 
 	// Wait for the results
 	responses := multiRequest.Responses()
@@ -206,7 +201,7 @@ func (s *Simple) DiskInfo(req *acomm.Request) (interface{}, *url.URL, error) {
 // StreamEcho is a task handler to echo input back via streaming data.
 func (s *Simple) StreamEcho(req *acomm.Request) (interface{}, *url.URL, error) {
 	src := ioutil.NopCloser(bytes.NewReader(*req.Args))
-	addr, err := s.tracker.NewStreamUnix(s.config.StreamDir("StreamEcho"), src)
+	addr, err := s.tracker.NewStream(src)
 
 	return nil, addr, err
 }
@@ -0,0 +1,52 @@
+package provider
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/jsonschema"
+)
+
+// TaskSpec describes a task for introspection. Args and Result are example
+// values, usually zero values of the arg and result structs, from which the
+// JSON Schemas are derived. Either may be nil if the task has no args or
+// result.
+type TaskSpec struct {
+	Description string
+	Args        interface{}
+	Result      interface{}
+}
+
+// schema returns the TaskSchema for the spec.
+func (spec TaskSpec) schema(taskName, providerName string) *acomm.TaskSchema {
+	return &acomm.TaskSchema{
+		Task:        taskName,
+		Providers:   []string{providerName},
+		Description: spec.Description,
+		Args:        jsonschema.Reflect(spec.Args),
+		Result:      jsonschema.Reflect(spec.Result),
+	}
+}
+
+// writeSchema publishes a task schema next to the task socket, where the
+// coordinator can find it.
+func writeSchema(socketPath string, schema *acomm.TaskSchema) error {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return errors.Wrapv(err, map[string]interface{}{"task": schema.Task})
+	}
+	path := acomm.TaskSchemaPath(socketPath)
+	return errors.Wrapv(ioutil.WriteFile(path, data, 0644), map[string]interface{}{"path": path})
+}
+
+// removeSchema removes a published task schema.
+func removeSchema(socketPath string) error {
+	path := acomm.TaskSchemaPath(socketPath)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapv(err, map[string]interface{}{"path": path})
+	}
+	return nil
+}
@@ -1,15 +1,25 @@
 package provider
 
 import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strconv"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/configutil"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/prometheusx"
+	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
 )
 
 // Server is the main server struct.
@@ -17,6 +27,10 @@ type Server struct {
 	config  *Config
 	tasks   map[string]*task
 	tracker *acomm.Tracker
+	metrics net.Listener
+	sighup  chan os.Signal
+
+	reloadLock sync.Mutex // Serializes reloads
 }
 
 // Provider is an interface to allow a provider to register its tasks with a
@@ -31,14 +45,27 @@ func NewServer(config *Config) (*Server, error) {
 		return nil, err
 	}
 
+	// Each instance has its own response socket, so a replacement can start
+	// while a stopping instance drains
 	responseSocket := filepath.Join(
 		config.SocketDir(),
 		"response",
-		config.ServiceName()+".sock")
+		config.ServiceName()+"-"+uuid.New()[:8]+".sock")
 	tracker, err := acomm.NewTracker(responseSocket, nil, nil, config.RequestTimeout())
 	if err != nil {
 		return nil, err
 	}
+	tracker.SetRetryPolicy(config.RetryPolicy())
+	tracker.SetCodec(config.Codec())
+	tracker.SetMaxMessageSize(config.MaxMessageSize())
+
+	if dest := config.TraceExport(); dest != "" {
+		exporter, err := acomm.NewSpanExporter(config.ServiceName(), dest)
+		if err != nil {
+			return nil, err
+		}
+		acomm.SetSpanExporter(exporter)
+	}
 
 	return &Server{
 		config:  config,
@@ -52,17 +79,36 @@ func (s *Server) Tracker() *acomm.Tracker {
 	return s.tracker
 }
 
-// RegisterTask registers a new task and its handler with the server.
-func (s *Server) RegisterTask(taskName string, handler TaskHandler) {
-	s.tasks[taskName] = newTask(taskName, s.config.ServiceName(), s.TaskSocketPath(taskName), s.config.TaskTimeout(taskName), handler)
+// RegisterTask registers a new task and its handler with the server. An
+// optional spec describes the task's args and result to the coordinator.
+func (s *Server) RegisterTask(taskName string, handler TaskHandler, spec ...TaskSpec) {
+	s.RegisterContextTask(taskName, func(_ context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
+		return handler(req)
+	}, spec...)
+}
+
+// RegisterContextTask registers a new task and its context aware handler with
+// the server. An optional spec describes the task's args and result to the
+// coordinator.
+func (s *Server) RegisterContextTask(taskName string, handler ContextTaskHandler, spec ...TaskSpec) {
+	var schema *acomm.TaskSchema
+	if len(spec) > 0 {
+		schema = spec[0].schema(taskName, s.config.ServiceName())
+	}
+	s.tasks[taskName] = newTask(taskName, s.config, handler, schema)
 }
 
 // TaskSocketPath returns the unix socket path for a task
 func (s *Server) TaskSocketPath(taskName string) string {
+	return taskSocketPath(s.config, taskName)
+}
+
+// taskSocketPath returns the socket path of a task for the config.
+func taskSocketPath(config *Config, taskName string) string {
 	return filepath.Join(
-		s.config.SocketDir(),
+		config.SocketDir(),
 		taskName,
-		strconv.Itoa(s.config.TaskPriority(taskName))+"-"+s.config.ServiceName()+".sock")
+		strconv.Itoa(config.TaskPriority(taskName))+"-"+config.ServiceName()+".sock")
 }
 
 // RegisteredTasks returns a list of registered task names.
@@ -74,8 +120,31 @@ func (s *Server) RegisteredTasks() []string {
 	return taskNames
 }
 
-// Start starts up all of the registered tasks and response handling
+// ReloadConfigTask is the suffix of the task registered by every provider when
+// it starts to reload its config. Each provider registers it under its own
+// name (see ReloadConfigTaskName), so a request reloads only the named
+// provider.
+const ReloadConfigTask = "reload-config"
+
+// ReloadConfigTaskName returns the name of the task that reloads the config of
+// the provider.
+func (s *Server) ReloadConfigTaskName() string {
+	return s.config.ServiceName() + "-" + ReloadConfigTask
+}
+
+// Start starts up all of the registered tasks and response handling. The
+// config is reloaded on SIGHUP or a request for the task named by
+// ReloadConfigTaskName.
 func (s *Server) Start() error {
+	s.RegisterTask(s.ReloadConfigTaskName(), s.reloadConfigTask, TaskSpec{
+		Description: "Reload the provider config, applying the settings that can change while running.",
+		Result:      configutil.ReloadResult{},
+	})
+
+	if err := s.removeStaleSockets(); err != nil {
+		return err
+	}
+
 	if err := s.tracker.Start(); err != nil {
 		return err
 	}
@@ -85,23 +154,170 @@ func (s *Server) Start() error {
 			return err
 		}
 	}
+
+	if err := s.startMetrics(); err != nil {
+		return err
+	}
+
+	s.sighup = make(chan os.Signal, 1)
+	signal.Notify(s.sighup, syscall.SIGHUP)
+	go s.reloadOnSignal(s.sighup)
+	return nil
+}
+
+// Reload reloads the config and applies the settings that can change while
+// running. The log level applies immediately and task timeouts apply to new
+// requests. A task whose priority changed is moved to its new socket before
+// the new config is used, and the current config is kept if a task can't be
+// moved.
+func (s *Server) Reload() (*configutil.ReloadResult, error) {
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+
+	result, err := s.config.Reload(s.moveTasks)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.config.SetupLogging(); err != nil {
+		return nil, err
+	}
+	s.tracker.SetRetryPolicy(s.config.RetryPolicy())
+	for taskName, t := range s.tasks {
+		t.setTimeout(s.config.TaskTimeout(taskName))
+	}
+
+	entry := logrus.WithFields(logrus.Fields{
+		"applied":         result.Applied,
+		"restartRequired": result.RestartRequired,
+	})
+	if len(result.RestartRequired) > 0 {
+		entry.Warn("config reloaded, some settings require a restart")
+	} else {
+		entry.Info("config reloaded")
+	}
+	return result, nil
+}
+
+// moveTasks moves tasks to their sockets for the config. If a task can't be
+// moved, the tasks already moved are moved back.
+func (s *Server) moveTasks(config *Config) error {
+	previous := make(map[*task]string)
+	for taskName, t := range s.tasks {
+		socketPath := t.path()
+		if err := t.move(taskSocketPath(config, taskName)); err != nil {
+			for moved, socketPath := range previous {
+				if err := moved.move(socketPath); err != nil {
+					logrus.WithFields(logrus.Fields{
+						"error":  err,
+						"task":   moved.name,
+						"socket": socketPath,
+					}).Error("failed to move task socket back")
+				}
+			}
+			return err
+		}
+		previous[t] = socketPath
+	}
 	return nil
 }
 
-// Stop stops all of the registered tasks and response handling. Blocks until complete.
+// reloadConfigTask is the handler for the provider's reload config task.
+func (s *Server) reloadConfigTask(req *acomm.Request) (interface{}, *url.URL, error) {
+	result, err := s.Reload()
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, nil, nil
+}
+
+// reloadOnSignal reloads the config for each signal received, until the
+// channel is closed.
+func (s *Server) reloadOnSignal(sigChan chan os.Signal) {
+	for range sigChan {
+		if _, err := s.Reload(); err != nil {
+			logrus.WithField("error", err).Error("failed to reload config")
+		}
+	}
+}
+
+// removeStaleSockets removes sockets left behind by a previous instance of the
+// provider that didn't stop cleanly, so they can be replaced. Sockets of a
+// running instance are left alone.
+func (s *Server) removeStaleSockets() error {
+	pattern := filepath.Join(s.config.SocketDir(), "response", s.config.ServiceName()+"-*.sock")
+	sockets, err := filepath.Glob(pattern)
+	if err != nil {
+		return errors.Wrapv(err, map[string]interface{}{"pattern": pattern})
+	}
+	for _, t := range s.tasks {
+		sockets = append(sockets, t.path())
+	}
+
+	for _, socket := range sockets {
+		removed, err := acomm.RemoveStaleSocket(socket)
+		if err != nil {
+			return err
+		}
+		if removed {
+			logrus.WithField("socket", socket).Warn("replacing stale socket")
+		}
+	}
+	return nil
+}
+
+// startMetrics serves metrics over http, if a metrics port is configured.
+func (s *Server) startMetrics() error {
+	port := s.config.MetricsPort()
+	if port == 0 {
+		return nil
+	}
+
+	addr := fmt.Sprintf(":%d", port)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrapv(err, map[string]interface{}{"addr": addr}, "failed to listen for metrics requests")
+	}
+	s.metrics = listener
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", prometheusx.Handler())
+	go func() {
+		// Serve returns an error once the listener is closed on Stop
+		_ = http.Serve(listener, mux)
+	}()
+	return nil
+}
+
+// Stop stops all of the registered tasks and response handling. Task sockets
+// are removed first, so requests are routed to other providers, while the
+// requests being handled are given until the drain timeout to finish. Blocks
+// until complete.
 func (s *Server) Stop() {
-	// Stop all actively handled tasks
+	if s.sighup != nil {
+		signal.Stop(s.sighup)
+		close(s.sighup)
+		s.sighup = nil
+	}
+
+	if s.metrics != nil {
+		_ = s.metrics.Close()
+	}
+
+	// Drain and stop all tasks, giving requests being handled until the drain
+	// timeout to finish
+	deadline := time.Now().Add(s.config.DrainTimeout())
 	var taskWG sync.WaitGroup
 	for _, t := range s.tasks {
 		taskWG.Add(1)
 		go func(t *task) {
 			defer taskWG.Done()
-			t.stop()
+			t.stop(deadline)
 		}(t)
 	}
 	taskWG.Wait()
 
 	s.tracker.Stop()
+	acomm.FlushSpans()
 	return
 }
 
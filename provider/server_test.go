@@ -1,18 +1,27 @@
 package provider_test
 
 import (
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"syscall"
 	"testing"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/configutil"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/jsonschema"
+	"github.com/cerana/cerana/pkg/logrusx"
 	"github.com/cerana/cerana/provider"
 	"github.com/pborman/uuid"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
 )
 
 func TestServer(t *testing.T) {
@@ -34,7 +43,7 @@ func (s *ServerSuite) SetupSuite() {
 
 	s.configData = &provider.ConfigData{
 		SocketDir:       socketDir,
-		ServiceName:     uuid.New(),
+		ServiceName:     uuid.New()[:8],
 		CoordinatorURL:  "http://localhost:8080/",
 		DefaultPriority: 43,
 		LogLevel:        "fatal",
@@ -151,3 +160,657 @@ func (s *ServerSuite) TestStopOnSignal() {
 
 	<-done
 }
+
+func (s *ServerSuite) TestCancel() {
+	started := make(chan string, 1)
+	taskHandler := func(req *acomm.Request) (interface{}, *url.URL, error) {
+		started <- req.ID
+		<-req.Done()
+		return nil, nil, nil
+	}
+	s.server.RegisterTask("foobar", taskHandler)
+
+	if !s.NoError(s.server.Start(), "failed to start server") {
+		return
+	}
+	time.Sleep(time.Second)
+	defer s.server.Stop()
+
+	tracker := s.server.Tracker()
+	providerSocket, _ := url.ParseRequestURI("unix://" + s.server.TaskSocketPath("foobar"))
+	sendReq := func(req *acomm.Request) chan *acomm.Response {
+		handled := make(chan *acomm.Response, 1)
+		req.ResponseHook = tracker.URL()
+		req.SuccessHandler = func(_ *acomm.Request, resp *acomm.Response) { handled <- resp }
+		req.ErrorHandler = req.SuccessHandler
+		s.Require().NoError(tracker.TrackRequest(req, 5*time.Second))
+		s.Require().NoError(acomm.Send(providerSocket, req))
+		return handled
+	}
+
+	req, err := acomm.NewRequest(acomm.RequestOptions{Task: "foobar"})
+	s.Require().NoError(err)
+	reqHandled := sendReq(req)
+	s.Equal(req.ID, <-started, "handler should have started")
+
+	cancelReq, err := acomm.NewCancelRequest(req.ID, acomm.RequestOptions{})
+	s.Require().NoError(err)
+	cancelHandled := sendReq(cancelReq)
+
+	resp := <-reqHandled
+	s.True(acomm.IsCancelled(resp.Error), "request should have been cancelled")
+	resp = <-cancelHandled
+	s.NoError(resp.Error, "cancel request should have succeeded")
+
+	// The request is no longer active
+	cancelReq, err = acomm.NewCancelRequest(req.ID, acomm.RequestOptions{})
+	s.Require().NoError(err)
+	resp = <-sendReq(cancelReq)
+	s.Error(resp.Error, "cancelling an inactive request should fail")
+}
+
+func (s *ServerSuite) TestIdempotency() {
+	calls := make(chan string, 10)
+	release := make(chan struct{})
+	streamRelease := make(chan struct{}, 1)
+	streamURL, _ := url.Parse("unix:///tmp/foobar-stream.sock")
+	taskHandler := func(req *acomm.Request) (interface{}, *url.URL, error) {
+		calls <- req.ID
+		<-release
+		if req.IdempotencyKey == "stream" {
+			<-streamRelease
+			return nil, streamURL, nil
+		}
+		if req.IdempotencyKey == "temporary" {
+			return nil, nil, acomm.NewTemporaryError("try again", nil)
+		}
+		return map[string]string{"requestID": req.ID}, nil, nil
+	}
+	s.server.RegisterTask("foobar", taskHandler)
+
+	if !s.NoError(s.server.Start(), "failed to start server") {
+		return
+	}
+	time.Sleep(time.Second)
+	defer s.server.Stop()
+
+	tracker := s.server.Tracker()
+	providerSocket, _ := url.ParseRequestURI("unix://" + s.server.TaskSocketPath("foobar"))
+	sendReq := func(key string) (*acomm.Request, chan *acomm.Response) {
+		handled := make(chan *acomm.Response, 1)
+		respHandler := func(_ *acomm.Request, resp *acomm.Response) { handled <- resp }
+		req, err := acomm.NewRequest(acomm.RequestOptions{
+			Task:           "foobar",
+			ResponseHook:   tracker.URL(),
+			IdempotencyKey: key,
+			SuccessHandler: respHandler,
+			ErrorHandler:   respHandler,
+		})
+		s.Require().NoError(err)
+		s.Require().NoError(tracker.TrackRequest(req, 5*time.Second))
+		s.Require().NoError(acomm.Send(providerSocket, req))
+		return req, handled
+	}
+	originalResult := func(resp *acomm.Response) string {
+		var result map[string]string
+		s.NoError(resp.UnmarshalResult(&result))
+		return result["requestID"]
+	}
+
+	// Duplicates of an in-progress request wait for its response
+	req, handled := sendReq("foo")
+	s.Equal(req.ID, <-calls)
+	dupReq, dupHandled := sendReq("foo")
+	close(release)
+
+	resp := <-handled
+	s.NoError(resp.Error)
+	s.Equal(req.ID, originalResult(resp))
+	resp = <-dupHandled
+	s.Equal(dupReq.ID, resp.ID, "response should be for the duplicate request")
+	s.Equal(req.ID, originalResult(resp), "duplicate should get the original result")
+
+	// Later duplicates get the remembered response
+	_, handled = sendReq("foo")
+	s.Equal(req.ID, originalResult(<-handled))
+
+	// Other keys are handled separately
+	req, handled = sendReq("bar")
+	s.Equal(req.ID, <-calls)
+	s.Equal(req.ID, originalResult(<-handled))
+
+	// Temporary errors are not remembered
+	for i := 0; i < 2; i++ {
+		req, handled = sendReq("temporary")
+		s.Equal(req.ID, <-calls, "should have run the handler again")
+		s.True(acomm.IsTemporary((<-handled).Error))
+	}
+
+	// Duplicates can't share a stream and responses with one are not remembered
+	req, handled = sendReq("stream")
+	s.Equal(req.ID, <-calls)
+	_, dupHandled = sendReq("stream")
+	time.Sleep(100 * time.Millisecond)
+	streamRelease <- struct{}{}
+	s.Equal(streamURL.String(), (<-handled).StreamURL.String())
+	s.True(errors.IsCode((<-dupHandled).Error, errors.CodeConflict), "duplicate should get a conflict")
+	req, handled = sendReq("stream")
+	s.Equal(req.ID, <-calls, "should have run the handler again")
+	streamRelease <- struct{}{}
+	s.NotNil((<-handled).StreamURL)
+	s.Len(calls, 0, "should not have run the handler for duplicates")
+}
+
+func (s *ServerSuite) TestContextTask() {
+	deadlines := make(chan time.Time, 1)
+	taskHandler := func(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
+		deadline, _ := ctx.Deadline()
+		deadlines <- deadline
+		return nil, nil, nil
+	}
+
+	// Load the config from a file to include the task timeouts
+	config, _, _, configFile, err := newConfig(true, true, s.configData)
+	if configFile != nil {
+		defer func() { _ = os.Remove(configFile.Name()) }()
+	}
+	s.Require().NoError(err, "failed to create config")
+	s.Require().NoError(config.LoadConfig(), "failed to load config")
+	server, err := provider.NewServer(config)
+	s.Require().NoError(err, "failed to create server")
+	server.RegisterContextTask("foobar", taskHandler)
+
+	if !s.NoError(server.Start(), "failed to start server") {
+		return
+	}
+	time.Sleep(time.Second)
+	defer server.Stop()
+
+	tracker := server.Tracker()
+	providerSocket, _ := url.ParseRequestURI("unix://" + server.TaskSocketPath("foobar"))
+
+	tests := []struct {
+		description string
+		deadline    time.Time
+		expected    time.Time
+	}{
+		{"task timeout", time.Time{}, time.Now().Add(64 * time.Second)},
+		{"request deadline", time.Now().Add(5 * time.Second), time.Now().Add(5 * time.Second)},
+	}
+
+	for _, test := range tests {
+		msg := testMsgFunc(test.description)
+		handled := make(chan struct{})
+		respHandler := func(req *acomm.Request, resp *acomm.Response) {
+			close(handled)
+		}
+		req, err := acomm.NewRequest(acomm.RequestOptions{
+			Task:           "foobar",
+			ResponseHook:   tracker.URL(),
+			Deadline:       test.deadline,
+			SuccessHandler: respHandler,
+			ErrorHandler:   respHandler,
+		})
+		s.Require().NoError(err, msg("should have created request"))
+		s.Require().NoError(tracker.TrackRequest(req, 5*time.Second), msg("should have tracked request"))
+		s.Require().NoError(acomm.Send(providerSocket, req), msg("should have sent request"))
+
+		s.WithinDuration(test.expected, <-deadlines, time.Second, msg("handler context should have the correct deadline"))
+		<-handled
+	}
+}
+
+func (s *ServerSuite) TestTrace() {
+	spans := make(chan *acomm.Span, 1)
+	taskHandler := func(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
+		spans <- acomm.SpanFromContext(ctx)
+		return nil, nil, nil
+	}
+	s.server.RegisterContextTask("foobar", taskHandler)
+
+	if !s.NoError(s.server.Start(), "failed to start server") {
+		return
+	}
+	time.Sleep(time.Second)
+	defer s.server.Stop()
+
+	tracker := s.server.Tracker()
+	providerSocket, _ := url.ParseRequestURI("unix://" + s.server.TaskSocketPath("foobar"))
+
+	handled := make(chan struct{})
+	respHandler := func(req *acomm.Request, resp *acomm.Response) {
+		close(handled)
+	}
+	parent := acomm.NewSpan("parent", acomm.SpanKindClient, "", "")
+	req, err := acomm.NewRequest(acomm.RequestOptions{
+		Task:           "foobar",
+		ResponseHook:   tracker.URL(),
+		SuccessHandler: respHandler,
+		ErrorHandler:   respHandler,
+	})
+	s.Require().NoError(err)
+	parent.Inject(req)
+	s.Require().NoError(tracker.TrackRequest(req, 5*time.Second))
+	s.Require().NoError(acomm.Send(providerSocket, req))
+
+	span := <-spans
+	<-handled
+	if !s.NotNil(span, "handler context should have a span") {
+		return
+	}
+	s.Equal(parent.TraceID, span.TraceID, "span should continue the request's trace")
+	s.Equal(parent.SpanID, span.ParentSpanID, "span should be a child of the request's parent span")
+	s.Equal("foobar", span.Name)
+	s.False(span.EndTime.IsZero(), "span should have finished")
+}
+
+func (s *ServerSuite) TestTaskSchema() {
+	type fooArgs struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+	handler := func(a *acomm.Request) (interface{}, *url.URL, error) {
+		return nil, nil, nil
+	}
+	s.server.RegisterTask("foobar", handler, provider.TaskSpec{
+		Description: "Does foo.",
+		Args:        fooArgs{},
+	})
+
+	schemaPath := acomm.TaskSchemaPath(s.server.TaskSocketPath("foobar"))
+	if !s.NoError(s.server.Start(), "failed to start server") {
+		return
+	}
+
+	data, err := ioutil.ReadFile(schemaPath)
+	if s.NoError(err, "should have published schema") {
+		schema := &acomm.TaskSchema{}
+		s.Require().NoError(json.Unmarshal(data, schema))
+		s.Equal("foobar", schema.Task)
+		s.Equal([]string{s.configData.ServiceName}, schema.Providers)
+		s.Equal("Does foo.", schema.Description)
+		if s.NotNil(schema.Args) {
+			s.Equal(jsonschema.TypeObject, schema.Args.Type)
+			s.Len(schema.Args.Properties, 2)
+			s.Equal(jsonschema.TypeInteger, schema.Args.Properties["count"].Type)
+		}
+		s.Nil(schema.Result)
+	}
+
+	s.server.Stop()
+	_, err = os.Stat(schemaPath)
+	s.True(os.IsNotExist(err), "should have removed schema")
+}
+
+func (s *ServerSuite) TestMetrics() {
+	configData := *s.configData
+	configData.ServiceName = uuid.New()[:8]
+	configData.MetricsPort = 45684
+	config, _, _, configFile, err := newConfig(false, true, &configData)
+	if configFile != nil {
+		defer func() { _ = os.Remove(configFile.Name()) }()
+	}
+	s.Require().NoError(err, "failed to create config")
+	s.Require().NoError(config.LoadConfig(), "failed to load config")
+	server, err := provider.NewServer(config)
+	s.Require().NoError(err, "failed to create server")
+
+	taskHandler := func(a *acomm.Request) (interface{}, *url.URL, error) {
+		return nil, nil, nil
+	}
+	server.RegisterTask("foobar", taskHandler)
+	if !s.NoError(server.Start(), "failed to start server") {
+		return
+	}
+	defer server.Stop()
+
+	tracker := server.Tracker()
+	handled := make(chan struct{})
+	respHandler := func(req *acomm.Request, resp *acomm.Response) {
+		close(handled)
+	}
+	req, err := acomm.NewRequest(acomm.RequestOptions{
+		Task:           "foobar",
+		ResponseHook:   tracker.URL(),
+		SuccessHandler: respHandler,
+		ErrorHandler:   respHandler,
+	})
+	s.Require().NoError(err)
+	providerSocket, _ := url.ParseRequestURI("unix://" + server.TaskSocketPath("foobar"))
+	s.Require().NoError(tracker.TrackRequest(req, 5*time.Second))
+	s.Require().NoError(acomm.Send(providerSocket, req))
+	<-handled
+
+	resp, err := http.Get("http://localhost:45684/metrics")
+	if !s.NoError(err, "should serve metrics") {
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := ioutil.ReadAll(resp.Body)
+	s.NoError(err)
+	expected := fmt.Sprintf(`cerana_provider_handler_duration_seconds_count{outcome="success",provider="%s",task="foobar"} 1`, configData.ServiceName)
+	s.Contains(string(body), expected, "should have observed the handler duration")
+}
+
+func (s *ServerSuite) TestStaleSocket() {
+	taskHandler := func(a *acomm.Request) (interface{}, *url.URL, error) {
+		return nil, nil, nil
+	}
+	s.server.RegisterTask("foobar", taskHandler)
+
+	// A socket left by a previous instance that crashed
+	socketPath := s.server.TaskSocketPath("foobar")
+	s.Require().NoError(os.MkdirAll(filepath.Dir(socketPath), os.ModePerm))
+	fd, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	s.Require().NoError(err)
+	s.Require().NoError(syscall.Bind(fd, &syscall.SockaddrUnix{Name: socketPath}))
+	s.Require().NoError(syscall.Close(fd))
+
+	if !s.NoError(s.server.Start(), "should replace the stale socket") {
+		return
+	}
+	defer s.server.Stop()
+	s.False(acomm.IsStaleSocket(socketPath), "should be listening on the socket")
+
+	// The socket of a running instance is not replaced
+	server, err := provider.NewServer(s.config)
+	s.Require().NoError(err)
+	server.RegisterTask("foobar", taskHandler)
+	s.Error(server.Start(), "should not replace the socket of a running instance")
+}
+
+func (s *ServerSuite) TestReload() {
+	deadlines := make(chan time.Time, 1)
+	taskHandler := func(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
+		deadline, _ := ctx.Deadline()
+		deadlines <- deadline
+		return nil, nil, nil
+	}
+
+	configData := *s.configData
+	configData.ServiceName = uuid.New()[:8]
+	configData.Tasks = map[string]*provider.TaskConfigData{
+		"foobar": {Priority: 56, Timeout: 64},
+	}
+	config, _, _, configFile, err := newConfig(false, true, &configData)
+	if configFile != nil {
+		defer func() { _ = os.Remove(configFile.Name()) }()
+	}
+	s.Require().NoError(err, "failed to create config")
+	s.Require().NoError(config.LoadConfig(), "failed to load config")
+	server, err := provider.NewServer(config)
+	s.Require().NoError(err, "failed to create server")
+	server.RegisterContextTask("foobar", taskHandler)
+
+	if !s.NoError(server.Start(), "failed to start server") {
+		return
+	}
+	time.Sleep(time.Second)
+	defer server.Stop()
+	// Only sets the level if it changed, so it doesn't race with logging by a
+	// reload triggered by SIGHUP
+	defer func() { _ = logrusx.SetLevel("fatal") }()
+
+	writeConfig := func() {
+		configJSON, _ := json.Marshal(configData)
+		s.Require().NoError(ioutil.WriteFile(configFile.Name(), configJSON, 0644))
+	}
+
+	// Reload on SIGHUP
+	oldSocket := server.TaskSocketPath("foobar")
+	configData.LogLevel = "error"
+	configData.RequestTimeout = 20
+	configData.Tasks["foobar"] = &provider.TaskConfigData{Priority: 57, Timeout: 32}
+	writeConfig()
+	selfProcess, err := os.FindProcess(os.Getpid())
+	s.Require().NoError(err, "couldn't find this process")
+	s.Require().NoError(selfProcess.Signal(syscall.SIGHUP))
+
+	newSocket := filepath.Join(configData.SocketDir, "foobar", "57-"+configData.ServiceName+".sock")
+	for i := 0; i < 20; i++ {
+		if _, err = os.Stat(oldSocket); os.IsNotExist(err) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	s.True(os.IsNotExist(err), "should have removed the old socket")
+	s.Equal(newSocket, server.TaskSocketPath("foobar"), "should have changed the task priority")
+	s.False(acomm.IsStaleSocket(newSocket), "should be listening on the new socket")
+	s.Equal(logrus.ErrorLevel, logrus.GetLevel(), "should have applied the log level")
+	s.Equal(10*time.Second, config.RequestTimeout(), "should keep the request timeout until a restart")
+
+	tracker := server.Tracker()
+	providerSocket, _ := url.ParseRequestURI("unix://" + newSocket)
+	handled := make(chan struct{})
+	respHandler := func(req *acomm.Request, resp *acomm.Response) {
+		close(handled)
+	}
+	req, err := acomm.NewRequest(acomm.RequestOptions{
+		Task:           "foobar",
+		ResponseHook:   tracker.URL(),
+		SuccessHandler: respHandler,
+		ErrorHandler:   respHandler,
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(tracker.TrackRequest(req, 5*time.Second))
+	s.Require().NoError(acomm.Send(providerSocket, req))
+	s.WithinDuration(time.Now().Add(32*time.Second), <-deadlines, time.Second, "should have applied the task timeout")
+	<-handled
+
+	// Reload with the task
+	reloadSocket, _ := url.ParseRequestURI("unix://" + server.TaskSocketPath(server.ReloadConfigTaskName()))
+	reload := func() (*configutil.ReloadResult, error) {
+		resp, err := tracker.SyncRequest(context.Background(), reloadSocket, acomm.RequestOptions{
+			Task: server.ReloadConfigTaskName(),
+		}, 5*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		result := &configutil.ReloadResult{}
+		return result, resp.UnmarshalResult(result)
+	}
+
+	configData.Tasks["foobar"].Priority = 56
+	writeConfig()
+	result, err := reload()
+	if s.NoError(err, "should have reloaded the config") {
+		s.Equal([]string{"tasks.foobar.priority"}, result.Applied)
+		s.Equal([]string{"request_timeout"}, result.RestartRequired)
+	}
+	s.Equal(oldSocket, server.TaskSocketPath("foobar"), "should have changed the task priority back")
+	s.False(acomm.IsStaleSocket(oldSocket), "should be listening on the socket")
+
+	// A config with a task that can't be moved is not applied
+	blockedSocket := filepath.Join(configData.SocketDir, "foobar", "58-"+configData.ServiceName+".sock")
+	s.Require().NoError(os.MkdirAll(filepath.Join(blockedSocket, "blocked"), os.ModePerm))
+	configData.Tasks["foobar"].Priority = 58
+	configData.LogLevel = "info"
+	writeConfig()
+	_, err = reload()
+	s.Error(err, "should not reload a config with a task that can't be moved")
+	s.Equal(oldSocket, server.TaskSocketPath("foobar"), "should keep the task priority")
+	s.False(acomm.IsStaleSocket(oldSocket), "should be listening on the socket")
+	s.Equal(logrus.ErrorLevel, logrus.GetLevel(), "should keep the log level")
+	s.Require().NoError(os.RemoveAll(blockedSocket))
+	configData.Tasks["foobar"].Priority = 56
+	configData.LogLevel = "error"
+
+	// An invalid config is not applied
+	configData.CoordinatorURL = ""
+	configData.LogLevel = "info"
+	writeConfig()
+	_, err = reload()
+	s.Error(err, "should not reload an invalid config")
+	s.Equal(logrus.ErrorLevel, logrus.GetLevel(), "should keep the log level")
+}
+
+func (s *ServerSuite) TestDrain() {
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	finishHandler := func(req *acomm.Request) (interface{}, *url.URL, error) {
+		started <- req.Task
+		<-release
+		return "finished", nil, nil
+	}
+	hangHandler := func(req *acomm.Request) (interface{}, *url.URL, error) {
+		started <- req.Task
+		<-req.Done()
+		return nil, nil, nil
+	}
+
+	configData := *s.configData
+	configData.ServiceName = uuid.New()[:8]
+	configData.DrainTimeout = 2
+	config, _, _, configFile, err := newConfig(false, true, &configData)
+	if configFile != nil {
+		defer func() { _ = os.Remove(configFile.Name()) }()
+	}
+	s.Require().NoError(err, "failed to create config")
+	s.Require().NoError(config.LoadConfig(), "failed to load config")
+	server, err := provider.NewServer(config)
+	s.Require().NoError(err, "failed to create server")
+	server.RegisterTask("finish", finishHandler)
+	server.RegisterTask("hang", hangHandler)
+	if !s.NoError(server.Start(), "failed to start server") {
+		return
+	}
+	time.Sleep(time.Second)
+
+	tracker := server.Tracker()
+	sendReq := func(task string) chan *acomm.Response {
+		handled := make(chan *acomm.Response, 1)
+		respHandler := func(_ *acomm.Request, resp *acomm.Response) { handled <- resp }
+		req, err := acomm.NewRequest(acomm.RequestOptions{
+			Task:           task,
+			ResponseHook:   tracker.URL(),
+			SuccessHandler: respHandler,
+			ErrorHandler:   respHandler,
+		})
+		s.Require().NoError(err)
+		providerSocket, _ := url.ParseRequestURI("unix://" + server.TaskSocketPath(task))
+		s.Require().NoError(tracker.TrackRequest(req, 10*time.Second))
+		s.Require().NoError(acomm.Send(providerSocket, req))
+		s.Equal(task, <-started, "handler should have started")
+		return handled
+	}
+	finished := sendReq("finish")
+	hung := sendReq("hang")
+
+	stopped := make(chan struct{})
+	go func() {
+		server.Stop()
+		close(stopped)
+	}()
+
+	socketPath := server.TaskSocketPath("finish")
+	for i := 0; i < 10; i++ {
+		if _, err = os.Stat(socketPath); os.IsNotExist(err) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	s.True(os.IsNotExist(err), "should have removed the task socket")
+
+	// Requests being handled finish while draining
+	close(release)
+	resp := <-finished
+	if s.NoError(resp.Error, "should have finished the request") {
+		var result string
+		s.NoError(resp.UnmarshalResult(&result))
+		s.Equal("finished", result)
+	}
+	select {
+	case <-stopped:
+		s.Fail("should still be draining")
+	default:
+	}
+
+	// Requests not finished by the drain timeout are abandoned
+	resp = <-hung
+	s.True(errors.IsCode(resp.Error, errors.CodeUnavailable), "should have abandoned the request")
+	s.False(acomm.IsTemporary(resp.Error), "should not retry the partly handled request")
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		s.Fail("should have stopped")
+	}
+}
+
+func (s *ServerSuite) TestDrainReplacement() {
+	started := make(chan struct{}, 1)
+	hangHandler := func(req *acomm.Request) (interface{}, *url.URL, error) {
+		started <- struct{}{}
+		<-req.Done()
+		return nil, nil, nil
+	}
+	spec := provider.TaskSpec{Description: "Hang until cancelled."}
+
+	configData := *s.configData
+	configData.ServiceName = uuid.New()[:8]
+	configData.DrainTimeout = 1
+	config, _, _, configFile, err := newConfig(false, true, &configData)
+	if configFile != nil {
+		defer func() { _ = os.Remove(configFile.Name()) }()
+	}
+	s.Require().NoError(err, "failed to create config")
+	s.Require().NoError(config.LoadConfig(), "failed to load config")
+
+	server, err := provider.NewServer(config)
+	s.Require().NoError(err, "failed to create server")
+	server.RegisterTask("hang", hangHandler, spec)
+	if !s.NoError(server.Start(), "failed to start server") {
+		return
+	}
+	time.Sleep(time.Second)
+
+	// Keep the server draining until the drain timeout
+	tracker := server.Tracker()
+	req, err := acomm.NewRequest(acomm.RequestOptions{
+		Task:           "hang",
+		ResponseHook:   tracker.URL(),
+		SuccessHandler: func(_ *acomm.Request, _ *acomm.Response) {},
+		ErrorHandler:   func(_ *acomm.Request, _ *acomm.Response) {},
+	})
+	s.Require().NoError(err)
+	socketPath := server.TaskSocketPath("hang")
+	providerSocket, _ := url.ParseRequestURI("unix://" + socketPath)
+	s.Require().NoError(tracker.TrackRequest(req, 10*time.Second))
+	s.Require().NoError(acomm.Send(providerSocket, req))
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		server.Stop()
+		close(stopped)
+	}()
+
+	for i := 0; i < 10; i++ {
+		if _, err = os.Stat(socketPath); os.IsNotExist(err) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	s.Require().True(os.IsNotExist(err), "should have removed the task socket")
+
+	// A replacement starts on the same socket while the old server drains
+	replacement, err := provider.NewServer(config)
+	s.Require().NoError(err, "failed to create replacement server")
+	replacement.RegisterTask("hang", hangHandler, spec)
+	if !s.NoError(replacement.Start(), "failed to start replacement server") {
+		return
+	}
+	defer replacement.Stop()
+	s.Equal(socketPath, replacement.TaskSocketPath("hang"), "should use the same socket")
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		s.Fail("should have stopped")
+	}
+
+	_, err = os.Stat(socketPath)
+	s.NoError(err, "should have left the replacement's socket")
+	_, err = os.Stat(acomm.TaskSchemaPath(socketPath))
+	s.NoError(err, "should have left the replacement's schema")
+	s.False(acomm.IsStaleSocket(socketPath), "replacement should still accept connections")
+}
@@ -9,68 +9,296 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/prometheusx"
+	"golang.org/x/net/context"
 )
 
 // TaskHandler if the request handler function for a particular task. It should
 // return results or an error, but not both.
 type TaskHandler func(*acomm.Request) (interface{}, *url.URL, error)
 
+// ContextTaskHandler is a TaskHandler that additionally receives a context.
+// The context expires at the earlier of the request deadline and the task
+// timeout, and is cancelled if the request is cancelled. It should be passed
+// along to any nested requests.
+type ContextTaskHandler func(context.Context, *acomm.Request) (interface{}, *url.URL, error)
+
 // task contains the request listener and handler for a task.
 type task struct {
 	name         string
 	providerName string
-	handler      TaskHandler
-	reqTimeout   time.Duration
-	reqListener  *acomm.UnixListener
+	handler      ContextTaskHandler
+	schema       *acomm.TaskSchema
 	waitgroup    sync.WaitGroup
+
+	lock        sync.Mutex // Protects socketPath, reqTimeout, reqListener, running, and draining
+	socketPath  string
+	reqTimeout  time.Duration
+	reqListener *acomm.UnixListener
+	running     bool
+	draining    bool
+
+	codec          acomm.Codec
+	maxMessageSize uint32
+
+	activeLock sync.Mutex // Protects active
+	active     map[string]*acomm.Request
+	dedupe     *dedupeCache
 }
 
-// newTask creates and initializes a new task.
-func newTask(name, providerName, socketPath string, reqTimeout time.Duration, handler TaskHandler) *task {
-	return &task{
-		name:         name,
-		providerName: providerName,
-		handler:      handler,
-		reqTimeout:   reqTimeout,
-		reqListener:  acomm.NewUnixListener(socketPath, 0),
+// newTask creates and initializes a new task with the settings for it in the
+// config. Responses to requests with idempotency keys are remembered for the
+// idempotency TTL. A non-nil schema is published alongside the socket while
+// the task is running.
+func newTask(name string, config *Config, handler ContextTaskHandler, schema *acomm.TaskSchema) *task {
+	t := &task{
+		name:           name,
+		providerName:   config.ServiceName(),
+		handler:        handler,
+		schema:         schema,
+		socketPath:     taskSocketPath(config, name),
+		reqTimeout:     config.TaskTimeout(name),
+		codec:          config.Codec(),
+		maxMessageSize: config.MaxMessageSize(),
+		active:         make(map[string]*acomm.Request),
+		dedupe:         newDedupeCache(config.IdempotencyTTL()),
 	}
+	t.reqListener = t.newListener(t.socketPath)
+	return t
+}
+
+// newListener creates a request listener for the socket path, accepting the
+// task's codec and message size.
+func (t *task) newListener(socketPath string) *acomm.UnixListener {
+	listener := acomm.NewUnixListener(socketPath, 0)
+	listener.SetCodec(t.codec)
+	listener.SetMaxMessageSize(t.maxMessageSize)
+	return listener
 }
 
 // start starts the task handler.
 func (t *task) start() error {
-	if err := t.reqListener.Start(); err != nil {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if err := t.listen(t.reqListener, t.socketPath); err != nil {
+		return err
+	}
+	t.running = true
+	return nil
+}
+
+// listen starts a request listener and publishes the schema at its socket
+// path.
+func (t *task) listen(listener *acomm.UnixListener, socketPath string) error {
+	if err := listener.Start(); err != nil {
+		return err
+	}
+	if t.schema != nil {
+		if err := writeSchema(socketPath, t.schema); err != nil {
+			listener.Stop(0)
+			return err
+		}
+	}
+
+	go t.handleConns(listener)
+	return nil
+}
+
+// stop shuts down the task handler. The task socket is removed first so no
+// new requests are routed to the task, and requests being handled are given
+// until the deadline to finish before they are abandoned.
+func (t *task) stop(deadline time.Time) {
+	t.drain()
+	if !t.wait(deadline) {
+		t.abandon()
+	}
+
+	t.lock.Lock()
+	listener := t.reqListener
+	t.running = false
+	t.lock.Unlock()
+
+	// Stop request listener and handle all open connections. The socket and
+	// schema were already removed by the drain, and may since belong to a
+	// new instance of the provider.
+	listener.Stop(0)
+
+	// Requests accepted while draining get what is left of the deadline
+	if !t.wait(deadline) {
+		t.abandon()
+	}
+}
+
+// drain removes the task socket and schema so no new requests are routed to
+// the task. Connections already made are still accepted.
+func (t *task) drain() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !t.running || t.draining {
+		return
+	}
+	t.draining = true
+
+	if t.schema != nil {
+		if err := removeSchema(t.socketPath); err != nil {
+			logrus.WithField("error", err).Error("failed to remove task schema")
+		}
+	}
+	if err := t.reqListener.Unlink(); err != nil {
+		err = errors.Wrapv(err, map[string]interface{}{"task": t.name})
+		logrus.WithField("error", err).Error("failed to remove task socket")
+	}
+}
+
+// wait waits for the requests being handled to finish, up to the deadline. It
+// returns whether they finished.
+func (t *task) wait(deadline time.Time) bool {
+	done := make(chan struct{})
+	go func() {
+		t.waitgroup.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(deadline.Sub(time.Now()))
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// abandon responds to the requests still being handled with an unavailable
+// error and cancels them. The error is not temporary, since the handler may
+// have already done part of the work, so callers don't retry them
+// automatically. Results later returned by the handler are discarded.
+func (t *task) abandon() {
+	t.activeLock.Lock()
+	reqs := make([]*acomm.Request, 0, len(t.active))
+	for id, req := range t.active {
+		reqs = append(reqs, req)
+		delete(t.active, id)
+	}
+	t.activeLock.Unlock()
+
+	for _, req := range reqs {
+		req.Cancel()
+		errData := map[string]interface{}{"task": t.name, "requestID": req.ID}
+		logrus.WithFields(logrus.Fields(errData)).Warn("abandoning request not finished before stopping")
+
+		respErr := errors.NewWithCode(errors.CodeUnavailable, "provider stopped before request finished", errData)
+		resp, err := acomm.NewResponse(req, nil, nil, respErr)
+		if err == nil {
+			err = req.Respond(resp)
+		}
+		if err != nil {
+			err = errors.Wrapv(err, errData)
+			logrus.WithField("error", err).Error("failed to respond to abandoned request")
+		}
+	}
+}
+
+// unlisten removes the published schema and stops a request listener,
+// handling all open connections.
+func (t *task) unlisten(listener *acomm.UnixListener, socketPath string) {
+	if t.schema != nil {
+		if err := removeSchema(socketPath); err != nil {
+			logrus.WithField("error", err).Error("failed to remove task schema")
+		}
+	}
+	listener.Stop(0)
+}
+
+// move changes the socket path of the task, such as after its priority
+// changed. A running task starts listening on the new socket before the old
+// one is removed, so it keeps accepting requests.
+func (t *task) move(socketPath string) error {
+	t.lock.Lock()
+	if socketPath == t.socketPath {
+		t.lock.Unlock()
+		return nil
+	}
+
+	// A draining task keeps its socket path until it stops
+	if t.draining {
+		t.lock.Unlock()
+		return nil
+	}
+
+	listener := t.newListener(socketPath)
+	if !t.running {
+		t.reqListener, t.socketPath = listener, socketPath
+		t.lock.Unlock()
+		return nil
+	}
+	if err := t.listen(listener, socketPath); err != nil {
+		t.lock.Unlock()
 		return err
 	}
+	oldListener, oldSocketPath := t.reqListener, t.socketPath
+	t.reqListener, t.socketPath = listener, socketPath
+	t.lock.Unlock()
 
-	go t.handleConns()
+	t.unlisten(oldListener, oldSocketPath)
+	logrus.WithFields(logrus.Fields{
+		"task":   t.name,
+		"from":   oldSocketPath,
+		"socket": socketPath,
+	}).Info("moved task socket")
 	return nil
 }
 
-// stop shuts down the task handler.
-func (t *task) stop() {
-	// Stop request listener and handle all open connections
-	t.reqListener.Stop(0)
+// path returns the current socket path of the task.
+func (t *task) path() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
 
-	// Wait for all actively handled requests
-	t.waitgroup.Wait()
+	return t.socketPath
 }
 
-func (t *task) handleConns() {
+// timeout returns the timeout for new requests.
+func (t *task) timeout() time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.reqTimeout
+}
+
+// setTimeout changes the timeout for new requests. Requests already being
+// handled keep their timeout.
+func (t *task) setTimeout(reqTimeout time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.reqTimeout = reqTimeout
+}
+
+func (t *task) handleConns(listener *acomm.UnixListener) {
 	for {
-		conn := t.reqListener.NextConn()
+		conn := listener.NextConn()
 		if conn == nil {
 			return
 		}
-		go t.acceptRequest(conn)
+		go t.acceptRequest(listener, conn)
 	}
 }
 
-func (t *task) acceptRequest(conn net.Conn) {
-	defer t.reqListener.DoneConn(conn)
+func (t *task) acceptRequest(listener *acomm.UnixListener, conn net.Conn) {
+	defer listener.DoneConn(conn)
 	var respErr error
 
 	req := &acomm.Request{}
-	if err := acomm.UnmarshalConnData(conn, req); err != nil {
+	codec, err := listener.ReadConnData(conn, req)
+	if err != nil {
 		respErr = errors.Wrap(err, "failed to unmarshal request")
 	}
 
@@ -86,7 +314,7 @@ func (t *task) acceptRequest(conn net.Conn) {
 		return
 	}
 
-	if err := acomm.SendConnData(conn, resp); err != nil {
+	if err := acomm.WriteConnData(conn, codec, resp); err != nil {
 		logrus.WithField("error", err).Error("failed to send initial response")
 		return
 	}
@@ -94,8 +322,13 @@ func (t *task) acceptRequest(conn net.Conn) {
 	if respErr != nil {
 		return
 	}
-	// Actually perform the task
+
 	t.waitgroup.Add(1)
+	if req.Task == acomm.CancelTask {
+		go t.cancelRequest(req)
+		return
+	}
+	// Actually perform the task
 	go t.handleRequest(req)
 }
 
@@ -104,11 +337,64 @@ func (t *task) acceptRequest(conn net.Conn) {
 func (t *task) handleRequest(req *acomm.Request) {
 	defer t.waitgroup.Done()
 
-	// Run the task-specific request handler
-	result, streamAddr, taskErr := t.handler(req)
+	t.addActive(req)
+
+	ctx, cancel := req.Context(context.Background())
+	defer cancel()
+	if reqTimeout := t.timeout(); reqTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, reqTimeout)
+		defer cancel()
+	}
+
+	// Nested requests made with the context become children of this span
+	span := acomm.NewRequestSpan(req, t.name, acomm.SpanKindServer)
+	span.SetAttribute("cerana.provider", t.providerName)
+	ctx = acomm.ContextWithSpan(ctx, span)
+
+	start := time.Now()
+	var resp *acomm.Response
+	if req.IdempotencyKey != "" {
+		resp = t.runIdempotent(ctx, req)
+	} else {
+		resp = t.runHandler(ctx, req)
+	}
+
+	var respErr error
+	if resp != nil {
+		respErr = resp.Error
+	}
+	span.Finish(respErr)
+	prometheusx.HandlerDuration.WithLabelValues(t.providerName, t.name, prometheusx.Outcome(respErr)).Observe(prometheusx.Since(start))
+
+	// A cancelled request has already been responded to
+	if t.removeActive(req.ID) == nil {
+		logrus.WithFields(logrus.Fields{
+			"task":      t.name,
+			"requestID": req.ID,
+			"traceID":   req.TraceID,
+		}).Info("discarding result of cancelled request")
+		return
+	}
+	if resp == nil {
+		return
+	}
+
+	if err := req.Respond(resp); err != nil {
+		err = errors.Wrapv(err, map[string]interface{}{"task": t.name, "request": req, "response": resp})
+		logrus.WithField("error", err).Error("failed to send response")
+		return
+	}
+}
+
+// runHandler runs the task-specific handler and creates a response from the
+// results. It returns nil if the response could not be created.
+func (t *task) runHandler(ctx context.Context, req *acomm.Request) *acomm.Response {
+	result, streamAddr, taskErr := t.handler(ctx, req)
+
 	taskErr = errors.Wrap(taskErr, t.providerName, t.name)
 	errData := map[string]interface{}{
 		"task":       t.name,
+		"traceID":    req.TraceID,
 		"request":    req,
 		"taskResult": result,
 		"streamAddr": streamAddr,
@@ -126,12 +412,117 @@ func (t *task) handleRequest(req *acomm.Request) {
 	if err != nil {
 		err = errors.Wrapv(err, errData)
 		logrus.WithField("error", err).Error("failed to create response")
-		return
+		return nil
 	}
+	return resp
+}
 
-	if err := req.Respond(resp); err != nil {
-		err = errors.Wrapv(err, errData)
-		logrus.WithField("error", err).Error("failed to send response")
-		return
+// runIdempotent handles a request with an idempotency key. Only the first
+// request with the key runs the handler; duplicates, such as retries, wait
+// for and get its response.
+func (t *task) runIdempotent(ctx context.Context, req *acomm.Request) *acomm.Response {
+	entry, first := t.dedupe.begin(req.IdempotencyKey)
+	if first {
+		resp := t.runHandler(ctx, req)
+		// A retry may get a different outcome for these, so don't reuse them.
+		// A stream can only be read once, so responses with one aren't either.
+		keep := resp != nil && ctx.Err() == nil && !acomm.IsTemporary(resp.Error) && resp.StreamURL == nil
+		t.dedupe.finish(req.IdempotencyKey, entry, resp, keep)
+		return resp
+	}
+
+	errData := map[string]interface{}{
+		"task":           t.name,
+		"requestID":      req.ID,
+		"idempotencyKey": req.IdempotencyKey,
+	}
+
+	var respErr error
+	select {
+	case <-entry.done:
+		if entry.resp != nil && entry.resp.StreamURL != nil {
+			respErr = errors.NewWithCode(errors.CodeConflict, "original response has a stream, which can't be shared with duplicate requests", errData)
+			break
+		}
+		if entry.resp != nil {
+			logrus.WithFields(logrus.Fields(errData)).Info("returning original response to duplicate request")
+			resp := *entry.resp
+			resp.ID = req.ID
+			return &resp
+		}
+		respErr = errors.Newv("failed to get response of original request", errData)
+	case <-ctx.Done():
+		respErr = errors.Wrapv(ctx.Err(), errData)
+	}
+
+	resp, err := acomm.NewResponse(req, nil, nil, respErr)
+	if err != nil {
+		logrus.WithField("error", errors.Wrapv(err, errData)).Error("failed to create response")
+		return nil
+	}
+	return resp
+}
+
+// cancelRequest handles a cancel request for an actively handled request and
+// responds to the cancel request.
+func (t *task) cancelRequest(cancelReq *acomm.Request) {
+	defer t.waitgroup.Done()
+
+	resp, err := acomm.NewResponse(cancelReq, nil, nil, t.cancelActive(cancelReq))
+	if err == nil {
+		err = cancelReq.Respond(resp)
+	}
+	if err != nil {
+		err = errors.Wrapv(err, map[string]interface{}{"task": t.name, "request": cancelReq})
+		logrus.WithField("error", err).Error("failed to respond to cancel request")
+	}
+}
+
+// cancelActive cancels the request targeted by a cancel request and sends a
+// cancelled response for it.
+func (t *task) cancelActive(cancelReq *acomm.Request) error {
+	args := &acomm.CancelArgs{}
+	if err := cancelReq.UnmarshalArgs(args); err != nil {
+		return err
+	}
+
+	req := t.removeActive(args.RequestID)
+	if req == nil {
+		return errors.NewWithCode(errors.CodeNotFound, "request not active", map[string]interface{}{"task": t.name, "cancelRequestID": args.RequestID})
+	}
+
+	req.Cancel()
+	logrus.WithFields(logrus.Fields{
+		"task":      t.name,
+		"requestID": req.ID,
+	}).Info("request cancelled")
+
+	resp, err := acomm.NewResponse(req, nil, nil, acomm.NewCancelledError("request cancelled", map[string]interface{}{"requestID": req.ID}))
+	if err != nil {
+		return err
+	}
+	return errors.Wrapv(req.Respond(resp), map[string]interface{}{"task": t.name}, "failed to send cancelled response")
+}
+
+// addActive tracks a request while it is being handled.
+func (t *task) addActive(req *acomm.Request) {
+	t.activeLock.Lock()
+	defer t.activeLock.Unlock()
+
+	t.active[req.ID] = req
+}
+
+// removeActive stops tracking an actively handled request and returns it, or
+// nil if it was not being tracked. This allows exactly one of completion or
+// cancellation to respond to a request.
+func (t *task) removeActive(id string) *acomm.Request {
+	t.activeLock.Lock()
+	defer t.activeLock.Unlock()
+
+	req, ok := t.active[id]
+	if !ok {
+		return nil
 	}
+	delete(t.active, id)
+	return req
 }
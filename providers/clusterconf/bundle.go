@@ -8,12 +8,12 @@ import (
 	"path"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/pkg/errors"
+	"golang.org/x/net/context"
 )
 
 const bundlesPrefix string = "bundles"
@@ -206,21 +206,21 @@ type BundleListResult struct {
 }
 
 // GetBundle retrieves a bundle.
-func (c *ClusterConf) GetBundle(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) GetBundle(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args GetBundleArgs
 	if err := req.UnmarshalArgs(&args); err != nil {
 		return nil, nil, err
 	}
 	if args.ID == 0 {
-		return nil, nil, errors.Newv("missing arg: id", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: id", map[string]interface{}{"args": args})
 	}
 
-	bundle, err := c.getBundle(args.ID)
+	bundle, err := c.getBundle(ctx, args.ID)
 	if err != nil {
 		return nil, nil, err
 	}
 	if args.CombinedOverlay {
-		bundle, err = bundle.combinedOverlay()
+		bundle, err = bundle.combinedOverlay(ctx)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -229,13 +229,13 @@ func (c *ClusterConf) GetBundle(req *acomm.Request) (interface{}, *url.URL, erro
 }
 
 // ListBundles retrieves a list of all bundles.
-func (c *ClusterConf) ListBundles(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) ListBundles(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args ListBundleArgs
 	if err := req.UnmarshalArgs(&args); err != nil {
 		return nil, nil, err
 	}
 
-	keys, err := c.kvKeys(bundlesPrefix)
+	keys, err := c.kvKeys(ctx, bundlesPrefix)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -258,13 +258,13 @@ func (c *ClusterConf) ListBundles(req *acomm.Request) (interface{}, *url.URL, er
 		wg.Add(1)
 		go func(id uint64) {
 			defer wg.Done()
-			bundle, err := c.getBundle(id)
+			bundle, err := c.getBundle(ctx, id)
 			if err != nil {
 				errChan <- err
 				return
 			}
 			if args.CombinedOverlay {
-				bundle, err = bundle.combinedOverlay()
+				bundle, err = bundle.combinedOverlay(ctx)
 				if err != nil {
 					errChan <- err
 					return
@@ -293,13 +293,13 @@ func (c *ClusterConf) ListBundles(req *acomm.Request) (interface{}, *url.URL, er
 }
 
 // UpdateBundle creates or updates a bundle config. When updating, a Get should first be performed and the modified Bundle passed back.
-func (c *ClusterConf) UpdateBundle(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) UpdateBundle(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args BundlePayload
 	if err := req.UnmarshalArgs(&args); err != nil {
 		return nil, nil, err
 	}
 	if args.Bundle == nil {
-		return nil, nil, errors.Newv("missing arg: bundle", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: bundle", map[string]interface{}{"args": args})
 	}
 	args.Bundle.c = c
 
@@ -308,51 +308,51 @@ func (c *ClusterConf) UpdateBundle(req *acomm.Request) (interface{}, *url.URL, e
 		args.Bundle.ID = uint64(rand.Int63())
 	}
 
-	if err := args.Bundle.update(); err != nil {
+	if err := args.Bundle.update(ctx); err != nil {
 		return nil, nil, err
 	}
 	return &BundlePayload{args.Bundle}, nil, nil
 }
 
 // DeleteBundle deletes a bundle config.
-func (c *ClusterConf) DeleteBundle(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) DeleteBundle(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args DeleteBundleArgs
 	if err := req.UnmarshalArgs(&args); err != nil {
 		return nil, nil, err
 	}
 	if args.ID == 0 {
-		return nil, nil, errors.Newv("missing arg: id", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: id", map[string]interface{}{"args": args})
 	}
 
-	bundle, err := c.getBundle(args.ID)
+	bundle, err := c.getBundle(ctx, args.ID)
 	if err != nil {
-		if strings.Contains(err.Error(), "bundle config not found") {
+		if errors.IsCode(err, errors.CodeNotFound) {
 			return nil, nil, nil
 		}
 		return nil, nil, err
 	}
 
-	return nil, nil, bundle.delete()
+	return nil, nil, bundle.delete(ctx)
 }
 
-func (c *ClusterConf) getBundle(id uint64) (*Bundle, error) {
+func (c *ClusterConf) getBundle(ctx context.Context, id uint64) (*Bundle, error) {
 	bundle := &Bundle{
 		c:  c,
 		ID: id,
 	}
-	if err := bundle.reload(); err != nil {
+	if err := bundle.reload(ctx); err != nil {
 		return nil, err
 	}
 	return bundle, nil
 }
 
-func (b *Bundle) reload() error {
+func (b *Bundle) reload(ctx context.Context) error {
 	var err error
 	key := path.Join(bundlesPrefix, strconv.FormatUint(b.ID, 10), "config")
-	value, err := b.c.kvGet(key)
+	value, err := b.c.kvGet(ctx, key)
 	if err != nil {
-		if strings.Contains(err.Error(), "key not found") {
-			err = errors.Newv("bundle config not found", map[string]interface{}{"bundleID": b.ID})
+		if errors.IsCode(err, errors.CodeNotFound) {
+			err = errors.NewWithCode(errors.CodeNotFound, "bundle config not found", map[string]interface{}{"bundleID": b.ID})
 		}
 		return err
 	}
@@ -365,16 +365,16 @@ func (b *Bundle) reload() error {
 	return nil
 }
 
-func (b *Bundle) delete() error {
+func (b *Bundle) delete(ctx context.Context) error {
 	key := path.Join(bundlesPrefix, strconv.FormatUint(b.ID, 10))
-	return errors.Wrapv(b.c.kvDelete(key, b.ModIndex), map[string]interface{}{"bundleID": b.ID})
+	return errors.Wrapv(b.c.kvDelete(ctx, key, b.ModIndex), map[string]interface{}{"bundleID": b.ID})
 }
 
 // update saves the core bundle config.
-func (b *Bundle) update() error {
+func (b *Bundle) update(ctx context.Context) error {
 	key := path.Join(bundlesPrefix, strconv.FormatUint(b.ID, 10), "config")
 
-	index, err := b.c.kvUpdate(key, b, b.ModIndex)
+	index, err := b.c.kvUpdate(ctx, key, b, b.ModIndex)
 	if err != nil {
 		return errors.Wrapv(err, map[string]interface{}{"bundleID": b.ID})
 	}
@@ -385,7 +385,7 @@ func (b *Bundle) update() error {
 
 // combinedOverlay will create a new *Bundle object containing the base configurations of datasets and services with the bundle values overlayed on top.
 // Note: Attempting to save a combined overlay bundle will result in an error.
-func (b *Bundle) combinedOverlay() (*Bundle, error) {
+func (b *Bundle) combinedOverlay(ctx context.Context) (*Bundle, error) {
 	var wg sync.WaitGroup
 	errorChan := make(chan error, len(b.Datasets)+len(b.Services))
 	defer close(errorChan)
@@ -417,7 +417,7 @@ func (b *Bundle) combinedOverlay() (*Bundle, error) {
 		wg.Add(1)
 		go func(id string, bd BundleDataset) {
 			defer wg.Done()
-			dataset, err := b.c.getDataset(id)
+			dataset, err := b.c.getDataset(ctx, id)
 			if err != nil {
 				errorChan <- err
 				return
@@ -435,7 +435,7 @@ func (b *Bundle) combinedOverlay() (*Bundle, error) {
 		wg.Add(1)
 		go func(id string, bs BundleService) {
 			defer wg.Done()
-			service, err := b.c.getService(id)
+			service, err := b.c.getService(ctx, id)
 			if err != nil {
 				errorChan <- err
 				return
@@ -11,6 +11,7 @@ import (
 	"github.com/cerana/cerana/pkg/errors"
 	"github.com/cerana/cerana/providers/clusterconf"
 	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
 )
 
 func (s *clusterConf) TestGetBundle() {
@@ -40,7 +41,7 @@ func (s *clusterConf) TestGetBundle() {
 			},
 		})
 		s.Require().NoError(err, test.desc)
-		result, streamURL, err := s.clusterConf.GetBundle(req)
+		result, streamURL, err := s.clusterConf.GetBundle(context.Background(), req)
 		s.Nil(streamURL, test.desc)
 		if test.err != "" {
 			s.Contains(err.Error(), test.err, test.desc)
@@ -92,7 +93,7 @@ func (s *clusterConf) TestUpdateBundle() {
 			},
 		})
 		s.Require().NoError(err, test.desc)
-		result, streamURL, err := s.clusterConf.UpdateBundle(req)
+		result, streamURL, err := s.clusterConf.UpdateBundle(context.Background(), req)
 		s.Nil(streamURL, test.desc)
 		if test.err != "" {
 			s.Contains(err.Error(), test.err, test.desc)
@@ -134,7 +135,7 @@ func (s *clusterConf) TestDeleteBundle() {
 			Args: &clusterconf.DeleteBundleArgs{ID: test.id},
 		})
 		s.Require().NoError(err, desc)
-		result, streamURL, err := s.clusterConf.DeleteBundle(req)
+		result, streamURL, err := s.clusterConf.DeleteBundle(context.Background(), req)
 		s.Nil(streamURL, desc)
 		s.Nil(result, desc)
 		if test.err != "" {
@@ -170,7 +171,7 @@ func (s *clusterConf) TestBundleHeartbeat() {
 		})
 		args := string(*req.Args)
 		s.Require().NoError(err, args)
-		result, streamURL, err := s.clusterConf.BundleHeartbeat(req)
+		result, streamURL, err := s.clusterConf.BundleHeartbeat(context.Background(), req)
 		s.Nil(streamURL, args)
 		if test.err != "" {
 			s.Contains(err.Error(), test.err, args)
@@ -223,14 +224,14 @@ func (s *clusterConf) TestListBundleHeartbeats() {
 		Args: &clusterconf.BundleHeartbeatArgs{ID: id, Serial: serial, IP: hb.IP},
 	})
 	s.Require().NoError(err)
-	_, _, err = s.clusterConf.BundleHeartbeat(req)
+	_, _, err = s.clusterConf.BundleHeartbeat(context.Background(), req)
 	s.Require().NoError(err)
 
 	req, err = acomm.NewRequest(acomm.RequestOptions{
 		Task: "bundle-list-heartbeats",
 	})
 	s.Require().NoError(err)
-	result, streamURL, err := s.clusterConf.ListBundleHeartbeats(req)
+	result, streamURL, err := s.clusterConf.ListBundleHeartbeats(context.Background(), req)
 	s.NoError(err)
 	s.Nil(streamURL)
 	if !s.NotNil(result) {
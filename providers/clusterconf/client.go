@@ -0,0 +1,197 @@
+package clusterconf
+
+import (
+	"strconv"
+
+	"github.com/cerana/cerana/acomm"
+	"golang.org/x/net/context"
+)
+
+// Client makes typed requests to the clusterconf provider's tasks.
+type Client struct {
+	c *acomm.Client
+}
+
+// NewClient creates a new Client sending requests with the acomm client.
+func NewClient(c *acomm.Client) *Client {
+	return &Client{c: c}
+}
+
+// GetBundle retrieves a bundle, combined with its service and dataset configs
+// if overlay is set.
+func (c *Client) GetBundle(ctx context.Context, id uint64, overlay bool) (*Bundle, error) {
+	var result BundlePayload
+	err := c.c.Call(ctx, TaskGetBundle, nil, GetBundleArgs{ID: id, CombinedOverlay: overlay}, &result)
+	return result.Bundle, err
+}
+
+// ListBundles retrieves all bundles, combined with their service and dataset
+// configs if overlay is set.
+func (c *Client) ListBundles(ctx context.Context, overlay bool) ([]*Bundle, error) {
+	var result BundleListResult
+	err := c.c.Call(ctx, TaskListBundles, nil, ListBundleArgs{CombinedOverlay: overlay}, &result)
+	return result.Bundles, err
+}
+
+// UpdateBundle creates or updates a bundle, returning the stored bundle.
+func (c *Client) UpdateBundle(ctx context.Context, bundle *Bundle) (*Bundle, error) {
+	var result BundlePayload
+	err := c.c.Call(ctx, TaskUpdateBundle, nil, BundlePayload{Bundle: bundle}, &result)
+	return result.Bundle, err
+}
+
+// DeleteBundle removes a bundle.
+func (c *Client) DeleteBundle(ctx context.Context, id uint64) error {
+	return c.c.Call(ctx, TaskDeleteBundle, nil, DeleteBundleArgs{ID: id}, nil)
+}
+
+// BundleHeartbeat registers a bundle heartbeat from a node.
+func (c *Client) BundleHeartbeat(ctx context.Context, args BundleHeartbeatArgs) error {
+	return c.c.Call(ctx, TaskBundleHeartbeat, nil, args, nil)
+}
+
+// SendBundleHeartbeats registers bundle heartbeats from a node in a single
+// batch. The errors of unsuccessful heartbeats are returned, keyed on bundle
+// id.
+func (c *Client) SendBundleHeartbeats(ctx context.Context, heartbeats []BundleHeartbeatArgs) map[uint64]error {
+	args := make(map[string]interface{}, len(heartbeats))
+	for _, hb := range heartbeats {
+		args[strconv.FormatUint(hb.ID, 10)] = hb
+	}
+
+	errs := make(map[uint64]error)
+	for name, err := range c.c.CallBatch(ctx, TaskBundleHeartbeat, args) {
+		id, _ := strconv.ParseUint(name, 10, 64)
+		errs[id] = err
+	}
+	return errs
+}
+
+// ListBundleHeartbeats retrieves the heartbeats of all bundles.
+func (c *Client) ListBundleHeartbeats(ctx context.Context) (map[uint64]BundleHeartbeats, error) {
+	var result BundleHeartbeatList
+	err := c.c.Call(ctx, TaskListBundleHeartbeats, nil, nil, &result)
+	return result.Heartbeats, err
+}
+
+// GetDataset retrieves a dataset.
+func (c *Client) GetDataset(ctx context.Context, id string) (*Dataset, error) {
+	var result DatasetPayload
+	err := c.c.Call(ctx, TaskGetDataset, nil, IDArgs{ID: id}, &result)
+	return result.Dataset, err
+}
+
+// ListDatasets retrieves all datasets.
+func (c *Client) ListDatasets(ctx context.Context) ([]*Dataset, error) {
+	var result DatasetListResult
+	err := c.c.Call(ctx, TaskListDatasets, nil, nil, &result)
+	return result.Datasets, err
+}
+
+// UpdateDataset creates or updates a dataset, returning the stored dataset.
+func (c *Client) UpdateDataset(ctx context.Context, dataset *Dataset) (*Dataset, error) {
+	var result DatasetPayload
+	err := c.c.Call(ctx, TaskUpdateDataset, nil, DatasetPayload{Dataset: dataset}, &result)
+	return result.Dataset, err
+}
+
+// DeleteDataset removes a dataset.
+func (c *Client) DeleteDataset(ctx context.Context, id string) error {
+	return c.c.Call(ctx, TaskDeleteDataset, nil, IDArgs{ID: id}, nil)
+}
+
+// DatasetHeartbeat registers a dataset heartbeat from a node.
+func (c *Client) DatasetHeartbeat(ctx context.Context, args DatasetHeartbeatArgs) error {
+	return c.c.Call(ctx, TaskDatasetHeartbeat, nil, args, nil)
+}
+
+// SendDatasetHeartbeats registers dataset heartbeats from a node in a single
+// batch. The errors of unsuccessful heartbeats are returned, keyed on dataset
+// id.
+func (c *Client) SendDatasetHeartbeats(ctx context.Context, heartbeats []DatasetHeartbeatArgs) map[string]error {
+	args := make(map[string]interface{}, len(heartbeats))
+	for _, hb := range heartbeats {
+		args[hb.ID] = hb
+	}
+	return c.c.CallBatch(ctx, TaskDatasetHeartbeat, args)
+}
+
+// ListDatasetHeartbeats retrieves the heartbeats of all datasets.
+func (c *Client) ListDatasetHeartbeats(ctx context.Context) (map[string]map[string]DatasetHeartbeat, error) {
+	var result DatasetHeartbeatList
+	err := c.c.Call(ctx, TaskListDatasetHeartbeats, nil, nil, &result)
+	return result.Heartbeats, err
+}
+
+// GetDefaults retrieves the cluster defaults.
+func (c *Client) GetDefaults(ctx context.Context) (*Defaults, error) {
+	var result DefaultsPayload
+	err := c.c.Call(ctx, TaskGetDefaults, nil, nil, &result)
+	return result.Defaults, err
+}
+
+// SetDefaults updates the cluster defaults, returning the stored defaults.
+func (c *Client) SetDefaults(ctx context.Context, defaults *Defaults) (*Defaults, error) {
+	var result DefaultsPayload
+	err := c.c.Call(ctx, TaskSetDefaults, nil, DefaultsPayload{Defaults: defaults}, &result)
+	return result.Defaults, err
+}
+
+// NodeHeartbeat registers a node heartbeat.
+func (c *Client) NodeHeartbeat(ctx context.Context, node *Node) error {
+	return c.c.Call(ctx, TaskNodeHeartbeat, nil, NodePayload{Node: node}, nil)
+}
+
+// GetNode retrieves a node.
+func (c *Client) GetNode(ctx context.Context, id string) (*Node, error) {
+	var result NodePayload
+	err := c.c.Call(ctx, TaskGetNode, nil, IDArgs{ID: id}, &result)
+	return result.Node, err
+}
+
+// ListNodes retrieves all nodes.
+func (c *Client) ListNodes(ctx context.Context) ([]Node, error) {
+	var result ListNodesResult
+	err := c.c.Call(ctx, TaskListNodes, nil, nil, &result)
+	return result.Nodes, err
+}
+
+// GetNodesHistory retrieves the heartbeat history of nodes.
+func (c *Client) GetNodesHistory(ctx context.Context, args NodeHistoryArgs) (NodesHistory, error) {
+	var result NodesHistoryResult
+	err := c.c.Call(ctx, TaskGetNodesHistory, nil, args, &result)
+	return result.History, err
+}
+
+// GetService retrieves a service.
+func (c *Client) GetService(ctx context.Context, id string) (*Service, error) {
+	var result ServicePayload
+	err := c.c.Call(ctx, TaskGetService, nil, IDArgs{ID: id}, &result)
+	return result.Service, err
+}
+
+// UpdateService creates or updates a service, returning the stored service.
+func (c *Client) UpdateService(ctx context.Context, service *Service) (*Service, error) {
+	var result ServicePayload
+	err := c.c.Call(ctx, TaskUpdateService, nil, ServicePayload{Service: service}, &result)
+	return result.Service, err
+}
+
+// DeleteService removes a service.
+func (c *Client) DeleteService(ctx context.Context, id string) error {
+	return c.c.Call(ctx, TaskDeleteService, nil, IDArgs{ID: id}, nil)
+}
+
+// GetDHCP retrieves the cluster DHCP config.
+func (c *Client) GetDHCP(ctx context.Context) (*DHCPConfig, error) {
+	var result DHCPConfig
+	if err := c.c.Call(ctx, TaskGetDHCP, nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetDHCP updates the cluster DHCP config.
+func (c *Client) SetDHCP(ctx context.Context, config DHCPConfig) error {
+	return c.c.Call(ctx, TaskSetDHCP, nil, config, nil)
+}
@@ -0,0 +1,160 @@
+package clusterconf_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/test"
+	"github.com/cerana/cerana/providers/clusterconf"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type client struct {
+	suite.Suite
+	coordinator *test.Coordinator
+	clusterConf *clusterconf.MockClusterConf
+	client      *clusterconf.Client
+}
+
+func TestClient(t *testing.T) {
+	suite.Run(t, new(client))
+}
+
+func (s *client) SetupSuite() {
+	var err error
+	s.coordinator, err = test.NewCoordinator("")
+	s.Require().NoError(err)
+
+	s.clusterConf = clusterconf.NewMockClusterConf()
+	s.coordinator.RegisterProvider(s.clusterConf)
+	s.Require().NoError(s.coordinator.Start())
+
+	s.client = clusterconf.NewClient(s.coordinator.NewClient())
+}
+
+func (s *client) TearDownSuite() {
+	s.coordinator.Stop()
+	s.Require().NoError(s.coordinator.Cleanup())
+}
+
+func (s *client) TestBundles() {
+	ctx := context.Background()
+
+	bundle, err := s.client.UpdateBundle(ctx, &clusterconf.Bundle{Redundancy: 2})
+	s.Require().NoError(err)
+	s.NotEqual(uint64(0), bundle.ID)
+
+	got, err := s.client.GetBundle(ctx, bundle.ID, false)
+	if s.NoError(err) {
+		s.Equal(bundle.Redundancy, got.Redundancy)
+	}
+	bundles, err := s.client.ListBundles(ctx, false)
+	s.NoError(err)
+	s.Len(bundles, 1)
+
+	s.NoError(s.client.BundleHeartbeat(ctx, clusterconf.BundleHeartbeatArgs{ID: bundle.ID, Serial: "foo", IP: net.ParseIP("10.0.0.1")}))
+	heartbeats, err := s.client.ListBundleHeartbeats(ctx)
+	if s.NoError(err) {
+		s.Len(heartbeats[bundle.ID], 1)
+	}
+
+	errs := s.client.SendBundleHeartbeats(ctx, []clusterconf.BundleHeartbeatArgs{
+		{ID: bundle.ID, Serial: "bar", IP: net.ParseIP("10.0.0.2")},
+		{ID: 0, Serial: "bar", IP: net.ParseIP("10.0.0.2")},
+	})
+	s.Len(errs, 1, "should only fail the invalid heartbeat")
+	s.Error(errs[0])
+	heartbeats, err = s.client.ListBundleHeartbeats(ctx)
+	if s.NoError(err) {
+		s.Len(heartbeats[bundle.ID], 2)
+	}
+
+	s.NoError(s.client.DeleteBundle(ctx, bundle.ID))
+	_, err = s.client.GetBundle(ctx, bundle.ID, false)
+	s.True(errors.IsCode(err, errors.CodeNotFound), "should fail with the error code of the provider")
+}
+
+func (s *client) TestDatasets() {
+	ctx := context.Background()
+
+	dataset, err := s.client.UpdateDataset(ctx, &clusterconf.Dataset{Quota: 1024})
+	s.Require().NoError(err)
+	s.NotEmpty(dataset.ID)
+
+	got, err := s.client.GetDataset(ctx, dataset.ID)
+	if s.NoError(err) {
+		s.Equal(dataset.Quota, got.Quota)
+	}
+	datasets, err := s.client.ListDatasets(ctx)
+	s.NoError(err)
+	s.Len(datasets, 1)
+
+	s.NoError(s.client.DatasetHeartbeat(ctx, clusterconf.DatasetHeartbeatArgs{ID: dataset.ID, IP: net.ParseIP("10.0.0.1")}))
+	heartbeats, err := s.client.ListDatasetHeartbeats(ctx)
+	if s.NoError(err) {
+		s.Len(heartbeats[dataset.ID], 1)
+	}
+
+	errs := s.client.SendDatasetHeartbeats(ctx, []clusterconf.DatasetHeartbeatArgs{
+		{ID: dataset.ID, IP: net.ParseIP("10.0.0.2")},
+		{ID: "", IP: net.ParseIP("10.0.0.2")},
+	})
+	s.Len(errs, 1, "should only fail the invalid heartbeat")
+	s.Error(errs[""])
+	heartbeats, err = s.client.ListDatasetHeartbeats(ctx)
+	if s.NoError(err) {
+		s.Len(heartbeats[dataset.ID], 2)
+	}
+
+	s.NoError(s.client.DeleteDataset(ctx, dataset.ID))
+	_, err = s.client.GetDataset(ctx, dataset.ID)
+	s.True(errors.IsCode(err, errors.CodeNotFound), "should fail with the error code of the provider")
+}
+
+func (s *client) TestServices() {
+	ctx := context.Background()
+
+	service, err := s.client.UpdateService(ctx, &clusterconf.Service{})
+	s.Require().NoError(err)
+	s.NotEmpty(service.ID)
+
+	got, err := s.client.GetService(ctx, service.ID)
+	if s.NoError(err) {
+		s.Equal(service.ModIndex, got.ModIndex)
+	}
+
+	s.NoError(s.client.DeleteService(ctx, service.ID))
+	_, err = s.client.GetService(ctx, service.ID)
+	s.True(errors.IsCode(err, errors.CodeNotFound), "should fail with the error code of the provider")
+}
+
+func (s *client) TestDefaults() {
+	ctx := context.Background()
+
+	defaults, err := s.client.SetDefaults(ctx, &clusterconf.Defaults{DefaultsConf: clusterconf.DefaultsConf{ZFSManual: true}})
+	s.Require().NoError(err)
+
+	got, err := s.client.GetDefaults(ctx)
+	if s.NoError(err) {
+		s.Equal(defaults.ModIndex, got.ModIndex)
+		s.True(got.ZFSManual)
+	}
+}
+
+func (s *client) TestNodes() {
+	ctx := context.Background()
+
+	node := &clusterconf.Node{ID: "client-test", Heartbeat: time.Now(), CPUCores: 4}
+	s.NoError(s.client.NodeHeartbeat(ctx, node))
+
+	got, err := s.client.GetNode(ctx, node.ID)
+	if s.NoError(err) {
+		s.Equal(node.CPUCores, got.CPUCores)
+	}
+	nodes, err := s.client.ListNodes(ctx)
+	s.NoError(err)
+	s.Len(nodes, 1)
+}
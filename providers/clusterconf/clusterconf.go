@@ -8,6 +8,8 @@ import (
 	"github.com/cerana/cerana/pkg/errors"
 	"github.com/cerana/cerana/pkg/kv"
 	"github.com/cerana/cerana/provider"
+	kvp "github.com/cerana/cerana/providers/kv"
+	"golang.org/x/net/context"
 )
 
 // ClusterConf is a provider of cluster configuration functionality.
@@ -31,156 +33,75 @@ func New(config *Config, tracker *acomm.Tracker) *ClusterConf {
 
 // RegisterTasks registers all of Systemd's task handlers with the server.
 func (c *ClusterConf) RegisterTasks(server *provider.Server) {
-	server.RegisterTask("get-bundle", c.GetBundle)
-	server.RegisterTask("list-bundles", c.ListBundles)
-	server.RegisterTask("update-bundle", c.UpdateBundle)
-	server.RegisterTask("delete-bundle", c.DeleteBundle)
-	server.RegisterTask("bundle-heartbeat", c.BundleHeartbeat)
-	server.RegisterTask("list-bundle-heartbeats", c.ListBundleHeartbeats)
-
-	server.RegisterTask("get-dataset", c.GetDataset)
-	server.RegisterTask("list-datasets", c.ListDatasets)
-	server.RegisterTask("update-dataset", c.UpdateDataset)
-	server.RegisterTask("delete-dataset", c.DeleteDataset)
-	server.RegisterTask("dataset-heartbeat", c.DatasetHeartbeat)
-	server.RegisterTask("list-dataset-heartbeats", c.ListDatasetHeartbeats)
-
-	server.RegisterTask("get-default-options", c.GetDefaults)
-	server.RegisterTask("set-default-options", c.UpdateDefaults)
-
-	server.RegisterTask("node-heartbeat", c.NodeHeartbeat)
-	server.RegisterTask("get-node", c.GetNode)
-	server.RegisterTask("list-nodes", c.ListNodes)
-	server.RegisterTask("get-nodes-history", c.GetNodesHistory)
-
-	server.RegisterTask("get-service", c.GetService)
-	server.RegisterTask("update-service", c.UpdateService)
-	server.RegisterTask("delete-service", c.DeleteService)
-
-	server.RegisterTask("get-dhcp-config", c.GetDHCP)
-	server.RegisterTask("set-dhcp-config", c.SetDHCP)
+	server.RegisterContextTask(TaskGetBundle, c.GetBundle, taskSchemas[TaskGetBundle])
+	server.RegisterContextTask(TaskListBundles, c.ListBundles, taskSchemas[TaskListBundles])
+	server.RegisterContextTask(TaskUpdateBundle, c.UpdateBundle, taskSchemas[TaskUpdateBundle])
+	server.RegisterContextTask(TaskDeleteBundle, c.DeleteBundle, taskSchemas[TaskDeleteBundle])
+	server.RegisterContextTask(TaskBundleHeartbeat, c.BundleHeartbeat, taskSchemas[TaskBundleHeartbeat])
+	server.RegisterContextTask(TaskListBundleHeartbeats, c.ListBundleHeartbeats, taskSchemas[TaskListBundleHeartbeats])
+
+	server.RegisterContextTask(TaskGetDataset, c.GetDataset, taskSchemas[TaskGetDataset])
+	server.RegisterContextTask(TaskListDatasets, c.ListDatasets, taskSchemas[TaskListDatasets])
+	server.RegisterContextTask(TaskUpdateDataset, c.UpdateDataset, taskSchemas[TaskUpdateDataset])
+	server.RegisterContextTask(TaskDeleteDataset, c.DeleteDataset, taskSchemas[TaskDeleteDataset])
+	server.RegisterContextTask(TaskDatasetHeartbeat, c.DatasetHeartbeat, taskSchemas[TaskDatasetHeartbeat])
+	server.RegisterContextTask(TaskListDatasetHeartbeats, c.ListDatasetHeartbeats, taskSchemas[TaskListDatasetHeartbeats])
+
+	server.RegisterContextTask(TaskGetDefaults, c.GetDefaults, taskSchemas[TaskGetDefaults])
+	server.RegisterContextTask(TaskSetDefaults, c.UpdateDefaults, taskSchemas[TaskSetDefaults])
+
+	server.RegisterContextTask(TaskNodeHeartbeat, c.NodeHeartbeat, taskSchemas[TaskNodeHeartbeat])
+	server.RegisterContextTask(TaskGetNode, c.GetNode, taskSchemas[TaskGetNode])
+	server.RegisterContextTask(TaskListNodes, c.ListNodes, taskSchemas[TaskListNodes])
+	server.RegisterContextTask(TaskGetNodesHistory, c.GetNodesHistory, taskSchemas[TaskGetNodesHistory])
+
+	server.RegisterContextTask(TaskGetService, c.GetService, taskSchemas[TaskGetService])
+	server.RegisterContextTask(TaskUpdateService, c.UpdateService, taskSchemas[TaskUpdateService])
+	server.RegisterContextTask(TaskDeleteService, c.DeleteService, taskSchemas[TaskDeleteService])
+
+	server.RegisterContextTask(TaskGetDHCP, c.GetDHCP, taskSchemas[TaskGetDHCP])
+	server.RegisterContextTask(TaskSetDHCP, c.SetDHCP, taskSchemas[TaskSetDHCP])
 }
 
-func (c *ClusterConf) kvReq(task string, args map[string]interface{}) (*acomm.Response, error) {
-	respChan := make(chan *acomm.Response, 1)
-	defer close(respChan)
-	rh := func(_ *acomm.Request, resp *acomm.Response) {
-		respChan <- resp
-	}
-
-	errData := map[string]interface{}{"task": task, "args": args}
-
-	if val, ok := args["value"]; ok {
-		valJSON, err := json.Marshal(val)
-		if err != nil {
-			return nil, errors.Wrapv(err, errData, "failed to json marshal value")
-		}
-		args["value"] = string(valJSON)
-	}
-
-	req, err := acomm.NewRequest(acomm.RequestOptions{
-		Task:           task,
-		ResponseHook:   c.tracker.URL(),
-		Args:           args,
-		SuccessHandler: rh,
-		ErrorHandler:   rh,
-	})
-	if err != nil {
-		return nil, err
-	}
-	if err := c.tracker.TrackRequest(req, 0); err != nil {
-		return nil, err
-	}
-	if err := acomm.Send(c.config.CoordinatorURL(), req); err != nil {
-		c.tracker.RemoveRequest(req)
-		return nil, err
-	}
-
-	resp := <-respChan
-	return resp, errors.Wrapv(errors.ResetStack(resp.Error), errData)
+// kv returns a client for the kv provider's tasks.
+func (c *ClusterConf) kv() *kvp.Client {
+	return kvp.NewClient(acomm.NewClient(c.tracker, c.config.CoordinatorURL(), c.config.RequestTimeout()))
 }
 
-func (c *ClusterConf) kvKeys(prefix string) ([]string, error) {
-	args := map[string]interface{}{
-		"key": prefix,
-	}
-
-	resp, err := c.kvReq("kv-keys", args)
-	if err != nil {
-		return nil, err
-	}
-	var values []string
-	if err := resp.UnmarshalResult(&values); err != nil {
-		return nil, errors.Wrapv(err, map[string]interface{}{"args": args})
-	}
-	return values, nil
+func (c *ClusterConf) kvKeys(ctx context.Context, prefix string) ([]string, error) {
+	values, err := c.kv().Keys(ctx, prefix)
+	return values, errors.Wrapv(err, map[string]interface{}{"key": prefix})
 }
 
-func (c *ClusterConf) kvGetAll(key string) (map[string]kv.Value, error) {
-	args := map[string]interface{}{
-		"key": key,
-	}
-
-	resp, err := c.kvReq("kv-getAll", args)
-	if err != nil {
-		return nil, err
-	}
-	values := make(map[string]kv.Value)
-	if err := resp.UnmarshalResult(&values); err != nil {
-		return nil, errors.Wrapv(err, map[string]interface{}{"args": args})
-	}
-	return values, nil
+func (c *ClusterConf) kvGetAll(ctx context.Context, key string) (map[string]kv.Value, error) {
+	values, err := c.kv().GetAll(ctx, key)
+	return values, errors.Wrapv(err, map[string]interface{}{"key": key})
 }
 
-func (c *ClusterConf) kvGet(key string) (kv.Value, error) {
-	var value kv.Value
-	args := map[string]interface{}{
-		"key": key,
-	}
-
-	resp, err := c.kvReq("kv-get", args)
-	if err != nil {
-		return value, err
-	}
-
-	if err := resp.UnmarshalResult(&value); err != nil {
-		return value, errors.Wrapv(err, map[string]interface{}{"args": args})
-	}
-	return value, nil
+func (c *ClusterConf) kvGet(ctx context.Context, key string) (kv.Value, error) {
+	value, err := c.kv().Get(ctx, key)
+	return value, errors.Wrapv(err, map[string]interface{}{"key": key})
 }
 
-func (c *ClusterConf) kvDelete(key string, modIndex uint64) error {
-	args := map[string]interface{}{
-		"key":     key,
-		"recurse": true,
-	}
-	_, err := c.kvReq("kv-delete", args)
-	return errors.Wrapv(err, map[string]interface{}{"args": args})
+func (c *ClusterConf) kvDelete(ctx context.Context, key string, modIndex uint64) error {
+	return errors.Wrapv(c.kv().Delete(ctx, key, true), map[string]interface{}{"key": key})
 }
 
-func (c *ClusterConf) kvUpdate(key string, value interface{}, modIndex uint64) (uint64, error) {
-	args := map[string]interface{}{
-		"key":   key,
-		"value": value,
-		"index": modIndex,
-	}
-	resp, err := c.kvReq("kv-update", args)
+func (c *ClusterConf) kvUpdate(ctx context.Context, key string, value interface{}, modIndex uint64) (uint64, error) {
+	errData := map[string]interface{}{"key": key, "index": modIndex}
+	valueJSON, err := json.Marshal(value)
 	if err != nil {
-		return 0, err
-	}
-	result := make(map[string]uint64)
-	if err := resp.UnmarshalResult(&result); err != nil {
-		return 0, errors.Wrapv(err, map[string]interface{}{"args": args})
+		return 0, errors.Wrapv(err, errData, "failed to json marshal value")
 	}
-	return result["index"], nil
+	index, err := c.kv().Update(ctx, key, string(valueJSON), modIndex)
+	return index, errors.Wrapv(err, errData)
 }
 
-func (c *ClusterConf) kvEphemeral(key string, value interface{}, ttl time.Duration) error {
-	args := map[string]interface{}{
-		"key":   key,
-		"value": value,
-		"ttl":   ttl,
+func (c *ClusterConf) kvEphemeral(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	errData := map[string]interface{}{"key": key, "ttl": ttl}
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return errors.Wrapv(err, errData, "failed to json marshal value")
 	}
-	_, err := c.kvReq("kv-ephemeral-set", args)
-	return errors.Wrapv(err, map[string]interface{}{"args": args})
+	return errors.Wrapv(c.kv().EphemeralSet(ctx, key, string(valueJSON), ttl), errData)
 }
@@ -16,6 +16,7 @@ import (
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
 )
 
 type clusterConf struct {
@@ -91,7 +92,7 @@ func (s *clusterConf) TestRegisterTasks() {
 }
 
 func (s *clusterConf) loadData(data map[string]interface{}) (map[string]uint64, error) {
-	multiRequest := acomm.NewMultiRequest(s.tracker, 0)
+	multiRequest := acomm.NewMultiRequest(context.Background(), s.tracker, 0)
 	requests := make(map[string]*acomm.Request)
 	for key, v := range data {
 		value, err := json.Marshal(v)
@@ -6,12 +6,12 @@ import (
 	"net/url"
 	"path"
 	"path/filepath"
-	"strings"
 	"sync"
 
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/pkg/errors"
 	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
 )
 
 const datasetsPrefix string = "datasets"
@@ -42,16 +42,16 @@ type DatasetListResult struct {
 }
 
 // GetDataset retrieves a dataset.
-func (c *ClusterConf) GetDataset(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) GetDataset(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args IDArgs
 	if err := req.UnmarshalArgs(&args); err != nil {
 		return nil, nil, err
 	}
 	if args.ID == "" {
-		return nil, nil, errors.Newv("missing arg: id", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: id", map[string]interface{}{"args": args})
 	}
 
-	dataset, err := c.getDataset(args.ID)
+	dataset, err := c.getDataset(ctx, args.ID)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -59,8 +59,8 @@ func (c *ClusterConf) GetDataset(req *acomm.Request) (interface{}, *url.URL, err
 }
 
 // ListDatasets returns a list of all Datasets.
-func (c *ClusterConf) ListDatasets(req *acomm.Request) (interface{}, *url.URL, error) {
-	keys, err := c.kvKeys(datasetsPrefix)
+func (c *ClusterConf) ListDatasets(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
+	keys, err := c.kvKeys(ctx, datasetsPrefix)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -83,7 +83,7 @@ func (c *ClusterConf) ListDatasets(req *acomm.Request) (interface{}, *url.URL, e
 		wg.Add(1)
 		go func(id string) {
 			defer wg.Done()
-			ds, err := c.getDataset(id)
+			ds, err := c.getDataset(ctx, id)
 			if err != nil {
 				errChan <- err
 				return
@@ -111,13 +111,13 @@ func (c *ClusterConf) ListDatasets(req *acomm.Request) (interface{}, *url.URL, e
 }
 
 // UpdateDataset creates or updates a dataset config. When updating, a Get should first be performed and the modified Dataset passed back.
-func (c *ClusterConf) UpdateDataset(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) UpdateDataset(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args DatasetPayload
 	if err := req.UnmarshalArgs(&args); err != nil {
 		return nil, nil, err
 	}
 	if args.Dataset == nil {
-		return nil, nil, errors.Newv("missing arg: dataset", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: dataset", map[string]interface{}{"args": args})
 	}
 	args.Dataset.c = c
 
@@ -125,51 +125,51 @@ func (c *ClusterConf) UpdateDataset(req *acomm.Request) (interface{}, *url.URL,
 		args.Dataset.ID = uuid.New()
 	}
 
-	if err := args.Dataset.update(); err != nil {
+	if err := args.Dataset.update(ctx); err != nil {
 		return nil, nil, err
 	}
 	return &DatasetPayload{args.Dataset}, nil, nil
 }
 
 // DeleteDataset deletes a dataset config.
-func (c *ClusterConf) DeleteDataset(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) DeleteDataset(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args IDArgs
 	if err := req.UnmarshalArgs(&args); err != nil {
 		return nil, nil, err
 	}
 	if args.ID == "" {
-		return nil, nil, errors.Newv("missing arg: id", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: id", map[string]interface{}{"args": args})
 	}
 
-	dataset, err := c.getDataset(args.ID)
+	dataset, err := c.getDataset(ctx, args.ID)
 	if err != nil {
-		if strings.Contains(err.Error(), "dataset config not found") {
+		if errors.IsCode(err, errors.CodeNotFound) {
 			return nil, nil, nil
 		}
 		return nil, nil, err
 	}
 
-	return nil, nil, dataset.delete()
+	return nil, nil, dataset.delete(ctx)
 }
 
-func (c *ClusterConf) getDataset(id string) (*Dataset, error) {
+func (c *ClusterConf) getDataset(ctx context.Context, id string) (*Dataset, error) {
 	dataset := &Dataset{
 		c:  c,
 		ID: id,
 	}
-	if err := dataset.reload(); err != nil {
+	if err := dataset.reload(ctx); err != nil {
 		return nil, err
 	}
 	return dataset, nil
 }
 
-func (d *Dataset) reload() error {
+func (d *Dataset) reload(ctx context.Context) error {
 	var err error
 	key := path.Join(datasetsPrefix, d.ID, "config")
-	value, err := d.c.kvGet(key)
+	value, err := d.c.kvGet(ctx, key)
 	if err != nil {
-		if strings.Contains(err.Error(), "key not found") {
-			err = errors.Newv("dataset config not found", map[string]interface{}{"datasetID": d.ID})
+		if errors.IsCode(err, errors.CodeNotFound) {
+			err = errors.NewWithCode(errors.CodeNotFound, "dataset config not found", map[string]interface{}{"datasetID": d.ID})
 		}
 		return err
 	}
@@ -181,16 +181,16 @@ func (d *Dataset) reload() error {
 	return nil
 }
 
-func (d *Dataset) delete() error {
+func (d *Dataset) delete(ctx context.Context) error {
 	key := path.Join(datasetsPrefix, d.ID)
-	return errors.Wrapv(d.c.kvDelete(key, d.ModIndex), map[string]interface{}{"datasetID": d.ID})
+	return errors.Wrapv(d.c.kvDelete(ctx, key, d.ModIndex), map[string]interface{}{"datasetID": d.ID})
 }
 
 // update saves the core dataset config.
-func (d *Dataset) update() error {
+func (d *Dataset) update(ctx context.Context) error {
 	key := path.Join(datasetsPrefix, d.ID, "config")
 
-	index, err := d.c.kvUpdate(key, d, d.ModIndex)
+	index, err := d.c.kvUpdate(ctx, key, d, d.ModIndex)
 	if err != nil {
 		return errors.Wrapv(err, map[string]interface{}{"datasetID": d.ID})
 	}
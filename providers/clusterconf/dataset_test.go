@@ -7,6 +7,7 @@ import (
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/providers/clusterconf"
 	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
 )
 
 func (s *clusterConf) TestGetDataset() {
@@ -28,7 +29,7 @@ func (s *clusterConf) TestGetDataset() {
 			Args: &clusterconf.IDArgs{ID: test.id},
 		})
 		s.Require().NoError(err, test.id)
-		result, streamURL, err := s.clusterConf.GetDataset(req)
+		result, streamURL, err := s.clusterConf.GetDataset(context.Background(), req)
 		s.Nil(streamURL, test.id)
 		if test.err != "" {
 			s.Contains(err.Error(), test.err, test.id)
@@ -74,7 +75,7 @@ func (s *clusterConf) TestUpdateDataset() {
 			},
 		})
 		s.Require().NoError(err, test.desc)
-		result, streamURL, err := s.clusterConf.UpdateDataset(req)
+		result, streamURL, err := s.clusterConf.UpdateDataset(context.Background(), req)
 		s.Nil(streamURL, test.desc)
 		if test.err != "" {
 			s.Contains(err.Error(), test.err, test.desc)
@@ -115,7 +116,7 @@ func (s *clusterConf) TestDeleteDataset() {
 			Args: &clusterconf.IDArgs{ID: test.id},
 		})
 		s.Require().NoError(err, test.id)
-		result, streamURL, err := s.clusterConf.DeleteDataset(req)
+		result, streamURL, err := s.clusterConf.DeleteDataset(context.Background(), req)
 		s.Nil(streamURL, test.id)
 		s.Nil(result, test.id)
 		if test.err != "" {
@@ -151,7 +152,7 @@ func (s *clusterConf) TestDatasetHeartbeat() {
 		})
 		args := string(*req.Args)
 		s.Require().NoError(err, args)
-		result, streamURL, err := s.clusterConf.DatasetHeartbeat(req)
+		result, streamURL, err := s.clusterConf.DatasetHeartbeat(context.Background(), req)
 		s.Nil(streamURL, args)
 		if test.err != "" {
 			s.Contains(err.Error(), test.err, args)
@@ -175,14 +176,14 @@ func (s *clusterConf) TestListDatasetHeartbeats() {
 		Args: &clusterconf.DatasetHeartbeatArgs{ID: id, IP: hb.IP, InUse: hb.InUse},
 	})
 	s.Require().NoError(err)
-	_, _, err = s.clusterConf.DatasetHeartbeat(req)
+	_, _, err = s.clusterConf.DatasetHeartbeat(context.Background(), req)
 	s.Require().NoError(err)
 
 	req, err = acomm.NewRequest(acomm.RequestOptions{
 		Task: "dataset-list-heartbeats",
 	})
 	s.Require().NoError(err)
-	result, streamURL, err := s.clusterConf.ListDatasetHeartbeats(req)
+	result, streamURL, err := s.clusterConf.ListDatasetHeartbeats(context.Background(), req)
 	s.NoError(err)
 	s.Nil(streamURL)
 	if !s.NotNil(result) {
@@ -3,10 +3,10 @@ package clusterconf
 import (
 	"encoding/json"
 	"net/url"
-	"strings"
 
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/pkg/errors"
+	"golang.org/x/net/context"
 )
 
 const defaultsPrefix string = "cluster"
@@ -30,8 +30,8 @@ type DefaultsPayload struct {
 }
 
 // GetDefaults retrieves the cluster config.
-func (c *ClusterConf) GetDefaults(req *acomm.Request) (interface{}, *url.URL, error) {
-	defaults, err := c.getDefaults()
+func (c *ClusterConf) GetDefaults(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
+	defaults, err := c.getDefaults(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -39,38 +39,38 @@ func (c *ClusterConf) GetDefaults(req *acomm.Request) (interface{}, *url.URL, er
 }
 
 // UpdateDefaults sets or updates
-func (c *ClusterConf) UpdateDefaults(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) UpdateDefaults(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args DefaultsPayload
 	if err := req.UnmarshalArgs(&args); err != nil {
 		return nil, nil, err
 	}
 	if args.Defaults == nil {
-		return nil, nil, errors.Newv("missing arg: defaults", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: defaults", map[string]interface{}{"args": args})
 	}
 
 	args.Defaults.c = c
 
-	if err := args.Defaults.update(); err != nil {
+	if err := args.Defaults.update(ctx); err != nil {
 		return nil, nil, err
 	}
 	return &DefaultsPayload{args.Defaults}, nil, nil
 }
 
-func (c *ClusterConf) getDefaults() (*Defaults, error) {
+func (c *ClusterConf) getDefaults(ctx context.Context) (*Defaults, error) {
 	defaults := &Defaults{
 		DefaultsConf: DefaultsConf{},
 		c:            c,
 	}
-	if err := defaults.reload(); err != nil {
+	if err := defaults.reload(ctx); err != nil {
 		return nil, err
 	}
 	return defaults, nil
 }
 
-func (d *Defaults) reload() error {
-	value, err := d.c.kvGet(defaultsPrefix)
+func (d *Defaults) reload(ctx context.Context) error {
+	value, err := d.c.kvGet(ctx, defaultsPrefix)
 	if err != nil {
-		if strings.Contains(err.Error(), "key not found") {
+		if errors.IsCode(err, errors.CodeNotFound) {
 			return nil
 		}
 		return err
@@ -83,8 +83,8 @@ func (d *Defaults) reload() error {
 	return nil
 }
 
-func (d *Defaults) update() error {
-	modIndex, err := d.c.kvUpdate(defaultsPrefix, d.DefaultsConf, d.ModIndex)
+func (d *Defaults) update(ctx context.Context) error {
+	modIndex, err := d.c.kvUpdate(ctx, defaultsPrefix, d.DefaultsConf, d.ModIndex)
 	if err != nil {
 		return err
 	}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/providers/clusterconf"
+	"golang.org/x/net/context"
 )
 
 func (s *clusterConf) TestGetDefaults() {
@@ -15,7 +16,7 @@ func (s *clusterConf) TestGetDefaults() {
 		Task: "get-defaults",
 	})
 	s.Require().NoError(err)
-	result, streamURL, err := s.clusterConf.GetDefaults(req)
+	result, streamURL, err := s.clusterConf.GetDefaults(context.Background(), req)
 	s.Nil(streamURL)
 	s.NoError(err)
 	if !s.NotNil(result) {
@@ -50,7 +51,7 @@ func (s *clusterConf) TestUpdateDefaults() {
 			},
 		})
 		s.Require().NoError(err, test.desc)
-		result, streamURL, err := s.clusterConf.UpdateDefaults(req)
+		result, streamURL, err := s.clusterConf.UpdateDefaults(context.Background(), req)
 		s.Nil(streamURL, test.desc)
 		if test.err != "" {
 			s.Contains(err.Error(), test.err, test.desc)
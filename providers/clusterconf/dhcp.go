@@ -8,6 +8,7 @@ import (
 
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/pkg/errors"
+	"golang.org/x/net/context"
 )
 
 const dhcpPrefix string = "dhcp"
@@ -59,8 +60,8 @@ func (c *DHCPConfig) Validate() error {
 }
 
 // GetDHCP retrieves the current cluster DHCP settings.
-func (c *ClusterConf) GetDHCP(*acomm.Request) (interface{}, *url.URL, error) {
-	value, err := c.kvGet(dhcpPrefix)
+func (c *ClusterConf) GetDHCP(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
+	value, err := c.kvGet(ctx, dhcpPrefix)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -74,7 +75,7 @@ func (c *ClusterConf) GetDHCP(*acomm.Request) (interface{}, *url.URL, error) {
 }
 
 // SetDHCP updates the cluster DHCP settings.
-func (c *ClusterConf) SetDHCP(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) SetDHCP(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	conf := DHCPConfig{}
 	if err := req.UnmarshalArgs(&conf); err != nil {
 		return nil, nil, err
@@ -84,7 +85,7 @@ func (c *ClusterConf) SetDHCP(req *acomm.Request) (interface{}, *url.URL, error)
 		return nil, nil, err
 	}
 
-	_, err := c.kvUpdate(dhcpPrefix, conf, 0)
+	_, err := c.kvUpdate(ctx, dhcpPrefix, conf, 0)
 	if err != nil {
 		err = errors.New("dhcp configuration can not be altered")
 	}
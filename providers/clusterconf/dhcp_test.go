@@ -7,6 +7,7 @@ import (
 
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/providers/clusterconf"
+	"golang.org/x/net/context"
 )
 
 func (s *clusterConf) setupDHCP(config clusterconf.DHCPConfig) {
@@ -26,12 +27,12 @@ func (s *clusterConf) TestGetDHCP() {
 		Net:      "10.10.10.0/24",
 	}
 
-	_, _, err := s.clusterConf.GetDHCP(nil)
+	_, _, err := s.clusterConf.GetDHCP(context.Background(), nil)
 	s.Error(err, "expected no dhcp settings")
 
 	s.setupDHCP(conf)
 
-	resp, _, err := s.clusterConf.GetDHCP(nil)
+	resp, _, err := s.clusterConf.GetDHCP(context.Background(), nil)
 	s.NoError(err, "expected some dhcp settings")
 
 	got := resp.(clusterconf.DHCPConfig)
@@ -137,7 +138,7 @@ func (s *clusterConf) TestSetDHCP() {
 		})
 		s.Require().NoError(err, t.desc)
 
-		resp, url, err := s.clusterConf.SetDHCP(req)
+		resp, url, err := s.clusterConf.SetDHCP(context.Background(), req)
 		s.Nil(resp, t.desc)
 		s.Nil(url, t.desc)
 		if t.err != "" {
@@ -148,7 +149,7 @@ func (s *clusterConf) TestSetDHCP() {
 			continue
 		}
 
-		resp, url, err = s.clusterConf.GetDHCP(nil)
+		resp, url, err = s.clusterConf.GetDHCP(context.Background(), nil)
 		s.Require().NoError(err, t.desc)
 		s.Nil(url)
 
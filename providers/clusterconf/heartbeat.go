@@ -9,6 +9,7 @@ import (
 
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/pkg/errors"
+	"golang.org/x/net/context"
 )
 
 const heartbeatPrefix string = "heartbeats"
@@ -32,26 +33,26 @@ type DatasetHeartbeatList struct {
 }
 
 // DatasetHeartbeat registers a new node heartbeat that is using the dataset.
-func (c *ClusterConf) DatasetHeartbeat(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) DatasetHeartbeat(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args DatasetHeartbeatArgs
 	if err := req.UnmarshalArgs(&args); err != nil {
 		return nil, nil, err
 	}
 	if args.ID == "" {
-		return nil, nil, errors.Newv("missing arg: id", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: id", map[string]interface{}{"args": args})
 	}
 	if args.IP == nil {
-		return nil, nil, errors.Newv("missing arg: ip", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: ip", map[string]interface{}{"args": args})
 	}
 
 	key := path.Join(heartbeatPrefix, datasetsPrefix, args.ID, args.IP.String())
-	return nil, nil, errors.Wrapv(c.kvEphemeral(key, args.InUse, c.config.DatasetTTL()), map[string]interface{}{"datasetID": args.ID})
+	return nil, nil, errors.Wrapv(c.kvEphemeral(ctx, key, args.InUse, c.config.DatasetTTL()), map[string]interface{}{"datasetID": args.ID})
 }
 
 // ListDatasetHeartbeats returns a list of all active dataset heartbeats.
-func (c *ClusterConf) ListDatasetHeartbeats(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) ListDatasetHeartbeats(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	base := path.Join(heartbeatPrefix, datasetsPrefix)
-	values, err := c.kvGetAll(base)
+	values, err := c.kvGetAll(ctx, base)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -181,19 +182,19 @@ func (b *BundleHeartbeatList) UnmarshalJSON(data []byte) error {
 }
 
 // BundleHeartbeat registers a new node heartbeat that is using the dataset.
-func (c *ClusterConf) BundleHeartbeat(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) BundleHeartbeat(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args BundleHeartbeatArgs
 	if err := req.UnmarshalArgs(&args); err != nil {
 		return nil, nil, err
 	}
 	if args.ID == 0 {
-		return nil, nil, errors.Newv("missing arg: id", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: id", map[string]interface{}{"args": args})
 	}
 	if args.Serial == "" {
-		return nil, nil, errors.Newv("missing arg: serial", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: serial", map[string]interface{}{"args": args})
 	}
 	if args.IP == nil {
-		return nil, nil, errors.Newv("missing arg: ip", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: ip", map[string]interface{}{"args": args})
 	}
 
 	heartbeat := BundleHeartbeat{
@@ -202,13 +203,13 @@ func (c *ClusterConf) BundleHeartbeat(req *acomm.Request) (interface{}, *url.URL
 	}
 
 	key := path.Join(heartbeatPrefix, bundlesPrefix, strconv.FormatUint(args.ID, 10), args.Serial)
-	return nil, nil, errors.Wrapv(c.kvEphemeral(key, heartbeat, c.config.BundleTTL()), map[string]interface{}{"bundleID": args.ID})
+	return nil, nil, errors.Wrapv(c.kvEphemeral(ctx, key, heartbeat, c.config.BundleTTL()), map[string]interface{}{"bundleID": args.ID})
 }
 
 // ListBundleHeartbeats returns a list of all active bundle heartbeats.
-func (c *ClusterConf) ListBundleHeartbeats(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) ListBundleHeartbeats(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	base := path.Join(heartbeatPrefix, bundlesPrefix)
-	values, err := c.kvGetAll(base)
+	values, err := c.kvGetAll(ctx, base)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -1,12 +1,12 @@
 package clusterconf
 
 import (
-	"errors"
 	"math/rand"
 	"net/url"
 	"time"
 
 	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
 	"github.com/cerana/cerana/provider"
 	"github.com/pborman/uuid"
 )
@@ -46,27 +46,27 @@ func NewMockClusterConf() *MockClusterConf {
 
 // RegisterTasks registers all of MockClusterConf's tasks.
 func (c *MockClusterConf) RegisterTasks(server *provider.Server) {
-	server.RegisterTask("get-bundle", c.GetBundle)
-	server.RegisterTask("list-bundles", c.ListBundles)
-	server.RegisterTask("list-bundle-heartbeats", c.ListBundleHeartbeats)
-	server.RegisterTask("update-bundle", c.UpdateBundle)
-	server.RegisterTask("delete-bundle", c.DeleteBundle)
-	server.RegisterTask("bundle-heartbeat", c.BundleHeartbeat)
-	server.RegisterTask("get-dataset", c.GetDataset)
-	server.RegisterTask("list-datasets", c.ListDatasets)
-	server.RegisterTask("list-dataset-heartbeats", c.ListDatasetHeartbeats)
-	server.RegisterTask("update-dataset", c.UpdateDataset)
-	server.RegisterTask("delete-dataset", c.DeleteDataset)
-	server.RegisterTask("dataset-heartbeat", c.DatasetHeartbeat)
-	server.RegisterTask("get-default-options", c.GetDefaults)
-	server.RegisterTask("set-default-options", c.UpdateDefaults)
-	server.RegisterTask("node-heartbeat", c.NodeHeartbeat)
-	server.RegisterTask("get-node", c.GetNode)
-	server.RegisterTask("list-nodes", c.ListNodes)
-	server.RegisterTask("get-nodes-history", c.GetNodesHistory)
-	server.RegisterTask("get-service", c.GetService)
-	server.RegisterTask("update-service", c.UpdateService)
-	server.RegisterTask("delete-service", c.DeleteService)
+	server.RegisterTask(TaskGetBundle, c.GetBundle, taskSchemas[TaskGetBundle])
+	server.RegisterTask(TaskListBundles, c.ListBundles, taskSchemas[TaskListBundles])
+	server.RegisterTask(TaskListBundleHeartbeats, c.ListBundleHeartbeats, taskSchemas[TaskListBundleHeartbeats])
+	server.RegisterTask(TaskUpdateBundle, c.UpdateBundle, taskSchemas[TaskUpdateBundle])
+	server.RegisterTask(TaskDeleteBundle, c.DeleteBundle, taskSchemas[TaskDeleteBundle])
+	server.RegisterTask(TaskBundleHeartbeat, c.BundleHeartbeat, taskSchemas[TaskBundleHeartbeat])
+	server.RegisterTask(TaskGetDataset, c.GetDataset, taskSchemas[TaskGetDataset])
+	server.RegisterTask(TaskListDatasets, c.ListDatasets, taskSchemas[TaskListDatasets])
+	server.RegisterTask(TaskListDatasetHeartbeats, c.ListDatasetHeartbeats, taskSchemas[TaskListDatasetHeartbeats])
+	server.RegisterTask(TaskUpdateDataset, c.UpdateDataset, taskSchemas[TaskUpdateDataset])
+	server.RegisterTask(TaskDeleteDataset, c.DeleteDataset, taskSchemas[TaskDeleteDataset])
+	server.RegisterTask(TaskDatasetHeartbeat, c.DatasetHeartbeat, taskSchemas[TaskDatasetHeartbeat])
+	server.RegisterTask(TaskGetDefaults, c.GetDefaults, taskSchemas[TaskGetDefaults])
+	server.RegisterTask(TaskSetDefaults, c.UpdateDefaults, taskSchemas[TaskSetDefaults])
+	server.RegisterTask(TaskNodeHeartbeat, c.NodeHeartbeat, taskSchemas[TaskNodeHeartbeat])
+	server.RegisterTask(TaskGetNode, c.GetNode, taskSchemas[TaskGetNode])
+	server.RegisterTask(TaskListNodes, c.ListNodes, taskSchemas[TaskListNodes])
+	server.RegisterTask(TaskGetNodesHistory, c.GetNodesHistory, taskSchemas[TaskGetNodesHistory])
+	server.RegisterTask(TaskGetService, c.GetService, taskSchemas[TaskGetService])
+	server.RegisterTask(TaskUpdateService, c.UpdateService, taskSchemas[TaskUpdateService])
+	server.RegisterTask(TaskDeleteService, c.DeleteService, taskSchemas[TaskDeleteService])
 }
 
 // GetBundle retrieves a mock bundle.
@@ -80,7 +80,7 @@ func (c *MockClusterConf) GetBundle(req *acomm.Request) (interface{}, *url.URL,
 	}
 	bundle, ok := c.Data.Bundles[args.ID]
 	if !ok {
-		return nil, nil, errors.New("bundle config not found")
+		return nil, nil, errors.NewWithCode(errors.CodeNotFound, "bundle config not found", nil)
 	}
 	return &BundlePayload{bundle}, nil, nil
 }
@@ -167,7 +167,7 @@ func (c *MockClusterConf) GetDataset(req *acomm.Request) (interface{}, *url.URL,
 	}
 	dataset, ok := c.Data.Datasets[args.ID]
 	if !ok {
-		return nil, nil, errors.New("dataset config not found")
+		return nil, nil, errors.NewWithCode(errors.CodeNotFound, "dataset config not found", nil)
 	}
 	return &DatasetPayload{dataset}, nil, nil
 }
@@ -351,7 +351,7 @@ func (c *MockClusterConf) GetService(req *acomm.Request) (interface{}, *url.URL,
 
 	service, ok := c.Data.Services[args.ID]
 	if !ok {
-		return nil, nil, errors.New("service config not found")
+		return nil, nil, errors.NewWithCode(errors.CodeNotFound, "service config not found", nil)
 	}
 	return &ServicePayload{service}, nil, nil
 }
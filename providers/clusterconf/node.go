@@ -9,6 +9,7 @@ import (
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/pkg/errors"
 	"github.com/shirou/gopsutil/load"
+	"golang.org/x/net/context"
 )
 
 const (
@@ -61,36 +62,36 @@ type NodesHistoryResult struct {
 type nodeFilter func(Node) bool
 
 // NodeHeartbeat records a new node heartbeat.
-func (c *ClusterConf) NodeHeartbeat(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) NodeHeartbeat(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args NodePayload
 	if err := req.UnmarshalArgs(&args); err != nil {
 		return nil, nil, err
 	}
 	if args.Node == nil {
-		return nil, nil, errors.Newv("missing arg: node", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: node", map[string]interface{}{"args": args})
 	}
 	args.Node.c = c
 
-	return nil, nil, args.Node.update()
+	return nil, nil, args.Node.update(ctx)
 }
 
 // GetNode returns the latest information about a node.
-func (c *ClusterConf) GetNode(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) GetNode(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args IDArgs
 	if err := req.UnmarshalArgs(&args); err != nil {
 		return nil, nil, err
 	}
 	if args.ID == "" {
-		return nil, nil, errors.Newv("missing arg: id", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: id", map[string]interface{}{"args": args})
 	}
 
-	node, err := c.getNode(args.ID)
+	node, err := c.getNode(ctx, args.ID)
 	return &NodePayload{node}, nil, err
 }
 
 // ListNodes list all current nodes.
-func (c *ClusterConf) ListNodes(req *acomm.Request) (interface{}, *url.URL, error) {
-	nodes, err := c.getNodes()
+func (c *ClusterConf) ListNodes(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
+	nodes, err := c.getNodes(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -98,13 +99,13 @@ func (c *ClusterConf) ListNodes(req *acomm.Request) (interface{}, *url.URL, erro
 }
 
 // GetNodesHistory gets the heartbeat history for one or more nodes.
-func (c *ClusterConf) GetNodesHistory(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) GetNodesHistory(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args NodeHistoryArgs
 	if err := req.UnmarshalArgs(args); err != nil {
 		return nil, nil, err
 	}
 
-	history, err := c.getNodesHistory(
+	history, err := c.getNodesHistory(ctx,
 		nodeFilterID(args.IDs...),
 		nodeFilterHeartbeat(args.Before, args.After),
 	)
@@ -115,10 +116,10 @@ func (c *ClusterConf) GetNodesHistory(req *acomm.Request) (interface{}, *url.URL
 
 }
 
-func (c *ClusterConf) getNode(id string) (*Node, error) {
+func (c *ClusterConf) getNode(ctx context.Context, id string) (*Node, error) {
 	node := &Node{}
 	key := path.Join(nodesPrefix, id)
-	value, err := c.kvGet(key)
+	value, err := c.kvGet(ctx, key)
 	if err != nil {
 		return nil, errors.Wrapv(err, map[string]interface{}{"nodeID": id})
 	}
@@ -129,8 +130,8 @@ func (c *ClusterConf) getNode(id string) (*Node, error) {
 	return node, nil
 }
 
-func (c *ClusterConf) getNodes() ([]Node, error) {
-	values, err := c.kvGetAll(nodesPrefix)
+func (c *ClusterConf) getNodes(ctx context.Context) ([]Node, error) {
+	values, err := c.kvGetAll(ctx, nodesPrefix)
 	if err != nil {
 		return nil, err
 	}
@@ -174,8 +175,8 @@ func nodeFilterHeartbeat(before, after time.Time) nodeFilter {
 	}
 }
 
-func (c *ClusterConf) getNodesHistory(filters ...nodeFilter) (*NodesHistory, error) {
-	values, err := c.kvGetAll(historicalPrefix)
+func (c *ClusterConf) getNodesHistory(ctx context.Context, filters ...nodeFilter) (*NodesHistory, error) {
+	values, err := c.kvGetAll(ctx, historicalPrefix)
 	if err != nil {
 		return nil, err
 	}
@@ -204,15 +205,15 @@ func (c *ClusterConf) getNodesHistory(filters ...nodeFilter) (*NodesHistory, err
 	return &history, nil
 }
 
-func (n *Node) update() error {
+func (n *Node) update(ctx context.Context) error {
 	currentKey := path.Join(nodesPrefix, n.ID)
 	historicalKey := path.Join(historicalPrefix, n.ID, n.Heartbeat.Format(time.RFC3339))
 
-	if err := n.c.kvEphemeral(currentKey, n, n.c.config.NodeTTL()); err != nil {
+	if err := n.c.kvEphemeral(ctx, currentKey, n, n.c.config.NodeTTL()); err != nil {
 		return errors.Wrapv(err, map[string]interface{}{"nodeID": n.ID})
 	}
 
-	if _, err := n.c.kvUpdate(historicalKey, n, 0); err != nil {
+	if _, err := n.c.kvUpdate(ctx, historicalKey, n, 0); err != nil {
 		return errors.Wrapv(err, map[string]interface{}{"nodeID": n.ID})
 	}
 
@@ -4,11 +4,11 @@ import (
 	"encoding/json"
 	"net/url"
 	"path"
-	"strings"
 
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/pkg/errors"
 	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
 )
 
 const servicesPrefix string = "services"
@@ -52,16 +52,16 @@ type ServicePayload struct {
 }
 
 // GetService retrieves a service.
-func (c *ClusterConf) GetService(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) GetService(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args IDArgs
 	if err := req.UnmarshalArgs(&args); err != nil {
 		return nil, nil, err
 	}
 	if args.ID == "" {
-		return nil, nil, errors.Newv("missing arg: id", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: id", map[string]interface{}{"args": args})
 	}
 
-	service, err := c.getService(args.ID)
+	service, err := c.getService(ctx, args.ID)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -69,13 +69,13 @@ func (c *ClusterConf) GetService(req *acomm.Request) (interface{}, *url.URL, err
 }
 
 // UpdateService creates or updates a service config. When updating, a Get should first be performed and the modified Service passed back.
-func (c *ClusterConf) UpdateService(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) UpdateService(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args ServicePayload
 	if err := req.UnmarshalArgs(&args); err != nil {
 		return nil, nil, err
 	}
 	if args.Service == nil {
-		return nil, nil, errors.Newv("missing arg: service", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: service", map[string]interface{}{"args": args})
 	}
 	args.Service.c = c
 
@@ -83,50 +83,50 @@ func (c *ClusterConf) UpdateService(req *acomm.Request) (interface{}, *url.URL,
 		args.Service.ID = uuid.New()
 	}
 
-	if err := args.Service.update(); err != nil {
+	if err := args.Service.update(ctx); err != nil {
 		return nil, nil, err
 	}
 	return &ServicePayload{args.Service}, nil, nil
 }
 
 // DeleteService deletes a service config.
-func (c *ClusterConf) DeleteService(req *acomm.Request) (interface{}, *url.URL, error) {
+func (c *ClusterConf) DeleteService(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args IDArgs
 	if err := req.UnmarshalArgs(&args); err != nil {
 		return nil, nil, err
 	}
 	if args.ID == "" {
-		return nil, nil, errors.Newv("missing arg: id", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: id", map[string]interface{}{"args": args})
 	}
 
-	service, err := c.getService(args.ID)
+	service, err := c.getService(ctx, args.ID)
 	if err != nil {
-		if strings.Contains(err.Error(), "service config not found") {
+		if errors.IsCode(err, errors.CodeNotFound) {
 			return nil, nil, nil
 		}
 		return nil, nil, err
 	}
 
-	return nil, nil, service.delete()
+	return nil, nil, service.delete(ctx)
 }
 
-func (c *ClusterConf) getService(id string) (*Service, error) {
+func (c *ClusterConf) getService(ctx context.Context, id string) (*Service, error) {
 	service := &Service{
 		c:           c,
 		ServiceConf: ServiceConf{ID: id},
 	}
-	if err := service.reload(); err != nil {
+	if err := service.reload(ctx); err != nil {
 		return nil, err
 	}
 	return service, nil
 }
 
-func (s *Service) reload() error {
+func (s *Service) reload(ctx context.Context) error {
 	key := path.Join(servicesPrefix, s.ID, "config")
-	value, err := s.c.kvGet(key)
+	value, err := s.c.kvGet(ctx, key)
 	if err != nil {
-		if strings.Contains(err.Error(), "key not found") {
-			err = errors.Newv("service config not found", map[string]interface{}{"serviceID": s.ID})
+		if errors.IsCode(err, errors.CodeNotFound) {
+			err = errors.NewWithCode(errors.CodeNotFound, "service config not found", map[string]interface{}{"serviceID": s.ID})
 		}
 		return err
 	}
@@ -138,16 +138,16 @@ func (s *Service) reload() error {
 	return nil
 }
 
-func (s *Service) delete() error {
+func (s *Service) delete(ctx context.Context) error {
 	key := path.Join(servicesPrefix, s.ID)
-	return errors.Wrapv(s.c.kvDelete(key, s.ModIndex), map[string]interface{}{"serviceID": s.ID})
+	return errors.Wrapv(s.c.kvDelete(ctx, key, s.ModIndex), map[string]interface{}{"serviceID": s.ID})
 }
 
 // update saves the service config.
-func (s *Service) update() error {
+func (s *Service) update(ctx context.Context) error {
 	key := path.Join(servicesPrefix, s.ID, "config")
 
-	modIndex, err := s.c.kvUpdate(key, s.ServiceConf, s.ModIndex)
+	modIndex, err := s.c.kvUpdate(ctx, key, s.ServiceConf, s.ModIndex)
 	if err != nil {
 		return errors.Wrapv(err, map[string]interface{}{"serviceID": s.ID})
 	}
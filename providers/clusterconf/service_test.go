@@ -6,6 +6,7 @@ import (
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/providers/clusterconf"
 	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
 )
 
 func (s *clusterConf) TestGetService() {
@@ -27,7 +28,7 @@ func (s *clusterConf) TestGetService() {
 			Args: &clusterconf.IDArgs{ID: test.id},
 		})
 		s.Require().NoError(err, test.id)
-		result, streamURL, err := s.clusterConf.GetService(req)
+		result, streamURL, err := s.clusterConf.GetService(context.Background(), req)
 		s.Nil(streamURL, test.id)
 		if test.err != "" {
 			s.Contains(err.Error(), test.err, test.id)
@@ -73,7 +74,7 @@ func (s *clusterConf) TestUpdateService() {
 			},
 		})
 		s.Require().NoError(err, test.desc)
-		result, streamURL, err := s.clusterConf.UpdateService(req)
+		result, streamURL, err := s.clusterConf.UpdateService(context.Background(), req)
 		s.Nil(streamURL, test.desc)
 		if test.err != "" {
 			s.Contains(err.Error(), test.err, test.desc)
@@ -114,7 +115,7 @@ func (s *clusterConf) TestDeleteService() {
 			Args: &clusterconf.IDArgs{ID: test.id},
 		})
 		s.Require().NoError(err, test.id)
-		result, streamURL, err := s.clusterConf.DeleteService(req)
+		result, streamURL, err := s.clusterConf.DeleteService(context.Background(), req)
 		s.Nil(streamURL, test.id)
 		s.Nil(result, test.id)
 		if test.err != "" {
@@ -0,0 +1,67 @@
+package clusterconf
+
+import "github.com/cerana/cerana/provider"
+
+// Task names of the clusterconf provider.
+const (
+	TaskGetBundle            = "get-bundle"
+	TaskListBundles          = "list-bundles"
+	TaskUpdateBundle         = "update-bundle"
+	TaskDeleteBundle         = "delete-bundle"
+	TaskBundleHeartbeat      = "bundle-heartbeat"
+	TaskListBundleHeartbeats = "list-bundle-heartbeats"
+
+	TaskGetDataset            = "get-dataset"
+	TaskListDatasets          = "list-datasets"
+	TaskUpdateDataset         = "update-dataset"
+	TaskDeleteDataset         = "delete-dataset"
+	TaskDatasetHeartbeat      = "dataset-heartbeat"
+	TaskListDatasetHeartbeats = "list-dataset-heartbeats"
+
+	TaskGetDefaults = "get-default-options"
+	TaskSetDefaults = "set-default-options"
+
+	TaskNodeHeartbeat   = "node-heartbeat"
+	TaskGetNode         = "get-node"
+	TaskListNodes       = "list-nodes"
+	TaskGetNodesHistory = "get-nodes-history"
+
+	TaskGetService    = "get-service"
+	TaskUpdateService = "update-service"
+	TaskDeleteService = "delete-service"
+
+	TaskGetDHCP = "get-dhcp-config"
+	TaskSetDHCP = "set-dhcp-config"
+)
+
+// taskSchemas describe the clusterconf tasks.
+var taskSchemas = map[string]provider.TaskSpec{
+	TaskGetBundle:            {Description: "Retrieve a bundle, optionally combined with its service and dataset configs.", Args: GetBundleArgs{}, Result: BundlePayload{}},
+	TaskListBundles:          {Description: "Retrieve all bundles, optionally combined with their service and dataset configs.", Args: ListBundleArgs{}, Result: BundleListResult{}},
+	TaskUpdateBundle:         {Description: "Create or update a bundle.", Args: BundlePayload{}, Result: BundlePayload{}},
+	TaskDeleteBundle:         {Description: "Remove a bundle.", Args: DeleteBundleArgs{}},
+	TaskBundleHeartbeat:      {Description: "Register a bundle heartbeat from a node.", Args: BundleHeartbeatArgs{}},
+	TaskListBundleHeartbeats: {Description: "Retrieve the heartbeats of all bundles.", Result: BundleHeartbeatList{}},
+
+	TaskGetDataset:            {Description: "Retrieve a dataset.", Args: IDArgs{}, Result: DatasetPayload{}},
+	TaskListDatasets:          {Description: "Retrieve all datasets.", Result: DatasetListResult{}},
+	TaskUpdateDataset:         {Description: "Create or update a dataset.", Args: DatasetPayload{}, Result: DatasetPayload{}},
+	TaskDeleteDataset:         {Description: "Remove a dataset.", Args: IDArgs{}},
+	TaskDatasetHeartbeat:      {Description: "Register a dataset heartbeat from a node.", Args: DatasetHeartbeatArgs{}},
+	TaskListDatasetHeartbeats: {Description: "Retrieve the heartbeats of all datasets.", Result: DatasetHeartbeatList{}},
+
+	TaskGetDefaults: {Description: "Retrieve the cluster defaults.", Result: DefaultsPayload{}},
+	TaskSetDefaults: {Description: "Update the cluster defaults.", Args: DefaultsPayload{}, Result: DefaultsPayload{}},
+
+	TaskNodeHeartbeat:   {Description: "Register a node heartbeat.", Args: NodePayload{}},
+	TaskGetNode:         {Description: "Retrieve a node.", Args: IDArgs{}, Result: NodePayload{}},
+	TaskListNodes:       {Description: "Retrieve all nodes.", Result: ListNodesResult{}},
+	TaskGetNodesHistory: {Description: "Retrieve the heartbeat history of nodes.", Args: NodeHistoryArgs{}, Result: NodesHistoryResult{}},
+
+	TaskGetService:    {Description: "Retrieve a service.", Args: IDArgs{}, Result: ServicePayload{}},
+	TaskUpdateService: {Description: "Create or update a service.", Args: ServicePayload{}, Result: ServicePayload{}},
+	TaskDeleteService: {Description: "Remove a service.", Args: IDArgs{}},
+
+	TaskGetDHCP: {Description: "Retrieve the cluster DHCP config.", Result: DHCPConfig{}},
+	TaskSetDHCP: {Description: "Update the cluster DHCP config.", Args: DHCPConfig{}},
+}
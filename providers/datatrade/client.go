@@ -0,0 +1,32 @@
+package datatrade
+
+import (
+	"net/url"
+
+	"github.com/cerana/cerana/acomm"
+	"golang.org/x/net/context"
+)
+
+// Client makes typed requests to the datatrade provider's tasks.
+type Client struct {
+	c *acomm.Client
+}
+
+// NewClient creates a new Client sending requests with the acomm client.
+func NewClient(c *acomm.Client) *Client {
+	return &Client{c: c}
+}
+
+// ImportDataset imports the zfs stream at the stream url as a new dataset in
+// the cluster.
+func (c *Client) ImportDataset(ctx context.Context, args DatasetImportArgs, stream *url.URL) (*DatasetImportResult, error) {
+	var result DatasetImportResult
+	if _, err := c.c.Do(ctx, acomm.RequestOptions{
+		Task:      TaskImportDataset,
+		StreamURL: stream,
+		Args:      args,
+	}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,32 @@
+package datatrade_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/providers/clusterconf"
+	"github.com/cerana/cerana/providers/datatrade"
+	"golang.org/x/net/context"
+)
+
+func (p *Provider) TestClient() {
+	client := datatrade.NewClient(acomm.NewClient(p.tracker, p.config.CoordinatorURL(), p.config.RequestTimeout()))
+	ctx := context.Background()
+
+	p.clusterConf.Data.Nodes["localhost"] = &clusterconf.Node{ID: "localhost"}
+
+	streamURL, err := p.tracker.NewStream(ioutil.NopCloser(bytes.NewBufferString("foobar")))
+	p.Require().NoError(err)
+
+	result, err := client.ImportDataset(ctx, datatrade.DatasetImportArgs{Redundancy: 1}, streamURL)
+	if p.NoError(err) {
+		p.Equal("foobar", string(p.zfs.Data.Data[filepath.Join(p.config.DatasetDir(), result.Dataset.ID)]))
+		p.NotNil(p.clusterConf.Data.Datasets[result.Dataset.ID])
+	}
+
+	_, err = client.ImportDataset(ctx, datatrade.DatasetImportArgs{}, streamURL)
+	p.True(errors.IsCode(err, errors.CodeInvalidArgument), "should fail with the error code of the provider")
+}
@@ -15,8 +15,7 @@ type Config struct {
 // ConfigData defines the structure of the config data (e.g. in the config file)
 type ConfigData struct {
 	provider.ConfigData
-	DatasetDir          string `json:"dataset_dir"`
-	NodeCoordinatorPort uint   `json:"node_coordinator_port"`
+	DatasetDir string `json:"dataset_dir"`
 }
 
 // DatasetDir returns the directory in which datasets are stored on nodes.
@@ -41,13 +40,6 @@ func NewConfig(flagSet *pflag.FlagSet, v *viper.Viper) *Config {
 	return &Config{provider.NewConfig(flagSet, v)}
 }
 
-// NodeCoordinatorPort returns the port that node coordinators are running on.
-func (c *Config) NodeCoordinatorPort() uint {
-	var port uint
-	_ = c.UnmarshalKey("node_coordinator_port", &port)
-	return port
-}
-
 // Validate returns whether the config is valid, containing necessary values.
 func (c *Config) Validate() error {
 	if err := c.Config.Validate(); err != nil {
@@ -58,9 +50,5 @@ func (c *Config) Validate() error {
 		return errors.New("missing dataset_dir")
 	}
 
-	if c.NodeCoordinatorPort() == 0 {
-		return errors.New("missing node_coordinator_port")
-	}
-
 	return nil
 }
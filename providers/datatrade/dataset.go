@@ -1,16 +1,19 @@
 package datatrade
 
 import (
-	"fmt"
+	"encoding/json"
 	"math/rand"
 	"net/url"
 	"path/filepath"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/pkg/errors"
 	"github.com/cerana/cerana/providers/clusterconf"
 	"github.com/cerana/cerana/providers/zfs"
+	"github.com/cerana/cerana/workflow"
 	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
 )
 
 // DatasetImportArgs are arguments for configuring an imported dataset.
@@ -29,13 +32,13 @@ type DatasetImportResult struct {
 
 // DatasetImport imports a dataset into the cluster and tracks it in the
 // cluster configuration.
-func (p *Provider) DatasetImport(req *acomm.Request) (interface{}, *url.URL, error) {
+func (p *Provider) DatasetImport(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args DatasetImportArgs
 	if err := req.UnmarshalArgs(&args); err != nil {
 		return nil, nil, err
 	}
 	if args.Redundancy == 0 {
-		return nil, nil, errors.Newv("missing arg: redundancy", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: redundancy", map[string]interface{}{"args": args})
 	}
 
 	if req.StreamURL == nil {
@@ -50,84 +53,155 @@ func (p *Provider) DatasetImport(req *acomm.Request) (interface{}, *url.URL, err
 		Redundancy: args.Redundancy,
 	}
 
-	node, err := p.datasetImportNode()
+	sendProgress(req, &acomm.Progress{Step: "selecting node"})
+	node, err := p.datasetImportNode(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	if err := p.datasetImport(node.ID, dataset.ID, req.StreamURL); err != nil {
+	input := datasetImportInput{
+		Dataset:   dataset,
+		NodeID:    node.ID,
+		StreamURL: req.StreamURL.String(),
+	}
+	w, err := p.datasetImportWorkflow(req.ID, input, req)
+	if err != nil {
 		return nil, nil, err
 	}
-
-	if args.ReadOnly {
-		if err := p.datasetSnapshot(node.ID, dataset.ID); err != nil {
-			return nil, nil, err
-		}
+	if _, err := p.workflows.Run(ctx, w); err != nil {
+		return nil, nil, err
 	}
+	return DatasetImportResult{Dataset: dataset, NodeID: node.ID}, nil, nil
+}
 
-	return DatasetImportResult{Dataset: dataset, NodeID: node.ID}, nil, p.datasetConfig(dataset)
+// datasetImportWorkflow is the name of the dataset import workflow.
+const datasetImportWorkflow = "import-dataset"
 
+// datasetImportInput is the input of the dataset import workflow.
+type datasetImportInput struct {
+	Dataset   clusterconf.Dataset `json:"dataset"`
+	NodeID    string              `json:"nodeID"`
+	StreamURL string              `json:"streamURL"`
 }
 
-func (p *Provider) datasetImportNode() (*clusterconf.Node, error) {
-	opts := acomm.RequestOptions{
-		Task: "list-nodes",
+func (p *Provider) buildDatasetImportWorkflow(id string, input json.RawMessage) (*workflow.Workflow, error) {
+	var in datasetImportInput
+	if err := json.Unmarshal(input, &in); err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"workflow": id})
 	}
-	resp, err := p.tracker.SyncRequest(p.config.CoordinatorURL(), opts, p.config.RequestTimeout())
+	return p.datasetImportWorkflow(id, in, nil)
+}
+
+// datasetImportWorkflow creates the workflow to receive a dataset on the
+// node, snapshot it if read only, and add it to the cluster configuration.
+// If any step fails, the received dataset is destroyed. Progress is relayed
+// to the original request, if there is one.
+func (p *Provider) datasetImportWorkflow(id string, input datasetImportInput, req *acomm.Request) (*workflow.Workflow, error) {
+	errData := map[string]interface{}{"workflow": id, "input": input}
+
+	// The coordinator routes the requests to the coordinator on the node
+	target := &acomm.Target{Node: input.NodeID}
+	streamURL, err := url.ParseRequestURI(input.StreamURL)
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrapv(err, errData)
 	}
-	var result clusterconf.ListNodesResult
-	if err := resp.UnmarshalResult(&result); err != nil {
-		return nil, err
-	}
-	if len(result.Nodes) == 0 {
-		return nil, errors.New("no nodes found")
+	name := filepath.Join(p.config.DatasetDir(), input.Dataset.ID)
+
+	progress := func(step string) func(*workflow.State, *acomm.RequestOptions) error {
+		return func(_ *workflow.State, _ *acomm.RequestOptions) error {
+			if req != nil {
+				sendProgress(req, &acomm.Progress{Step: step})
+			}
+			return nil
+		}
 	}
-	node := result.Nodes[rand.Intn(len(result.Nodes))]
-	return &node, nil
-}
 
-func (p *Provider) datasetImport(nodeID, datasetID string, streamURL *url.URL) error {
-	taskURL, err := url.ParseRequestURI(fmt.Sprintf("http://%s:%d", nodeID, p.config.NodeCoordinatorPort()))
-	if err != nil {
-		return errors.Wrapv(err, map[string]interface{}{"taskURL": taskURL}, "failed to generate taskURL")
-	}
-	opts := acomm.RequestOptions{
-		Task:      "zfs-receive",
-		TaskURL:   taskURL,
-		StreamURL: streamURL,
-		Args: zfs.CommonArgs{
-			Name: filepath.Join(p.config.DatasetDir(), datasetID),
+	importStep := &workflow.Step{
+		Name: "import",
+		Action: workflow.Action{
+			Task:   zfs.TaskReceive,
+			Target: target,
+			Args:   zfs.CommonArgs{Name: name},
+			Prepare: func(_ *workflow.State, opts *acomm.RequestOptions) error {
+				opts.StreamURL = streamURL
+				if req != nil {
+					sendProgress(req, &acomm.Progress{Step: "importing"})
+					// relay receive progress back to the original requestor
+					opts.ProgressHandler = func(_ *acomm.Request, resp *acomm.Response) {
+						sendProgress(req, resp.Progress)
+					}
+				}
+				return nil
+			},
+		},
+		Compensate: &workflow.Action{
+			Task:   zfs.TaskDestroy,
+			Target: target,
+			Args: zfs.DestroyArgs{
+				Name:      name,
+				Recursive: true,
+			},
 		},
 	}
-	_, err = p.tracker.SyncRequest(p.config.CoordinatorURL(), opts, p.config.RequestTimeout())
-	return err
+	steps := []*workflow.Step{importStep}
+	configDeps := []string{"import"}
+
+	if input.Dataset.ReadOnly {
+		steps = append(steps, &workflow.Step{
+			Name:      "snapshot",
+			DependsOn: []string{"import"},
+			Action: workflow.Action{
+				Task:   zfs.TaskSnapshot,
+				Target: target,
+				Args: zfs.SnapshotArgs{
+					Name:      name,
+					SnapName:  input.Dataset.ID,
+					Recursive: false,
+				},
+				Prepare: progress("snapshotting"),
+			},
+		})
+		configDeps = append(configDeps, "snapshot")
+	}
+
+	dataset := input.Dataset
+	steps = append(steps, &workflow.Step{
+		Name:      "config",
+		DependsOn: configDeps,
+		Action: workflow.Action{
+			Task:    clusterconf.TaskUpdateDataset,
+			Args:    clusterconf.DatasetPayload{Dataset: &dataset},
+			Prepare: progress("configuring"),
+		},
+	})
+
+	return &workflow.Workflow{
+		ID:    id,
+		Name:  datasetImportWorkflow,
+		Input: input,
+		Steps: steps,
+	}, nil
 }
 
-func (p *Provider) datasetSnapshot(nodeID, datasetID string) error {
-	taskURL, err := url.ParseRequestURI(fmt.Sprintf("http://%s:%d", nodeID, p.config.NodeCoordinatorPort()))
+func (p *Provider) datasetImportNode(ctx context.Context) (*clusterconf.Node, error) {
+	nodes, err := p.clusterconf.ListNodes(ctx)
 	if err != nil {
-		return errors.Wrapv(err, map[string]interface{}{"taskURL": taskURL}, "failed to generate taskURL")
-	}
-	opts := acomm.RequestOptions{
-		Task:    "zfs-snapshot",
-		TaskURL: taskURL,
-		Args: zfs.SnapshotArgs{
-			Name:      filepath.Join(p.config.DatasetDir(), datasetID),
-			SnapName:  datasetID,
-			Recursive: false,
-		},
+		return nil, err
 	}
-	_, err = p.tracker.SyncRequest(p.config.CoordinatorURL(), opts, p.config.RequestTimeout())
-	return err
+	if len(nodes) == 0 {
+		return nil, errors.New("no nodes found")
+	}
+	node := nodes[rand.Intn(len(nodes))]
+	return &node, nil
 }
 
-func (p *Provider) datasetConfig(dataset clusterconf.Dataset) error {
-	opts := acomm.RequestOptions{
-		Task: "update-dataset",
-		Args: clusterconf.DatasetPayload{Dataset: &dataset},
+// sendProgress sends progress for a request, logging rather than failing on
+// errors since progress is informational.
+func sendProgress(req *acomm.Request, progress *acomm.Progress) {
+	if err := req.SendProgress(progress); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error":     err,
+			"requestID": req.ID,
+		}).Warn("failed to send progress")
 	}
-	_, err := p.tracker.SyncRequest(p.config.CoordinatorURL(), opts, p.config.RequestTimeout())
-	return err
 }
@@ -10,12 +10,13 @@ import (
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/providers/clusterconf"
 	"github.com/cerana/cerana/providers/datatrade"
+	"golang.org/x/net/context"
 )
 
 func (p *Provider) TestDatasetImport() {
 	data := []byte("foobar")
 	stream := bytes.NewBuffer(data)
-	streamURL, err := p.tracker.NewStreamUnix(p.config.StreamDir("dataset-import"), ioutil.NopCloser(stream))
+	streamURL, err := p.tracker.NewStream(ioutil.NopCloser(stream))
 	p.Require().NoError(err)
 
 	p.clusterConf.Data.Nodes["localhost"] = &clusterconf.Node{ID: "localhost"}
@@ -42,7 +43,7 @@ func (p *Provider) TestDatasetImport() {
 		})
 		p.Require().NoError(err)
 
-		res, streamURL, err := p.provider.DatasetImport(req)
+		res, streamURL, err := p.provider.DatasetImport(context.Background(), req)
 		p.Nil(streamURL)
 		if test.expectedErr != "" {
 			p.EqualError(err, test.expectedErr, desc)
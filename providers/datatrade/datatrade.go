@@ -3,23 +3,41 @@ package datatrade
 import (
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/provider"
+	"github.com/cerana/cerana/providers/clusterconf"
+	"github.com/cerana/cerana/workflow"
+	"golang.org/x/net/context"
 )
 
 // Provider is a provider of data import and export functionality.
 type Provider struct {
-	config  *Config
-	tracker *acomm.Tracker
+	config      *Config
+	tracker     *acomm.Tracker
+	clusterconf *clusterconf.Client
+	workflows   *workflow.Engine
 }
 
 // New creates a new instance of Provider.
 func New(config *Config, tracker *acomm.Tracker) *Provider {
-	return &Provider{
-		config:  config,
-		tracker: tracker,
+	p := &Provider{
+		config:      config,
+		tracker:     tracker,
+		clusterconf: clusterconf.NewClient(acomm.NewClient(tracker, config.CoordinatorURL(), config.RequestTimeout())),
 	}
+
+	store := workflow.NewKVStore(tracker, config.CoordinatorURL(), config.RequestTimeout(), "workflows/datatrade")
+	p.workflows = workflow.NewEngine(tracker, config.CoordinatorURL(), config.RequestTimeout(), store)
+	p.workflows.Register(datasetImportWorkflow, p.buildDatasetImportWorkflow)
+	return p
 }
 
 // RegisterTasks registers all of the provider task handlers with the server.
 func (p *Provider) RegisterTasks(server *provider.Server) {
-	server.RegisterTask("import-dataset", p.DatasetImport)
+	server.RegisterContextTask(TaskImportDataset, p.DatasetImport, taskSchemas[TaskImportDataset])
+}
+
+// ResumeWorkflows finishes dataset imports interrupted by a restart of the
+// provider, blocking until they are done. Imports that had not finished
+// receiving their data are cleaned up.
+func (p *Provider) ResumeWorkflows() error {
+	return p.workflows.Resume(context.Background())
 }
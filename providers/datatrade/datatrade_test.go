@@ -42,13 +42,13 @@ func (p *Provider) SetupSuite() {
 
 	p.coordinator, err = test.NewCoordinator("")
 	p.Require().NoError(err)
+	p.coordinator.SetNodeCoordinatorPort(p.nodeCoordinator.HTTPPort)
 
 	p.responseHook, _ = url.ParseRequestURI("unix:///tmp/foobar")
 
 	v := p.coordinator.NewProviderViper()
 	flagset := pflag.NewFlagSet("datatrade", pflag.PanicOnError)
 	v.Set("dataset_dir", "foobar")
-	v.Set("node_coordinator_port", uint(p.nodeCoordinator.HTTPPort))
 	config := datatrade.NewConfig(flagset, v)
 	p.Require().NoError(flagset.Parse([]string{}))
 	p.Require().NoError(config.LoadConfig())
@@ -61,6 +61,7 @@ func (p *Provider) SetupSuite() {
 	p.Require().NoError(p.tracker.Start())
 
 	p.provider = datatrade.New(p.config, p.tracker)
+	p.coordinator.RegisterProvider(p.provider)
 
 	p.setupClusterConf()
 	p.setupZFS()
@@ -0,0 +1,12 @@
+package datatrade
+
+import "github.com/cerana/cerana/provider"
+
+// TaskImportDataset is the task name for importing a dataset into the
+// cluster.
+const TaskImportDataset = "import-dataset"
+
+// taskSchemas describe the datatrade tasks.
+var taskSchemas = map[string]provider.TaskSpec{
+	TaskImportDataset: {Description: "Import a dataset into the cluster from the request stream.", Args: DatasetImportArgs{}, Result: DatasetImportResult{}},
+}
@@ -0,0 +1,42 @@
+package dhcp
+
+import (
+	"github.com/cerana/cerana/acomm"
+	"golang.org/x/net/context"
+)
+
+// Client makes typed requests to the dhcp provider's tasks.
+type Client struct {
+	c *acomm.Client
+}
+
+// NewClient creates a new Client sending requests with the acomm client.
+func NewClient(c *acomm.Client) *Client {
+	return &Client{c: c}
+}
+
+// OfferLease offers a lease to a mac address, preferring its current ip if
+// one is given.
+func (c *Client) OfferLease(ctx context.Context, addrs Addresses) (*Lease, error) {
+	var result Lease
+	if err := c.c.Call(ctx, TaskOfferLease, nil, addrs, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// AckLease acknowledges an offered lease, allocating the ip to the mac
+// address.
+func (c *Client) AckLease(ctx context.Context, addrs Addresses) (*Lease, error) {
+	var result Lease
+	if err := c.c.Call(ctx, TaskAckLease, nil, addrs, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// RemoveLease expires the lease of a mac address. It is only provided by the
+// Mock.
+func (c *Client) RemoveLease(ctx context.Context, addrs Addresses) error {
+	return c.c.Call(ctx, TaskRemoveLease, nil, addrs, nil)
+}
@@ -0,0 +1,58 @@
+package dhcp
+
+import (
+	"testing"
+
+	"github.com/cerana/cerana/pkg/test"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type ClientS struct {
+	suite.Suite
+	coord  *test.Coordinator
+	mock   *Mock
+	client *Client
+}
+
+func TestClient(t *testing.T) {
+	suite.Run(t, &ClientS{})
+}
+
+func (s *ClientS) SetupSuite() {
+	coordinator, err := test.NewCoordinator("")
+	s.Require().NoError(err)
+	s.coord = coordinator
+
+	s.mock = NewMock()
+	s.coord.RegisterProvider(s.mock)
+	s.Require().NoError(s.coord.Start())
+
+	s.client = NewClient(s.coord.NewClient())
+}
+
+func (s *ClientS) TearDownSuite() {
+	s.coord.Stop()
+	s.Require().NoError(s.coord.Cleanup())
+}
+
+func (s *ClientS) TestRoundTrip() {
+	ctx := context.Background()
+	mac := "de:ad:be:ef:00:01"
+
+	offer, err := s.client.OfferLease(ctx, Addresses{MAC: mac})
+	s.Require().NoError(err)
+	s.Equal(s.mock.Config.Gateway(), offer.Gateway)
+	s.Equal(s.mock.Config.LeaseDuration(), offer.Duration)
+
+	ack, err := s.client.AckLease(ctx, Addresses{MAC: mac, IP: offer.Net.IP.String()})
+	s.Require().NoError(err)
+	s.Equal(offer.Net.IP.String(), ack.Net.IP.String())
+
+	s.NoError(s.client.RemoveLease(ctx, Addresses{MAC: mac}))
+	_, err = s.client.AckLease(ctx, Addresses{MAC: mac, IP: offer.Net.IP.String()})
+	s.Error(err, "should fail for a removed lease")
+
+	_, err = s.client.OfferLease(ctx, Addresses{})
+	s.Error(err, "should fail without a mac address")
+}
@@ -58,8 +58,8 @@ func New(config *Config, tracker *acomm.Tracker) (*DHCP, error) {
 
 // RegisterTasks registers all of DHCP's task handlers with the server.
 func (d *DHCP) RegisterTasks(server *provider.Server) {
-	server.RegisterTask("dhcp-offer-lease", d.get)
-	server.RegisterTask("dhcp-ack-lease", d.ack)
+	server.RegisterTask(TaskOfferLease, d.get, taskSchemas[TaskOfferLease])
+	server.RegisterTask(TaskAckLease, d.ack, taskSchemas[TaskAckLease])
 }
 
 func lookupMAC(tracker *acomm.Tracker, coord *url.URL, ip string) (string, error) {
@@ -68,7 +68,7 @@ func lookupMAC(tracker *acomm.Tracker, coord *url.URL, ip string) (string, error
 		ch <- resp
 	}
 	req, err := acomm.NewRequest(acomm.RequestOptions{
-		Task:           "kv-get",
+		Task:           kv.TaskGet,
 		ResponseHook:   tracker.URL(),
 		SuccessHandler: handler,
 		ErrorHandler:   handler,
@@ -88,7 +88,12 @@ func lookupMAC(tracker *acomm.Tracker, coord *url.URL, ip string) (string, error
 
 	resp := <-ch
 	if resp.Error != nil {
-		return "", nil
+		// No lease for the ip is expected, but other failures mean the
+		// assignment is unknown
+		if errors.IsCode(resp.Error, errors.CodeNotFound) {
+			return "", nil
+		}
+		return "", resp.Error
 	}
 
 	kvp := kv.Value{}
@@ -105,7 +110,7 @@ func doESet(tracker *acomm.Tracker, coord *url.URL, mac, ip string, ttl time.Dur
 		ch <- resp
 	}
 	req, err := acomm.NewRequest(acomm.RequestOptions{
-		Task:           "kv-ephemeral-set",
+		Task:           kv.TaskEphemeralSet,
 		ResponseHook:   tracker.URL(),
 		SuccessHandler: handler,
 		ErrorHandler:   handler,
@@ -201,7 +206,7 @@ func getAllAllocations(tracker *acomm.Tracker, coord *url.URL) (map[string]strin
 		ch <- resp
 	}
 	req, err := acomm.NewRequest(acomm.RequestOptions{
-		Task:           "kv-getAll",
+		Task:           kv.TaskGetAll,
 		ResponseHook:   tracker.URL(),
 		SuccessHandler: handler,
 		ErrorHandler:   handler,
@@ -243,7 +248,7 @@ func (d *DHCP) get(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if addrs.MAC == "" {
-		return nil, nil, errors.Newv("missing arg: mac", map[string]interface{}{"args": addrs, "missing": "mac"})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: mac", map[string]interface{}{"args": addrs, "missing": "mac"})
 	}
 
 	lease := Lease{
@@ -367,14 +372,14 @@ func (d *DHCP) ack(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if addrs.MAC == "" {
-		return nil, nil, errors.Newv("missing arg: mac", map[string]interface{}{"args": addrs, "missing": "mac"})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: mac", map[string]interface{}{"args": addrs, "missing": "mac"})
 	}
 	if addrs.IP == "" {
-		return nil, nil, errors.Newv("missing arg: ip", map[string]interface{}{"args": addrs, "missing": "ip"})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: ip", map[string]interface{}{"args": addrs, "missing": "ip"})
 	}
 
 	if !d.config.ipInRange(net.ParseIP(addrs.IP)) {
-		return nil, nil, errors.Newv("invalid ip", map[string]interface{}{"ip": addrs.IP})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "invalid ip", map[string]interface{}{"ip": addrs.IP})
 	}
 
 	mac, err := lookupMAC(d.tracker, d.coordinator, addrs.IP)
@@ -48,9 +48,9 @@ func NewMock() *Mock {
 
 // RegisterTasks registers all of Mock's task handlers with the server.
 func (m *Mock) RegisterTasks(server *provider.Server) {
-	server.RegisterTask("dhcp-offer-lease", m.get)
-	server.RegisterTask("dhcp-ack-lease", m.ack)
-	server.RegisterTask("dhcp-remove-lease", m.remove)
+	server.RegisterTask(TaskOfferLease, m.get, taskSchemas[TaskOfferLease])
+	server.RegisterTask(TaskAckLease, m.ack, taskSchemas[TaskAckLease])
+	server.RegisterTask(TaskRemoveLease, m.remove, taskSchemas[TaskRemoveLease])
 }
 
 func (m *Mock) get(req *acomm.Request) (interface{}, *url.URL, error) {
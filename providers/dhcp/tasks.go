@@ -0,0 +1,18 @@
+package dhcp
+
+import "github.com/cerana/cerana/provider"
+
+// Task names of the dhcp provider.
+const (
+	TaskOfferLease = "dhcp-offer-lease"
+	TaskAckLease   = "dhcp-ack-lease"
+	// TaskRemoveLease is only provided by the Mock.
+	TaskRemoveLease = "dhcp-remove-lease"
+)
+
+// taskSchemas describe the dhcp tasks.
+var taskSchemas = map[string]provider.TaskSpec{
+	TaskOfferLease:  {Description: "Offer a lease for a mac address.", Args: Addresses{}, Result: Lease{}},
+	TaskAckLease:    {Description: "Acknowledge a lease for a mac address.", Args: Addresses{}, Result: Lease{}},
+	TaskRemoveLease: {Description: "Remove a lease.", Args: Addresses{}},
+}
@@ -0,0 +1,40 @@
+package health
+
+import (
+	"net/url"
+
+	"github.com/cerana/cerana/acomm"
+	"golang.org/x/net/context"
+)
+
+// Client makes typed requests to the health provider's tasks. Requests go to
+// the coordinator of the acomm client, or on to the node's coordinator url if
+// one is given. Each check returns an error if it fails.
+type Client struct {
+	c *acomm.Client
+}
+
+// NewClient creates a new Client sending requests with the acomm client.
+func NewClient(c *acomm.Client) *Client {
+	return &Client{c: c}
+}
+
+// Uptime checks that a unit has been running for a minimum time.
+func (c *Client) Uptime(ctx context.Context, node *url.URL, args UptimeArgs) error {
+	return c.c.Call(ctx, TaskUptime, node, args, nil)
+}
+
+// File checks the existence, mode, and size of a file.
+func (c *Client) File(ctx context.Context, node *url.URL, args FileArgs) error {
+	return c.c.Call(ctx, TaskFile, node, args, nil)
+}
+
+// TCPResponse checks the response to a TCP request.
+func (c *Client) TCPResponse(ctx context.Context, node *url.URL, args TCPResponseArgs) error {
+	return c.c.Call(ctx, TaskTCPResponse, node, args, nil)
+}
+
+// HTTPStatus checks the status code of an HTTP request.
+func (c *Client) HTTPStatus(ctx context.Context, node *url.URL, args HTTPStatusArgs) error {
+	return c.c.Call(ctx, TaskHTTPStatus, node, args, nil)
+}
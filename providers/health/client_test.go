@@ -0,0 +1,51 @@
+package health_test
+
+import (
+	"testing"
+
+	"github.com/cerana/cerana/pkg/test"
+	healthp "github.com/cerana/cerana/providers/health"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type client struct {
+	suite.Suite
+	coordinator *test.Coordinator
+	health      *healthp.Mock
+	client      *healthp.Client
+}
+
+func TestClient(t *testing.T) {
+	suite.Run(t, new(client))
+}
+
+func (s *client) SetupSuite() {
+	var err error
+	s.coordinator, err = test.NewCoordinator("")
+	s.Require().NoError(err)
+
+	s.health = healthp.NewMock()
+	s.coordinator.RegisterProvider(s.health)
+	s.Require().NoError(s.coordinator.Start())
+
+	s.client = healthp.NewClient(s.coordinator.NewClient())
+}
+
+func (s *client) TearDownSuite() {
+	s.coordinator.Stop()
+	s.Require().NoError(s.coordinator.Cleanup())
+}
+
+func (s *client) TestRoundTrip() {
+	ctx := context.Background()
+
+	s.NoError(s.client.Uptime(ctx, nil, healthp.UptimeArgs{}))
+	s.NoError(s.client.File(ctx, nil, healthp.FileArgs{}))
+	s.NoError(s.client.TCPResponse(ctx, nil, healthp.TCPResponseArgs{}))
+	s.NoError(s.client.HTTPStatus(ctx, nil, healthp.HTTPStatusArgs{}))
+
+	s.health.Data.File = false
+	defer func() { s.health.Data.File = true }()
+	s.Error(s.client.File(ctx, nil, healthp.FileArgs{}), "should fail when the check fails")
+}
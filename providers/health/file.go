@@ -25,7 +25,7 @@ func (h *Health) File(req *acomm.Request) (interface{}, *url.URL, error) {
 	}
 
 	if args.Path == "" {
-		return nil, nil, errors.Newv("missing arg: path", map[string]interface{}{"args": args, "missing": "path"})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: path", map[string]interface{}{"args": args, "missing": "path"})
 	}
 
 	fileInfo, err := os.Stat(args.Path)
@@ -21,8 +21,8 @@ func New(config *provider.Config, tracker *acomm.Tracker) *Health {
 
 // RegisterTasks registers all of Health's task handlers with the server.
 func (h *Health) RegisterTasks(server *provider.Server) {
-	server.RegisterTask("health-uptime", h.Uptime)
-	server.RegisterTask("health-file", h.File)
-	server.RegisterTask("health-tcp-response", h.TCPResponse)
-	server.RegisterTask("health-http-status", h.HTTPStatus)
+	server.RegisterTask(TaskUptime, h.Uptime, taskSchemas[TaskUptime])
+	server.RegisterTask(TaskFile, h.File, taskSchemas[TaskFile])
+	server.RegisterTask(TaskTCPResponse, h.TCPResponse, taskSchemas[TaskTCPResponse])
+	server.RegisterTask(TaskHTTPStatus, h.HTTPStatus, taskSchemas[TaskHTTPStatus])
 }
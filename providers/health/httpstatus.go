@@ -27,7 +27,7 @@ func (h *Health) HTTPStatus(req *acomm.Request) (interface{}, *url.URL, error) {
 	}
 
 	if args.URL == "" {
-		return nil, nil, errors.Newv("missing arg: url", map[string]interface{}{"args": args, "missing": "url"})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: url", map[string]interface{}{"args": args, "missing": "url"})
 	}
 
 	if args.StatusCode == 0 {
@@ -35,10 +35,10 @@ func NewMock() *Mock {
 
 // RegisterTasks registers all of the Mock health task handlers with the server.
 func (m *Mock) RegisterTasks(server *provider.Server) {
-	server.RegisterTask("health-uptime", m.Uptime)
-	server.RegisterTask("health-file", m.File)
-	server.RegisterTask("health-tcp-response", m.TCPResponse)
-	server.RegisterTask("health-http-status", m.HTTPStatus)
+	server.RegisterTask(TaskUptime, m.Uptime, taskSchemas[TaskUptime])
+	server.RegisterTask(TaskFile, m.File, taskSchemas[TaskFile])
+	server.RegisterTask(TaskTCPResponse, m.TCPResponse, taskSchemas[TaskTCPResponse])
+	server.RegisterTask(TaskHTTPStatus, m.HTTPStatus, taskSchemas[TaskHTTPStatus])
 }
 
 // Uptime is a mock uptime health check.
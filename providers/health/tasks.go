@@ -0,0 +1,19 @@
+package health
+
+import "github.com/cerana/cerana/provider"
+
+// Task names of the health provider.
+const (
+	TaskUptime      = "health-uptime"
+	TaskFile        = "health-file"
+	TaskTCPResponse = "health-tcp-response"
+	TaskHTTPStatus  = "health-http-status"
+)
+
+// taskSchemas describe the health tasks.
+var taskSchemas = map[string]provider.TaskSpec{
+	TaskUptime:      {Description: "Check that a unit has been up for a minimum time.", Args: UptimeArgs{}},
+	TaskFile:        {Description: "Check that a file exists, or not.", Args: FileArgs{}},
+	TaskTCPResponse: {Description: "Check the response to a TCP request.", Args: TCPResponseArgs{}},
+	TaskHTTPStatus:  {Description: "Check the status code of an HTTP request.", Args: HTTPStatusArgs{}},
+}
@@ -27,10 +27,10 @@ func (h *Health) TCPResponse(req *acomm.Request) (interface{}, *url.URL, error)
 	}
 
 	if args.Address == "" {
-		return nil, nil, errors.Newv("missing arg: address", map[string]interface{}{"args": args, "missing": "address"})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: address", map[string]interface{}{"args": args, "missing": "address"})
 	}
 	if args.Regexp == "" {
-		return nil, nil, errors.Newv("missing arg: regexp", map[string]interface{}{"args": args, "missing": "regexp"})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: regexp", map[string]interface{}{"args": args, "missing": "regexp"})
 	}
 	re, err := regexp.Compile(args.Regexp)
 	if err != nil {
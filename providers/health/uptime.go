@@ -22,7 +22,7 @@ func (h *Health) Uptime(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if args.Name == "" {
-		return nil, nil, errors.Newv("missing arg: name", map[string]interface{}{"args": args, "missing": "name"})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: name", map[string]interface{}{"args": args, "missing": "name"})
 	}
 
 	unitStatus, err := h.getUnitStatus(args.Name)
@@ -43,7 +43,7 @@ func (h *Health) getUnitStatus(name string) (*systemd.UnitStatus, error) {
 		doneChan <- resp
 	}
 	req, err := acomm.NewRequest(acomm.RequestOptions{
-		Task:           "systemd-get",
+		Task:           systemd.TaskGet,
 		ResponseHook:   h.tracker.URL(),
 		Args:           &systemd.GetArgs{Name: name},
 		SuccessHandler: rh,
@@ -32,13 +32,13 @@ func (k *KV) delete(req *acomm.Request) (interface{}, *url.URL, error) {
 	}
 
 	if !args.Recursive && args.Key == "" {
-		return nil, nil, errors.Newv("missing arg: key", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: key", map[string]interface{}{"args": args})
 	}
 
 	if k.kvDown() {
 		return nil, nil, errors.Wrap(errorKVDown)
 	}
-	return nil, nil, k.kv.Delete(args.Key, args.Recursive)
+	return nil, nil, k.codeError(k.kv.Delete(args.Key, args.Recursive))
 }
 
 func (k *KV) get(req *acomm.Request) (interface{}, *url.URL, error) {
@@ -48,7 +48,7 @@ func (k *KV) get(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if args.Key == "" {
-		return nil, nil, errors.Newv("missing arg: key", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: key", map[string]interface{}{"args": args})
 	}
 
 	if k.kvDown() {
@@ -56,7 +56,7 @@ func (k *KV) get(req *acomm.Request) (interface{}, *url.URL, error) {
 	}
 	kvp, err := k.kv.Get(args.Key)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, k.codeError(err)
 	}
 
 	return kvp, nil, nil
@@ -69,7 +69,7 @@ func (k *KV) getAll(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if args.Key == "" {
-		return nil, nil, errors.Newv("missing arg: key", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: key", map[string]interface{}{"args": args})
 	}
 
 	if k.kvDown() {
@@ -77,7 +77,7 @@ func (k *KV) getAll(req *acomm.Request) (interface{}, *url.URL, error) {
 	}
 	kvps, err := k.kv.GetAll(args.Key)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, k.codeError(err)
 	}
 
 	return kvps, nil, nil
@@ -90,7 +90,7 @@ func (k *KV) keys(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if args.Key == "" {
-		return nil, nil, errors.Newv("missing arg: key", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: key", map[string]interface{}{"args": args})
 	}
 
 	if k.kvDown() {
@@ -98,7 +98,7 @@ func (k *KV) keys(req *acomm.Request) (interface{}, *url.URL, error) {
 	}
 	keys, err := k.kv.Keys(args.Key)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, k.codeError(err)
 	}
 
 	return keys, nil, nil
@@ -111,10 +111,10 @@ func (k *KV) set(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if args.Key == "" {
-		return nil, nil, errors.Newv("missing arg: key", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: key", map[string]interface{}{"args": args})
 	}
 	if args.Data == "" {
-		return nil, nil, errors.Newv("missing arg: data", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: data", map[string]interface{}{"args": args})
 	}
 
 	if k.kvDown() {
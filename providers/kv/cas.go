@@ -33,13 +33,13 @@ func (k *KV) remove(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if args.Key == "" {
-		return nil, nil, errors.Newv("missing arg: key", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: key", map[string]interface{}{"args": args})
 	}
 
 	if k.kvDown() {
 		return nil, nil, errors.Wrap(errorKVDown)
 	}
-	return nil, nil, k.kv.Remove(args.Key, args.Index)
+	return nil, nil, k.codeError(k.kv.Remove(args.Key, args.Index))
 }
 
 func (k *KV) update(req *acomm.Request) (interface{}, *url.URL, error) {
@@ -49,10 +49,10 @@ func (k *KV) update(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if args.Key == "" {
-		return nil, nil, errors.Newv("missing arg: key", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: key", map[string]interface{}{"args": args})
 	}
 	if args.Value == "" {
-		return nil, nil, errors.Newv("missing arg: value", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: value", map[string]interface{}{"args": args})
 	}
 
 	value := kv.Value{
@@ -65,7 +65,7 @@ func (k *KV) update(req *acomm.Request) (interface{}, *url.URL, error) {
 	}
 	index, err := k.kv.Update(args.Key, value)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, k.codeError(err)
 	}
 
 	ret := UpdateReturn{
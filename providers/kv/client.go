@@ -0,0 +1,111 @@
+package kv
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/kv"
+	"golang.org/x/net/context"
+)
+
+// Client makes typed requests to the kv provider's tasks.
+type Client struct {
+	c *acomm.Client
+}
+
+// NewClient creates a new Client sending requests with the acomm client.
+func NewClient(c *acomm.Client) *Client {
+	return &Client{c: c}
+}
+
+// Delete removes a key, and the keys under it if recursive is set.
+func (c *Client) Delete(ctx context.Context, key string, recursive bool) error {
+	return c.c.Call(ctx, TaskDelete, nil, DeleteArgs{Key: key, Recursive: recursive}, nil)
+}
+
+// Get retrieves the value of a key.
+func (c *Client) Get(ctx context.Context, key string) (kv.Value, error) {
+	var result kv.Value
+	err := c.c.Call(ctx, TaskGet, nil, GetArgs{Key: key}, &result)
+	return result, err
+}
+
+// GetAll retrieves the values of all keys under a prefix.
+func (c *Client) GetAll(ctx context.Context, prefix string) (map[string]kv.Value, error) {
+	var result map[string]kv.Value
+	err := c.c.Call(ctx, TaskGetAll, nil, GetArgs{Key: prefix}, &result)
+	return result, err
+}
+
+// Keys lists the keys directly under a prefix.
+func (c *Client) Keys(ctx context.Context, prefix string) ([]string, error) {
+	var result []string
+	err := c.c.Call(ctx, TaskKeys, nil, GetArgs{Key: prefix}, &result)
+	return result, err
+}
+
+// Set sets the value of a key.
+func (c *Client) Set(ctx context.Context, key, data string) error {
+	return c.c.Call(ctx, TaskSet, nil, SetArgs{Key: key, Data: data}, nil)
+}
+
+// Remove removes a key if it hasn't been modified since index.
+func (c *Client) Remove(ctx context.Context, key string, index uint64) error {
+	return c.c.Call(ctx, TaskRemove, nil, RemoveArgs{Key: key, Index: index}, nil)
+}
+
+// Update sets the value of a key if it hasn't been modified since index,
+// returning the new index. An index of 0 only creates the key.
+func (c *Client) Update(ctx context.Context, key, value string, index uint64) (uint64, error) {
+	var result UpdateReturn
+	err := c.c.Call(ctx, TaskUpdate, nil, UpdateArgs{Key: key, Value: value, Index: index}, &result)
+	return result.Index, err
+}
+
+// Watch watches a prefix for changes after index. The events are streamed as
+// JSON from the returned url until the watch is stopped with its cookie.
+func (c *Client) Watch(ctx context.Context, prefix string, index uint64) (Cookie, *url.URL, error) {
+	var result Cookie
+	resp, err := c.c.Do(ctx, acomm.RequestOptions{
+		Task: TaskWatch,
+		Args: WatchArgs{Prefix: prefix, Index: index},
+	}, &result)
+	if err != nil {
+		return result, nil, err
+	}
+	return result, resp.StreamURL, nil
+}
+
+// Stop stops a watch.
+func (c *Client) Stop(ctx context.Context, cookie Cookie) error {
+	return c.c.Call(ctx, TaskStop, nil, cookie, nil)
+}
+
+// Lock acquires a lock on a key, held for the ttl unless renewed.
+func (c *Client) Lock(ctx context.Context, key string, ttl time.Duration) (Cookie, error) {
+	var result Cookie
+	err := c.c.Call(ctx, TaskLock, nil, LockArgs{Key: key, TTL: ttl}, &result)
+	return result, err
+}
+
+// Renew renews a lock for another ttl.
+func (c *Client) Renew(ctx context.Context, cookie Cookie) error {
+	return c.c.Call(ctx, TaskRenew, nil, cookie, nil)
+}
+
+// Unlock releases a lock.
+func (c *Client) Unlock(ctx context.Context, cookie Cookie) error {
+	return c.c.Call(ctx, TaskUnlock, nil, cookie, nil)
+}
+
+// EphemeralSet sets the value of a key that is removed if it isn't set again
+// within the ttl.
+func (c *Client) EphemeralSet(ctx context.Context, key, value string, ttl time.Duration) error {
+	return c.c.Call(ctx, TaskEphemeralSet, nil, EphemeralSetArgs{Key: key, Value: value, TTL: ttl}, nil)
+}
+
+// EphemeralDestroy removes an ephemeral key.
+func (c *Client) EphemeralDestroy(ctx context.Context, key string) error {
+	return c.c.Call(ctx, TaskEphemeralDestroy, nil, EphemeralDestroyArgs{Key: key}, nil)
+}
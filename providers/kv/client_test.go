@@ -0,0 +1,102 @@
+package kv_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/test"
+	"github.com/cerana/cerana/provider"
+	"github.com/cerana/cerana/providers/kv"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type client struct {
+	suite.Suite
+	coord   *test.Coordinator
+	tracker *acomm.Tracker
+	mock    *kv.Mock
+	client  *kv.Client
+}
+
+func TestClient(t *testing.T) {
+	suite.Run(t, new(client))
+}
+
+func (s *client) SetupSuite() {
+	coordinator, err := test.NewCoordinator("")
+	s.Require().NoError(err)
+	s.coord = coordinator
+
+	flagset := pflag.NewFlagSet("kv-client", pflag.PanicOnError)
+	config := provider.NewConfig(flagset, coordinator.NewProviderViper())
+	s.Require().NoError(flagset.Parse([]string{}))
+
+	s.tracker, err = acomm.NewTracker(filepath.Join(coordinator.SocketDir, "tracker.sock"), nil, nil, 5*time.Second)
+	s.Require().NoError(err)
+	s.Require().NoError(s.tracker.Start())
+
+	s.mock, err = kv.NewMock(config, s.tracker)
+	s.Require().NoError(err)
+
+	coordinator.RegisterProvider(s.mock)
+	s.Require().NoError(coordinator.Start())
+
+	s.client = kv.NewClient(coordinator.NewClient())
+}
+
+func (s *client) TearDownTest() {
+	_ = s.mock.Clean("client-test")
+}
+
+func (s *client) TearDownSuite() {
+	s.mock.Stop()
+	s.coord.Stop()
+	s.tracker.Stop()
+	s.Require().NoError(s.coord.Cleanup())
+}
+
+func (s *client) TestRoundTrip() {
+	ctx := context.Background()
+
+	s.NoError(s.client.Set(ctx, "client-test/foo", "bar"))
+	value, err := s.client.Get(ctx, "client-test/foo")
+	if s.NoError(err) {
+		s.Equal("bar", string(value.Data))
+	}
+
+	values, err := s.client.GetAll(ctx, "client-test")
+	s.NoError(err)
+	s.Len(values, 1)
+	keys, err := s.client.Keys(ctx, "client-test")
+	s.NoError(err)
+	s.Len(keys, 1)
+
+	index, err := s.client.Update(ctx, "client-test/foo", "baz", value.Index)
+	s.NoError(err)
+	_, err = s.client.Update(ctx, "client-test/foo", "qux", value.Index)
+	s.True(errors.IsCode(err, errors.CodeConflict), "should fail with the error code of the provider")
+	s.NoError(s.client.Remove(ctx, "client-test/foo", index))
+
+	s.NoError(s.client.EphemeralSet(ctx, "client-test/ephemeral", "bar", 5*time.Second))
+	s.NoError(s.client.EphemeralDestroy(ctx, "client-test/ephemeral"))
+
+	cookie, err := s.client.Lock(ctx, "client-test/lock", 5*time.Second)
+	s.Require().NoError(err)
+	s.NoError(s.client.Renew(ctx, cookie))
+	s.NoError(s.client.Unlock(ctx, cookie))
+
+	cookie, streamURL, err := s.client.Watch(ctx, "client-test", 0)
+	s.Require().NoError(err)
+	s.NotNil(streamURL)
+	s.NoError(s.client.Stop(ctx, cookie))
+
+	s.NoError(s.client.Set(ctx, "client-test/dir/foo", "bar"))
+	s.NoError(s.client.Delete(ctx, "client-test/dir", true))
+	_, err = s.client.Get(ctx, "client-test/dir/foo")
+	s.Error(err, "should fail for a deleted key")
+}
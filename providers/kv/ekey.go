@@ -29,13 +29,13 @@ func (k *KV) eset(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if args.Key == "" {
-		return nil, nil, errors.Newv("missing arg: key", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: key", map[string]interface{}{"args": args})
 	}
 	if args.Value == "" {
-		return nil, nil, errors.Newv("missing arg: value", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: value", map[string]interface{}{"args": args})
 	}
 	if args.TTL == 0 {
-		return nil, nil, errors.Newv("missing arg: ttl", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: ttl", map[string]interface{}{"args": args})
 	}
 
 	if k.kvDown() {
@@ -64,7 +64,7 @@ func (k *KV) edestroy(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if args.Key == "" {
-		return nil, nil, errors.Newv("missing arg: key", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: key", map[string]interface{}{"args": args})
 	}
 
 	return nil, nil, eKeys.Destroy(args.Key)
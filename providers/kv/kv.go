@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
 	"github.com/cerana/cerana/pkg/kv"
 	_ "github.com/cerana/cerana/pkg/kv/consul" // register consul with pkg/kv
 	"github.com/cerana/cerana/provider"
@@ -28,6 +29,10 @@ func (e eKVDown) Temporary() bool {
 	return true
 }
 
+func (e eKVDown) Code() errors.Code {
+	return errors.CodeUnavailable
+}
+
 func (e eKVDown) Error() string {
 	return string(e)
 }
@@ -48,7 +53,7 @@ func New(config *Config, tracker *acomm.Tracker) (*KV, error) {
 			k, err := kv.New(addr)
 			if err == nil {
 				KV.mu.Lock()
-				KV.kv = k
+				KV.kv = instrumentedKV{k}
 				KV.mu.Unlock()
 				return
 
@@ -65,29 +70,38 @@ func (k *KV) kvDown() bool {
 	return k.kv == nil
 }
 
+// codeError classifies errors from the kv store that callers are likely to
+// handle.
+func (k *KV) codeError(err error) error {
+	if err != nil && k.kv.IsKeyNotFound(err) {
+		return errors.WithCode(err, errors.CodeNotFound)
+	}
+	return err
+}
+
 // RegisterTasks registers all of KV's task handlers with the server.
 func (k *KV) RegisterTasks(server *provider.Server) {
 	// simple.go
-	server.RegisterTask("kv-delete", k.delete)
-	server.RegisterTask("kv-get", k.get)
-	server.RegisterTask("kv-getAll", k.getAll)
-	server.RegisterTask("kv-keys", k.keys)
-	server.RegisterTask("kv-set", k.set)
+	server.RegisterTask(TaskDelete, k.delete, taskSchemas[TaskDelete])
+	server.RegisterTask(TaskGet, k.get, taskSchemas[TaskGet])
+	server.RegisterTask(TaskGetAll, k.getAll, taskSchemas[TaskGetAll])
+	server.RegisterTask(TaskKeys, k.keys, taskSchemas[TaskKeys])
+	server.RegisterTask(TaskSet, k.set, taskSchemas[TaskSet])
 
 	// cas.go
-	server.RegisterTask("kv-remove", k.remove)
-	server.RegisterTask("kv-update", k.update)
+	server.RegisterTask(TaskRemove, k.remove, taskSchemas[TaskRemove])
+	server.RegisterTask(TaskUpdate, k.update, taskSchemas[TaskUpdate])
 
 	// watch.go
-	server.RegisterTask("kv-watch", k.watch)
-	server.RegisterTask("kv-stop", k.stop)
+	server.RegisterTask(TaskWatch, k.watch, taskSchemas[TaskWatch])
+	server.RegisterTask(TaskStop, k.stop, taskSchemas[TaskStop])
 
 	// lock.go
-	server.RegisterTask("kv-lock", k.lock)
-	server.RegisterTask("kv-renew", k.renew)
-	server.RegisterTask("kv-unlock", k.unlock)
+	server.RegisterTask(TaskLock, k.lock, taskSchemas[TaskLock])
+	server.RegisterTask(TaskRenew, k.renew, taskSchemas[TaskRenew])
+	server.RegisterTask(TaskUnlock, k.unlock, taskSchemas[TaskUnlock])
 
 	// ekey.go
-	server.RegisterTask("kv-ephemeral-set", k.eset)
-	server.RegisterTask("kv-ephemeral-destroy", k.edestroy)
+	server.RegisterTask(TaskEphemeralSet, k.eset, taskSchemas[TaskEphemeralSet])
+	server.RegisterTask(TaskEphemeralDestroy, k.edestroy, taskSchemas[TaskEphemeralDestroy])
 }
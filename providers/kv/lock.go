@@ -24,10 +24,10 @@ func (k *KV) lock(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if args.Key == "" {
-		return nil, nil, errors.Newv("missing arg: key", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: key", map[string]interface{}{"args": args})
 	}
 	if args.TTL == 0 {
-		return nil, nil, errors.Newv("missing arg: ttl", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: ttl", map[string]interface{}{"args": args})
 	}
 
 	if k.kvDown() {
@@ -54,7 +54,7 @@ func (k *KV) renew(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if args.Cookie == 0 {
-		return nil, nil, errors.Newv("missing arg: cookie", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: cookie", map[string]interface{}{"args": args})
 	}
 
 	iface, err := locks.Peek(args.Cookie)
@@ -79,7 +79,7 @@ func (k *KV) unlock(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if args.Cookie == 0 {
-		return nil, nil, errors.Newv("missing arg: cookie", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: cookie", map[string]interface{}{"args": args})
 	}
 
 	iface, err := locks.Get(args.Cookie)
@@ -0,0 +1,102 @@
+package kv
+
+import (
+	"time"
+
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/kv"
+	"github.com/cerana/cerana/pkg/prometheusx"
+)
+
+// instrumentedKV observes the latency of each call to a kv store. Calls that
+// create locks, ephemeral keys, and watches are observed, but not later use of
+// what they return.
+type instrumentedKV struct {
+	kv.KV
+}
+
+// observe records the duration and outcome of a kv store call.
+func (i instrumentedKV) observe(operation string, start time.Time, err error) {
+	outcome := prometheusx.Outcome(err)
+	if err != nil && i.KV.IsKeyNotFound(err) {
+		outcome = string(errors.CodeNotFound)
+	}
+	prometheusx.KVDuration.WithLabelValues(operation, outcome).Observe(prometheusx.Since(start))
+}
+
+func (i instrumentedKV) Delete(key string, recurse bool) error {
+	start := time.Now()
+	err := i.KV.Delete(key, recurse)
+	i.observe("delete", start, err)
+	return err
+}
+
+func (i instrumentedKV) Get(key string) (kv.Value, error) {
+	start := time.Now()
+	value, err := i.KV.Get(key)
+	i.observe("get", start, err)
+	return value, err
+}
+
+func (i instrumentedKV) GetAll(prefix string) (map[string]kv.Value, error) {
+	start := time.Now()
+	values, err := i.KV.GetAll(prefix)
+	i.observe("getAll", start, err)
+	return values, err
+}
+
+func (i instrumentedKV) Keys(prefix string) ([]string, error) {
+	start := time.Now()
+	keys, err := i.KV.Keys(prefix)
+	i.observe("keys", start, err)
+	return keys, err
+}
+
+func (i instrumentedKV) Set(key, value string) error {
+	start := time.Now()
+	err := i.KV.Set(key, value)
+	i.observe("set", start, err)
+	return err
+}
+
+func (i instrumentedKV) Update(key string, value kv.Value) (uint64, error) {
+	start := time.Now()
+	index, err := i.KV.Update(key, value)
+	i.observe("update", start, err)
+	return index, err
+}
+
+func (i instrumentedKV) Remove(key string, index uint64) error {
+	start := time.Now()
+	err := i.KV.Remove(key, index)
+	i.observe("remove", start, err)
+	return err
+}
+
+func (i instrumentedKV) Watch(prefix string, index uint64, stop chan struct{}) (chan kv.Event, chan error, error) {
+	start := time.Now()
+	events, errs, err := i.KV.Watch(prefix, index, stop)
+	i.observe("watch", start, err)
+	return events, errs, err
+}
+
+func (i instrumentedKV) EphemeralKey(key string, ttl time.Duration) (kv.EphemeralKey, error) {
+	start := time.Now()
+	ekey, err := i.KV.EphemeralKey(key, ttl)
+	i.observe("ephemeralKey", start, err)
+	return ekey, err
+}
+
+func (i instrumentedKV) Lock(key string, ttl time.Duration) (kv.Lock, error) {
+	start := time.Now()
+	lock, err := i.KV.Lock(key, ttl)
+	i.observe("lock", start, err)
+	return lock, err
+}
+
+func (i instrumentedKV) Ping() error {
+	start := time.Now()
+	err := i.KV.Ping()
+	i.observe("ping", start, err)
+	return err
+}
@@ -0,0 +1,50 @@
+package kv
+
+import (
+	"github.com/cerana/cerana/pkg/kv"
+	"github.com/cerana/cerana/provider"
+)
+
+// Task names of the kv provider.
+const (
+	TaskDelete = "kv-delete"
+	TaskGet    = "kv-get"
+	TaskGetAll = "kv-getAll"
+	TaskKeys   = "kv-keys"
+	TaskSet    = "kv-set"
+
+	TaskRemove = "kv-remove"
+	TaskUpdate = "kv-update"
+
+	TaskWatch = "kv-watch"
+	TaskStop  = "kv-stop"
+
+	TaskLock   = "kv-lock"
+	TaskRenew  = "kv-renew"
+	TaskUnlock = "kv-unlock"
+
+	TaskEphemeralSet     = "kv-ephemeral-set"
+	TaskEphemeralDestroy = "kv-ephemeral-destroy"
+)
+
+// taskSchemas describe the kv tasks.
+var taskSchemas = map[string]provider.TaskSpec{
+	TaskDelete: {Description: "Remove a key, and the keys under it if recursive.", Args: DeleteArgs{}},
+	TaskGet:    {Description: "Retrieve the value of a key.", Args: GetArgs{}, Result: kv.Value{}},
+	TaskGetAll: {Description: "Retrieve the values of all keys under a prefix.", Args: GetArgs{}, Result: map[string]kv.Value{}},
+	TaskKeys:   {Description: "List the keys directly under a prefix.", Args: GetArgs{}, Result: []string{}},
+	TaskSet:    {Description: "Set the value of a key.", Args: SetArgs{}},
+
+	TaskRemove: {Description: "Remove a key if it has not been modified since the index.", Args: RemoveArgs{}},
+	TaskUpdate: {Description: "Set the value of a key if it has not been modified since the index.", Args: UpdateArgs{}, Result: UpdateReturn{}},
+
+	TaskWatch: {Description: "Watch a prefix for changes, streaming the events.", Args: WatchArgs{}, Result: Cookie{}},
+	TaskStop:  {Description: "Stop a watch.", Args: Cookie{}},
+
+	TaskLock:   {Description: "Acquire a lock on a key for the ttl.", Args: LockArgs{}, Result: Cookie{}},
+	TaskRenew:  {Description: "Renew a lock for another ttl.", Args: Cookie{}},
+	TaskUnlock: {Description: "Release a lock.", Args: Cookie{}},
+
+	TaskEphemeralSet:     {Description: "Set a key that is removed unless set again within the ttl.", Args: EphemeralSetArgs{}},
+	TaskEphemeralDestroy: {Description: "Remove an ephemeral key.", Args: EphemeralDestroyArgs{}},
+}
@@ -78,7 +78,7 @@ func (k *KV) watch(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if args.Prefix == "" {
-		return nil, nil, errors.Newv("missing arg: prefix", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: prefix", map[string]interface{}{"args": args})
 	}
 
 	if k.kvDown() {
@@ -91,7 +91,7 @@ func (k *KV) watch(req *acomm.Request) (interface{}, *url.URL, error) {
 	}
 
 	reader := makeEventReader(events, errs)
-	addr, err := k.tracker.NewStreamUnix(k.config.StreamDir("kv-watch"), reader)
+	addr, err := k.tracker.NewStream(reader)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -112,7 +112,7 @@ func (k *KV) stop(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if args.Cookie == 0 {
-		return nil, nil, errors.Newv("missing arg: cookie", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: cookie", map[string]interface{}{"args": args})
 	}
 
 	ch, err := watches.Get(args.Cookie)
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"net/url"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/shirou/gopsutil/host"
+	"golang.org/x/net/context"
+)
+
+// Client makes typed requests to the metrics provider's tasks. Requests go to
+// the coordinator of the acomm client, or on to the node's coordinator url if
+// one is given.
+type Client struct {
+	c *acomm.Client
+}
+
+// NewClient creates a new Client sending requests with the acomm client.
+func NewClient(c *acomm.Client) *Client {
+	return &Client{c: c}
+}
+
+// CPU retrieves information about the CPU hardware, times, and load.
+func (c *Client) CPU(ctx context.Context, node *url.URL) (*CPUResult, error) {
+	var result CPUResult
+	if err := c.c.Call(ctx, TaskCPU, node, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Disk retrieves information about the disk partitions, io, and usage.
+func (c *Client) Disk(ctx context.Context, node *url.URL) (*DiskResult, error) {
+	var result DiskResult
+	if err := c.c.Call(ctx, TaskDisk, node, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Host retrieves information about the host.
+func (c *Client) Host(ctx context.Context, node *url.URL) (*host.InfoStat, error) {
+	var result host.InfoStat
+	if err := c.c.Call(ctx, TaskHost, node, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Memory retrieves information about the virtual and swap memory.
+func (c *Client) Memory(ctx context.Context, node *url.URL) (*MemoryResult, error) {
+	var result MemoryResult
+	if err := c.c.Call(ctx, TaskMemory, node, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Network retrieves information about the network interfaces and io.
+func (c *Client) Network(ctx context.Context, node *url.URL) (*NetworkResult, error) {
+	var result NetworkResult
+	if err := c.c.Call(ctx, TaskNetwork, node, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
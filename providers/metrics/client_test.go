@@ -0,0 +1,69 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/cerana/cerana/pkg/test"
+	metricsp "github.com/cerana/cerana/providers/metrics"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type client struct {
+	suite.Suite
+	coordinator *test.Coordinator
+	metrics     *metricsp.MockMetrics
+	client      *metricsp.Client
+}
+
+func TestClient(t *testing.T) {
+	suite.Run(t, new(client))
+}
+
+func (s *client) SetupSuite() {
+	var err error
+	s.coordinator, err = test.NewCoordinator("")
+	s.Require().NoError(err)
+
+	s.metrics = metricsp.NewMockMetrics()
+	s.coordinator.RegisterProvider(s.metrics)
+	s.Require().NoError(s.coordinator.Start())
+
+	s.client = metricsp.NewClient(s.coordinator.NewClient())
+}
+
+func (s *client) TearDownSuite() {
+	s.coordinator.Stop()
+	s.Require().NoError(s.coordinator.Cleanup())
+}
+
+func (s *client) TestRoundTrip() {
+	ctx := context.Background()
+	data := s.metrics.Data
+
+	cpu, err := s.client.CPU(ctx, nil)
+	if s.NoError(err) {
+		s.Len(cpu.Info, len(data.CPU.Info))
+		s.Equal(data.CPU.Load, cpu.Load)
+	}
+
+	disk, err := s.client.Disk(ctx, nil)
+	if s.NoError(err) {
+		s.Len(disk.Partitions, len(data.Disk.Partitions))
+	}
+
+	host, err := s.client.Host(ctx, nil)
+	if s.NoError(err) {
+		s.Equal(data.Host.Hostname, host.Hostname)
+	}
+
+	memory, err := s.client.Memory(ctx, nil)
+	if s.NoError(err) {
+		s.Equal(data.Memory.Virtual.Total, memory.Virtual.Total)
+	}
+
+	network, err := s.client.Network(ctx, nil)
+	if s.NoError(err) {
+		s.Len(network.Interfaces, len(data.Network.Interfaces))
+	}
+}
@@ -7,9 +7,9 @@ type Metrics struct{}
 
 // RegisterTasks registers all of Metric's task handlers with the server.
 func (m *Metrics) RegisterTasks(server *provider.Server) {
-	server.RegisterTask("metrics-cpu", m.CPU)
-	server.RegisterTask("metrics-disk", m.Disk)
-	server.RegisterTask("metrics-host", m.Host)
-	server.RegisterTask("metrics-memory", m.Memory)
-	server.RegisterTask("metrics-network", m.Network)
+	server.RegisterTask(TaskCPU, m.CPU, taskSchemas[TaskCPU])
+	server.RegisterTask(TaskDisk, m.Disk, taskSchemas[TaskDisk])
+	server.RegisterTask(TaskHost, m.Host, taskSchemas[TaskHost])
+	server.RegisterTask(TaskMemory, m.Memory, taskSchemas[TaskMemory])
+	server.RegisterTask(TaskNetwork, m.Network, taskSchemas[TaskNetwork])
 }
@@ -163,11 +163,11 @@ func NewMockMetrics() *MockMetrics {
 
 // RegisterTasks registes all MockMetric task handlers.
 func (m *MockMetrics) RegisterTasks(server *provider.Server) {
-	server.RegisterTask("metrics-cpu", m.CPU)
-	server.RegisterTask("metrics-disk", m.Disk)
-	server.RegisterTask("metrics-host", m.Host)
-	server.RegisterTask("metrics-memory", m.Memory)
-	server.RegisterTask("metrics-network", m.Network)
+	server.RegisterTask(TaskCPU, m.CPU, taskSchemas[TaskCPU])
+	server.RegisterTask(TaskDisk, m.Disk, taskSchemas[TaskDisk])
+	server.RegisterTask(TaskHost, m.Host, taskSchemas[TaskHost])
+	server.RegisterTask(TaskMemory, m.Memory, taskSchemas[TaskMemory])
+	server.RegisterTask(TaskNetwork, m.Network, taskSchemas[TaskNetwork])
 }
 
 // CPU returns mock CPU information.
@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"github.com/cerana/cerana/provider"
+	"github.com/shirou/gopsutil/host"
+)
+
+// Task names of the metrics provider.
+const (
+	TaskCPU     = "metrics-cpu"
+	TaskDisk    = "metrics-disk"
+	TaskHost    = "metrics-host"
+	TaskMemory  = "metrics-memory"
+	TaskNetwork = "metrics-network"
+)
+
+// taskSchemas describe the metrics tasks.
+var taskSchemas = map[string]provider.TaskSpec{
+	TaskCPU:     {Description: "Retrieve CPU information and usage.", Result: CPUResult{}},
+	TaskDisk:    {Description: "Retrieve disk information and usage.", Result: DiskResult{}},
+	TaskHost:    {Description: "Retrieve host information.", Result: host.InfoStat{}},
+	TaskMemory:  {Description: "Retrieve memory usage.", Result: MemoryResult{}},
+	TaskNetwork: {Description: "Retrieve network interfaces and usage.", Result: NetworkResult{}},
+}
@@ -0,0 +1,25 @@
+package namespace
+
+import (
+	"net/url"
+
+	"github.com/cerana/cerana/acomm"
+	"golang.org/x/net/context"
+)
+
+// Client makes typed requests to the namespace provider's tasks. Requests go
+// to the coordinator of the acomm client, or on to the node's coordinator url
+// if one is given.
+type Client struct {
+	c *acomm.Client
+}
+
+// NewClient creates a new Client sending requests with the acomm client.
+func NewClient(c *acomm.Client) *Client {
+	return &Client{c: c}
+}
+
+// SetUser sets the user and group id mappings of a process.
+func (c *Client) SetUser(ctx context.Context, node *url.URL, args UserArgs) error {
+	return c.c.Call(ctx, TaskSetUser, node, args, nil)
+}
@@ -0,0 +1,50 @@
+package namespace_test
+
+import (
+	"testing"
+
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/test"
+	"github.com/cerana/cerana/providers/namespace"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type client struct {
+	suite.Suite
+	coordinator *test.Coordinator
+	namespace   *namespace.Mock
+	client      *namespace.Client
+}
+
+func TestClient(t *testing.T) {
+	suite.Run(t, new(client))
+}
+
+func (s *client) SetupSuite() {
+	var err error
+	s.coordinator, err = test.NewCoordinator("")
+	s.Require().NoError(err)
+
+	s.namespace = namespace.NewMock()
+	s.coordinator.RegisterProvider(s.namespace)
+	s.Require().NoError(s.coordinator.Start())
+
+	s.client = namespace.NewClient(s.coordinator.NewClient())
+}
+
+func (s *client) TearDownSuite() {
+	s.coordinator.Stop()
+	s.Require().NoError(s.coordinator.Cleanup())
+}
+
+func (s *client) TestRoundTrip() {
+	ctx := context.Background()
+
+	s.NoError(s.client.SetUser(ctx, nil, namespace.UserArgs{PID: 1}))
+
+	s.namespace.Data.SetUserErr = errors.NewWithCode(errors.CodeInvalidArgument, "bad mapping", nil)
+	defer func() { s.namespace.Data.SetUserErr = nil }()
+	err := s.client.SetUser(ctx, nil, namespace.UserArgs{PID: 1})
+	s.True(errors.IsCode(err, errors.CodeInvalidArgument), "should fail with the error code of the provider")
+}
@@ -25,7 +25,7 @@ func NewMock() *Mock {
 
 // RegisterTasks registers all of Mock's task handlers.
 func (n *Mock) RegisterTasks(server *provider.Server) {
-	server.RegisterTask("namespace-set-user", n.SetUser)
+	server.RegisterTask(TaskSetUser, n.SetUser, taskSchemas[TaskSetUser])
 }
 
 // SetUser sets mock uid and gid mappings.
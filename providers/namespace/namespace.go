@@ -21,5 +21,5 @@ func New(config *provider.Config, tracker *acomm.Tracker) *Namespace {
 
 // RegisterTasks registers all of Namespaces's task handlers with the server.
 func (n *Namespace) RegisterTasks(server *provider.Server) {
-	server.RegisterTask("namespace-set-user", n.SetUser)
+	server.RegisterTask(TaskSetUser, n.SetUser, taskSchemas[TaskSetUser])
 }
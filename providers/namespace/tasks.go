@@ -0,0 +1,12 @@
+package namespace
+
+import "github.com/cerana/cerana/provider"
+
+// TaskSetUser is the task name for setting a process's user namespace id
+// mappings.
+const TaskSetUser = "namespace-set-user"
+
+// taskSchemas describe the namespace tasks.
+var taskSchemas = map[string]provider.TaskSpec{
+	TaskSetUser: {Description: "Set the user namespace id mappings of a process.", Args: UserArgs{}},
+}
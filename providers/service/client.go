@@ -0,0 +1,55 @@
+package service
+
+import (
+	"net/url"
+
+	"github.com/cerana/cerana/acomm"
+	"golang.org/x/net/context"
+)
+
+// Client makes typed requests to the service provider's tasks. Requests go to
+// the coordinator of the acomm client, or on to the node's coordinator url if
+// one is given.
+type Client struct {
+	c *acomm.Client
+}
+
+// NewClient creates a new Client sending requests with the acomm client.
+func NewClient(c *acomm.Client) *Client {
+	return &Client{c: c}
+}
+
+// Create creates (or replaces) and starts (or restarts) a service.
+func (c *Client) Create(ctx context.Context, node *url.URL, args CreateArgs) (*Service, error) {
+	var result GetResult
+	if err := c.c.Call(ctx, TaskCreate, node, args, &result); err != nil {
+		return nil, err
+	}
+	return &result.Service, nil
+}
+
+// Get retrieves a service.
+func (c *Client) Get(ctx context.Context, node *url.URL, bundleID uint64, id string) (*Service, error) {
+	var result GetResult
+	if err := c.c.Call(ctx, TaskGet, node, GetArgs{ID: id, BundleID: bundleID}, &result); err != nil {
+		return nil, err
+	}
+	return &result.Service, nil
+}
+
+// List retrieves all services.
+func (c *Client) List(ctx context.Context, node *url.URL) ([]Service, error) {
+	var result ListResult
+	err := c.c.Call(ctx, TaskList, node, nil, &result)
+	return result.Services, err
+}
+
+// Restart restarts a service.
+func (c *Client) Restart(ctx context.Context, node *url.URL, bundleID uint64, id string) error {
+	return c.c.Call(ctx, TaskRestart, node, RestartArgs{ID: id, BundleID: bundleID}, nil)
+}
+
+// Remove stops and removes a service.
+func (c *Client) Remove(ctx context.Context, node *url.URL, bundleID uint64, id string) error {
+	return c.c.Call(ctx, TaskRemove, node, RemoveArgs{ID: id, BundleID: bundleID}, nil)
+}
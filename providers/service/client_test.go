@@ -0,0 +1,40 @@
+package service_test
+
+import (
+	"fmt"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/providers/service"
+	"github.com/cerana/cerana/providers/systemd"
+	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
+)
+
+func (s *Provider) TestClient() {
+	client := service.NewClient(acomm.NewClient(s.tracker, s.config.CoordinatorURL(), s.config.RequestTimeout()))
+	ctx := context.Background()
+
+	id := uuid.New()
+	bundleID := uint64(321)
+	s.systemd.ManualCreate(systemd.CreateArgs{Name: fmt.Sprintf("%d:%s.service", bundleID, id)}, true)
+
+	services, err := client.List(ctx, nil)
+	s.NoError(err)
+	s.Len(services, 1)
+
+	svc, err := client.Get(ctx, nil, bundleID, id)
+	if s.NoError(err) {
+		s.Equal(id, svc.ID)
+		s.Equal(bundleID, svc.BundleID)
+	}
+
+	s.NoError(client.Restart(ctx, nil, bundleID, id))
+	s.NoError(client.Remove(ctx, nil, bundleID, id))
+
+	_, err = client.Get(ctx, nil, bundleID, id)
+	s.Error(err, "should fail for a removed service")
+
+	_, err = client.Get(ctx, nil, bundleID, "")
+	s.True(errors.IsCode(err, errors.CodeInvalidArgument), "should fail with the error code of the provider")
+}
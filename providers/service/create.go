@@ -1,15 +1,19 @@
 package service
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"path/filepath"
 	"strings"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/pkg/errors"
 	"github.com/cerana/cerana/providers/systemd"
+	"github.com/cerana/cerana/workflow"
 	"github.com/coreos/go-systemd/unit"
+	"golang.org/x/net/context"
 )
 
 // CreateArgs contains args for creating or replacing a Service.
@@ -24,7 +28,7 @@ type CreateArgs struct {
 }
 
 // Create creates (or replaces) and starts (or restarts) a service.
-func (p *Provider) Create(req *acomm.Request) (interface{}, *url.URL, error) {
+func (p *Provider) Create(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args CreateArgs
 	if err := req.UnmarshalArgs(&args); err != nil {
 		return nil, nil, err
@@ -33,21 +37,47 @@ func (p *Provider) Create(req *acomm.Request) (interface{}, *url.URL, error) {
 
 	if args.ID == "" {
 		argErrData["missing"] = "id"
-		return nil, nil, errors.Newv("missing arg: id", argErrData)
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: id", argErrData)
 	}
 	if args.BundleID == 0 {
 		argErrData["missing"] = "bundleID"
-		return nil, nil, errors.Newv("missing arg: bundleID", argErrData)
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: bundleID", argErrData)
 	}
 	if len(args.Cmd) == 0 {
 		argErrData["missing"] = "cmd"
-		return nil, nil, errors.Newv("missing arg: cmd", argErrData)
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: cmd", argErrData)
 	}
 	if args.Dataset == "" {
 		argErrData["missing"] = "dataset"
-		return nil, nil, errors.Newv("missing arg: dataset", argErrData)
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: dataset", argErrData)
 	}
 
+	if _, err := p.workflows.Run(ctx, p.createWorkflow(workflowID(req), args, req)); err != nil {
+		return nil, nil, err
+	}
+
+	service, err := p.getService(args.BundleID, args.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return GetResult{*service}, nil, nil
+}
+
+// createWorkflow is the name of the service creation workflow.
+const createWorkflow = "service-create"
+
+func (p *Provider) buildCreateWorkflow(id string, input json.RawMessage) (*workflow.Workflow, error) {
+	var args CreateArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"workflow": id})
+	}
+	return p.createWorkflow(id, args, nil), nil
+}
+
+// createWorkflow creates the workflow to create (or replace) and start (or
+// restart) a service. A new service that fails to start is removed again.
+// Progress is reported to the original request, if there is one.
+func (p *Provider) createWorkflow(id string, args CreateArgs, req *acomm.Request) *workflow.Workflow {
 	name := serviceName(args.BundleID, args.ID)
 	datasetCloneName := filepath.Join(p.config.DatasetCloneDir(), name)
 	unitOptions := []*unit.UnitOption{
@@ -78,74 +108,86 @@ func (p *Provider) Create(req *acomm.Request) (interface{}, *url.URL, error) {
 		})
 	}
 
-	requests, continueChecks, err := p.prepareCreateRequests(name, unitOptions, args.Overwrite)
-	if err != nil {
-		return nil, nil, err
+	// there's only more work to do if the unit was modified
+	unitModified := func(state *workflow.State) (bool, error) {
+		var result systemd.CreateResult
+		if err := state.Result("create", &result); err != nil {
+			return false, err
+		}
+		return result.UnitModified, nil
 	}
 
-	if err = p.executeRequests(requests, continueChecks); err != nil {
-		return nil, nil, err
+	progress := func(step string) func(*workflow.State, *acomm.RequestOptions) error {
+		return func(_ *workflow.State, _ *acomm.RequestOptions) error {
+			if req != nil {
+				sendProgress(req, &acomm.Progress{Step: step})
+			}
+			return nil
+		}
 	}
 
-	service, err := p.getService(args.BundleID, args.ID)
-	if err != nil {
-		return nil, nil, err
+	create := &workflow.Step{
+		Name: "create",
+		Action: workflow.Action{
+			Task: systemd.TaskCreate,
+			Args: systemd.CreateArgs{
+				Name:        name,
+				UnitOptions: unitOptions,
+				Overwrite:   args.Overwrite,
+			},
+			Prepare: progress("creating unit"),
+		},
 	}
-	return GetResult{*service}, nil, nil
-}
-
-func (p *Provider) prepareCreateRequests(name string, unitOptions []*unit.UnitOption, overwrite bool) ([]*acomm.Request, []continueCheck, error) {
-	requests := make([]*acomm.Request, 0, 3)
-	continueChecks := make([]continueCheck, 0, 3)
-
-	req, err := acomm.NewRequest(acomm.RequestOptions{
-		Task:         "systemd-create",
-		ResponseHook: p.tracker.URL(),
-		Args: systemd.CreateArgs{
-			Name:        name,
-			UnitOptions: unitOptions,
-			Overwrite:   overwrite,
+	enable := &workflow.Step{
+		Name:      "enable",
+		DependsOn: []string{"create"},
+		When:      unitModified,
+		Action: workflow.Action{
+			Task:    systemd.TaskEnable,
+			Args:    systemd.EnableArgs{Name: name},
+			Prepare: progress("enabling unit"),
 		},
-	})
-	if err != nil {
-		return nil, nil, err
 	}
-	requests = append(requests, req)
-	// there's only more work to do if the unit was modified
-	continueChecks = append(continueChecks, func(resp *acomm.Response) (bool, error) {
-		var result systemd.CreateResult
-		if err = resp.UnmarshalResult(&result); err != nil {
-			return false, err
-		}
-		return result.UnitModified, nil
-	})
-
-	req, err = acomm.NewRequest(acomm.RequestOptions{
-		Task:         "systemd-enable",
-		ResponseHook: p.tracker.URL(),
-		Args: systemd.EnableArgs{
-			Name: name,
+	restart := &workflow.Step{
+		Name:      "restart",
+		DependsOn: []string{"enable"},
+		When:      unitModified,
+		Action: workflow.Action{
+			Task: systemd.TaskRestart,
+			Args: systemd.ActionArgs{
+				Name: name,
+				Mode: systemd.ModeFail,
+			},
+			Prepare: progress("starting service"),
 		},
-	})
-	if err != nil {
-		return nil, nil, err
 	}
-	requests = append(requests, req)
-	continueChecks = append(continueChecks, nil)
+	// A replaced unit can't be restored, so only undo new services
+	if !args.Overwrite {
+		create.Compensate = &workflow.Action{
+			Task: systemd.TaskRemove,
+			Args: systemd.RemoveArgs{Name: name},
+		}
+		enable.Compensate = &workflow.Action{
+			Task: systemd.TaskDisable,
+			Args: systemd.DisableArgs{Name: name},
+		}
+	}
 
-	req, err = acomm.NewRequest(acomm.RequestOptions{
-		Task:         "systemd-restart",
-		ResponseHook: p.tracker.URL(),
-		Args: systemd.ActionArgs{
-			Name: name,
-			Mode: systemd.ModeFail,
-		},
-	})
-	if err != nil {
-		return nil, nil, err
+	return &workflow.Workflow{
+		ID:    id,
+		Name:  createWorkflow,
+		Input: args,
+		Steps: []*workflow.Step{create, enable, restart},
 	}
-	requests = append(requests, req)
-	continueChecks = append(continueChecks, nil)
+}
 
-	return requests, continueChecks, nil
+// sendProgress sends progress for a request, logging rather than failing on
+// errors since progress is informational.
+func sendProgress(req *acomm.Request, progress *acomm.Progress) {
+	if err := req.SendProgress(progress); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error":     err,
+			"requestID": req.ID,
+		}).Warn("failed to send progress")
+	}
 }
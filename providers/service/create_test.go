@@ -7,6 +7,7 @@ import (
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/providers/service"
 	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
 )
 
 func (s *Provider) TestCreate() {
@@ -47,7 +48,7 @@ func (s *Provider) TestCreate() {
 		})
 		s.Require().NoError(err, desc)
 
-		result, streamURL, err := s.provider.Create(req)
+		result, streamURL, err := s.provider.Create(context.Background(), req)
 		s.Nil(streamURL, desc)
 		if test.err != "" {
 			s.EqualError(err, test.err, desc)
@@ -44,10 +44,10 @@ func (p *Provider) Get(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if args.ID == "" {
-		return nil, nil, errors.Newv("missing arg: id", map[string]interface{}{"args": args, "missing": "id"})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: id", map[string]interface{}{"args": args, "missing": "id"})
 	}
 	if args.BundleID == 0 {
-		return nil, nil, errors.Newv("missing arg: bundleID", map[string]interface{}{"args": args, "missing": "bundleID"})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: bundleID", map[string]interface{}{"args": args, "missing": "bundleID"})
 	}
 
 	service, err := p.getService(args.BundleID, args.ID)
@@ -67,7 +67,7 @@ func (p *Provider) getService(bundleID uint64, id string) (*Service, error) {
 		ch <- resp
 	}
 	req, err := acomm.NewRequest(acomm.RequestOptions{
-		Task:         "systemd-get",
+		Task:         systemd.TaskGet,
 		ResponseHook: p.tracker.URL(),
 		Args: systemd.GetArgs{
 			Name: name,
@@ -21,7 +21,7 @@ func (p *Provider) List(req *acomm.Request) (interface{}, *url.URL, error) {
 		ch <- resp
 	}
 	req, err := acomm.NewRequest(acomm.RequestOptions{
-		Task:           "systemd-list",
+		Task:           systemd.TaskList,
 		ResponseHook:   p.tracker.URL(),
 		SuccessHandler: rh,
 		ErrorHandler:   rh,
@@ -31,11 +31,11 @@ func NewMock() *Mock {
 
 // RegisterTasks registers all of the mock provider task handlers with the server.
 func (m *Mock) RegisterTasks(server *provider.Server) {
-	server.RegisterTask("service-create", m.Create)
-	server.RegisterTask("service-get", m.Get)
-	server.RegisterTask("service-list", m.List)
-	server.RegisterTask("service-restart", m.Restart)
-	server.RegisterTask("service-remove", m.Remove)
+	server.RegisterTask(TaskCreate, m.Create, taskSchemas[TaskCreate])
+	server.RegisterTask(TaskGet, m.Get, taskSchemas[TaskGet])
+	server.RegisterTask(TaskList, m.List, taskSchemas[TaskList])
+	server.RegisterTask(TaskRestart, m.Restart, taskSchemas[TaskRestart])
+	server.RegisterTask(TaskRemove, m.Remove, taskSchemas[TaskRemove])
 }
 
 // Create creates a new mock service.
@@ -1,11 +1,14 @@
 package service
 
 import (
+	"encoding/json"
 	"net/url"
 
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/pkg/errors"
 	"github.com/cerana/cerana/providers/systemd"
+	"github.com/cerana/cerana/workflow"
+	"golang.org/x/net/context"
 )
 
 // RemoveArgs are arguments for the Remove task.
@@ -15,64 +18,79 @@ type RemoveArgs struct {
 }
 
 // Remove removes a service from the node.
-func (p *Provider) Remove(req *acomm.Request) (interface{}, *url.URL, error) {
+func (p *Provider) Remove(ctx context.Context, req *acomm.Request) (interface{}, *url.URL, error) {
 	var args RemoveArgs
 	if err := req.UnmarshalArgs(&args); err != nil {
 		return nil, nil, err
 	}
 	if args.ID == "" {
-		return nil, nil, errors.Newv("missing arg: id", map[string]interface{}{"args": args, "missing": "id"})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: id", map[string]interface{}{"args": args, "missing": "id"})
 	}
 	if args.BundleID == 0 {
-		return nil, nil, errors.Newv("missing arg: bundleID", map[string]interface{}{"args": args, "missing": "bundleID"})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: bundleID", map[string]interface{}{"args": args, "missing": "bundleID"})
 	}
 
-	name := serviceName(args.BundleID, args.ID)
-	requests, err := p.prepareRemoveRequests(name)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	return nil, nil, p.executeRequests(requests, nil)
+	_, err := p.workflows.Run(ctx, p.removeWorkflow(workflowID(req), args))
+	return nil, nil, err
 }
 
-func (p *Provider) prepareRemoveRequests(name string) ([]*acomm.Request, error) {
-	requests := make([]*acomm.Request, 0, 3)
-	req, err := acomm.NewRequest(acomm.RequestOptions{
-		Task:         "systemd-stop",
-		ResponseHook: p.tracker.URL(),
-		Args: systemd.ActionArgs{
-			Name: name,
-			Mode: systemd.ModeFail,
-		},
-	})
-	if err != nil {
-		return nil, err
-	}
-	requests = append(requests, req)
+// removeWorkflow is the name of the service removal workflow.
+const removeWorkflow = "service-remove"
 
-	req, err = acomm.NewRequest(acomm.RequestOptions{
-		Task:         "systemd-disable",
-		ResponseHook: p.tracker.URL(),
-		Args: systemd.DisableArgs{
-			Name: name,
-		},
-	})
-	if err != nil {
-		return nil, err
+func (p *Provider) buildRemoveWorkflow(id string, input json.RawMessage) (*workflow.Workflow, error) {
+	var args RemoveArgs
+	if err := json.Unmarshal(input, &args); err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"workflow": id})
 	}
-	requests = append(requests, req)
+	return p.removeWorkflow(id, args), nil
+}
 
-	req, err = acomm.NewRequest(acomm.RequestOptions{
-		Task:         "systemd-remove",
-		ResponseHook: p.tracker.URL(),
-		Args: systemd.ActionArgs{
-			Name: name,
+// removeWorkflow creates the workflow to stop, disable, and remove a service.
+// If a step fails, the service is enabled and started again.
+func (p *Provider) removeWorkflow(id string, args RemoveArgs) *workflow.Workflow {
+	name := serviceName(args.BundleID, args.ID)
+	return &workflow.Workflow{
+		ID:    id,
+		Name:  removeWorkflow,
+		Input: args,
+		Steps: []*workflow.Step{
+			{
+				Name: "stop",
+				Action: workflow.Action{
+					Task: systemd.TaskStop,
+					Args: systemd.ActionArgs{
+						Name: name,
+						Mode: systemd.ModeFail,
+					},
+				},
+				Compensate: &workflow.Action{
+					Task: systemd.TaskStart,
+					Args: systemd.ActionArgs{
+						Name: name,
+						Mode: systemd.ModeFail,
+					},
+				},
+			},
+			{
+				Name:      "disable",
+				DependsOn: []string{"stop"},
+				Action: workflow.Action{
+					Task: systemd.TaskDisable,
+					Args: systemd.DisableArgs{Name: name},
+				},
+				Compensate: &workflow.Action{
+					Task: systemd.TaskEnable,
+					Args: systemd.EnableArgs{Name: name},
+				},
+			},
+			{
+				Name:      "remove",
+				DependsOn: []string{"disable"},
+				Action: workflow.Action{
+					Task: systemd.TaskRemove,
+					Args: systemd.RemoveArgs{Name: name},
+				},
+			},
 		},
-	})
-	if err != nil {
-		return nil, err
 	}
-	requests = append(requests, req)
-	return requests, nil
 }
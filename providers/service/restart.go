@@ -21,10 +21,10 @@ func (p *Provider) Restart(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if args.ID == "" {
-		return nil, nil, errors.Newv("missing arg: id", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: id", map[string]interface{}{"args": args})
 	}
 	if args.BundleID == 0 {
-		return nil, nil, errors.Newv("missing arg: bundleID", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: bundleID", map[string]interface{}{"args": args})
 	}
 
 	ch := make(chan *acomm.Response, 1)
@@ -32,7 +32,7 @@ func (p *Provider) Restart(req *acomm.Request) (interface{}, *url.URL, error) {
 		ch <- resp
 	}
 	req, err := acomm.NewRequest(acomm.RequestOptions{
-		Task:         "systemd-restart",
+		Task:         systemd.TaskRestart,
 		ResponseHook: p.tracker.URL(),
 		Args: systemd.ActionArgs{
 			Name: serviceName(args.BundleID, args.ID),
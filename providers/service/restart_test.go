@@ -7,6 +7,7 @@ import (
 	"github.com/cerana/cerana/providers/service"
 	"github.com/cerana/cerana/providers/systemd"
 	"github.com/pborman/uuid"
+	"golang.org/x/net/context"
 )
 
 func (s *Provider) TestRestart() {
@@ -23,7 +24,7 @@ func (s *Provider) TestRestart() {
 		},
 	})
 
-	result, streamURL, err := s.provider.Remove(req)
+	result, streamURL, err := s.provider.Remove(context.Background(), req)
 	s.Nil(result)
 	s.Nil(streamURL)
 	s.NoError(err)
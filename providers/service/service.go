@@ -1,70 +1,63 @@
 package service
 
 import (
+	"os"
+	"path"
+
+	"github.com/Sirupsen/logrus"
 	"github.com/cerana/cerana/acomm"
-	"github.com/cerana/cerana/pkg/errors"
 	"github.com/cerana/cerana/provider"
+	"github.com/cerana/cerana/workflow"
+	"golang.org/x/net/context"
 )
 
-type continueCheck func(*acomm.Response) (bool, error)
-
 // Provider is a provider of service management functionality.
 type Provider struct {
-	config  *Config
-	tracker *acomm.Tracker
+	config    *Config
+	tracker   *acomm.Tracker
+	workflows *workflow.Engine
 }
 
 // New creates a new instance of Provider.
 func New(config *Config, tracker *acomm.Tracker) *Provider {
-	return &Provider{
+	p := &Provider{
 		config:  config,
 		tracker: tracker,
 	}
+
+	// Workflows run systemd tasks on this node, so only this node should
+	// resume them
+	hostname, err := os.Hostname()
+	if err != nil {
+		logrus.WithField("error", err).Warn("failed to get hostname for workflow state")
+	}
+	store := workflow.NewKVStore(tracker, config.CoordinatorURL(), config.RequestTimeout(), path.Join("workflows", "service", hostname))
+	p.workflows = workflow.NewEngine(tracker, config.CoordinatorURL(), config.RequestTimeout(), store)
+	p.workflows.Register(createWorkflow, p.buildCreateWorkflow)
+	p.workflows.Register(removeWorkflow, p.buildRemoveWorkflow)
+	return p
 }
 
 // RegisterTasks registers all of the provider task handlers with the server.
 func (p *Provider) RegisterTasks(server *provider.Server) {
-	server.RegisterTask("service-create", p.Create)
-	server.RegisterTask("service-get", p.Get)
-	server.RegisterTask("service-list", p.List)
-	server.RegisterTask("service-restart", p.Restart)
-	server.RegisterTask("service-remove", p.Remove)
+	server.RegisterContextTask(TaskCreate, p.Create, taskSchemas[TaskCreate])
+	server.RegisterTask(TaskGet, p.Get, taskSchemas[TaskGet])
+	server.RegisterTask(TaskList, p.List, taskSchemas[TaskList])
+	server.RegisterTask(TaskRestart, p.Restart, taskSchemas[TaskRestart])
+	server.RegisterContextTask(TaskRemove, p.Remove, taskSchemas[TaskRemove])
 }
 
-func (p *Provider) executeRequests(requests []*acomm.Request, continueChecks []continueCheck) error {
-	if continueChecks == nil {
-		continueChecks = make([]continueCheck, len(requests))
-	}
-	for i, req := range requests {
-		doneChan := make(chan *acomm.Response, 1)
-		defer close(doneChan)
-		rh := func(req *acomm.Request, resp *acomm.Response) {
-			doneChan <- resp
-		}
-		req.SuccessHandler = rh
-		req.ErrorHandler = rh
-
-		if err := p.tracker.TrackRequest(req, p.config.RequestTimeout()); err != nil {
-			return err
-		}
-		if err := acomm.Send(p.config.CoordinatorURL(), req); err != nil {
-			return err
-		}
-
-		resp := <-doneChan
-		if resp.Error != nil {
-			return errors.ResetStack(resp.Error)
-		}
+// ResumeWorkflows finishes service creations and removals interrupted by a
+// restart of the provider, blocking until they are done.
+func (p *Provider) ResumeWorkflows() error {
+	return p.workflows.Resume(context.Background())
+}
 
-		if check := continueChecks[i]; check != nil {
-			next, err := check(resp)
-			if err != nil {
-				return err
-			}
-			if !next {
-				return nil
-			}
-		}
+// workflowID returns the workflow id for a request. Retries of a request share
+// an idempotency key, so they resume the same workflow.
+func workflowID(req *acomm.Request) string {
+	if req.IdempotencyKey != "" {
+		return req.IdempotencyKey
 	}
-	return nil
+	return req.ID
 }
@@ -58,6 +58,7 @@ func (s *Provider) SetupSuite() {
 
 	s.systemd = systemd.NewMockSystemd()
 	s.coordinator.RegisterProvider(s.systemd)
+	s.coordinator.RegisterProvider(s.provider)
 
 	s.Require().NoError(s.coordinator.Start())
 }
@@ -0,0 +1,21 @@
+package service
+
+import "github.com/cerana/cerana/provider"
+
+// Task names of the service provider.
+const (
+	TaskCreate  = "service-create"
+	TaskGet     = "service-get"
+	TaskList    = "service-list"
+	TaskRestart = "service-restart"
+	TaskRemove  = "service-remove"
+)
+
+// taskSchemas describe the service tasks.
+var taskSchemas = map[string]provider.TaskSpec{
+	TaskCreate:  {Description: "Create and start a service.", Args: CreateArgs{}, Result: GetResult{}},
+	TaskGet:     {Description: "Retrieve a service.", Args: GetArgs{}, Result: GetResult{}},
+	TaskList:    {Description: "Retrieve all services.", Result: ListResult{}},
+	TaskRestart: {Description: "Restart a service.", Args: RestartArgs{}},
+	TaskRemove:  {Description: "Stop and remove a service.", Args: RemoveArgs{}},
+}
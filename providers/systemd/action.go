@@ -36,7 +36,7 @@ func (s *Systemd) systemdAction(action string, req *acomm.Request) (interface{},
 		return nil, nil, err
 	}
 	if args.Name == "" {
-		return nil, nil, errors.Newv("missing arg: name", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: name", map[string]interface{}{"args": args})
 	}
 
 	var actionFn func(string, string, chan<- string) (int, error)
@@ -53,7 +53,7 @@ func (s *Systemd) systemdAction(action string, req *acomm.Request) (interface{},
 	// job is completed, the jobid is meaningless.
 	if _, err := actionFn(args.Name, args.Mode, nil); err != nil {
 		if strings.Contains(err.Error(), "No such file or directory") {
-			err = errors.Newv("unit not found", map[string]interface{}{"name": args.Name})
+			err = errors.NewWithCode(errors.CodeNotFound, "unit not found", map[string]interface{}{"name": args.Name})
 		}
 		return nil, nil, errors.Wrapv(err, map[string]interface{}{"name": args.Name, "mode": args.Mode, "action": action})
 	}
@@ -0,0 +1,73 @@
+package systemd
+
+import (
+	"net/url"
+
+	"github.com/cerana/cerana/acomm"
+	"golang.org/x/net/context"
+)
+
+// Client makes typed requests to the systemd provider's tasks. Requests go to
+// the coordinator of the acomm client, or on to the node's coordinator url if
+// one is given.
+type Client struct {
+	c *acomm.Client
+}
+
+// NewClient creates a new Client sending requests with the acomm client.
+func NewClient(c *acomm.Client) *Client {
+	return &Client{c: c}
+}
+
+// Create creates or overwrites a unit file, returning whether it was modified.
+func (c *Client) Create(ctx context.Context, node *url.URL, args CreateArgs) (bool, error) {
+	var result CreateResult
+	err := c.c.Call(ctx, TaskCreate, node, args, &result)
+	return result.UnitModified, err
+}
+
+// Disable disables a unit.
+func (c *Client) Disable(ctx context.Context, node *url.URL, args DisableArgs) error {
+	return c.c.Call(ctx, TaskDisable, node, args, nil)
+}
+
+// Enable enables a unit.
+func (c *Client) Enable(ctx context.Context, node *url.URL, args EnableArgs) error {
+	return c.c.Call(ctx, TaskEnable, node, args, nil)
+}
+
+// Get retrieves the status of a unit.
+func (c *Client) Get(ctx context.Context, node *url.URL, name string) (*UnitStatus, error) {
+	var result GetResult
+	if err := c.c.Call(ctx, TaskGet, node, GetArgs{Name: name}, &result); err != nil {
+		return nil, err
+	}
+	return &result.Unit, nil
+}
+
+// List retrieves the statuses of all units.
+func (c *Client) List(ctx context.Context, node *url.URL) ([]UnitStatus, error) {
+	var result ListResult
+	err := c.c.Call(ctx, TaskList, node, nil, &result)
+	return result.Units, err
+}
+
+// Remove removes a unit file.
+func (c *Client) Remove(ctx context.Context, node *url.URL, name string) error {
+	return c.c.Call(ctx, TaskRemove, node, RemoveArgs{Name: name}, nil)
+}
+
+// Restart restarts a unit.
+func (c *Client) Restart(ctx context.Context, node *url.URL, args ActionArgs) error {
+	return c.c.Call(ctx, TaskRestart, node, args, nil)
+}
+
+// Start starts a unit.
+func (c *Client) Start(ctx context.Context, node *url.URL, args ActionArgs) error {
+	return c.c.Call(ctx, TaskStart, node, args, nil)
+}
+
+// Stop stops a unit.
+func (c *Client) Stop(ctx context.Context, node *url.URL, args ActionArgs) error {
+	return c.c.Call(ctx, TaskStop, node, args, nil)
+}
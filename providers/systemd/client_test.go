@@ -0,0 +1,70 @@
+package systemd_test
+
+import (
+	"testing"
+
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/test"
+	systemdp "github.com/cerana/cerana/providers/systemd"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type client struct {
+	suite.Suite
+	coordinator *test.Coordinator
+	systemd     *systemdp.MockSystemd
+	client      *systemdp.Client
+}
+
+func TestClient(t *testing.T) {
+	suite.Run(t, new(client))
+}
+
+func (s *client) SetupSuite() {
+	var err error
+	s.coordinator, err = test.NewCoordinator("")
+	s.Require().NoError(err)
+
+	s.systemd = systemdp.NewMockSystemd()
+	s.coordinator.RegisterProvider(s.systemd)
+	s.Require().NoError(s.coordinator.Start())
+
+	s.client = systemdp.NewClient(s.coordinator.NewClient())
+}
+
+func (s *client) TearDownSuite() {
+	s.coordinator.Stop()
+	s.Require().NoError(s.coordinator.Cleanup())
+}
+
+func (s *client) TestRoundTrip() {
+	ctx := context.Background()
+	name := "client-test.service"
+
+	modified, err := s.client.Create(ctx, nil, systemdp.CreateArgs{Name: name})
+	s.NoError(err)
+	s.True(modified)
+
+	s.NoError(s.client.Enable(ctx, nil, systemdp.EnableArgs{Name: name}))
+	status, err := s.client.Get(ctx, nil, name)
+	if s.NoError(err) {
+		s.Equal(name, status.Name)
+	}
+	units, err := s.client.List(ctx, nil)
+	s.NoError(err)
+	s.Len(units, 1)
+
+	s.NoError(s.client.Start(ctx, nil, systemdp.ActionArgs{Name: name}))
+	s.NoError(s.client.Restart(ctx, nil, systemdp.ActionArgs{Name: name}))
+	s.NoError(s.client.Stop(ctx, nil, systemdp.ActionArgs{Name: name}))
+	s.NoError(s.client.Disable(ctx, nil, systemdp.DisableArgs{Name: name}))
+
+	err = s.client.Start(ctx, nil, systemdp.ActionArgs{Name: name})
+	s.True(errors.IsCode(err, errors.CodeNotFound), "should fail with the error code of the provider")
+
+	s.NoError(s.client.Remove(ctx, nil, name))
+	units, err = s.client.List(ctx, nil)
+	s.NoError(err)
+	s.Len(units, 0)
+}
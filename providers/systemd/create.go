@@ -30,7 +30,7 @@ func (s *Systemd) Create(req *acomm.Request) (interface{}, *url.URL, error) {
 	}
 
 	if args.Name == "" {
-		return nil, nil, errors.Newv("missing arg: name", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: name", map[string]interface{}{"args": args})
 	}
 
 	unitFileContents, err := ioutil.ReadAll(unit.Serialize(args.UnitOptions))
@@ -45,7 +45,7 @@ func (s *Systemd) Create(req *acomm.Request) (interface{}, *url.URL, error) {
 
 	if _, err = os.Stat(unitFilePath); err == nil {
 		if !args.Overwrite {
-			return nil, nil, errors.Newv("unit file already exists", map[string]interface{}{"path": unitFilePath})
+			return nil, nil, errors.NewWithCode(errors.CodeAlreadyExists, "unit file already exists", map[string]interface{}{"path": unitFilePath})
 		}
 
 		// check if modifications exist to avoid unnecessary work
@@ -20,7 +20,7 @@ func (s *Systemd) Disable(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if args.Name == "" {
-		return nil, nil, errors.Newv("missing arg: name", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: name", map[string]interface{}{"args": args})
 	}
 
 	_, err := s.dconn.DisableUnitFiles([]string{args.Name}, args.Runtime)
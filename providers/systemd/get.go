@@ -36,7 +36,7 @@ func (s *Systemd) Get(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, err
 	}
 	if args.Name == "" {
-		return nil, nil, errors.Newv("missing arg: name", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: name", map[string]interface{}{"args": args})
 	}
 
 	list, err := s.dconn.ListUnits()
@@ -46,7 +46,7 @@ func (s *Systemd) Get(req *acomm.Request) (interface{}, *url.URL, error) {
 
 	// Try to find the requested unit in the list
 	var res *GetResult
-	err = errors.Newv("unit not found", map[string]interface{}{"name": args.Name})
+	err = errors.NewWithCode(errors.CodeNotFound, "unit not found", map[string]interface{}{"name": args.Name})
 	for _, unit := range list {
 		if unit.Name == args.Name {
 			err = nil
@@ -36,15 +36,15 @@ func NewMockSystemd() *MockSystemd {
 
 // RegisterTasks registers the MockSystemd tasks.
 func (s *MockSystemd) RegisterTasks(server *provider.Server) {
-	server.RegisterTask("systemd-create", s.Create)
-	server.RegisterTask("systemd-disable", s.Disable)
-	server.RegisterTask("systemd-enable", s.Enable)
-	server.RegisterTask("systemd-get", s.Get)
-	server.RegisterTask("systemd-list", s.List)
-	server.RegisterTask("systemd-remove", s.Remove)
-	server.RegisterTask("systemd-restart", s.Restart)
-	server.RegisterTask("systemd-start", s.Start)
-	server.RegisterTask("systemd-stop", s.Stop)
+	server.RegisterTask(TaskCreate, s.Create, taskSchemas[TaskCreate])
+	server.RegisterTask(TaskDisable, s.Disable, taskSchemas[TaskDisable])
+	server.RegisterTask(TaskEnable, s.Enable, taskSchemas[TaskEnable])
+	server.RegisterTask(TaskGet, s.Get, taskSchemas[TaskGet])
+	server.RegisterTask(TaskList, s.List, taskSchemas[TaskList])
+	server.RegisterTask(TaskRemove, s.Remove, taskSchemas[TaskRemove])
+	server.RegisterTask(TaskRestart, s.Restart, taskSchemas[TaskRestart])
+	server.RegisterTask(TaskStart, s.Start, taskSchemas[TaskStart])
+	server.RegisterTask(TaskStop, s.Stop, taskSchemas[TaskStop])
 }
 
 // Create creates a mock unit file.
@@ -60,7 +60,7 @@ func (s *MockSystemd) Create(req *acomm.Request) (interface{}, *url.URL, error)
 
 	if u, ok := s.Data.UnitFiles[args.Name]; ok {
 		if !args.Overwrite {
-			return nil, nil, errors.New("unit file already exists")
+			return nil, nil, errors.NewWithCode(errors.CodeAlreadyExists, "unit file already exists", nil)
 		}
 		unitFileContents, err := ioutil.ReadAll(unit.Serialize(args.UnitOptions))
 		if err != nil {
@@ -166,7 +166,7 @@ func (s *MockSystemd) action(req *acomm.Request) (interface{}, *url.URL, error)
 	}
 
 	if _, ok := s.Data.Statuses[args.Name]; !ok {
-		return nil, nil, errors.New("unit not found")
+		return nil, nil, errors.NewWithCode(errors.CodeNotFound, "unit not found", nil)
 	}
 	return nil, nil, nil
 }
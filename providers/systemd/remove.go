@@ -21,7 +21,7 @@ func (s *Systemd) Remove(req *acomm.Request) (interface{}, *url.URL, error) {
 	}
 
 	if args.Name == "" {
-		return nil, nil, errors.Newv("missing arg: name", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: name", map[string]interface{}{"args": args})
 	}
 
 	unitFilePath, err := s.config.UnitFilePath(args.Name)
@@ -35,13 +35,13 @@ func New(config *Config) (*Systemd, error) {
 
 // RegisterTasks registers all of Systemd's task handlers with the server.
 func (s *Systemd) RegisterTasks(server *provider.Server) {
-	server.RegisterTask("systemd-create", s.Create)
-	server.RegisterTask("systemd-disable", s.Disable)
-	server.RegisterTask("systemd-enable", s.Enable)
-	server.RegisterTask("systemd-get", s.Get)
-	server.RegisterTask("systemd-list", s.List)
-	server.RegisterTask("systemd-remove", s.Remove)
-	server.RegisterTask("systemd-restart", s.Restart)
-	server.RegisterTask("systemd-start", s.Start)
-	server.RegisterTask("systemd-stop", s.Stop)
+	server.RegisterTask(TaskCreate, s.Create, taskSchemas[TaskCreate])
+	server.RegisterTask(TaskDisable, s.Disable, taskSchemas[TaskDisable])
+	server.RegisterTask(TaskEnable, s.Enable, taskSchemas[TaskEnable])
+	server.RegisterTask(TaskGet, s.Get, taskSchemas[TaskGet])
+	server.RegisterTask(TaskList, s.List, taskSchemas[TaskList])
+	server.RegisterTask(TaskRemove, s.Remove, taskSchemas[TaskRemove])
+	server.RegisterTask(TaskRestart, s.Restart, taskSchemas[TaskRestart])
+	server.RegisterTask(TaskStart, s.Start, taskSchemas[TaskStart])
+	server.RegisterTask(TaskStop, s.Stop, taskSchemas[TaskStop])
 }
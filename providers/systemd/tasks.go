@@ -0,0 +1,29 @@
+package systemd
+
+import "github.com/cerana/cerana/provider"
+
+// Task names of the systemd provider.
+const (
+	TaskCreate  = "systemd-create"
+	TaskDisable = "systemd-disable"
+	TaskEnable  = "systemd-enable"
+	TaskGet     = "systemd-get"
+	TaskList    = "systemd-list"
+	TaskRemove  = "systemd-remove"
+	TaskRestart = "systemd-restart"
+	TaskStart   = "systemd-start"
+	TaskStop    = "systemd-stop"
+)
+
+// taskSchemas describe the systemd tasks.
+var taskSchemas = map[string]provider.TaskSpec{
+	TaskCreate:  {Description: "Create a unit file.", Args: CreateArgs{}, Result: CreateResult{}},
+	TaskDisable: {Description: "Disable a unit.", Args: DisableArgs{}},
+	TaskEnable:  {Description: "Enable a unit.", Args: EnableArgs{}},
+	TaskGet:     {Description: "Retrieve the status of a unit.", Args: GetArgs{}, Result: GetResult{}},
+	TaskList:    {Description: "Retrieve the status of all units.", Result: ListResult{}},
+	TaskRemove:  {Description: "Remove a unit file.", Args: RemoveArgs{}},
+	TaskRestart: {Description: "Restart a unit.", Args: ActionArgs{}},
+	TaskStart:   {Description: "Start a unit.", Args: ActionArgs{}},
+	TaskStop:    {Description: "Stop a unit.", Args: ActionArgs{}},
+}
@@ -0,0 +1,116 @@
+package zfs
+
+import (
+	"net/url"
+
+	"github.com/cerana/cerana/acomm"
+	"golang.org/x/net/context"
+)
+
+// Client makes typed requests to the zfs provider's tasks. Requests go to the
+// coordinator of the acomm client, or on to the node's coordinator url if one
+// is given.
+type Client struct {
+	c *acomm.Client
+}
+
+// NewClient creates a new Client sending requests with the acomm client.
+func NewClient(c *acomm.Client) *Client {
+	return &Client{c: c}
+}
+
+// Clone creates a clone from a snapshot.
+func (c *Client) Clone(ctx context.Context, node *url.URL, args CloneArgs) (*Dataset, error) {
+	var result DatasetResult
+	err := c.c.Call(ctx, TaskClone, node, args, &result)
+	return result.Dataset, err
+}
+
+// Create creates a new filesystem or volume.
+func (c *Client) Create(ctx context.Context, node *url.URL, args CreateArgs) (*Dataset, error) {
+	var result DatasetResult
+	err := c.c.Call(ctx, TaskCreate, node, args, &result)
+	return result.Dataset, err
+}
+
+// Destroy destroys a dataset.
+func (c *Client) Destroy(ctx context.Context, node *url.URL, args DestroyArgs) error {
+	return c.c.Call(ctx, TaskDestroy, node, args, nil)
+}
+
+// Exists determines whether a dataset exists.
+func (c *Client) Exists(ctx context.Context, node *url.URL, name string) (bool, error) {
+	var result ExistsResult
+	err := c.c.Call(ctx, TaskExists, node, CommonArgs{Name: name}, &result)
+	return result.Exists, err
+}
+
+// Get retrieves a dataset.
+func (c *Client) Get(ctx context.Context, node *url.URL, name string) (*Dataset, error) {
+	var result DatasetResult
+	err := c.c.Call(ctx, TaskGet, node, CommonArgs{Name: name}, &result)
+	return result.Dataset, err
+}
+
+// Holds retrieves the user holds on a snapshot.
+func (c *Client) Holds(ctx context.Context, node *url.URL, name string) ([]string, error) {
+	var result HoldsResult
+	err := c.c.Call(ctx, TaskHolds, node, CommonArgs{Name: name}, &result)
+	return result.Holds, err
+}
+
+// List retrieves datasets.
+func (c *Client) List(ctx context.Context, node *url.URL, args ListArgs) ([]*Dataset, error) {
+	var result ListResult
+	err := c.c.Call(ctx, TaskList, node, args, &result)
+	return result.Datasets, err
+}
+
+// Mount mounts a filesystem.
+func (c *Client) Mount(ctx context.Context, node *url.URL, args MountArgs) error {
+	return c.c.Call(ctx, TaskMount, node, args, nil)
+}
+
+// Receive creates a dataset or snapshot from the zfs stream at the stream url.
+func (c *Client) Receive(ctx context.Context, node *url.URL, name string, stream *url.URL) error {
+	_, err := c.c.Do(ctx, acomm.RequestOptions{
+		Task:      TaskReceive,
+		TaskURL:   node,
+		StreamURL: stream,
+		Args:      CommonArgs{Name: name},
+	}, nil)
+	return err
+}
+
+// Rename renames a dataset.
+func (c *Client) Rename(ctx context.Context, node *url.URL, args RenameArgs) error {
+	return c.c.Call(ctx, TaskRename, node, args, nil)
+}
+
+// Rollback rolls a filesystem or volume back to a snapshot.
+func (c *Client) Rollback(ctx context.Context, node *url.URL, args RollbackArgs) error {
+	return c.c.Call(ctx, TaskRollback, node, args, nil)
+}
+
+// Send returns the url of a zfs stream of a snapshot.
+func (c *Client) Send(ctx context.Context, node *url.URL, name string) (*url.URL, error) {
+	resp, err := c.c.Do(ctx, acomm.RequestOptions{
+		Task:    TaskSend,
+		TaskURL: node,
+		Args:    CommonArgs{Name: name},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.StreamURL, nil
+}
+
+// Snapshot creates a snapshot of a filesystem or volume.
+func (c *Client) Snapshot(ctx context.Context, node *url.URL, args SnapshotArgs) error {
+	return c.c.Call(ctx, TaskSnapshot, node, args, nil)
+}
+
+// Unmount unmounts a filesystem.
+func (c *Client) Unmount(ctx context.Context, node *url.URL, args UnmountArgs) error {
+	return c.c.Call(ctx, TaskUnmount, node, args, nil)
+}
@@ -0,0 +1,84 @@
+package zfs_test
+
+import (
+	"testing"
+
+	"github.com/cerana/cerana/pkg/test"
+	"github.com/cerana/cerana/provider"
+	zfsp "github.com/cerana/cerana/providers/zfs"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type client struct {
+	suite.Suite
+	coordinator *test.Coordinator
+	zfs         *zfsp.MockZFS
+	client      *zfsp.Client
+}
+
+func TestClient(t *testing.T) {
+	suite.Run(t, new(client))
+}
+
+func (s *client) SetupSuite() {
+	var err error
+	s.coordinator, err = test.NewCoordinator("")
+	s.Require().NoError(err)
+
+	flagset := pflag.NewFlagSet("zfs", pflag.PanicOnError)
+	config := provider.NewConfig(flagset, s.coordinator.NewProviderViper())
+	s.Require().NoError(flagset.Parse([]string{}))
+	s.Require().NoError(config.LoadConfig())
+
+	s.zfs = zfsp.NewMockZFS(config, s.coordinator.ProviderTracker())
+	s.coordinator.RegisterProvider(s.zfs)
+	s.Require().NoError(s.coordinator.Start())
+
+	s.client = zfsp.NewClient(s.coordinator.NewClient())
+}
+
+func (s *client) TearDownSuite() {
+	s.coordinator.Stop()
+	s.Require().NoError(s.coordinator.Cleanup())
+}
+
+func (s *client) TestRoundTrip() {
+	ctx := context.Background()
+	name := "pool/client-test"
+
+	dataset, err := s.client.Create(ctx, nil, zfsp.CreateArgs{Name: name, Type: "filesystem"})
+	s.Require().NoError(err)
+	s.Equal(name, dataset.Name)
+
+	exists, err := s.client.Exists(ctx, nil, name)
+	s.NoError(err)
+	s.True(exists)
+	dataset, err = s.client.Get(ctx, nil, name)
+	if s.NoError(err) {
+		s.Equal("filesystem", dataset.Properties.Type)
+	}
+	datasets, err := s.client.List(ctx, nil, zfsp.ListArgs{})
+	s.NoError(err)
+	s.Len(datasets, 1)
+	holds, err := s.client.Holds(ctx, nil, name)
+	s.NoError(err)
+	s.Len(holds, 0)
+
+	s.NoError(s.client.Mount(ctx, nil, zfsp.MountArgs{Name: name}))
+	s.NoError(s.client.Unmount(ctx, nil, zfsp.UnmountArgs{Name: name}))
+
+	// Send streams the data that Receive reads
+	s.zfs.Data.Data[name] = []byte("foobar")
+	streamURL, err := s.client.Send(ctx, nil, name)
+	s.Require().NoError(err)
+	s.NoError(s.client.Receive(ctx, nil, name+"-copy", streamURL))
+	s.Equal("foobar", string(s.zfs.Data.Data[name+"-copy"]))
+
+	s.NoError(s.client.Destroy(ctx, nil, zfsp.DestroyArgs{Name: name}))
+	exists, err = s.client.Exists(ctx, nil, name)
+	s.NoError(err)
+	s.False(exists)
+	s.Error(s.client.Destroy(ctx, nil, zfsp.DestroyArgs{Name: name}), "should fail for a destroyed dataset")
+}
@@ -23,10 +23,10 @@ func (z *ZFS) Clone(req *acomm.Request) (interface{}, *url.URL, error) {
 	}
 
 	if args.Name == "" {
-		return nil, nil, errors.Newv("missing arg: name", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: name", map[string]interface{}{"args": args})
 	}
 	if args.Origin == "" {
-		return nil, nil, errors.Newv("missing arg: origin", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: origin", map[string]interface{}{"args": args})
 	}
 	if err := fixPropertyTypesFromJSON(args.Properties); err != nil {
 		return nil, nil, err
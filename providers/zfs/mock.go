@@ -9,7 +9,6 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/pkg/errors"
-	"github.com/cerana/cerana/pkg/logrusx"
 	"github.com/cerana/cerana/provider"
 	"github.com/cerana/cerana/zfs"
 )
@@ -41,20 +40,20 @@ func NewMockZFS(config *provider.Config, tracker *acomm.Tracker) *MockZFS {
 
 // RegisterTasks registers all MockZFS tasks.
 func (z *MockZFS) RegisterTasks(server *provider.Server) {
-	server.RegisterTask("zfs-clone", z.Clone)
-	server.RegisterTask("zfs-create", z.Create)
-	server.RegisterTask("zfs-destroy", z.Destroy)
-	server.RegisterTask("zfs-exists", z.Exists)
-	server.RegisterTask("zfs-get", z.Get)
-	server.RegisterTask("zfs-holds", z.Holds)
-	server.RegisterTask("zfs-list", z.List)
-	server.RegisterTask("zfs-mount", z.Mount)
-	server.RegisterTask("zfs-receive", z.Receive)
-	server.RegisterTask("zfs-rename", z.Rename)
-	server.RegisterTask("zfs-rollback", z.Rollback)
-	server.RegisterTask("zfs-send", z.Send)
-	server.RegisterTask("zfs-snapshot", z.Snapshot)
-	server.RegisterTask("zfs-unmount", z.Unmount)
+	server.RegisterTask(TaskClone, z.Clone, taskSchemas[TaskClone])
+	server.RegisterTask(TaskCreate, z.Create, taskSchemas[TaskCreate])
+	server.RegisterTask(TaskDestroy, z.Destroy, taskSchemas[TaskDestroy])
+	server.RegisterTask(TaskExists, z.Exists, taskSchemas[TaskExists])
+	server.RegisterTask(TaskGet, z.Get, taskSchemas[TaskGet])
+	server.RegisterTask(TaskHolds, z.Holds, taskSchemas[TaskHolds])
+	server.RegisterTask(TaskList, z.List, taskSchemas[TaskList])
+	server.RegisterTask(TaskMount, z.Mount, taskSchemas[TaskMount])
+	server.RegisterTask(TaskReceive, z.Receive, taskSchemas[TaskReceive])
+	server.RegisterTask(TaskRename, z.Rename, taskSchemas[TaskRename])
+	server.RegisterTask(TaskRollback, z.Rollback, taskSchemas[TaskRollback])
+	server.RegisterTask(TaskSend, z.Send, taskSchemas[TaskSend])
+	server.RegisterTask(TaskSnapshot, z.Snapshot, taskSchemas[TaskSnapshot])
+	server.RegisterTask(TaskUnmount, z.Unmount, taskSchemas[TaskUnmount])
 }
 
 // Clone clones a mock dataset.
@@ -237,10 +236,14 @@ func (z *MockZFS) Receive(req *acomm.Request) (interface{}, *url.URL, error) {
 
 	r, w := io.Pipe()
 	go func() {
-		defer logrusx.LogReturnedErr(w.Close, nil, "failed to close writer")
-		logrusx.LogReturnedErr(func() error {
-			return acomm.Stream(w, req.StreamURL)
-		}, logrus.Fields{"streamURL": req.StreamURL}, "failed to stream")
+		err := acomm.Stream(w, req.StreamURL)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error":     err,
+				"streamURL": req.StreamURL,
+			}).Error("failed to stream")
+		}
+		_ = w.CloseWithError(err)
 	}()
 
 	data, err := ioutil.ReadAll(r)
@@ -317,7 +320,7 @@ func (z *MockZFS) Send(req *acomm.Request) (interface{}, *url.URL, error) {
 
 	reader := bytes.NewReader(data)
 
-	addr, err := z.tracker.NewStreamUnix(z.config.StreamDir("zfs-send"), ioutil.NopCloser(reader))
+	addr, err := z.tracker.NewStream(ioutil.NopCloser(reader))
 	if err != nil {
 		return nil, nil, err
 	}
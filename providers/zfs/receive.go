@@ -3,13 +3,17 @@ package zfs
 import (
 	"io"
 	"net/url"
+	"time"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/pkg/errors"
-	"github.com/cerana/cerana/pkg/logrusx"
 	"github.com/cerana/cerana/zfs"
 )
 
+// receiveProgressInterval is how often progress is sent while receiving.
+const receiveProgressInterval = time.Second
+
 // Receive creates a new snapshot from a zfs stream. If it a full stream, then
 // a new filesystem or volume is created as well.
 func (z *ZFS) Receive(req *acomm.Request) (interface{}, *url.URL, error) {
@@ -19,7 +23,7 @@ func (z *ZFS) Receive(req *acomm.Request) (interface{}, *url.URL, error) {
 	}
 
 	if args.Name == "" {
-		return nil, nil, errors.Newv("missing arg: name", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: name", map[string]interface{}{"args": args})
 	}
 	if req.StreamURL == nil {
 		return nil, nil, errors.Newv("missing request stream-url", map[string]interface{}{"args": args})
@@ -27,10 +31,16 @@ func (z *ZFS) Receive(req *acomm.Request) (interface{}, *url.URL, error) {
 
 	r, w := io.Pipe()
 	go func() {
-		defer logrusx.LogReturnedErr(w.Close, nil, "failed to close writer")
-		logrusx.LogReturnedErr(func() error {
-			return acomm.Stream(w, req.StreamURL)
-		}, map[string]interface{}{"streamURL": req.StreamURL}, "failed to stream")
+		pw := acomm.NewProgressWriter(w, req, "receiving", receiveProgressInterval)
+		err := acomm.Stream(pw, req.StreamURL)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error":     err,
+				"streamURL": req.StreamURL,
+			}).Error("failed to stream")
+		}
+		// An incomplete stream must fail the receive rather than end it cleanly
+		_ = w.CloseWithError(err)
 	}()
 
 	return nil, nil, zfs.Receive(r, args.Name)
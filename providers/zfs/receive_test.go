@@ -68,5 +68,5 @@ func (s *zfs) zfsSendStreamURL(name string) (*url.URL, error) {
 		return nil, err
 	}
 
-	return s.tracker.NewStreamUnix(s.config.StreamDir("zfs-receive"), ioutil.NopCloser(&stream))
+	return s.tracker.NewStream(ioutil.NopCloser(&stream))
 }
@@ -19,7 +19,7 @@ func (z *ZFS) Send(req *acomm.Request) (interface{}, *url.URL, error) {
 	}
 
 	if args.Name == "" {
-		return nil, nil, errors.Newv("missing arg: name", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: name", map[string]interface{}{"args": args})
 	}
 
 	ds, err := zfs.GetDataset(args.Name)
@@ -32,11 +32,25 @@ func (z *ZFS) Send(req *acomm.Request) (interface{}, *url.URL, error) {
 		return nil, nil, errors.Wrap(err)
 	}
 
-	addr, err := z.tracker.NewStreamUnix(z.config.StreamDir("zfs-send"), reader)
+	addr, err := z.tracker.NewStream(reader)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// The response carrying the stream url completes the request before any
+	// data is read, so only the expected size can be reported here. Bytes
+	// transferred are reported by the receiving side as the stream is read.
+	progress := &acomm.Progress{Step: "sending"}
+	if ds.Properties != nil {
+		progress.TotalBytes = ds.Properties.Referenced
+	}
+	if err := req.SendProgress(progress); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error":     err,
+			"requestID": req.ID,
+		}).Warn("failed to send progress")
+	}
+
 	go func() {
 		defer func() {
 			logrusx.LogReturnedErr(writer.Close, nil, "failed to close snapshot stream writer")
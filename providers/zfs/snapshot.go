@@ -23,10 +23,10 @@ func (z *ZFS) Snapshot(req *acomm.Request) (interface{}, *url.URL, error) {
 	}
 
 	if args.Name == "" {
-		return nil, nil, errors.Newv("missing arg: name", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: name", map[string]interface{}{"args": args})
 	}
 	if args.SnapName == "" {
-		return nil, nil, errors.Newv("missing arg: snapname", map[string]interface{}{"args": args})
+		return nil, nil, errors.NewWithCode(errors.CodeInvalidArgument, "missing arg: snapname", map[string]interface{}{"args": args})
 	}
 
 	ds, err := zfs.GetDataset(args.Name)
@@ -0,0 +1,39 @@
+package zfs
+
+import "github.com/cerana/cerana/provider"
+
+// Task names of the zfs provider.
+const (
+	TaskClone    = "zfs-clone"
+	TaskCreate   = "zfs-create"
+	TaskDestroy  = "zfs-destroy"
+	TaskExists   = "zfs-exists"
+	TaskGet      = "zfs-get"
+	TaskHolds    = "zfs-holds"
+	TaskList     = "zfs-list"
+	TaskMount    = "zfs-mount"
+	TaskReceive  = "zfs-receive"
+	TaskRename   = "zfs-rename"
+	TaskRollback = "zfs-rollback"
+	TaskSend     = "zfs-send"
+	TaskSnapshot = "zfs-snapshot"
+	TaskUnmount  = "zfs-unmount"
+)
+
+// taskSchemas describe the zfs tasks.
+var taskSchemas = map[string]provider.TaskSpec{
+	TaskClone:    {Description: "Clone a snapshot into a new dataset.", Args: CloneArgs{}, Result: DatasetResult{}},
+	TaskCreate:   {Description: "Create a dataset.", Args: CreateArgs{}, Result: DatasetResult{}},
+	TaskDestroy:  {Description: "Destroy a dataset.", Args: DestroyArgs{}},
+	TaskExists:   {Description: "Check whether a dataset exists.", Args: CommonArgs{}, Result: ExistsResult{}},
+	TaskGet:      {Description: "Retrieve a dataset.", Args: CommonArgs{}, Result: DatasetResult{}},
+	TaskHolds:    {Description: "Retrieve the holds on a snapshot.", Args: CommonArgs{}, Result: HoldsResult{}},
+	TaskList:     {Description: "Retrieve datasets.", Args: ListArgs{}, Result: ListResult{}},
+	TaskMount:    {Description: "Mount a dataset.", Args: MountArgs{}},
+	TaskReceive:  {Description: "Receive a dataset from the request stream.", Args: CommonArgs{}},
+	TaskRename:   {Description: "Rename a dataset.", Args: RenameArgs{}},
+	TaskRollback: {Description: "Roll a dataset back to a snapshot.", Args: RollbackArgs{}},
+	TaskSend:     {Description: "Send a snapshot as a stream.", Args: CommonArgs{}},
+	TaskSnapshot: {Description: "Snapshot a dataset.", Args: SnapshotArgs{}},
+	TaskUnmount:  {Description: "Unmount a dataset.", Args: UnmountArgs{}},
+}
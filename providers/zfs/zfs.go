@@ -35,20 +35,20 @@ type DatasetResult struct {
 
 // RegisterTasks registers all of ZFS's task handlers with the server.
 func (z *ZFS) RegisterTasks(server *provider.Server) {
-	server.RegisterTask("zfs-clone", z.Clone)
-	server.RegisterTask("zfs-create", z.Create)
-	server.RegisterTask("zfs-destroy", z.Destroy)
-	server.RegisterTask("zfs-exists", z.Exists)
-	server.RegisterTask("zfs-get", z.Get)
-	server.RegisterTask("zfs-holds", z.Holds)
-	server.RegisterTask("zfs-list", z.List)
-	server.RegisterTask("zfs-mount", z.Mount)
-	server.RegisterTask("zfs-receive", z.Receive)
-	server.RegisterTask("zfs-rename", z.Rename)
-	server.RegisterTask("zfs-rollback", z.Rollback)
-	server.RegisterTask("zfs-send", z.Send)
-	server.RegisterTask("zfs-snapshot", z.Snapshot)
-	server.RegisterTask("zfs-unmount", z.Unmount)
+	server.RegisterTask(TaskClone, z.Clone, taskSchemas[TaskClone])
+	server.RegisterTask(TaskCreate, z.Create, taskSchemas[TaskCreate])
+	server.RegisterTask(TaskDestroy, z.Destroy, taskSchemas[TaskDestroy])
+	server.RegisterTask(TaskExists, z.Exists, taskSchemas[TaskExists])
+	server.RegisterTask(TaskGet, z.Get, taskSchemas[TaskGet])
+	server.RegisterTask(TaskHolds, z.Holds, taskSchemas[TaskHolds])
+	server.RegisterTask(TaskList, z.List, taskSchemas[TaskList])
+	server.RegisterTask(TaskMount, z.Mount, taskSchemas[TaskMount])
+	server.RegisterTask(TaskReceive, z.Receive, taskSchemas[TaskReceive])
+	server.RegisterTask(TaskRename, z.Rename, taskSchemas[TaskRename])
+	server.RegisterTask(TaskRollback, z.Rollback, taskSchemas[TaskRollback])
+	server.RegisterTask(TaskSend, z.Send, taskSchemas[TaskSend])
+	server.RegisterTask(TaskSnapshot, z.Snapshot, taskSchemas[TaskSnapshot])
+	server.RegisterTask(TaskUnmount, z.Unmount, taskSchemas[TaskUnmount])
 }
 
 // fixPropertyTypesFromJSON attempts to convert the underlying data types in a property
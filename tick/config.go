@@ -1,10 +1,12 @@
 package tick
 
 import (
+	"crypto/tls"
 	"net/url"
 	"os"
 	"time"
 
+	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/pkg/configutil"
 	"github.com/cerana/cerana/pkg/errors"
 	"github.com/cerana/cerana/pkg/logrusx"
@@ -20,8 +22,10 @@ type Configer interface {
 	ClusterDataURL() *url.URL
 	LogLevel() string
 	RequestTimeout() time.Duration
+	RequestRetries() int
 	TickInterval() time.Duration
 	TickRetryInterval() time.Duration
+	TLSConfig() (*tls.Config, error)
 }
 
 // Config is the configuration for a tick.
@@ -36,8 +40,12 @@ type ConfigData struct {
 	ClusterDataURL    string `json:"clusterDataURL"`
 	LogLevel          string `json:"logLevel"`
 	RequestTimeout    string `json:"requestTimeout"`
+	RequestRetries    int    `json:"requestRetries"`
 	TickInterval      string `json:"tickInterval"`
 	TickRetryInterval string `json:"tickRetryInterval"`
+	TLSCAFile         string `json:"tlsCAFile"`
+	TLSCertFile       string `json:"tlsCertFile"`
+	TLSKeyFile        string `json:"tlsKeyFile"`
 }
 
 // NewConfig creates a new instance of Config.
@@ -58,8 +66,12 @@ func NewConfig(flagSet *pflag.FlagSet, v *viper.Viper) *Config {
 	flagSet.StringP("clusterDataURL", "u", "", "url of coordinator for the cluster information")
 	flagSet.StringP("logLevel", "l", "warning", "log level: debug/info/warn/error/fatal/panic")
 	flagSet.DurationP("requestTimeout", "r", 0, "default timeout for external requests made")
+	flagSet.Int("requestRetries", 2, "times to retry requests that fail with temporary errors")
 	flagSet.DurationP("tickInterval", "t", 0, "tick run frequency")
 	flagSet.DurationP("tickRetryInterval", "i", 0, "tick retry on error frequency")
+	flagSet.String("tlsCAFile", "", "path to ca certificate for verifying coordinators")
+	flagSet.String("tlsCertFile", "", "path to client certificate to present to coordinators")
+	flagSet.String("tlsKeyFile", "", "path to key for the client certificate")
 
 	return &Config{
 		viper:   v,
@@ -117,6 +129,12 @@ func (c *Config) RequestTimeout() time.Duration {
 	return c.viper.GetDuration("requestTimeout")
 }
 
+// RequestRetries returns how many times to retry requests that fail with
+// temporary errors.
+func (c *Config) RequestRetries() int {
+	return c.viper.GetInt("requestRetries")
+}
+
 // TickInterval returns how often the tick function should be executed.
 func (c *Config) TickInterval() time.Duration {
 	return c.viper.GetDuration("tickInterval")
@@ -128,6 +146,18 @@ func (c *Config) TickRetryInterval() time.Duration {
 	return c.viper.GetDuration("tickRetryInterval")
 }
 
+// TLSConfig returns the TLS config to use for https requests, or nil if no
+// TLS files are configured.
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	caFile := c.viper.GetString("tlsCAFile")
+	certFile := c.viper.GetString("tlsCertFile")
+	keyFile := c.viper.GetString("tlsKeyFile")
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	return acomm.LoadTLSConfig(caFile, certFile, keyFile)
+}
+
 // LogLevel returns the log level.
 func (c *Config) LogLevel() string {
 	return c.viper.GetString("logLevel")
@@ -157,6 +187,10 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	if (c.viper.GetString("tlsCertFile") == "") != (c.viper.GetString("tlsKeyFile") == "") {
+		return errors.New("tlsCertFile and tlsKeyFile must be set together")
+	}
+
 	return nil
 }
 
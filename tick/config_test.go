@@ -78,16 +78,21 @@ func (s *Tick) TestValidate() {
 		requestTimeout    string
 		tickInterval      string
 		tickRetryInterval string
+		tlsCertFile       string
+		tlsKeyFile        string
 		expectedErr       string
 	}{
-		{"valid", u, u, "5s", "4s", "3s", ""},
-		{"missing nodeDataURL", "", u, "5s", "4s", "3s", "missing nodeDataURL"},
-		{"invalud nodeDataURL", "asdf", u, "5s", "4s", "3s", "invalid nodeDataURL"},
-		{"missing clusterDataURL", u, "", "5s", "4s", "3s", "missing clusterDataURL"},
-		{"invalud clusterDataURL", u, "asdf", "5s", "4s", "3s", "invalid clusterDataURL"},
-		{"invalid request timeout", u, u, "0", "4s", "3s", "requestTimeout must be greater than 0"},
-		{"invalid tick interval", u, u, "5s", "0", "3s", "tickInterval must be greater than 0"},
-		{"missing tick retry interval", u, u, "5s", "4s", "0", "tickRetryInterval must be greater than 0"},
+		{"valid", u, u, "5s", "4s", "3s", "", "", ""},
+		{"valid tls", u, u, "5s", "4s", "3s", "cert.pem", "key.pem", ""},
+		{"missing tls key", u, u, "5s", "4s", "3s", "cert.pem", "", "tlsCertFile and tlsKeyFile must be set together"},
+		{"missing tls cert", u, u, "5s", "4s", "3s", "", "key.pem", "tlsCertFile and tlsKeyFile must be set together"},
+		{"missing nodeDataURL", "", u, "5s", "4s", "3s", "", "", "missing nodeDataURL"},
+		{"invalud nodeDataURL", "asdf", u, "5s", "4s", "3s", "", "", "invalid nodeDataURL"},
+		{"missing clusterDataURL", u, "", "5s", "4s", "3s", "", "", "missing clusterDataURL"},
+		{"invalud clusterDataURL", u, "asdf", "5s", "4s", "3s", "", "", "invalid clusterDataURL"},
+		{"invalid request timeout", u, u, "0", "4s", "3s", "", "", "requestTimeout must be greater than 0"},
+		{"invalid tick interval", u, u, "5s", "0", "3s", "", "", "tickInterval must be greater than 0"},
+		{"missing tick retry interval", u, u, "5s", "4s", "0", "", "", "tickRetryInterval must be greater than 0"},
 	}
 
 	for _, test := range tests {
@@ -97,6 +102,8 @@ func (s *Tick) TestValidate() {
 			RequestTimeout:    test.requestTimeout,
 			TickInterval:      test.tickInterval,
 			TickRetryInterval: test.tickRetryInterval,
+			TLSCertFile:       test.tlsCertFile,
+			TLSKeyFile:        test.tlsKeyFile,
 		}
 
 		config, fs, v, _, err := newTestConfig(true, false, configData)
@@ -133,6 +140,10 @@ func (s *Tick) TestRequestTimeout() {
 	s.EqualValues(s.configData.RequestTimeout, s.config.RequestTimeout().String())
 }
 
+func (s *Tick) TestRequestRetries() {
+	s.Equal(s.configData.RequestRetries, s.config.RequestRetries())
+}
+
 func (s *Tick) TestTickInterval() {
 	s.EqualValues(s.configData.TickInterval, s.config.TickInterval().String())
 }
@@ -188,6 +199,12 @@ func newTestConfig(setFlags, writeConfig bool, configData *tick.ConfigData) (*ti
 		if err := fs.Set("tickRetryInterval", configData.TickRetryInterval); err != nil {
 			return nil, nil, nil, configFile, err
 		}
+		if err := fs.Set("tlsCertFile", configData.TLSCertFile); err != nil {
+			return nil, nil, nil, configFile, err
+		}
+		if err := fs.Set("tlsKeyFile", configData.TLSKeyFile); err != nil {
+			return nil, nil, nil, configFile, err
+		}
 
 	}
 
@@ -11,6 +11,7 @@ import (
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/pkg/errors"
 	"github.com/cerana/cerana/providers/metrics"
+	"golang.org/x/net/context"
 )
 
 // ActionFn is a function that can be run on a tick interval.
@@ -32,6 +33,15 @@ func RunTick(config Configer, tick ActionFn) (chan struct{}, error) {
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	stopChan := make(chan struct{}, 1)
 
+	// present a client certificate if configured
+	tlsConfig, err := config.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		acomm.SetTLSConfig(tlsConfig)
+	}
+
 	// setup response tracker
 	tracker, err := acomm.NewTracker("", nil, nil, config.RequestTimeout())
 	if err != nil {
@@ -40,6 +50,13 @@ func RunTick(config Configer, tick ActionFn) (chan struct{}, error) {
 	if err = tracker.Start(); err != nil {
 		return nil, err
 	}
+	if retries := config.RequestRetries(); retries > 0 {
+		tracker.SetRetryPolicy(&acomm.RetryPolicy{
+			MaxAttempts: retries + 1,
+			Backoff:     250 * time.Millisecond,
+			MaxBackoff:  5 * time.Second,
+		})
+	}
 
 	go func() {
 		defer func() { stopChan <- struct{}{} }()
@@ -79,9 +96,9 @@ func RunTick(config Configer, tick ActionFn) (chan struct{}, error) {
 // GetIP retrieves the ip of the current node, very often needed for ticks.
 func GetIP(config Configer, tracker *acomm.Tracker) (net.IP, error) {
 	opts := acomm.RequestOptions{
-		Task: "metrics-network",
+		Task: metrics.TaskNetwork,
 	}
-	resp, err := tracker.SyncRequest(config.NodeDataURL(), opts, config.RequestTimeout())
+	resp, err := tracker.SyncRequest(context.Background(), config.NodeDataURL(), opts, config.RequestTimeout())
 	if err != nil {
 		return nil, err
 	}
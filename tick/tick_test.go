@@ -43,6 +43,7 @@ func (s *Tick) SetupSuite() {
 		ClusterDataURL:    nodeDataURL,
 		LogLevel:          "fatal",
 		RequestTimeout:    "5s",
+		RequestRetries:    1,
 		TickInterval:      "1s",
 		TickRetryInterval: "500ms",
 	}
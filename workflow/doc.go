@@ -0,0 +1,46 @@
+/*
+Package workflow runs multi-step task sequences on top of acomm, with
+compensation on failure and persisted state for recovery.
+
+A Workflow is a set of named Steps, each an Action: a task request sent
+through the coordinator, optionally to another coordinator's TaskURL. Steps
+may depend on other steps and run as soon as their dependencies are done, so
+independent branches run in parallel. A step's When condition can skip it
+based on the results of earlier steps, and an Action's Prepare hook can adjust
+its request, such as to use an earlier result in the args. A failed request
+is retried up to the Action's Retries, with exponential backoff, and each
+attempt gets its own idempotency key.
+
+If a step fails, no further steps are started. Once the running steps finish,
+the Compensate action of each completed step is run, most recently completed
+first, to undo the work done so far. The step's error is returned from Run,
+keeping its error code.
+
+The state of a run, including each step's status and result, is saved in a
+Store after every change and removed once the workflow is done. KVStore keeps
+it in the cluster kv, using the kv-* tasks, and concurrent runs of the same
+workflow are detected by its modification index. Running a workflow with the
+ID of one that was interrupted picks up where it left off: steps that were in
+flight are run again and an unfinished compensation continues. Resume runs
+every workflow left in the store, rebuilding each from its name and input with
+a Builder registered on the Engine. If the store is unavailable, workflows
+still run but can't be resumed.
+
+	engine := workflow.NewEngine(tracker, coordinatorURL, timeout, store)
+	state, err := engine.Run(ctx, &workflow.Workflow{
+		ID: id,
+		Steps: []*workflow.Step{
+			{
+				Name:       "create",
+				Action:     workflow.Action{Task: "systemd-create", Args: createArgs},
+				Compensate: &workflow.Action{Task: "systemd-remove", Args: removeArgs},
+			},
+			{
+				Name:      "start",
+				DependsOn: []string{"create"},
+				Action:    workflow.Action{Task: "systemd-start", Args: startArgs, Retries: 2},
+			},
+		},
+	})
+*/
+package workflow
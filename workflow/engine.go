@@ -0,0 +1,490 @@
+package workflow
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// Backoff between retries of a failed action, doubling after each attempt.
+const (
+	retryBackoff    = 250 * time.Millisecond
+	maxRetryBackoff = 5 * time.Second
+)
+
+// Engine runs workflows, sending step requests through a coordinator and
+// persisting their state in a Store.
+type Engine struct {
+	tracker        *acomm.Tracker
+	coordinatorURL *url.URL
+	timeout        time.Duration
+	store          Store
+	lock           sync.Mutex // Protects builders
+	builders       map[string]Builder
+}
+
+// NewEngine creates a new Engine.
+func NewEngine(tracker *acomm.Tracker, coordinatorURL *url.URL, timeout time.Duration, store Store) *Engine {
+	return &Engine{
+		tracker:        tracker,
+		coordinatorURL: coordinatorURL,
+		timeout:        timeout,
+		store:          store,
+		builders:       make(map[string]Builder),
+	}
+}
+
+// Register registers a Builder for workflows with the name, used by Resume.
+func (e *Engine) Register(name string, builder Builder) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.builders[name] = builder
+}
+
+func (e *Engine) builder(name string) Builder {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.builders[name]
+}
+
+// Run runs a workflow until it completes or fails, resuming from its stored
+// state if it was interrupted. If a step fails, the completed steps are
+// compensated in the reverse order of their completion and the step's error
+// is returned. The state is removed from the store once the workflow is done.
+func (e *Engine) Run(ctx context.Context, w *Workflow) (*State, error) {
+	if err := w.validate(); err != nil {
+		return nil, err
+	}
+
+	r := &run{
+		engine:   e,
+		workflow: w,
+		persist:  true,
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r.run(ctx)
+}
+
+// Resume runs the workflows left in the store, such as by a crash, using
+// the registered Builders to rebuild them. It blocks until they are done.
+// Failures of individual workflows are logged.
+func (e *Engine) Resume(ctx context.Context) error {
+	ids, err := e.store.List()
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		state, err := e.store.Load(id)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error":    err,
+				"workflow": id,
+			}).Error("failed to load workflow state")
+			continue
+		}
+		if state == nil {
+			continue
+		}
+
+		builder := e.builder(state.Name)
+		if builder == nil {
+			logrus.WithFields(logrus.Fields{
+				"workflow": id,
+				"name":     state.Name,
+			}).Warn("no builder registered for workflow")
+			continue
+		}
+		w, err := builder(id, state.Input)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error":    err,
+				"workflow": id,
+				"name":     state.Name,
+			}).Error("failed to rebuild workflow")
+			continue
+		}
+
+		wg.Add(1)
+		go func(w *Workflow) {
+			defer wg.Done()
+			if _, err := e.Run(ctx, w); err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error":    err,
+					"workflow": w.ID,
+					"name":     w.Name,
+				}).Error("resumed workflow failed")
+			}
+		}(w)
+	}
+	wg.Wait()
+	return nil
+}
+
+// do makes the action's request, retrying failures. Each attempt gets its own
+// idempotency key derived from the key, so an attempt repeated after a crash
+// returns the original response rather than running the task again.
+func (e *Engine) do(ctx context.Context, action *Action, opts acomm.RequestOptions, key string) (*acomm.Response, int, error) {
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		opts.IdempotencyKey = fmt.Sprintf("%s/%d", key, attempt)
+		resp, err := e.tracker.SyncRequest(ctx, e.coordinatorURL, opts, e.timeout)
+		if err == nil || attempt > action.Retries || ctx.Err() != nil {
+			return resp, attempt, err
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"error":   err,
+			"task":    opts.Task,
+			"key":     key,
+			"attempt": attempt,
+		}).Warn("retrying failed workflow action")
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return resp, attempt, err
+		}
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// run is a single run of a workflow.
+type run struct {
+	engine   *Engine
+	workflow *Workflow
+	state    *State
+	// persist is cleared if the store fails, after which the run continues
+	// without being resumable
+	persist bool
+}
+
+// stepResult is the outcome of a step's action.
+type stepResult struct {
+	step     *Step
+	attempts int
+	resp     *acomm.Response
+	err      error
+}
+
+// load loads the stored state of the workflow, preparing it to be resumed,
+// or creates a new state.
+func (r *run) load() error {
+	w := r.workflow
+	state, err := r.engine.store.Load(w.ID)
+	if err != nil {
+		// The state only aids recovery, so run the workflow from the start
+		logrus.WithFields(logrus.Fields{
+			"error":    err,
+			"workflow": w.ID,
+		}).Warn("failed to load workflow state")
+		r.persist = false
+	}
+	if state == nil {
+		r.state, err = newState(w)
+		return err
+	}
+
+	// Steps that were in progress are run again
+	for _, step := range w.Steps {
+		stepState, ok := state.Steps[step.Name]
+		switch {
+		case !ok:
+			state.Steps[step.Name] = &StepState{Status: StatusPending}
+		case stepState.Status == StatusRunning:
+			stepState.Status = StatusPending
+		case stepState.Status == StatusCompensating:
+			stepState.Status = StatusCompleted
+		}
+	}
+	r.state = state
+
+	logrus.WithFields(logrus.Fields{
+		"workflow": w.ID,
+		"name":     w.Name,
+		"status":   state.Status,
+	}).Info("resuming workflow")
+	return nil
+}
+
+// save persists the state. Only a conflict, meaning the workflow is being run
+// elsewhere, is returned as an error; other failures are logged and stop
+// further persistence.
+func (r *run) save() error {
+	if !r.persist {
+		return nil
+	}
+	err := r.engine.store.Save(r.state)
+	if err == nil {
+		return nil
+	}
+	if errors.IsCode(err, errors.CodeConflict) {
+		return err
+	}
+	logrus.WithFields(logrus.Fields{
+		"error":    err,
+		"workflow": r.state.ID,
+	}).Warn("failed to save workflow state, continuing without it")
+	r.persist = false
+	return nil
+}
+
+func (r *run) run(ctx context.Context) (*State, error) {
+	var failure error
+	switch r.state.Status {
+	case StatusRunning:
+		failure = r.runSteps(ctx)
+	case StatusCompensating, StatusFailed:
+		// The original error only survives as its message
+		failure = errors.Newv(r.state.Error, map[string]interface{}{"workflow": r.state.ID})
+	}
+
+	if failure != nil && r.state.Status != StatusFailed {
+		r.compensate(failure)
+	} else if failure == nil {
+		r.state.Status = StatusCompleted
+	}
+
+	if r.persist && r.state.Index != 0 {
+		if err := r.engine.store.Delete(r.state); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error":    err,
+				"workflow": r.state.ID,
+			}).Error("failed to delete workflow state")
+		}
+	}
+	return r.state, failure
+}
+
+// runSteps runs the steps as they become ready until they are all done or
+// one fails.
+func (r *run) runSteps(ctx context.Context) error {
+	results := make(chan *stepResult, len(r.workflow.Steps))
+	running := 0
+
+	var failure error
+	for {
+		if failure == nil && ctx.Err() == nil {
+			var ready []*stepRequest
+			var changed bool
+			ready, changed, failure = r.readySteps()
+			if failure != nil {
+				// Steps that were not started are left to be run on resume
+				for _, sr := range ready {
+					r.state.Steps[sr.step.Name].Status = StatusPending
+				}
+			} else if changed {
+				failure = r.save()
+			}
+			if failure == nil {
+				for _, sr := range ready {
+					running++
+					go func(sr *stepRequest) {
+						key := fmt.Sprintf("%s/%s", r.state.ID, sr.step.Name)
+						resp, attempts, err := r.engine.do(ctx, &sr.step.Action, sr.opts, key)
+						results <- &stepResult{step: sr.step, attempts: attempts, resp: resp, err: err}
+					}(sr)
+				}
+			}
+		}
+		if running == 0 {
+			break
+		}
+
+		result := <-results
+		running--
+		stepState := r.state.Steps[result.step.Name]
+		stepState.Attempts = result.attempts
+		if result.err != nil {
+			stepState.Status = StatusFailed
+			stepState.Error = result.err.Error()
+			if failure == nil {
+				failure = errors.Wrapv(result.err, map[string]interface{}{
+					"workflow": r.state.ID,
+					"step":     result.step.Name,
+				})
+			}
+		} else {
+			stepState.Status = StatusCompleted
+			stepState.Seq = r.nextSeq()
+			if result.resp.Result != nil {
+				stepState.Result = *result.resp.Result
+			}
+		}
+		if err := r.save(); err != nil && failure == nil {
+			failure = err
+		}
+	}
+
+	if failure == nil && ctx.Err() != nil {
+		for _, stepState := range r.state.Steps {
+			if stepState.Status == StatusPending {
+				failure = errors.Wrapv(ctx.Err(), map[string]interface{}{"workflow": r.state.ID})
+				break
+			}
+		}
+	}
+	return failure
+}
+
+// stepRequest is a step ready to run with its prepared request.
+type stepRequest struct {
+	step *Step
+	opts acomm.RequestOptions
+}
+
+// readySteps marks the steps whose dependencies are done as running, or
+// skipped if their condition is not met, and returns those to run along with
+// whether any step changed.
+func (r *run) readySteps() ([]*stepRequest, bool, error) {
+	var ready []*stepRequest
+	var changed bool
+	// Skipping a step may make others ready
+	for skipped := true; skipped; {
+		skipped = false
+		for _, step := range r.workflow.Steps {
+			stepState := r.state.Steps[step.Name]
+			if stepState.Status != StatusPending || !r.depsDone(step) {
+				continue
+			}
+			errData := map[string]interface{}{"workflow": r.state.ID, "step": step.Name}
+
+			if step.When != nil {
+				ok, err := step.When(r.state)
+				if err != nil {
+					return ready, changed, errors.Wrapv(err, errData)
+				}
+				if !ok {
+					stepState.Status = StatusSkipped
+					skipped, changed = true, true
+					continue
+				}
+			}
+
+			opts, err := prepare(&step.Action, r.state)
+			if err != nil {
+				return ready, changed, errors.Wrapv(err, errData)
+			}
+			stepState.Status = StatusRunning
+			changed = true
+			ready = append(ready, &stepRequest{step: step, opts: opts})
+		}
+	}
+	return ready, changed, nil
+}
+
+// depsDone returns whether all of the step's dependencies are done.
+func (r *run) depsDone(step *Step) bool {
+	for _, dep := range step.DependsOn {
+		status := r.state.Steps[dep].Status
+		if status != StatusCompleted && status != StatusSkipped {
+			return false
+		}
+	}
+	return true
+}
+
+// nextSeq returns the next step completion sequence number.
+func (r *run) nextSeq() int {
+	seq := 0
+	for _, stepState := range r.state.Steps {
+		if stepState.Seq > seq {
+			seq = stepState.Seq
+		}
+	}
+	return seq + 1
+}
+
+// compensate runs the compensating actions of the completed steps, most
+// recently completed first. Compensation runs to completion regardless of
+// the workflow's context, and failures are logged rather than stopping it.
+func (r *run) compensate(failure error) {
+	r.state.Status = StatusCompensating
+	r.state.Error = failure.Error()
+	if err := r.save(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error":    err,
+			"workflow": r.state.ID,
+		}).Error("not compensating workflow modified elsewhere")
+		return
+	}
+
+	var completed []*Step
+	for _, step := range r.workflow.Steps {
+		if step.Compensate != nil && r.state.Steps[step.Name].Status == StatusCompleted {
+			completed = append(completed, step)
+		}
+	}
+	sort.Sort(sort.Reverse(bySeq{steps: completed, state: r.state}))
+
+	for _, step := range completed {
+		stepState := r.state.Steps[step.Name]
+		stepState.Status = StatusCompensating
+		if err := r.save(); err != nil {
+			return
+		}
+
+		key := fmt.Sprintf("%s/%s/compensate", r.state.ID, step.Name)
+		opts, err := prepare(step.Compensate, r.state)
+		if err == nil {
+			_, _, err = r.engine.do(context.Background(), step.Compensate, opts, key)
+		}
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error":    err,
+				"workflow": r.state.ID,
+				"step":     step.Name,
+				"task":     step.Compensate.Task,
+			}).Error("failed to compensate workflow step")
+			stepState.Status = StatusFailed
+			stepState.Error = err.Error()
+		} else {
+			stepState.Status = StatusCompensated
+		}
+		if err := r.save(); err != nil {
+			return
+		}
+	}
+	r.state.Status = StatusFailed
+}
+
+// prepare creates the request options for an action.
+func prepare(action *Action, state *State) (acomm.RequestOptions, error) {
+	opts := acomm.RequestOptions{
+		Task:    action.Task,
+		TaskURL: action.TaskURL,
+		Target:  action.Target,
+		Args:    action.Args,
+	}
+	if action.Prepare != nil {
+		if err := action.Prepare(state, &opts); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// bySeq sorts steps by the order they completed.
+type bySeq struct {
+	steps []*Step
+	state *State
+}
+
+func (s bySeq) Len() int      { return len(s.steps) }
+func (s bySeq) Swap(i, j int) { s.steps[i], s.steps[j] = s.steps[j], s.steps[i] }
+func (s bySeq) Less(i, j int) bool {
+	return s.state.Steps[s.steps[i].Name].Seq < s.state.Steps[s.steps[j].Name].Seq
+}
@@ -0,0 +1,407 @@
+package workflow_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cerana/cerana/acomm"
+	cerrors "github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/pkg/kv"
+	"github.com/cerana/cerana/pkg/test"
+	"github.com/cerana/cerana/provider"
+	kvp "github.com/cerana/cerana/providers/kv"
+	"github.com/cerana/cerana/workflow"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type Engine struct {
+	suite.Suite
+	coordinator *test.Coordinator
+	tracker     *acomm.Tracker
+	tasks       *mockTasks
+	kv          *mockKV
+	store       *workflow.MemoryStore
+	engine      *workflow.Engine
+}
+
+func TestEngine(t *testing.T) {
+	suite.Run(t, new(Engine))
+}
+
+func (s *Engine) SetupSuite() {
+	var err error
+	s.coordinator, err = test.NewCoordinator("")
+	s.Require().NoError(err)
+
+	s.tasks = &mockTasks{failures: make(map[string]int)}
+	s.coordinator.RegisterProvider(s.tasks)
+	s.kv = &mockKV{data: make(map[string]kv.Value)}
+	s.coordinator.RegisterProvider(s.kv)
+
+	s.tracker, err = acomm.NewTracker(filepath.Join(s.coordinator.SocketDir, "tracker.sock"), nil, nil, 5*time.Second)
+	s.Require().NoError(err)
+	s.Require().NoError(s.tracker.Start())
+
+	s.Require().NoError(s.coordinator.Start())
+}
+
+func (s *Engine) SetupTest() {
+	s.tasks.reset()
+	s.store = workflow.NewMemoryStore()
+	s.engine = workflow.NewEngine(s.tracker, s.coordinatorURL(), 5*time.Second, s.store)
+}
+
+func (s *Engine) TearDownSuite() {
+	s.coordinator.Stop()
+	s.tracker.Stop()
+	s.Require().NoError(s.coordinator.Cleanup())
+}
+
+func (s *Engine) coordinatorURL() *url.URL {
+	u, err := url.ParseRequestURI(s.coordinator.NewProviderViper().GetString("coordinator_url"))
+	s.Require().NoError(err)
+	return u
+}
+
+func recordStep(name string, deps ...string) *workflow.Step {
+	return &workflow.Step{
+		Name:      name,
+		DependsOn: deps,
+		Action: workflow.Action{
+			Task: "wf-record",
+			Args: recordArgs{Name: name},
+		},
+		Compensate: &workflow.Action{
+			Task: "wf-record",
+			Args: recordArgs{Name: "undo-" + name},
+		},
+	}
+}
+
+func (s *Engine) TestRun() {
+	w := &workflow.Workflow{
+		ID: uuid.New(),
+		Steps: []*workflow.Step{
+			recordStep("d", "b", "c"),
+			recordStep("b", "a"),
+			recordStep("c", "a"),
+			recordStep("a"),
+		},
+	}
+
+	state, err := s.engine.Run(context.Background(), w)
+	s.Require().NoError(err)
+	s.Equal(workflow.StatusCompleted, state.Status)
+
+	calls := s.tasks.log()
+	if !s.Len(calls, 4) {
+		return
+	}
+	s.Equal("a", calls[0], "should run steps without dependencies first")
+	middle := calls[1:3]
+	sort.Strings(middle)
+	s.Equal([]string{"b", "c"}, middle, "should run independent steps")
+	s.Equal("d", calls[3], "should wait for all dependencies")
+
+	var result recordArgs
+	s.NoError(state.Result("d", &result))
+	s.Equal("d", result.Name)
+	s.Equal(4, state.Steps["d"].Seq)
+
+	ids, err := s.store.List()
+	s.NoError(err)
+	s.Empty(ids, "should remove state of finished workflows")
+}
+
+func (s *Engine) TestWhen() {
+	skip := recordStep("b", "a")
+	skip.When = func(state *workflow.State) (bool, error) {
+		var result recordArgs
+		if err := state.Result("a", &result); err != nil {
+			return false, err
+		}
+		return result.Name != "a", nil
+	}
+	w := &workflow.Workflow{
+		ID:    uuid.New(),
+		Steps: []*workflow.Step{recordStep("a"), skip, recordStep("c", "b")},
+	}
+
+	state, err := s.engine.Run(context.Background(), w)
+	s.Require().NoError(err)
+	s.Equal([]string{"a", "c"}, s.tasks.log(), "should run steps depending on skipped steps")
+	s.Equal(workflow.StatusSkipped, state.Steps["b"].Status)
+}
+
+func (s *Engine) TestCompensation() {
+	fail := recordStep("c", "b")
+	fail.Task = "wf-fail"
+	fail.Retries = 1
+	w := &workflow.Workflow{
+		ID:    uuid.New(),
+		Steps: []*workflow.Step{recordStep("a"), recordStep("b", "a"), fail},
+	}
+
+	state, err := s.engine.Run(context.Background(), w)
+	s.Error(err)
+	s.True(cerrors.IsCode(err, cerrors.CodeConflict), "should keep the step's error code")
+	s.Equal(workflow.StatusFailed, state.Status)
+	s.Equal(2, state.Steps["c"].Attempts, "should have retried")
+	s.Equal(workflow.StatusFailed, state.Steps["c"].Status)
+	s.Equal(workflow.StatusCompensated, state.Steps["a"].Status)
+	s.Equal(workflow.StatusCompensated, state.Steps["b"].Status)
+	s.Equal([]string{"a", "b", "undo-b", "undo-a"}, s.tasks.log(), "should compensate in reverse order")
+}
+
+func (s *Engine) TestRetries() {
+	flaky := recordStep("a")
+	flaky.Retries = 2
+	s.tasks.failures["a"] = 2
+
+	state, err := s.engine.Run(context.Background(), &workflow.Workflow{
+		ID:    uuid.New(),
+		Steps: []*workflow.Step{flaky},
+	})
+	s.Require().NoError(err)
+	s.Equal(3, state.Steps["a"].Attempts)
+	s.Equal([]string{"a"}, s.tasks.log())
+}
+
+func (s *Engine) TestResume() {
+	id := uuid.New()
+	result := json.RawMessage(`{"name":"a"}`)
+	s.Require().NoError(s.store.Save(&workflow.State{
+		ID:     id,
+		Name:   "test",
+		Input:  json.RawMessage(`["a","b"]`),
+		Status: workflow.StatusRunning,
+		Steps: map[string]*workflow.StepState{
+			"a": {Status: workflow.StatusCompleted, Seq: 1, Result: result},
+			"b": {Status: workflow.StatusRunning},
+		},
+	}))
+
+	s.engine.Register("test", func(id string, input json.RawMessage) (*workflow.Workflow, error) {
+		var names []string
+		if err := json.Unmarshal(input, &names); err != nil {
+			return nil, err
+		}
+		return &workflow.Workflow{
+			ID:    id,
+			Name:  "test",
+			Input: names,
+			Steps: []*workflow.Step{recordStep(names[0]), recordStep(names[1], names[0])},
+		}, nil
+	})
+	s.Require().NoError(s.engine.Resume(context.Background()))
+	s.Equal([]string{"b"}, s.tasks.log(), "should only run unfinished steps")
+
+	ids, err := s.store.List()
+	s.NoError(err)
+	s.Empty(ids)
+}
+
+func (s *Engine) TestValidate() {
+	tests := []struct {
+		description string
+		steps       []*workflow.Step
+		err         string
+	}{
+		{"no steps", nil, "workflow has no steps"},
+		{"duplicate", []*workflow.Step{recordStep("a"), recordStep("a")}, "duplicate step name"},
+		{"unknown dep", []*workflow.Step{recordStep("a", "b")}, "unknown step dependency"},
+		{"cycle", []*workflow.Step{recordStep("a", "c"), recordStep("b", "a"), recordStep("c", "b")}, "step dependency cycle"},
+	}
+
+	for _, test := range tests {
+		_, err := s.engine.Run(context.Background(), &workflow.Workflow{ID: uuid.New(), Steps: test.steps})
+		if s.Error(err, test.description) {
+			s.Equal(test.err, err.Error(), test.description)
+			s.True(cerrors.IsCode(err, cerrors.CodeInvalidArgument), test.description)
+		}
+	}
+	s.Empty(s.tasks.log())
+}
+
+func (s *Engine) TestKVStore() {
+	store := workflow.NewKVStore(s.tracker, s.coordinatorURL(), 5*time.Second, "workflows/test")
+	id := uuid.New() + "/1"
+
+	state, err := store.Load(id)
+	s.NoError(err)
+	s.Nil(state, "should not find missing state")
+
+	state = &workflow.State{
+		ID:     id,
+		Status: workflow.StatusRunning,
+		Steps:  map[string]*workflow.StepState{"a": {Status: workflow.StatusPending}},
+	}
+	s.Require().NoError(store.Save(state))
+	s.NotZero(state.Index)
+
+	loaded, err := store.Load(id)
+	s.Require().NoError(err)
+	s.Equal(state, loaded)
+
+	ids, err := store.List()
+	s.NoError(err)
+	s.Equal([]string{id}, ids)
+
+	stale := *loaded
+	s.Require().NoError(store.Save(loaded))
+	err = store.Save(&stale)
+	s.True(cerrors.IsCode(err, cerrors.CodeConflict), "should not overwrite newer state")
+
+	s.NoError(store.Delete(loaded))
+	state, err = store.Load(id)
+	s.NoError(err)
+	s.Nil(state)
+}
+
+type recordArgs struct {
+	Name string `json:"name"`
+}
+
+// mockTasks provides tasks that record their calls.
+type mockTasks struct {
+	lock     sync.Mutex
+	calls    []string
+	failures map[string]int
+}
+
+func (m *mockTasks) RegisterTasks(server *provider.Server) {
+	server.RegisterTask("wf-record", m.record)
+	server.RegisterTask("wf-fail", m.fail)
+}
+
+func (m *mockTasks) reset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.calls = nil
+	m.failures = make(map[string]int)
+}
+
+func (m *mockTasks) log() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return append([]string(nil), m.calls...)
+}
+
+func (m *mockTasks) record(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args recordArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.failures[args.Name] > 0 {
+		m.failures[args.Name]--
+		return nil, nil, errors.New("flaky failure")
+	}
+	m.calls = append(m.calls, args.Name)
+	return args, nil, nil
+}
+
+func (m *mockTasks) fail(req *acomm.Request) (interface{}, *url.URL, error) {
+	return nil, nil, cerrors.NewWithCode(cerrors.CodeConflict, "failed", nil)
+}
+
+// mockKV provides the kv tasks used by the KVStore.
+type mockKV struct {
+	lock  sync.Mutex
+	data  map[string]kv.Value
+	index uint64
+}
+
+func (m *mockKV) RegisterTasks(server *provider.Server) {
+	server.RegisterTask(kvp.TaskGet, m.get)
+	server.RegisterTask(kvp.TaskKeys, m.keys)
+	server.RegisterTask(kvp.TaskUpdate, m.update)
+	server.RegisterTask(kvp.TaskRemove, m.remove)
+}
+
+type mockKVArgs struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Index uint64 `json:"index"`
+}
+
+func (m *mockKV) get(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args mockKVArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	value, ok := m.data[args.Key]
+	if !ok {
+		return nil, nil, cerrors.NewWithCode(cerrors.CodeNotFound, "key not found", nil)
+	}
+	return value, nil, nil
+}
+
+func (m *mockKV) keys(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args mockKVArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	keys := []string{}
+	for key := range m.data {
+		if strings.HasPrefix(key, args.Key+"/") {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil, nil
+}
+
+func (m *mockKV) update(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args mockKVArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.data[args.Key].Index != args.Index {
+		return nil, nil, cerrors.NewWithCode(cerrors.CodeConflict, "CAS failed", nil)
+	}
+	m.index++
+	m.data[args.Key] = kv.Value{Data: []byte(args.Value), Index: m.index}
+	return map[string]uint64{"index": m.index}, nil, nil
+}
+
+func (m *mockKV) remove(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args mockKVArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.data[args.Key].Index != args.Index {
+		return nil, nil, cerrors.NewWithCode(cerrors.CodeConflict, "failed to delete atomically", nil)
+	}
+	delete(m.data, args.Key)
+	return nil, nil, nil
+}
@@ -0,0 +1,192 @@
+package workflow
+
+import (
+	"encoding/json"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+	kvp "github.com/cerana/cerana/providers/kv"
+	"golang.org/x/net/context"
+)
+
+// Store persists workflow state so that interrupted workflows can be resumed.
+type Store interface {
+	// Load returns the state of a workflow, or nil if there is none.
+	Load(id string) (*State, error)
+	// Save stores the state of a workflow, failing with a conflict if the
+	// state was modified since it was loaded or last saved.
+	Save(state *State) error
+	// Delete removes the state of a workflow.
+	Delete(state *State) error
+	// List returns the IDs of the workflows with stored state.
+	List() ([]string, error)
+}
+
+// KVStore is a Store keeping workflow state in the cluster kv through the
+// kv provider's tasks.
+type KVStore struct {
+	kv     *kvp.Client
+	prefix string
+}
+
+// NewKVStore creates a new KVStore, keeping state under the prefix.
+func NewKVStore(tracker *acomm.Tracker, coordinatorURL *url.URL, timeout time.Duration, prefix string) *KVStore {
+	return &KVStore{
+		kv:     kvp.NewClient(acomm.NewClient(tracker, coordinatorURL, timeout)),
+		prefix: prefix,
+	}
+}
+
+// key returns the kv key of a workflow's state. The id is escaped so that
+// it is always a single path element.
+func (s *KVStore) key(id string) string {
+	return path.Join(s.prefix, url.QueryEscape(id))
+}
+
+// Load returns the state of a workflow, or nil if there is none.
+func (s *KVStore) Load(id string) (*State, error) {
+	errData := map[string]interface{}{"workflow": id, "key": s.key(id)}
+	value, err := s.kv.Get(context.Background(), s.key(id))
+	if err != nil {
+		if errors.IsCode(err, errors.CodeNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrapv(err, errData)
+	}
+
+	state := &State{}
+	if err := json.Unmarshal(value.Data, state); err != nil {
+		return nil, errors.Wrapv(err, errData)
+	}
+	state.Index = value.Index
+	return state, nil
+}
+
+// Save stores the state of a workflow.
+func (s *KVStore) Save(state *State) error {
+	errData := map[string]interface{}{"workflow": state.ID, "index": state.Index}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrapv(err, errData)
+	}
+
+	index, err := s.kv.Update(context.Background(), s.key(state.ID), string(data), state.Index)
+	if err != nil {
+		return errors.Wrapv(err, errData)
+	}
+	state.Index = index
+	return nil
+}
+
+// Delete removes the state of a workflow.
+func (s *KVStore) Delete(state *State) error {
+	err := s.kv.Remove(context.Background(), s.key(state.ID), state.Index)
+	return errors.Wrapv(err, map[string]interface{}{"workflow": state.ID, "index": state.Index})
+}
+
+// List returns the IDs of the workflows with stored state.
+func (s *KVStore) List() ([]string, error) {
+	keys, err := s.kv.Keys(context.Background(), s.prefix)
+	if err != nil {
+		if errors.IsCode(err, errors.CodeNotFound) {
+			return nil, nil
+		}
+		return nil, errors.Wrapv(err, map[string]interface{}{"prefix": s.prefix})
+	}
+
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if strings.HasSuffix(key, "/") {
+			continue
+		}
+		id, err := url.QueryUnescape(path.Base(key))
+		if err != nil {
+			return nil, errors.Wrapv(err, map[string]interface{}{"key": key})
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// MemoryStore is a Store keeping workflow state in memory, for workflows that
+// need not survive the process.
+type MemoryStore struct {
+	lock   sync.Mutex // Protects states and index
+	states map[string][]byte
+	index  map[string]uint64
+	next   uint64
+}
+
+// NewMemoryStore creates a new MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		states: make(map[string][]byte),
+		index:  make(map[string]uint64),
+	}
+}
+
+// Load returns the state of a workflow, or nil if there is none.
+func (s *MemoryStore) Load(id string) (*State, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	data, ok := s.states[id]
+	if !ok {
+		return nil, nil
+	}
+	state := &State{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"workflow": id})
+	}
+	state.Index = s.index[id]
+	return state, nil
+}
+
+// Save stores the state of a workflow.
+func (s *MemoryStore) Save(state *State) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if state.Index != s.index[state.ID] {
+		return errors.NewWithCode(errors.CodeConflict, "workflow state modified", map[string]interface{}{"workflow": state.ID})
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrapv(err, map[string]interface{}{"workflow": state.ID})
+	}
+	s.next++
+	s.states[state.ID] = data
+	s.index[state.ID] = s.next
+	state.Index = s.next
+	return nil
+}
+
+// Delete removes the state of a workflow.
+func (s *MemoryStore) Delete(state *State) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if state.Index != s.index[state.ID] {
+		return errors.NewWithCode(errors.CodeConflict, "workflow state modified", map[string]interface{}{"workflow": state.ID})
+	}
+	delete(s.states, state.ID)
+	delete(s.index, state.ID)
+	return nil
+}
+
+// List returns the IDs of the workflows with stored state.
+func (s *MemoryStore) List() ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ids := make([]string, 0, len(s.states))
+	for id := range s.states {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,200 @@
+package workflow
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+// Status is the status of a workflow or one of its steps.
+type Status string
+
+// Workflow and step statuses.
+const (
+	StatusPending      Status = "pending"
+	StatusRunning      Status = "running"
+	StatusCompleted    Status = "completed"
+	StatusSkipped      Status = "skipped"
+	StatusFailed       Status = "failed"
+	StatusCompensating Status = "compensating"
+	StatusCompensated  Status = "compensated"
+)
+
+// Action is a task request made by a workflow.
+type Action struct {
+	Task    string
+	TaskURL *url.URL
+	// Target, if set, routes the request to a node resolved by the cluster
+	// coordinator instead of the TaskURL.
+	Target *acomm.Target
+	Args   interface{}
+	// Retries is the number of times the request is retried if it fails.
+	Retries int
+	// Prepare, if set, is called with the workflow state before the request
+	// is made, to adjust it using the results of earlier steps.
+	Prepare func(*State, *acomm.RequestOptions) error
+}
+
+// Step is a named action within a workflow. A step runs once all of the
+// steps it depends on have completed or been skipped, in parallel with any
+// other steps that are ready. If a later step fails, the Compensate action
+// of each completed step is run to undo its effects.
+type Step struct {
+	Action
+	Name      string
+	DependsOn []string
+	// When, if set, is called once the dependencies are done. The step is
+	// skipped if it returns false.
+	When       func(*State) (bool, error)
+	Compensate *Action
+}
+
+// Workflow is a set of steps run together. The ID identifies a particular
+// run, so running a workflow with the ID of one that was interrupted resumes
+// it. The Name and Input are stored with its state, allowing an Engine to
+// rebuild the workflow with a registered Builder when resuming.
+type Workflow struct {
+	ID    string
+	Name  string
+	Input interface{}
+	Steps []*Step
+}
+
+// Builder rebuilds a workflow from its ID and input.
+type Builder func(id string, input json.RawMessage) (*Workflow, error)
+
+// validate checks that the workflow's steps are uniquely named and that
+// their dependencies exist and are acyclic.
+func (w *Workflow) validate() error {
+	errData := map[string]interface{}{"workflow": w.ID}
+	if w.ID == "" {
+		return errors.NewWithCode(errors.CodeInvalidArgument, "missing workflow id", errData)
+	}
+	if len(w.Steps) == 0 {
+		return errors.NewWithCode(errors.CodeInvalidArgument, "workflow has no steps", errData)
+	}
+
+	steps := make(map[string]*Step, len(w.Steps))
+	for _, step := range w.Steps {
+		errData["step"] = step.Name
+		if step.Name == "" {
+			return errors.NewWithCode(errors.CodeInvalidArgument, "missing step name", errData)
+		}
+		if step.Task == "" {
+			return errors.NewWithCode(errors.CodeInvalidArgument, "missing step task", errData)
+		}
+		if step.Compensate != nil && step.Compensate.Task == "" {
+			return errors.NewWithCode(errors.CodeInvalidArgument, "missing compensation task", errData)
+		}
+		if _, ok := steps[step.Name]; ok {
+			return errors.NewWithCode(errors.CodeInvalidArgument, "duplicate step name", errData)
+		}
+		steps[step.Name] = step
+	}
+
+	for _, step := range w.Steps {
+		for _, dep := range step.DependsOn {
+			if _, ok := steps[dep]; !ok {
+				errData["step"] = step.Name
+				errData["dependency"] = dep
+				return errors.NewWithCode(errors.CodeInvalidArgument, "unknown step dependency", errData)
+			}
+		}
+	}
+
+	// Depth first search for cycles
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	marks := make(map[string]int, len(w.Steps))
+	var visit func(*Step) error
+	visit = func(step *Step) error {
+		switch marks[step.Name] {
+		case visiting:
+			errData["step"] = step.Name
+			return errors.NewWithCode(errors.CodeInvalidArgument, "step dependency cycle", errData)
+		case visited:
+			return nil
+		}
+		marks[step.Name] = visiting
+		for _, dep := range step.DependsOn {
+			if err := visit(steps[dep]); err != nil {
+				return err
+			}
+		}
+		marks[step.Name] = visited
+		return nil
+	}
+	for _, step := range w.Steps {
+		if err := visit(step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// State is the persisted progress of a workflow run.
+type State struct {
+	ID     string                `json:"id"`
+	Name   string                `json:"name,omitempty"`
+	Input  json.RawMessage       `json:"input,omitempty"`
+	Status Status                `json:"status"`
+	Error  string                `json:"error,omitempty"`
+	Steps  map[string]*StepState `json:"steps"`
+	// Index is the store's modification index of the state, used to detect
+	// concurrent runs of the same workflow.
+	Index uint64 `json:"-"`
+}
+
+// StepState is the persisted progress of a step.
+type StepState struct {
+	Status   Status          `json:"status"`
+	Attempts int             `json:"attempts,omitempty"`
+	Seq      int             `json:"seq,omitempty"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// newState creates the initial state of a workflow.
+func newState(w *Workflow) (*State, error) {
+	state := &State{
+		ID:     w.ID,
+		Name:   w.Name,
+		Status: StatusRunning,
+		Steps:  make(map[string]*StepState, len(w.Steps)),
+	}
+	if w.Input != nil {
+		input, err := json.Marshal(w.Input)
+		if err != nil {
+			return nil, errors.Wrapv(err, map[string]interface{}{"workflow": w.ID})
+		}
+		state.Input = input
+	}
+	for _, step := range w.Steps {
+		state.Steps[step.Name] = &StepState{Status: StatusPending}
+	}
+	return state, nil
+}
+
+// Result unmarshals the result of a completed step into dest.
+func (s *State) Result(step string, dest interface{}) error {
+	errData := map[string]interface{}{"workflow": s.ID, "step": step}
+
+	stepState, ok := s.Steps[step]
+	if !ok || stepState.Status != StatusCompleted {
+		return errors.NewWithCode(errors.CodeNotFound, "step not completed", errData)
+	}
+	if len(stepState.Result) == 0 {
+		return nil
+	}
+	return errors.Wrapv(json.Unmarshal(stepState.Result, dest), errData)
+}
+
+// Completed returns whether the step has completed.
+func (s *State) Completed(step string) bool {
+	stepState, ok := s.Steps[step]
+	return ok && stepState.Status == StatusCompleted
+}